@@ -0,0 +1,54 @@
+// Package apitest serves the API over an in-memory repository, so that tests
+// can call its endpoints end-to-end without SQLite or a listener.
+package apitest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2/humatest"
+
+	"ldapmerge/internal/api"
+	"ldapmerge/internal/repository"
+)
+
+// API is a server whose requests are made with the methods of
+// humatest.TestAPI, such as Get and Post. They go through the server's
+// middleware, as requests to its listener do.
+type API struct {
+	humatest.TestAPI
+
+	// Server is the server under test
+	Server *api.Server
+	// Repo is the repository of Server, to seed data and check writes
+	Repo *repository.Memory
+}
+
+// New returns an API with default options and an empty repository.
+func New(t testing.TB) *API {
+	t.Helper()
+	return NewWithOptions(t, api.DefaultOptions())
+}
+
+// NewWithOptions returns an API with the given options and an empty
+// repository.
+func NewWithOptions(t testing.TB, opts api.Options) *API {
+	t.Helper()
+	repo := repository.NewMemory()
+	srv := api.NewServerWithOptions(":0", repo, opts)
+	return &API{
+		TestAPI: humatest.Wrap(t, srv.API()),
+		Server:  srv,
+		Repo:    repo,
+	}
+}
+
+// Decode decodes a JSON response body into v, failing t if it cannot.
+func Decode[T any](t testing.TB, body []byte) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("invalid response body %s: %v", body, err)
+	}
+	return v
+}
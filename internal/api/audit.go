@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/logging"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+)
+
+// maxAuditedBody is the most of a request body that is read to hash it
+// once the handler is done with it; the digest of a larger body is left
+// out of its audit event.
+const maxAuditedBody = 64 << 20
+
+// callerKey is the context key of the caller of a request.
+type callerKey struct{}
+
+// withCaller sets the caller authenticated by the keyring on req: the API
+// key name, oidc:<user> or cert:<subject>.
+func withCaller(req bunrouter.Request, caller string) bunrouter.Request {
+	return req.WithContext(context.WithValue(req.Context(), callerKey{}, caller))
+}
+
+// caller returns the caller of the request of ctx, or "" when the API is
+// served without keys.
+func caller(ctx context.Context) string {
+	name, _ := ctx.Value(callerKey{}).(string)
+	return name
+}
+
+// sourceIPKey is the context key of the client IP of a request.
+type sourceIPKey struct{}
+
+// sourceIP returns the client IP of the request of ctx, as set by
+// auditMiddleware.
+func sourceIP(ctx context.Context) string {
+	ip, _ := ctx.Value(sourceIPKey{}).(string)
+	return ip
+}
+
+// auditMiddleware records every POST, PUT, PATCH and DELETE to the API in
+// the audit log with its caller, status and the SHA-256 of its body. The
+// body itself is not stored: it may hold NSX credentials.
+func (s *Server) auditMiddleware(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		if s.audit == nil || !isMutating(req.Method) || isPublic(req.URL.Path) {
+			return next(w, req)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), sourceIPKey{}, clientIP(req.Request)))
+
+		if req.Body == nil {
+			req.Body = http.NoBody
+		}
+		body := &hashingBody{ReadCloser: req.Body, hash: sha256.New()}
+		req.Body = body
+		rw := &statusWriter{ResponseWriter: w}
+		err := next(rw, req)
+
+		event := &models.AuditEvent{
+			Operation:  audit.OperationAPIRequest,
+			Origin:     audit.OriginAPI,
+			Actor:      caller(req.Context()),
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			Status:     rw.Status(),
+			ClientCert: clientCert(req.Context()),
+			SourceIP:   sourceIP(req.Context()),
+			Outcome:    audit.OutcomeSuccess,
+		}
+		if event.Status >= http.StatusBadRequest {
+			event.Outcome = audit.OutcomeFailed
+		}
+		if digest, derr := body.sum(); derr != nil {
+			event.Error = derr.Error()
+		} else {
+			event.BodySHA256 = digest
+		}
+
+		// The request has been served, so a failure to record it is logged
+		// rather than returned
+		ctx := req.Context()
+		if rerr := s.audit.Record(context.WithoutCancel(ctx), event); rerr != nil {
+			logging.RunLogger(ctx).Error("audit event not recorded", "operation", event.Operation, "path", event.Path, "error", rerr)
+		}
+		return err
+	}
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// hashingBody hashes a request body as the handler reads it.
+type hashingBody struct {
+	io.ReadCloser
+	hash hash.Hash
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	return n, err
+}
+
+// sum reads what the handler left of the body, up to maxAuditedBody, and
+// returns its hex SHA-256.
+func (b *hashingBody) sum() (string, error) {
+	n, err := io.Copy(io.Discard, io.LimitReader(b, maxAuditedBody+1))
+	if err != nil {
+		return "", fmt.Errorf("request body not hashed: %w", err)
+	}
+	if n > maxAuditedBody {
+		return "", fmt.Errorf("request body not hashed: more than %d MiB left unread", maxAuditedBody>>20)
+	}
+	return hex.EncodeToString(b.hash.Sum(nil)), nil
+}
+
+// statusWriter records the status of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Status returns the status written, 200 if the handler wrote none.
+func (w *statusWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AuditListInput selects audit events
+type AuditListInput struct {
+	Actor      string    `query:"actor" doc:"Only events of this actor: OS user, API key name, oidc:<user> or cert:<subject>" example:"ansible"`
+	SourceIP   string    `query:"source_ip" doc:"Only API events from this client IP" example:"192.0.2.10"`
+	Operation  string    `query:"operation" enum:"nsx.push,nsx.delete,sync.push,history.push,snapshot.restore,bundle.push,api.request" doc:"Only events of this operation"`
+	BodySHA256 string    `query:"body_sha256" pattern:"^[0-9a-f]{64}$" doc:"Only api.request events whose body has this hex SHA-256"`
+	Since      time.Time `query:"since" doc:"Only events at or after this time (RFC 3339)"`
+	Until      time.Time `query:"until" doc:"Only events at or before this time (RFC 3339)"`
+	Limit      int       `query:"limit" minimum:"1" maximum:"1000" default:"100" doc:"Maximum number of events to return"`
+}
+
+// AuditListOutput is the response for the audit log
+type AuditListOutput struct {
+	Body []models.AuditEvent
+}
+
+func (s *Server) handleListAudit(ctx context.Context, input *AuditListInput) (*AuditListOutput, error) {
+	// Events are not scoped to a tenant: they record the calls of every key
+	if err := requireAdmin(ctx, "audit events"); err != nil {
+		return nil, err
+	}
+	if s.repo == nil {
+		return &AuditListOutput{Body: []models.AuditEvent{}}, nil
+	}
+	if !input.Since.IsZero() && !input.Until.IsZero() && input.Until.Before(input.Since) {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, "until is before since")
+	}
+
+	events, err := s.repo.ListAuditEvents(ctx, repository.AuditFilter{
+		Actor:      input.Actor,
+		SourceIP:   input.SourceIP,
+		Operation:  input.Operation,
+		BodySHA256: input.BodySHA256,
+		Since:      input.Since,
+		Until:      input.Until,
+		Limit:      input.Limit,
+	})
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to list audit events", err)
+	}
+
+	return &AuditListOutput{Body: events}, nil
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+)
+
+// changeEvents returns the audit events of repo other than api.request,
+// newest first.
+func changeEvents(t *testing.T, repo *repository.Repository) []models.AuditEvent {
+	t.Helper()
+	events, err := repo.ListAuditEvents(t.Context(), repository.AuditFilter{})
+	if err != nil {
+		t.Fatalf("ListAuditEvents failed: %v", err)
+	}
+	changes := []models.AuditEvent{}
+	for _, e := range events {
+		if e.Operation != audit.OperationAPIRequest {
+			changes = append(changes, e)
+		}
+	}
+	return changes
+}
+
+func TestAuditMutatingRequests(t *testing.T) {
+	repo, err := repository.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+
+	opts := DefaultOptions()
+	opts.APIKeys = []APIKey{{Name: "ansible", Key: "ansible-key-0123456789"}}
+	s := NewServerWithOptions(":0", repo, opts)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	config := `{"name":"prod","host":"https://nsx.example.lab","username":"admin","password":"secret","insecure":false}`
+	if rec := do(http.MethodPost, "/api/configs", "ansible-key-0123456789", config); rec.Code != http.StatusCreated {
+		t.Fatalf("Create config failed: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/api/configs", "ansible-key-0123456789", `{"name":`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for an invalid body, got %d", rec.Code)
+	}
+	// Neither reads nor unauthenticated requests are recorded
+	do(http.MethodGet, "/api/configs", "ansible-key-0123456789", "")
+	do(http.MethodPost, "/api/configs", "", config)
+
+	events, err := repo.ListAuditEvents(t.Context(), repository.AuditFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to list audit events: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 audit events, got %+v", events)
+	}
+
+	invalid, created := events[0], events[1]
+	sum := sha256.Sum256([]byte(config))
+	if created.Operation != audit.OperationAPIRequest || created.Origin != audit.OriginAPI ||
+		created.Actor != "ansible" || created.Method != http.MethodPost || created.Path != "/api/configs" ||
+		created.Status != http.StatusCreated || created.Outcome != audit.OutcomeSuccess ||
+		created.BodySHA256 != hex.EncodeToString(sum[:]) || created.RunID == "" || created.SourceIP != "192.0.2.1" {
+		t.Errorf("Unexpected event for the created config: %+v", created)
+	}
+	if invalid.Status != http.StatusBadRequest || invalid.Outcome != audit.OutcomeFailed || invalid.BodySHA256 == "" {
+		t.Errorf("Unexpected event for the invalid request: %+v", invalid)
+	}
+}
+
+func TestListAudit(t *testing.T) {
+	s, repo := setupTestServer(t)
+
+	config := `{"name":"prod","host":"https://nsx.example.lab","username":"admin","password":"secret","insecure":false}`
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/configs", strings.NewReader(strings.Replace(config, "prod", ip, 1)))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":40000"
+		s.router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err := repo.AddAuditEvent(t.Context(), &models.AuditEvent{Operation: audit.OperationNSXPush, Origin: audit.OriginCLI,
+		Actor: "jdoe", NSXHost: "https://nsx.example.lab", Reason: "CHG-1", Outcome: audit.OutcomeSuccess}); err != nil {
+		t.Fatalf("AddAuditEvent failed: %v", err)
+	}
+
+	list := func(query string) []models.AuditEvent {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/audit"+query, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /api/audit%s: %d %s", query, rec.Code, rec.Body.String())
+		}
+		var events []models.AuditEvent
+		if err := json.Unmarshal(rec.Body.Bytes(), &events); err != nil {
+			t.Fatalf("Invalid response: %v", err)
+		}
+		return events
+	}
+
+	if events := list(""); len(events) != 3 || events[0].Operation != audit.OperationNSXPush {
+		t.Errorf("Expected all 3 events, newest first, got %+v", events)
+	}
+	if events := list("?limit=1"); len(events) != 1 {
+		t.Errorf("Expected 1 event with limit=1, got %d", len(events))
+	}
+	if events := list("?actor=jdoe"); len(events) != 1 || events[0].Actor != "jdoe" {
+		t.Errorf("Expected the event of jdoe, got %+v", events)
+	}
+
+	requests := list("?operation=api.request&source_ip=192.0.2.2")
+	if len(requests) != 1 || requests[0].SourceIP != "192.0.2.2" || requests[0].BodySHA256 == "" {
+		t.Fatalf("Expected the request from 192.0.2.2, got %+v", requests)
+	}
+	if events := list("?body_sha256=" + requests[0].BodySHA256); len(events) != 1 || events[0].ID != requests[0].ID {
+		t.Errorf("Expected the request with the digest, got %+v", events)
+	}
+	if events := list("?until=2000-01-01T00:00:00Z"); len(events) != 0 {
+		t.Errorf("Expected no events before 2000, got %d", len(events))
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/audit?body_sha256=abc", nil))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for an invalid digest, got %d", rec.Code)
+	}
+}
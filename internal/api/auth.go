@@ -0,0 +1,209 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/uptrace/bunrouter"
+
+	"ldapmerge/internal/oidc"
+	"ldapmerge/internal/repository"
+)
+
+// APIKey grants access to the API. Requests made with a key bound to a
+// tenant see and create only that tenant's NSX configurations, history,
+// documents and snapshots; a key without a tenant sees those of every
+// tenant.
+type APIKey struct {
+	Name   string // identifies the key in logs
+	Key    string
+	Tenant string
+	// CertSubjects lists the client certificates that act as the key over
+	// mutual TLS, each as its full subject (CN=ansible-01,O=Example) or the
+	// hex SHA-256 fingerprint of the certificate
+	CertSubjects []string `mapstructure:"cert_subjects"`
+}
+
+// OIDC accepts the JWT bearer tokens of an OpenID Connect issuer besides
+// API keys. The claims of a token are set on the request context (see
+// oidc.ClaimsFrom).
+type OIDC struct {
+	Verifier *oidc.Verifier
+	// TenantClaim names the claim holding the tenant of a token, which is
+	// then required; empty makes tokens unscoped, like API keys without a
+	// tenant
+	TenantClaim string
+}
+
+// publicPaths are served without an API key: health checks, metrics and the
+// API documentation. Paths ending in / cover the paths under them; the
+// others also cover their file variants, such as /openapi.json.
+var publicPaths = []string{"/api/health", "/readyz", "/metrics", "/docs", "/docs/", "/openapi", "/schemas/"}
+
+// keyring checks the API key or bearer token of requests.
+type keyring struct {
+	keys []hashedKey
+	oidc *OIDC
+}
+
+// hashedKey is an API key compared by its SHA-256, in constant time.
+type hashedKey struct {
+	APIKey
+	sum [sha256.Size]byte
+}
+
+func newKeyring(keys []APIKey, oidc *OIDC) *keyring {
+	k := &keyring{oidc: oidc}
+	for _, key := range keys {
+		k.keys = append(k.keys, hashedKey{APIKey: key, sum: sha256.Sum256([]byte(key.Key))})
+	}
+	return k
+}
+
+// certKey returns the first API key listing the client certificate of
+// subject and fingerprint in its CertSubjects, if any.
+func (k *keyring) certKey(subject, fingerprint string) (*APIKey, bool) {
+	for i := range k.keys {
+		for _, s := range k.keys[i].CertSubjects {
+			if fp := normalizeFingerprint(s); s == subject || (fp != "" && fp == fingerprint) {
+				return &k.keys[i].APIKey, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// lookup returns the API key matching key, if any.
+func (k *keyring) lookup(key string) (*APIKey, bool) {
+	sum := sha256.Sum256([]byte(key))
+	var found *APIKey
+	for i := range k.keys {
+		// Every key is compared, so the time taken does not reveal which matched
+		if subtle.ConstantTimeCompare(sum[:], k.keys[i].sum[:]) == 1 {
+			found = &k.keys[i].APIKey
+		}
+	}
+	return found, found != nil
+}
+
+// middleware rejects requests without a valid API key or bearer token,
+// except to publicPaths and requests made with a verified client
+// certificate, sets the caller of the request (see caller) and scopes the
+// repository to the tenant of the key, token or certificate (see serveCert).
+// Without keys or OIDC, every request is served unscoped.
+// Requests made with a key or token without a tenant, or a certificate
+// acting as such a key, or with neither configured, may set DebugHeader.
+func (k *keyring) middleware(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		if len(k.keys) == 0 && k.oidc == nil {
+			return next(w, debugRequest(w, req, ""))
+		}
+		if isPublic(req.URL.Path) {
+			return next(w, req)
+		}
+
+		credential := requestKey(req.Request)
+		if clientCert(req.Context()) != "" && credential == "" {
+			// The TLS handshake verified the client certificate
+			return k.serveCert(w, req, next)
+		}
+		if k.oidc != nil && oidc.IsJWT(credential) {
+			return k.serveToken(w, req, next, credential)
+		}
+
+		key, ok := k.lookup(credential)
+		if !ok {
+			return unauthorized(w, "missing or invalid API key")
+		}
+
+		req = withCaller(req, key.Name)
+		if key.Tenant == "" {
+			return next(w, debugRequest(w, req, key.Name))
+		}
+		return next(w, req.WithContext(repository.WithTenant(req.Context(), key.Tenant)))
+	}
+}
+
+// serveCert serves req, authenticated by its client certificate alone. A
+// certificate listed in the CertSubjects of an API key acts as that key:
+// scoped to its tenant, if it has one. Any other certificate is scoped to
+// the default tenant, so it does not see the configurations of other
+// tenants, pass requireAdmin or set DebugHeader.
+func (k *keyring) serveCert(w http.ResponseWriter, req bunrouter.Request, next bunrouter.HandlerFunc) error {
+	subject := clientCert(req.Context())
+	name := "cert:" + subject
+	req = withCaller(req, name)
+
+	key, ok := k.certKey(subject, clientCertFingerprint(req.Context()))
+	switch {
+	case !ok:
+		return next(w, req.WithContext(repository.WithTenant(req.Context(), "")))
+	case key.Tenant == "":
+		return next(w, debugRequest(w, req, name))
+	default:
+		return next(w, req.WithContext(repository.WithTenant(req.Context(), key.Tenant)))
+	}
+}
+
+// serveToken serves req, authenticated with the JWT bearer token, with its
+// claims set on the context.
+func (k *keyring) serveToken(w http.ResponseWriter, req bunrouter.Request, next bunrouter.HandlerFunc, token string) error {
+	ctx := req.Context()
+	claims, err := k.oidc.Verifier.Verify(ctx, token)
+	if err != nil {
+		if !errors.Is(err, oidc.ErrInvalidToken) {
+			slog.ErrorContext(ctx, "failed to verify bearer token", "issuer", k.oidc.Verifier.Issuer(), "error", err)
+			return unauthorized(w, "bearer token could not be verified")
+		}
+		slog.WarnContext(ctx, "bearer token rejected", "path", req.URL.Path, "error", err)
+		return unauthorized(w, "invalid bearer token")
+	}
+	ctx = oidc.WithClaims(ctx, claims)
+	req = withCaller(req.WithContext(ctx), "oidc:"+claims.Principal())
+	ctx = req.Context()
+
+	if k.oidc.TenantClaim == "" {
+		return next(w, debugRequest(w, req, caller(ctx)))
+	}
+	tenant := claims.String(k.oidc.TenantClaim)
+	if tenant == "" {
+		slog.WarnContext(ctx, "bearer token rejected", "path", req.URL.Path, "subject", claims.Subject, "error", "no "+k.oidc.TenantClaim+" claim")
+		return unauthorized(w, "bearer token has no "+k.oidc.TenantClaim+" claim")
+	}
+	return next(w, req.WithContext(repository.WithTenant(ctx, tenant)))
+}
+
+// unauthorized refuses a request with 401 and msg.
+func unauthorized(w http.ResponseWriter, msg string) error {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="ldapmerge"`)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(http.StatusUnauthorized)
+	return json.NewEncoder(w).Encode(newErrorModel(http.StatusUnauthorized, CodeUnauthorized, msg))
+}
+
+// requestKey returns the API key of a request, from X-API-Key or an
+// "Authorization: Bearer" header.
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func isPublic(path string) bool {
+	for _, p := range publicPaths {
+		if path == p || strings.HasPrefix(path, p+".") || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/logging"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/oidc"
+	"ldapmerge/internal/repository"
+)
+
+func TestAPIKeys(t *testing.T) {
+	repo, err := repository.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+
+	opts := DefaultOptions()
+	opts.APIKeys = []APIKey{
+		{Name: "admin", Key: "admin-key-0123456789"},
+		{Name: "red", Key: "red-key-0123456789", Tenant: "red"},
+		{Name: "blue", Key: "blue-key-0123456789", Tenant: "blue"},
+	}
+	s := NewServerWithOptions(":0", repo, opts)
+
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "/api/health", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected /api/health without a key to succeed, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/health/history", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected /api/health/history to require a key, got %d", rec.Code)
+	}
+	for _, key := range []string{"", "wrong-key-0123456789"} {
+		rec := do(http.MethodGet, "/api/configs", key, "")
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 with key %q, got %d", key, rec.Code)
+		}
+		var body ErrorModel
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != CodeUnauthorized {
+			t.Errorf("Expected %s, got %s (%v)", CodeUnauthorized, rec.Body.String(), err)
+		}
+	}
+
+	// Tenants may use the same config name
+	config := `{"name":"prod","host":"https://nsx.example.lab","username":"admin","password":"secret","insecure":false}`
+	var red models.NSXConfig
+	for _, key := range []string{"red-key-0123456789", "blue-key-0123456789"} {
+		rec := do(http.MethodPost, "/api/configs", key, config)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Create config failed: %d %s", rec.Code, rec.Body.String())
+		}
+		if key == "red-key-0123456789" {
+			_ = json.Unmarshal(rec.Body.Bytes(), &red)
+		}
+	}
+	if red.Tenant != "red" {
+		t.Errorf("Expected config of tenant red, got %q", red.Tenant)
+	}
+
+	var configs []models.NSXConfig
+	rec := do(http.MethodGet, "/api/configs", "blue-key-0123456789", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &configs); err != nil || len(configs) != 1 || configs[0].Tenant != "blue" {
+		t.Errorf("Expected only the config of tenant blue, got %s", rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/configs/"+strconv.FormatInt(red.ID, 10), "blue-key-0123456789", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the config of another tenant, got %d", rec.Code)
+	}
+	rec = do(http.MethodGet, "/api/configs", "admin-key-0123456789", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &configs); err != nil || len(configs) != 2 {
+		t.Errorf("Expected the admin key to see both configs, got %s", rec.Body.String())
+	}
+
+	// History is scoped the same way
+	entry, err := repo.SaveHistory(repository.WithTenant(context.Background(), "red"), nil, models.CertificateResponse{}, nil)
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	path := "/api/history/" + strconv.FormatInt(entry.ID, 10)
+	if rec := do(http.MethodGet, path, "blue-key-0123456789", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the history of another tenant, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, path, "red-key-0123456789", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected the history of the own tenant, got %d", rec.Code)
+	}
+
+	// So are documents and snapshots
+	rec = do(http.MethodPost, "/api/documents", "red-key-0123456789", `{"name":"initial","kind":"initial","content":[]}`)
+	var doc models.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil || rec.Code != http.StatusCreated || doc.Tenant != "red" {
+		t.Fatalf("Create document failed: %d %s", rec.Code, rec.Body.String())
+	}
+	snapshot := &models.Snapshot{Operation: "nsx.push", NSXHost: "https://nsx.example.lab"}
+	if err := repo.AddSnapshot(repository.WithTenant(context.Background(), "red"), snapshot); err != nil {
+		t.Fatalf("AddSnapshot failed: %v", err)
+	}
+	for _, path := range []string{"/api/documents/" + strconv.FormatInt(doc.ID, 10), "/api/snapshots/" + strconv.FormatInt(snapshot.ID, 10)} {
+		if rec := do(http.MethodGet, path, "blue-key-0123456789", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for %s of another tenant, got %d", path, rec.Code)
+		}
+		if rec := do(http.MethodGet, path, "red-key-0123456789", ""); rec.Code != http.StatusOK {
+			t.Errorf("Expected %s of the own tenant, got %d", path, rec.Code)
+		}
+	}
+	if rec := do(http.MethodDelete, "/api/documents/"+strconv.FormatInt(doc.ID, 10), "blue-key-0123456789", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 deleting the document of another tenant, got %d", rec.Code)
+	}
+	for _, path := range []string{"/api/documents", "/api/snapshots"} {
+		var items []json.RawMessage
+		if rec := do(http.MethodGet, path, "blue-key-0123456789", ""); json.Unmarshal(rec.Body.Bytes(), &items) != nil || len(items) != 0 {
+			t.Errorf("Expected no %s of another tenant, got %s", path, rec.Body.String())
+		}
+		if rec := do(http.MethodGet, path, "admin-key-0123456789", ""); json.Unmarshal(rec.Body.Bytes(), &items) != nil || len(items) != 1 {
+			t.Errorf("Expected the admin key to see the %s of every tenant, got %s", path, rec.Body.String())
+		}
+	}
+
+	// Inventory servers are seen by the tenants of their NSX Manager
+	if _, err := repo.UpdateInventory(context.Background(), "https://nsx.example.lab", []models.Domain{
+		{ID: "example.lab", LDAPServers: []models.LDAPServer{{URL: "ldaps://ad-01.example.lab:636", Enabled: "true"}}},
+	}); err != nil {
+		t.Fatalf("UpdateInventory failed: %v", err)
+	}
+	if _, err := repo.UpdateInventory(context.Background(), "https://nsx-other.example.lab", []models.Domain{
+		{ID: "example.org", LDAPServers: []models.LDAPServer{{URL: "ldaps://dc01.example.org:636", Enabled: "true"}}},
+	}); err != nil {
+		t.Fatalf("UpdateInventory failed: %v", err)
+	}
+	var servers []models.InventoryServer
+	rec = do(http.MethodGet, "/api/servers", "blue-key-0123456789", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &servers); err != nil || len(servers) != 1 || servers[0].NSXHost != "https://nsx.example.lab" {
+		t.Errorf("Expected the server of the tenant's NSX Manager, got %s", rec.Body.String())
+	}
+	rec = do(http.MethodGet, "/api/servers", "admin-key-0123456789", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &servers); err != nil || len(servers) != 2 {
+		t.Errorf("Expected the admin key to see every server, got %s", rec.Body.String())
+	}
+	blue := repository.WithTenant(context.Background(), "blue")
+	if configs, err := repo.ListConfigs(blue); err != nil || len(configs) != 1 {
+		t.Fatalf("ListConfigs failed: %v", err)
+	} else if err := repo.DeleteConfig(blue, configs[0].ID); err != nil {
+		t.Fatalf("DeleteConfig failed: %v", err)
+	}
+	rec = do(http.MethodGet, "/api/servers", "blue-key-0123456789", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &servers); err != nil || len(servers) != 0 {
+		t.Errorf("Expected no servers without a config, got %s", rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/api/servers/1/probes", "blue-key-0123456789", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for the probes of a server of another tenant, got %d", rec.Code)
+	}
+
+	// The audit log spans every tenant
+	if rec := do(http.MethodGet, "/api/audit", "blue-key-0123456789", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for the audit log with a tenant key, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/api/audit", "admin-key-0123456789", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected the audit log with the admin key, got %d", rec.Code)
+	}
+}
+
+func TestDebugHeader(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(logging.NewContextHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn}))))
+
+	opts := DefaultOptions()
+	opts.APIKeys = []APIKey{
+		{Name: "admin", Key: "admin-key-0123456789"},
+		{Name: "red", Key: "red-key-0123456789", Tenant: "red"},
+	}
+	repo, err := repository.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+	s := NewServerWithOptions(":0", repo, opts)
+
+	do := func(key, debug string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/configs", nil)
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set(DebugHeader, debug)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, tc := range []struct{ key, debug string }{
+		{"admin-key-0123456789", "false"},
+		{"red-key-0123456789", "true"},
+	} {
+		if rec := do(tc.key, tc.debug); rec.Header().Get(DebugRequestHeader) != "" {
+			t.Errorf("Expected no debug logging with key %s and %s, got %s", tc.key, tc.debug, rec.Header().Get(DebugRequestHeader))
+		}
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing logged below warn, got %s", buf.String())
+	}
+
+	rec := do("admin-key-0123456789", "1")
+	id := rec.Header().Get(DebugRequestHeader)
+	if id == "" {
+		t.Fatalf("Expected %s with an admin key", DebugRequestHeader)
+	}
+	var record struct {
+		Msg          string `json:"msg"`
+		APIKey       string `json:"api_key"`
+		DebugRequest string `json:"debug_request"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil || record.APIKey != "admin" || record.DebugRequest != id {
+		t.Errorf("Expected the request logged with debug_request %s, got %s (%v)", id, buf.String(), err)
+	}
+}
+
+func TestOIDCBearerTokens(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	var issuer *httptest.Server
+	issuer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"issuer": issuer.URL, "jwks_uri": issuer.URL + "/certs"})
+		case "/certs":
+			_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+				"kty": "EC", "kid": "k1", "crv": "P-256",
+				"x": b64(key.X.FillBytes(make([]byte, 32))), "y": b64(key.Y.FillBytes(make([]byte, 32))),
+			}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(issuer.Close)
+
+	sign := func(claims map[string]any) string {
+		header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "k1", "typ": "JWT"})
+		payload, _ := json.Marshal(claims)
+		signed := b64(header) + "." + b64(payload)
+		digest := sha256.Sum256([]byte(signed))
+		r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+		return signed + "." + b64(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...))
+	}
+	claims := func(tenant string) map[string]any {
+		c := map[string]any{"iss": issuer.URL, "aud": "ldapmerge", "sub": "u1", "preferred_username": "jdoe", "exp": time.Now().Add(time.Minute).Unix()}
+		if tenant != "" {
+			c["tenant"] = tenant
+		}
+		return c
+	}
+
+	repo, err := repository.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+
+	opts := DefaultOptions()
+	opts.APIKeys = []APIKey{{Name: "admin", Key: "admin-key-0123456789"}}
+	opts.OIDC = &OIDC{
+		Verifier:    oidc.NewVerifier(oidc.Config{Issuer: issuer.URL, Audience: "ldapmerge"}),
+		TenantClaim: "tenant",
+	}
+	s := NewServerWithOptions(":0", repo, opts)
+
+	do := func(method, token, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, "/api/configs", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	config := `{"name":"prod","host":"https://nsx.example.lab","username":"admin","password":"secret","insecure":false}`
+	rec := do(http.MethodPost, sign(claims("red")), config)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Create config with a token failed: %d %s", rec.Code, rec.Body.String())
+	}
+	var created models.NSXConfig
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || created.Tenant != "red" {
+		t.Errorf("Expected a config of tenant red, got %s (%v)", rec.Body.String(), err)
+	}
+
+	// API keys still work next to tokens
+	if rec := do(http.MethodGet, "admin-key-0123456789", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected the admin key to be accepted, got %d", rec.Code)
+	}
+
+	other := claims("red")
+	other["aud"] = "account"
+	noAudience := claims("red")
+	delete(noAudience, "aud")
+	expired := claims("red")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	for name, token := range map[string]string{
+		"no tenant":      sign(claims("")),
+		"other audience": sign(other),
+		"no audience":    sign(noAudience),
+		"expired":        sign(expired),
+		"tampered":       strings.Replace(sign(claims("red")), ".", ".e30", 1),
+	} {
+		rec := do(http.MethodGet, token, "")
+		var body ErrorModel
+		if rec.Code != http.StatusUnauthorized || json.Unmarshal(rec.Body.Bytes(), &body) != nil || body.Code != CodeUnauthorized {
+			t.Errorf("%s: expected 401 %s, got %d %s", name, CodeUnauthorized, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/uptrace/bunrouter"
+
+	"ldapmerge/internal/logging"
+)
+
+// DebugHeader, set to a true value by an admin key, elevates logging to
+// debug level for the request, NSX API calls included. The logs of the
+// request carry the id returned in DebugRequestHeader as debug_request.
+const (
+	DebugHeader        = "X-Debug"
+	DebugRequestHeader = "X-Debug-Request"
+)
+
+// debugRequest returns req with logging elevated to debug level if it sets
+// DebugHeader, and req as it is otherwise. key names the API key of the
+// request for the log, "" without keys.
+func debugRequest(w http.ResponseWriter, req bunrouter.Request, key string) bunrouter.Request {
+	if on, _ := strconv.ParseBool(req.Header.Get(DebugHeader)); !on {
+		return req
+	}
+
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	id := hex.EncodeToString(b)
+	w.Header().Set(DebugRequestHeader, id)
+
+	ctx := logging.WithDebug(req.Context(), id)
+	slog.InfoContext(ctx, "debug logging enabled for request", "method", req.Method, "path", req.URL.Path, "api_key", key)
+	return req.WithContext(ctx)
+}
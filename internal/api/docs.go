@@ -0,0 +1,154 @@
+package api
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/uptrace/bunrouter"
+)
+
+// DocsRenderer selects how /docs renders the OpenAPI specification
+type DocsRenderer string
+
+const (
+	// DocsRendererAuto uses the embedded Scalar bundle when the binary was
+	// built with one and the built-in renderer otherwise
+	DocsRendererAuto DocsRenderer = "auto"
+	// DocsRendererScalar serves Scalar from the bundle embedded in the binary
+	DocsRendererScalar DocsRenderer = "scalar"
+	// DocsRendererBuiltin serves a minimal renderer without external resources
+	DocsRendererBuiltin DocsRenderer = "builtin"
+	// DocsRendererCDN loads Scalar from jsdelivr; needs internet access in the browser
+	DocsRendererCDN DocsRenderer = "cdn"
+)
+
+// DocsRenderers lists the accepted renderer names
+var DocsRenderers = []DocsRenderer{DocsRendererAuto, DocsRendererScalar, DocsRendererBuiltin, DocsRendererCDN}
+
+// ParseDocsRenderer validates a renderer name. An empty name means auto.
+func ParseDocsRenderer(name string) (DocsRenderer, error) {
+	if name == "" {
+		return DocsRendererAuto, nil
+	}
+	for _, r := range DocsRenderers {
+		if strings.EqualFold(name, string(r)) {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown docs renderer %q (expected one of: auto, scalar, builtin, cdn)", name)
+}
+
+const (
+	scalarBundlePath = "assets/scalar/standalone.js"
+	scalarCDNURL     = "https://cdn.jsdelivr.net/npm/@scalar/api-reference"
+)
+
+// assets holds static files served under /docs/assets/. The Scalar bundle is
+// not kept in git; `make docs-assets` downloads it before the build.
+//
+//go:embed assets
+var assets embed.FS
+
+//go:embed docs.html
+var builtinDocsHTML string
+
+// ScalarBundled reports whether the Scalar bundle is embedded in this build
+func ScalarBundled() bool {
+	_, err := fs.Stat(assets, scalarBundlePath)
+	return err == nil
+}
+
+// resolve picks the renderer actually served. Scalar without an embedded
+// bundle falls back to the built-in renderer rather than to the CDN, so an
+// air-gapped deployment never ends up with a blank page.
+func (r DocsRenderer) resolve() DocsRenderer {
+	switch r {
+	case DocsRendererScalar:
+		if !ScalarBundled() {
+			slog.Warn("Scalar bundle is not embedded in this build, using the built-in docs renderer")
+			return DocsRendererBuiltin
+		}
+		return r
+	case DocsRendererBuiltin, DocsRendererCDN:
+		return r
+	default:
+		if ScalarBundled() {
+			return DocsRendererScalar
+		}
+		return DocsRendererBuiltin
+	}
+}
+
+// docsPage returns the /docs HTML for the renderer
+func docsPage(r DocsRenderer) string {
+	switch r {
+	case DocsRendererScalar:
+		return fmt.Sprintf(scalarHTML, "/docs/"+scalarBundlePath)
+	case DocsRendererCDN:
+		return fmt.Sprintf(scalarHTML, scalarCDNURL)
+	default:
+		return builtinDocsHTML
+	}
+}
+
+// setupDocs registers /docs and the embedded assets it loads
+func (s *Server) setupDocs() {
+	page := []byte(docsPage(s.docsRenderer))
+
+	s.router.GET("/docs", func(w http.ResponseWriter, r bunrouter.Request) error {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, err := w.Write(page)
+		return err
+	})
+
+	files := http.StripPrefix("/docs/", http.FileServer(http.FS(assets)))
+	s.router.GET("/docs/assets/*path", func(w http.ResponseWriter, r bunrouter.Request) error {
+		files.ServeHTTP(w, r.Request)
+		return nil
+	})
+}
+
+// Scalar API Documentation HTML; %s is the script URL of the Scalar bundle
+const scalarHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>ldapmerge API Documentation</title>
+    <meta name="description" content="LDAP Configuration Merger for VMware NSX 4.2 - API Documentation">
+    <link rel="icon" type="image/svg+xml" href="data:image/svg+xml,<svg xmlns='http://www.w3.org/2000/svg' viewBox='0 0 100 100'><text y='.9em' font-size='90'>🔀</text></svg>">
+    <style>
+        body {
+            margin: 0;
+            padding: 0;
+        }
+    </style>
+</head>
+<body>
+    <script
+        id="api-reference"
+        data-url="/openapi.json"
+        data-configuration='{
+            "theme": "kepler",
+            "layout": "modern",
+            "darkMode": true,
+            "hiddenClients": ["unirest"],
+            "defaultHttpClient": {
+                "targetKey": "shell",
+                "clientKey": "curl"
+            },
+            "metaData": {
+                "title": "ldapmerge API",
+                "description": "LDAP Configuration Merger for VMware NSX 4.2",
+                "ogDescription": "REST API for merging LDAP configurations with SSL certificates"
+            },
+            "searchHotKey": "k"
+        }'
+    ></script>
+    <script src="%s"></script>
+</body>
+</html>`
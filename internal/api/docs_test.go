@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func getDocs(t *testing.T, renderer DocsRenderer, path string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	opts := DefaultOptions()
+	opts.DocsRenderer = renderer
+	s := NewServerWithOptions(":0", nil, opts)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestDocsRenderer(t *testing.T) {
+	rec := getDocs(t, DocsRendererBuiltin, "/docs")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, `fetch("/openapi.json")`) {
+		t.Error("Expected built-in renderer to load /openapi.json")
+	}
+	if strings.Contains(body, "src=\"http") || strings.Contains(body, "cdn.") {
+		t.Error("Expected built-in renderer to load no external resources")
+	}
+
+	if body := getDocs(t, DocsRendererCDN, "/docs").Body.String(); !strings.Contains(body, scalarCDNURL) {
+		t.Error("Expected cdn renderer to load Scalar from jsdelivr")
+	}
+
+	// auto and scalar never fall back to the CDN
+	for _, renderer := range []DocsRenderer{DocsRendererAuto, DocsRendererScalar} {
+		body := getDocs(t, renderer, "/docs").Body.String()
+		if strings.Contains(body, scalarCDNURL) {
+			t.Errorf("Expected %s renderer to serve local assets only", renderer)
+		}
+		if ScalarBundled() != strings.Contains(body, "/docs/"+scalarBundlePath) {
+			t.Errorf("Expected %s renderer to use Scalar only when bundled (bundled: %v)", renderer, ScalarBundled())
+		}
+	}
+}
+
+func TestDocsAssets(t *testing.T) {
+	rec := getDocs(t, DocsRendererAuto, "/docs/assets/scalar/README.md")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	rec = getDocs(t, DocsRendererAuto, "/docs/assets/missing.js")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestParseDocsRenderer(t *testing.T) {
+	for name, want := range map[string]DocsRenderer{"": DocsRendererAuto, "Builtin": DocsRendererBuiltin, "cdn": DocsRendererCDN} {
+		got, err := ParseDocsRenderer(name)
+		if err != nil || got != want {
+			t.Errorf("ParseDocsRenderer(%q) = %q, %v; expected %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseDocsRenderer("swagger"); err == nil {
+		t.Error("Expected error for unknown renderer")
+	}
+}
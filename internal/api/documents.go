@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"ldapmerge/internal/loader"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+)
+
+// DocumentListOutput is the response for documents list
+type DocumentListOutput struct {
+	Body []models.Document
+}
+
+// DocumentInput is the request for uploading a document
+type DocumentInput struct {
+	Body models.Document
+}
+
+// DocumentPathInput is the path parameter for document
+type DocumentPathInput struct {
+	ID int64 `path:"id" doc:"Document ID"`
+}
+
+// DocumentOutput is the response for single document
+type DocumentOutput struct {
+	Body models.Document
+}
+
+func (s *Server) handleListDocuments(ctx context.Context, input *struct{}) (*DocumentListOutput, error) {
+	if s.repo == nil {
+		return &DocumentListOutput{Body: []models.Document{}}, nil
+	}
+
+	docs, err := s.repo.ListDocuments(ctx)
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to list documents", err)
+	}
+	if docs == nil {
+		docs = []models.Document{}
+	}
+
+	return &DocumentListOutput{Body: docs}, nil
+}
+
+func (s *Server) handleCreateDocument(ctx context.Context, input *DocumentInput) (*DocumentOutput, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabaseUnavailable, "database not available")
+	}
+
+	if len(input.Body.Content) == 0 {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, "content is required")
+	}
+
+	doc, err := s.repo.SaveDocument(ctx, &input.Body)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidDocument) {
+			return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error(), err)
+		}
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to save document", err)
+	}
+
+	// The content was just uploaded; don't echo it back
+	doc.Content = nil
+	return &DocumentOutput{Body: *doc}, nil
+}
+
+func (s *Server) handleGetDocument(ctx context.Context, input *DocumentPathInput) (*DocumentOutput, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "documents not available")
+	}
+
+	doc, err := s.repo.GetDocument(ctx, input.ID)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "document not found")
+	}
+
+	return &DocumentOutput{Body: *doc}, nil
+}
+
+func (s *Server) handleDeleteDocument(ctx context.Context, input *DocumentPathInput) (*struct{}, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabaseUnavailable, "database not available")
+	}
+
+	if err := s.repo.DeleteDocument(ctx, input.ID); err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "document not found")
+	}
+
+	return &struct{}{}, nil
+}
+
+// resolveMergeDocuments returns the initial and response data of a merge
+// request, loading referenced documents or locations when the inline fields
+// are absent.
+func (s *Server) resolveMergeDocuments(ctx context.Context, input *MergeInput) ([]models.Domain, *models.CertificateResponse, error) {
+	body := &input.Body
+
+	if countSet(body.Initial != nil, body.InitialDocumentID != nil, body.InitialLocation != nil) > 1 {
+		return nil, nil, apiError(http.StatusUnprocessableEntity, CodeValidation, "initial, initial_document_id and initial_location are mutually exclusive")
+	}
+	if countSet(body.Response != nil, body.ResponseDocumentID != nil, body.ResponseLocation != nil) > 1 {
+		return nil, nil, apiError(http.StatusUnprocessableEntity, CodeValidation, "response, response_document_id and response_location are mutually exclusive")
+	}
+
+	initial := body.Initial
+	switch {
+	case body.InitialDocumentID != nil:
+		if s.repo == nil {
+			return nil, nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "documents not available")
+		}
+		domains, err := s.repo.GetInitialDocument(ctx, *body.InitialDocumentID)
+		if err != nil {
+			return nil, nil, documentError(*body.InitialDocumentID, err)
+		}
+		initial = domains
+	case body.InitialLocation != nil:
+		if err := s.checkLocation("initial_location", *body.InitialLocation); err != nil {
+			return nil, nil, err
+		}
+		domains, err := s.merger.LoadInitial(ctx, *body.InitialLocation)
+		if err != nil {
+			return nil, nil, apiError(http.StatusUnprocessableEntity, CodeValidation, "failed to load initial_location", err)
+		}
+		initial = domains
+	case initial == nil:
+		return nil, nil, apiError(http.StatusUnprocessableEntity, CodeValidation, "initial, initial_document_id or initial_location is required")
+	}
+
+	response, err := s.resolveResponse(ctx, body.Response, body.ResponseDocumentID, body.ResponseLocation)
+	if err != nil {
+		return nil, nil, err
+	}
+	return initial, response, nil
+}
+
+// resolveResponse returns the certificate response of a request: response
+// itself, the uploaded document documentID or the file at location,
+// whichever is set.
+func (s *Server) resolveResponse(ctx context.Context, response *models.CertificateResponse, documentID *int64, location *string) (*models.CertificateResponse, error) {
+	switch {
+	case documentID != nil:
+		if s.repo == nil {
+			return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "documents not available")
+		}
+		r, err := s.repo.GetResponseDocument(ctx, *documentID)
+		if err != nil {
+			return nil, documentError(*documentID, err)
+		}
+		return r, nil
+	case location != nil:
+		if err := s.checkLocation("response_location", *location); err != nil {
+			return nil, err
+		}
+		r, err := s.merger.LoadResponse(ctx, *location)
+		if err != nil {
+			return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, "failed to load response_location", err)
+		}
+		return r, nil
+	case response == nil:
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, "response, response_document_id or response_location is required")
+	}
+	return response, nil
+}
+
+// checkLocation rejects locations whose scheme is not enabled for requests.
+// Stdin is never allowed: the server's stdin is not the client's.
+func (s *Server) checkLocation(field, location string) error {
+	scheme := loader.Scheme(location)
+	if location == loader.StdinLocation || !s.inputSchemes[scheme] {
+		return apiError(http.StatusUnprocessableEntity, CodeValidation, fmt.Sprintf("%s scheme %q is not enabled on this server", field, scheme))
+	}
+	return nil
+}
+
+func countSet(set ...bool) int {
+	n := 0
+	for _, b := range set {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// documentError maps a failure to load a referenced document to an API error.
+func documentError(id int64, err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return apiError(http.StatusNotFound, CodeNotFound, fmt.Sprintf("document %d not found", id))
+	case errors.Is(err, repository.ErrInvalidDocument):
+		return apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error(), err)
+	default:
+		return apiError(http.StatusInternalServerError, CodeDatabase, fmt.Sprintf("failed to load document %d", id), err)
+	}
+}
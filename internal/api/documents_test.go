@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+)
+
+func TestMergeWithDocuments(t *testing.T) {
+	s, repo := setupTestServer(t)
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("/api/documents", `{"name": "lab", "kind": "initial", "content": [
+		{"id": "example.lab", "domain_name": "example.lab", "base_dn": "DC=example,DC=lab",
+		 "ldap_servers": [{"url": "ldaps://ad-01.example.lab:636", "starttls": "false", "enabled": "true"}]}
+	]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var doc models.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+	if doc.Content != nil {
+		t.Error("Expected upload response to omit content")
+	}
+
+	rec = post("/api/documents", `{"name": "broken", "kind": "response", "content": [1, 2]}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for mismatched content, got %d", rec.Code)
+	}
+
+	rec = post("/api/merge", `{"initial_document_id": `+strconv.FormatInt(doc.ID, 10)+`, "response": {"results": [
+		{"item": {"url": "ldaps://ad-01.example.lab:636", "starttls": "false", "enabled": "true"},
+		 "json": {"pem_encoded": "CERT", "details": []}}
+	]}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result []models.Domain
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if len(result) != 1 || len(result[0].LDAPServers[0].Certificates) != 1 {
+		t.Errorf("Expected certificate merged into document domains, got %+v", result)
+	}
+
+	entries, err := repo.ListHistory(context.Background(), repository.HistoryFilter{})
+	if err != nil {
+		t.Fatalf("ListHistory failed: %v", err)
+	}
+	if len(entries) != 1 || len(entries[0].Initial.Data) != 1 {
+		t.Errorf("Expected history to record the document's domains, got %+v", entries)
+	}
+
+	for body, want := range map[string]int{
+		`{"response": {"results": []}}`:                                                  http.StatusUnprocessableEntity,
+		`{"initial": [], "initial_document_id": 1, "response": {"results": []}}`:         http.StatusUnprocessableEntity,
+		`{"initial": [], "response_document_id": ` + strconv.FormatInt(doc.ID, 10) + `}`: http.StatusUnprocessableEntity,
+		`{"initial_document_id": 999, "response": {"results": []}}`:                      http.StatusNotFound,
+	} {
+		if rec := post("/api/merge", body); rec.Code != want {
+			t.Errorf("Expected status %d for %s, got %d: %s", want, body, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestMergeWithLocations(t *testing.T) {
+	dir := t.TempDir()
+	initialPath := filepath.Join(dir, "initial.json")
+	err := os.WriteFile(initialPath, []byte(`[{"id": "example.lab", "domain_name": "example.lab", "base_dn": "DC=example,DC=lab",
+		"ldap_servers": [{"url": "ldaps://ad-01.example.lab:636", "starttls": "false", "enabled": "true"}]}]`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/response.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"results": [{"item": {"url": "ldaps://ad-01.example.lab:636"}, "json": {"pem_encoded": "CERT"}}]}`))
+	}))
+	defer responseSrv.Close()
+
+	opts := DefaultOptions()
+	opts.InputSchemes = []string{"file", "http"}
+	s := NewServerWithOptions(":0", nil, opts)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/merge", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(`{"initial_location": "` + initialPath + `", "response_location": "` + responseSrv.URL + `/response.json"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result []models.Domain
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if len(result) != 1 || len(result[0].LDAPServers[0].Certificates) != 1 {
+		t.Errorf("Expected certificate merged from locations, got %+v", result)
+	}
+
+	for _, body := range []string{
+		`{"initial_location": "-", "response": {"results": []}}`,
+		`{"initial_location": "s3://bucket/initial.json", "response": {"results": []}}`,
+		`{"initial": [], "initial_location": "` + initialPath + `", "response": {"results": []}}`,
+		`{"initial": [], "response_location": "` + responseSrv.URL + `/missing.json"}`,
+	} {
+		if rec := post(body); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Locations are disabled by default
+	s = NewServer(":0", nil)
+	if rec := post(`{"initial_location": "` + initialPath + `", "response": {"results": []}}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 with no input schemes, got %d", rec.Code)
+	}
+}
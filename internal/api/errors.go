@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// ErrorCode is a stable, machine-readable error identifier returned in every
+// error response, so API consumers can branch on codes instead of messages.
+//
+// Codes are grouped by subsystem: LM-1xxx request errors, LM-2xxx NSX Manager
+// errors, LM-3xxx database errors, LM-9xxx internal errors. Codes are never
+// reused or renumbered.
+type ErrorCode string
+
+const (
+	// CodeValidation means the request failed schema or value validation
+	CodeValidation ErrorCode = "LM-1001"
+	// CodeNotFound means the requested resource does not exist
+	CodeNotFound ErrorCode = "LM-1002"
+	// CodeConflict means the request conflicts with existing state
+	CodeConflict ErrorCode = "LM-1003"
+	// CodeUnauthorized means the request has no valid API key
+	CodeUnauthorized ErrorCode = "LM-1004"
+	// CodeRateLimited means the client exceeded a rate limit
+	CodeRateLimited ErrorCode = "LM-1005"
+	// CodeForbidden means the API key or token may not make the request
+	CodeForbidden ErrorCode = "LM-1006"
+
+	// CodeNSXAuth means NSX Manager rejected the stored credentials
+	CodeNSXAuth ErrorCode = "LM-2001"
+	// CodeNSXUnreachable means NSX Manager could not be reached
+	CodeNSXUnreachable ErrorCode = "LM-2002"
+	// CodeNSXAPI means NSX Manager returned an error response
+	CodeNSXAPI ErrorCode = "LM-2003"
+
+	// CodeDatabase means a database query failed
+	CodeDatabase ErrorCode = "LM-3001"
+	// CodeDatabaseUnavailable means the server runs without a database
+	CodeDatabaseUnavailable ErrorCode = "LM-3002"
+
+	// CodeInternal means an unexpected server error
+	CodeInternal ErrorCode = "LM-9001"
+)
+
+// ErrorModel is the RFC 9457 problem+json body with an ldapmerge error code
+type ErrorModel struct {
+	huma.ErrorModel
+	Code ErrorCode `json:"code" enum:"LM-1001,LM-1002,LM-1003,LM-1004,LM-1005,LM-1006,LM-2001,LM-2002,LM-2003,LM-3001,LM-3002,LM-9001" doc:"Stable ldapmerge error code" example:"LM-1002"`
+}
+
+// defaultNewError is the huma error constructor wrapped by newErrorModel
+var defaultNewError = huma.NewError
+
+func init() {
+	// Errors raised by huma itself (validation, content negotiation) get a
+	// code derived from the status; handlers set specific codes via apiError.
+	huma.NewError = func(status int, msg string, errs ...error) huma.StatusError {
+		return newErrorModel(status, codeForStatus(status), msg, errs...)
+	}
+}
+
+func newErrorModel(status int, code ErrorCode, msg string, errs ...error) *ErrorModel {
+	model := &ErrorModel{Code: code}
+	if base, ok := defaultNewError(status, msg, errs...).(*huma.ErrorModel); ok {
+		model.ErrorModel = *base
+	} else {
+		model.Status = status
+		model.Title = http.StatusText(status)
+		model.Detail = msg
+	}
+	return model
+}
+
+// apiError returns an error response with a specific error code
+func apiError(status int, code ErrorCode, msg string, errs ...error) huma.StatusError {
+	return newErrorModel(status, code, msg, errs...)
+}
+
+func codeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusRequestEntityTooLarge,
+		http.StatusUnsupportedMediaType, http.StatusNotAcceptable, http.StatusMethodNotAllowed:
+		return CodeValidation
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusForbidden:
+		return CodeForbidden
+	default:
+		return CodeInternal
+	}
+}
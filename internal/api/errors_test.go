@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorCodes(t *testing.T) {
+	s := NewServer(":0", nil)
+
+	cases := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		code   ErrorCode
+	}{
+		{http.MethodGet, "/api/history/1", "", http.StatusNotFound, CodeDatabaseUnavailable},
+		{http.MethodPost, "/api/merge", `{"initial": "not-an-array"}`, http.StatusUnprocessableEntity, CodeValidation},
+		{http.MethodDelete, "/api/configs/1", "", http.StatusInternalServerError, CodeDatabaseUnavailable},
+		{http.MethodPatch, "/api/admin/settings", `{"probes_paused": true}`, http.StatusNotFound, CodeDatabaseUnavailable},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+
+		if rec.Code != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.path, tc.status, rec.Code)
+		}
+
+		var body ErrorModel
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s %s: failed to decode error: %v", tc.method, tc.path, err)
+		}
+		if body.Code != tc.code {
+			t.Errorf("%s %s: expected code %s, got %q", tc.method, tc.path, tc.code, body.Code)
+		}
+	}
+}
+
+func TestErrorCodesInOpenAPI(t *testing.T) {
+	s := NewServer(":0", nil)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	if !strings.Contains(rec.Body.String(), `"LM-2001"`) {
+		t.Error("Expected error codes in OpenAPI error schema")
+	}
+}
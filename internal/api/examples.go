@@ -0,0 +1,543 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"ldapmerge/internal/models"
+)
+
+// Examples of request and response bodies in the OpenAPI spec, so that the
+// documentation and clients generated from the spec show realistic payloads.
+// They are built from the API types, and TestOpenAPIExamples checks them
+// against the schemas.
+
+var exampleTime = time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+
+const examplePEM = "-----BEGIN CERTIFICATE-----\nMIIC...\n-----END CERTIFICATE-----"
+
+// exampleInitial is a two-domain NSX configuration before a merge.
+var exampleInitial = []models.Domain{
+	{
+		ID:                     "example.lab",
+		DomainName:             "example.lab",
+		BaseDN:                 "DC=example,DC=lab",
+		AlternativeDomainNames: []string{"EXAMPLE"},
+		LDAPServers: []models.LDAPServer{
+			{URL: "ldaps://ad-01.example.lab:636", StartTLS: "false", Enabled: "true", BindUsername: "sync@example.lab"},
+			{URL: "ldaps://ad-02.example.lab:636", StartTLS: "false", Enabled: "true", BindUsername: "sync@example.lab"},
+		},
+	},
+	{
+		ID:                     "corp.example.com",
+		DomainName:             "corp.example.com",
+		BaseDN:                 "DC=corp,DC=example,DC=com",
+		AlternativeDomainNames: []string{},
+		LDAPServers: []models.LDAPServer{
+			{URL: "ldap://dc-01.corp.example.com:389", StartTLS: "true", Enabled: "true", BindUsername: "svc-nsx@corp.example.com"},
+		},
+	},
+}
+
+// exampleResponse is the Ansible certificate response for exampleInitial.
+var exampleResponse = models.CertificateResponse{
+	Results: []models.CertificateResult{
+		exampleCertificate("ldaps://ad-01.example.lab:636", "false", "ad-01.example.lab"),
+		exampleCertificate("ldaps://ad-02.example.lab:636", "false", "ad-02.example.lab"),
+		exampleCertificate("ldap://dc-01.corp.example.com:389", "true", "dc-01.corp.example.com"),
+	},
+}
+
+func exampleCertificate(url, starttls, cn string) models.CertificateResult {
+	return models.CertificateResult{
+		JSON: models.CertificateJSON{
+			PEMEncoded: examplePEM,
+			Details:    []models.CertificateDetail{{SubjectCN: cn}},
+		},
+		Item:           models.ResponseItem{URL: url, StartTLS: starttls, Enabled: "true"},
+		AnsibleLoopVar: "item",
+	}
+}
+
+// exampleResult is exampleInitial merged with exampleResponse.
+var exampleResult = func() []models.Domain {
+	result := make([]models.Domain, len(exampleInitial))
+	for i, d := range exampleInitial {
+		d.LDAPServers = append([]models.LDAPServer(nil), d.LDAPServers...)
+		for j := range d.LDAPServers {
+			d.LDAPServers[j].Certificates = []string{examplePEM}
+		}
+		result[i] = d
+	}
+	return result
+}()
+
+var exampleStats = &models.MergeStats{
+	DurationMS:         1.8,
+	Domains:            2,
+	Servers:            3,
+	ResponseResults:    3,
+	MatchedServers:     3,
+	MatchRatio:         1,
+	ResultCertificates: 3,
+	InputBytes:         5120,
+}
+
+var exampleConfig = models.NSXConfig{
+	ID:          1,
+	Name:        "production-nsx",
+	Description: "Production NSX Manager",
+	Host:        "https://nsx.example.com",
+	Username:    "admin",
+	CreatedAt:   exampleTime,
+	UpdatedAt:   exampleTime,
+	SyncDefaults: &models.SyncDefaults{
+		Strategy: "append",
+		Domains:  []string{"*.example.lab"},
+	},
+}
+
+var exampleSettings = Settings{
+	LogLevel:       "debug",
+	ProbeRetention: "168h0m0s",
+	ProbesPaused:   true,
+	ProbesRunning:  true,
+	DatabasePath:   "/var/lib/ldapmerge/data.db",
+	UpdatedAt:      &exampleTime,
+	UpdatedBy:      "ops",
+}
+
+// requestExamples are the examples of request bodies, by operation ID.
+var requestExamples = map[string]map[string]*huma.Example{
+	"merge": {
+		"multiDomain": {
+			Summary:     "Two domains with their certificates",
+			Description: "Every LDAP server gets the certificate of the response result with its URL.",
+			Value:       map[string]any{"initial": exampleInitial, "response": exampleResponse},
+		},
+		"documents": {
+			Summary: "Uploaded documents",
+			Value:   map[string]any{"initial_document_id": 1, "response_document_id": 2, "options": map[string]any{"strategy": "append", "dedup": true}},
+		},
+		"exploratory": {
+			Summary: "Without history",
+			Value:   map[string]any{"initial": exampleInitial[:1], "response": exampleResponse, "save_history": false},
+		},
+	},
+	"createDocument": {
+		"initial": {
+			Summary: "Initial document",
+			Value:   models.Document{Name: "prod-initial", Kind: models.DocumentInitial, Content: mustJSON(exampleInitial)},
+		},
+	},
+	"pushHistory": {
+		"push": {
+			Summary: "Push to a saved configuration",
+			Value:   map[string]any{"config_id": 1, "reason": "CHG-1234: restore AD certificates after NSX restore"},
+		},
+		"canary": {
+			Summary: "Canary first, then the rest",
+			Value:   map[string]any{"config_id": 1, "reason": "CHG-1235: renew lab certificates", "domains": []string{"*.example.lab", "corp.example.com"}, "canary": "example.lab"},
+		},
+	},
+	"pushNSX": {
+		"push": {
+			Summary: "Push a merged result",
+			Value:   map[string]any{"result": exampleResult, "reason": "CHG-1234: renew AD certificates"},
+		},
+		"dryRun": {
+			Summary: "List the sources that would be pushed",
+			Value:   map[string]any{"result": exampleResult, "reason": "CHG-1234: renew AD certificates", "dry_run": true, "domains": []string{"*.example.lab"}},
+		},
+	},
+	"startSync": {
+		"document": {
+			Summary: "Sync with an uploaded response document",
+			Value:   map[string]any{"config_id": 1, "response_document_id": 2, "reason": "CHG-1234: renew AD certificates"},
+		},
+		"canary": {
+			Summary: "Sync the example.lab sources, lab.example.lab first",
+			Value: map[string]any{
+				"config_id": 1, "response": exampleResponse, "reason": "CHG-1234: renew AD certificates",
+				"domains": []string{"*.example.lab"}, "canary": "lab.example.lab", "options": map[string]any{"strategy": "append"},
+			},
+		},
+	},
+	"restoreSnapshot": {
+		"restore": {
+			Summary: "Roll a push back",
+			Value:   map[string]any{"config_id": 1, "reason": "CHG-1236: roll back CHG-1234"},
+		},
+	},
+	"updateSettings": {
+		"pause": {
+			Summary: "Pause probes during maintenance",
+			Value:   map[string]any{"probes_paused": true},
+		},
+		"debug": {
+			Summary: "Debug logging, shorter probe history",
+			Value:   map[string]any{"log_level": "debug", "probe_retention": "168h"},
+		},
+	},
+	"createConfig": {
+		"config": {
+			Summary: "NSX Manager with sync defaults",
+			Value: models.NSXConfig{
+				Name:         exampleConfig.Name,
+				Description:  exampleConfig.Description,
+				Host:         exampleConfig.Host,
+				Username:     exampleConfig.Username,
+				Password:     "VMware1!VMware1!",
+				SyncDefaults: exampleConfig.SyncDefaults,
+			},
+		},
+	},
+}
+
+// responseExamples are the examples of successful response bodies, by
+// operation ID.
+var responseExamples = map[string]map[string]*huma.Example{
+	"merge": {
+		"multiDomain": {Summary: "Merged domains", Value: exampleResult},
+	},
+	"listHistory": {
+		"summaries": {
+			Summary: "Entry summaries",
+			Value: []models.HistorySummary{{
+				ID: 12, CreatedAt: exampleTime, Stats: exampleStats, Size: 48213,
+				Domains: 2, Servers: 3, Certificates: 3, RunID: "20250115T103000Z-3f9a2c1b",
+			}},
+		},
+	},
+	"getHistory": {
+		"entry": {
+			Summary: "Entry with its data",
+			Value: models.HistoryEntry{
+				ID:        12,
+				CreatedAt: exampleTime,
+				Initial:   models.JSON[[]models.Domain]{Data: exampleInitial},
+				Response:  models.JSON[models.CertificateResponse]{Data: exampleResponse},
+				Result:    models.JSON[[]models.Domain]{Data: exampleResult},
+				Stats:     exampleStats,
+				Size:      48213,
+				RunID:     "20250115T103000Z-3f9a2c1b",
+			},
+		},
+	},
+	"pushHistory": {
+		"partial": {
+			Summary: "One source failed",
+			Value: map[string]any{
+				"config_id": 1, "host": "https://nsx.example.com", "succeeded": 1, "failed": 1, "snapshot_id": 7,
+				"results": []PushSourceResult{
+					{ID: "example.lab", Success: true},
+					{ID: "corp.example.com", Error: "LDAP server ldap://dc-01.corp.example.com:389 unreachable"},
+				},
+			},
+		},
+		"dryRun": {
+			Summary: "Dry run",
+			Value: map[string]any{
+				"config_id": 1, "host": "https://nsx.example.com", "succeeded": 0, "failed": 0, "snapshot_id": 0,
+				"results": []PushSourceResult{}, "dry_run": true, "planned": []string{"example.lab", "corp.example.com"},
+			},
+		},
+	},
+	"pushNSX": {
+		"pushed": {
+			Summary: "Every source updated",
+			Value: map[string]any{
+				"config_id": 1, "host": "https://nsx.example.com", "succeeded": 2, "failed": 0, "snapshot_id": 8,
+				"results": []PushSourceResult{{ID: "example.lab", Success: true}, {ID: "corp.example.com", Success: true}},
+			},
+		},
+	},
+	"listAudit": {
+		"push": {
+			Summary: "A push through the API, recorded before its request",
+			Value: []models.AuditEvent{
+				{
+					ID: 42, CreatedAt: exampleTime, Operation: "api.request", Origin: "api", Actor: "ansible",
+					SourceIDs: []string{}, Outcome: "success", RunID: "20250115T103000Z-3f9a2c1b", SourceIP: "192.0.2.10",
+					Method: http.MethodPost, Path: "/api/history/12/push", Status: http.StatusOK,
+					BodySHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+				},
+				{
+					ID: 41, CreatedAt: exampleTime, Operation: "history.push", Origin: "api", Actor: "ansible",
+					NSXHost: "https://nsx.example.com", SourceIDs: []string{"example.lab"}, Reason: "CHG-1234: renew AD certificates",
+					Outcome: "success", RunID: "20250115T103000Z-3f9a2c1b", SourceIP: "192.0.2.10",
+				},
+			},
+		},
+	},
+	"healthHistory": {
+		"flapping": {
+			Summary: "An NSX Manager intermittently unreachable",
+			Value: map[string]any{
+				"snapshots": []models.HealthSnapshot{{
+					ID: 289, TakenAt: exampleTime,
+					Database: models.DatabaseSample{OK: true, Size: 1048576, HistoryCount: 120},
+					NSX: []models.NSXSample{{
+						ConfigID: 1, Name: exampleConfig.Name, Host: exampleConfig.Host, LatencyMS: 30000,
+						Error: "Get \"https://nsx.example.com/policy/api/v1/aaa/ldap-identity-sources\": dial tcp: i/o timeout",
+					}},
+				}},
+				"database": DatabaseTrend{FirstSize: 45056, LastSize: 1048576, Growth: 1003520, GrowthDaily: 1003520},
+				"nsx": []NSXTrend{{
+					ConfigID: 1, Name: exampleConfig.Name, Host: exampleConfig.Host, Checks: 288, Failures: 7, Changes: 6,
+					Flapping: true, LastChangeAt: &exampleTime,
+					LastError: "Get \"https://nsx.example.com/policy/api/v1/aaa/ldap-identity-sources\": dial tcp: i/o timeout",
+				}},
+			},
+		},
+	},
+	"getSettings": {
+		"settings": {Summary: "Settings changed through the API", Value: exampleSettings},
+	},
+	"updateSettings": {
+		"settings": {Summary: "Settings after the change", Value: exampleSettings},
+	},
+	"createConfig": {
+		"config": {Summary: "Saved configuration, without its password", Value: exampleConfig},
+	},
+	"getConfig": {
+		"config": {Summary: "Configuration without its password", Value: exampleConfig},
+	},
+	"listNSXSources": {
+		"sources": {Summary: "Identity sources as domains", Value: exampleInitial},
+	},
+	"startSync": {
+		"started": {Summary: "Job started", Value: exampleSyncJob(SyncRunning)},
+	},
+	"getSyncJob": {
+		"running":   {Summary: "Pushing", Value: exampleSyncJob(SyncPhasePush)},
+		"succeeded": {Summary: "Every source updated", Value: exampleSyncJob(SyncSucceeded)},
+		"failed":    {Summary: "NSX Manager rejected the credentials", Value: exampleSyncJob(SyncFailed)},
+	},
+	"listSyncJobs": {
+		"jobs": {Summary: "A job running and one done", Value: []SyncJob{exampleSyncJob(SyncPhasePush), exampleSyncJob(SyncSucceeded)}},
+	},
+}
+
+// exampleSyncJob returns an example sync job: started, in phase push, or
+// ended with status.
+func exampleSyncJob(state string) SyncJob {
+	job := SyncJob{
+		ID: "20250115T103000Z-3f9a2c1b", Status: SyncRunning, Phase: SyncPhasePull, ConfigID: 1, Host: "https://nsx.example.com",
+		RunID: "20250115T102959Z-8d0e4f7a", Reason: "CHG-1234: renew AD certificates", CreatedAt: exampleTime,
+	}
+	if state == SyncRunning {
+		return job
+	}
+	historyID := int64(12)
+	job.Phase, job.Pulled, job.HistoryID = SyncPhasePush, 2, &historyID
+	if state == SyncPhasePush {
+		return job
+	}
+
+	finished := exampleTime.Add(95 * time.Second)
+	job.Status, job.FinishedAt = state, &finished
+	if state == SyncFailed {
+		job.Phase, job.Pulled, job.HistoryID = SyncPhasePull, 0, nil
+		job.Error = errorExample(http.StatusBadGateway, CodeNSXAuth, "NSX Manager rejected the credentials")
+		return job
+	}
+	job.Result = &PushResult{
+		ConfigID: 1, Host: "https://nsx.example.com", Succeeded: 2, SnapshotID: 8,
+		Results: []PushSourceResult{{ID: "example.lab", Success: true}, {ID: "corp.example.com", Success: true}},
+	}
+	return job
+}
+
+// notFoundDetails are the details of 404 responses, by operation tag.
+var notFoundDetails = map[string]string{
+	"merge":     "document 1 not found",
+	"documents": "document not found",
+	"history":   "history entry not found",
+	"snapshots": "snapshot not found",
+	"config":    "config not found",
+	"inventory": "server not found",
+	"admin":     "settings not available",
+	"nsx":       "config not found",
+	"sync":      "sync job not found",
+}
+
+// conflictExamples are the examples of 409 responses, by operation ID.
+var conflictExamples = map[string]map[string]*huma.Example{
+	"pushHistory": {
+		"protected": {
+			Summary: "Protected sources without force_protected",
+			Value:   errorExample(http.StatusConflict, CodeConflict, "identity sources are protected: prod.example.com; set force_protected to change them"),
+		},
+	},
+	"pushNSX": {
+		"protected": {
+			Summary: "Protected sources without force_protected",
+			Value:   errorExample(http.StatusConflict, CodeConflict, "identity sources are protected: prod.example.com; set force_protected to change them"),
+		},
+	},
+	"startSync": {
+		"running": {
+			Summary: "A sync of the configuration already running",
+			Value:   errorExample(http.StatusConflict, CodeConflict, "a sync of config 1 is already running: job 20250115T103000Z-3f9a2c1b"),
+		},
+	},
+	"restoreSnapshot": {
+		"otherManager": {
+			Summary: "Snapshot of another NSX Manager",
+			Value:   errorExample(http.StatusConflict, CodeConflict, "snapshot 7 was taken on https://nsx-lab.example.com, not on https://nsx.example.com"),
+		},
+		"protected": {
+			Summary: "Protected sources without force_protected",
+			Value:   errorExample(http.StatusConflict, CodeConflict, "identity sources are protected: prod.example.com; set force_protected to change them"),
+		},
+	},
+}
+
+// errorExamples returns the examples of the error response with status of
+// op.
+func errorExamples(op *huma.Operation, status int) map[string]*huma.Example {
+	switch status {
+	case http.StatusBadRequest:
+		return map[string]*huma.Example{"malformed": {
+			Summary: "Malformed JSON",
+			Value: errorExample(status, CodeValidation, "validation failed",
+				&huma.ErrorDetail{Message: "unexpected end of JSON input", Location: "body", Value: `{"name":`}),
+		}}
+	case http.StatusUnauthorized:
+		return map[string]*huma.Example{"unauthorized": {
+			Summary: "Missing or invalid API key",
+			Value:   errorExample(status, CodeUnauthorized, "missing or invalid API key"),
+		}}
+	case http.StatusForbidden:
+		return map[string]*huma.Example{"tenant": {
+			Summary: "Key bound to a tenant",
+			Value:   errorExample(status, CodeForbidden, "server settings require a key or token without a tenant"),
+		}}
+	case http.StatusNotFound:
+		detail := "not found"
+		if len(op.Tags) > 0 && notFoundDetails[op.Tags[0]] != "" {
+			detail = notFoundDetails[op.Tags[0]]
+		}
+		return map[string]*huma.Example{"notFound": {
+			Summary: "Not found",
+			Value:   errorExample(status, CodeNotFound, detail),
+		}}
+	case http.StatusConflict:
+		return conflictExamples[op.OperationID]
+	case http.StatusUnprocessableEntity:
+		return map[string]*huma.Example{"validation": {
+			Summary: "Invalid field",
+			Value: errorExample(status, CodeValidation, "validation failed",
+				&huma.ErrorDetail{Message: "expected length >= 1", Location: "body.reason", Value: ""}),
+		}}
+	case http.StatusTooManyRequests:
+		return map[string]*huma.Example{"rateLimited": {
+			Summary: "Rate limit exceeded",
+			Value:   errorExample(status, CodeRateLimited, "token rate limit of 5 requests per second exceeded; retry in 1s"),
+		}}
+	case http.StatusInternalServerError:
+		return map[string]*huma.Example{"database": {
+			Summary: "Database error",
+			Value:   errorExample(status, CodeDatabase, "failed to save config"),
+		}}
+	case http.StatusBadGateway:
+		return map[string]*huma.Example{
+			"nsxAuth": {
+				Summary: "NSX Manager rejected the credentials",
+				Value:   errorExample(status, CodeNSXAuth, "NSX Manager rejected the credentials"),
+			},
+			"nsxUnreachable": {
+				Summary: "NSX Manager unreachable",
+				Value:   errorExample(status, CodeNSXUnreachable, "NSX Manager unreachable"),
+			},
+		}
+	case http.StatusGatewayTimeout:
+		return map[string]*huma.Example{"nsxTimeout": {
+			Summary: "NSX Manager timed out",
+			Value:   errorExample(status, CodeNSXUnreachable, "NSX Manager did not respond"),
+		}}
+	case http.StatusServiceUnavailable:
+		return map[string]*huma.Example{"notReady": {
+			Summary: "Database not ready",
+			Value:   errorExample(status, CodeDatabase, "database not ready"),
+		}}
+	}
+	return nil
+}
+
+func errorExample(status int, code ErrorCode, detail string, errs ...*huma.ErrorDetail) *ErrorModel {
+	return &ErrorModel{
+		ErrorModel: huma.ErrorModel{Title: http.StatusText(status), Status: status, Detail: detail, Errors: errs},
+		Code:       code,
+	}
+}
+
+// documentOperations adds the 401 and 429 responses to the operations of
+// oapi outside publicPaths, which the API keys and rate limits apply to, and
+// the examples above to their request and response bodies.
+func documentOperations(oapi *huma.OpenAPI) {
+	errSchema := oapi.Components.Schemas.Schema(reflect.TypeOf(ErrorModel{}), true, "Error")
+	for path, item := range oapi.Paths {
+		for _, op := range []*huma.Operation{item.Get, item.Post, item.Put, item.Patch, item.Delete} {
+			if op == nil {
+				continue
+			}
+			if !isPublic(path) {
+				for _, status := range []int{http.StatusUnauthorized, http.StatusTooManyRequests} {
+					if op.Responses[strconv.Itoa(status)] == nil {
+						op.Responses[strconv.Itoa(status)] = &huma.Response{
+							Description: http.StatusText(status),
+							Content:     map[string]*huma.MediaType{problemContentType: {Schema: errSchema}},
+						}
+					}
+				}
+				op.Responses[strconv.Itoa(http.StatusTooManyRequests)].Headers = map[string]*huma.Param{
+					"Retry-After": {
+						Description: "Seconds to wait before retrying",
+						Schema:      &huma.Schema{Type: huma.TypeInteger},
+					},
+				}
+			}
+
+			if op.RequestBody != nil {
+				setExamples(op.RequestBody.Content, requestExamples[op.OperationID])
+			}
+			for key, resp := range op.Responses {
+				status, err := strconv.Atoi(key)
+				switch {
+				case err != nil:
+				case status < 300:
+					setExamples(resp.Content, responseExamples[op.OperationID])
+				default:
+					setExamples(resp.Content, errorExamples(op, status))
+				}
+			}
+		}
+	}
+}
+
+// problemContentType is the content type of error responses.
+const problemContentType = "application/problem+json"
+
+func setExamples(content map[string]*huma.MediaType, examples map[string]*huma.Example) {
+	if examples == nil {
+		return
+	}
+	for _, mt := range content {
+		mt.Examples = examples
+	}
+}
+
+func mustJSON(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
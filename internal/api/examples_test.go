@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+func TestOpenAPIExamples(t *testing.T) {
+	s := NewServer(":0", nil)
+	registry := s.openapi.Components.Schemas
+
+	validate := func(name string, mode huma.ValidateMode, content map[string]*huma.MediaType) int {
+		t.Helper()
+		n := 0
+		for _, mt := range content {
+			for key, example := range mt.Examples {
+				data, err := json.Marshal(example.Value)
+				if err != nil {
+					t.Fatalf("%s %s: %v", name, key, err)
+				}
+				var value any
+				if err := json.Unmarshal(data, &value); err != nil {
+					t.Fatalf("%s %s: %v", name, key, err)
+				}
+				res := &huma.ValidateResult{}
+				huma.Validate(registry, mt.Schema, huma.NewPathBuffer([]byte{}, 0), mode, value, res)
+				for _, e := range res.Errors {
+					t.Errorf("%s example %s does not match its schema: %v", name, key, e)
+				}
+				n++
+			}
+		}
+		return n
+	}
+
+	examples := 0
+	for path, item := range s.openapi.Paths {
+		for _, op := range []*huma.Operation{item.Get, item.Post, item.Put, item.Patch, item.Delete} {
+			if op == nil {
+				continue
+			}
+			if op.RequestBody != nil {
+				examples += validate(op.OperationID+" request", huma.ModeWriteToServer, op.RequestBody.Content)
+			}
+			for status, resp := range op.Responses {
+				examples += validate(op.OperationID+" "+status, huma.ModeReadFromServer, resp.Content)
+			}
+			if !isPublic(path) && op.Responses[strconv.Itoa(http.StatusUnauthorized)] == nil {
+				t.Errorf("%s has no 401 response", op.OperationID)
+			}
+		}
+	}
+	if examples == 0 {
+		t.Fatal("Expected examples in the OpenAPI spec")
+	}
+
+	merge := s.openapi.Paths["/api/merge"].Post
+	if merge.RequestBody.Content["application/json"].Examples["multiDomain"] == nil {
+		t.Error("Expected a multi-domain merge request example")
+	}
+	notFound := s.openapi.Paths["/api/history/{id}"].Get.Responses["404"]
+	if notFound == nil {
+		t.Fatal("Expected a 404 response for getHistory")
+	}
+	if e, ok := notFound.Content[problemContentType].Examples["notFound"].Value.(*ErrorModel); !ok || e.Code != CodeNotFound || e.Detail != "history entry not found" {
+		t.Errorf("Unexpected 404 example for getHistory: %+v", notFound.Content)
+	}
+}
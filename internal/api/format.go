@@ -0,0 +1,58 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+
+	"github.com/danielgtaylor/huma/v2"
+)
+
+// streamingJSONFormat encodes top-level arrays one element at a time, so
+// large list responses (history entries, merged domains with hundreds of
+// PEM blocks) are written to the client as they are encoded instead of
+// being buffered in full first. Other values use the default JSON format.
+var streamingJSONFormat = huma.Format{
+	Marshal:   marshalStreaming,
+	Unmarshal: json.Unmarshal,
+}
+
+func marshalStreaming(w io.Writer, v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	// []byte is encoded as a base64 string, not an array
+	if rv.Kind() != reflect.Slice || rv.IsNil() || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return huma.DefaultJSONFormat.Marshal(w, v)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+			return err
+		}
+		// Drop the newline Encode appends after each element
+		buf.Truncate(buf.Len() - 1)
+
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		buf.Reset()
+	}
+
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"ldapmerge/internal/models"
+)
+
+func TestMarshalStreaming(t *testing.T) {
+	domains := []models.Domain{
+		{ID: "a.lab", DomainName: "a.lab", LDAPServers: []models.LDAPServer{{URL: "ldaps://dc01.a.lab:636", Certificates: []string{"<pem>"}}}},
+		{ID: "b.lab", DomainName: "b.lab"},
+	}
+
+	cases := map[string]any{
+		"slice":         domains,
+		"pointer":       &domains,
+		"empty":         []models.Domain{},
+		"nil":           []models.Domain(nil),
+		"struct":        domains[0],
+		"bytes":         []byte("raw"),
+		"history slice": []models.HistoryEntry{{ID: 1}, {ID: 2}},
+	}
+
+	for name, v := range cases {
+		var got bytes.Buffer
+		if err := marshalStreaming(&got, v); err != nil {
+			t.Fatalf("%s: marshalStreaming failed: %v", name, err)
+		}
+
+		var want bytes.Buffer
+		enc := json.NewEncoder(&want)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("%s: Encode failed: %v", name, err)
+		}
+
+		if got.String() != want.String() {
+			t.Errorf("%s: expected %s, got %s", name, want.String(), got.String())
+		}
+	}
+}
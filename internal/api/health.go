@@ -0,0 +1,163 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+)
+
+// defaultHealthWindow is the window of the health history when the request
+// sets no since.
+const defaultHealthWindow = 24 * time.Hour
+
+// HealthHistoryInput is the request for the health history
+type HealthHistoryInput struct {
+	Since         time.Time `query:"since" doc:"Only snapshots taken at or after this time (RFC 3339); default 24 hours ago"`
+	Limit         int       `query:"limit" minimum:"1" maximum:"10000" default:"1000" doc:"Maximum number of snapshots to return, newest first"`
+	FlapThreshold int       `query:"flap_threshold" minimum:"1" default:"3" doc:"Changes between reachable and unreachable in the returned snapshots from which an NSX Manager is flagged as flapping"`
+}
+
+// DatabaseTrend summarizes the database over the returned snapshots
+type DatabaseTrend struct {
+	FirstSize   int64   `json:"first_size" doc:"Database size in bytes in the oldest snapshot" example:"45056"`
+	LastSize    int64   `json:"last_size" doc:"Database size in bytes in the newest snapshot" example:"1048576"`
+	Growth      int64   `json:"growth" doc:"Size change in bytes between the oldest and the newest snapshot" example:"1003520"`
+	GrowthDaily float64 `json:"growth_per_day" doc:"Size change in bytes per day between the oldest and the newest snapshot" example:"1003520"`
+	Failures    int     `json:"failures" doc:"Snapshots in which the database could not be read" example:"0"`
+}
+
+// NSXTrend summarizes the reachability of an NSX Manager over the returned
+// snapshots
+type NSXTrend struct {
+	ConfigID     int64      `json:"config_id" doc:"NSX configuration ID" example:"1"`
+	Name         string     `json:"name" doc:"NSX configuration name, as of the newest snapshot" example:"production-nsx"`
+	Host         string     `json:"host" doc:"NSX Manager URL, as of the newest snapshot" example:"https://nsx.example.com"`
+	Reachable    bool       `json:"reachable" doc:"Whether the NSX Manager was reachable in the newest snapshot"`
+	Checks       int        `json:"checks" doc:"Snapshots that checked the NSX Manager" example:"288"`
+	Failures     int        `json:"failures" doc:"Checks that found the NSX Manager unreachable" example:"7"`
+	Changes      int        `json:"changes" doc:"Changes between reachable and unreachable" example:"6"`
+	Flapping     bool       `json:"flapping" doc:"Whether changes reached flap_threshold"`
+	LastChangeAt *time.Time `json:"last_change_at,omitempty" doc:"Time of the snapshot of the last change" format:"date-time"`
+	LastError    string     `json:"last_error,omitempty" doc:"Error of the last failed check" example:"Get \"https://nsx.example.com/policy/api/v1/aaa/ldap-identity-sources\": dial tcp: i/o timeout"`
+}
+
+// HealthHistoryOutput is the response for the health history
+type HealthHistoryOutput struct {
+	Body struct {
+		Snapshots []models.HealthSnapshot `json:"snapshots" doc:"Health snapshots, newest first"`
+		Database  *DatabaseTrend          `json:"database,omitempty" doc:"Database trend; absent without snapshots"`
+		NSX       []NSXTrend              `json:"nsx" doc:"Reachability trend of each NSX Manager, by configuration ID"`
+	}
+}
+
+func (s *Server) handleHealthHistory(ctx context.Context, input *HealthHistoryInput) (*HealthHistoryOutput, error) {
+	output := &HealthHistoryOutput{}
+	output.Body.Snapshots = []models.HealthSnapshot{}
+	output.Body.NSX = []NSXTrend{}
+	if s.repo == nil {
+		return output, nil
+	}
+
+	since := input.Since
+	if since.IsZero() {
+		since = time.Now().Add(-defaultHealthWindow)
+	}
+	snapshots, err := s.repo.ListHealthSnapshots(ctx, since, input.Limit)
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to list health snapshots", err)
+	}
+
+	// Keys bound to a tenant see the NSX Managers of their configurations
+	if _, ok := repository.TenantFrom(ctx); ok {
+		configs, err := s.repo.ListConfigs(ctx)
+		if err != nil {
+			return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to list configs", err)
+		}
+		visible := make(map[int64]bool, len(configs))
+		for _, c := range configs {
+			visible[c.ID] = true
+		}
+		for i := range snapshots {
+			snapshots[i].NSX = slices.DeleteFunc(snapshots[i].NSX, func(n models.NSXSample) bool { return !visible[n.ConfigID] })
+		}
+	}
+
+	output.Body.Snapshots = snapshots
+	output.Body.Database = databaseTrend(snapshots)
+	output.Body.NSX = nsxTrends(snapshots, input.FlapThreshold)
+	return output, nil
+}
+
+// databaseTrend summarizes the database over snapshots, newest first; nil
+// without snapshots.
+func databaseTrend(snapshots []models.HealthSnapshot) *DatabaseTrend {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	trend := &DatabaseTrend{}
+	var first, last *models.HealthSnapshot
+	for i := range snapshots {
+		s := &snapshots[i]
+		if !s.Database.OK {
+			trend.Failures++
+			continue
+		}
+		if last == nil {
+			last = s
+		}
+		first = s
+	}
+	if first == nil {
+		return trend
+	}
+
+	trend.FirstSize = first.Database.Size
+	trend.LastSize = last.Database.Size
+	trend.Growth = trend.LastSize - trend.FirstSize
+	if elapsed := last.TakenAt.Sub(first.TakenAt); elapsed > 0 {
+		trend.GrowthDaily = float64(trend.Growth) / elapsed.Hours() * 24
+	}
+	return trend
+}
+
+// nsxTrends summarizes the reachability of each NSX Manager over snapshots,
+// newest first. Managers that changed between reachable and unreachable at
+// least threshold times are flagged as flapping.
+func nsxTrends(snapshots []models.HealthSnapshot, threshold int) []NSXTrend {
+	trends := []NSXTrend{}
+	index := make(map[int64]int)
+	// Oldest first, so that changes are counted in order
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		for _, sample := range snapshots[i].NSX {
+			j, ok := index[sample.ConfigID]
+			if !ok {
+				j = len(trends)
+				index[sample.ConfigID] = j
+				trends = append(trends, NSXTrend{ConfigID: sample.ConfigID, Reachable: sample.Reachable})
+			}
+			t := &trends[j]
+			if t.Checks > 0 && t.Reachable != sample.Reachable {
+				t.Changes++
+				t.LastChangeAt = &snapshots[i].TakenAt
+			}
+			t.Name, t.Host, t.Reachable = sample.Name, sample.Host, sample.Reachable
+			t.Checks++
+			if !sample.Reachable {
+				t.Failures++
+				t.LastError = sample.Error
+			}
+		}
+	}
+
+	for i := range trends {
+		trends[i].Flapping = trends[i].Changes >= threshold
+	}
+	slices.SortFunc(trends, func(a, b NSXTrend) int { return cmp.Compare(a.ConfigID, b.ConfigID) })
+	return trends
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+)
+
+func TestHealthHistory(t *testing.T) {
+	repo := repository.NewMemory()
+	ctx := context.Background()
+
+	red, err := repo.SaveConfig(repository.WithTenant(ctx, "red"), &models.NSXConfig{Name: "red", Host: "https://nsx-red", Username: "admin"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	blue, err := repo.SaveConfig(repository.WithTenant(ctx, "blue"), &models.NSXConfig{Name: "blue", Host: "https://nsx-blue", Username: "admin"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	// red is reachable every other snapshot, blue always; the database
+	// grows by 1 MiB a day and is unreadable once
+	start := time.Now().Add(-6 * time.Hour).UTC().Truncate(time.Second)
+	for i := range 6 {
+		snapshot := &models.HealthSnapshot{
+			TakenAt:  start.Add(time.Duration(i) * time.Hour),
+			Database: models.DatabaseSample{OK: true, Size: 1<<20 + int64(i)*(1<<20)/24},
+			NSX: []models.NSXSample{
+				{ConfigID: red.ID, Name: "red", Host: red.Host, Reachable: i%2 == 0},
+				{ConfigID: blue.ID, Name: "blue", Host: blue.Host, Reachable: true},
+			},
+		}
+		if i%2 == 1 {
+			snapshot.NSX[0].Error = "connection refused"
+		}
+		if i == 3 {
+			snapshot.Database = models.DatabaseSample{Error: "database is locked"}
+			snapshot.NSX = nil
+		}
+		if err := repo.AddHealthSnapshot(ctx, snapshot); err != nil {
+			t.Fatalf("AddHealthSnapshot failed: %v", err)
+		}
+	}
+	if err := repo.AddHealthSnapshot(ctx, &models.HealthSnapshot{TakenAt: start.Add(-48 * time.Hour)}); err != nil {
+		t.Fatalf("AddHealthSnapshot failed: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.APIKeys = []APIKey{{Name: "admin", Key: "admin-key-0123456789"}, {Name: "blue", Key: "blue-key-0123456789", Tenant: "blue"}}
+	s := NewServerWithOptions(":0", repo, opts)
+
+	get := func(query, key string) HealthHistoryOutput {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/health/history"+query, nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var output HealthHistoryOutput
+		if err := json.Unmarshal(rec.Body.Bytes(), &output.Body); err != nil {
+			t.Fatalf("Failed to decode history: %v", err)
+		}
+		return output
+	}
+
+	output := get("", "admin-key-0123456789")
+	if len(output.Body.Snapshots) != 6 || !output.Body.Snapshots[0].TakenAt.Equal(start.Add(5*time.Hour)) {
+		t.Fatalf("Expected the snapshots of the last day, newest first, got %+v", output.Body.Snapshots)
+	}
+	db := output.Body.Database
+	if db == nil || db.Failures != 1 || db.Growth != 5*(1<<20)/24 || db.GrowthDaily < 1<<20-10 || db.GrowthDaily > 1<<20+10 {
+		t.Errorf("Expected 1 MiB growth a day and one failure, got %+v", db)
+	}
+
+	trends := output.Body.NSX
+	if len(trends) != 2 || trends[0].ConfigID != red.ID {
+		t.Fatalf("Expected the trends of both managers by config ID, got %+v", trends)
+	}
+	if r := trends[0]; r.Checks != 5 || r.Failures != 2 || r.Changes != 3 || !r.Flapping || r.Reachable || r.LastError != "connection refused" ||
+		r.LastChangeAt == nil || !r.LastChangeAt.Equal(start.Add(5*time.Hour)) {
+		t.Errorf("Expected red flapping, got %+v", r)
+	}
+	if b := trends[1]; b.Checks != 5 || b.Failures != 0 || b.Changes != 0 || b.Flapping || !b.Reachable {
+		t.Errorf("Expected blue steady, got %+v", b)
+	}
+
+	if output := get("?flap_threshold=4", "admin-key-0123456789"); output.Body.NSX[0].Flapping {
+		t.Error("Expected red not flapping below flap_threshold")
+	}
+	if output := get("?since="+start.Add(-72*time.Hour).Format(time.RFC3339)+"&limit=7", "admin-key-0123456789"); len(output.Body.Snapshots) != 7 {
+		t.Errorf("Expected 7 snapshots since 3 days ago, got %d", len(output.Body.Snapshots))
+	}
+
+	// A tenant sees its own NSX Managers only
+	output = get("", "blue-key-0123456789")
+	if len(output.Body.NSX) != 1 || output.Body.NSX[0].ConfigID != blue.ID {
+		t.Errorf("Expected only the manager of tenant blue, got %+v", output.Body.NSX)
+	}
+	for _, snapshot := range output.Body.Snapshots {
+		for _, sample := range snapshot.NSX {
+			if sample.ConfigID != blue.ID {
+				t.Errorf("Expected only samples of tenant blue, got %+v", sample)
+			}
+		}
+	}
+}
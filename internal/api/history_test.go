@@ -0,0 +1,807 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/credentials"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/nsx/mock"
+	"ldapmerge/internal/repository"
+	"ldapmerge/internal/signing"
+)
+
+func setupTestServer(t *testing.T) (*Server, *repository.Repository) {
+	t.Helper()
+
+	repo, err := repository.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+
+	return NewServer(":0", repo), repo
+}
+
+func TestGetHistoryResultDownload(t *testing.T) {
+	s, repo := setupTestServer(t)
+
+	result := []models.Domain{{ID: "example.lab", DomainName: "example.lab"}}
+	entry, err := repo.SaveHistory(context.Background(), nil, models.CertificateResponse{}, result)
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	path := "/api/history/" + strconv.FormatInt(entry.ID, 10) + "/result?download=true"
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	want := `attachment; filename="ldapmerge-result-` + strconv.FormatInt(entry.ID, 10) + `.json"`
+	if got := rec.Header().Get("Content-Disposition"); got != want {
+		t.Errorf("Expected Content-Disposition %q, got %q", want, got)
+	}
+
+	if !strings.Contains(rec.Body.String(), "\n    {") {
+		t.Errorf("Expected pretty-printed body, got %s", rec.Body.String())
+	}
+
+	var domains []models.Domain
+	if err := json.Unmarshal(rec.Body.Bytes(), &domains); err != nil {
+		t.Fatalf("Failed to decode result: %v", err)
+	}
+	if len(domains) != 1 || domains[0].ID != "example.lab" {
+		t.Errorf("Unexpected result: %+v", domains)
+	}
+}
+
+func TestGetHistoryResultSplit(t *testing.T) {
+	s, repo := setupTestServer(t)
+
+	result := []models.Domain{{ID: "example.lab"}, {ID: "corp/emea"}}
+	entry, err := repo.SaveHistory(context.Background(), nil, models.CertificateResponse{}, result)
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	path := "/api/history/" + strconv.FormatInt(entry.ID, 10) + "/result?split=true"
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/zip" {
+		t.Errorf("Expected application/zip, got %q", got)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open zip: %v", err)
+	}
+	if len(zr.File) != 2 || zr.File[0].Name != "example.lab.json" || zr.File[1].Name != "corp_emea.json" {
+		t.Fatalf("Unexpected files %+v", zr.File)
+	}
+	f, err := zr.File[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var domains []models.Domain
+	if err := json.NewDecoder(f).Decode(&domains); err != nil || len(domains) != 1 || domains[0].ID != "corp/emea" {
+		t.Errorf("Unexpected file content %+v: %v", domains, err)
+	}
+}
+
+func TestGetHistoryResultSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(priv)
+	keyFile := filepath.Join(t.TempDir(), "signing.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	signer, err := signing.NewEd25519Signer(keyFile)
+	if err != nil {
+		t.Fatalf("NewEd25519Signer failed: %v", err)
+	}
+
+	unsigned, repo := setupTestServer(t)
+	s := NewServerWithOptions(":0", repo, Options{Merge: DefaultOptions().Merge, Signer: signer})
+
+	entry, err := repo.SaveHistory(context.Background(), nil, models.CertificateResponse{}, []models.Domain{{ID: "example.lab"}})
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	id := strconv.FormatInt(entry.ID, 10)
+
+	get := func(s *Server, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	if rec := get(unsigned, "/api/history/"+id+"/result/signature"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without signer, got %d", rec.Code)
+	}
+
+	result := get(s, "/api/history/"+id+"/result?download=true")
+	sig := get(s, "/api/history/"+id+"/result/signature")
+	if sig.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", sig.Code, sig.Body.String())
+	}
+
+	if _, err := signing.VerifyEd25519(result.Body.Bytes(), sig.Body.Bytes(), pub); err != nil {
+		t.Errorf("Expected signature to match downloaded result: %v", err)
+	}
+}
+
+func TestListHistory(t *testing.T) {
+	s, repo := setupTestServer(t)
+
+	result := []models.Domain{{ID: "example.lab", LDAPServers: []models.LDAPServer{
+		{URL: "ldaps://ad-01.example.lab:636", Certificates: []string{"cert-a", "cert-b"}},
+		{URL: "ldaps://ad-02.example.lab:636"},
+	}}}
+	entry, err := repo.SaveHistory(context.Background(), nil, models.CertificateResponse{}, result)
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+
+	for _, full := range []bool{false, true} {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/history?full="+strconv.FormatBool(full), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var entries []HistoryListEntry
+		if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+			t.Fatalf("Failed to decode history: %v", err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("Expected 1 entry, got %d", len(entries))
+		}
+		got := entries[0]
+		if got.ID != entry.ID || got.Domains != 1 || got.Servers != 2 || got.Certificates != 2 || got.Size != entry.Size {
+			t.Errorf("Unexpected summary (full=%t): %+v", full, got.HistorySummary)
+		}
+		if full != (got.Result != nil) || full != strings.Contains(rec.Body.String(), `"initial"`) {
+			t.Errorf("Expected data only with full=true (full=%t): %s", full, rec.Body.String())
+		}
+		if full && got.Result.Data[0].LDAPServers[0].Certificates[1] != "cert-b" {
+			t.Errorf("Unexpected result: %+v", got.Result.Data)
+		}
+	}
+}
+
+func TestListHistoryFilters(t *testing.T) {
+	s, repo := setupTestServer(t)
+
+	var ids []int64
+	for _, id := range []string{"a.lab", "b.lab", "a.lab"} {
+		entry, err := repo.SaveHistory(context.Background(), nil, models.CertificateResponse{}, []models.Domain{{ID: id}})
+		if err != nil {
+			t.Fatalf("SaveHistory failed: %v", err)
+		}
+		ids = append(ids, entry.ID)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/history?domain=A.lab&order=asc&limit=1&offset=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var entries []HistoryListEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("Failed to decode history: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != ids[2] {
+		t.Errorf("Expected the second a.lab entry, got %+v", entries)
+	}
+	if total := rec.Header().Get("X-Total-Count"); total != "2" {
+		t.Errorf("Expected X-Total-Count 2, got %q", total)
+	}
+
+	for _, query := range []string{
+		"from=2025-01-02T00:00:00Z&to=2025-01-01T00:00:00Z",
+		"sort=tenant",
+		"limit=0",
+	} {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/history?"+query, nil))
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestDiffHistory(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	a, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, []models.Domain{
+		{ID: "example.lab", LDAPServers: []models.LDAPServer{{URL: "ldaps://ad-01.example.lab:636"}}},
+	})
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	b, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, []models.Domain{
+		{ID: "example.lab", LDAPServers: []models.LDAPServer{{URL: "ldaps://ad-01.example.lab:636"}, {URL: "ldaps://ad-02.example.lab:636"}}},
+		{ID: "example.org"},
+	})
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	path := "/api/history/diff?a=" + strconv.FormatInt(a.ID, 10) + "&b=" + strconv.FormatInt(b.ID, 10)
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var body HistoryDiffOutput
+	if err := json.Unmarshal(rec.Body.Bytes(), &body.Body); err != nil {
+		t.Fatalf("Failed to decode diff: %v", err)
+	}
+
+	diff := body.Body.Diff
+	if body.Body.Identical || diff == nil {
+		t.Fatal("Expected differences")
+	}
+	if len(diff.AddedDomains) != 1 || diff.AddedDomains[0] != "example.org" {
+		t.Errorf("Expected added domain example.org, got %v", diff.AddedDomains)
+	}
+	if len(diff.ChangedDomains) != 1 || len(diff.ChangedDomains[0].AddedServers) != 1 {
+		t.Errorf("Expected one added server in example.lab, got %+v", diff.ChangedDomains)
+	}
+	if !strings.Contains(body.Body.Text, "+ server ldaps://ad-02.example.lab:636") {
+		t.Errorf("Unexpected text diff: %s", body.Body.Text)
+	}
+}
+
+func TestDeleteHistory(t *testing.T) {
+	s, repo := setupTestServer(t)
+
+	entry, err := repo.SaveHistory(context.Background(), nil, models.CertificateResponse{}, []models.Domain{{ID: "example.lab"}})
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	path := "/api/history/" + strconv.FormatInt(entry.ID, 10)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, path, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		rec = httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected %s of a deleted entry to return 404, got %d", method, rec.Code)
+		}
+	}
+}
+
+func TestPurgeHistory(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, []models.Domain{{ID: "example.lab"}}); err != nil {
+			t.Fatalf("SaveHistory failed: %v", err)
+		}
+	}
+
+	purge := func(query string) (int, HistoryPurgeOutput) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/history"+query, nil))
+		var output HistoryPurgeOutput
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &output.Body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return rec.Code, output
+	}
+
+	if code, _ := purge(""); code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 without before, got %d", code)
+	}
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	if code, output := purge("?before=" + past); code != http.StatusOK || output.Body.Deleted != 0 {
+		t.Errorf("Expected nothing purged before an hour ago, got %d, %+v", code, output.Body)
+	}
+
+	future := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+	if code, output := purge("?before=" + future); code != http.StatusOK || output.Body.Deleted != 3 {
+		t.Errorf("Expected 3 entries purged, got %d, %+v", code, output.Body)
+	}
+	if summaries, err := repo.ListHistorySummaries(ctx, repository.HistoryFilter{}); err != nil || len(summaries) != 0 {
+		t.Errorf("Expected no history left, got %d, %v", len(summaries), err)
+	}
+}
+
+func TestPushHistory(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	mockServer := mock.NewServer()
+	mockServer.ClearSources()
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	entry, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, []models.Domain{
+		{ID: "example.lab", DomainName: "example.lab", LDAPServers: []models.LDAPServer{{URL: "ldaps://ad-01.example.lab:636", Enabled: "true"}}},
+	})
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+
+	good, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "mock", Host: ts.URL, Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	bad, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "mock-bad", Host: ts.URL, Username: "admin", Password: "wrong"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	push := func(configID int64, reason string) *httptest.ResponseRecorder {
+		body := `{"config_id": ` + strconv.FormatInt(configID, 10) + `, "reason": ` + strconv.Quote(reason) + `}`
+		req := httptest.NewRequest(http.MethodPost, "/api/history/"+strconv.FormatInt(entry.ID, 10)+"/push", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := push(good.ID, "   ")
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a blank reason, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = push(good.ID, "CHG-1234")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := mockServer.GetSources()["example.lab"]; !ok {
+		t.Error("Expected example.lab to be pushed to NSX")
+	}
+	var output PushOutput
+	if err := json.Unmarshal(rec.Body.Bytes(), &output.Body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	snapshot, err := repo.GetSnapshot(ctx, output.Body.SnapshotID)
+	if err != nil {
+		t.Fatalf("Expected a pre-push snapshot: %v", err)
+	}
+	if snapshot.HistoryID == nil || *snapshot.HistoryID != entry.ID || len(snapshot.Sources) != 1 || snapshot.Sources[0].Existed {
+		t.Errorf("Expected a snapshot of the missing example.lab linked to the entry, got %+v", snapshot)
+	}
+
+	rec = push(bad.ID, "CHG-1235")
+	var errBody ErrorModel
+	if err := json.Unmarshal(rec.Body.Bytes(), &errBody); err != nil {
+		t.Fatalf("Failed to decode error: %v", err)
+	}
+	if rec.Code != http.StatusBadGateway || errBody.Code != CodeNSXAuth {
+		t.Errorf("Expected 502 %s, got %d %s", CodeNSXAuth, rec.Code, errBody.Code)
+	}
+
+	// Both pushes are audited, failed ones included
+	events := changeEvents(t, repo)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 audit events, got %d", len(events))
+	}
+	if e := events[1]; e.Operation != "history.push" || e.Origin != "api" || e.Reason != "CHG-1234" ||
+		e.Outcome != "success" || len(e.SourceIDs) != 1 || e.SourceIDs[0] != "example.lab" {
+		t.Errorf("Unexpected audit event %+v", e)
+	}
+	if e := events[0]; e.Reason != "CHG-1235" || e.Outcome != "failed" || e.Error == "" {
+		t.Errorf("Expected failed audit event with error, got %+v", e)
+	}
+}
+
+func TestPushHistoryProtected(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	guard, err := audit.NewGuard([]string{"prod.*"})
+	if err != nil {
+		t.Fatalf("NewGuard failed: %v", err)
+	}
+	s.guard = guard
+
+	mockServer := mock.NewServer()
+	mockServer.ClearSources()
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	entry, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, []models.Domain{
+		{ID: "prod.lab", DomainName: "prod.lab", LDAPServers: []models.LDAPServer{{URL: "ldaps://ad-01.prod.lab:636", Enabled: "true"}}},
+	})
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	config, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "mock", Host: ts.URL, Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	push := func(force bool) *httptest.ResponseRecorder {
+		body := `{"config_id": ` + strconv.FormatInt(config.ID, 10) + `, "reason": "CHG-1234", "force_protected": ` + strconv.FormatBool(force) + `}`
+		req := httptest.NewRequest(http.MethodPost, "/api/history/"+strconv.FormatInt(entry.ID, 10)+"/push", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := push(false)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409 for a protected source, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := mockServer.GetSources()["prod.lab"]; ok {
+		t.Error("Expected prod.lab not to be pushed without force_protected")
+	}
+
+	if rec = push(true); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with force_protected, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, ok := mockServer.GetSources()["prod.lab"]; !ok {
+		t.Error("Expected prod.lab to be pushed with force_protected")
+	}
+
+	// The refusal is audited, and the forced push names the protected source
+	events := changeEvents(t, repo)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 audit events, got %d", len(events))
+	}
+	if e := events[1]; e.Outcome != audit.OutcomeRefused || e.Error == "" || !slices.Equal(e.Protected, []string{"prod.lab"}) {
+		t.Errorf("Expected refused audit event, got %+v", e)
+	}
+	if e := events[0]; e.Outcome != audit.OutcomeSuccess || !slices.Equal(e.Protected, []string{"prod.lab"}) {
+		t.Errorf("Expected forced audit event naming prod.lab, got %+v", e)
+	}
+}
+
+func TestPushHistoryRealization(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+	s.realization.Interval = 10 * time.Millisecond
+
+	mockServer := mock.NewServer()
+	mockServer.ClearSources()
+	mockServer.SetRealization("example.lab", 2, nsx.RealizationSuccess, "")
+	mockServer.SetRealization("example.org", 0, nsx.RealizationError, "LDAP server unreachable")
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	entry, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, []models.Domain{
+		{ID: "example.lab", DomainName: "example.lab", LDAPServers: []models.LDAPServer{{URL: "ldaps://ad-01.example.lab:636", Enabled: "true"}}},
+		{ID: "example.org", DomainName: "example.org", LDAPServers: []models.LDAPServer{{URL: "ldaps://dc01.example.org:636", Enabled: "true"}}},
+	})
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	config, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "mock", Host: ts.URL, Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	body := `{"config_id": ` + strconv.FormatInt(config.ID, 10) + `, "reason": "CHG-1234"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/history/"+strconv.FormatInt(entry.ID, 10)+"/push", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// NSX accepted both, but only realized example.lab
+	var output PushOutput
+	if err := json.Unmarshal(rec.Body.Bytes(), &output.Body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if output.Body.Succeeded != 1 || output.Body.Failed != 1 {
+		t.Fatalf("Expected 1 succeeded and 1 failed source, got %+v", output.Body)
+	}
+	for _, result := range output.Body.Results {
+		if result.ID == "example.org" && (result.Success || !strings.Contains(result.Error, "LDAP server unreachable")) {
+			t.Errorf("Expected realization failure for example.org, got %+v", result)
+		}
+	}
+
+	events := changeEvents(t, repo)
+	if len(events) != 1 || events[0].Outcome != audit.OutcomePartial {
+		t.Errorf("Expected one partial audit event, got %+v", events)
+	}
+}
+
+func TestPushHistorySyncDefaults(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+	s.realization.Interval = 10 * time.Millisecond
+
+	mockServer := mock.NewServer()
+	mockServer.ClearSources()
+	mockServer.SetRealization("example.org", 0, nsx.RealizationError, "LDAP server unreachable")
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	entry, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, []models.Domain{
+		{ID: "example.lab", DomainName: "example.lab", LDAPServers: []models.LDAPServer{{URL: "ldaps://ad-01.example.lab:636", Enabled: "true"}}},
+		{ID: "example.org", DomainName: "example.org", LDAPServers: []models.LDAPServer{{URL: "ldaps://dc01.example.org:636", Enabled: "true"}}},
+		{ID: "other.test", DomainName: "other.test", LDAPServers: []models.LDAPServer{{URL: "ldaps://dc01.other.test:636", Enabled: "true"}}},
+	})
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+
+	do := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	config := `{"name": "mock", "host": ` + strconv.Quote(ts.URL) + `, "username": "admin", "password": "secret", "insecure": false,
+		"sync_defaults": {"dry_run": true, "domains": ["example.*"], "canary": %q}}`
+	if rec := do("/api/configs", fmt.Sprintf(config, "other.test")); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a canary outside the domain filter, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := do("/api/configs", fmt.Sprintf(config, "example.org"))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var saved models.NSXConfig
+	if err := json.Unmarshal(rec.Body.Bytes(), &saved); err != nil {
+		t.Fatalf("Failed to decode config: %v", err)
+	}
+
+	push := func(extra string) PushOutput {
+		t.Helper()
+		body := `{"config_id": ` + strconv.FormatInt(saved.ID, 10) + `, "reason": "CHG-1234"` + extra + `}`
+		rec := do("/api/history/"+strconv.FormatInt(entry.ID, 10)+"/push", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var output PushOutput
+		if err := json.Unmarshal(rec.Body.Bytes(), &output.Body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return output
+	}
+
+	// The saved defaults make it a dry run of the filtered sources, canary first
+	output := push("")
+	if !output.Body.DryRun || !slices.Equal(output.Body.Planned, []string{"example.org", "example.lab"}) {
+		t.Errorf("Expected a dry run of example.org and example.lab, got %+v", output.Body)
+	}
+	if len(mockServer.GetSources()) != 0 {
+		t.Error("Expected a dry run not to push")
+	}
+
+	// The canary fails, so the other source is skipped
+	output = push(`, "dry_run": false`)
+	if output.Body.DryRun || output.Body.Failed != 1 || output.Body.Succeeded != 0 || !slices.Equal(output.Body.Skipped, []string{"example.lab"}) {
+		t.Errorf("Expected the failed canary to skip example.lab, got %+v", output.Body)
+	}
+	if _, ok := mockServer.GetSources()["example.lab"]; ok {
+		t.Error("Expected example.lab not to be pushed after the canary failed")
+	}
+
+	// Request fields override the defaults
+	output = push(`, "dry_run": false, "domains": ["*"], "canary": ""`)
+	if output.Body.Succeeded != 2 || output.Body.Failed != 1 || len(output.Body.Skipped) != 0 {
+		t.Errorf("Expected every source pushed, got %+v", output.Body)
+	}
+
+	// In parallel, results keep the order of the sources; stop_on_error
+	// skips the ones after the failure
+	output = push(`, "dry_run": false, "domains": ["*"], "canary": "", "concurrency": 3`)
+	if len(output.Body.Results) != 3 || output.Body.Results[0].ID != "example.lab" || output.Body.Results[2].ID != "other.test" {
+		t.Errorf("Expected results in source order, got %+v", output.Body.Results)
+	}
+	output = push(`, "dry_run": false, "domains": ["*"], "canary": "", "stop_on_error": true`)
+	if output.Body.Succeeded != 1 || output.Body.Failed != 1 || !slices.Equal(output.Body.Skipped, []string{"other.test"}) {
+		t.Errorf("Expected other.test skipped after example.org failed, got %+v", output.Body)
+	}
+}
+
+func TestPushHistoryConflict(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	mockServer := mock.NewServer()
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	// Pulled at revision 0, as seeded
+	revision := int64(0)
+	entry, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, []models.Domain{
+		{ID: "example.lab", DomainName: "example.lab", Revision: &revision, LDAPServers: []models.LDAPServer{{URL: "ldaps://ad-01.example.lab:636", Enabled: "true"}}},
+	})
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	config, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "mock", Host: ts.URL, Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	push := func(retry bool) PushSourceResult {
+		body := `{"config_id": ` + strconv.FormatInt(config.ID, 10) + `, "reason": "CHG-1234", "retry_conflicts": ` + strconv.FormatBool(retry) + `}`
+		req := httptest.NewRequest(http.MethodPost, "/api/history/"+strconv.FormatInt(entry.ID, 10)+"/push", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var output PushOutput
+		if err := json.Unmarshal(rec.Body.Bytes(), &output.Body); err != nil || len(output.Body.Results) != 1 {
+			t.Fatalf("Unexpected response %s (%v)", rec.Body.String(), err)
+		}
+		return output.Body.Results[0]
+	}
+
+	if result := push(false); !result.Success || result.Retried {
+		t.Fatalf("Expected the first push to succeed, got %+v", result)
+	}
+	// NSX is at revision 1 now
+	if result := push(false); result.Success || !result.Conflict || !strings.Contains(result.Error, "re-pull") {
+		t.Errorf("Expected a revision conflict, got %+v", result)
+	}
+	if result := push(true); !result.Success || !result.Retried {
+		t.Errorf("Expected the push to be retried at the current revision, got %+v", result)
+	}
+}
+
+func TestPushHistoryBindPasswords(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+	s.bindPasswords = credentials.New()
+	s.bindPasswords.Set("ldaps://ad-01.example.lab", "bind-secret")
+
+	mockServer := mock.NewServer()
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	// As pulled: NSX returns no bind passwords
+	entry, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, []models.Domain{
+		{ID: "example.lab", DomainName: "example.lab", LDAPServers: []models.LDAPServer{
+			{URL: "ldaps://ad-01.example.lab:636", Enabled: "true", BindUsername: "sync_to_ad@example.lab"},
+			{URL: "ldaps://ad-02.example.lab:636", Enabled: "true", BindUsername: "sync_to_ad@example.lab"},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	config, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "mock", Host: ts.URL, Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	body := `{"config_id": ` + strconv.FormatInt(config.ID, 10) + `, "reason": "CHG-1234"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/history/"+strconv.FormatInt(entry.ID, 10)+"/push", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var output PushOutput
+	if err := json.Unmarshal(rec.Body.Bytes(), &output.Body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if want := []string{"ldaps://ad-02.example.lab:636"}; !slices.Equal(output.Body.MissingBindPasswords, want) {
+		t.Errorf("Expected %v reported missing, got %v", want, output.Body.MissingBindPasswords)
+	}
+
+	// ad-02 is patched without one and keeps the password NSX has
+	servers := mockServer.GetSources()["example.lab"].LDAPServers
+	if servers[0].Password != "bind-secret" || servers[1].Password != "secret" {
+		t.Errorf("Expected ad-01 pushed with its bind password and ad-02 kept, got %+v", servers)
+	}
+
+	body = `{"config_id": ` + strconv.FormatInt(config.ID, 10) + `, "reason": "CHG-1234", "clear_bind_passwords": true}`
+	req = httptest.NewRequest(http.MethodPost, "/api/history/"+strconv.FormatInt(entry.ID, 10)+"/push", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if servers := mockServer.GetSources()["example.lab"].LDAPServers; servers[1].Password != "" {
+		t.Errorf("Expected clear_bind_passwords to clear the ad-02 password, got %+v", servers)
+	}
+}
+
+func TestMergeSaveHistory(t *testing.T) {
+	s, repo := setupTestServer(t)
+
+	merge := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/merge", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	merge(`{"initial": [], "response": {"results": []}, "save_history": false}`)
+	merge(`{"initial": [], "response": {"results": []}}`)
+
+	entries, err := repo.ListHistory(context.Background(), repository.HistoryFilter{})
+	if err != nil {
+		t.Fatalf("ListHistory failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected 1 history entry, got %d", len(entries))
+	}
+}
+
+func TestMergeRunID(t *testing.T) {
+	s, repo := setupTestServer(t)
+
+	merge := func(runID string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/merge", strings.NewReader(`{"initial":[{"id":"example.lab","domain_name":"example.lab","base_dn":"DC=example,DC=lab","alternative_domain_names":[],"ldap_servers":[]}],"response":{"results":[]}}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(RunIDHeader, runID)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Merge failed: %d %s", rec.Code, rec.Body.String())
+		}
+		return rec.Header().Get(RunIDHeader)
+	}
+
+	if got := merge("CHG-1234.ansible_42"); got != "CHG-1234.ansible_42" {
+		t.Errorf("Expected the run ID of the request, got %q", got)
+	}
+	generated := merge("not a valid id")
+	if generated == "" || generated == "not a valid id" {
+		t.Errorf("Expected a generated run ID, got %q", generated)
+	}
+
+	summaries, err := repo.ListHistorySummaries(context.Background(), repository.HistoryFilter{})
+	if err != nil {
+		t.Fatalf("ListHistorySummaries failed: %v", err)
+	}
+	if len(summaries) != 2 || summaries[0].RunID != generated || summaries[1].RunID != "CHG-1234.ansible_42" {
+		t.Errorf("Expected the history entries with their run IDs, got %+v", summaries)
+	}
+}
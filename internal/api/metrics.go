@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"ldapmerge/internal/metrics"
+	"ldapmerge/internal/models"
+)
+
+// collectInventoryMetrics exports certificate expiry and probe status of the
+// server inventory, one series per NSX Manager, identity source and URL, and
+// the certificate population of each identity source.
+func (s *Server) collectInventoryMetrics(ctx context.Context) ([]metrics.Family, error) {
+	if s.repo == nil {
+		return nil, nil
+	}
+
+	servers, err := s.repo.ListServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := metrics.Family{
+		Name: "ldapmerge_certificate_expiry_seconds",
+		Help: "Seconds until the LDAP server's leaf certificate expires; negative once expired.",
+		Type: metrics.TypeGauge,
+	}
+	success := metrics.Family{
+		Name: "ldapmerge_server_probe_success",
+		Help: "Whether the last probe of the LDAP server succeeded (1) or failed (0).",
+		Type: metrics.TypeGauge,
+	}
+	failures := metrics.Family{
+		Name: "ldapmerge_server_probe_consecutive_failures",
+		Help: "Failed probes of the LDAP server since the last successful one.",
+		Type: metrics.TypeGauge,
+	}
+	lastProbe := metrics.Family{
+		Name: "ldapmerge_server_probe_timestamp_seconds",
+		Help: "Unix time of the last probe of the LDAP server.",
+		Type: metrics.TypeGauge,
+	}
+	uptime := metrics.Family{
+		Name: "ldapmerge_server_probe_uptime_ratio",
+		Help: "Share of successful probes in the retained probe history (0-1).",
+		Type: metrics.TypeGauge,
+	}
+
+	now := time.Now()
+	for _, server := range servers {
+		labels := metrics.Labels{
+			"nsx_host": server.NSXHost,
+			"domain":   server.DomainID,
+			"url":      server.URL,
+		}
+
+		if server.CertExpiresAt != nil {
+			certLabels := metrics.Labels{"subject": server.CertSubject}
+			for k, v := range labels {
+				certLabels[k] = v
+			}
+			expiry.Samples = append(expiry.Samples, metrics.Sample{
+				Labels: certLabels,
+				Value:  server.CertExpiresAt.Sub(now).Seconds(),
+			})
+		}
+
+		if server.LastProbeOK == nil {
+			continue
+		}
+		success.Samples = append(success.Samples, metrics.Sample{Labels: labels, Value: boolValue(*server.LastProbeOK)})
+		failures.Samples = append(failures.Samples, metrics.Sample{Labels: labels, Value: float64(server.ConsecutiveFailures)})
+		if server.LastProbeAt != nil {
+			lastProbe.Samples = append(lastProbe.Samples, metrics.Sample{Labels: labels, Value: float64(server.LastProbeAt.Unix())})
+		}
+		if server.Uptime != nil {
+			uptime.Samples = append(uptime.Samples, metrics.Sample{Labels: labels, Value: *server.Uptime / 100})
+		}
+	}
+
+	families := []metrics.Family{expiry, success, failures, lastProbe, uptime}
+	return append(families, domainMetrics(servers, now)...), nil
+}
+
+// domainMetrics exports the servers, certificates and soonest certificate
+// expiry of each identity source, one series per NSX Manager and domain, so
+// that dashboards can aggregate them by business domain.
+func domainMetrics(servers []models.InventoryServer, now time.Time) []metrics.Family {
+	count := metrics.Family{
+		Name: "ldapmerge_domain_servers",
+		Help: "LDAP servers of the identity source in the inventory.",
+		Type: metrics.TypeGauge,
+	}
+	certificates := metrics.Family{
+		Name: "ldapmerge_domain_certificates",
+		Help: "Certificates configured for the LDAP servers of the identity source.",
+		Type: metrics.TypeGauge,
+	}
+	uncertified := metrics.Family{
+		Name: "ldapmerge_domain_servers_without_certificate",
+		Help: "LDAP servers of the identity source with no certificate configured.",
+		Type: metrics.TypeGauge,
+	}
+	expiry := metrics.Family{
+		Name: "ldapmerge_domain_certificate_expiry_days",
+		Help: "Days until the soonest leaf certificate of the identity source expires; negative once expired.",
+		Type: metrics.TypeGauge,
+	}
+
+	// Servers are ordered by NSX host and domain, so each domain is a run
+	for start := 0; start < len(servers); {
+		end := start + 1
+		for end < len(servers) && servers[end].NSXHost == servers[start].NSXHost && servers[end].DomainID == servers[start].DomainID {
+			end++
+		}
+		domain := servers[start:end]
+		start = end
+
+		var certs, without int
+		var soonest *time.Time
+		for _, server := range domain {
+			certs += server.CertCount
+			if server.CertCount == 0 {
+				without++
+			}
+			if server.CertExpiresAt != nil && (soonest == nil || server.CertExpiresAt.Before(*soonest)) {
+				soonest = server.CertExpiresAt
+			}
+		}
+
+		labels := metrics.Labels{"nsx_host": domain[0].NSXHost, "domain": domain[0].DomainID}
+		count.Samples = append(count.Samples, metrics.Sample{Labels: labels, Value: float64(len(domain))})
+		certificates.Samples = append(certificates.Samples, metrics.Sample{Labels: labels, Value: float64(certs)})
+		uncertified.Samples = append(uncertified.Samples, metrics.Sample{Labels: labels, Value: float64(without)})
+		if soonest != nil {
+			expiry.Samples = append(expiry.Samples, metrics.Sample{Labels: labels, Value: soonest.Sub(now).Hours() / 24})
+		}
+	}
+
+	return []metrics.Family{count, certificates, uncertified, expiry}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+)
+
+func TestMetricsInventory(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	url := "ldaps://ad-01.example.lab:636"
+	domains := []models.Domain{{ID: "example.lab", LDAPServers: []models.LDAPServer{
+		{URL: url, Enabled: "true", Certificates: []string{testCertificate(t, "ad-01.example.lab", time.Now().Add(30*24*time.Hour))}},
+		{URL: "ldaps://ad-02.example.lab:636", Enabled: "true", Certificates: []string{
+			testCertificate(t, "ad-02.example.lab", time.Now().Add(90*24*time.Hour)),
+			testCertificate(t, "Example Root CA", time.Now().Add(3650*24*time.Hour)),
+		}},
+		{URL: "ldaps://ad-03.example.lab:636", Enabled: "true"},
+	}}}
+	if _, err := repo.UpdateInventory(ctx, "https://nsx.example.com", domains); err != nil {
+		t.Fatalf("UpdateInventory failed: %v", err)
+	}
+	if err := repo.RecordProbe(ctx, "https://nsx.example.com", url, false, "connection refused"); err != nil {
+		t.Fatalf("RecordProbe failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected text/plain content type, got %q", ct)
+	}
+
+	body := rec.Body.String()
+	labels := `{domain="example.lab",nsx_host="https://nsx.example.com",url="ldaps://ad-01.example.lab:636"}`
+	for _, want := range []string{
+		"# TYPE ldapmerge_certificate_expiry_seconds gauge",
+		`ldapmerge_certificate_expiry_seconds{domain="example.lab",nsx_host="https://nsx.example.com",subject="ad-01.example.lab",url="ldaps://ad-01.example.lab:636"} `,
+		"ldapmerge_server_probe_success" + labels + " 0",
+		"ldapmerge_server_probe_consecutive_failures" + labels + " 1",
+		"ldapmerge_server_probe_uptime_ratio" + labels + " 0",
+		`ldapmerge_domain_servers{domain="example.lab",nsx_host="https://nsx.example.com"} 3`,
+		`ldapmerge_domain_certificates{domain="example.lab",nsx_host="https://nsx.example.com"} 3`,
+		`ldapmerge_domain_servers_without_certificate{domain="example.lab",nsx_host="https://nsx.example.com"} 1`,
+		`ldapmerge_domain_certificate_expiry_days{domain="example.lab",nsx_host="https://nsx.example.com"} 29.99`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func testCertificate(t *testing.T, cn string, notAfter time.Time) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestMergeStatsRecorded(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	body := `{"initial": [{"id": "example.lab", "domain_name": "example.lab", "base_dn": "DC=example,DC=lab",
+		"alternative_domain_names": [], "ldap_servers": [{"url": "ldaps://ad-01.example.lab:636", "starttls": "false", "enabled": "true"},
+		                 {"url": "ldaps://ad-02.example.lab:636", "starttls": "false", "enabled": "true"}]}],
+		"response": {"results": [{"item": {"url": "ldaps://ad-01.example.lab:636", "starttls": "false", "enabled": "true"},
+		                          "json": {"pem_encoded": "CERT", "details": []}}]}}`
+	req := httptest.NewRequest(http.MethodPost, "/api/merge", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	entries, err := repo.ListHistory(ctx, repository.HistoryFilter{})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected one history entry, got %d (%v)", len(entries), err)
+	}
+	stats := entries[0].Stats
+	if stats == nil {
+		t.Fatal("Expected merge stats in history")
+	}
+	if stats.Servers != 2 || stats.MatchedServers != 1 || stats.MatchRatio != 0.5 || stats.InputBytes == 0 {
+		t.Errorf("Unexpected merge stats: %+v", stats)
+	}
+
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		"# TYPE ldapmerge_merge_duration_seconds histogram",
+		"ldapmerge_merge_match_ratio_bucket{le=\"0.5\"}",
+		"ldapmerge_merge_servers_count ",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
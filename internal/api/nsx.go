@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/logging"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+)
+
+// NSXConfigPathInput is the path parameter for operations on the NSX Manager
+// of a saved configuration
+type NSXConfigPathInput struct {
+	ConfigID int64 `path:"configId" doc:"ID of the saved NSX configuration"`
+}
+
+// NSXSourcesOutput is the response for pulling identity sources from NSX
+type NSXSourcesOutput struct {
+	Body []models.Domain
+}
+
+// NSXPushInput is the request for pushing domains to NSX
+type NSXPushInput struct {
+	ConfigID int64 `path:"configId" doc:"ID of the saved NSX configuration to push to"`
+	Body     struct {
+		Result []models.Domain `json:"result" minItems:"1" doc:"Domains to push, such as the merged result of POST /api/merge"`
+		PushOptions
+	}
+}
+
+func (s *Server) handleListNSXSources(ctx context.Context, input *NSXConfigPathInput) (*NSXSourcesOutput, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "config not available")
+	}
+
+	config, err := s.repo.GetConfig(ctx, input.ConfigID)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "config not found")
+	}
+
+	start := time.Now()
+	log := logging.RunLogger(ctx).With("config_id", config.ID, "nsx_host", config.Host)
+
+	result, err := s.newNSXClient(config).ListLDAPIdentitySources(ctx)
+	if err != nil {
+		log.Error("failed to fetch LDAP identity sources", "error", err)
+		if se := nsxError(err); se != nil {
+			return nil, se
+		}
+		return nil, apiError(http.StatusBadGateway, CodeNSXAPI, "failed to fetch LDAP identity sources", err)
+	}
+
+	domains := nsx.LDAPIdentitySourcesToDomains(result.Results)
+	log.Info("pull completed", "sources_count", len(domains), "duration", time.Since(start))
+
+	// As with ldapmerge nsx pull, the servers pulled are recorded in the
+	// inventory; a failure does not fail the pull
+	if count, err := s.repo.UpdateInventory(ctx, config.Host, domains); err != nil {
+		log.Warn("inventory not updated", "error", err)
+	} else {
+		log.Info("inventory updated", "servers_count", count)
+	}
+
+	return &NSXSourcesOutput{Body: domains}, nil
+}
+
+func (s *Server) handlePushNSX(ctx context.Context, input *NSXPushInput) (*PushOutput, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "config not available")
+	}
+	if err := audit.CheckReason(input.Body.Reason); err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error())
+	}
+
+	config, err := s.repo.GetConfig(ctx, input.ConfigID)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "config not found")
+	}
+
+	plan, err := newPushPlan(config.SyncDefaults, input.Body.DryRun, input.Body.Domains, input.Body.Canary)
+	if err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error())
+	}
+	domains, err := plan.domains(input.Body.Result)
+	if err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error())
+	}
+
+	log := logging.RunLogger(ctx).With("config_id", config.ID, "nsx_host", config.Host)
+	if plan.dryRun {
+		log.Info("dry run of push, NSX left unchanged", "domains_count", len(domains))
+		return plannedPush(config, domains), nil
+	}
+	log.Info("pushing domains to NSX", "domains_count", len(domains), "canary", plan.canary)
+
+	return s.push(ctx, log, audit.OperationNSXPush, config, domains, plan, &input.Body.PushOptions, nil)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx/mock"
+	"ldapmerge/internal/repository"
+)
+
+func TestListNSXSources(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	mockServer := mock.NewServer()
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	config, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "mock", Host: ts.URL, Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	rejected, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "rejected", Host: ts.URL, Username: "admin", Password: "wrong"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	get := func(id int64) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/nsx/"+strconv.FormatInt(id, 10)+"/sources", nil))
+		return rec
+	}
+
+	rec := get(config.ID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var domains []models.Domain
+	if err := json.Unmarshal(rec.Body.Bytes(), &domains); err != nil {
+		t.Fatalf("Failed to decode sources: %v", err)
+	}
+	if len(domains) != len(mockServer.GetSources()) {
+		t.Fatalf("Expected %d domains, got %d", len(mockServer.GetSources()), len(domains))
+	}
+	for _, domain := range domains {
+		source := mockServer.GetSources()[domain.ID]
+		if source == nil || domain.BaseDN != source.BaseDN || len(domain.LDAPServers) != len(source.LDAPServers) {
+			t.Errorf("Domain %s does not match its source: %+v", domain.ID, domain)
+		}
+	}
+
+	servers, err := repo.ListServers(ctx)
+	if err != nil || len(servers) == 0 || servers[0].NSXHost != ts.URL {
+		t.Errorf("Expected the pulled servers in the inventory, got %+v (%v)", servers, err)
+	}
+
+	if rec := get(rejected.ID); rec.Code != http.StatusBadGateway || !strings.Contains(rec.Body.String(), string(CodeNSXAuth)) {
+		t.Errorf("Expected status 502 for rejected credentials, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := get(config.ID + 100); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown config, got %d", rec.Code)
+	}
+}
+
+func TestPushNSX(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	mockServer := mock.NewServer()
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	config, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "mock", Host: ts.URL, Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	path := "/api/nsx/" + strconv.FormatInt(config.ID, 10) + "/push"
+
+	do := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+	result := `[{"id": "example.lab", "domain_name": "example.lab", "base_dn": "DC=changed", "alternative_domain_names": [], "ldap_servers": []},
+		{"id": "new.lab", "domain_name": "new.lab", "base_dn": "DC=new,DC=lab", "alternative_domain_names": [], "ldap_servers": []}]`
+
+	rec := do(`{"result": ` + result + `, "reason": "CHG-1", "dry_run": true}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"planned":["example.lab","new.lab"]`) {
+		t.Fatalf("Expected a dry run of both sources, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if mockServer.GetSources()["example.lab"].BaseDN == "DC=changed" {
+		t.Fatal("Expected the dry run to leave NSX unchanged")
+	}
+
+	rec = do(`{"result": ` + result + `, "reason": "CHG-1"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected push to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var pushed PushOutput
+	if err := json.Unmarshal(rec.Body.Bytes(), &pushed.Body); err != nil {
+		t.Fatalf("Failed to decode push response: %v", err)
+	}
+	if pushed.Body.Succeeded != 2 || pushed.Body.Failed != 0 || pushed.Body.SnapshotID == 0 {
+		t.Errorf("Unexpected push outcome: %+v", pushed.Body)
+	}
+	if mockServer.GetSources()["example.lab"].BaseDN != "DC=changed" || mockServer.GetSources()["new.lab"] == nil {
+		t.Error("Expected both sources pushed to NSX")
+	}
+
+	events, err := repo.ListAuditEvents(ctx, repository.AuditFilter{Operation: "nsx.push"})
+	if err != nil || len(events) != 1 || events[0].Outcome != "success" || events[0].Reason != "CHG-1" || events[0].Origin != "api" {
+		t.Errorf("Expected a successful nsx.push audit event, got %+v (%v)", events, err)
+	}
+
+	for _, body := range []string{
+		`{"result": [], "reason": "CHG-1"}`,
+		`{"result": ` + result + `}`,
+		`{"result": ` + result + `, "reason": "CHG-1", "domains": ["other.lab"]}`,
+	} {
+		if rec := do(body); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status 422 for %s, got %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/credentials"
+	"ldapmerge/internal/logging"
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+)
+
+// PushOptions are the options of a push of identity sources to NSX
+type PushOptions struct {
+	Reason             string `json:"reason" minLength:"1" maxLength:"1000" doc:"Justification for the change, stored in the audit log" example:"CHG-1234: restore AD certificates after NSX restore"`
+	ForceProtected     bool   `json:"force_protected,omitempty" doc:"Allow changes to identity sources matching the server's protected_sources patterns"`
+	RetryConflicts     bool   `json:"retry_conflicts,omitempty" doc:"Push sources changed on NSX since they were pulled again at their current revision, overwriting the change"`
+	ClearBindPasswords bool   `json:"clear_bind_passwords,omitempty" doc:"Replace sources with PUT even if LDAP servers lack a bind password, clearing the one NSX has; by default such sources are patched and NSX keeps it"`
+
+	DryRun  *bool    `json:"dry_run,omitempty" doc:"List the sources to push without changing NSX; defaults to the configuration's sync_defaults"`
+	Domains []string `json:"domains,omitempty" doc:"Glob patterns of the identity source IDs to push; defaults to the configuration's sync_defaults, then all" example:"[\"*.example.lab\"]"`
+	Canary  *string  `json:"canary,omitempty" doc:"ID of a source to push first, pushing the others only if NSX accepts it; defaults to the configuration's sync_defaults" example:"lab.example.lab"`
+
+	Concurrency int  `json:"concurrency,omitempty" minimum:"0" maximum:"16" doc:"Number of sources pushed to the NSX Manager at once; 0 and 1 push them one at a time. Results keep the order of the sources" example:"4"`
+	StopOnError bool `json:"stop_on_error,omitempty" doc:"Skip the sources not yet started once one fails, instead of pushing them all"`
+}
+
+// HistoryPushInput is the request for re-pushing a history entry to NSX
+type HistoryPushInput struct {
+	ID   int64 `path:"id" doc:"History entry ID"`
+	Body struct {
+		ConfigID int64 `json:"config_id" doc:"ID of the saved NSX configuration to push to" example:"1"`
+		PushOptions
+	}
+}
+
+// PushSourceResult is the outcome of pushing one identity source
+type PushSourceResult struct {
+	ID       string `json:"id" doc:"Identity source ID" example:"example.lab"`
+	Success  bool   `json:"success" doc:"True if NSX accepted and realized the update"`
+	Error    string `json:"error,omitempty" doc:"NSX error message"`
+	Conflict bool   `json:"conflict,omitempty" doc:"True if the source changed on NSX since it was pulled and was not overwritten"`
+	Retried  bool   `json:"retried,omitempty" doc:"True if the source changed on NSX since it was pulled and was pushed again at its current revision"`
+}
+
+// PushResult is the outcome of a push to NSX
+type PushResult struct {
+	ConfigID   int64              `json:"config_id" doc:"NSX configuration ID"`
+	Host       string             `json:"host" doc:"NSX Manager URL"`
+	Succeeded  int                `json:"succeeded" doc:"Number of identity sources updated"`
+	Failed     int                `json:"failed" doc:"Number of identity sources that failed"`
+	SnapshotID int64              `json:"snapshot_id" doc:"ID of the snapshot of the sources' state before the push" example:"7"`
+	Results    []PushSourceResult `json:"results" doc:"Per-source results"`
+	DryRun     bool               `json:"dry_run,omitempty" doc:"True if nothing was pushed"`
+	Planned    []string           `json:"planned,omitempty" doc:"IDs of the sources a dry run would push, in order" example:"[\"example.lab\"]"`
+	Skipped    []string           `json:"skipped,omitempty" doc:"IDs of the sources not pushed because NSX did not accept the canary source or, with stop_on_error, another source failed" example:"[\"example.lab\"]"`
+
+	MissingBindPasswords []string `json:"missing_bind_passwords,omitempty" doc:"URLs of LDAP servers pushed without a bind password; NSX keeps the one it has unless clear_bind_passwords is set or the sources are restored. Configure them with the server's --bind-passwords" example:"[\"ldaps://ad-02.example.lab:636\"]"`
+}
+
+// PushOutput is the result of a push to NSX
+type PushOutput struct {
+	Body PushResult
+}
+
+func (s *Server) handlePushHistory(ctx context.Context, input *HistoryPushInput) (*PushOutput, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "history not available")
+	}
+	if err := audit.CheckReason(input.Body.Reason); err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error())
+	}
+
+	entry, err := s.repo.GetHistory(ctx, input.ID)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "history entry not found")
+	}
+
+	config, err := s.repo.GetConfig(ctx, input.Body.ConfigID)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "config not found")
+	}
+
+	plan, err := newPushPlan(config.SyncDefaults, input.Body.DryRun, input.Body.Domains, input.Body.Canary)
+	if err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error())
+	}
+	domains, err := plan.domains(entry.Result.Data)
+	if err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error())
+	}
+
+	log := logging.RunLogger(ctx).With("history_id", entry.ID, "config_id", config.ID, "nsx_host", config.Host)
+	if plan.dryRun {
+		log.Info("dry run of history push, NSX left unchanged", "domains_count", len(domains))
+		return plannedPush(config, domains), nil
+	}
+	log.Info("re-pushing history result to NSX", "domains_count", len(domains), "canary", plan.canary)
+
+	return s.push(ctx, log, audit.OperationHistoryPush, config, domains, plan, &input.Body.PushOptions, &entry.ID)
+}
+
+// push pushes domains to the NSX Manager of config as planned, after
+// checking protected sources and taking a snapshot of historyID, and
+// records the outcome in the audit log as operation.
+func (s *Server) push(ctx context.Context, log *slog.Logger, operation string, config *models.NSXConfig, domains []models.Domain, plan *pushPlan, opts *PushOptions, historyID *int64) (*PushOutput, error) {
+	event := newPushEvent(operation, config, domains, opts.Reason)
+	if err := s.checkProtected(ctx, log, event, opts.ForceProtected); err != nil {
+		return nil, err
+	}
+
+	client := s.newNSXClient(config)
+	snapshot, err := s.saveSnapshot(ctx, log, client, event, historyID)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := pushDomains(ctx, log, client, config, domains, s.bindPasswords, nsx.BatchOptions{
+		PushOptions: nsx.PushOptions{
+			RetryConflicts: opts.RetryConflicts,
+			Realization:    s.realization,
+			ClearPasswords: opts.ClearBindPasswords,
+		},
+		Concurrency: opts.Concurrency,
+		Canary:      plan.canary != "",
+		StopOnError: opts.StopOnError,
+	})
+	if output != nil {
+		output.Body.SnapshotID = snapshot.ID
+	}
+	s.recordPush(ctx, log, event, output, err)
+	return output, err
+}
+
+// pushPlan is what a push does, from its request and the sync defaults of
+// its NSX configuration.
+type pushPlan struct {
+	dryRun bool
+	filter *merger.Filter
+	canary string
+}
+
+// newPushPlan returns the plan of a push requesting dryRun, domains and
+// canary; those not requested are taken from defaults.
+func newPushPlan(defaults *models.SyncDefaults, dryRun *bool, domains []string, canary *string) (*pushPlan, error) {
+	if defaults == nil {
+		defaults = &models.SyncDefaults{}
+	}
+	plan := &pushPlan{dryRun: defaults.DryRun, canary: defaults.Canary}
+	if dryRun != nil {
+		plan.dryRun = *dryRun
+	}
+	if canary != nil {
+		plan.canary = *canary
+	}
+	if domains == nil {
+		domains = defaults.Domains
+	}
+
+	var err error
+	if plan.filter, err = merger.NewFilter(domains); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// domains returns the domains of result to push, the canary first.
+func (p *pushPlan) domains(result []models.Domain) ([]models.Domain, error) {
+	domains := p.filter.Select(result)
+	if len(domains) == 0 {
+		return nil, errors.New("no identity sources match the domain filter")
+	}
+	return merger.CanaryFirst(domains, p.canary)
+}
+
+// validateSyncDefaults checks the sync defaults of an NSX configuration.
+func validateSyncDefaults(defaults *models.SyncDefaults) error {
+	if defaults == nil {
+		return nil
+	}
+	if _, err := merger.ParseStrategy(defaults.Strategy); err != nil {
+		return err
+	}
+	filter, err := merger.NewFilter(defaults.Domains)
+	if err != nil {
+		return err
+	}
+	if defaults.Canary != "" && !filter.Match(defaults.Canary) {
+		return fmt.Errorf("canary source %q does not match the domain filter", defaults.Canary)
+	}
+	return nil
+}
+
+// plannedPush returns the output of a dry run pushing domains to config.
+func plannedPush(config *models.NSXConfig, domains []models.Domain) *PushOutput {
+	output := &PushOutput{}
+	output.Body.ConfigID = config.ID
+	output.Body.Host = config.Host
+	output.Body.Results = []PushSourceResult{}
+	output.Body.DryRun = true
+	for _, d := range domains {
+		output.Body.Planned = append(output.Body.Planned, d.ID)
+	}
+	return output
+}
+
+// checkProtected refuses the change of event if it targets protected
+// sources and force is false. The refusal is recorded in the audit log.
+func (s *Server) checkProtected(ctx context.Context, log *slog.Logger, event *models.AuditEvent, force bool) error {
+	var err error
+	event.Protected, err = s.guard.Check(event.SourceIDs, force)
+	if err != nil {
+		event.Outcome = audit.OutcomeRefused
+		event.Error = err.Error()
+		s.recordEvent(ctx, log, event)
+		return apiError(http.StatusConflict, CodeConflict, err.Error()+"; set force_protected to change them")
+	}
+	return nil
+}
+
+// saveSnapshot stores the current state of the sources event targets before
+// they are changed. Without a snapshot the change does not start, and is
+// recorded as failed.
+func (s *Server) saveSnapshot(ctx context.Context, log *slog.Logger, client *nsx.Client, event *models.AuditEvent, historyID *int64) (*models.Snapshot, error) {
+	snapshot := &models.Snapshot{HistoryID: historyID, Operation: event.Operation, NSXHost: event.NSXHost}
+
+	var err error
+	if snapshot.Sources, err = client.SnapshotLDAPIdentitySources(ctx, event.SourceIDs); err != nil {
+		log.Error("failed to snapshot identity sources", "error", err)
+		s.recordPush(ctx, log, event, nil, err)
+		if se := nsxError(err); se != nil {
+			return nil, se
+		}
+		return nil, apiError(http.StatusBadGateway, CodeNSXAPI, "failed to snapshot identity sources", err)
+	}
+	if err := s.repo.AddSnapshot(ctx, snapshot); err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to save snapshot", err)
+	}
+
+	log.Info("saved snapshot", "snapshot_id", snapshot.ID)
+	return snapshot, nil
+}
+
+// newPushEvent returns the audit event of pushing domains to config.
+func newPushEvent(operation string, config *models.NSXConfig, domains []models.Domain, reason string) *models.AuditEvent {
+	event := &models.AuditEvent{
+		Operation: operation,
+		Origin:    audit.OriginAPI,
+		NSXHost:   config.Host,
+		Reason:    reason,
+	}
+	for _, d := range domains {
+		event.SourceIDs = append(event.SourceIDs, d.ID)
+	}
+	return event
+}
+
+// recordPush records the outcome of a push or restore in the audit log.
+func (s *Server) recordPush(ctx context.Context, log *slog.Logger, event *models.AuditEvent, output *PushOutput, pushErr error) {
+	event.Actor = caller(ctx)
+	event.ClientCert = clientCert(ctx)
+	event.SourceIP = sourceIP(ctx)
+	if pushErr != nil {
+		event.Outcome = audit.OutcomeFailed
+		event.Error = pushErr.Error()
+	} else {
+		event.Outcome = audit.Outcome(output.Body.Succeeded, output.Body.Failed)
+		for _, r := range output.Body.Results {
+			if r.Error != "" {
+				event.Error = r.Error
+				break
+			}
+		}
+	}
+	s.recordEvent(ctx, log, event)
+}
+
+// recordEvent stores event in the audit log. The change has already been
+// made or refused, so a failure to record it is logged rather than returned.
+func (s *Server) recordEvent(ctx context.Context, log *slog.Logger, event *models.AuditEvent) {
+	if err := s.audit.Record(context.WithoutCancel(ctx), event); err != nil {
+		log.Error("audit event not recorded", "operation", event.Operation, "error", err)
+		return
+	}
+	log.Info("audit event recorded", "audit_id", event.ID, "outcome", event.Outcome)
+}
+
+// newNSXClient returns a client for the NSX Manager of config.
+func (s *Server) newNSXClient(config *models.NSXConfig) *nsx.Client {
+	return nsx.NewClient(nsx.ClientConfig{
+		Host:        config.Host,
+		Username:    config.Username,
+		Password:    config.Password,
+		Insecure:    config.Insecure,
+		Diagnostics: s.nsxDiagnostics,
+	})
+}
+
+// pushDomains pushes domains to the NSX Manager of config through client with
+// opts, setting missing bind passwords from passwords. Authentication and
+// connection failures abort the push; other NSX errors, revision conflicts
+// and realization failures included, are reported per source in the order
+// of domains. Sources left out by a failed canary or opts.StopOnError are
+// listed as skipped.
+func pushDomains(ctx context.Context, log *slog.Logger, client *nsx.Client, config *models.NSXConfig, domains []models.Domain, passwords *credentials.BindPasswords, opts nsx.BatchOptions) (*PushOutput, error) {
+	output := &PushOutput{}
+	output.Body.ConfigID = config.ID
+	output.Body.Host = config.Host
+	output.Body.Results = []PushSourceResult{}
+
+	sources := nsx.DomainsToLDAPIdentitySources(domains)
+	var missing []string
+	for i := range sources {
+		missing = append(missing, passwords.Inject(&sources[i])...)
+	}
+	output.Body.MissingBindPasswords = missingBindPasswords(log, missing)
+
+	opts.Abort = func(err error) bool { return nsxError(err) != nil }
+	for _, result := range client.PushLDAPIdentitySources(ctx, sources, opts) {
+		if result.Retried {
+			log.Warn("source changed on NSX since pull, pushed again at the current revision", "source_id", result.ID)
+		}
+		switch {
+		case result.Skipped:
+			output.Body.Skipped = append(output.Body.Skipped, result.ID)
+		case result.Err != nil:
+			if se := nsxError(result.Err); se != nil {
+				log.Error("push aborted", "source_id", result.ID, "error", result.Err)
+				return nil, se
+			}
+
+			log.Error("failed to update source", "source_id", result.ID, "error", result.Err, "duration", result.Duration)
+			output.Body.Results = append(output.Body.Results, PushSourceResult{
+				ID:       result.ID,
+				Error:    result.Err.Error(),
+				Conflict: errors.Is(result.Err, nsx.ErrRevisionConflict),
+				Retried:  result.Retried,
+			})
+			output.Body.Failed++
+		default:
+			log.Info("source updated successfully", "source_id", result.ID, "duration", result.Duration)
+			output.Body.Results = append(output.Body.Results, PushSourceResult{ID: result.ID, Success: true, Retried: result.Retried})
+			output.Body.Succeeded++
+		}
+	}
+	if len(output.Body.Skipped) > 0 {
+		log.Warn("push stopped after a failure", "skipped", output.Body.Skipped)
+	}
+
+	log.Info("push completed", "success_count", output.Body.Succeeded, "error_count", output.Body.Failed)
+	return output, nil
+}
+
+// missingBindPasswords returns the URLs of servers left without a bind
+// password, sorted and without duplicates, and logs them.
+func missingBindPasswords(log *slog.Logger, urls []string) []string {
+	if len(urls) == 0 {
+		return nil
+	}
+	urls = slices.Clone(urls)
+	slices.Sort(urls)
+	urls = slices.Compact(urls)
+	log.Warn("pushing LDAP servers without a bind password", "urls", urls)
+	return urls
+}
+
+// nsxError maps NSX failures that affect every source (rejected credentials,
+// unreachable manager) to an API error. It returns nil for errors specific
+// to a single request.
+func nsxError(err error) huma.StatusError {
+	var apiErr *nsx.APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.HTTPStatus == http.StatusUnauthorized || apiErr.HTTPStatus == http.StatusForbidden {
+			return apiError(http.StatusBadGateway, CodeNSXAuth, "NSX Manager rejected the credentials", err)
+		}
+		return nil
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if urlErr.Timeout() {
+			return apiError(http.StatusGatewayTimeout, CodeNSXUnreachable, "NSX Manager did not respond", err)
+		}
+		return apiError(http.StatusBadGateway, CodeNSXUnreachable, "NSX Manager unreachable", err)
+	}
+
+	return nil
+}
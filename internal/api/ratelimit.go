@@ -0,0 +1,234 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+
+	"ldapmerge/internal/metrics"
+)
+
+// RateLimit limits how fast clients may call the API, with a token bucket
+// per client IP and per caller, so that a runaway job cannot exhaust the
+// database writer. Requests to publicPaths are not limited.
+type RateLimit struct {
+	// PerIP is the requests per second allowed from each client IP; 0
+	// disables the limit
+	PerIP float64
+	// PerToken is the requests per second allowed for each API key, OIDC
+	// user or client certificate; 0 disables the limit
+	PerToken float64
+	// Burst is the number of requests allowed at once above the rate; less
+	// than 1 means DefaultRateLimitBurst
+	Burst int
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For is
+	// believed: the IP limit of a request from one of them applies to the
+	// right-most address in that header that is not a trusted proxy. From
+	// any other address, X-Forwarded-For is ignored.
+	TrustedProxies []netip.Prefix
+}
+
+// DefaultRateLimitBurst is the default RateLimit.Burst.
+const DefaultRateLimitBurst = 20
+
+// rateLimitSweepInterval is how often buckets that have refilled are
+// dropped, so that the limiter does not grow with every client ever seen.
+const rateLimitSweepInterval = time.Minute
+
+// rateLimited counts the requests refused by each limit.
+var rateLimited = metrics.NewCounterVec("ldapmerge_api_rate_limited_total",
+	"API requests refused with 429 by a rate limit, by limit (ip, token).", "limit")
+
+// limiter is a set of token buckets with the same rate and burst.
+type limiter struct {
+	name  string // ip or token, the label of rateLimited
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(name string, rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = DefaultRateLimitBurst
+	}
+	return &limiter{
+		name:    name,
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token from the bucket of key. If it is empty, it returns
+// false and how long until a token is available.
+func (l *limiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets that have refilled since their last request.
+func (l *limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// rateLimiter applies a RateLimit to requests.
+type rateLimiter struct {
+	ip      *limiter
+	caller  *limiter
+	proxies []netip.Prefix
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	r := &rateLimiter{proxies: limit.TrustedProxies}
+	if limit.PerIP > 0 {
+		r.ip = newLimiter("ip", limit.PerIP, limit.Burst)
+	}
+	if limit.PerToken > 0 {
+		r.caller = newLimiter("token", limit.PerToken, limit.Burst)
+	}
+	return r
+}
+
+// ipMiddleware limits the requests of each client IP. It runs before the
+// keyring, so that requests with invalid keys are limited too.
+func (r *rateLimiter) ipMiddleware(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		if r.ip == nil || isPublic(req.URL.Path) {
+			return next(w, req)
+		}
+		if ok, wait := r.ip.allow(r.limitedIP(req.Request)); !ok {
+			return tooManyRequests(w, req, r.ip, wait)
+		}
+		return next(w, req)
+	}
+}
+
+// callerMiddleware limits the requests of each caller set by the keyring.
+// Without API keys, OIDC or client certificates, there is no caller and
+// only the IP limit applies.
+func (r *rateLimiter) callerMiddleware(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		name := caller(req.Context())
+		if r.caller == nil || name == "" {
+			return next(w, req)
+		}
+		if ok, wait := r.caller.allow(name); !ok {
+			return tooManyRequests(w, req, r.caller, wait)
+		}
+		return next(w, req)
+	}
+}
+
+// tooManyRequests refuses a request with 429 and a Retry-After of wait,
+// rounded up to a second.
+func tooManyRequests(w http.ResponseWriter, req bunrouter.Request, l *limiter, wait time.Duration) error {
+	rateLimited.Inc(l.name)
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	slog.DebugContext(req.Context(), "request rate limited", "limit", l.name, "method", req.Method, "path", req.URL.Path, "retry_after", retryAfter)
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(http.StatusTooManyRequests)
+	msg := fmt.Sprintf("%s rate limit of %g requests per second exceeded; retry in %ds", l.name, l.rate, retryAfter)
+	return json.NewEncoder(w).Encode(newErrorModel(http.StatusTooManyRequests, CodeRateLimited, msg))
+}
+
+// clientIP returns the IP address of the client of r. Behind a reverse
+// proxy, this is the proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limitedIP returns the IP address the IP limit applies to for req: the
+// client IP or, when it is a trusted proxy, the right-most X-Forwarded-For
+// hop that is not. Hops are read from the right, as only those appended by
+// trusted proxies can be believed; an unparsable hop ends the walk at the
+// last trusted address.
+func (r *rateLimiter) limitedIP(req *http.Request) string {
+	ip := clientIP(req)
+	if len(r.proxies) == 0 || !r.trusted(ip) {
+		return ip
+	}
+
+	var hops []string
+	for _, header := range req.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop.Unmap().String()
+		if !r.trusted(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// trusted reports whether ip is one of the trusted proxies.
+func (r *rateLimiter) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range r.proxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := newLimiter("ip", 2, 3)
+	l.now = func() time.Time { return now }
+
+	for i := range 3 {
+		if ok, _ := l.allow("a"); !ok {
+			t.Fatalf("Request %d within the burst was refused", i+1)
+		}
+	}
+	ok, wait := l.allow("a")
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("Expected a refusal with a 500ms wait, got %v %v", ok, wait)
+	}
+	if ok, _ := l.allow("b"); !ok {
+		t.Error("Expected another key to have its own bucket")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.allow("a"); !ok {
+		t.Error("Expected a token after 500ms at 2 requests per second")
+	}
+	if ok, _ := l.allow("a"); ok {
+		t.Error("Expected the bucket to be empty again")
+	}
+
+	// Refilled buckets are dropped
+	now = now.Add(rateLimitSweepInterval)
+	l.allow("c")
+	if len(l.buckets) != 1 {
+		t.Errorf("Expected only the new bucket after a sweep, got %d", len(l.buckets))
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	opts := DefaultOptions()
+	opts.APIKeys = []APIKey{
+		{Name: "ansible", Key: "ansible-key-0123456789"},
+		{Name: "admin", Key: "admin-key-0123456789"},
+	}
+	opts.RateLimit = RateLimit{PerIP: 0.001, PerToken: 0.001, Burst: 2}
+	s := NewServerWithOptions(":0", nil, opts)
+
+	do := func(path, ip, key string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":40000"
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for range 2 {
+		if rec := do("/api/configs", "192.0.2.1", "ansible-key-0123456789"); rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200 within the burst, got %d", rec.Code)
+		}
+	}
+
+	// The token limit applies from another IP too
+	rec := do("/api/configs", "192.0.2.2", "ansible-key-0123456789")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 over the token limit, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After on 429")
+	}
+	var body ErrorModel
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != CodeRateLimited {
+		t.Errorf("Expected %s, got %s (%v)", CodeRateLimited, rec.Body.String(), err)
+	}
+
+	// The first IP is over its own limit, with any key, even an invalid one
+	for _, key := range []string{"admin-key-0123456789", "wrong-key-0123456789"} {
+		if rec := do("/api/configs", "192.0.2.1", key); rec.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected 429 over the IP limit with key %q, got %d", key, rec.Code)
+		}
+	}
+	if rec := do("/api/health", "192.0.2.1", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected /api/health not to be limited, got %d", rec.Code)
+	}
+	if rec := do("/api/configs", "192.0.2.3", "admin-key-0123456789"); rec.Code != http.StatusOK {
+		t.Errorf("Expected another key from another IP to be served, got %d", rec.Code)
+	}
+}
+
+func TestLimitedIP(t *testing.T) {
+	r := newRateLimiter(RateLimit{TrustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/24"),
+		netip.MustParsePrefix("2001:db8::/64"),
+	}})
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    []string
+		want   string
+	}{
+		{"no proxy", "192.0.2.1:40000", nil, "192.0.2.1"},
+		{"untrusted sender", "192.0.2.1:40000", []string{"198.51.100.7"}, "192.0.2.1"},
+		{"trusted proxy", "10.0.0.1:40000", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"spoofed left hops", "10.0.0.1:40000", []string{"203.0.113.9, 198.51.100.7"}, "198.51.100.7"},
+		{"proxy chain", "10.0.0.1:40000", []string{"198.51.100.7, 10.0.0.2", "10.0.0.3"}, "198.51.100.7"},
+		{"trusted IPv6 proxy", "[2001:db8::1]:40000", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"mapped hop", "10.0.0.1:40000", []string{"::ffff:198.51.100.7"}, "198.51.100.7"},
+		{"invalid hop", "10.0.0.1:40000", []string{"198.51.100.7, garbage, 10.0.0.2"}, "10.0.0.2"},
+		{"no header", "10.0.0.1:40000", nil, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/configs", nil)
+			req.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := r.limitedIP(req); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRateLimitTrustedProxy(t *testing.T) {
+	opts := DefaultOptions()
+	opts.RateLimit = RateLimit{
+		PerIP:          0.001,
+		Burst:          1,
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")},
+	}
+	s := NewServerWithOptions(":0", nil, opts)
+
+	do := func(remote, xff string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/configs", nil)
+		req.RemoteAddr = remote + ":40000"
+		req.Header.Set("X-Forwarded-For", xff)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Clients behind the proxy have their own buckets
+	if code := do("10.0.0.1", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("Expected 200 for the first client, got %d", code)
+	}
+	if code := do("10.0.0.1", "198.51.100.2"); code != http.StatusOK {
+		t.Fatalf("Expected 200 for the second client, got %d", code)
+	}
+	if code := do("10.0.0.1", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 for the first client again, got %d", code)
+	}
+
+	// An untrusted sender cannot pick its bucket
+	if code := do("192.0.2.1", "198.51.100.3"); code != http.StatusOK {
+		t.Fatalf("Expected 200 for the direct client, got %d", code)
+	}
+	if code := do("192.0.2.1", "198.51.100.4"); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 despite a new X-Forwarded-For, got %d", code)
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+)
+
+// Repository is the storage the server reads and writes. It is implemented
+// by *repository.Repository over SQLite and by *repository.Memory for tests.
+// Lookups of missing rows return sql.ErrNoRows.
+type Repository interface {
+	audit.Store
+	ListAuditEvents(ctx context.Context, filter repository.AuditFilter) ([]models.AuditEvent, error)
+
+	Ping(ctx context.Context) error
+	Health() repository.Health
+	GetDBInfo(ctx context.Context) (*repository.DBInfo, error)
+
+	SaveHistoryWithStats(ctx context.Context, initial []models.Domain, response models.CertificateResponse, result []models.Domain, stats *models.MergeStats) (*models.HistoryEntry, error)
+	GetHistory(ctx context.Context, id int64) (*models.HistoryEntry, error)
+	ListHistory(ctx context.Context, filter repository.HistoryFilter) ([]models.HistoryEntry, error)
+	ListHistorySummaries(ctx context.Context, filter repository.HistoryFilter) ([]models.HistorySummary, error)
+	CountHistory(ctx context.Context, filter repository.HistoryFilter) (int64, error)
+	DeleteHistory(ctx context.Context, id int64) error
+	PurgeHistory(ctx context.Context, before time.Time) (int64, error)
+
+	SaveConfig(ctx context.Context, config *models.NSXConfig) (*models.NSXConfig, error)
+	GetConfig(ctx context.Context, id int64) (*models.NSXConfig, error)
+	ListConfigs(ctx context.Context) ([]models.NSXConfig, error)
+	DeleteConfig(ctx context.Context, id int64) error
+	PurgeConfig(ctx context.Context, id int64) error
+
+	SaveDocument(ctx context.Context, doc *models.Document) (*models.Document, error)
+	GetDocument(ctx context.Context, id int64) (*models.Document, error)
+	ListDocuments(ctx context.Context) ([]models.Document, error)
+	DeleteDocument(ctx context.Context, id int64) error
+	GetInitialDocument(ctx context.Context, id int64) ([]models.Domain, error)
+	GetResponseDocument(ctx context.Context, id int64) (*models.CertificateResponse, error)
+
+	AddSnapshot(ctx context.Context, snapshot *models.Snapshot) error
+	GetSnapshot(ctx context.Context, id int64) (*models.Snapshot, error)
+	ListSnapshots(ctx context.Context, limit int) ([]models.Snapshot, error)
+
+	UpdateInventory(ctx context.Context, nsxHost string, domains []models.Domain) (int, error)
+	ListServers(ctx context.Context) ([]models.InventoryServer, error)
+	GetServer(ctx context.Context, id int64) (*models.InventoryServer, error)
+	ListProbes(ctx context.Context, serverID int64, limit int) ([]models.ProbeRecord, error)
+
+	ListHealthSnapshots(ctx context.Context, since time.Time, limit int) ([]models.HealthSnapshot, error)
+
+	ListSettings(ctx context.Context) ([]models.Setting, error)
+	SaveSettings(ctx context.Context, settings []models.Setting) error
+}
+
+var (
+	_ Repository = (*repository.Repository)(nil)
+	_ Repository = (*repository.Memory)(nil)
+)
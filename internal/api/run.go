@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/uptrace/bunrouter"
+
+	"ldapmerge/internal/runid"
+)
+
+// RunIDHeader carries the run ID of a request (see runid). A valid run ID
+// sent by the client is used, so that the caller can correlate the request
+// with its own logs; otherwise one is generated. It is returned in the
+// response either way.
+const RunIDHeader = "X-Run-ID"
+
+// runMiddleware gives every request but those to publicPaths a run ID.
+func runMiddleware(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		if isPublic(req.URL.Path) {
+			return next(w, req)
+		}
+		id := req.Header.Get(RunIDHeader)
+		if !runid.Valid(id) {
+			id = runid.New()
+		}
+		w.Header().Set(RunIDHeader, id)
+		return next(w, req.WithContext(runid.With(req.Context(), id)))
+	}
+}
@@ -1,8 +1,16 @@
 package api
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
@@ -10,9 +18,19 @@ import (
 	"github.com/uptrace/bunrouter"
 	"github.com/uptrace/bunrouter/extra/reqlog"
 
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/credentials"
+	"ldapmerge/internal/diff"
+	"ldapmerge/internal/features"
+	"ldapmerge/internal/logging"
 	"ldapmerge/internal/merger"
+	"ldapmerge/internal/metrics"
 	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/prober"
 	"ldapmerge/internal/repository"
+	"ldapmerge/internal/signing"
+	"ldapmerge/internal/snippet"
 	"ldapmerge/internal/version"
 )
 
@@ -21,14 +39,57 @@ type Server struct {
 	addr   string
 	router *bunrouter.Router
 	merger *merger.Merger
-	repo   *repository.Repository
+	repo   Repository
+	signer signing.Signer
+
+	probeFailureThreshold int
+	prober                *prober.Prober
+	logLevel              *slog.LevelVar
+	docsRenderer          DocsRenderer
+	inputSchemes          map[string]bool
+	metrics               *metrics.Registry
+	audit                 *audit.Recorder
+	guard                 *audit.Guard
+	realization           nsx.RealizationWait
+	bindPasswords         *credentials.BindPasswords
+	features              features.Set
+	jobs                  *syncJobs
+	nsxDiagnostics        nsx.Diagnostics
+	api                   huma.API
+	openapi               *huma.OpenAPI
+
+	tlsCert      string
+	tlsKey       string
+	tlsClientCA  string
+	redirectAddr string
+
+	shutdownTimeout time.Duration
+	mu              sync.Mutex
+	httpServers     []*http.Server // of the running Start
+}
+
+// MergeOptionsInput overrides the server's default merge options for one request
+type MergeOptionsInput struct {
+	Strategy    *string           `json:"strategy,omitempty" enum:"replace,append,keep" doc:"Certificate merge strategy"`
+	Normalize   *bool             `json:"normalize,omitempty" doc:"Match URLs case-insensitively and with default ports"`
+	AltNames    *bool             `json:"alt_names,omitempty" doc:"Also match response URLs with a host in an alternative domain name of the domain to the servers of the domain"`
+	HostAliases map[string]string `json:"host_aliases,omitempty" doc:"Hosts used in response URLs mapped to the hosts of LDAP servers, replacing the server's aliases"`
+	Strict      *bool             `json:"strict,omitempty" doc:"Fail when response URLs match no LDAP server"`
+	Dedup       *bool             `json:"dedup,omitempty" doc:"Remove duplicate certificates per server"`
+	Weak        *string           `json:"weak_certificates,omitempty" enum:"ignore,warn,fail" doc:"Policy for response certificates with SHA-1 signatures, RSA keys under 2048 bits or expired CAs; fail rejects the merge, warn logs them"`
 }
 
 // MergeInput is the request body for merge operation
 type MergeInput struct {
 	Body struct {
-		Initial  []models.Domain            `json:"initial" doc:"Initial domain configurations"`
-		Response models.CertificateResponse `json:"response" doc:"Certificate response data"`
+		Initial            []models.Domain             `json:"initial,omitempty" required:"false" doc:"Initial domain configurations; required unless initial_document_id or initial_location is set"`
+		InitialDocumentID  *int64                      `json:"initial_document_id,omitempty" doc:"ID of an uploaded initial document to use instead of initial" example:"1"`
+		InitialLocation    *string                     `json:"initial_location,omitempty" doc:"URL of the initial document to load instead of initial; the scheme must be enabled with --input-schemes" example:"s3://ldap-artifacts/prod/initial.json"`
+		Response           *models.CertificateResponse `json:"response,omitempty" required:"false" doc:"Certificate response data; required unless response_document_id or response_location is set"`
+		ResponseDocumentID *int64                      `json:"response_document_id,omitempty" doc:"ID of an uploaded response document to use instead of response" example:"2"`
+		ResponseLocation   *string                     `json:"response_location,omitempty" doc:"URL of the response document to load instead of response; the scheme must be enabled with --input-schemes" example:"https://pki.example.com/ldap/response.json"`
+		Options            *MergeOptionsInput          `json:"options,omitempty" doc:"Per-request overrides of the server's default merge options"`
+		SaveHistory        *bool                       `json:"save_history,omitempty" doc:"Record the merge in history (default true); set false for exploratory merges"`
 	}
 }
 
@@ -39,14 +100,32 @@ type MergeOutput struct {
 
 // DatabaseInfo contains database information for health check
 type DatabaseInfo struct {
-	Path         string `json:"path" doc:"Database file path" example:"/home/user/.ldapmerge/data.db"`
-	Size         int64  `json:"size" doc:"Database size in bytes" example:"45056"`
-	SizeHuman    string `json:"size_human" doc:"Human-readable database size" example:"44.0 KB"`
-	Version      string `json:"version" doc:"SQLite version" example:"3.46.0"`
-	Tables       int    `json:"tables" doc:"Number of application tables" example:"2"`
-	WALMode      bool   `json:"wal_mode" doc:"Write-Ahead Logging enabled" example:"true"`
-	HistoryCount int64  `json:"history_count" doc:"Number of history entries" example:"10"`
-	ConfigCount  int64  `json:"config_count" doc:"Number of saved NSX configs" example:"2"`
+	Path          string `json:"path" doc:"Database file path" example:"/home/user/.config/ldapmerge/data.db"`
+	Size          int64  `json:"size" doc:"Database size in bytes" example:"45056"`
+	SizeHuman     string `json:"size_human" doc:"Human-readable database size" example:"44.0 KB"`
+	Version       string `json:"version" doc:"SQLite version" example:"3.46.0"`
+	Tables        int    `json:"tables" doc:"Number of application tables" example:"2"`
+	WALMode       bool   `json:"wal_mode" doc:"Write-Ahead Logging enabled" example:"true"`
+	HistoryCount  int64  `json:"history_count" doc:"Number of history entries" example:"10"`
+	ConfigCount   int64  `json:"config_count" doc:"Number of saved NSX configs" example:"2"`
+	DocumentCount int64  `json:"document_count" doc:"Number of uploaded documents" example:"4"`
+}
+
+// DatabaseHealth is the state of the database connection
+type DatabaseHealth struct {
+	OK         bool       `json:"ok" doc:"Whether the last check succeeded"`
+	Error      string     `json:"error,omitempty" doc:"Error of the last check"`
+	CheckedAt  time.Time  `json:"checked_at" doc:"Time of the last check" format:"date-time"`
+	Reopens    int        `json:"reopens" doc:"Times the database was reopened after an error" example:"0"`
+	ReopenedAt *time.Time `json:"reopened_at,omitempty" doc:"Time of the last reopen" format:"date-time"`
+}
+
+// ReadyOutput is the response for readiness check
+type ReadyOutput struct {
+	Body struct {
+		Status   string          `json:"status" example:"ready" doc:"Readiness status"`
+		Database *DatabaseHealth `json:"database,omitempty" doc:"Database connection state; absent without a database"`
+	}
 }
 
 // HealthOutput is the response for health check
@@ -58,9 +137,31 @@ type HealthOutput struct {
 	}
 }
 
+// HistoryListInput is the request for history list
+type HistoryListInput struct {
+	Full   bool      `query:"full" doc:"Include the initial, response and result data of every entry"`
+	From   time.Time `query:"from" doc:"Only entries created at or after this time (RFC 3339)"`
+	To     time.Time `query:"to" doc:"Only entries created at or before this time (RFC 3339)"`
+	Domain string    `query:"domain" doc:"Only entries whose merged result has a domain of this ID, ignoring case" example:"example.lab"`
+	Sort   string    `query:"sort" enum:"created_at,size,domains,servers,certificates" default:"created_at" doc:"Field to sort entries by"`
+	Order  string    `query:"order" enum:"asc,desc" default:"desc" doc:"Sort order"`
+	Limit  int       `query:"limit" minimum:"1" maximum:"1000" default:"100" doc:"Maximum number of entries to return"`
+	Offset int       `query:"offset" minimum:"0" doc:"Number of entries to skip, for paging"`
+}
+
+// HistoryListEntry is a listed history entry: its summary and, with
+// full=true, its data.
+type HistoryListEntry struct {
+	models.HistorySummary
+	Initial  *models.JSON[[]models.Domain]            `json:"initial,omitempty" doc:"Original domain configurations before merge (full=true)"`
+	Response *models.JSON[models.CertificateResponse] `json:"response,omitempty" doc:"Certificate response data used for merge (full=true)"`
+	Result   *models.JSON[[]models.Domain]            `json:"result,omitempty" doc:"Final merged domain configurations with certificates (full=true)"`
+}
+
 // HistoryListOutput is the response for history list
 type HistoryListOutput struct {
-	Body []models.HistoryEntry
+	Total int64 `header:"X-Total-Count" doc:"Number of entries matching the filters, across all pages"`
+	Body  []HistoryListEntry
 }
 
 // HistoryInput is the path parameter for history entry
@@ -73,6 +174,49 @@ type HistoryOutput struct {
 	Body models.HistoryEntry
 }
 
+// HistoryResultInput is the request for a history entry's merged result
+type HistoryResultInput struct {
+	ID       int64 `path:"id" doc:"History entry ID"`
+	Download bool  `query:"download" doc:"Return a pretty-printed file attachment"`
+	Split    bool  `query:"split" doc:"Return a zip attachment with one pretty-printed file per domain, as merge --split-output writes"`
+}
+
+// HistoryResultOutput is the merged result of a history entry
+type HistoryResultOutput struct {
+	ContentType        string `header:"Content-Type"`
+	ContentDisposition string `header:"Content-Disposition" doc:"Attachment file name, set when download=true"`
+	Body               []byte
+}
+
+// HistoryDiffInput selects two history entries to compare
+type HistoryDiffInput struct {
+	A int64 `query:"a" required:"true" doc:"ID of the older history entry"`
+	B int64 `query:"b" required:"true" doc:"ID of the newer history entry"`
+}
+
+// HistoryDiffOutput is the difference between two merge results
+type HistoryDiffOutput struct {
+	Body struct {
+		A         int64            `json:"a" doc:"ID of the older history entry"`
+		B         int64            `json:"b" doc:"ID of the newer history entry"`
+		Identical bool             `json:"identical" doc:"True if both results are the same"`
+		Diff      *diff.ResultDiff `json:"diff" doc:"Structured diff"`
+		Text      string           `json:"text" doc:"Human-readable diff"`
+	}
+}
+
+// HistoryPurgeInput is the request for removing old history entries
+type HistoryPurgeInput struct {
+	Before time.Time `query:"before" required:"true" doc:"Remove the entries created before this time (RFC 3339)"`
+}
+
+// HistoryPurgeOutput is the response for removing old history entries
+type HistoryPurgeOutput struct {
+	Body struct {
+		Deleted int64 `json:"deleted" doc:"Number of history entries removed" example:"42"`
+	}
+}
+
 // ConfigListOutput is the response for NSX configs list
 type ConfigListOutput struct {
 	Body []models.NSXConfig
@@ -93,18 +237,144 @@ type ConfigOutput struct {
 	Body models.NSXConfig
 }
 
-// NewServer creates a new API server
-func NewServer(addr string, repo *repository.Repository) *Server {
-	router := bunrouter.New(
-		bunrouter.Use(reqlog.NewMiddleware()),
-	)
+// ConfigSnippetOutput is the ldapmerge command line of an NSX config
+type ConfigSnippetOutput struct {
+	ContentType string `header:"Content-Type"`
+	Body        []byte
+}
+
+// Options configures the API server.
+type Options struct {
+	// Merge holds the default merge options, overridable per request
+	Merge merger.Options
+	// Signer signs downloadable history results; nil disables signatures
+	Signer signing.Signer
+	// ProbeFailureThreshold is the number of consecutive failed probes after
+	// which an inventory server is flagged as failing
+	ProbeFailureThreshold int
+	// Prober is the scheduled prober shown on /status; nil when disabled
+	Prober *prober.Prober
+	// LogLevel is the level of the server's log, changed through
+	// /api/admin/settings; nil reports info and changes no logger
+	LogLevel *slog.LevelVar
+	// DocsRenderer selects the /docs renderer; empty means auto
+	DocsRenderer DocsRenderer
+	// InputSchemes are the loader schemes merge requests may name in
+	// initial_location and response_location; empty disables locations, as
+	// they let clients make the server read files and fetch URLs
+	InputSchemes []string
+	// AuditWebhook receives the audit events of NSX changes; nil for none
+	AuditWebhook *audit.Webhook
+	// Protected refuses unforced changes to the identity sources it
+	// protects; nil protects none
+	Protected *audit.Guard
+	// RealizationTimeout is how long pushes wait for NSX to realize each
+	// source; 0 does not wait
+	RealizationTimeout time.Duration
+	// BindPasswords are set on the LDAP servers of pushed and restored
+	// sources that have no bind password; nil sets none
+	BindPasswords *credentials.BindPasswords
+	// Features gates optional subsystems; nil enables all. The API server
+	// serves /status and /docs only with features.WebUI.
+	Features features.Set
+	// APIKeys, if any, are required on every request except health checks,
+	// metrics and the API documentation; keys bound to a tenant scope NSX
+	// configurations and history to it
+	APIKeys []APIKey
+	// OIDC, if set, also accepts the JWT bearer tokens of an OpenID
+	// Connect issuer; nil accepts none
+	OIDC *OIDC
+	// NSXDiagnostics configures the request ids and slow-call logging of
+	// the NSX clients
+	NSXDiagnostics nsx.Diagnostics
+	// TLSCert and TLSKey are the PEM certificate (with its chain) and key
+	// files the server serves HTTPS with; empty serves plain HTTP
+	TLSCert string
+	TLSKey  string
+	// TLSClientCA, with TLS, is a PEM CA bundle: only clients presenting a
+	// certificate it signed are accepted, and they need no API key or token
+	TLSClientCA string
+	// HTTPRedirectAddr, with TLS, is an address where plain HTTP requests
+	// are redirected to HTTPS; empty listens for HTTPS only
+	HTTPRedirectAddr string
+	// RateLimit limits the requests of each client IP and caller; the zero
+	// value disables it
+	RateLimit RateLimit
+	// ShutdownTimeout is how long Start waits for the requests in flight
+	// once its context is done; 0 means DefaultShutdownTimeout
+	ShutdownTimeout time.Duration
+}
 
+// DefaultShutdownTimeout is how long a stopping server waits for the
+// requests in flight by default.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// DefaultOptions returns the default server options.
+func DefaultOptions() Options {
+	return Options{
+		Merge:                 merger.DefaultOptions(),
+		ProbeFailureThreshold: 3,
+		RealizationTimeout:    nsx.DefaultRealizationTimeout,
+		ShutdownTimeout:       DefaultShutdownTimeout,
+	}
+}
+
+// NewServer creates a new API server with default options. Without a
+// repository, the endpoints that need the database fail with LM-3002.
+func NewServer(addr string, repo Repository) *Server {
+	return NewServerWithOptions(addr, repo, DefaultOptions())
+}
+
+// NewServerWithOptions creates a new API server with the given options
+func NewServerWithOptions(addr string, repo Repository, opts Options) *Server {
 	s := &Server{
 		addr:   addr,
-		router: router,
-		merger: merger.New(),
+		merger: merger.NewWithOptions(opts.Merge),
 		repo:   repo,
+		signer: opts.Signer,
+
+		probeFailureThreshold: opts.ProbeFailureThreshold,
+		prober:                opts.Prober,
+		logLevel:              opts.LogLevel,
+		docsRenderer:          opts.DocsRenderer.resolve(),
+		inputSchemes:          make(map[string]bool, len(opts.InputSchemes)),
+		metrics:               metrics.NewRegistry(),
+		jobs:                  newSyncJobs(),
+	}
+	for _, scheme := range opts.InputSchemes {
+		s.inputSchemes[strings.ToLower(scheme)] = true
+	}
+	if repo != nil {
+		s.audit = audit.NewRecorder(repo, opts.AuditWebhook)
+	}
+	s.guard = opts.Protected
+	s.realization = nsx.RealizationWait{Timeout: opts.RealizationTimeout}
+	s.bindPasswords = opts.BindPasswords
+	s.features = opts.Features
+	s.nsxDiagnostics = opts.NSXDiagnostics
+	s.tlsCert = opts.TLSCert
+	s.tlsKey = opts.TLSKey
+	s.tlsClientCA = opts.TLSClientCA
+	s.redirectAddr = opts.HTTPRedirectAddr
+	s.shutdownTimeout = opts.ShutdownTimeout
+	if s.logLevel == nil {
+		s.logLevel = new(slog.LevelVar)
 	}
+	if s.shutdownTimeout <= 0 {
+		s.shutdownTimeout = DefaultShutdownTimeout
+	}
+	limits := newRateLimiter(opts.RateLimit)
+	s.router = bunrouter.New(
+		bunrouter.Use(reqlog.NewMiddleware()),
+		bunrouter.Use(runMiddleware),
+		bunrouter.Use(clientCertMiddleware),
+		bunrouter.Use(limits.ipMiddleware),
+		bunrouter.Use(newKeyring(opts.APIKeys, opts.OIDC).middleware),
+		bunrouter.Use(limits.callerMiddleware),
+		bunrouter.Use(s.auditMiddleware),
+	)
+	s.metrics.Register(metrics.Default)
+	s.metrics.Register(metrics.CollectorFunc(s.collectInventoryMetrics))
 
 	s.setupRoutes()
 	return s
@@ -127,6 +397,7 @@ REST API for merging LDAP server configurations with SSL certificates and synchr
 This API provides endpoints for:
 - **Merging** LDAP configurations with certificate data from Ansible
 - **Storing** merge operation history in SQLite
+- **Uploading** initial and response documents for reuse by ID
 - **Managing** NSX connection configurations
 
 ## Workflow
@@ -138,8 +409,66 @@ This API provides endpoints for:
 
 ## Authentication
 
-> **Note:** This API does not implement authentication.
-> Use a reverse proxy (nginx, traefik) for production deployments.
+When the server is configured with API keys (` + "`server.api_keys`" + `), every
+request except ` + "`/api/health`" + `, ` + "`/readyz`" + `, ` + "`/metrics`" + ` and the documentation
+must carry one in ` + "`X-API-Key`" + ` or ` + "`Authorization: Bearer`" + `; otherwise it is
+refused with 401 (` + "`LM-1004`" + `). A key bound to a tenant sees and creates only
+that tenant's NSX configurations, history, documents and snapshots, sees
+the inventory servers of its configurations' NSX Managers only, and is
+refused the audit log and server settings with 403 (` + "`LM-1006`" + `).
+
+With an OpenID Connect issuer (` + "`server.oidc`" + `, e.g. a Keycloak realm), a JWT
+in ` + "`Authorization: Bearer`" + ` is accepted too: its signature is checked against
+the issuer's published keys, and its issuer, audience and expiry against
+the configuration. With ` + "`server.oidc.tenant_claim`" + `, the token is scoped to
+the tenant in that claim and refused without it.
+
+With mutual TLS (` + "`--tls-client-ca`" + `), only clients presenting a certificate
+signed by the configured CA bundle can connect. Such requests need no API
+key; the certificate subject is logged as ` + "`client_cert`" + ` and recorded in the
+audit log. A certificate listed in the ` + "`cert_subjects`" + ` of an API key, by full
+subject or SHA-256 fingerprint, acts as that key, tenant included. Any other
+certificate sees only the
+configurations without a tenant, is refused the audit log and settings with 403
+and cannot set ` + "`X-Debug`" + `.
+
+A request with ` + "`X-Debug: true`" + ` made with a key or token without a
+tenant, or to a server without either, is logged at debug level whatever the server's log
+level, NSX API calls included; its log records carry the id returned in
+` + "`X-Debug-Request`" + ` as ` + "`debug_request`" + `.
+
+Without API keys or OIDC the API is open: use a reverse proxy (nginx,
+traefik) for production deployments.
+
+## Rate limits
+
+The server may limit the requests per second of each client IP and of each
+API key, token user or client certificate (` + "`--rate-limit-ip`" + `,
+` + "`--rate-limit-token`" + `). A request over a limit is refused with 429
+(` + "`LM-1005`" + `) and a ` + "`Retry-After`" + ` header giving the seconds to wait.
+The health, metrics and documentation endpoints are not limited. Behind a
+reverse proxy listed in ` + "`--rate-limit-trusted-proxies`" + ` the client IP is
+the right-most untrusted ` + "`X-Forwarded-For`" + ` hop.
+
+## Errors
+
+Errors are returned as ` + "`application/problem+json`" + ` (RFC 9457) with a stable
+` + "`code`" + ` field. Branch on the code, not on the English ` + "`detail`" + ` message.
+
+| Code | Meaning |
+|------|---------|
+| LM-1001 | Request validation failed |
+| LM-1002 | Resource not found |
+| LM-1003 | Request conflicts with existing state |
+| LM-1004 | Missing or invalid API key |
+| LM-1005 | Rate limit exceeded; retry after Retry-After seconds |
+| LM-1006 | API key or token not allowed to make the request |
+| LM-2001 | NSX Manager rejected the credentials |
+| LM-2002 | NSX Manager unreachable |
+| LM-2003 | NSX Manager returned an error |
+| LM-3001 | Database query failed |
+| LM-3002 | Database not available |
+| LM-9001 | Unexpected internal error |
 
 ## Related Resources
 
@@ -177,30 +506,71 @@ This API provides endpoints for:
 			Name:        "merge",
 			Description: "Operations for merging LDAP configurations with SSL certificates",
 		},
+		{
+			Name:        "documents",
+			Description: "Uploaded initial and response documents, reusable by ID in merge requests",
+		},
 		{
 			Name:        "history",
 			Description: "Merge operation history stored in SQLite database",
 		},
+		{
+			Name:        "snapshots",
+			Description: "State of NSX identity sources captured before each push, for rollback",
+		},
+		{
+			Name:        "audit",
+			Description: "Audit log of changes to NSX and of mutating API requests",
+		},
 		{
 			Name:        "config",
 			Description: "NSX Manager connection configuration management",
 		},
+		{
+			Name:        "nsx",
+			Description: "Identity sources of NSX Managers, through saved configurations",
+		},
+		{
+			Name:        "sync",
+			Description: "Pull, merge and push of a saved configuration, run in the background",
+		},
+		{
+			Name:        "inventory",
+			Description: "LDAP server inventory built from NSX pulls and probes",
+		},
+		{
+			Name:        "admin",
+			Description: "Runtime settings of the server, for API keys and tokens without a tenant",
+		},
 		{
 			Name:        "system",
 			Description: "System endpoints for health checks and monitoring",
 		},
 	}
 
-	// Disable default docs, we'll add Scalar manually
+	// Stream list responses instead of buffering them whole
+	config.Formats = map[string]huma.Format{
+		"application/json": streamingJSONFormat,
+		"json":             streamingJSONFormat,
+	}
+
+	// Disable default docs, /docs is served by setupDocs
 	config.DocsPath = ""
 
 	api := humabunrouter.New(s.router, config)
 
-	// Scalar API Documentation
-	s.router.GET("/docs", func(w http.ResponseWriter, r bunrouter.Request) error {
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		_, err := w.Write([]byte(scalarHTML))
-		return err
+	if s.features.Enabled(features.WebUI) {
+		// API documentation
+		s.setupDocs()
+
+		// Operator status page
+		s.router.GET("/status", s.handleStatus)
+	}
+
+	// Prometheus metrics
+	s.router.GET("/metrics", func(w http.ResponseWriter, r bunrouter.Request) error {
+		s.metrics.Handler().ServeHTTP(w, r.Request)
+		return nil
 	})
 
 	// Merge endpoints
@@ -217,17 +587,92 @@ The request body must contain two fields:
 - **initial**: Array of domain configurations (from NSX or JSON file)
 - **response**: Certificate response data (from Ansible)
 
+Either field can be replaced by a reference to an uploaded document
+(` + "`initial_document_id`" + `, ` + "`response_document_id`" + `, see ` + "`POST /api/documents`" + `),
+so large payloads do not have to be resent with every request.
+
 ## Merge Logic
 
 Certificates are matched to LDAP servers by exact URL match.
 Each certificate from the response is added to the corresponding server's ` + "`certificates`" + ` array.
 
+## Options
+
+The optional **options** field overrides the server's default merge options
+(the ` + "`merge:`" + ` section of the server config) for this request:
+- **strategy**: ` + "`replace`" + ` (default), ` + "`append`" + ` or ` + "`keep`" + ` existing certificates
+- **normalize**: match URLs case-insensitively and with default ports
+- **strict**: reject the request when response URLs match no LDAP server
+- **dedup**: remove duplicate certificates per server
+
 ## Side Effects
 
-The merge result is automatically saved to the history database for auditing purposes.`,
-		Tags: []string{"merge"},
+The merge result is automatically saved to the history database for auditing purposes.
+Set ` + "`save_history`" + ` to ` + "`false`" + ` for exploratory merges that should not appear in
+history; the skip is recorded in the server log.`,
+		Tags:   []string{"merge"},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound},
 	}, s.handleMerge)
 
+	huma.Register(api, mergeStreamOperation(api.OpenAPI().Components.Schemas), s.handleMergeStream)
+
+	// Document endpoints
+	huma.Register(api, huma.Operation{
+		OperationID:   "listDocuments",
+		Method:        http.MethodGet,
+		Path:          "/api/documents",
+		Summary:       "List documents",
+		Description:   `Returns all uploaded documents, newest first, without their content.`,
+		Tags:          []string{"documents"},
+		DefaultStatus: http.StatusOK,
+	}, s.handleListDocuments)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "createDocument",
+		Method:      http.MethodPost,
+		Path:        "/api/documents",
+		Summary:     "Upload document",
+		Description: `Stores an initial or response JSON document for reuse.
+
+## Required Fields
+
+- **name**: Document name
+- **kind**: ` + "`initial`" + ` (array of domains) or ` + "`response`" + ` (certificate response)
+- **content**: The document itself
+
+The content must match the kind. Size and SHA-256 are computed by the server.
+
+Reference the returned ` + "`id`" + ` from ` + "`POST /api/merge`" + ` as ` + "`initial_document_id`" + ` or
+` + "`response_document_id`" + `, or from ` + "`ldapmerge sync --response-document`" + `.`,
+		Tags:          []string{"documents"},
+		DefaultStatus: http.StatusCreated,
+		Errors:        []int{http.StatusBadRequest},
+	}, s.handleCreateDocument)
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "getDocument",
+		Method:        http.MethodGet,
+		Path:          "/api/documents/{id}",
+		Summary:       "Get document",
+		Description:   `Returns a document by ID, including its content.`,
+		Tags:          []string{"documents"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusNotFound},
+	}, s.handleGetDocument)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "deleteDocument",
+		Method:      http.MethodDelete,
+		Path:        "/api/documents/{id}",
+		Summary:     "Delete document",
+		Description: `Permanently deletes a document by ID.
+
+History entries created from the document keep their own copy of the data.`,
+		Tags:          []string{"documents"},
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusNotFound},
+	}, s.handleDeleteDocument)
+
 	// Health endpoint
 	huma.Register(api, huma.Operation{
 		OperationID: "health",
@@ -247,24 +692,71 @@ The merge result is automatically saved to the history database for auditing pur
 
 ## Use cases:
 
-- Kubernetes liveness/readiness probes
+- Kubernetes liveness probes (readiness: /readyz)
 - Load balancer health checks
 - Monitoring and alerting systems
 - Database diagnostics`,
 		Tags: []string{"system"},
 	}, s.handleHealth)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "readiness",
+		Method:      http.MethodGet,
+		Path:        "/readyz",
+		Summary:     "Readiness check",
+		Description: `Checks that the database can be read and returns 503 when it cannot.
+
+A failed check with a locked, closed or moved database file reopens the
+database before reporting, so a transient filesystem issue recovers without a
+restart. The database is also checked on a timer (--db-ping-interval).
+
+Use for Kubernetes readiness probes; /api/health stays available for liveness.`,
+		Tags:   []string{"system"},
+		Errors: []int{http.StatusServiceUnavailable},
+	}, s.handleReady)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "healthHistory",
+		Method:      http.MethodGet,
+		Path:        "/api/health/history",
+		Summary:     "Get health history",
+		Description: `Returns the health snapshots the server records every
+` + "`--health-interval`" + `, newest first, with trends over them:
+
+- **database**: size growth between the oldest and the newest snapshot, and
+  the snapshots in which the database could not be read
+- **nsx**: per saved NSX configuration, the checks that found its NSX Manager
+  unreachable and the changes between reachable and unreachable; managers
+  with at least ` + "`flap_threshold`" + ` changes are flagged as ` + "`flapping`" + `
+
+Unlike /api/health, the history requires an API key. Keys bound to a tenant
+see the NSX Managers of that tenant's configurations only.`,
+		Tags:          []string{"system"},
+		DefaultStatus: http.StatusOK,
+	}, s.handleHealthHistory)
+
 	// History endpoints
 	huma.Register(api, huma.Operation{
 		OperationID: "listHistory",
 		Method:      http.MethodGet,
 		Path:        "/api/history",
 		Summary:     "List merge history",
-		Description: `Returns all merge operation history entries.
+		Description: `Returns merge operation history entries, the latest 100 by default.
 
-Each entry contains:
+Entries can be filtered by creation time (` + "`from`, `to`" + `) and by the ID of a
+domain of the merged result (` + "`domain`" + `), sorted by ` + "`sort`" + ` and ` + "`order`" + `,
+and paged with ` + "`limit`" + ` and ` + "`offset`" + `. The X-Total-Count header holds the
+number of entries matching the filters.
+
+By default each entry is a summary, read without loading the stored data:
 - **id**: Unique identifier
 - **created_at**: Timestamp of the merge operation
+- **size**: Size of the stored JSON
+- **domains**, **servers**, **certificates**: Counts of the merged result
+- **stats**: Merge statistics, when recorded
+
+With ` + "`full=true`" + ` entries also contain their data, as returned by
+` + "`GET /api/history/{id}`" + `:
 - **initial**: Original configuration before merge
 - **response**: Certificate data used for merge
 - **result**: Final merged configuration`,
@@ -272,6 +764,31 @@ Each entry contains:
 		DefaultStatus: http.StatusOK,
 	}, s.handleListHistory)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "diffHistory",
+		Method:      http.MethodGet,
+		Path:        "/api/history/diff",
+		Summary:     "Diff two history entries",
+		Description: `Compares the merged results of two history entries.
+
+Domains are matched by ID and LDAP servers by URL. Certificates are compared
+by SHA-256 fingerprint, so re-encoded but identical certificates are not
+reported as changes.
+
+The response contains both a structured diff and a human-readable rendering:
+
+` + "```" + `
+~ domain example.lab
+    + server ldaps://ad-03.example.lab:636
+    ~ server ldaps://ad-01.example.lab:636
+        - certificate 3f9a...
+        + certificate b27c...
+` + "```",
+		Tags:          []string{"history"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusNotFound, http.StatusUnprocessableEntity},
+	}, s.handleDiffHistory)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "getHistory",
 		Method:      http.MethodGet,
@@ -285,8 +802,275 @@ The entry includes full data for:
 - Merged result`,
 		Tags:          []string{"history"},
 		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusNotFound},
 	}, s.handleGetHistory)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "deleteHistory",
+		Method:      http.MethodDelete,
+		Path:        "/api/history/{id}",
+		Summary:     "Delete history entry",
+		Description: `Permanently removes a history entry by ID, with its data in the artifact
+store when one is configured.
+
+Snapshots taken before pushing the entry are kept; their ` + "`history_id`" + ` is
+cleared. Use ` + "`DELETE /api/history?before=...`" + ` to remove old entries in bulk.`,
+		Tags:          []string{"history"},
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusNotFound},
+	}, s.handleDeleteHistory)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "purgeHistory",
+		Method:      http.MethodDelete,
+		Path:        "/api/history",
+		Summary:     "Purge old history",
+		Description: `Permanently removes the history entries created before ` + "`before`" + `,
+with their data in the artifact store when one is configured, and returns
+how many were removed.
+
+` + "```bash" + `
+curl -X DELETE 'http://localhost:8080/api/history?before=2025-01-01T00:00:00Z'
+` + "```" + `
+
+Keys bound to a tenant remove only that tenant's entries. The database
+file does not shrink by itself: the space of removed entries is reused by
+later ones.`,
+		Tags:          []string{"history"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusUnprocessableEntity},
+	}, s.handlePurgeHistory)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "getHistoryResult",
+		Method:      http.MethodGet,
+		Path:        "/api/history/{id}/result",
+		Summary:     "Get history merge result",
+		Description: `Returns only the merged result of a history entry: the array of domains
+in the same format as ` + "`ldapmerge merge`" + ` output.
+
+With ` + "`download=true`" + ` the result is pretty-printed and returned as a file
+attachment, ready for ` + "`ldapmerge nsx push -f`" + `:
+
+` + "```bash" + `
+curl -OJ 'http://localhost:8080/api/history/12/result?download=true'
+ldapmerge nsx push -f ldapmerge-result-12.json ...
+` + "```" + `
+
+With ` + "`split=true`" + ` the result is returned as ` + "`ldapmerge-result-{id}.zip`" + ` with one
+pretty-printed file per domain, named after the domain ID as
+` + "`ldapmerge merge --split-output`" + ` names them.`,
+		Tags:          []string{"history"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusNotFound},
+	}, s.handleGetHistoryResult)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "getHistoryResultSignature",
+		Method:      http.MethodGet,
+		Path:        "/api/history/{id}/result/signature",
+		Summary:     "Get history result signature",
+		Description: `Returns a detached signature of the file served by
+` + "`GET /api/history/{id}/result?download=true`" + `, signed with the server's
+configured key (the ` + "`signing:`" + ` config section).
+
+Verify the pair with ` + "`ldapmerge verify-output`" + `:
+
+` + "```bash" + `
+curl -OJ 'http://localhost:8080/api/history/12/result?download=true'
+curl -OJ 'http://localhost:8080/api/history/12/result/signature'
+ldapmerge verify-output ldapmerge-result-12.json --public-key signing.pub
+` + "```" + `
+
+Returns 404 (` + "`LM-1002`" + `) when signing is not configured.`,
+		Tags:          []string{"history"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusNotFound},
+	}, s.handleGetHistoryResultSignature)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "pushHistory",
+		Method:      http.MethodPost,
+		Path:        "/api/history/{id}/push",
+		Summary:     "Re-push history result to NSX",
+		Description: `Pushes the merged result of a history entry to an NSX Manager again,
+using a saved NSX configuration.
+
+Useful after an NSX restore wiped recent identity source changes.
+
+` + "`reason`" + ` is required and stored with the outcome in the audit log; it is
+also sent to the audit webhook when one is configured (` + "`audit.webhook_url`" + `).
+
+## Errors
+
+- **LM-2001** (502): NSX Manager rejected the configuration's credentials
+- **LM-2002** (502/504): NSX Manager is unreachable or timed out
+
+Both abort the push. Other NSX errors are reported per source in ` + "`results`" + `.
+
+## Sync defaults
+
+` + "`dry_run`" + `, ` + "`domains`" + ` and ` + "`canary`" + ` default to the ` + "`sync_defaults`" + ` of the
+configuration. A dry run lists the sources it would push in ` + "`planned`" + ` without
+changing NSX. With a canary, that source is pushed first and, if NSX does not
+accept it, the others are listed in ` + "`skipped`" + ` and left unchanged.`,
+		Tags:          []string{"history"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway, http.StatusGatewayTimeout},
+	}, s.handlePushHistory)
+
+	// Snapshot endpoints
+	huma.Register(api, huma.Operation{
+		OperationID:   "listSnapshots",
+		Method:        http.MethodGet,
+		Path:          "/api/snapshots",
+		Summary:       "List snapshots",
+		Description:   `Returns snapshots, newest first, with the IDs of their sources but without the source documents.`,
+		Tags:          []string{"snapshots"},
+		DefaultStatus: http.StatusOK,
+	}, s.handleListSnapshots)
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "getSnapshot",
+		Method:        http.MethodGet,
+		Path:          "/api/snapshots/{id}",
+		Summary:       "Get snapshot",
+		Description:   `Returns a snapshot by ID, including each source as NSX Manager returned it.`,
+		Tags:          []string{"snapshots"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusNotFound},
+	}, s.handleGetSnapshot)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "restoreSnapshot",
+		Method:      http.MethodPost,
+		Path:        "/api/snapshots/{id}/restore",
+		Summary:     "Restore snapshot to NSX",
+		Description: `Puts the identity sources of a snapshot back on NSX Manager as they were
+captured, and deletes those that did not exist then. Every push saves a
+snapshot first (` + "`snapshot_id`" + ` in the push response), so this rolls a push back.
+
+The configuration must point to the NSX Manager the snapshot was taken on
+(409, ` + "`LM-1003`" + `, otherwise). The current state is snapshotted before the
+restore, so a restore can be rolled back too.
+
+` + "`reason`" + ` is required and stored in the audit log as ` + "`snapshot.restore`" + `.
+Protected sources need ` + "`force_protected`" + `.
+
+## Errors
+
+- **LM-2001** (502): NSX Manager rejected the configuration's credentials
+- **LM-2002** (502/504): NSX Manager is unreachable or timed out
+
+Both abort the restore. Other NSX errors are reported per source in ` + "`results`" + `.`,
+		Tags:          []string{"snapshots"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway, http.StatusGatewayTimeout},
+	}, s.handleRestoreSnapshot)
+
+	// Audit endpoints
+	huma.Register(api, huma.Operation{
+		OperationID: "listAudit",
+		Method:      http.MethodGet,
+		Path:        "/api/audit",
+		Summary:     "List audit events",
+		Description: `Returns audit events, newest first: pushes, deletes and restores made
+through the CLI or the API, and every authenticated POST, PUT, PATCH and
+DELETE to the API (` + "`api.request`" + `).
+
+Events are filtered by the query parameters; all filters must match:
+- **actor**: OS user for CLI changes; API key name, oidc:<user> or cert:<subject> for API changes
+- **source_ip**: client IP of API changes, as seen by the server
+- **operation**: e.g. ` + "`history.push`" + ` or ` + "`api.request`" + `
+- **body_sha256**: hex SHA-256 of the body of an ` + "`api.request`" + `, to find who sent a given payload
+- **since**, **until**: time range, inclusive
+
+Requests made with an API key or token bound to a tenant are refused with
+403 (` + "`LM-1006`" + `).`,
+		Tags:          []string{"audit"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusForbidden},
+	}, s.handleListAudit)
+
+	// Inventory endpoints
+	huma.Register(api, huma.Operation{
+		OperationID: "listServers",
+		Method:      http.MethodGet,
+		Path:        "/api/servers",
+		Summary:     "List LDAP server inventory",
+		Description: `Returns every LDAP server seen in an NSX pull (` + "`ldapmerge nsx pull`" + `,
+` + "`ldapmerge sync`" + `), one entry per NSX Manager, identity source and URL.
+
+Each entry includes:
+- **enabled**: Server state in NSX
+- **cert_fingerprint**, **cert_subject**, **cert_expires_at**: Leaf certificate details
+- **cert_count**: Number of certificates configured for the server
+- **last_probe_at**, **last_probe_ok**, **last_probe_error**: Last probe outcome
+- **uptime**, **probe_count**, **last_failure_at**: Statistics over the retained probe history
+- **consecutive_failures**, **failing**: Servers that failed at least the server's
+  failure threshold (` + "`probes.failure_threshold`" + `, default 3) of probes in a row are flagged
+- **first_seen_at**, **last_seen_at**: Pulls that included the server; servers removed
+  from NSX keep their last ` + "`last_seen_at`" + `
+
+Probes come from ` + "`ldapmerge nsx probe`" + ` and, when the server runs with
+` + "`--probe-interval`" + `, from scheduled probes of every saved NSX configuration.
+
+Requests made with an API key or token bound to a tenant see the servers of
+the NSX Managers of that tenant's configurations only.
+
+Filter with ` + "`domain`" + `, ` + "`nsx_host`" + ` and ` + "`failing`" + `.`,
+		Tags:          []string{"inventory"},
+		DefaultStatus: http.StatusOK,
+	}, s.handleListServers)
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "listServerProbes",
+		Method:        http.MethodGet,
+		Path:          "/api/servers/{id}/probes",
+		Summary:       "Get server probe history",
+		Description:   `Returns the probe history of an inventory server, newest first.`,
+		Tags:          []string{"inventory"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusNotFound},
+	}, s.handleListServerProbes)
+
+	// Admin endpoints
+	huma.Register(api, huma.Operation{
+		OperationID: "getSettings",
+		Method:      http.MethodGet,
+		Path:        "/api/admin/settings",
+		Summary:     "Get runtime settings",
+		Description: `Returns the settings of the running server that can be changed without
+a restart, with the database path and whether scheduled probes run.
+
+Requests made with an API key or token bound to a tenant are refused with
+403 (` + "`LM-1006`" + `).`,
+		Tags:          []string{"admin"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusForbidden},
+	}, s.handleGetSettings)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "updateSettings",
+		Method:      http.MethodPatch,
+		Path:        "/api/admin/settings",
+		Summary:     "Change runtime settings",
+		Description: `Changes settings of the running server and stores them in the database,
+so that they are applied again when the server restarts and override the
+matching flags. Omitted settings are left as they are.
+
+- **log_level**: level of the server's log
+- **probe_retention**: how long probe history is kept, applied from the next probe round
+- **probes_paused**: skip scheduled probe rounds; a round in progress is completed
+
+The probe settings of a server started without ` + "`--probe-interval`" + ` are
+stored and apply once it runs scheduled probes. Returns the settings after
+the change.`,
+		Tags:          []string{"admin"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusForbidden, http.StatusNotFound, http.StatusUnprocessableEntity},
+	}, s.handleUpdateSettings)
+
 	// NSX Config endpoints
 	huma.Register(api, huma.Operation{
 		OperationID: "listConfigs",
@@ -317,9 +1101,14 @@ The entry includes full data for:
 
 - **password**: API password (stored securely)
 - **description**: Human-readable description
-- **insecure**: Skip TLS certificate verification`,
+- **insecure**: Skip TLS certificate verification
+- **sync_defaults**: Options of pushes to this NSX Manager that do not set
+  them: ` + "`dry_run`" + `, merge ` + "`strategy`" + `, ` + "`domains`" + ` (glob patterns of the
+  identity source IDs to push) and ` + "`canary`" + ` (a source pushed first; the
+  others are pushed only if NSX accepts it)`,
 		Tags:          []string{"config"},
 		DefaultStatus: http.StatusCreated,
+		Errors:        []int{http.StatusBadRequest},
 	}, s.handleCreateConfig)
 
 	huma.Register(api, huma.Operation{
@@ -332,27 +1121,186 @@ The entry includes full data for:
 > **Security Note:** Password field is never included in the response.`,
 		Tags:          []string{"config"},
 		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusNotFound},
 	}, s.handleGetConfig)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "getConfigSnippet",
+		Method:      http.MethodGet,
+		Path:        "/api/configs/{id}/snippet",
+		Summary:     "Get NSX configuration as a sync command",
+		Description: `Returns the ` + "`ldapmerge sync`" + ` command line that syncs the NSX Manager of
+a configuration with its ` + "`sync_defaults`" + `, as plain text, to hand a sync set up
+through the API over to the CLI. ` + "`ldapmerge config snippet <name>`" + ` prints the
+same command.
+
+The password is left out: the command reads it from ` + "`LDAPMERGE_NSX_PASSWORD`" + `.
+The certificate response and the audit reason are placeholders to replace.
+
+` + "```bash" + `
+curl http://localhost:8080/api/configs/1/snippet
+` + "```",
+		Tags:          []string{"config"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusNotFound},
+	}, s.handleGetConfigSnippet)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "deleteConfig",
 		Method:      http.MethodDelete,
 		Path:        "/api/configs/{id}",
 		Summary:     "Delete NSX configuration",
-		Description: `Permanently deletes an NSX configuration by ID.
+		Description: `Deletes an NSX configuration by ID.
 
-This action cannot be undone.`,
+The configuration is soft-deleted: it no longer appears in lists or lookups
+and its name can be reused, but the record is kept so that history and audit
+entries referring to it remain intact.
+
+Use ` + "`DELETE /api/configs/{id}/purge`" + ` to remove it permanently.`,
 		Tags:          []string{"config"},
 		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusNotFound},
 	}, s.handleDeleteConfig)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "purgeConfig",
+		Method:      http.MethodDelete,
+		Path:        "/api/configs/{id}/purge",
+		Summary:     "Purge NSX configuration",
+		Description: `Permanently removes an NSX configuration by ID, including soft-deleted ones.
+
+This action cannot be undone.`,
+		Tags:          []string{"config"},
+		DefaultStatus: http.StatusNoContent,
+		Errors:        []int{http.StatusNotFound},
+	}, s.handlePurgeConfig)
+
+	// NSX endpoints
+	huma.Register(api, huma.Operation{
+		OperationID: "listNSXSources",
+		Method:      http.MethodGet,
+		Path:        "/api/nsx/{configId}/sources",
+		Summary:     "Pull identity sources from NSX",
+		Description: `Fetches the LDAP identity sources of the NSX Manager of a saved configuration
+and returns them as domains, like ` + "`ldapmerge nsx pull`" + `. The result can be
+passed as ` + "`initial`" + ` to ` + "`POST /api/merge`" + `, so that the whole workflow
+runs without the CLI.
+
+The LDAP servers pulled are recorded in the server inventory (` + "`GET /api/servers`" + `).
+
+## Errors
+
+- **LM-2001** (502): NSX Manager rejected the configuration's credentials
+- **LM-2002** (502/504): NSX Manager is unreachable or timed out
+- **LM-2003** (502): NSX Manager returned another error`,
+		Tags:          []string{"nsx"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusNotFound, http.StatusBadGateway, http.StatusGatewayTimeout},
+	}, s.handleListNSXSources)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "pushNSX",
+		Method:      http.MethodPost,
+		Path:        "/api/nsx/{configId}/push",
+		Summary:     "Push domains to NSX",
+		Description: `Pushes domains, such as the merged result of ` + "`POST /api/merge`" + `, to the NSX
+Manager of a saved configuration, like ` + "`ldapmerge nsx push`" + `, and returns the
+outcome of each identity source.
+
+As with ` + "`POST /api/history/{id}/push`" + `, the sources are checked against the
+protected sources and snapshotted before they change, ` + "`reason`" + ` is required and
+stored with the outcome in the audit log (operation ` + "`nsx.push`" + `), and ` + "`dry_run`" + `,
+` + "`domains`" + ` and ` + "`canary`" + ` default to the ` + "`sync_defaults`" + ` of the configuration.
+
+## Errors
+
+- **LM-2001** (502): NSX Manager rejected the configuration's credentials
+- **LM-2002** (502/504): NSX Manager is unreachable or timed out
+
+Both abort the push. Other NSX errors are reported per source in ` + "`results`" + `.`,
+		Tags:          []string{"nsx"},
+		DefaultStatus: http.StatusOK,
+		Errors:        []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusBadGateway, http.StatusGatewayTimeout},
+	}, s.handlePushNSX)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "startSync",
+		Method:      http.MethodPost,
+		Path:        "/api/sync",
+		Summary:     "Start a sync",
+		Description: `Starts a sync of a saved NSX configuration, like ` + "`ldapmerge sync`" + `, and
+returns its job at once with status 202 and the URL of the job in ` + "`Location`" + `.
+
+In the background, the job pulls the identity sources from the NSX Manager, merges
+the certificate response into those matching ` + "`domains`" + `, records the merge in
+history and pushes the result back as ` + "`POST /api/nsx/{configId}/push`" + ` does: protected
+sources are refused without ` + "`force_protected`" + `, a snapshot linked to the history
+entry is taken first, and the push is recorded in the audit log (operation
+` + "`sync.push`" + `). Poll ` + "`GET /api/sync/{id}`" + ` for its progress and outcome.
+
+The request is checked before the job starts: the configuration, the certificate
+response and the options. A configuration runs one sync at a time; another one is
+refused with 409 until it ends.`,
+		Tags:          []string{"sync"},
+		DefaultStatus: http.StatusAccepted,
+		Errors:        []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	}, s.handleStartSync)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "listSyncJobs",
+		Method:      http.MethodGet,
+		Path:        "/api/sync",
+		Summary:     "List sync jobs",
+		Description: `Returns the sync jobs, newest first. Jobs are kept in memory: the last ` + fmt.Sprint(maxSyncJobs) + `
+are listed, and a restart of the server forgets them. What they changed stays in
+history, snapshots and the audit log.`,
+		Tags: []string{"sync"},
+	}, s.handleListSyncJobs)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "getSyncJob",
+		Method:      http.MethodGet,
+		Path:        "/api/sync/{id}",
+		Summary:     "Get a sync job",
+		Description: `Returns a sync job: its status and phase while it runs, then the outcome of the push
+in ` + "`result`" + ` or, if it stopped early, the error in ` + "`error`" + `, with the code a request
+failing with it would have returned.`,
+		Tags:   []string{"sync"},
+		Errors: []int{http.StatusNotFound},
+	}, s.handleGetSyncJob)
+
+	s.api = api
+	s.openapi = api.OpenAPI()
+	documentOperations(s.openapi)
 }
 
 func (s *Server) handleMerge(ctx context.Context, input *MergeInput) (*MergeOutput, error) {
-	result := s.merger.Merge(input.Body.Initial, &input.Body.Response)
+	m, err := s.mergerFor(input.Body.Options)
+	if err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error(), err)
+	}
+
+	initial, response, err := s.resolveMergeDocuments(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.Validate(initial, response); err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error(), err)
+	}
+	logWeakCertificates(m, response)
+
+	result, stats, err := m.MergeWithStats(ctx, initial, response)
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeInternal, "merge failed", err)
+	}
 
 	// Save to history (ignore error, don't fail the request)
-	if s.repo != nil {
-		_, _ = s.repo.SaveHistory(ctx, input.Body.Initial, input.Body.Response, result)
+	switch {
+	case input.Body.SaveHistory != nil && !*input.Body.SaveHistory:
+		slog.InfoContext(ctx, "merge history not saved", "reason", "save_history=false", "domains_count", len(result))
+	case s.repo != nil:
+		_, _ = s.repo.SaveHistoryWithStats(ctx, initial, *response, result, &stats)
 	}
 
 	return &MergeOutput{Body: result}, nil
@@ -367,14 +1315,15 @@ func (s *Server) handleHealth(ctx context.Context, input *struct{}) (*HealthOutp
 	if s.repo != nil {
 		if dbInfo, err := s.repo.GetDBInfo(ctx); err == nil {
 			output.Body.Database = &DatabaseInfo{
-				Path:         dbInfo.Path,
-				Size:         dbInfo.Size,
-				SizeHuman:    dbInfo.SizeHuman,
-				Version:      dbInfo.Version,
-				Tables:       dbInfo.Tables,
-				WALMode:      dbInfo.WALMode,
-				HistoryCount: dbInfo.HistoryCount,
-				ConfigCount:  dbInfo.ConfigCount,
+				Path:          dbInfo.Path,
+				Size:          dbInfo.Size,
+				SizeHuman:     dbInfo.SizeHuman,
+				Version:       dbInfo.Version,
+				Tables:        dbInfo.Tables,
+				WALMode:       dbInfo.WALMode,
+				HistoryCount:  dbInfo.HistoryCount,
+				ConfigCount:   dbInfo.ConfigCount,
+				DocumentCount: dbInfo.DocumentCount,
 			}
 		}
 	}
@@ -382,32 +1331,256 @@ func (s *Server) handleHealth(ctx context.Context, input *struct{}) (*HealthOutp
 	return output, nil
 }
 
-func (s *Server) handleListHistory(ctx context.Context, input *struct{}) (*HistoryListOutput, error) {
+func (s *Server) handleReady(ctx context.Context, input *struct{}) (*ReadyOutput, error) {
+	output := &ReadyOutput{}
+	output.Body.Status = "ready"
 	if s.repo == nil {
-		return &HistoryListOutput{Body: []models.HistoryEntry{}}, nil
+		return output, nil
 	}
 
-	entries, err := s.repo.ListHistory(ctx)
+	if err := s.repo.Ping(ctx); err != nil {
+		return nil, apiError(http.StatusServiceUnavailable, CodeDatabase, "database not ready", err)
+	}
+	health := DatabaseHealth(s.repo.Health())
+	output.Body.Database = &health
+	return output, nil
+}
+
+func (s *Server) handleListHistory(ctx context.Context, input *HistoryListInput) (*HistoryListOutput, error) {
+	output := &HistoryListOutput{Body: []HistoryListEntry{}}
+	if s.repo == nil {
+		return output, nil
+	}
+	if !input.From.IsZero() && !input.To.IsZero() && input.To.Before(input.From) {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, "to is before from")
+	}
+
+	filter := repository.HistoryFilter{
+		From:   input.From,
+		To:     input.To,
+		Domain: input.Domain,
+		Sort:   input.Sort,
+		Asc:    input.Order == "asc",
+		Limit:  input.Limit,
+		Offset: input.Offset,
+	}
+	total, err := s.repo.CountHistory(ctx, filter)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("failed to list history", err)
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to count history", err)
 	}
+	output.Total = total
 
-	return &HistoryListOutput{Body: entries}, nil
+	if !input.Full {
+		summaries, err := s.repo.ListHistorySummaries(ctx, filter)
+		if err != nil {
+			return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to list history", err)
+		}
+		for _, summary := range summaries {
+			output.Body = append(output.Body, HistoryListEntry{HistorySummary: summary})
+		}
+		return output, nil
+	}
+
+	entries, err := s.repo.ListHistory(ctx, filter)
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to list history", err)
+	}
+	for i := range entries {
+		entry := &entries[i]
+		output.Body = append(output.Body, HistoryListEntry{
+			HistorySummary: entry.Summary(),
+			Initial:        &entry.Initial,
+			Response:       &entry.Response,
+			Result:         &entry.Result,
+		})
+	}
+	return output, nil
 }
 
 func (s *Server) handleGetHistory(ctx context.Context, input *HistoryInput) (*HistoryOutput, error) {
 	if s.repo == nil {
-		return nil, huma.Error404NotFound("history not available")
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "history not available")
 	}
 
 	entry, err := s.repo.GetHistory(ctx, input.ID)
 	if err != nil {
-		return nil, huma.Error404NotFound("history entry not found")
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "history entry not found")
 	}
 
 	return &HistoryOutput{Body: *entry}, nil
 }
 
+func (s *Server) handleDeleteHistory(ctx context.Context, input *HistoryInput) (*struct{}, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "history not available")
+	}
+
+	err := s.repo.DeleteHistory(ctx, input.ID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "history entry not found")
+	case errors.Is(err, repository.ErrArtifactsKept):
+		logging.RunLogger(ctx).Warn("history entry deleted, but not its artifacts", "history_id", input.ID, "error", err)
+	case err != nil:
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to delete history entry", err)
+	}
+
+	return &struct{}{}, nil
+}
+
+func (s *Server) handlePurgeHistory(ctx context.Context, input *HistoryPurgeInput) (*HistoryPurgeOutput, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "history not available")
+	}
+
+	deleted, err := s.repo.PurgeHistory(ctx, input.Before)
+	log := logging.RunLogger(ctx)
+	switch {
+	case errors.Is(err, repository.ErrArtifactsKept):
+		log.Warn("history entries deleted, but not all their artifacts", "before", input.Before, "deleted", deleted, "error", err)
+	case err != nil:
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to purge history", err)
+	}
+	log.Info("history purged", "before", input.Before, "deleted", deleted, "actor", caller(ctx))
+
+	output := &HistoryPurgeOutput{}
+	output.Body.Deleted = deleted
+	return output, nil
+}
+
+func (s *Server) handleDiffHistory(ctx context.Context, input *HistoryDiffInput) (*HistoryDiffOutput, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "history not available")
+	}
+
+	a, err := s.repo.GetHistory(ctx, input.A)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, fmt.Sprintf("history entry %d not found", input.A))
+	}
+	b, err := s.repo.GetHistory(ctx, input.B)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, fmt.Sprintf("history entry %d not found", input.B))
+	}
+
+	r := diff.Compare(a.Result.Data, b.Result.Data)
+
+	var text strings.Builder
+	_ = r.WriteText(&text)
+
+	output := &HistoryDiffOutput{}
+	output.Body.A = a.ID
+	output.Body.B = b.ID
+	output.Body.Identical = r.Empty()
+	output.Body.Diff = r
+	output.Body.Text = text.String()
+	return output, nil
+}
+
+func (s *Server) handleGetHistoryResult(ctx context.Context, input *HistoryResultInput) (*HistoryResultOutput, error) {
+	if input.Split {
+		return s.historySplitResult(ctx, input.ID)
+	}
+
+	entry, data, err := s.historyResult(ctx, input.ID, input.Download)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &HistoryResultOutput{ContentType: "application/json", Body: data}
+	if input.Download {
+		output.ContentDisposition = fmt.Sprintf(`attachment; filename="%s"`, historyResultFilename(entry.ID))
+	}
+
+	return output, nil
+}
+
+func (s *Server) handleGetHistoryResultSignature(ctx context.Context, input *HistoryInput) (*HistoryResultOutput, error) {
+	if s.signer == nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "result signing is not configured")
+	}
+
+	entry, data, err := s.historyResult(ctx, input.ID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := s.signer.Sign(ctx, data)
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeInternal, "failed to sign result", err)
+	}
+
+	return &HistoryResultOutput{
+		ContentType:        "text/plain; charset=utf-8",
+		ContentDisposition: fmt.Sprintf(`attachment; filename="%s%s"`, historyResultFilename(entry.ID), s.signer.Extension()),
+		Body:               sig,
+	}, nil
+}
+
+// historyResult returns the merged result of a history entry as JSON. The
+// download form is pretty-printed with a trailing newline.
+func (s *Server) historyResult(ctx context.Context, id int64, download bool) (*models.HistoryEntry, []byte, error) {
+	if s.repo == nil {
+		return nil, nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "history not available")
+	}
+
+	entry, err := s.repo.GetHistory(ctx, id)
+	if err != nil {
+		return nil, nil, apiError(http.StatusNotFound, CodeNotFound, "history entry not found")
+	}
+
+	var buf bytes.Buffer
+	if err := s.merger.WriteJSON(&buf, entry.Result.Data, download); err != nil {
+		return nil, nil, apiError(http.StatusInternalServerError, CodeInternal, "failed to encode result", err)
+	}
+	if download {
+		buf.WriteByte('\n')
+	}
+
+	return entry, buf.Bytes(), nil
+}
+
+func historyResultFilename(id int64) string {
+	return fmt.Sprintf("ldapmerge-result-%d.json", id)
+}
+
+// historySplitResult returns the merged result of a history entry as a zip
+// of one file per domain, named by merger.SplitFileNames and in the
+// download form of historyResult.
+func (s *Server) historySplitResult(ctx context.Context, id int64) (*HistoryResultOutput, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "history not available")
+	}
+
+	entry, err := s.repo.GetHistory(ctx, id)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "history entry not found")
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	domains := entry.Result.Data
+	for i, name := range merger.SplitFileNames(domains) {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: entry.CreatedAt})
+		if err == nil {
+			if err = s.merger.WriteJSON(w, domains[i:i+1], true); err == nil {
+				_, err = w.Write([]byte{'\n'})
+			}
+		}
+		if err != nil {
+			return nil, apiError(http.StatusInternalServerError, CodeInternal, "failed to encode result", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeInternal, "failed to encode result", err)
+	}
+
+	return &HistoryResultOutput{
+		ContentType:        "application/zip",
+		ContentDisposition: fmt.Sprintf(`attachment; filename="ldapmerge-result-%d.zip"`, entry.ID),
+		Body:               buf.Bytes(),
+	}, nil
+}
+
 func (s *Server) handleListConfigs(ctx context.Context, input *struct{}) (*ConfigListOutput, error) {
 	if s.repo == nil {
 		return &ConfigListOutput{Body: []models.NSXConfig{}}, nil
@@ -415,7 +1588,7 @@ func (s *Server) handleListConfigs(ctx context.Context, input *struct{}) (*Confi
 
 	configs, err := s.repo.ListConfigs(ctx)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("failed to list configs", err)
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to list configs", err)
 	}
 
 	return &ConfigListOutput{Body: configs}, nil
@@ -423,12 +1596,16 @@ func (s *Server) handleListConfigs(ctx context.Context, input *struct{}) (*Confi
 
 func (s *Server) handleCreateConfig(ctx context.Context, input *ConfigInput) (*ConfigOutput, error) {
 	if s.repo == nil {
-		return nil, huma.Error500InternalServerError("database not available", nil)
+		return nil, apiError(http.StatusInternalServerError, CodeDatabaseUnavailable, "database not available")
+	}
+
+	if err := validateSyncDefaults(input.Body.SyncDefaults); err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error())
 	}
 
 	config, err := s.repo.SaveConfig(ctx, &input.Body)
 	if err != nil {
-		return nil, huma.Error500InternalServerError("failed to save config", err)
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to save config", err)
 	}
 
 	return &ConfigOutput{Body: *config}, nil
@@ -436,80 +1613,152 @@ func (s *Server) handleCreateConfig(ctx context.Context, input *ConfigInput) (*C
 
 func (s *Server) handleGetConfig(ctx context.Context, input *ConfigPathInput) (*ConfigOutput, error) {
 	if s.repo == nil {
-		return nil, huma.Error404NotFound("config not available")
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "config not available")
 	}
 
 	config, err := s.repo.GetConfig(ctx, input.ID)
 	if err != nil {
-		return nil, huma.Error404NotFound("config not found")
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "config not found")
 	}
 
 	return &ConfigOutput{Body: *config}, nil
 }
 
+func (s *Server) handleGetConfigSnippet(ctx context.Context, input *ConfigPathInput) (*ConfigSnippetOutput, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "config not available")
+	}
+
+	config, err := s.repo.GetConfig(ctx, input.ID)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "config not found")
+	}
+
+	return &ConfigSnippetOutput{ContentType: "text/plain; charset=utf-8", Body: []byte(snippet.Sync(config))}, nil
+}
+
 func (s *Server) handleDeleteConfig(ctx context.Context, input *ConfigPathInput) (*struct{}, error) {
 	if s.repo == nil {
-		return nil, huma.Error500InternalServerError("database not available", nil)
+		return nil, apiError(http.StatusInternalServerError, CodeDatabaseUnavailable, "database not available")
 	}
 
 	err := s.repo.DeleteConfig(ctx, input.ID)
 	if err != nil {
-		return nil, huma.Error404NotFound("config not found")
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "config not found")
 	}
 
 	return &struct{}{}, nil
 }
 
-// Start starts the HTTP server
-func (s *Server) Start() error {
-	srv := &http.Server{
-		Addr:              s.addr,
-		Handler:           s.router,
+func (s *Server) handlePurgeConfig(ctx context.Context, input *ConfigPathInput) (*struct{}, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabaseUnavailable, "database not available")
+	}
+
+	err := s.repo.PurgeConfig(ctx, input.ID)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "config not found")
+	}
+
+	return &struct{}{}, nil
+}
+
+// Handler returns the handler of the server's routes and middleware, to
+// serve them on a listener of the caller's.
+func (s *Server) Handler() http.Handler {
+	return s.router
+}
+
+// API returns the Huma API of the server. Requests to it go through the
+// same middleware as requests to Start's listener.
+func (s *Server) API() huma.API {
+	return s.api
+}
+
+// Start starts the HTTP server, or the HTTPS server and its HTTP redirect
+// when TLS is configured, and serves until ctx is done, Shutdown is called
+// or a listener fails. Once ctx is done, it shuts the server down as
+// Shutdown does, waiting up to the shutdown timeout for the requests in
+// flight. It returns the error of the listener that failed, if any.
+func (s *Server) Start(ctx context.Context) error {
+	srv := newHTTPServer(s.addr, s.router)
+	servers := []*http.Server{srv}
+	listeners := []func() error{srv.ListenAndServe}
+	if s.tlsCert != "" || s.tlsKey != "" {
+		var err error
+		if srv.TLSConfig, err = tlsConfig(s.tlsCert, s.tlsKey, s.tlsClientCA); err != nil {
+			return err
+		}
+		listeners[0] = func() error { return srv.ListenAndServeTLS("", "") }
+		if s.redirectAddr != "" {
+			redirect := newHTTPServer(s.redirectAddr, httpsRedirect(s.addr))
+			servers = append(servers, redirect)
+			listeners = append(listeners, redirect.ListenAndServe)
+		}
+	}
+
+	s.mu.Lock()
+	s.httpServers = servers
+	s.mu.Unlock()
+
+	errs := make(chan error, len(listeners))
+	for _, listen := range listeners {
+		go func() { errs <- listen() }()
+	}
+
+	select {
+	case err := <-errs:
+		if errors.Is(err, http.ErrServerClosed) {
+			// Shutdown was called, and waits for the requests in flight
+			return nil
+		}
+		for _, srv := range servers {
+			_ = srv.Close()
+		}
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.shutdownTimeout)
+		defer cancel()
+		return s.Shutdown(shutdownCtx)
+	}
+}
+
+// Shutdown stops the listeners of Start and waits until the requests in
+// flight, such as merges and pushes, and the sync jobs have finished or ctx
+// is done. The connections still open then are closed, and their requests
+// fail; the sync jobs still running are canceled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	servers := s.httpServers
+	s.mu.Unlock()
+
+	slog.Info("API server shutting down, waiting for requests in flight")
+	var errs []error
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			_ = srv.Close()
+			errs = append(errs, fmt.Errorf("requests in flight on %s not finished: %w", srv.Addr, err))
+		}
+	}
+	if err := s.jobs.wait(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	slog.Info("API server stopped")
+	return nil
+}
+
+// newHTTPServer returns an http.Server for handler on addr with the
+// timeouts of the API.
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
 		ReadTimeout:       30 * time.Second,
 		ReadHeaderTimeout: 10 * time.Second,
 		WriteTimeout:      30 * time.Second,
 		IdleTimeout:       120 * time.Second,
 	}
-	return srv.ListenAndServe()
-}
-
-// Scalar API Documentation HTML
-const scalarHTML = `<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>ldapmerge API Documentation</title>
-    <meta name="description" content="LDAP Configuration Merger for VMware NSX 4.2 - API Documentation">
-    <link rel="icon" type="image/svg+xml" href="data:image/svg+xml,<svg xmlns='http://www.w3.org/2000/svg' viewBox='0 0 100 100'><text y='.9em' font-size='90'>🔀</text></svg>">
-    <style>
-        body {
-            margin: 0;
-            padding: 0;
-        }
-    </style>
-</head>
-<body>
-    <script
-        id="api-reference"
-        data-url="/openapi.json"
-        data-configuration='{
-            "theme": "kepler",
-            "layout": "modern",
-            "darkMode": true,
-            "hiddenClients": ["unirest"],
-            "defaultHttpClient": {
-                "targetKey": "shell",
-                "clientKey": "curl"
-            },
-            "metaData": {
-                "title": "ldapmerge API",
-                "description": "LDAP Configuration Merger for VMware NSX 4.2",
-                "ogDescription": "REST API for merging LDAP configurations with SSL certificates"
-            },
-            "searchHotKey": "k"
-        }'
-    ></script>
-    <script src="https://cdn.jsdelivr.net/npm/@scalar/api-reference"></script>
-</body>
-</html>`
+}
@@ -1,10 +1,20 @@
 package api_test
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"ldapmerge/internal/api"
+	"ldapmerge/internal/api/apitest"
 	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
 )
 
 func TestMergeLogic(t *testing.T) {
@@ -140,3 +150,229 @@ func TestRequestBodyStructure(t *testing.T) {
 		t.Error("Expected 'response' field in request")
 	}
 }
+
+// mergeRequest is a merge of one domain with one server and its certificate.
+var mergeRequest = map[string]any{
+	"initial": []models.Domain{{
+		ID:          "example.lab",
+		DomainName:  "example.lab",
+		BaseDN:      "DC=example,DC=lab",
+		LDAPServers: []models.LDAPServer{{URL: "ldaps://ad-01.example.lab:636", StartTLS: "false", Enabled: "true"}},
+	}},
+	"response": models.CertificateResponse{Results: []models.CertificateResult{{
+		JSON: models.CertificateJSON{PEMEncoded: "-----BEGIN CERTIFICATE-----\ncert1\n-----END CERTIFICATE-----"},
+		Item: models.ResponseItem{URL: "ldaps://ad-01.example.lab:636"},
+	}}},
+}
+
+func TestMergeEndpoint(t *testing.T) {
+	a := apitest.New(t)
+
+	resp := a.Post("/api/merge", mergeRequest)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("merge: status %d: %s", resp.Code, resp.Body.String())
+	}
+	result := apitest.Decode[[]models.Domain](t, resp.Body.Bytes())
+	if len(result) != 1 || len(result[0].LDAPServers) != 1 || len(result[0].LDAPServers[0].Certificates) != 1 {
+		t.Fatalf("merge result = %+v, want one server with one certificate", result)
+	}
+
+	// The merge is recorded in history
+	entries, err := a.Repo.ListHistory(context.Background(), repository.HistoryFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Stats == nil {
+		t.Fatalf("history = %+v, want one entry with stats", entries)
+	}
+
+	// Unless the request says otherwise
+	noHistory := map[string]any{"initial": mergeRequest["initial"], "response": mergeRequest["response"], "save_history": false}
+	if resp := a.Post("/api/merge", noHistory); resp.Code != http.StatusOK {
+		t.Fatalf("merge without history: status %d: %s", resp.Code, resp.Body.String())
+	}
+	if entries, _ := a.Repo.ListHistory(context.Background(), repository.HistoryFilter{}); len(entries) != 1 {
+		t.Errorf("history has %d entries after save_history=false, want 1", len(entries))
+	}
+
+	resp = a.Post("/api/merge", map[string]any{"initial": mergeRequest["initial"]})
+	if resp.Code != http.StatusUnprocessableEntity {
+		t.Errorf("merge without response: status %d, want 422: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestHistoryEndpoints(t *testing.T) {
+	a := apitest.New(t)
+	for range 2 {
+		if resp := a.Post("/api/merge", mergeRequest); resp.Code != http.StatusOK {
+			t.Fatalf("merge: status %d: %s", resp.Code, resp.Body.String())
+		}
+	}
+
+	resp := a.Get("/api/history")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("list history: status %d: %s", resp.Code, resp.Body.String())
+	}
+	list := apitest.Decode[[]api.HistoryListEntry](t, resp.Body.Bytes())
+	if len(list) != 2 {
+		t.Fatalf("history lists %d entries, want 2", len(list))
+	}
+	if list[0].ID < list[1].ID {
+		t.Errorf("history is not newest first: %d before %d", list[0].ID, list[1].ID)
+	}
+	if list[0].Result != nil || list[0].Domains != 1 || list[0].Certificates != 1 {
+		t.Errorf("history summary = %+v, want 1 domain and 1 certificate without data", list[0])
+	}
+
+	resp = a.Get(fmt.Sprintf("/api/history/%d", list[0].ID))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("get history: status %d: %s", resp.Code, resp.Body.String())
+	}
+	entry := apitest.Decode[models.HistoryEntry](t, resp.Body.Bytes())
+	if len(entry.Result.Data) != 1 || len(entry.Initial.Data) != 1 {
+		t.Errorf("history entry = %+v, want its initial and result data", entry)
+	}
+
+	resp = a.Get(fmt.Sprintf("/api/history/diff?a=%d&b=%d", list[1].ID, list[0].ID))
+	if resp.Code != http.StatusOK {
+		t.Errorf("diff history: status %d: %s", resp.Code, resp.Body.String())
+	}
+
+	if resp := a.Get("/api/history/999"); resp.Code != http.StatusNotFound {
+		t.Errorf("get missing history: status %d, want 404", resp.Code)
+	}
+}
+
+func TestConfigEndpoints(t *testing.T) {
+	a := apitest.New(t)
+
+	resp := a.Post("/api/configs", models.NSXConfig{Name: "lab", Host: "https://nsx.example.lab", Username: "admin", Password: "secret"})
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("create config: status %d: %s", resp.Code, resp.Body.String())
+	}
+	created := apitest.Decode[models.NSXConfig](t, resp.Body.Bytes())
+	if created.ID == 0 || created.CreatedAt.IsZero() {
+		t.Fatalf("created config = %+v, want an ID and creation time", created)
+	}
+
+	resp = a.Get("/api/configs")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("list configs: status %d: %s", resp.Code, resp.Body.String())
+	}
+	configs := apitest.Decode[[]models.NSXConfig](t, resp.Body.Bytes())
+	if len(configs) != 1 || configs[0].Name != "lab" || configs[0].Password != "" {
+		t.Errorf("configs = %+v, want lab without its password", configs)
+	}
+
+	path := fmt.Sprintf("/api/configs/%d", created.ID)
+	if resp := a.Get(path); resp.Code != http.StatusOK {
+		t.Fatalf("get config: status %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := a.Delete(path); resp.Code >= http.StatusBadRequest {
+		t.Fatalf("delete config: status %d: %s", resp.Code, resp.Body.String())
+	}
+	if resp := a.Get(path); resp.Code != http.StatusNotFound {
+		t.Errorf("get deleted config: status %d, want 404", resp.Code)
+	}
+	if resp := a.Delete(path); resp.Code != http.StatusNotFound {
+		t.Errorf("delete deleted config: status %d, want 404", resp.Code)
+	}
+
+	// A deleted config can still be purged
+	if resp := a.Delete(path + "/purge"); resp.Code >= http.StatusBadRequest {
+		t.Errorf("purge config: status %d: %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestConfigEndpointsTenant(t *testing.T) {
+	a := apitest.New(t)
+	ctx := repository.WithTenant(context.Background(), "team-a")
+	config, err := a.Repo.SaveConfig(ctx, &models.NSXConfig{Name: "lab", Host: "https://nsx.example.lab", Username: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests without a tenant see every tenant's configs
+	resp := a.Get(fmt.Sprintf("/api/configs/%d", config.ID))
+	if resp.Code != http.StatusOK {
+		t.Fatalf("get config: status %d: %s", resp.Code, resp.Body.String())
+	}
+	if got := apitest.Decode[models.NSXConfig](t, resp.Body.Bytes()); got.Tenant != "team-a" {
+		t.Errorf("config tenant = %q, want team-a", got.Tenant)
+	}
+
+	// A request scoped to another tenant does not
+	other := repository.WithTenant(context.Background(), "team-b")
+	if resp := a.GetCtx(other, fmt.Sprintf("/api/configs/%d", config.ID)); resp.Code != http.StatusNotFound {
+		t.Errorf("get config of another tenant: status %d, want 404", resp.Code)
+	}
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	responseSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		_ = json.NewEncoder(w).Encode(mergeRequest["response"])
+	}))
+	defer responseSrv.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	opts := api.DefaultOptions()
+	opts.InputSchemes = []string{"http"}
+	srv := api.NewServerWithOptions(addr, repository.NewMemory(), opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- srv.Start(ctx) }()
+
+	url := "http://" + addr
+	for i := 0; ; i++ {
+		resp, err := http.Get(url + "/api/health")
+		if err == nil {
+			_ = resp.Body.Close()
+			break
+		}
+		if i == 50 {
+			t.Fatalf("server not listening: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	merged := make(chan int, 1)
+	go func() {
+		body := fmt.Sprintf(`{"initial": [], "response_location": %q}`, responseSrv.URL+"/response.json")
+		resp, err := http.Post(url+"/api/merge", "application/json", strings.NewReader(body))
+		if err != nil {
+			merged <- 0
+			return
+		}
+		_ = resp.Body.Close()
+		merged <- resp.StatusCode
+	}()
+
+	// Stop the server while the merge waits for its response document
+	<-started
+	cancel()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Start returned with a merge in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := http.Get(url + "/api/health"); err == nil {
+		t.Error("Expected new connections to be refused while draining")
+	}
+
+	close(release)
+	if status := <-merged; status != http.StatusOK {
+		t.Errorf("merge in flight: status %d, want 200", status)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Start failed: %v", err)
+	}
+}
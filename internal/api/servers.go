@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+)
+
+// ServerListInput filters the server inventory
+type ServerListInput struct {
+	Domain  string `query:"domain" doc:"Only servers of this identity source (domain) ID" example:"example.lab"`
+	NSXHost string `query:"nsx_host" doc:"Only servers pulled from this NSX Manager" example:"https://nsx.example.com"`
+	Failing bool   `query:"failing" doc:"Only servers flagged as failing"`
+}
+
+// ServerListOutput is the response for the server inventory
+type ServerListOutput struct {
+	Body []models.InventoryServer
+}
+
+// ServerProbesInput selects the probe history of an inventory server
+type ServerProbesInput struct {
+	ID    int64 `path:"id" doc:"Inventory server ID"`
+	Limit int   `query:"limit" default:"100" minimum:"1" maximum:"1000" doc:"Maximum number of entries"`
+}
+
+// ServerProbesOutput is the probe history of an inventory server
+type ServerProbesOutput struct {
+	Body []models.ProbeRecord
+}
+
+func (s *Server) handleListServers(ctx context.Context, input *ServerListInput) (*ServerListOutput, error) {
+	if s.repo == nil {
+		return &ServerListOutput{Body: []models.InventoryServer{}}, nil
+	}
+
+	servers, err := s.repo.ListServers(ctx)
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to list servers", err)
+	}
+	hosts, err := s.tenantHosts(ctx)
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to list configs", err)
+	}
+
+	filtered := make([]models.InventoryServer, 0, len(servers))
+	for _, server := range servers {
+		server.Failing = s.isFailing(&server)
+		if hosts != nil && !hosts[server.NSXHost] {
+			continue
+		}
+		if input.Domain != "" && server.DomainID != input.Domain {
+			continue
+		}
+		if input.NSXHost != "" && server.NSXHost != input.NSXHost {
+			continue
+		}
+		if input.Failing && !server.Failing {
+			continue
+		}
+		filtered = append(filtered, server)
+	}
+
+	return &ServerListOutput{Body: filtered}, nil
+}
+
+func (s *Server) handleListServerProbes(ctx context.Context, input *ServerProbesInput) (*ServerProbesOutput, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "inventory not available")
+	}
+
+	server, err := s.repo.GetServer(ctx, input.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apiError(http.StatusNotFound, CodeNotFound, "server not found")
+		}
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to load server", err)
+	}
+	hosts, err := s.tenantHosts(ctx)
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to list configs", err)
+	}
+	if hosts != nil && !hosts[server.NSXHost] {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "server not found")
+	}
+
+	probes, err := s.repo.ListProbes(ctx, input.ID, input.Limit)
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to list probes", err)
+	}
+	if probes == nil {
+		probes = []models.ProbeRecord{}
+	}
+
+	return &ServerProbesOutput{Body: probes}, nil
+}
+
+// tenantHosts returns the NSX Managers of the configurations of the tenant
+// of ctx, whose inventory servers requests of that tenant see; nil without
+// a tenant, as every server is seen.
+func (s *Server) tenantHosts(ctx context.Context) (map[string]bool, error) {
+	if _, ok := repository.TenantFrom(ctx); !ok {
+		return nil, nil
+	}
+	configs, err := s.repo.ListConfigs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make(map[string]bool, len(configs))
+	for _, c := range configs {
+		hosts[c.Host] = true
+	}
+	return hosts, nil
+}
+
+// isFailing reports whether server reached the consecutive probe failure threshold
+func (s *Server) isFailing(server *models.InventoryServer) bool {
+	return s.probeFailureThreshold > 0 && server.ConsecutiveFailures >= s.probeFailureThreshold
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"ldapmerge/internal/models"
+)
+
+func TestListServers(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	domains := []models.Domain{
+		{ID: "example.lab", LDAPServers: []models.LDAPServer{
+			{URL: "ldaps://ad-01.example.lab:636", Enabled: "true"},
+			{URL: "ldaps://ad-02.example.lab:636", Enabled: "false"},
+		}},
+		{ID: "example.org", LDAPServers: []models.LDAPServer{
+			{URL: "ldaps://dc01.example.org:636", Enabled: "true"},
+		}},
+	}
+	if _, err := repo.UpdateInventory(ctx, "https://nsx.example.com", domains); err != nil {
+		t.Fatalf("UpdateInventory failed: %v", err)
+	}
+
+	get := func(path string) []models.InventoryServer {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var servers []models.InventoryServer
+		if err := json.Unmarshal(rec.Body.Bytes(), &servers); err != nil {
+			t.Fatalf("Failed to decode servers: %v", err)
+		}
+		return servers
+	}
+
+	if servers := get("/api/servers"); len(servers) != 3 {
+		t.Errorf("Expected 3 servers, got %d", len(servers))
+	}
+
+	servers := get("/api/servers?domain=example.lab")
+	if len(servers) != 2 {
+		t.Fatalf("Expected 2 servers for example.lab, got %d", len(servers))
+	}
+	if servers[1].Enabled {
+		t.Errorf("Expected %s to be disabled", servers[1].URL)
+	}
+
+	if servers := get("/api/servers?nsx_host=https://other.example.com"); len(servers) != 0 {
+		t.Errorf("Expected no servers for unknown NSX host, got %d", len(servers))
+	}
+}
+
+func TestServerProbes(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	url := "ldaps://ad-01.example.lab:636"
+	domains := []models.Domain{{ID: "example.lab", LDAPServers: []models.LDAPServer{{URL: url, Enabled: "true"}}}}
+	if _, err := repo.UpdateInventory(ctx, "https://nsx.example.com", domains); err != nil {
+		t.Fatalf("UpdateInventory failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := repo.RecordProbe(ctx, "https://nsx.example.com", url, false, "connection refused"); err != nil {
+			t.Fatalf("RecordProbe failed: %v", err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/servers?failing=true", nil))
+	var servers []models.InventoryServer
+	if err := json.Unmarshal(rec.Body.Bytes(), &servers); err != nil {
+		t.Fatalf("Failed to decode servers: %v", err)
+	}
+	if len(servers) != 1 || !servers[0].Failing || servers[0].ConsecutiveFailures != 3 {
+		t.Fatalf("Expected one failing server after 3 failed probes, got %+v", servers)
+	}
+	if servers[0].Uptime == nil || *servers[0].Uptime != 0 {
+		t.Errorf("Expected 0%% uptime, got %v", servers[0].Uptime)
+	}
+
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/servers/"+strconv.FormatInt(servers[0].ID, 10)+"/probes?limit=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var probes []models.ProbeRecord
+	if err := json.Unmarshal(rec.Body.Bytes(), &probes); err != nil {
+		t.Fatalf("Failed to decode probes: %v", err)
+	}
+	if len(probes) != 2 || probes[0].Success || probes[0].Error != "connection refused" {
+		t.Errorf("Expected 2 failed probes, got %+v", probes)
+	}
+
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/servers/999/probes", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown server, got %d", rec.Code)
+	}
+}
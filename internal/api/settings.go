@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ldapmerge/internal/logging"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/prober"
+	"ldapmerge/internal/repository"
+)
+
+// Keys of the runtime settings stored by PATCH /api/admin/settings.
+const (
+	settingLogLevel       = "log_level"
+	settingProbeRetention = "probe_retention"
+	settingProbesPaused   = "probes_paused"
+)
+
+// Settings are the runtime settings of the server
+type Settings struct {
+	LogLevel       string     `json:"log_level" enum:"debug,info,warn,error" doc:"Level of the server's log" example:"info"`
+	ProbeRetention string     `json:"probe_retention" doc:"How long probe history is kept, as a Go duration; 0s keeps it forever" example:"720h0m0s"`
+	ProbesPaused   bool       `json:"probes_paused" doc:"Whether scheduled probe rounds are skipped"`
+	ProbesRunning  bool       `json:"probes_running" doc:"Whether the server runs scheduled probes (--probe-interval); set at startup" example:"true"`
+	DatabasePath   string     `json:"database_path,omitempty" doc:"Database file path; set at startup" example:"/home/user/.config/ldapmerge/data.db"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty" doc:"Time of the last change through the API" format:"date-time"`
+	UpdatedBy      string     `json:"updated_by,omitempty" doc:"Caller of the last change through the API" example:"ops"`
+}
+
+// SettingsOutput is the response for the runtime settings
+type SettingsOutput struct {
+	Body Settings
+}
+
+// SettingsPatchInput is the request for changing runtime settings; omitted
+// settings are left as they are
+type SettingsPatchInput struct {
+	Body struct {
+		LogLevel       *string `json:"log_level,omitempty" enum:"debug,info,warn,error" doc:"Level of the server's log"`
+		ProbeRetention *string `json:"probe_retention,omitempty" doc:"How long probe history is kept, as a Go duration such as 168h; 0s keeps it forever" example:"168h"`
+		ProbesPaused   *bool   `json:"probes_paused,omitempty" doc:"Skip scheduled probe rounds until set back to false"`
+	}
+}
+
+// requireAdmin refuses the requests made with a key or token bound to a
+// tenant, or with a client certificate not mapped to a key without one, to
+// what, which spans the whole server: settings or the audit log.
+func requireAdmin(ctx context.Context, what string) error {
+	if _, ok := repository.TenantFrom(ctx); ok {
+		return apiError(http.StatusForbidden, CodeForbidden, what+" require a key or token without a tenant")
+	}
+	return nil
+}
+
+func (s *Server) handleGetSettings(ctx context.Context, _ *struct{}) (*SettingsOutput, error) {
+	if err := requireAdmin(ctx, "server settings"); err != nil {
+		return nil, err
+	}
+
+	settings, err := s.settings(ctx)
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to load settings", err)
+	}
+	return &SettingsOutput{Body: *settings}, nil
+}
+
+func (s *Server) handleUpdateSettings(ctx context.Context, input *SettingsPatchInput) (*SettingsOutput, error) {
+	if err := requireAdmin(ctx, "server settings"); err != nil {
+		return nil, err
+	}
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "settings not available")
+	}
+
+	var changes []models.Setting
+	if v := input.Body.LogLevel; v != nil {
+		level, err := parseLevel(*v)
+		if err != nil {
+			return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error())
+		}
+		changes = append(changes, models.Setting{Key: settingLogLevel, Value: formatLevel(level)})
+	}
+	if v := input.Body.ProbeRetention; v != nil {
+		retention, err := parseRetention(*v)
+		if err != nil {
+			return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error())
+		}
+		changes = append(changes, models.Setting{Key: settingProbeRetention, Value: retention.String()})
+	}
+	if v := input.Body.ProbesPaused; v != nil {
+		changes = append(changes, models.Setting{Key: settingProbesPaused, Value: strconv.FormatBool(*v)})
+	}
+
+	if len(changes) > 0 {
+		for i := range changes {
+			changes[i].UpdatedBy = caller(ctx)
+		}
+		if err := s.repo.SaveSettings(ctx, changes); err != nil {
+			return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to save settings", err)
+		}
+
+		log := logging.RunLogger(ctx)
+		for _, setting := range changes {
+			if err := s.applySetting(setting); err != nil {
+				// Validated above
+				return nil, apiError(http.StatusInternalServerError, CodeInternal, "failed to apply settings", err)
+			}
+			log.Info("server setting changed", "setting", setting.Key, "value", setting.Value, "actor", setting.UpdatedBy)
+		}
+	}
+
+	return s.handleGetSettings(ctx, nil)
+}
+
+// LoadSettings applies the settings stored through PATCH
+// /api/admin/settings, so that they survive restarts. Stored values that
+// are no longer valid are logged and skipped. Without a repository there
+// is nothing to load.
+func (s *Server) LoadSettings(ctx context.Context) error {
+	if s.repo == nil {
+		return nil
+	}
+
+	stored, err := s.repo.ListSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+	for _, setting := range stored {
+		if err := s.applySetting(setting); err != nil {
+			slog.WarnContext(ctx, "stored setting ignored", "setting", setting.Key, "value", setting.Value, "error", err)
+			continue
+		}
+		slog.InfoContext(ctx, "stored setting applied", "setting", setting.Key, "value", setting.Value,
+			"updated_at", setting.UpdatedAt, "updated_by", setting.UpdatedBy)
+	}
+	return nil
+}
+
+// applySetting applies a validated setting to the running server. The
+// probe settings of a server without scheduled probes are only stored.
+func (s *Server) applySetting(setting models.Setting) error {
+	switch setting.Key {
+	case settingLogLevel:
+		level, err := parseLevel(setting.Value)
+		if err != nil {
+			return err
+		}
+		s.logLevel.Set(level)
+	case settingProbeRetention:
+		retention, err := parseRetention(setting.Value)
+		if err != nil {
+			return err
+		}
+		if s.prober != nil {
+			s.prober.SetRetention(retention)
+		}
+	case settingProbesPaused:
+		paused, err := strconv.ParseBool(setting.Value)
+		if err != nil {
+			return err
+		}
+		if s.prober != nil {
+			s.prober.SetPaused(paused)
+		}
+	default:
+		return fmt.Errorf("unknown setting %q", setting.Key)
+	}
+	return nil
+}
+
+// settings returns the current runtime settings: those of the running
+// server, and the stored ones for the probe settings of a server without
+// scheduled probes.
+func (s *Server) settings(ctx context.Context) (*Settings, error) {
+	settings := &Settings{
+		LogLevel:       formatLevel(s.logLevel.Level()),
+		ProbeRetention: prober.DefaultOptions().Retention.String(),
+		ProbesRunning:  s.prober != nil,
+	}
+	if s.prober != nil {
+		status := s.prober.Status()
+		settings.ProbeRetention = status.Retention.String()
+		settings.ProbesPaused = status.Paused
+	}
+	if s.repo == nil {
+		return settings, nil
+	}
+
+	if info, err := s.repo.GetDBInfo(ctx); err == nil {
+		settings.DatabasePath = info.Path
+	}
+	stored, err := s.repo.ListSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, setting := range stored {
+		if s.prober == nil {
+			switch setting.Key {
+			case settingProbeRetention:
+				settings.ProbeRetention = setting.Value
+			case settingProbesPaused:
+				settings.ProbesPaused, _ = strconv.ParseBool(setting.Value)
+			}
+		}
+		if settings.UpdatedAt == nil || setting.UpdatedAt.After(*settings.UpdatedAt) {
+			settings.UpdatedAt = &setting.UpdatedAt
+			settings.UpdatedBy = setting.UpdatedBy
+		}
+	}
+	return settings, nil
+}
+
+// parseLevel parses a log level: debug, info, warn or error.
+func parseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: use debug, info, warn or error", s)
+	}
+	return level, nil
+}
+
+// formatLevel formats level as parsed by parseLevel.
+func formatLevel(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
+
+// parseRetention parses a probe retention: a Go duration, zero or positive.
+func parseRetention(s string) (time.Duration, error) {
+	retention, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid probe retention %q: %w", s, err)
+	}
+	if retention < 0 {
+		return 0, fmt.Errorf("invalid probe retention %q: must not be negative", s)
+	}
+	return retention, nil
+}
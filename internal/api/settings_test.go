@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/prober"
+	"ldapmerge/internal/repository"
+)
+
+func TestSettings(t *testing.T) {
+	repo, err := repository.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+
+	level := new(slog.LevelVar)
+	probes := prober.New(repo, prober.DefaultOptions())
+	opts := DefaultOptions()
+	opts.Prober = probes
+	opts.LogLevel = level
+	opts.APIKeys = []APIKey{
+		{Name: "ops", Key: "ops-key-0123456789"},
+		{Name: "red", Key: "red-key-0123456789", Tenant: "red"},
+	}
+	s := NewServerWithOptions(":0", repo, opts)
+
+	do := func(method, key, body string) (*httptest.ResponseRecorder, Settings) {
+		t.Helper()
+		req := httptest.NewRequest(method, "/api/admin/settings", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+
+		var settings Settings
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &settings); err != nil {
+				t.Fatalf("Failed to decode settings: %v", err)
+			}
+		}
+		return rec, settings
+	}
+
+	rec, settings := do(http.MethodGet, "ops-key-0123456789", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if settings.LogLevel != "info" || settings.ProbeRetention != "720h0m0s" || settings.ProbesPaused ||
+		!settings.ProbesRunning || settings.DatabasePath == "" || settings.UpdatedAt != nil {
+		t.Errorf("Unexpected initial settings %+v", settings)
+	}
+
+	// Settings apply to the whole server
+	for _, method := range []string{http.MethodGet, http.MethodPatch} {
+		rec, _ := do(method, "red-key-0123456789", `{"probes_paused": true}`)
+		var body ErrorModel
+		_ = json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != http.StatusForbidden || body.Code != CodeForbidden {
+			t.Errorf("%s with a tenant key: expected 403 %s, got %d: %s", method, CodeForbidden, rec.Code, rec.Body.String())
+		}
+	}
+	if probes.Status().Paused {
+		t.Fatal("Expected the tenant key not to pause probes")
+	}
+
+	for _, body := range []string{`{"log_level": "trace"}`, `{"probe_retention": "a week"}`, `{"probe_retention": "-1h"}`} {
+		if rec, _ := do(http.MethodPatch, "ops-key-0123456789", body); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("PATCH %s: expected 422, got %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec, settings = do(http.MethodPatch, "ops-key-0123456789", `{"log_level": "debug", "probe_retention": "168h", "probes_paused": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if settings.LogLevel != "debug" || settings.ProbeRetention != "168h0m0s" || !settings.ProbesPaused ||
+		settings.UpdatedAt == nil || settings.UpdatedBy != "ops" {
+		t.Errorf("Unexpected settings after the change %+v", settings)
+	}
+	status := probes.Status()
+	if level.Level() != slog.LevelDebug || !status.Paused || status.Retention != 168*time.Hour {
+		t.Errorf("Expected the settings applied, got level %s and prober %+v", level.Level(), status)
+	}
+
+	// A restarted server applies the stored settings
+	restartedLevel := new(slog.LevelVar)
+	restartedProbes := prober.New(repo, prober.DefaultOptions())
+	opts.Prober = restartedProbes
+	opts.LogLevel = restartedLevel
+	if err := NewServerWithOptions(":0", repo, opts).LoadSettings(context.Background()); err != nil {
+		t.Fatalf("LoadSettings failed: %v", err)
+	}
+	status = restartedProbes.Status()
+	if restartedLevel.Level() != slog.LevelDebug || !status.Paused || status.Retention != 168*time.Hour {
+		t.Errorf("Expected the stored settings applied, got level %s and prober %+v", restartedLevel.Level(), status)
+	}
+}
+
+func TestSettingsWithoutProber(t *testing.T) {
+	s := NewServer(":0", repository.NewMemory())
+
+	patch := httptest.NewRequest(http.MethodPatch, "/api/admin/settings", strings.NewReader(`{"probes_paused": true, "probe_retention": "24h"}`))
+	patch.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, patch)
+
+	var settings Settings
+	if err := json.Unmarshal(rec.Body.Bytes(), &settings); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if settings.ProbesRunning || !settings.ProbesPaused || settings.ProbeRetention != "24h0m0s" {
+		t.Errorf("Expected the stored probe settings, got %+v", settings)
+	}
+}
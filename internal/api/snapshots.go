@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/credentials"
+	"ldapmerge/internal/logging"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+)
+
+// SnapshotListInput is the request for the snapshot list
+type SnapshotListInput struct {
+	Limit int `query:"limit" minimum:"1" maximum:"1000" default:"100" doc:"Maximum number of snapshots to return"`
+}
+
+// SnapshotListOutput is the response for the snapshot list
+type SnapshotListOutput struct {
+	Body []models.Snapshot
+}
+
+// SnapshotPathInput is the path parameter for snapshot
+type SnapshotPathInput struct {
+	ID int64 `path:"id" doc:"Snapshot ID"`
+}
+
+// SnapshotOutput is the response for single snapshot
+type SnapshotOutput struct {
+	Body models.Snapshot
+}
+
+// SnapshotRestoreInput is the request for restoring a snapshot to NSX
+type SnapshotRestoreInput struct {
+	ID   int64 `path:"id" doc:"Snapshot ID"`
+	Body struct {
+		ConfigID       int64  `json:"config_id" doc:"ID of the saved NSX configuration of the NSX Manager the snapshot was taken on" example:"1"`
+		Reason         string `json:"reason" minLength:"1" maxLength:"1000" doc:"Justification for the change, stored in the audit log" example:"CHG-1236: roll back failed certificate renewal"`
+		ForceProtected bool   `json:"force_protected,omitempty" doc:"Allow changes to identity sources matching the server's protected_sources patterns"`
+	}
+}
+
+func (s *Server) handleListSnapshots(ctx context.Context, input *SnapshotListInput) (*SnapshotListOutput, error) {
+	if s.repo == nil {
+		return &SnapshotListOutput{Body: []models.Snapshot{}}, nil
+	}
+
+	snapshots, err := s.repo.ListSnapshots(ctx, input.Limit)
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to list snapshots", err)
+	}
+
+	return &SnapshotListOutput{Body: snapshots}, nil
+}
+
+func (s *Server) handleGetSnapshot(ctx context.Context, input *SnapshotPathInput) (*SnapshotOutput, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "snapshots not available")
+	}
+
+	snapshot, err := s.repo.GetSnapshot(ctx, input.ID)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "snapshot not found")
+	}
+
+	return &SnapshotOutput{Body: *snapshot}, nil
+}
+
+func (s *Server) handleRestoreSnapshot(ctx context.Context, input *SnapshotRestoreInput) (*PushOutput, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "snapshots not available")
+	}
+	if err := audit.CheckReason(input.Body.Reason); err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error())
+	}
+
+	snapshot, err := s.repo.GetSnapshot(ctx, input.ID)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "snapshot not found")
+	}
+
+	config, err := s.repo.GetConfig(ctx, input.Body.ConfigID)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "config not found")
+	}
+	if !nsx.SameHost(snapshot.NSXHost, config.Host) {
+		return nil, apiError(http.StatusConflict, CodeConflict,
+			fmt.Sprintf("snapshot %d was taken on %s, not on %s", snapshot.ID, snapshot.NSXHost, config.Host))
+	}
+
+	log := logging.RunLogger(ctx).With("snapshot_id", snapshot.ID, "config_id", config.ID, "nsx_host", config.Host)
+	log.Info("restoring snapshot to NSX", "sources_count", len(snapshot.Sources))
+
+	event := newPushEvent(audit.OperationSnapshotRestore, config, nil, input.Body.Reason)
+	for _, source := range snapshot.Sources {
+		event.SourceIDs = append(event.SourceIDs, source.ID)
+	}
+	if err := s.checkProtected(ctx, log, event, input.Body.ForceProtected); err != nil {
+		return nil, err
+	}
+
+	// The restore is itself a change that can be rolled back
+	client := s.newNSXClient(config)
+	before, err := s.saveSnapshot(ctx, log, client, event, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := restoreSources(ctx, log, client, config, snapshot.Sources, s.bindPasswords, s.realization)
+	if output != nil {
+		output.Body.SnapshotID = before.ID
+	}
+	s.recordPush(ctx, log, event, output, err)
+	return output, err
+}
+
+// restoreSources puts snapshotted sources back on the NSX Manager of config
+// through client, waiting for NSX to realize those it puts back. Snapshots
+// hold no bind passwords, as NSX does not return them; missing ones are set
+// from passwords. Errors are handled as in pushDomains.
+func restoreSources(ctx context.Context, log *slog.Logger, client *nsx.Client, config *models.NSXConfig, sources []models.SnapshotSource, passwords *credentials.BindPasswords, wait nsx.RealizationWait) (*PushOutput, error) {
+	output := &PushOutput{}
+	output.Body.ConfigID = config.ID
+	output.Body.Host = config.Host
+	output.Body.Results = []PushSourceResult{}
+
+	sources = slices.Clone(sources)
+	var missing []string
+	for i, source := range sources {
+		if !source.Existed {
+			continue
+		}
+		doc, urls, err := passwords.InjectDocument(source.Source)
+		if err != nil {
+			return nil, apiError(http.StatusInternalServerError, CodeInternal, "invalid snapshot of "+source.ID, err)
+		}
+		sources[i].Source = doc
+		missing = append(missing, urls...)
+	}
+	output.Body.MissingBindPasswords = missingBindPasswords(log, missing)
+
+	for _, source := range sources {
+		start := time.Now()
+		err := client.RestoreLDAPIdentitySource(ctx, source)
+		if err == nil && source.Existed {
+			err = client.WaitRealized(ctx, source.ID, wait)
+		}
+		if err != nil {
+			if se := nsxError(err); se != nil {
+				log.Error("restore aborted", "source_id", source.ID, "error", err)
+				return nil, se
+			}
+
+			log.Error("failed to restore source", "source_id", source.ID, "error", err, "duration", time.Since(start))
+			output.Body.Results = append(output.Body.Results, PushSourceResult{ID: source.ID, Error: err.Error()})
+			output.Body.Failed++
+			continue
+		}
+
+		log.Info("source restored", "source_id", source.ID, "existed", source.Existed, "duration", time.Since(start))
+		output.Body.Results = append(output.Body.Results, PushSourceResult{ID: source.ID, Success: true})
+		output.Body.Succeeded++
+	}
+
+	log.Info("restore completed", "success_count", output.Body.Succeeded, "error_count", output.Body.Failed)
+	return output, nil
+}
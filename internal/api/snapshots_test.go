@@ -0,0 +1,117 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx/mock"
+)
+
+func TestRestoreSnapshot(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	mockServer := mock.NewServer()
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	config, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "mock", Host: ts.URL, Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	other, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "other", Host: "https://nsx.other.lab", Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	// Push a changed example.lab and a new source from history
+	entry, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, []models.Domain{
+		{ID: "example.lab", DomainName: "example.lab", BaseDN: "DC=changed"},
+		{ID: "new.lab", DomainName: "new.lab"},
+	})
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/api/history/"+strconv.FormatInt(entry.ID, 10)+"/push",
+		`{"config_id": `+strconv.FormatInt(config.ID, 10)+`, "reason": "CHG-1"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected push to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var pushed PushOutput
+	if err := json.Unmarshal(rec.Body.Bytes(), &pushed.Body); err != nil {
+		t.Fatalf("Failed to decode push response: %v", err)
+	}
+	if mockServer.GetSources()["example.lab"].BaseDN != "DC=changed" {
+		t.Fatal("Expected example.lab to be changed by the push")
+	}
+
+	// The list omits documents, get includes them
+	rec = do(http.MethodGet, "/api/snapshots", "")
+	var list []models.Snapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to decode list: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != pushed.Body.SnapshotID || len(list[0].Sources) != 2 || list[0].Sources[0].Source != nil {
+		t.Fatalf("Expected one snapshot without documents, got %s", rec.Body.String())
+	}
+	rec = do(http.MethodGet, "/api/snapshots/"+strconv.FormatInt(pushed.Body.SnapshotID, 10), "")
+	var snapshot models.Snapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("Failed to decode snapshot: %v", err)
+	}
+	if len(snapshot.Sources) != 2 || !snapshot.Sources[0].Existed || snapshot.Sources[0].Source == nil || snapshot.Sources[1].Existed {
+		t.Fatalf("Unexpected snapshot %s", rec.Body.String())
+	}
+
+	restore := func(configID int64, reason string) *httptest.ResponseRecorder {
+		return do(http.MethodPost, "/api/snapshots/"+strconv.FormatInt(snapshot.ID, 10)+"/restore",
+			`{"config_id": `+strconv.FormatInt(configID, 10)+`, "reason": `+strconv.Quote(reason)+`}`)
+	}
+
+	if rec = restore(config.ID, " "); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for a blank reason, got %d", rec.Code)
+	}
+	if rec = restore(other.ID, "CHG-2"); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for another NSX Manager, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = restore(config.ID, "CHG-2")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected restore to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var restored PushOutput
+	if err := json.Unmarshal(rec.Body.Bytes(), &restored.Body); err != nil {
+		t.Fatalf("Failed to decode restore response: %v", err)
+	}
+	if restored.Body.Succeeded != 2 || restored.Body.SnapshotID == snapshot.ID {
+		t.Errorf("Expected 2 restored sources and a new snapshot, got %s", rec.Body.String())
+	}
+
+	sources := mockServer.GetSources()
+	if sources["example.lab"].BaseDN == "DC=changed" {
+		t.Error("Expected example.lab to be restored")
+	}
+	if _, ok := sources["new.lab"]; ok {
+		t.Error("Expected new.lab, absent before the push, to be deleted")
+	}
+
+	events := changeEvents(t, repo)
+	if e := events[0]; e.Operation != "snapshot.restore" || e.Reason != "CHG-2" || e.Outcome != "success" || len(e.SourceIDs) != 2 {
+		t.Errorf("Unexpected audit event %+v", e)
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/uptrace/bunrouter"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/prober"
+	"ldapmerge/internal/repository"
+	"ldapmerge/internal/version"
+)
+
+// statusExpiryDays is the default certificate expiry warning window of /status
+const statusExpiryDays = 30
+
+// statusHistoryLimit is the number of history entries shown on /status
+const statusHistoryLimit = 10
+
+//go:embed status.html
+var statusHTML string
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"datetime": func(t time.Time) string {
+		if t.IsZero() {
+			return "—"
+		}
+		return t.UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+	"percent": func(f float64) string {
+		return strconv.FormatFloat(f*100, 'f', 0, 64) + "%"
+	},
+}).Parse(statusHTML))
+
+// statusPage is the data rendered by the /status template
+type statusPage struct {
+	Version       string
+	GeneratedAt   time.Time
+	Database      *repository.DBInfo
+	DatabaseError string
+	Scheduler     *prober.Status
+	ExpiryDays    int
+	Expiring      []certificateWarning
+	Failing       []models.InventoryServer
+	History       []models.HistorySummary
+	HistoryError  string
+	Inventory     int
+}
+
+// certificateWarning is an inventory certificate expiring within the window
+type certificateWarning struct {
+	Server  models.InventoryServer
+	Days    int
+	Expired bool
+}
+
+// handleStatus renders the operator status page. It never fails as a whole:
+// sections whose data cannot be loaded show the error instead.
+func (s *Server) handleStatus(w http.ResponseWriter, r bunrouter.Request) error {
+	ctx := r.Context()
+
+	page := statusPage{
+		Version:     version.Short(),
+		GeneratedAt: time.Now(),
+		ExpiryDays:  statusExpiryDays,
+	}
+	if days, err := strconv.Atoi(r.URL.Query().Get("days")); err == nil && days > 0 {
+		page.ExpiryDays = days
+	}
+
+	if s.prober != nil {
+		status := s.prober.Status()
+		page.Scheduler = &status
+	}
+
+	if s.repo == nil {
+		page.DatabaseError = "server runs without a database"
+	} else {
+		if info, err := s.repo.GetDBInfo(ctx); err != nil {
+			page.DatabaseError = err.Error()
+		} else {
+			page.Database = info
+		}
+
+		// Requests of a tenant see the servers of its NSX Managers
+		hosts, err := s.tenantHosts(ctx)
+		var servers []models.InventoryServer
+		if err == nil {
+			servers, err = s.repo.ListServers(ctx)
+		}
+		if err != nil {
+			page.DatabaseError = fmt.Sprintf("failed to list servers: %v", err)
+		} else {
+			if hosts != nil {
+				servers = slices.DeleteFunc(servers, func(server models.InventoryServer) bool { return !hosts[server.NSXHost] })
+			}
+			page.Inventory = len(servers)
+			page.Expiring, page.Failing = s.statusWarnings(servers, page.GeneratedAt, page.ExpiryDays)
+		}
+
+		if summaries, err := s.repo.ListHistorySummaries(ctx, repository.HistoryFilter{Limit: statusHistoryLimit}); err != nil {
+			page.HistoryError = err.Error()
+		} else {
+			page.History = summaries
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := statusTemplate.Execute(&buf, page); err != nil {
+		slog.Error("failed to render status page", "error", err)
+		http.Error(w, "failed to render status page", http.StatusInternalServerError)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// statusWarnings returns certificates expiring within days of now, soonest
+// first, and servers flagged as failing.
+func (s *Server) statusWarnings(servers []models.InventoryServer, now time.Time, days int) ([]certificateWarning, []models.InventoryServer) {
+	var expiring []certificateWarning
+	var failing []models.InventoryServer
+
+	limit := now.Add(time.Duration(days) * 24 * time.Hour)
+	for _, server := range servers {
+		if server.CertExpiresAt != nil && server.CertExpiresAt.Before(limit) {
+			remaining := server.CertExpiresAt.Sub(now)
+			expiring = append(expiring, certificateWarning{
+				Server:  server,
+				Days:    int(remaining.Hours() / 24),
+				Expired: remaining <= 0,
+			})
+		}
+		if s.isFailing(&server) {
+			server.Failing = true
+			failing = append(failing, server)
+		}
+	}
+
+	sort.Slice(expiring, func(i, j int) bool {
+		return expiring[i].Server.CertExpiresAt.Before(*expiring[j].Server.CertExpiresAt)
+	})
+	return expiring, failing
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/features"
+	"ldapmerge/internal/models"
+)
+
+func TestStatusPage(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	domains := []models.Domain{{ID: "example.lab", LDAPServers: []models.LDAPServer{
+		{URL: "ldaps://ad-01.example.lab:636", Certificates: []string{testCertificate(t, "ad-01.example.lab", time.Now().Add(5*24*time.Hour))}},
+		{URL: "ldaps://ad-02.example.lab:636", Certificates: []string{testCertificate(t, "ad-02.example.lab", time.Now().Add(400*24*time.Hour))}},
+	}}}
+	if _, err := repo.UpdateInventory(ctx, "https://nsx.example.com", domains); err != nil {
+		t.Fatalf("UpdateInventory failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := repo.RecordProbe(ctx, "https://nsx.example.com", "ldaps://ad-02.example.lab:636", false, "connection <refused>"); err != nil {
+			t.Fatalf("RecordProbe failed: %v", err)
+		}
+	}
+	stats := &models.MergeStats{DurationMS: 1.5, MatchRatio: 0.5}
+	if _, err := repo.SaveHistoryWithStats(ctx, nil, models.CertificateResponse{}, domains, stats); err != nil {
+		t.Fatalf("SaveHistoryWithStats failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected HTML content type, got %q", ct)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"ad-01.example.lab</td>",
+		"<span class=\"bad\">4 days</span>",
+		"connection &lt;refused&gt;",
+		"Start the server with <code>--probe-interval</code>",
+		"50%",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected status page to contain %q", want)
+		}
+	}
+	if strings.Contains(body, "ad-02.example.lab</td>") {
+		t.Error("Expected certificate expiring in 400 days not to be listed")
+	}
+	if strings.Contains(body, "<script") || strings.Contains(body, "stylesheet") {
+		t.Error("Expected status page without external assets")
+	}
+}
+
+func TestWebUIDisabled(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Features = features.Set{features.WebUI: false}
+	s := NewServerWithOptions(":0", nil, opts)
+
+	for _, path := range []string{"/status", "/docs"} {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status 404 without the web UI, got %d", path, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the OpenAPI document without the web UI, got %d", rec.Code)
+	}
+}
+
+func TestReady(t *testing.T) {
+	s, repo := setupTestServer(t)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ok":true`) {
+		t.Fatalf("Expected a ready database, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// A closed repository is not reopened
+	_ = repo.Close()
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), string(CodeDatabase)) {
+		t.Errorf("Expected 503 with %s, got %d: %s", CodeDatabase, rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,351 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/danielgtaylor/huma/v2"
+
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+)
+
+// ndjsonContentType is the media type of newline-delimited JSON
+const ndjsonContentType = "application/x-ndjson"
+
+// mergeStreamMaxLine bounds a single NDJSON line, i.e. one domain with its
+// certificate results
+const mergeStreamMaxLine = 32 << 20
+
+// MergeStreamUnit is one line of a POST /api/merge/stream request: a domain
+// and the certificate results for its servers. The first line may instead
+// carry only options and save_history, which then apply to the whole stream.
+type MergeStreamUnit struct {
+	Domain      *models.Domain              `json:"domain,omitempty" doc:"Initial domain configuration"`
+	Response    *models.CertificateResponse `json:"response,omitempty" doc:"Certificate results for the domain's servers"`
+	Options     *MergeOptionsInput          `json:"options,omitempty" doc:"Stream options; first line only"`
+	SaveHistory *bool                       `json:"save_history,omitempty" doc:"Record the stream as one history entry (default true); first line only"`
+}
+
+// MergeStreamResult is one line of a POST /api/merge/stream response: the
+// merged domain or the error of one input line, or the final summary.
+type MergeStreamResult struct {
+	Line    int                 `json:"line,omitempty" doc:"Input line number, starting at 1"`
+	Domain  *models.Domain      `json:"domain,omitempty" doc:"Merged domain"`
+	Stats   *models.MergeStats  `json:"stats,omitempty" doc:"Merge statistics of the line"`
+	Error   *ErrorModel         `json:"error,omitempty" doc:"Why the line was not merged"`
+	Summary *MergeStreamSummary `json:"summary,omitempty" doc:"Last line of the response"`
+}
+
+// MergeStreamSummary closes a streaming merge response
+type MergeStreamSummary struct {
+	Merged    int                `json:"merged" doc:"Number of merged domains" example:"120"`
+	Failed    int                `json:"failed" doc:"Number of lines that failed" example:"0"`
+	Stats     *models.MergeStats `json:"stats,omitempty" doc:"Merge statistics of the whole stream"`
+	HistoryID int64              `json:"history_id,omitempty" doc:"ID of the saved history entry" example:"42"`
+}
+
+// MergeStreamInput gives the handler the raw request body, which huma would
+// otherwise read whole before calling it.
+type MergeStreamInput struct {
+	body io.Reader
+}
+
+// Resolve implements huma.Resolver.
+func (i *MergeStreamInput) Resolve(ctx huma.Context) []error {
+	i.body = ctx.BodyReader()
+	return nil
+}
+
+// mergeStreamOperation describes POST /api/merge/stream; request and response
+// schemas are set by hand because both are NDJSON.
+func mergeStreamOperation(registry huma.Registry) huma.Operation {
+	return huma.Operation{
+		OperationID: "mergeStream",
+		Method:      http.MethodPost,
+		Path:        "/api/merge/stream",
+		Summary:     "Merge a stream of domains",
+		Description: `Merges newline-delimited JSON (NDJSON) one domain at a time and streams the
+results back as each line completes, so very large configurations need
+neither a single request document nor a single response document.
+
+## Request Body
+
+Each line is a merge unit:
+
+` + "```" + `
+{"domain": {...}, "response": {"results": [...]}}
+` + "```" + `
+
+The first line may instead be ` + "`{\"options\": {...}, \"save_history\": false}`" + ` to set the
+merge options (as in ` + "`POST /api/merge`" + `) for the whole stream. Empty lines are skipped.
+
+## Response
+
+One line per input line, in input order: ` + "`{\"line\": N, \"domain\": {...}, \"stats\": {...}}`" + `
+or ` + "`{\"line\": N, \"error\": {...}}`" + `. A malformed or invalid line does not stop the stream.
+The last line is ` + "`{\"summary\": {...}}`" + `; a response without it was cut short.
+
+## Side Effects
+
+Unless ` + "`save_history`" + ` is false, the merged domains are saved as one history entry
+once the stream ends. This keeps the whole stream in memory; disable it for the
+largest inputs.`,
+		Tags: []string{"merge"},
+		RequestBody: &huma.RequestBody{
+			Required: true,
+			Content: map[string]*huma.MediaType{
+				ndjsonContentType: {Schema: registry.Schema(reflect.TypeOf(MergeStreamUnit{}), true, "MergeStreamUnit")},
+			},
+		},
+		Responses: map[string]*huma.Response{
+			"200": {
+				Description: "One JSON result per line",
+				Content: map[string]*huma.MediaType{
+					ndjsonContentType: {Schema: registry.Schema(reflect.TypeOf(MergeStreamResult{}), true, "MergeStreamResult")},
+				},
+			},
+		},
+	}
+}
+
+func (s *Server) handleMergeStream(ctx context.Context, input *MergeStreamInput) (*huma.StreamResponse, error) {
+	return &huma.StreamResponse{
+		Body: func(hctx huma.Context) {
+			hctx.SetHeader("Content-Type", ndjsonContentType)
+
+			w := hctx.BodyWriter()
+			var rc *http.ResponseController
+			if rw, ok := w.(http.ResponseWriter); ok {
+				rc = http.NewResponseController(rw)
+				// Results are written while the body is still being read
+				_ = rc.EnableFullDuplex()
+			}
+
+			enc := json.NewEncoder(w)
+			enc.SetEscapeHTML(false)
+			write := func(r *MergeStreamResult) bool {
+				if err := enc.Encode(r); err != nil {
+					return false
+				}
+				if rc != nil {
+					_ = rc.Flush()
+				}
+				return true
+			}
+
+			s.mergeStream(ctx, input.body, write)
+		},
+	}, nil
+}
+
+// mergeStream merges each line of body and passes the results to write,
+// ending with the summary. It stops early if write fails.
+func (s *Server) mergeStream(ctx context.Context, body io.Reader, write func(*MergeStreamResult) bool) {
+	m := s.merger
+	saveHistory := s.repo != nil
+
+	var (
+		summary  MergeStreamSummary
+		total    models.MergeStats
+		initial  []models.Domain
+		response models.CertificateResponse
+		result   []models.Domain
+	)
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), mergeStreamMaxLine)
+
+	line := 0
+	started := false
+	for scanner.Scan() {
+		line++
+		if ctx.Err() != nil {
+			return
+		}
+
+		data := scanner.Bytes()
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		first := !started
+		started = true
+
+		var unit MergeStreamUnit
+		if err := json.Unmarshal(data, &unit); err != nil {
+			summary.Failed++
+			if !write(streamError(line, http.StatusBadRequest, fmt.Sprintf("invalid JSON: %v", err))) {
+				return
+			}
+			continue
+		}
+
+		if unit.Domain == nil {
+			if unit.Options == nil && unit.SaveHistory == nil {
+				summary.Failed++
+				if !write(streamError(line, http.StatusUnprocessableEntity, "line has no domain")) {
+					return
+				}
+				continue
+			}
+			if !first {
+				summary.Failed++
+				if !write(streamError(line, http.StatusUnprocessableEntity, "options are only allowed on the first line")) {
+					return
+				}
+				continue
+			}
+			var err error
+			if m, err = s.mergerFor(unit.Options); err != nil {
+				// Merging with other options than requested would be wrong
+				summary.Failed++
+				write(streamError(line, http.StatusUnprocessableEntity, err.Error()))
+				write(&MergeStreamResult{Summary: &summary})
+				return
+			}
+			if unit.SaveHistory != nil && !*unit.SaveHistory {
+				saveHistory = false
+			}
+			continue
+		}
+
+		if unit.Response == nil {
+			unit.Response = &models.CertificateResponse{}
+		}
+		domains := []models.Domain{*unit.Domain}
+		if err := m.Validate(domains, unit.Response); err != nil {
+			summary.Failed++
+			if !write(streamError(line, http.StatusUnprocessableEntity, err.Error())) {
+				return
+			}
+			continue
+		}
+		logWeakCertificates(m, unit.Response)
+
+		merged, stats, err := m.MergeWithStats(ctx, domains, unit.Response)
+		if err != nil {
+			// ctx is canceled, the client is gone
+			return
+		}
+		summary.Merged++
+		addMergeStats(&total, stats)
+		if saveHistory {
+			initial = append(initial, domains...)
+			response.Results = append(response.Results, unit.Response.Results...)
+			result = append(result, merged...)
+		}
+
+		if !write(&MergeStreamResult{Line: line, Domain: &merged[0], Stats: &stats}) {
+			return
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = fmt.Errorf("line longer than %d bytes", mergeStreamMaxLine)
+			status = http.StatusRequestEntityTooLarge
+		}
+		summary.Failed++
+		if !write(streamError(line+1, status, fmt.Sprintf("failed to read request: %v", err))) {
+			return
+		}
+	}
+
+	if summary.Merged > 0 {
+		summary.Stats = &total
+	}
+
+	switch {
+	case s.repo == nil || summary.Merged == 0:
+	case !saveHistory:
+		slog.InfoContext(ctx, "merge history not saved", "reason", "save_history=false", "domains_count", summary.Merged)
+	default:
+		if entry, err := s.repo.SaveHistoryWithStats(ctx, initial, response, result, &total); err == nil {
+			summary.HistoryID = entry.ID
+		}
+	}
+
+	write(&MergeStreamResult{Summary: &summary})
+}
+
+// mergerFor returns the server's merger with the per-request overrides applied
+func (s *Server) mergerFor(o *MergeOptionsInput) (*merger.Merger, error) {
+	if o == nil {
+		return s.merger, nil
+	}
+
+	opts := s.merger.Options()
+	if o.Strategy != nil {
+		strategy, err := merger.ParseStrategy(*o.Strategy)
+		if err != nil {
+			return nil, err
+		}
+		opts.Strategy = strategy
+	}
+	if o.Normalize != nil {
+		opts.Normalize = *o.Normalize
+	}
+	if o.AltNames != nil {
+		opts.AltNames = *o.AltNames
+	}
+	if o.HostAliases != nil {
+		opts.HostAliases = o.HostAliases
+	}
+	if o.Strict != nil {
+		opts.Strict = *o.Strict
+	}
+	if o.Dedup != nil {
+		opts.Dedup = *o.Dedup
+	}
+	if o.Weak != nil {
+		weak, err := merger.ParseWeakPolicy(*o.Weak)
+		if err != nil {
+			return nil, err
+		}
+		opts.Weak = weak
+	}
+	return merger.NewWithOptions(opts), nil
+}
+
+// logWeakCertificates logs the weak certificates of response under
+// merger.WeakWarn; Validate rejects them under merger.WeakFail.
+func logWeakCertificates(m *merger.Merger, response *models.CertificateResponse) {
+	if policy := m.Options().Weak; policy != merger.WeakWarn && policy != "" {
+		return
+	}
+	for _, weak := range merger.WeakCertificates(response, time.Now()) {
+		slog.Warn("weak certificate in merge response",
+			"url", weak.URL,
+			"subject", weak.Subject,
+			"fingerprint", weak.Fingerprint,
+			"reasons", weak.Reasons,
+		)
+	}
+}
+
+func streamError(line, status int, msg string) *MergeStreamResult {
+	return &MergeStreamResult{Line: line, Error: newErrorModel(status, codeForStatus(status), msg)}
+}
+
+// addMergeStats accumulates per-line statistics into the stream total
+func addMergeStats(total *models.MergeStats, stats models.MergeStats) {
+	total.DurationMS += stats.DurationMS
+	total.Domains += stats.Domains
+	total.Servers += stats.Servers
+	total.ResponseResults += stats.ResponseResults
+	total.MatchedServers += stats.MatchedServers
+	total.ResultCertificates += stats.ResultCertificates
+	if total.Servers > 0 {
+		total.MatchRatio = float64(total.MatchedServers) / float64(total.Servers)
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ldapmerge/internal/repository"
+)
+
+func postMergeStream(t *testing.T, s *Server, body string) []MergeStreamResult {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/merge/stream", strings.NewReader(body))
+	req.Header.Set("Content-Type", ndjsonContentType)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != ndjsonContentType {
+		t.Errorf("Expected Content-Type %s, got %s", ndjsonContentType, ct)
+	}
+
+	var results []MergeStreamResult
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var r MergeStreamResult
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("Invalid response line %q: %v", scanner.Text(), err)
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func TestMergeStream(t *testing.T) {
+	s, repo := setupTestServer(t)
+
+	body := `{"options": {"normalize": true}}
+{"domain": {"id": "a.lab", "domain_name": "a.lab", "base_dn": "DC=a,DC=lab", "alternative_domain_names": [], "ldap_servers": [{"url": "LDAPS://dc1.a.lab", "starttls": "false", "enabled": "true"}]}, "response": {"results": [{"item": {"url": "ldaps://dc1.a.lab:636"}, "json": {"pem_encoded": "CERT-A"}}]}}
+
+not json
+{"domain": {"id": "b.lab", "domain_name": "b.lab", "base_dn": "DC=b,DC=lab", "alternative_domain_names": [], "ldap_servers": [{"url": "ldaps://dc1.b.lab", "starttls": "false", "enabled": "true"}]}}
+{"options": {"strict": true}}
+`
+	results := postMergeStream(t, s, body)
+	if len(results) != 5 {
+		t.Fatalf("Expected 5 result lines, got %d: %+v", len(results), results)
+	}
+
+	if r := results[0]; r.Line != 2 || r.Domain == nil || r.Domain.ID != "a.lab" {
+		t.Fatalf("Expected merged a.lab for line 2, got %+v", r)
+	}
+	if certs := results[0].Domain.LDAPServers[0].Certificates; len(certs) != 1 || certs[0] != "CERT-A" {
+		t.Errorf("Expected normalized URL to match CERT-A, got %v", certs)
+	}
+	if r := results[1]; r.Line != 4 || r.Error == nil || r.Error.Code != CodeValidation {
+		t.Errorf("Expected LM-1001 error for line 4, got %+v", r)
+	}
+	if r := results[2]; r.Line != 5 || r.Domain == nil || r.Domain.ID != "b.lab" {
+		t.Errorf("Expected merged b.lab for line 5, got %+v", r)
+	}
+	if r := results[3]; r.Line != 6 || r.Error == nil {
+		t.Errorf("Expected late options on line 6 to be rejected, got %+v", r)
+	}
+
+	summary := results[4].Summary
+	if summary == nil {
+		t.Fatalf("Expected summary as last line, got %+v", results[4])
+	}
+	if summary.Merged != 2 || summary.Failed != 2 {
+		t.Errorf("Expected 2 merged and 2 failed, got %+v", summary)
+	}
+	if summary.Stats == nil || summary.Stats.Servers != 2 || summary.Stats.MatchedServers != 1 {
+		t.Errorf("Expected stream stats over both domains, got %+v", summary.Stats)
+	}
+
+	entry, err := repo.GetHistory(context.Background(), summary.HistoryID)
+	if err != nil {
+		t.Fatalf("Expected history entry %d: %v", summary.HistoryID, err)
+	}
+	if len(entry.Result.Data) != 2 {
+		t.Errorf("Expected 2 domains in history, got %d", len(entry.Result.Data))
+	}
+}
+
+func TestMergeStreamOptions(t *testing.T) {
+	s, repo := setupTestServer(t)
+
+	results := postMergeStream(t, s, `{"options": {"strategy": "merge"}}`+"\n")
+	if len(results) != 2 || results[0].Error == nil || results[1].Summary == nil {
+		t.Fatalf("Expected error and summary for an invalid strategy, got %+v", results)
+	}
+
+	body := `{"save_history": false}
+{"domain": {"id": "a.lab", "domain_name": "a.lab", "base_dn": "DC=a,DC=lab", "alternative_domain_names": [], "ldap_servers": []}}
+`
+	results = postMergeStream(t, s, body)
+	if summary := results[len(results)-1].Summary; summary == nil || summary.Merged != 1 || summary.HistoryID != 0 {
+		t.Errorf("Expected one merge without history, got %+v", summary)
+	}
+
+	entries, err := repo.ListHistory(context.Background(), repository.HistoryFilter{})
+	if err != nil {
+		t.Fatalf("ListHistory failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected no history entries, got %d", len(entries))
+	}
+}
@@ -0,0 +1,399 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/logging"
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/repository"
+	"ldapmerge/internal/runid"
+)
+
+// Statuses of a sync job
+const (
+	SyncRunning   = "running"
+	SyncSucceeded = "succeeded"
+	SyncFailed    = "failed"
+)
+
+// Phases of a sync job
+const (
+	SyncPhasePull  = "pull"
+	SyncPhaseMerge = "merge"
+	SyncPhasePush  = "push"
+)
+
+// maxSyncJobs bounds the sync jobs kept in memory; the oldest finished
+// jobs are dropped beyond it.
+const maxSyncJobs = 100
+
+// SyncInput is the request for syncing the identity sources of an NSX configuration
+type SyncInput struct {
+	Body struct {
+		ConfigID           int64                       `json:"config_id" doc:"ID of the saved NSX configuration to sync" example:"1"`
+		Response           *models.CertificateResponse `json:"response,omitempty" required:"false" doc:"Certificate response data; required unless response_document_id or response_location is set"`
+		ResponseDocumentID *int64                      `json:"response_document_id,omitempty" doc:"ID of an uploaded response document to use instead of response" example:"2"`
+		ResponseLocation   *string                     `json:"response_location,omitempty" doc:"URL of the response document to load instead of response; the scheme must be enabled with --input-schemes" example:"https://pki.example.com/ldap/response.json"`
+		Options            *MergeOptionsInput          `json:"options,omitempty" doc:"Per-request overrides of the server's default merge options; the strategy defaults to the configuration's sync_defaults"`
+		PushOptions
+	}
+}
+
+// SyncJob is a sync of an NSX configuration running in the background
+type SyncJob struct {
+	ID         string      `json:"id" doc:"Job ID" example:"20250115T103000Z-3f9a2c1b"`
+	Status     string      `json:"status" enum:"running,succeeded,failed" doc:"running until the sync ends; succeeded if every source was pushed, or planned by a dry run; failed otherwise, with error or the failed sources in result"`
+	Phase      string      `json:"phase" enum:"pull,merge,push" doc:"Phase running, or the last one run"`
+	ConfigID   int64       `json:"config_id" doc:"NSX configuration ID" example:"1"`
+	Host       string      `json:"host" doc:"NSX Manager URL" example:"https://nsx.example.com"`
+	RunID      string      `json:"run_id,omitempty" doc:"Run ID of the request that started the job, logged with every record of the job" example:"20250115T103000Z-3f9a2c1b"`
+	Reason     string      `json:"reason" doc:"Justification for the change, stored in the audit log"`
+	CreatedAt  time.Time   `json:"created_at" doc:"When the job started"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty" doc:"When the job ended"`
+	Pulled     int         `json:"pulled" doc:"Number of identity sources pulled from NSX"`
+	HistoryID  *int64      `json:"history_id,omitempty" doc:"ID of the history entry of the merge"`
+	Result     *PushResult `json:"result,omitempty" doc:"Outcome of the push, or the sources planned by a dry run"`
+	Error      *ErrorModel `json:"error,omitempty" doc:"Why the job failed before pushing every source"`
+
+	tenant string
+	done   chan struct{} // closed when the job ends
+}
+
+// SyncJobInput identifies a sync job
+type SyncJobInput struct {
+	ID string `path:"id" doc:"Sync job ID"`
+}
+
+// SyncStartOutput is the response for a sync job started
+type SyncStartOutput struct {
+	Location string `header:"Location" doc:"URL of the job"`
+	Body     SyncJob
+}
+
+// SyncJobOutput is the response with a sync job
+type SyncJobOutput struct {
+	Body SyncJob
+}
+
+// SyncJobListOutput is the response with the sync jobs
+type SyncJobListOutput struct {
+	Body []SyncJob
+}
+
+// syncJobs are the sync jobs of a server. They are kept in memory only:
+// what a job changed is recorded in history, snapshots and the audit log,
+// which outlive it.
+type syncJobs struct {
+	mu   sync.Mutex
+	jobs []*SyncJob // oldest first
+
+	ctx    context.Context // canceled when the server gives up waiting for the jobs
+	cancel context.CancelFunc
+}
+
+func newSyncJobs() *syncJobs {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &syncJobs{ctx: ctx, cancel: cancel}
+}
+
+// start adds job and runs it with run in the background, on a context with
+// the values of ctx. It refuses a job of a configuration already syncing.
+func (j *syncJobs) start(ctx context.Context, job *SyncJob, run func(ctx context.Context, job *SyncJob) (*PushResult, error)) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, other := range j.jobs {
+		if other.ConfigID == job.ConfigID && other.Status == SyncRunning {
+			return fmt.Errorf("a sync of config %d is already running: job %s", job.ConfigID, other.ID)
+		}
+	}
+	job.done = make(chan struct{})
+	j.jobs = append(j.jobs, job)
+	j.prune()
+
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(j.ctx, cancel)
+	go func() {
+		defer close(job.done)
+		defer cancel()
+		defer stop()
+
+		result, err := run(jobCtx, job)
+		j.finish(job, result, err)
+	}()
+	return nil
+}
+
+// prune drops the oldest finished jobs beyond maxSyncJobs. Running jobs are
+// always kept.
+func (j *syncJobs) prune() {
+	for i := 0; len(j.jobs) > maxSyncJobs && i < len(j.jobs); {
+		if j.jobs[i].Status == SyncRunning {
+			i++
+			continue
+		}
+		j.jobs = slices.Delete(j.jobs, i, i+1)
+	}
+}
+
+// setPhase records the phase job entered.
+func (j *syncJobs) setPhase(job *SyncJob, phase string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job.Phase = phase
+}
+
+// update changes job with fn.
+func (j *syncJobs) update(job *SyncJob, fn func(job *SyncJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(job)
+}
+
+// finish records the outcome of job.
+func (j *syncJobs) finish(job *SyncJob, result *PushResult, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	job.Result = result
+	switch {
+	case err != nil:
+		job.Status = SyncFailed
+		job.Error = jobError(err)
+	case result.Failed > 0 || len(result.Skipped) > 0:
+		job.Status = SyncFailed
+	default:
+		job.Status = SyncSucceeded
+	}
+}
+
+// jobError returns the error model of err, as a request failing with it
+// would have returned.
+func jobError(err error) *ErrorModel {
+	var model *ErrorModel
+	if errors.As(err, &model) {
+		return model
+	}
+	if errors.Is(err, context.Canceled) {
+		return newErrorModel(http.StatusServiceUnavailable, CodeInternal, "sync interrupted by the server shutdown", err)
+	}
+	return newErrorModel(http.StatusInternalServerError, CodeInternal, err.Error())
+}
+
+// get returns a copy of the job id, if ctx may see it.
+func (j *syncJobs) get(ctx context.Context, id string) (SyncJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, job := range j.jobs {
+		if job.ID == id && visible(ctx, job) {
+			return *job, true
+		}
+	}
+	return SyncJob{}, false
+}
+
+// list returns copies of the jobs ctx may see, newest first.
+func (j *syncJobs) list(ctx context.Context) []SyncJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	jobs := []SyncJob{}
+	for _, job := range slices.Backward(j.jobs) {
+		if visible(ctx, job) {
+			jobs = append(jobs, *job)
+		}
+	}
+	return jobs
+}
+
+// visible reports whether the request of ctx may see job: requests of a
+// tenant see the jobs started by that tenant only.
+func visible(ctx context.Context, job *SyncJob) bool {
+	tenant, ok := repository.TenantFrom(ctx)
+	return !ok || job.tenant == tenant
+}
+
+// wait waits until the running jobs have finished or ctx is done. The jobs
+// still running then are canceled: their push stops after the sources in
+// progress, and what was pushed is recorded.
+func (j *syncJobs) wait(ctx context.Context) error {
+	var running []chan struct{}
+	j.mu.Lock()
+	for _, job := range j.jobs {
+		if job.Status == SyncRunning {
+			slog.Info("waiting for sync job", "job_id", job.ID, "config_id", job.ConfigID, "phase", job.Phase)
+			running = append(running, job.done)
+		}
+	}
+	j.mu.Unlock()
+
+	for _, done := range running {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			j.cancel()
+			return fmt.Errorf("sync jobs not finished: %w", ctx.Err())
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleStartSync(ctx context.Context, input *SyncInput) (*SyncStartOutput, error) {
+	if s.repo == nil {
+		return nil, apiError(http.StatusNotFound, CodeDatabaseUnavailable, "config not available")
+	}
+	body := &input.Body
+	if err := audit.CheckReason(body.Reason); err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error())
+	}
+	if countSet(body.Response != nil, body.ResponseDocumentID != nil, body.ResponseLocation != nil) > 1 {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, "response, response_document_id and response_location are mutually exclusive")
+	}
+
+	config, err := s.repo.GetConfig(ctx, body.ConfigID)
+	if err != nil {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "config not found")
+	}
+
+	plan, err := newPushPlan(config.SyncDefaults, body.DryRun, body.Domains, body.Canary)
+	if err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error())
+	}
+	if plan.canary != "" && !plan.filter.Match(plan.canary) {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, fmt.Sprintf("canary source %q does not match the domain filter", plan.canary))
+	}
+	m, err := s.mergerFor(syncMergeOptions(body.Options, config.SyncDefaults))
+	if err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error(), err)
+	}
+	response, err := s.resolveResponse(ctx, body.Response, body.ResponseDocumentID, body.ResponseLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &SyncJob{
+		ID:        runid.New(),
+		Status:    SyncRunning,
+		Phase:     SyncPhasePull,
+		ConfigID:  config.ID,
+		Host:      config.Host,
+		Reason:    body.Reason,
+		CreatedAt: time.Now().UTC(),
+	}
+	job.RunID, _ = runid.From(ctx)
+	job.tenant, _ = repository.TenantFrom(ctx)
+
+	opts := body.PushOptions
+	err = s.jobs.start(ctx, job, func(ctx context.Context, job *SyncJob) (*PushResult, error) {
+		return s.sync(ctx, job, config, m, response, plan, &opts)
+	})
+	if err != nil {
+		return nil, apiError(http.StatusConflict, CodeConflict, err.Error())
+	}
+	logging.RunLogger(ctx).Info("sync job started", "job_id", job.ID, "config_id", config.ID, "nsx_host", config.Host, "dry_run", plan.dryRun)
+
+	output := &SyncStartOutput{Location: "/api/sync/" + job.ID}
+	output.Body, _ = s.jobs.get(ctx, job.ID)
+	return output, nil
+}
+
+// syncMergeOptions returns the merge options of a sync: the strategy of
+// the sync defaults of its configuration, unless the request sets one.
+func syncMergeOptions(o *MergeOptionsInput, defaults *models.SyncDefaults) *MergeOptionsInput {
+	if defaults == nil || defaults.Strategy == "" || (o != nil && o.Strategy != nil) {
+		return o
+	}
+	var opts MergeOptionsInput
+	if o != nil {
+		opts = *o
+	}
+	opts.Strategy = &defaults.Strategy
+	return &opts
+}
+
+// sync pulls the identity sources of config, merges the certificates of
+// response into them with m and pushes them back as planned, recording the
+// progress in job. Like the sync command, it only merges and pushes the
+// sources that match the domain filter.
+func (s *Server) sync(ctx context.Context, job *SyncJob, config *models.NSXConfig, m *merger.Merger, response *models.CertificateResponse, plan *pushPlan, opts *PushOptions) (*PushResult, error) {
+	log := logging.RunLogger(ctx).With("job_id", job.ID, "config_id", config.ID, "nsx_host", config.Host)
+	client := s.newNSXClient(config)
+
+	log.Info("step 1/3: pulling LDAP identity sources from NSX")
+	pulled, err := client.ListLDAPIdentitySources(ctx)
+	if err != nil {
+		log.Error("failed to pull from NSX", "error", err)
+		if se := nsxError(err); se != nil {
+			return nil, se
+		}
+		return nil, apiError(http.StatusBadGateway, CodeNSXAPI, "failed to list identity sources", err)
+	}
+	domains := nsx.LDAPIdentitySourcesToDomains(pulled.Results)
+	s.jobs.update(job, func(job *SyncJob) { job.Pulled = len(domains) })
+	if _, err := s.repo.UpdateInventory(ctx, config.Host, domains); err != nil {
+		log.Warn("server inventory not updated", "error", err)
+	}
+
+	initial := plan.filter.Select(domains)
+	if len(initial) == 0 {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, "no identity sources match the domain filter")
+	}
+
+	s.jobs.setPhase(job, SyncPhaseMerge)
+	log.Info("step 2/3: merging with certificate response", "domains_count", len(initial))
+	if err := m.Validate(initial, response); err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error(), err)
+	}
+	logWeakCertificates(m, response)
+
+	merged, stats, err := m.MergeWithStats(ctx, initial, response)
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeInternal, "merge failed", err)
+	}
+	entry, err := s.repo.SaveHistoryWithStats(ctx, initial, *response, merged, &stats)
+	if err != nil {
+		return nil, apiError(http.StatusInternalServerError, CodeDatabase, "failed to save history", err)
+	}
+	s.jobs.update(job, func(job *SyncJob) { job.HistoryID = &entry.ID })
+	log.Info("merge completed", "history_id", entry.ID, "domains_count", len(merged), "matched_servers", stats.MatchedServers)
+
+	ordered, err := merger.CanaryFirst(merged, plan.canary)
+	if err != nil {
+		return nil, apiError(http.StatusUnprocessableEntity, CodeValidation, err.Error())
+	}
+
+	if plan.dryRun {
+		log.Info("dry run of sync, NSX left unchanged", "domains_count", len(ordered))
+		return &plannedPush(config, ordered).Body, nil
+	}
+	s.jobs.setPhase(job, SyncPhasePush)
+	log.Info("step 3/3: pushing merged configuration to NSX", "domains_count", len(ordered), "canary", plan.canary)
+
+	output, err := s.push(ctx, log, audit.OperationSyncPush, config, ordered, plan, opts, &entry.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &output.Body, nil
+}
+
+func (s *Server) handleGetSyncJob(ctx context.Context, input *SyncJobInput) (*SyncJobOutput, error) {
+	job, ok := s.jobs.get(ctx, input.ID)
+	if !ok {
+		return nil, apiError(http.StatusNotFound, CodeNotFound, "sync job not found")
+	}
+	return &SyncJobOutput{Body: job}, nil
+}
+
+func (s *Server) handleListSyncJobs(ctx context.Context, input *struct{}) (*SyncJobListOutput, error) {
+	return &SyncJobListOutput{Body: s.jobs.list(ctx)}, nil
+}
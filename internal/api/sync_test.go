@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/nsx/mock"
+	"ldapmerge/internal/repository"
+)
+
+func TestSync(t *testing.T) {
+	s, repo := setupTestServer(t)
+	ctx := context.Background()
+
+	mockServer := mock.NewServer()
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	config, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "mock", Host: ts.URL, Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	rejected, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "rejected", Host: ts.URL, Username: "admin", Password: "wrong"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	id := strconv.FormatInt(config.ID, 10)
+
+	var sources []nsx.LDAPIdentitySource
+	for _, source := range mockServer.GetSources() {
+		sources = append(sources, *source)
+	}
+	response, err := json.Marshal(mock.GenerateResponse(sources))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/sync", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+	// run starts a sync and waits for its job to end
+	run := func(body string) SyncJob {
+		t.Helper()
+		rec := start(body)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var job SyncJob
+		if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+			t.Fatalf("Failed to decode job: %v", err)
+		}
+		if job.Status != SyncRunning || rec.Header().Get("Location") != "/api/sync/"+job.ID {
+			t.Fatalf("Expected a running job at its Location, got %+v, %q", job, rec.Header().Get("Location"))
+		}
+
+		for deadline := time.Now().Add(10 * time.Second); job.Status == SyncRunning; {
+			if time.Now().After(deadline) {
+				t.Fatalf("Sync job %s did not end: %+v", job.ID, job)
+			}
+			time.Sleep(10 * time.Millisecond)
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sync/"+job.ID, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+				t.Fatalf("Failed to decode job: %v", err)
+			}
+		}
+		return job
+	}
+	certificate := func() string {
+		return strings.Join(mockServer.GetSources()["example.lab"].LDAPServers[0].Certificates, "")
+	}
+
+	job := run(`{"config_id": ` + id + `, "response": ` + string(response) + `, "reason": "CHG-1", "dry_run": true}`)
+	if job.Status != SyncSucceeded || job.Result == nil || !job.Result.DryRun || len(job.Result.Planned) != len(sources) || job.HistoryID == nil {
+		t.Fatalf("Expected a dry run of every source, got %+v", job)
+	}
+	if strings.Contains(certificate(), "renewed") {
+		t.Fatal("Expected the dry run to leave NSX unchanged")
+	}
+
+	job = run(`{"config_id": ` + id + `, "response": ` + string(response) + `, "reason": "CHG-1"}`)
+	if job.Status != SyncSucceeded || job.Phase != SyncPhasePush || job.Pulled != len(sources) || job.FinishedAt == nil || job.Error != nil {
+		t.Fatalf("Expected the sync to succeed, got %+v", job)
+	}
+	if job.Result == nil || job.Result.Succeeded != len(sources) || job.Result.Failed != 0 || job.Result.SnapshotID == 0 {
+		t.Fatalf("Unexpected push outcome: %+v", job.Result)
+	}
+	if !strings.Contains(certificate(), "renewed") {
+		t.Error("Expected the renewed certificate pushed")
+	}
+
+	snapshot, err := repo.GetSnapshot(ctx, job.Result.SnapshotID)
+	if err != nil || snapshot.HistoryID == nil || *snapshot.HistoryID != *job.HistoryID {
+		t.Errorf("Expected the snapshot linked to history entry %d, got %+v (%v)", *job.HistoryID, snapshot, err)
+	}
+	events, err := repo.ListAuditEvents(ctx, repository.AuditFilter{Operation: "sync.push"})
+	if err != nil || len(events) != 1 || events[0].Outcome != "success" || events[0].Reason != "CHG-1" || events[0].Origin != "api" {
+		t.Errorf("Expected a successful sync.push audit event, got %+v (%v)", events, err)
+	}
+
+	job = run(`{"config_id": ` + strconv.FormatInt(rejected.ID, 10) + `, "response": ` + string(response) + `, "reason": "CHG-1"}`)
+	if job.Status != SyncFailed || job.Phase != SyncPhasePull || job.Error == nil || job.Error.Code != CodeNSXAuth {
+		t.Errorf("Expected the job to fail with %s, got %+v", CodeNSXAuth, job)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sync", nil))
+	var jobs []SyncJob
+	if err := json.Unmarshal(rec.Body.Bytes(), &jobs); err != nil || len(jobs) != 3 || jobs[0].ID != job.ID {
+		t.Errorf("Expected the 3 jobs, newest first, got %+v (%v)", jobs, err)
+	}
+
+	for _, tc := range []struct {
+		body   string
+		status int
+	}{
+		{`{"config_id": ` + id + `, "response": ` + string(response) + `}`, http.StatusUnprocessableEntity},
+		{`{"config_id": ` + id + `, "reason": "CHG-1"}`, http.StatusUnprocessableEntity},
+		{`{"config_id": ` + id + `, "response": ` + string(response) + `, "reason": "CHG-1", "canary": "x.lab", "domains": ["*.org"]}`, http.StatusUnprocessableEntity},
+		{`{"config_id": 999, "response": ` + string(response) + `, "reason": "CHG-1"}`, http.StatusNotFound},
+	} {
+		if rec := start(tc.body); rec.Code != tc.status {
+			t.Errorf("Expected status %d for %.80s, got %d: %s", tc.status, tc.body, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sync/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown job, got %d", rec.Code)
+	}
+}
+
+func TestSyncJobs(t *testing.T) {
+	jobs := newSyncJobs()
+	ctx := repository.WithTenant(context.Background(), "team-a")
+
+	// block runs until the jobs are canceled
+	block := func(ctx context.Context, job *SyncJob) (*PushResult, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	job := &SyncJob{ID: "job-1", Status: SyncRunning, ConfigID: 1, tenant: "team-a"}
+	if err := jobs.start(ctx, job, block); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+	if err := jobs.start(ctx, &SyncJob{ID: "job-2", Status: SyncRunning, ConfigID: 1}, block); err == nil {
+		t.Error("Expected a second job of the same config refused")
+	}
+
+	if _, ok := jobs.get(ctx, "job-1"); !ok {
+		t.Error("Expected the job visible to its tenant")
+	}
+	if _, ok := jobs.get(context.Background(), "job-1"); !ok {
+		t.Error("Expected the job visible without a tenant")
+	}
+	if _, ok := jobs.get(repository.WithTenant(context.Background(), "team-b"), "job-1"); ok {
+		t.Error("Expected the job hidden from another tenant")
+	}
+
+	waitCtx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := jobs.wait(waitCtx); err == nil {
+		t.Fatal("Expected wait to give up on the running job")
+	}
+	if err := jobs.wait(context.Background()); err != nil {
+		t.Fatalf("Expected the canceled job to end: %v", err)
+	}
+	if got, _ := jobs.get(ctx, "job-1"); got.Status != SyncFailed || got.Error == nil || got.Error.Status != http.StatusServiceUnavailable {
+		t.Errorf("Expected the job failed by the shutdown, got %+v", got)
+	}
+
+	// Finished jobs beyond the limit are dropped, oldest first
+	for i := range maxSyncJobs + 5 {
+		job := &SyncJob{ID: strconv.Itoa(i), Status: SyncRunning, ConfigID: int64(i + 2), tenant: "team-a"}
+		if err := jobs.start(ctx, job, func(context.Context, *SyncJob) (*PushResult, error) { return &PushResult{}, nil }); err != nil {
+			t.Fatalf("start failed: %v", err)
+		}
+		<-job.done
+	}
+	if list := jobs.list(ctx); len(list) != maxSyncJobs || list[0].ID != strconv.Itoa(maxSyncJobs+4) || list[0].Status != SyncSucceeded {
+		t.Errorf("Expected the last %d jobs, got %d, newest %+v", maxSyncJobs, len(list), list[0])
+	}
+}
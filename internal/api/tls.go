@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/uptrace/bunrouter"
+
+	"ldapmerge/internal/logging"
+)
+
+// tlsConfig returns the TLS configuration of the HTTPS server with the
+// certificate and key in the PEM files certFile and keyFile. With the PEM
+// CA bundle clientCAFile, only clients with a certificate it signed are
+// accepted.
+func tlsConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if clientCAFile != "" {
+		data, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("failed to load client CA bundle: no PEM certificate in %s", clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// clientCertKey is the context key of the client certificate.
+type clientCertKey struct{}
+
+// clientCert returns the subject of the verified TLS client certificate of
+// the request of ctx, or "".
+func clientCert(ctx context.Context) string {
+	if cert, ok := ctx.Value(clientCertKey{}).(*x509.Certificate); ok {
+		return cert.Subject.String()
+	}
+	return ""
+}
+
+// clientCertFingerprint returns the hex SHA-256 fingerprint of the
+// verified TLS client certificate of the request of ctx, or "".
+func clientCertFingerprint(ctx context.Context) string {
+	if cert, ok := ctx.Value(clientCertKey{}).(*x509.Certificate); ok {
+		sum := sha256.Sum256(cert.Raw)
+		return hex.EncodeToString(sum[:])
+	}
+	return ""
+}
+
+// normalizeFingerprint returns a SHA-256 certificate fingerprint as
+// lowercase hex without separators, accepting the sha256: prefix and the
+// colons of openssl x509 -fingerprint; "" if s is not one.
+func normalizeFingerprint(s string) string {
+	s = strings.ReplaceAll(strings.TrimPrefix(strings.ToLower(s), "sha256:"), ":", "")
+	if b, err := hex.DecodeString(s); err != nil || len(b) != sha256.Size {
+		return ""
+	}
+	return s
+}
+
+// clientCertMiddleware sets the subject of the verified client certificate
+// of requests made over mutual TLS on their context and their log records.
+func clientCertMiddleware(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+			return next(w, req)
+		}
+		cert := req.TLS.VerifiedChains[0][0]
+		subject := cert.Subject.String()
+		ctx := context.WithValue(req.Context(), clientCertKey{}, cert)
+		ctx = logging.WithAttrs(ctx, slog.String(logging.KeyClientCert, subject))
+		return next(w, req.WithContext(ctx))
+	}
+}
+
+// httpsRedirect redirects requests to the same host and URI over HTTPS on
+// the port of tlsAddr. 308 keeps the method and body of API calls.
+func httpsRedirect(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.Trim(host, "[]")
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/logging"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+)
+
+func TestHTTPSRedirect(t *testing.T) {
+	for _, tc := range []struct{ tlsAddr, host, target, want string }{
+		{"0.0.0.0:8443", "ldapmerge.example.lab:8080", "/api/configs?x=1", "https://ldapmerge.example.lab:8443/api/configs?x=1"},
+		{":443", "ldapmerge.example.lab", "/docs", "https://ldapmerge.example.lab/docs"},
+		{":8443", "[::1]:8080", "/", "https://[::1]:8443/"},
+		{":443", "[::1]", "/", "https://[::1]/"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.target, nil)
+		req.Host = tc.host
+		rec := httptest.NewRecorder()
+		httpsRedirect(tc.tlsAddr).ServeHTTP(rec, req)
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != tc.want {
+			t.Errorf("%s%s: expected 308 to %s, got %d %s", tc.host, tc.target, tc.want, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestStartTLSInvalidCertificate(t *testing.T) {
+	s := NewServerWithOptions("127.0.0.1:0", nil, Options{TLSCert: "missing.pem", TLSKey: "missing.key"})
+	if err := s.Start(context.Background()); err == nil || !strings.Contains(err.Error(), "TLS certificate") {
+		t.Errorf("Expected a TLS certificate error, got %v", err)
+	}
+}
+
+// writeCert writes a certificate for template signed by parent (itself if
+// nil) and its key as PEM files in dir, and returns the certificate, key
+// and file paths.
+func writeCert(t *testing.T, dir, name string, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+".key")
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return cert, key, certFile, keyFile
+}
+
+// fingerprint returns the SHA-256 fingerprint of cert as openssl x509
+// -fingerprint prints it.
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+func TestMutualTLS(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(logging.NewContextHandler(slog.NewJSONHandler(&buf, nil))))
+
+	dir := t.TempDir()
+	now := time.Now()
+	ca, caKey, caFile, _ := writeCert(t, dir, "ca", &x509.Certificate{
+		SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Automation CA"},
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign,
+	}, nil, nil)
+	_, _, serverCert, serverKey := writeCert(t, dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour),
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	_, _, clientCertFile, clientKeyFile := writeCert(t, dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3), Subject: pkix.Name{CommonName: "ansible", Organization: []string{"Example"}},
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	_, _, impostorCertFile, impostorKeyFile := writeCert(t, dir, "impostor", &x509.Certificate{
+		SerialNumber: big.NewInt(5), Subject: pkix.Name{CommonName: "admin"},
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	teamCert, _, teamCertFile, teamKeyFile := writeCert(t, dir, "team-a", &x509.Certificate{
+		SerialNumber: big.NewInt(6), Subject: pkix.Name{CommonName: "team-a-bot"},
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+	_, _, otherCertFile, otherKeyFile := writeCert(t, dir, "other", &x509.Certificate{
+		SerialNumber: big.NewInt(4), Subject: pkix.Name{CommonName: "intruder"},
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, nil, nil)
+
+	repo, err := repository.New(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+	opts := DefaultOptions()
+	opts.APIKeys = []APIKey{
+		{Name: "admin", Key: "admin-key-0123456789"},
+		{Name: "ansible", Key: "ansible-key-0123456789", CertSubjects: []string{"CN=ansible,O=Example"}},
+		{Name: "team-a-bot", Key: "team-a-key-0123456789", Tenant: "team-a", CertSubjects: []string{"SHA256:" + fingerprint(teamCert)}},
+	}
+	s := NewServerWithOptions("127.0.0.1:0", repo, opts)
+
+	srv := httptest.NewUnstartedServer(s.router)
+	if srv.TLS, err = tlsConfig(serverCert, serverKey, caFile); err != nil {
+		t.Fatalf("tlsConfig failed: %v", err)
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	client := func(certFile, keyFile string) *http.Client {
+		cfg := &tls.Config{RootCAs: roots}
+		if certFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg.Certificates = []tls.Certificate{cert}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/configs", nil)
+	req.Header.Set(DebugHeader, "true")
+	resp, err := client(clientCertFile, clientKeyFile).Do(req)
+	if err != nil {
+		t.Fatalf("Request with a client certificate failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the client certificate to stand in for an API key, got %d", resp.StatusCode)
+	}
+	for _, want := range []string{`"api_key":"cert:CN=ansible,O=Example"`, `"client_cert":"CN=ansible,O=Example"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Expected %s in the log, got %s", want, buf.String())
+		}
+	}
+
+	ctx := context.Background()
+	if _, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "shared", Host: "https://nsx-01.example.lab"}); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	if _, err := repo.SaveConfig(repository.WithTenant(ctx, "team-a"), &models.NSXConfig{Name: "team-a", Host: "https://nsx-02.example.lab"}); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	// A certificate acts as the key listing its subject or fingerprint; any
+	// other, even one named after a key, is scoped to the default tenant and
+	// is not an administrator
+	for _, tc := range []struct {
+		name              string
+		certFile, keyFile string
+		configs           []string
+		settings          int
+		debug             bool
+	}{
+		{"ansible", clientCertFile, clientKeyFile, []string{"shared", "team-a"}, http.StatusOK, true},
+		{"team-a-bot", teamCertFile, teamKeyFile, []string{"team-a"}, http.StatusForbidden, false},
+		{"impostor", impostorCertFile, impostorKeyFile, []string{"shared"}, http.StatusForbidden, false},
+	} {
+		c := client(tc.certFile, tc.keyFile)
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/configs", nil)
+		req.Header.Set(DebugHeader, "true")
+		resp, err := c.Do(req)
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tc.name, err)
+		}
+		var configs []models.NSXConfig
+		_ = json.NewDecoder(resp.Body).Decode(&configs)
+		_ = resp.Body.Close()
+		var names []string
+		for _, config := range configs {
+			names = append(names, config.Name)
+		}
+		if !slices.Equal(names, tc.configs) {
+			t.Errorf("%s: expected configs %q, got %q", tc.name, tc.configs, names)
+		}
+		if debug := resp.Header.Get(DebugRequestHeader) != ""; debug != tc.debug {
+			t.Errorf("%s: expected debug logging %v, got %v", tc.name, tc.debug, debug)
+		}
+
+		resp, err = c.Get(srv.URL + "/api/admin/settings")
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tc.name, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != tc.settings {
+			t.Errorf("%s: expected status %d for the settings, got %d", tc.name, tc.settings, resp.StatusCode)
+		}
+	}
+
+	for name, c := range map[string]*http.Client{
+		"no certificate":      client("", ""),
+		"unknown certificate": client(otherCertFile, otherKeyFile),
+	} {
+		if resp, err := c.Get(srv.URL + "/api/health"); err == nil {
+			_ = resp.Body.Close()
+			t.Errorf("%s: expected the handshake to fail, got %d", name, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+// Package artifacts stores merge artifacts (inputs and results) outside the
+// SQLite database, keeping the database file small in busy installations.
+package artifacts
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned when an artifact does not exist.
+var ErrNotFound = errors.New("artifact not found")
+
+// Store is an object store for merge artifacts. Keys are slash-separated
+// paths relative to the store's prefix.
+type Store interface {
+	// Put stores data under key, replacing any existing object
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns the data stored under key, or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes the object stored under key; missing objects are not an error
+	Delete(ctx context.Context, key string) error
+}
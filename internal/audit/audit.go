@@ -0,0 +1,155 @@
+// Package audit records changes made to NSX identity sources. Every push and
+// delete carries the operator's reason; the event is stored in the audit log
+// and, when a webhook is configured, posted to it.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/runid"
+)
+
+// Operations recorded in the audit log
+const (
+	OperationNSXPush         = "nsx.push"
+	OperationNSXDelete       = "nsx.delete"
+	OperationSyncPush        = "sync.push"
+	OperationHistoryPush     = "history.push"
+	OperationSnapshotRestore = "snapshot.restore"
+	OperationBundlePush      = "bundle.push"
+	// OperationAPIRequest is a POST, PUT, PATCH or DELETE to the API,
+	// recorded besides the change it made, if any
+	OperationAPIRequest = "api.request"
+)
+
+// Origins of a change
+const (
+	OriginCLI = "cli"
+	OriginAPI = "api"
+)
+
+// Outcomes of a change
+const (
+	OutcomeSuccess = "success"
+	OutcomePartial = "partial"
+	OutcomeFailed  = "failed"
+	OutcomeRefused = "refused"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of the webhook body, as
+// "sha256=<hex>", when a webhook secret is configured.
+const SignatureHeader = "X-Ldapmerge-Signature"
+
+// ErrReasonRequired is returned by CheckReason for an empty reason.
+var ErrReasonRequired = errors.New("a reason is required for changes to NSX identity sources")
+
+// CheckReason checks that a reason was given for a change.
+func CheckReason(reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return ErrReasonRequired
+	}
+	return nil
+}
+
+// Outcome returns the outcome of a change that succeeded for succeeded
+// sources and failed for failed ones.
+func Outcome(succeeded, failed int) string {
+	switch {
+	case failed == 0:
+		return OutcomeSuccess
+	case succeeded == 0:
+		return OutcomeFailed
+	default:
+		return OutcomePartial
+	}
+}
+
+// Store persists audit events; *repository.Repository implements it.
+type Store interface {
+	AddAuditEvent(ctx context.Context, event *models.AuditEvent) error
+}
+
+// Recorder stores audit events and forwards them to a webhook.
+type Recorder struct {
+	store   Store
+	webhook *Webhook
+}
+
+// NewRecorder returns a recorder that stores events in store and, if
+// webhook is not nil, posts them to it.
+func NewRecorder(store Store, webhook *Webhook) *Recorder {
+	return &Recorder{store: store, webhook: webhook}
+}
+
+// Record stores event, with the run ID of ctx unless it has one, and posts
+// it to the webhook. Only a storage failure is returned: the audit log is authoritative, the webhook a notification.
+func (r *Recorder) Record(ctx context.Context, event *models.AuditEvent) error {
+	event.Reason = strings.TrimSpace(event.Reason)
+	if event.RunID == "" {
+		event.RunID, _ = runid.From(ctx)
+	}
+	if err := r.store.AddAuditEvent(ctx, event); err != nil {
+		return err
+	}
+
+	if r.webhook != nil {
+		if err := r.webhook.Send(ctx, event); err != nil {
+			slog.Warn("audit webhook failed", "audit_id", event.ID, "url", r.webhook.URL, "error", err)
+		}
+	}
+	return nil
+}
+
+// Webhook posts audit events as JSON to a URL.
+type Webhook struct {
+	URL    string
+	Secret string // signs the body in SignatureHeader; empty for none
+	Client *http.Client
+}
+
+// NewWebhook returns a webhook for url with the given request timeout.
+func NewWebhook(url, secret string, timeout time.Duration) *Webhook {
+	return &Webhook{URL: url, Secret: secret, Client: &http.Client{Timeout: timeout}}
+}
+
+// Send posts event to the webhook. Any status other than 2xx is an error.
+func (w *Webhook) Send(ctx context.Context, event *models.AuditEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package audit_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/runid"
+)
+
+// memStore keeps audit events in memory.
+type memStore struct {
+	events []models.AuditEvent
+	err    error
+}
+
+func (m *memStore) AddAuditEvent(_ context.Context, event *models.AuditEvent) error {
+	if m.err != nil {
+		return m.err
+	}
+	event.ID = int64(len(m.events) + 1)
+	m.events = append(m.events, *event)
+	return nil
+}
+
+func TestRecordWebhook(t *testing.T) {
+	var got models.AuditEvent
+	var signature string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(audit.SignatureHeader)
+		_ = json.Unmarshal(body, &got)
+	}))
+	defer srv.Close()
+
+	store := &memStore{}
+	rec := audit.NewRecorder(store, audit.NewWebhook(srv.URL, "secret", time.Second))
+
+	event := &models.AuditEvent{
+		Operation: audit.OperationNSXDelete,
+		Origin:    audit.OriginCLI,
+		NSXHost:   "https://nsx.example.com",
+		SourceIDs: []string{"example.lab"},
+		Reason:    "  CHG-1234 ",
+		Outcome:   audit.OutcomeSuccess,
+	}
+	if err := rec.Record(runid.With(context.Background(), "run-1"), event); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	if len(store.events) != 1 || store.events[0].Reason != "CHG-1234" {
+		t.Fatalf("Expected one stored event with a trimmed reason, got %+v", store.events)
+	}
+	if got.ID != 1 || got.Reason != "CHG-1234" || got.Operation != audit.OperationNSXDelete || got.RunID != "run-1" {
+		t.Errorf("Expected the stored event in the webhook payload, got %+v", got)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("Expected signature %s, got %s", want, signature)
+	}
+}
+
+func TestRecordErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	// A failing webhook does not fail the record
+	store := &memStore{}
+	rec := audit.NewRecorder(store, audit.NewWebhook(srv.URL, "", time.Second))
+	if err := rec.Record(context.Background(), &models.AuditEvent{Reason: "test"}); err != nil {
+		t.Errorf("Expected webhook failure to be ignored, got %v", err)
+	}
+	if err := audit.NewWebhook(srv.URL, "", time.Second).Send(context.Background(), &models.AuditEvent{}); err == nil {
+		t.Error("Expected error for a 500 webhook response")
+	}
+
+	// A failing store does
+	storeErr := errors.New("disk full")
+	rec = audit.NewRecorder(&memStore{err: storeErr}, nil)
+	if err := rec.Record(context.Background(), &models.AuditEvent{Reason: "test"}); !errors.Is(err, storeErr) {
+		t.Errorf("Expected store error, got %v", err)
+	}
+}
+
+func TestCheckReason(t *testing.T) {
+	if err := audit.CheckReason(" \t"); !errors.Is(err, audit.ErrReasonRequired) {
+		t.Errorf("Expected ErrReasonRequired for a blank reason, got %v", err)
+	}
+	if err := audit.CheckReason("CHG-1234"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	for _, tt := range []struct {
+		succeeded, failed int
+		want              string
+	}{
+		{2, 0, audit.OutcomeSuccess},
+		{1, 1, audit.OutcomePartial},
+		{0, 2, audit.OutcomeFailed},
+	} {
+		if got := audit.Outcome(tt.succeeded, tt.failed); got != tt.want {
+			t.Errorf("Outcome(%d, %d) = %s; expected %s", tt.succeeded, tt.failed, got, tt.want)
+		}
+	}
+}
+
+func TestGuard(t *testing.T) {
+	g, err := audit.NewGuard([]string{"prod.*", " *.Corp.Example.com ", ""})
+	if err != nil {
+		t.Fatalf("NewGuard failed: %v", err)
+	}
+
+	ids := []string{"prod.lab", "example.lab", "ad.corp.example.com", "PROD.example"}
+	protected := g.Protected(ids)
+	if want := []string{"prod.lab", "ad.corp.example.com", "PROD.example"}; !slices.Equal(protected, want) {
+		t.Errorf("Expected %v protected, got %v", want, protected)
+	}
+
+	var perr *audit.ProtectedError
+	if _, err := g.Check(ids, false); !errors.As(err, &perr) || len(perr.IDs) != 3 {
+		t.Errorf("Expected ProtectedError for 3 sources, got %v", err)
+	}
+	if got, err := g.Check(ids, true); err != nil || len(got) != 3 {
+		t.Errorf("Expected forced change to pass with 3 protected sources, got %v, %v", got, err)
+	}
+	if _, err := g.Check([]string{"example.lab"}, false); err != nil {
+		t.Errorf("Expected unprotected change to pass, got %v", err)
+	}
+
+	if _, err := audit.NewGuard([]string{"prod.[a"}); err == nil {
+		t.Error("Expected error for an invalid pattern")
+	}
+	var none *audit.Guard
+	if got := none.Protected(ids); got != nil {
+		t.Errorf("Expected nil guard to protect nothing, got %v", got)
+	}
+}
@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Guard protects identity sources whose IDs match one of a set of glob
+// patterns (path.Match syntax, case-insensitive) from changes that were not
+// explicitly forced.
+type Guard struct {
+	patterns []string
+}
+
+// NewGuard returns a guard for patterns such as "prod.*" or "*.corp.example.com".
+func NewGuard(patterns []string) (*Guard, error) {
+	g := &Guard{}
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid protected source pattern %q: %w", p, err)
+		}
+		g.patterns = append(g.patterns, p)
+	}
+	return g, nil
+}
+
+// Protected returns the IDs among ids that match a protected pattern, in
+// order. A nil guard protects nothing.
+func (g *Guard) Protected(ids []string) []string {
+	if g == nil {
+		return nil
+	}
+
+	var out []string
+	for _, id := range ids {
+		for _, p := range g.patterns {
+			if ok, _ := path.Match(p, strings.ToLower(id)); ok {
+				out = append(out, id)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// ProtectedError refuses an unforced change to protected identity sources.
+type ProtectedError struct {
+	IDs []string
+}
+
+func (e *ProtectedError) Error() string {
+	return fmt.Sprintf("identity sources are protected: %s", strings.Join(e.IDs, ", "))
+}
+
+// Check returns a *ProtectedError if ids include protected sources and
+// force is false, and the protected IDs either way.
+func (g *Guard) Check(ids []string, force bool) ([]string, error) {
+	protected := g.Protected(ids)
+	if len(protected) > 0 && !force {
+		return protected, &ProtectedError{IDs: protected}
+	}
+	return protected, nil
+}
@@ -0,0 +1,368 @@
+// Package bundle packs the pulled configuration, certificate response and
+// merged result of a sync into one signed archive, so that a merge made
+// where the certificates are collected can be carried to and pushed from a
+// network that reaches an air-gapped NSX Manager.
+//
+// An archive is a .tar.gz or .zip holding manifest.json, which records the
+// SHA-256 of every other file, a detached signature of the manifest
+// (manifest.json.sig or .asc, see package signing) and the JSON documents.
+package bundle
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/signing"
+)
+
+// FormatVersion is the manifest version written by this package.
+const FormatVersion = 1
+
+// Files of an archive
+const (
+	FileManifest = "manifest.json"
+	FilePulled   = "pulled.json"
+	FileResponse = "response.json"
+	FileResult   = "result.json"
+)
+
+// maxFileSize bounds each file read from an archive.
+const maxFileSize = 256 << 20
+
+var (
+	// ErrUnsigned is returned when verifying an archive without a signature.
+	ErrUnsigned = errors.New("bundle is not signed")
+	// ErrCorrupt is returned when an archive does not match its manifest.
+	ErrCorrupt = errors.New("bundle is corrupt")
+)
+
+// Format is an archive format.
+type Format string
+
+// Archive formats
+const (
+	FormatTarGz Format = "tar.gz"
+	FormatZip   Format = "zip"
+)
+
+// FormatOf returns the archive format of a file name: .tar.gz, .tgz or .zip.
+func FormatOf(name string) (Format, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FormatTarGz, nil
+	case strings.HasSuffix(lower, ".zip"):
+		return FormatZip, nil
+	}
+	return "", fmt.Errorf("unknown bundle format of %s (want .tar.gz, .tgz or .zip)", name)
+}
+
+// Manifest describes the contents of an archive.
+type Manifest struct {
+	Version   int                `json:"version"`
+	CreatedAt time.Time          `json:"created_at"`
+	Creator   string             `json:"creator"`          // ldapmerge version
+	Source    string             `json:"source,omitempty"` // where the configuration was pulled from
+	Files     map[string]string  `json:"files"`            // file name to SHA-256
+	Stats     *models.MergeStats `json:"stats,omitempty"`
+}
+
+// Bundle is the content of an archive.
+type Bundle struct {
+	Manifest Manifest
+	Pulled   []models.Domain
+	Response *models.CertificateResponse
+	Result   []models.Domain
+}
+
+// Write writes b as an archive in format, with the manifest signed by
+// signer unless it is nil. The file hashes of the manifest are filled in.
+func Write(ctx context.Context, w io.Writer, format Format, b *Bundle, signer signing.Signer) error {
+	files := []struct {
+		name string
+		v    any
+	}{
+		{FilePulled, b.Pulled},
+		{FileResponse, b.Response},
+		{FileResult, b.Result},
+	}
+
+	var entries []entry
+	b.Manifest.Version = FormatVersion
+	b.Manifest.Files = make(map[string]string, len(files))
+	for _, f := range files {
+		data, err := json.MarshalIndent(f.v, "", "    ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", f.name, err)
+		}
+		b.Manifest.Files[f.name] = sha256Hex(data)
+		entries = append(entries, entry{f.name, data})
+	}
+
+	manifest, err := json.MarshalIndent(b.Manifest, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	head := []entry{{FileManifest, manifest}}
+	if signer != nil {
+		sig, err := signer.Sign(ctx, manifest)
+		if err != nil {
+			return fmt.Errorf("failed to sign manifest: %w", err)
+		}
+		head = append(head, entry{FileManifest + signer.Extension(), sig})
+	}
+	entries = append(head, entries...)
+
+	switch format {
+	case FormatTarGz:
+		return writeTarGz(w, entries, b.Manifest.CreatedAt)
+	case FormatZip:
+		return writeZip(w, entries, b.Manifest.CreatedAt)
+	}
+	return fmt.Errorf("unknown bundle format %q", format)
+}
+
+// Archive is a bundle read from an archive.
+type Archive struct {
+	Bundle
+	files     map[string][]byte
+	manifest  []byte
+	signature []byte
+}
+
+// Signed reports whether the archive has a signature.
+func (a *Archive) Signed() bool {
+	return a.signature != nil
+}
+
+// Verify checks the signature of the manifest, which covers every file, with
+// pub for Ed25519 signatures or the local keyring for GPG ones.
+func (a *Archive) Verify(ctx context.Context, pub ed25519.PublicKey) (*signing.Result, error) {
+	switch {
+	case a.signature == nil:
+		return nil, ErrUnsigned
+	case signing.IsGPG(a.signature):
+		return signing.VerifyGPG(ctx, a.manifest, a.signature)
+	case pub == nil:
+		return nil, errors.New("a public key is required to verify an Ed25519-signed bundle")
+	}
+	return signing.VerifyEd25519(a.manifest, a.signature, pub)
+}
+
+// Open reads the archive at name and checks its files against the manifest.
+// The signature is not verified; see Archive.Verify.
+func Open(name string) (*Archive, error) {
+	format, err := FormatOf(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var entries []entry
+	switch format {
+	case FormatTarGz:
+		entries, err = readTarGz(f)
+	case FormatZip:
+		var info os.FileInfo
+		if info, err = f.Stat(); err == nil {
+			entries, err = readZip(f, info.Size())
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return parse(entries)
+}
+
+// parse decodes and checks the entries of an archive.
+func parse(entries []entry) (*Archive, error) {
+	files := make(map[string][]byte, len(entries))
+	for _, e := range entries {
+		// Files are extracted by name, so they must stay in the target directory
+		if strings.ContainsAny(e.name, `/\`) || e.name == ".." {
+			return nil, fmt.Errorf("%w: invalid file name %q", ErrCorrupt, e.name)
+		}
+		if _, dup := files[e.name]; dup {
+			return nil, fmt.Errorf("%w: duplicate file %s", ErrCorrupt, e.name)
+		}
+		files[e.name] = e.data
+	}
+
+	a := &Archive{files: files, manifest: files[FileManifest]}
+	if a.manifest == nil {
+		return nil, fmt.Errorf("%w: no %s", ErrCorrupt, FileManifest)
+	}
+	if err := json.Unmarshal(a.manifest, &a.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %v", ErrCorrupt, err)
+	}
+	if a.Manifest.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", a.Manifest.Version)
+	}
+	for _, ext := range []string{".sig", ".asc"} {
+		if sig, ok := files[FileManifest+ext]; ok {
+			a.signature = sig
+		}
+	}
+
+	for name := range files {
+		_, listed := a.Manifest.Files[name]
+		if !listed && name != FileManifest && name != FileManifest+".sig" && name != FileManifest+".asc" {
+			return nil, fmt.Errorf("%w: %s is not in the manifest", ErrCorrupt, name)
+		}
+	}
+	targets := map[string]any{FilePulled: &a.Pulled, FileResponse: &a.Response, FileResult: &a.Result}
+	for name, sum := range a.Manifest.Files {
+		data, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is missing", ErrCorrupt, name)
+		}
+		if sha256Hex(data) != sum {
+			return nil, fmt.Errorf("%w: %s does not match the manifest", ErrCorrupt, name)
+		}
+		target, known := targets[name]
+		if !known {
+			continue
+		}
+		if err := json.Unmarshal(data, target); err != nil {
+			return nil, fmt.Errorf("%w: invalid %s: %v", ErrCorrupt, name, err)
+		}
+	}
+	if a.Result == nil {
+		return nil, fmt.Errorf("%w: no %s", ErrCorrupt, FileResult)
+	}
+	return a, nil
+}
+
+// Files returns the files of the archive by name, including the manifest
+// and its signature.
+func (a *Archive) Files() map[string][]byte {
+	return maps.Clone(a.files)
+}
+
+// entry is a file of an archive.
+type entry struct {
+	name string
+	data []byte
+}
+
+func writeTarGz(w io.Writer, entries []entry, modTime time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0o600, Size: int64(len(e.data)), ModTime: modTime, Format: tar.FormatPAX}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func writeZip(w io.Writer, entries []entry, modTime time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: modTime})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(e.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func readTarGz(r io.Reader) ([]entry, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(gz)
+
+	var entries []entry
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := readLimited(tr, header.Name)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{path.Clean(header.Name), data})
+	}
+}
+
+func readZip(r io.ReaderAt, size int64) ([]entry, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]entry, 0, len(zr.File))
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := readLimited(rc, f.Name)
+		_ = rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{path.Clean(f.Name), data})
+	}
+	return entries, nil
+}
+
+// readLimited reads a file of an archive of at most maxFileSize bytes.
+func readLimited(r io.Reader, name string) ([]byte, error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > maxFileSize {
+		return nil, fmt.Errorf("%s is larger than %d bytes", name, maxFileSize)
+	}
+	return buf.Bytes(), nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
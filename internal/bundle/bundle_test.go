@@ -0,0 +1,140 @@
+package bundle_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/bundle"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/signing"
+)
+
+// newSigner writes a fresh Ed25519 key and returns its signer and public key.
+func newSigner(t *testing.T) (*signing.Ed25519Signer, ed25519.PublicKey) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := signing.NewEd25519Signer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, pub
+}
+
+func testBundle() *bundle.Bundle {
+	server := models.LDAPServer{URL: "ldaps://ad-01.example.lab:636", StartTLS: "false", Enabled: "true"}
+	pulled := []models.Domain{{ID: "example.lab", DomainName: "example.lab", LDAPServers: []models.LDAPServer{server}}}
+	result := []models.Domain{pulled[0]}
+	result[0].LDAPServers = []models.LDAPServer{server}
+	result[0].LDAPServers[0].Certificates = []string{"-----BEGIN CERTIFICATE-----\nMIIC\n-----END CERTIFICATE-----"}
+
+	return &bundle.Bundle{
+		Manifest: bundle.Manifest{CreatedAt: time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC), Creator: "test"},
+		Pulled:   pulled,
+		Response: &models.CertificateResponse{Results: []models.CertificateResult{{Item: models.ResponseItem{URL: server.URL}}}},
+		Result:   result,
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	signer, pub := newSigner(t)
+	_, otherPub := newSigner(t)
+	ctx := context.Background()
+
+	for _, name := range []string{"bundle.tar.gz", "bundle.zip"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			format, err := bundle.FormatOf(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := bundle.Write(ctx, &buf, format, testBundle(), signer); err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+			if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			archive, err := bundle.Open(path)
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			if len(archive.Result) != 1 || len(archive.Result[0].LDAPServers[0].Certificates) != 1 || len(archive.Pulled) != 1 {
+				t.Errorf("Unexpected content %+v", archive.Bundle)
+			}
+			if len(archive.Files()) != 5 {
+				t.Errorf("Expected manifest, signature and 3 documents, got %d files", len(archive.Files()))
+			}
+
+			if _, err := archive.Verify(ctx, pub); err != nil {
+				t.Errorf("Verify failed: %v", err)
+			}
+			if _, err := archive.Verify(ctx, otherPub); !errors.Is(err, signing.ErrInvalidSignature) {
+				t.Errorf("Expected invalid signature with another key, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUnsignedAndTampered(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+
+	var buf bytes.Buffer
+	if err := bundle.Write(ctx, &buf, bundle.FormatZip, testBundle(), nil); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := bundle.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := archive.Verify(ctx, nil); !errors.Is(err, bundle.ErrUnsigned) {
+		t.Errorf("Expected ErrUnsigned, got %v", err)
+	}
+
+	// Rewrite the archive with an edited result
+	files := archive.Files()
+	files[bundle.FileResult] = bytes.Replace(files[bundle.FileResult], []byte("ad-01"), []byte("ad-99"), 1)
+	var tampered bytes.Buffer
+	zw := zip.NewWriter(&tampered)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, tampered.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bundle.Open(path); !errors.Is(err, bundle.ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for an edited file, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/features"
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+)
+
+var (
+	// auditReason justifies a change to NSX identity sources (--reason)
+	auditReason string
+	// forceProtected allows changes to protected identity sources
+	// (--force-protected)
+	forceProtected bool
+)
+
+// getAuditWebhook returns the webhook configured in the "audit:" config
+// section, or nil, as when the webhooks feature is disabled.
+func getAuditWebhook() *audit.Webhook {
+	url := viper.GetString("audit.webhook_url")
+	if url == "" || !enabledFeatures.Enabled(features.Webhooks) {
+		return nil
+	}
+	timeout := viper.GetDuration("audit.webhook_timeout")
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return audit.NewWebhook(url, viper.GetString("audit.webhook_secret"), timeout)
+}
+
+// getProtectedGuard returns the guard of the identity source ID patterns
+// listed in audit.protected_sources. The environment variable takes a
+// comma-separated list.
+func getProtectedGuard() (*audit.Guard, error) {
+	var patterns []string
+	for _, p := range viper.GetStringSlice("audit.protected_sources") {
+		patterns = append(patterns, strings.Split(p, ",")...)
+	}
+	return audit.NewGuard(patterns)
+}
+
+// auditLog records the changes a command makes to NSX identity sources.
+type auditLog struct {
+	repo      *repository.Repository
+	recorder  *audit.Recorder
+	guard     *audit.Guard
+	protected []string // protected sources changed with --force-protected
+}
+
+// openAuditLog checks --reason and opens the audit log. Commands call it
+// before changing anything, so that no change is made that cannot be recorded.
+func openAuditLog() (*auditLog, error) {
+	if err := audit.CheckReason(auditReason); err != nil {
+		return nil, fmt.Errorf("%w: use --reason", err)
+	}
+	guard, err := getProtectedGuard()
+	if err != nil {
+		return nil, fmt.Errorf("invalid audit.protected_sources: %w", err)
+	}
+
+	repo, err := repository.New(getDBPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &auditLog{repo: repo, recorder: audit.NewRecorder(repo, getAuditWebhook()), guard: guard}, nil
+}
+
+// checkProtected refuses operation on sourceIDs if any of them is protected
+// and --force-protected is not set. The refusal is recorded in the audit log.
+func (a *auditLog) checkProtected(ctx context.Context, log *slog.Logger, operation string, sourceIDs []string) error {
+	protected, err := a.guard.Check(sourceIDs, forceProtected)
+	if err != nil {
+		log.Error("change to protected identity sources refused", "protected", protected)
+		event := a.newEvent(operation, sourceIDs)
+		event.Protected = protected
+		event.Outcome = audit.OutcomeRefused
+		event.Error = err.Error()
+		if recErr := a.store(ctx, log, event); recErr != nil {
+			return recErr
+		}
+		return fmt.Errorf("%w; use --force-protected to change them", err)
+	}
+
+	if len(protected) > 0 {
+		log.Warn("changing protected identity sources", "protected", protected)
+		fmt.Println(i18n.T("audit.protected.forced", strings.Join(protected, ", ")))
+	}
+	a.protected = protected
+	return nil
+}
+
+// record stores the outcome of operation on sourceIDs; firstErr is the
+// first error NSX reported, if any.
+func (a *auditLog) record(ctx context.Context, log *slog.Logger, operation string, sourceIDs []string, succeeded, failed int, firstErr error) error {
+	event := a.newEvent(operation, sourceIDs)
+	event.Protected = a.protected
+	event.Outcome = audit.Outcome(succeeded, failed)
+	if firstErr != nil {
+		event.Error = firstErr.Error()
+	}
+	return a.store(ctx, log, event)
+}
+
+func (a *auditLog) newEvent(operation string, sourceIDs []string) *models.AuditEvent {
+	return &models.AuditEvent{
+		Operation: operation,
+		Origin:    audit.OriginCLI,
+		Actor:     currentUser(),
+		NSXHost:   nsxHost,
+		SourceIDs: sourceIDs,
+		Reason:    auditReason,
+	}
+}
+
+func (a *auditLog) store(ctx context.Context, log *slog.Logger, event *models.AuditEvent) error {
+	// Record interrupted operations too
+	if err := a.recorder.Record(context.WithoutCancel(ctx), event); err != nil {
+		log.Error("audit event not recorded", "error", err)
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	log.Info("audit event recorded", "audit_id", event.ID, "outcome", event.Outcome)
+	return nil
+}
+
+func (a *auditLog) Close() error {
+	return a.repo.Close()
+}
+
+// currentUser returns the name of the operating system user running the CLI.
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"ldapmerge/internal/credentials"
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/nsx"
+)
+
+var (
+	// bindPasswordsFile maps LDAP server URLs to bind passwords
+	// (--bind-passwords)
+	bindPasswordsFile string
+	// promptBindPasswords asks for the bind passwords found nowhere else
+	// (--prompt-bind-passwords)
+	promptBindPasswords bool
+	// clearBindPasswords puts sources lacking bind passwords instead of
+	// patching them (--clear-bind-passwords)
+	clearBindPasswords bool
+)
+
+// bindPasswordsSetting is the setting of --bind-passwords
+var bindPasswordsSetting = setting{Key: "nsx.bind_passwords_file", Flag: "bind-passwords"}
+
+// addBindPasswordFlags adds --bind-passwords and --prompt-bind-passwords to a
+// command that pushes to NSX.
+func addBindPasswordFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&bindPasswordsFile, "bind-passwords", "", "YAML or JSON file mapping LDAP server URLs to bind passwords, set on servers pushed without one")
+	cmd.Flags().BoolVar(&promptBindPasswords, "prompt-bind-passwords", false, "ask on the terminal for bind passwords not found in --bind-passwords or "+credentials.EnvVar)
+	registerSettings(cmd, bindPasswordsSetting)
+}
+
+// addClearBindPasswordsFlag adds --clear-bind-passwords to a command that
+// pushes sources with nsx.Client.PushLDAPIdentitySource.
+func addClearBindPasswordsFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&clearBindPasswords, "clear-bind-passwords", false, "replace sources with PUT even if servers lack a bind password, clearing the one NSX has (default: PATCH, which keeps it)")
+	registerSettings(cmd, setting{Key: "nsx.clear_bind_passwords", Flag: "clear-bind-passwords"})
+}
+
+// getBindPasswords loads the bind passwords of --bind-passwords and
+// LDAPMERGE_BIND_PASSWORDS; the environment wins.
+func getBindPasswords() (*credentials.BindPasswords, error) {
+	passwords := credentials.New()
+	if bindPasswordsFile != "" {
+		if err := passwords.LoadFile(bindPasswordsFile); err != nil {
+			return nil, err
+		}
+	}
+	if err := passwords.LoadEnv(); err != nil {
+		return nil, err
+	}
+	return passwords, nil
+}
+
+// injectBindPasswords sets bind passwords on the servers inject visits,
+// asking for missing ones with --prompt-bind-passwords. inject returns the
+// URLs of the servers it left without one. If kept, NSX keeps their bind
+// passwords and they are only listed; otherwise pushing them clears the
+// passwords, which is reported as a warning.
+func injectBindPasswords(log *slog.Logger, kept bool, inject func(*credentials.BindPasswords) ([]string, error)) error {
+	passwords, err := getBindPasswords()
+	if err != nil {
+		return err
+	}
+
+	missing, err := inject(passwords)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 && promptBindPasswords {
+		if err := promptForBindPasswords(passwords, uniqueSorted(missing)); err != nil {
+			return err
+		}
+		if missing, err = inject(passwords); err != nil {
+			return err
+		}
+	}
+
+	missing = uniqueSorted(missing)
+	switch {
+	case len(missing) == 0:
+	case kept:
+		log.Info("patching LDAP servers without a bind password, NSX keeps theirs", "urls", missing)
+		fmt.Println(i18n.T("nsx.push.bind_password_kept", strings.Join(missing, ", ")))
+	default:
+		log.Warn("pushing LDAP servers without a bind password", "urls", missing)
+		fmt.Fprintln(os.Stderr, i18n.T("nsx.push.bind_password_missing", strings.Join(missing, ", ")))
+	}
+	return nil
+}
+
+// injectSourceBindPasswords is injectBindPasswords for sources pushed by
+// pushSource.
+func injectSourceBindPasswords(log *slog.Logger, sources []nsx.LDAPIdentitySource) error {
+	return injectBindPasswords(log, !clearBindPasswords, func(passwords *credentials.BindPasswords) ([]string, error) {
+		var missing []string
+		for i := range sources {
+			missing = append(missing, passwords.Inject(&sources[i])...)
+		}
+		return missing, nil
+	})
+}
+
+// promptForBindPasswords reads the bind password of each of urls from the
+// terminal without echo. An empty answer leaves the server without one.
+func promptForBindPasswords(passwords *credentials.BindPasswords, urls []string) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return fmt.Errorf("--prompt-bind-passwords needs a terminal on stdin")
+	}
+
+	for _, url := range urls {
+		fmt.Fprint(os.Stderr, i18n.T("nsx.push.bind_password_prompt", url))
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return fmt.Errorf("failed to read bind password: %w", err)
+		}
+		if len(password) > 0 {
+			passwords.Set(url, string(password))
+		}
+	}
+	return nil
+}
+
+// uniqueSorted returns values sorted and without duplicates.
+func uniqueSorted(values []string) []string {
+	values = slices.Clone(values)
+	slices.Sort(values)
+	return slices.Compact(values)
+}
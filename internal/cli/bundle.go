@@ -0,0 +1,324 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/bundle"
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/signing"
+	"ldapmerge/internal/version"
+)
+
+var (
+	bundleOutput        string
+	bundleSource        string
+	bundleUnsigned      bool
+	bundleDir           string
+	bundlePublicKey     string
+	bundleAllowUnsigned bool
+)
+
+// bundleCmd represents the bundle command group
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "📦 Signed bundles for air-gapped NSX Managers",
+	Long: `Carry a merge to an NSX Manager that cannot be reached from where the
+certificates are collected.
+
+A bundle is a .tar.gz or .zip with the pulled configuration, the certificate
+response, the merged result and a manifest of their SHA-256 hashes. The
+manifest is signed with the key of the "signing:" config section, like merge
+output (see ldapmerge verify-output --help), so the bundle cannot be edited
+on the way without the signature check failing.
+
+Available operations:
+  export - Merge and pack a bundle, on the side that collects certificates
+  import - Verify a bundle and extract its files, on the NSX side
+  push   - Verify a bundle and push its merged result to NSX`,
+}
+
+// bundleExportCmd merges and packs a bundle
+var bundleExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Merge and pack a bundle",
+	Long: `Merge the pulled configuration with the certificate response and pack
+the three into a signed bundle. The format follows the extension of
+--output: .tar.gz, .tgz or .zip.
+
+Signing is required unless --unsigned is set.`,
+	Example: `  # On the NSX side: pull and carry pulled.json over
+  ldapmerge nsx pull --profile prod -P secret > pulled.json
+
+  # Where the certificates are collected
+  ldapmerge bundle export -i pulled.json -r response.json -o bundle.tar.gz --source nsx-prod`,
+	Args:         cobra.NoArgs,
+	RunE:         runBundleExport,
+	SilenceUsage: true,
+}
+
+// bundleImportCmd verifies a bundle and extracts its files
+var bundleImportCmd = &cobra.Command{
+	Use:   "import <bundle>",
+	Short: "Verify a bundle and extract its files",
+	Long: `Check the files of a bundle against its manifest, verify the signature of
+the manifest and write the files to --dir for review.
+
+Ed25519 signatures are verified with --public-key, GPG signatures with the
+local keyring. Unsigned bundles are refused unless --allow-unsigned is set.`,
+	Example:      `  ldapmerge bundle import bundle.tar.gz --public-key signing.pub -d ./bundle`,
+	Args:         cobra.ExactArgs(1),
+	RunE:         runBundleImport,
+	SilenceUsage: true,
+}
+
+// bundlePushCmd verifies a bundle and pushes its merged result
+var bundlePushCmd = &cobra.Command{
+	Use:   "push <bundle>",
+	Short: "Verify a bundle and push its merged result to NSX",
+	Long: `Verify a bundle as bundle import does, then push its merged result to NSX
+Manager as nsx push does: with bind passwords injected, protected sources
+checked and a snapshot taken first. The push is audited as bundle.push.
+
+Sources changed on NSX since the configuration in the bundle was pulled are
+refused as revision conflicts unless --retry-conflicts is set.`,
+	Example: `  ldapmerge bundle push bundle.tar.gz --public-key signing.pub \
+    --profile prod -P secret --reason "CHG-1234: renew AD certificates"`,
+	Args:         cobra.ExactArgs(1),
+	PreRunE:      requireNSXConnection,
+	RunE:         runBundlePush,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+	bundleCmd.AddCommand(bundleExportCmd)
+	bundleCmd.AddCommand(bundleImportCmd)
+	bundleCmd.AddCommand(bundlePushCmd)
+
+	bundleExportCmd.Flags().StringVarP(&initialFile, "initial", "i", "", "pulled JSON location: path, URL or - for stdin (required)")
+	bundleExportCmd.Flags().StringVarP(&responseFile, "response", "r", "", "response JSON or .zip/.tar.gz location: path, URL or - for stdin (required)")
+	bundleExportCmd.Flags().StringVarP(&bundleOutput, "output", "o", "", "bundle path: .tar.gz, .tgz or .zip (required)")
+	bundleExportCmd.Flags().StringVar(&bundleSource, "source", "", "where the configuration was pulled from, recorded in the manifest (e.g. the NSX Manager)")
+	bundleExportCmd.Flags().BoolVar(&bundleUnsigned, "unsigned", false, "allow an unsigned bundle when signing is not configured")
+	_ = bundleExportCmd.MarkFlagRequired("initial")
+	_ = bundleExportCmd.MarkFlagRequired("response")
+	_ = bundleExportCmd.MarkFlagRequired("output")
+	addMergeFlags(bundleExportCmd)
+
+	for _, c := range []*cobra.Command{bundleImportCmd, bundlePushCmd} {
+		c.Flags().StringVar(&bundlePublicKey, "public-key", "", "path to Ed25519 public key (PEM) for .sig signatures")
+		c.Flags().BoolVar(&bundleAllowUnsigned, "allow-unsigned", false, "accept a bundle without a signature")
+	}
+	bundleImportCmd.Flags().StringVarP(&bundleDir, "dir", "d", ".", "directory to write the files to")
+
+	// NSX connection flags (same as nsx command)
+	bundlePushCmd.Flags().StringVar(&profileName, "profile", "", "connection profile from the config file (see ldapmerge nsx --help)")
+	bundlePushCmd.Flags().StringVar(&nsxHost, "host", "", "NSX Manager host URL (required unless set by --profile)")
+	bundlePushCmd.Flags().StringVarP(&nsxUsername, "username", "u", "", "NSX API username (required unless set by --profile)")
+	bundlePushCmd.Flags().StringVarP(&nsxPassword, "password", "P", "", "NSX API password (required unless set by LDAPMERGE_NSX_PASSWORD)")
+	bundlePushCmd.Flags().BoolVarP(&nsxInsecure, "insecure", "k", false, "Skip TLS certificate verification")
+	bundlePushCmd.Flags().IntVar(&nsxTimeout, "timeout", 30, "API request timeout in seconds")
+	bundlePushCmd.Flags().StringVar(&dbPath, "db", "", "path to SQLite database for the audit log (default: ldapmerge/data.db in the user config directory)")
+	bundlePushCmd.Flags().StringVar(&auditReason, "reason", "", "justification for the push, stored in the audit log (required)")
+	_ = bundlePushCmd.MarkFlagRequired("reason")
+	bundlePushCmd.Flags().BoolVar(&forceProtected, "force-protected", false, "allow pushing sources matching audit.protected_sources")
+	addRealizationFlag(bundlePushCmd)
+	addRetryConflictsFlag(bundlePushCmd)
+	addPushConcurrencyFlags(bundlePushCmd)
+	addSimulateFlags(bundlePushCmd)
+	addBindPasswordFlags(bundlePushCmd)
+	addClearBindPasswordsFlag(bundlePushCmd)
+
+	registerSettings(bundlePushCmd, nsxSettings...)
+	_ = bundlePushCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+}
+
+func runBundleExport(cmd *cobra.Command, args []string) error {
+	startTime := time.Now()
+	ctx := cmd.Context()
+
+	log := slog.With(
+		"command", "bundle.export",
+		"initial_file", initialFile,
+		"response_file", responseFile,
+		"bundle", bundleOutput,
+	)
+
+	format, err := bundle.FormatOf(bundleOutput)
+	if err != nil {
+		return err
+	}
+	signer, err := getSigner()
+	if err != nil {
+		return err
+	}
+	if signer == nil && !bundleUnsigned {
+		return errors.New(`signing is not configured: set signing.key or signing.gpg_key, or use --unsigned`)
+	}
+
+	opts, err := getMergeOptions(cmd)
+	if err != nil {
+		return err
+	}
+	m := merger.NewWithOptions(opts)
+
+	pulled, err := m.LoadInitial(ctx, initialFile)
+	if err != nil {
+		return fmt.Errorf("failed to load initial file: %w", err)
+	}
+	response, err := m.LoadResponse(ctx, responseFile)
+	if err != nil {
+		return fmt.Errorf("failed to load response file: %w", err)
+	}
+	if err := m.Validate(pulled, response); err != nil {
+		log.Error("merge validation failed", "error", err)
+		return fmt.Errorf("merge failed: %w", err)
+	}
+	warnWeakCertificates(log, opts.Weak, response)
+
+	result, stats, err := m.MergeWithStats(ctx, pulled, response)
+	if err != nil {
+		log.Error("merge failed", "error", err)
+		return fmt.Errorf("merge failed: %w", err)
+	}
+
+	b := &bundle.Bundle{
+		Manifest: bundle.Manifest{
+			CreatedAt: time.Now().UTC().Truncate(time.Second),
+			Creator:   version.Info(),
+			Source:    bundleSource,
+			Stats:     &stats,
+		},
+		Pulled:   pulled,
+		Response: response,
+		Result:   result,
+	}
+	var buf bytes.Buffer
+	if err := bundle.Write(ctx, &buf, format, b, signer); err != nil {
+		return err
+	}
+	if err := os.WriteFile(bundleOutput, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	log.Info("bundle exported",
+		"domains_count", len(result),
+		"signed", signer != nil,
+		"duration", time.Since(startTime),
+	)
+
+	fmt.Println(i18n.T("bundle.exported", bundleOutput, len(result), stats.ResultCertificates))
+	if signer == nil {
+		fmt.Fprintln(os.Stderr, i18n.T("bundle.unsigned"))
+	}
+	return nil
+}
+
+func runBundleImport(cmd *cobra.Command, args []string) error {
+	log := slog.With(
+		"command", "bundle.import",
+		"bundle", args[0],
+	)
+
+	archive, err := openBundle(cmd.Context(), log, args[0])
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(bundleDir, 0o750); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	files := archive.Files()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		path := filepath.Join(bundleDir, name)
+		if err := os.WriteFile(path, files[name], 0o600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		fmt.Println(i18n.T("bundle.extracted", path))
+	}
+
+	log.Info("bundle imported", "dir", bundleDir, "files", len(names))
+	return nil
+}
+
+func runBundlePush(cmd *cobra.Command, args []string) error {
+	startTime := time.Now()
+	ctx := startRun(cmd)
+
+	log := slog.With(
+		"command", "bundle.push",
+		"nsx_host", nsxHost,
+		"bundle", args[0],
+	)
+
+	auditLog, err := openAuditLog()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = auditLog.Close() }()
+
+	archive, err := openBundle(ctx, log, args[0])
+	if err != nil {
+		return err
+	}
+
+	log.Info("starting push operation", "sources_count", len(archive.Result))
+	return pushDomains(ctx, log, auditLog, audit.OperationBundlePush, archive.Result, startTime)
+}
+
+// openBundle opens the bundle at path and verifies its signature with
+// --public-key, accepting an unsigned one with --allow-unsigned.
+func openBundle(ctx context.Context, log *slog.Logger, path string) (*bundle.Archive, error) {
+	archive, err := bundle.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pub ed25519.PublicKey
+	if bundlePublicKey != "" {
+		if pub, err = signing.LoadPublicKey(bundlePublicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	m := archive.Manifest
+	fmt.Println(i18n.T("bundle.manifest", m.CreatedAt.Format(time.RFC3339), m.Creator, len(archive.Result)))
+	if m.Source != "" {
+		fmt.Println(i18n.T("bundle.source", m.Source))
+	}
+
+	result, err := archive.Verify(ctx, pub)
+	switch {
+	case errors.Is(err, bundle.ErrUnsigned) && bundleAllowUnsigned:
+		log.Warn("bundle is not signed")
+		fmt.Fprintln(os.Stderr, i18n.T("bundle.unsigned"))
+		return archive, nil
+	case errors.Is(err, bundle.ErrUnsigned):
+		return nil, fmt.Errorf("%s: %w; use --allow-unsigned to accept it", path, err)
+	case err != nil:
+		log.Error("bundle signature is invalid", "error", err)
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	log.Info("bundle verified", "algorithm", result.Algorithm, "key_id", result.KeyID)
+	fmt.Println(i18n.T("bundle.verified", result.Algorithm, result.KeyID))
+	return archive, nil
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/nsx"
+)
+
+var (
+	// simulatePushFailures are the --simulate-push-failure values
+	simulatePushFailures []string
+	// simulateLatency is the --simulate-latency of every NSX call
+	simulateLatency time.Duration
+
+	// simulatedChaos is the fault injection of the NSX clients of the
+	// command, set by checkSimulateFlags; nil for none
+	simulatedChaos *nsx.Chaos
+)
+
+// addSimulateFlags adds the hidden --simulate-push-failure and
+// --simulate-latency flags to a command that pushes to NSX. They inject
+// faults into its NSX calls, so that CI can exercise partial failures,
+// conflict retries and rollbacks against the mock server deterministically.
+func addSimulateFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&simulatePushFailures, "simulate-push-failure", nil, "fail the pushes of the identity sources matching PATTERN[:STATUS[:TIMES]] (testing only)")
+	cmd.Flags().DurationVar(&simulateLatency, "simulate-latency", 0, "delay every NSX call by this long (testing only)")
+	_ = cmd.Flags().MarkHidden("simulate-push-failure")
+	_ = cmd.Flags().MarkHidden("simulate-latency")
+}
+
+// checkSimulateFlags validates the --simulate-* flags and sets
+// simulatedChaos from them.
+func checkSimulateFlags(log *slog.Logger) error {
+	if len(simulatePushFailures) == 0 && simulateLatency <= 0 {
+		return nil
+	}
+
+	chaos := &nsx.Chaos{Latency: simulateLatency}
+	for _, s := range simulatePushFailures {
+		f, err := nsx.ParsePushFailure(s)
+		if err != nil {
+			return err
+		}
+		chaos.PushFailures = append(chaos.PushFailures, f)
+	}
+	log.Warn("simulating NSX faults", "push_failures", simulatePushFailures, "latency", simulateLatency)
+	simulatedChaos = chaos
+	return nil
+}
@@ -0,0 +1,235 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/repository"
+)
+
+var (
+	completionShell string
+	completionPath  string
+)
+
+// completionInstallCmd writes the completion script where the shell loads it
+var completionInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the autocompletion script for the current shell",
+	Long: `Detect the shell from $SHELL (PowerShell on Windows), generate the completion
+script and write it where the shell loads completions for the current user:
+
+  bash        $XDG_DATA_HOME/bash-completion/completions/ldapmerge
+              (needs the bash-completion package)
+  zsh         ~/.zsh/completions/_ldapmerge (added to fpath in ~/.zshrc by hand)
+  fish        $XDG_CONFIG_HOME/fish/completions/ldapmerge.fish
+  powershell  ~/.config/powershell/ldapmerge.ps1 (dot-sourced from $PROFILE)
+
+Besides commands and flags, the script completes --profile with the profiles
+of the config file and identity source IDs (nsx get, delete, probe, search)
+with the sources recorded in the server inventory.`,
+	Example: `  # Current shell
+  ldapmerge completion install
+
+  # Another shell or location
+  ldapmerge completion install --shell zsh --path /usr/local/share/zsh/site-functions/_ldapmerge`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         runCompletionInstall,
+}
+
+// initCompletionCmd adds install to cobra's default completion command. The
+// default command only exists once all commands are registered.
+func initCompletionCmd() {
+	rootCmd.InitDefaultCompletionCmd()
+	for _, c := range rootCmd.Commands() {
+		if c.Name() == "completion" {
+			c.AddCommand(completionInstallCmd)
+			return
+		}
+	}
+}
+
+func init() {
+	completionInstallCmd.Flags().StringVar(&completionShell, "shell", "", "shell: bash, zsh, fish, powershell (default: detected)")
+	completionInstallCmd.Flags().StringVar(&completionPath, "path", "", "write the script to this file instead of the shell's default location")
+	_ = completionInstallCmd.RegisterFlagCompletionFunc("shell", cobra.FixedCompletions(
+		[]string{"bash", "zsh", "fish", "powershell"}, cobra.ShellCompDirectiveNoFileComp))
+}
+
+// detectShell returns the user's shell from $SHELL.
+func detectShell() (string, error) {
+	if runtime.GOOS == "windows" {
+		return "powershell", nil
+	}
+	shell := filepath.Base(os.Getenv("SHELL"))
+	switch shell {
+	case "bash", "zsh", "fish":
+		return shell, nil
+	case "pwsh", "powershell":
+		return "powershell", nil
+	case ".", "":
+		return "", fmt.Errorf("cannot detect the shell: $SHELL is not set; use --shell")
+	default:
+		return "", fmt.Errorf("unsupported shell %q; use --shell bash, zsh, fish or powershell", shell)
+	}
+}
+
+// completionScriptPath returns the per-user location the shell loads the
+// completion script from, and what the user still has to do, if anything.
+func completionScriptPath(shell string) (path, hint string, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", err
+	}
+	xdg := func(env, fallback string) string {
+		if dir := os.Getenv(env); dir != "" {
+			return dir
+		}
+		return filepath.Join(home, fallback)
+	}
+
+	name := rootCmd.Name()
+	switch shell {
+	case "bash":
+		return filepath.Join(xdg("XDG_DATA_HOME", ".local/share"), "bash-completion", "completions", name),
+			i18n.T("completion.hint.bash"), nil
+	case "zsh":
+		dir := filepath.Join(xdg("ZDOTDIR", ""), ".zsh", "completions")
+		return filepath.Join(dir, "_"+name),
+			i18n.T("completion.hint.zsh", dir), nil
+	case "fish":
+		return filepath.Join(xdg("XDG_CONFIG_HOME", ".config"), "fish", "completions", name+".fish"),
+			i18n.T("completion.hint.fish"), nil
+	case "powershell":
+		path := filepath.Join(home, ".config", "powershell", name+".ps1")
+		return path, i18n.T("completion.hint.powershell", path), nil
+	default:
+		return "", "", fmt.Errorf("unsupported shell %q; use bash, zsh, fish or powershell", shell)
+	}
+}
+
+func runCompletionInstall(cmd *cobra.Command, args []string) error {
+	shell := completionShell
+	if shell == "" {
+		var err error
+		if shell, err = detectShell(); err != nil {
+			return err
+		}
+	}
+
+	path, hint, err := completionScriptPath(shell)
+	if err != nil {
+		return err
+	}
+	if completionPath != "" {
+		path, hint = completionPath, ""
+	}
+
+	var script bytes.Buffer
+	root := cmd.Root()
+	switch shell {
+	case "bash":
+		err = root.GenBashCompletionV2(&script, true)
+	case "zsh":
+		err = root.GenZshCompletion(&script)
+	case "fish":
+		err = root.GenFishCompletion(&script, true)
+	case "powershell":
+		err = root.GenPowerShellCompletionWithDesc(&script)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to generate %s completion: %w", shell, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create completion directory: %w", err)
+	}
+	if err := os.WriteFile(path, script.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write completion script: %w", err)
+	}
+
+	fmt.Println(i18n.T("completion.installed", shell, path))
+	if hint != "" {
+		fmt.Println(hint)
+	}
+	return nil
+}
+
+// completionConfig rereads the config file when the command line being
+// completed names one: it was loaded before the line's flags were parsed.
+func completionConfig(cmd *cobra.Command) {
+	if cmd.Flags().Changed("config") {
+		initConfig()
+	}
+}
+
+// completeProfiles completes --profile with the profiles of the config file.
+func completeProfiles(cmd *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	completionConfig(cmd)
+	profiles, err := getProfiles()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var out []string
+	for _, name := range profileNames() {
+		if strings.HasPrefix(name, toComplete) {
+			out = append(out, name+"\t"+profiles[name].Host)
+		}
+	}
+	return out, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeSourceIDs completes the identity source ID argument with the
+// sources recorded in the server inventory for the resolved NSX host. It
+// never creates the database or contacts NSX.
+func completeSourceIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	// Hooks do not run while completing; resolve --profile, env and config here
+	completionConfig(cmd)
+	_ = applySettings(cmd)
+
+	path := getDBPath()
+	if _, err := os.Stat(path); err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	repo, err := repository.New(path)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	defer func() { _ = repo.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	servers, err := repo.ListServers(ctx)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	seen := make(map[string]bool)
+	var out []string
+	for _, s := range servers {
+		if nsxHost != "" && s.NSXHost != nsxHost {
+			continue
+		}
+		if seen[s.DomainID] || !strings.HasPrefix(s.DomainID, toComplete) {
+			continue
+		}
+		seen[s.DomainID] = true
+		out = append(out, s.DomainID+"\t"+s.NSXHost)
+	}
+	return out, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,416 @@
+package cli
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/repository"
+	"ldapmerge/internal/snippet"
+)
+
+// Sources of a resolved setting, highest precedence first
+const (
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceProfile = "profile"
+	sourceConfig  = "config"
+	sourceDefault = "default"
+)
+
+// setting is an option resolved through the precedence chain
+// flags > env > profile > config file > defaults.
+type setting struct {
+	Key     string // config key, e.g. "nsx.host"; env is LDAPMERGE_NSX_HOST
+	Flag    string // flag that overrides it on the command
+	Profile string // profile field that may set it; empty if none
+	Secret  bool   // masked by "config effective"
+}
+
+// settings holds the settings registered per command. A command resolves its
+// own and those of its parents.
+var settings = map[*cobra.Command][]setting{}
+
+// registerSettings declares settings resolved for cmd and its subcommands.
+func registerSettings(cmd *cobra.Command, s ...setting) {
+	settings[cmd] = append(settings[cmd], s...)
+}
+
+// nsxSettings are the NSX connection settings of the nsx and sync commands
+var nsxSettings = []setting{
+	{Key: "nsx.host", Flag: "host", Profile: "host"},
+	{Key: "nsx.username", Flag: "username", Profile: "username"},
+	{Key: "nsx.password", Flag: "password", Secret: true},
+	{Key: "nsx.insecure", Flag: "insecure", Profile: "insecure"},
+	{Key: "nsx.timeout", Flag: "timeout", Profile: "timeout"},
+}
+
+// mergeSettings are the settings of the flags added by addMergeFlags
+var mergeSettings = []setting{
+	{Key: "merge.strategy", Flag: "strategy"},
+	{Key: "merge.normalize", Flag: "normalize"},
+	{Key: "merge.alt_names", Flag: "alt-names"},
+	{Key: "merge.host_aliases", Flag: "host-alias"},
+	{Key: "merge.strict", Flag: "strict"},
+	{Key: "merge.dedup", Flag: "dedup"},
+	{Key: "merge.workers", Flag: "merge-workers"},
+	{Key: "merge.weak_certificates", Flag: "weak-certificates"},
+}
+
+// envKeyReplacer maps config keys to environment variable names
+var envKeyReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// envName returns the environment variable of a config key.
+func envName(key string) string {
+	return "LDAPMERGE_" + strings.ToUpper(envKeyReplacer.Replace(key))
+}
+
+// resolvedSetting is a setting with its effective value
+type resolvedSetting struct {
+	Key    string `json:"key"`
+	Value  any    `json:"value"`
+	Source string `json:"source"`
+
+	secret bool
+	flag   *pflag.Flag
+}
+
+// commandSettings returns the settings of cmd and its parents.
+func commandSettings(cmd *cobra.Command) []setting {
+	var all []setting
+	for c := cmd; c != nil; c = c.Parent() {
+		all = append(append([]setting(nil), settings[c]...), all...)
+	}
+	return all
+}
+
+// selectedProfile returns the name and raw fields of the profile selected
+// for cmd, if cmd takes --profile (--from-nsx for gen response) and one is
+// selected.
+func selectedProfile(cmd *cobra.Command) (string, map[string]any, error) {
+	f := cmd.Flags().Lookup("profile")
+	if f == nil {
+		f = cmd.Flags().Lookup("from-nsx")
+	}
+	if f == nil {
+		return "", nil, nil
+	}
+
+	name := f.Value.String()
+	if !f.Changed {
+		name = viper.GetString("profile")
+	}
+	if name == "" {
+		return "", nil, nil
+	}
+
+	profiles, err := getProfiles()
+	if err != nil {
+		return "", nil, err
+	}
+	if _, ok := profiles[name]; !ok {
+		return "", nil, fmt.Errorf("profile %q not found in config (available: %s)", name, strings.Join(profileNames(), ", "))
+	}
+	return name, viper.GetStringMap("profiles." + name), nil
+}
+
+// resolveSettings resolves the settings of cmd from its parsed flags, the
+// environment, the selected profile and the config file.
+func resolveSettings(cmd *cobra.Command) ([]resolvedSetting, error) {
+	_, profile, err := selectedProfile(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var resolved []resolvedSetting
+	for _, s := range commandSettings(cmd) {
+		r := resolvedSetting{Key: s.Key, secret: s.Secret, flag: cmd.Flags().Lookup(s.Flag)}
+
+		env, inEnv := os.LookupEnv(envName(s.Key))
+		profileValue, inProfile := profile[strings.ToLower(s.Profile)]
+		switch {
+		case r.flag != nil && r.flag.Changed:
+			r.Value, r.Source = flagValue(r.flag), sourceFlag
+		case inEnv:
+			r.Value, r.Source = env, sourceEnv
+		case s.Profile != "" && inProfile:
+			r.Value, r.Source = profileValue, sourceProfile
+		case viper.InConfig(s.Key):
+			r.Value, r.Source = viper.Get(s.Key), sourceConfig
+		case r.flag != nil:
+			r.Value, r.Source = flagValue(r.flag), sourceDefault
+		default:
+			r.Value, r.Source = nil, sourceDefault
+		}
+		resolved = append(resolved, r)
+	}
+	return resolved, nil
+}
+
+// applySettings resolves the settings of cmd and makes both the flags and
+// viper return the effective values.
+func applySettings(cmd *cobra.Command) error {
+	resolved, err := resolveSettings(cmd)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range resolved {
+		if r.flag != nil && r.Source != sourceFlag && r.Source != sourceDefault {
+			if err := setFlagValue(r.flag, r.Value); err != nil {
+				return fmt.Errorf("invalid %s from %s: %w", r.Key, r.Source, err)
+			}
+			r.Value = flagValue(r.flag)
+		}
+		switch {
+		case r.Value == nil:
+		case r.Source == sourceDefault:
+			// A config file read later, as by "config effective --config", wins
+			viper.SetDefault(r.Key, r.Value)
+		default:
+			viper.Set(r.Key, r.Value)
+		}
+	}
+	return nil
+}
+
+func flagValue(f *pflag.Flag) any {
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		return sv.GetSlice()
+	}
+	return f.Value.String()
+}
+
+// setFlagValue sets f without marking it as changed on the command line.
+func setFlagValue(f *pflag.Flag, v any) error {
+	if sv, ok := f.Value.(pflag.SliceValue); ok {
+		if s, ok := v.(string); ok {
+			return sv.Replace(strings.Split(s, ","))
+		}
+		return sv.Replace(cast.ToStringSlice(v))
+	}
+	return f.Value.Set(cast.ToString(v))
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "⚙️ Configuration tools",
+	Long: `Commands for inspecting the ldapmerge configuration.
+
+Every option resolves with the same precedence, highest first:
+
+  1. command-line flags
+  2. environment variables (LDAPMERGE_ + key, e.g. LDAPMERGE_NSX_HOST)
+  3. the selected profile (nsx and sync, see "ldapmerge nsx --help")
+  4. the config file
+  5. built-in defaults`,
+}
+
+var configEffectiveCmd = &cobra.Command{
+	Use:   "effective [--json] [command [flags]]",
+	Short: "Print the resolved configuration and where each value comes from",
+	Example: `  # Every command's settings
+  ldapmerge config effective
+
+  # What sync would use with these flags
+  ldapmerge config effective sync --profile prod --strategy append
+
+  # As JSON
+  ldapmerge config effective --json nsx pull`,
+	// The flags belong to the inspected command
+	DisableFlagParsing: true,
+	RunE:               runConfigEffective,
+}
+
+var configSnippetCmd = &cobra.Command{
+	Use:   "snippet <name>",
+	Short: "Print the sync command of an NSX configuration saved through the API",
+	Long: `Print the ldapmerge sync command line that syncs the NSX Manager of a
+configuration saved through the API server (POST /api/configs), with its
+sync defaults. GET /api/configs/{id}/snippet returns the same command.
+
+The password is left out: set LDAPMERGE_NSX_PASSWORD or add -P. The
+certificate response and the audit reason are placeholders to replace.
+
+Names are unique per tenant: when several tenants have a configuration of
+that name, pick one with --tenant ("" for the default tenant).`,
+	Example: `  ldapmerge config snippet production-nsx
+  ldapmerge config snippet production-nsx --db /var/lib/ldapmerge/data.db
+  ldapmerge config snippet production-nsx --tenant team-a`,
+	Args: cobra.ExactArgs(1),
+	RunE: runConfigSnippet,
+}
+
+var snippetTenant string
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configEffectiveCmd)
+	configCmd.AddCommand(configSnippetCmd)
+
+	configSnippetCmd.Flags().StringVar(&dbPath, "db", "", "path to SQLite database (default: ldapmerge/data.db in the user config directory)")
+	configSnippetCmd.Flags().StringVar(&snippetTenant, "tenant", "", "tenant of the configuration, when the name is used by several")
+}
+
+func runConfigSnippet(cmd *cobra.Command, args []string) error {
+	repo, err := repository.New(getDBPath())
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	ctx := cmd.Context()
+	if cmd.Flags().Changed("tenant") {
+		ctx = repository.WithTenant(ctx, snippetTenant)
+	}
+
+	config, err := repo.GetConfigByName(ctx, args[0])
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no NSX configuration named %q", args[0])
+	}
+	if errors.Is(err, repository.ErrAmbiguousConfig) {
+		return fmt.Errorf("%w; pick one with --tenant", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load NSX configuration %q: %w", args[0], err)
+	}
+
+	fmt.Print(snippet.Sync(config))
+	return nil
+}
+
+// effectiveConfig is the resolved configuration of one command
+type effectiveConfig struct {
+	Command  string            `json:"command"`
+	Profile  string            `json:"profile,omitempty"`
+	Settings []resolvedSetting `json:"settings"`
+}
+
+func runConfigEffective(cmd *cobra.Command, args []string) error {
+	asJSON := false
+	rest := make([]string, 0, len(args))
+	for _, arg := range args {
+		switch arg {
+		case "--json":
+			asJSON = true
+		case "-h", "--help":
+			return cmd.Help()
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	// Global flags such as --config arrive here too
+	target, flags, err := rootCmd.Find(rest)
+	if err != nil {
+		return err
+	}
+	if err := target.ParseFlags(flags); err != nil {
+		return fmt.Errorf("%s: %w", target.CommandPath(), err)
+	}
+	if target.Flags().Changed("config") {
+		initConfig()
+		if lang := viper.GetString("lang"); lang != "" {
+			_ = setLanguage(lang)
+		}
+	}
+
+	all := target == rootCmd
+	targets := []*cobra.Command{target}
+	if all {
+		for _, c := range commandsWithSettings(rootCmd) {
+			// Merges the persistent flags of the parents into c.Flags()
+			if err := c.ParseFlags(nil); err != nil {
+				return err
+			}
+			targets = append(targets, c)
+		}
+	}
+
+	configs := make([]effectiveConfig, 0, len(targets))
+	for _, target := range targets {
+		resolved, err := resolveSettings(target)
+		if err != nil {
+			return fmt.Errorf("%s: %w", target.CommandPath(), err)
+		}
+		profile, _, _ := selectedProfile(target)
+		for i := range resolved {
+			if resolved[i].secret && resolved[i].Value != nil && cast.ToString(resolved[i].Value) != "" {
+				resolved[i].Value = "********"
+			}
+		}
+		if all && target != rootCmd {
+			// The global settings are listed once, under the root command
+			resolved = resolved[len(settings[rootCmd]):]
+		}
+		configs = append(configs, effectiveConfig{Command: target.CommandPath(), Profile: profile, Settings: resolved})
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(configs)
+	}
+
+	if used := viper.ConfigFileUsed(); used != "" {
+		fmt.Println(i18n.T("config.file", used))
+	} else {
+		fmt.Println(i18n.T("config.file.none"))
+	}
+	for _, c := range configs {
+		fmt.Println()
+		titleStyle.Print(c.Command)
+		if c.Profile != "" {
+			fmt.Print(i18n.T("config.profile", c.Profile))
+		}
+		fmt.Println()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, i18n.T("config.header"))
+		for _, r := range c.Settings {
+			fmt.Fprintf(w, "  %s\t%v\t%s\n", r.Key, displayValue(r.Value), r.Source)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func displayValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case []string, []any:
+		return strings.Join(cast.ToStringSlice(v), ",")
+	default:
+		if s := cast.ToString(v); s != "" {
+			return s
+		}
+		return `""`
+	}
+}
+
+// commandsWithSettings returns the descendants of c that register settings
+// of their own; a command group stands for all of its commands.
+func commandsWithSettings(c *cobra.Command) []*cobra.Command {
+	var out []*cobra.Command
+	for _, child := range c.Commands() {
+		if len(settings[child]) > 0 {
+			out = append(out, child)
+			continue
+		}
+		out = append(out, commandsWithSettings(child)...)
+	}
+	return out
+}
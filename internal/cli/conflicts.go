@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"ldapmerge/internal/diff"
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/report"
+)
+
+// interactive asks on the terminal how to resolve conflicts (--interactive)
+var interactive bool
+
+// errConflictAborted is returned when the user aborts at a conflict prompt.
+var errConflictAborted = errors.New("aborted at a conflict")
+
+// addInteractiveFlag adds --interactive to a command that merges or pushes.
+func addInteractiveFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&interactive, "interactive", false, "ask on the terminal how to resolve conflicting response certificates and sources changed on NSX since the pull")
+}
+
+// checkInteractive fails if --interactive is set without a terminal on
+// stdin.
+func checkInteractive() error {
+	if interactive && !term.IsTerminal(int(os.Stdin.Fd())) {
+		return errors.New("--interactive needs a terminal on stdin")
+	}
+	return nil
+}
+
+// conflictPrompt asks the user to resolve conflicts on stderr and reads the
+// answers from stdin, one conflict at a time.
+type conflictPrompt struct {
+	mu sync.Mutex
+	in *bufio.Reader
+	// all is the choice the user made for every remaining conflict, or ""
+	all string
+}
+
+// conflicts is the prompt of --interactive, shared by the merge and the
+// push of a command so that an answer for all conflicts applies to both.
+var conflicts = &conflictPrompt{in: bufio.NewReader(os.Stdin)}
+
+// certificateResolver returns the merger.ConflictResolver of --interactive,
+// or nil without it.
+func (p *conflictPrompt) certificateResolver() merger.ConflictResolver {
+	if !interactive {
+		return nil
+	}
+	return func(conflict merger.CertificateConflict) (merger.Strategy, error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		fmt.Fprintln(os.Stderr, "\n"+i18n.T("conflict.certificates.title", conflict.URL, len(conflict.Response)))
+		fmt.Fprintln(os.Stderr, i18n.T("conflict.certificates.existing"))
+		writeCertificates(os.Stderr, conflict.URL, conflict.Existing)
+		fmt.Fprintln(os.Stderr, i18n.T("conflict.certificates.response"))
+		writeCertificates(os.Stderr, conflict.URL, conflict.Response)
+
+		choice, err := p.ask(i18n.T("conflict.certificates.prompt"))
+		if err != nil {
+			return "", err
+		}
+		switch choice {
+		case "k":
+			return merger.StrategyKeep, nil
+		case "l":
+			return merger.StrategyReplace, nil
+		default:
+			return merger.StrategyAppend, nil
+		}
+	}
+}
+
+// revisionResolver returns the nsx.ConflictResolver of --interactive, or
+// nil without it.
+func (p *conflictPrompt) revisionResolver() nsx.ConflictResolver {
+	if !interactive {
+		return nil
+	}
+	return func(local, current *nsx.LDAPIdentitySource) (nsx.ConflictChoice, error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		if current == nil {
+			fmt.Fprintln(os.Stderr, "\n"+i18n.T("conflict.revision.deleted", local.ID))
+		} else {
+			fmt.Fprintln(os.Stderr, "\n"+i18n.T("conflict.revision.title", local.ID))
+			changes := diff.Compare(
+				[]models.Domain{nsx.LDAPIdentitySourceToDomain(*current)},
+				[]models.Domain{nsx.LDAPIdentitySourceToDomain(*local)},
+			)
+			_ = changes.WriteText(os.Stderr)
+		}
+
+		choice, err := p.ask(i18n.T("conflict.revision.prompt"))
+		if err != nil {
+			return nsx.KeepNSX, err
+		}
+		switch choice {
+		case "k":
+			return nsx.KeepNSX, nil
+		case "l":
+			return nsx.KeepLocal, nil
+		default:
+			return nsx.MergeBoth, nil
+		}
+	}
+}
+
+// ask prompts until the user answers k (keep NSX), l (keep local), b (merge
+// both) or a (abort), and returns the answer. An upper-case answer applies
+// to the remaining conflicts too.
+func (p *conflictPrompt) ask(prompt string) (string, error) {
+	if p.all != "" {
+		fmt.Fprintln(os.Stderr, i18n.T("conflict.applied", p.all))
+		return p.all, nil
+	}
+	for {
+		fmt.Fprint(os.Stderr, prompt)
+		line, err := p.in.ReadString('\n')
+		answer := strings.TrimSpace(line)
+		switch strings.ToLower(answer) {
+		case "k", "l", "b":
+			if answer != strings.ToLower(answer) {
+				p.all = strings.ToLower(answer)
+			}
+			return strings.ToLower(answer), nil
+		case "a":
+			return "", errConflictAborted
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read answer: %w", err)
+		}
+	}
+}
+
+// writeCertificates lists certs of the server at url, one per line.
+func writeCertificates(w io.Writer, url string, certs []string) {
+	if len(certs) == 0 {
+		fmt.Fprintln(w, "    -")
+		return
+	}
+	domains := []models.Domain{{LDAPServers: []models.LDAPServer{{URL: url, Certificates: certs}}}}
+	for _, c := range report.Certificates(domains, time.Now(), report.DefaultExpiryWarning) {
+		notAfter := "?"
+		if c.NotAfter != nil {
+			notAfter = c.NotAfter.Format("2006-01-02")
+		}
+		line := fmt.Sprintf("    %s  %s  %s", c.Fingerprint[:16], notAfter, c.Subject)
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/convert"
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/loader"
+)
+
+var (
+	convertInput   string
+	convertOutput  string
+	convertFrom    string
+	convertTo      string
+	convertCompact bool
+)
+
+// convertCmd converts documents between the formats ldapmerge reads
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "🔄 Convert between domain, NSX and response JSON",
+	Long: `Detect which kind of JSON document a file holds and convert it to another:
+
+  domains   domain list, as nsx pull and merge write it and merge reads it
+  nsx       NSX identity source list result, as the NSX API returns it
+            (an array of identity sources or a single one is read as well)
+  response  Ansible certificate response (an array of results or a single
+            result is read as well)
+
+The input format is detected unless --from is set. Domain and NSX lists
+convert to each other; both convert to a response with one result per
+server certificate. A response only holds URLs and certificates, so it only
+converts to its canonical {"results": [...]} form.`,
+	Example: `  # Identity sources captured from the NSX API, as merge input
+  ldapmerge convert -i nsx-sources.json -o initial.json
+
+  # Merge result as the body of NSX API calls
+  ldapmerge convert -i result.json --to nsx -o sources.json
+
+  # Certificates of a merge result as a response
+  ldapmerge convert -i result.json --to response -o response.json`,
+	Args:         cobra.NoArgs,
+	RunE:         runConvert,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+
+	convertCmd.Flags().StringVarP(&convertInput, "input", "i", "", "input JSON location: path, URL or - for stdin (required)")
+	_ = convertCmd.MarkFlagRequired("input")
+	convertCmd.Flags().StringVarP(&convertOutput, "output", "o", "", "output file (default: stdout)")
+	convertCmd.Flags().StringVar(&convertFrom, "from", "", "input format: domains, nsx or response (default: detected)")
+	convertCmd.Flags().StringVar(&convertTo, "to", string(convert.FormatDomains), "output format: domains, nsx or response")
+	convertCmd.Flags().BoolVarP(&convertCompact, "compact", "c", false, "output compact JSON (no indentation)")
+}
+
+func runConvert(cmd *cobra.Command, args []string) error {
+	log := slog.With("command", "convert", "input", convertInput)
+
+	to, err := convert.ParseFormat(convertTo)
+	if err != nil {
+		return err
+	}
+
+	r, err := loader.Open(cmd.Context(), convertInput)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	data, err := io.ReadAll(r)
+	_ = r.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	from := convert.Format(convertFrom)
+	if convertFrom == "" {
+		if from, err = convert.Detect(data); err != nil {
+			return fmt.Errorf("failed to detect input format: %w", err)
+		}
+	} else if from, err = convert.ParseFormat(convertFrom); err != nil {
+		return err
+	}
+
+	var out any
+	count := 0
+	switch to {
+	case convert.FormatResponse:
+		response, err := convert.Response(data, from)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s to %s: %w", from, to, err)
+		}
+		out, count = response, len(response.Results)
+	default:
+		domains, err := convert.Domains(data, from)
+		if err != nil {
+			return fmt.Errorf("failed to convert %s to %s: %w", from, to, err)
+		}
+		out, count = domains, len(domains)
+		if to == convert.FormatNSX {
+			out = convert.NSX(domains)
+		}
+	}
+
+	log.Info("converted", "from", from, "to", to, "items", count)
+	if err := writeOutput(convertOutput, func(w io.Writer) error {
+		var data []byte
+		var err error
+		if convertCompact {
+			data, err = json.Marshal(out)
+		} else {
+			data, err = json.MarshalIndent(out, "", "    ")
+		}
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	fmt.Fprintln(os.Stderr, i18n.T("convert.done", from, to, count))
+	return nil
+}
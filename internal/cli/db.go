@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/maintenance"
+	"ldapmerge/internal/repository"
+)
+
+var (
+	dbImportFrom   string
+	dbImportDryRun bool
+
+	dbMaintainWALLimit int
+)
+
+// dbCmd represents the db command group
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "🗄️ Database maintenance",
+	Long: `Commands for maintaining the local SQLite database.
+
+Available operations:
+  import   - Import history and configurations from another database
+  maintain - Checkpoint the write-ahead log and remove stale files`,
+}
+
+// dbImportCmd imports rows from another database
+var dbImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import history and configurations from another database",
+	Long: `Import merge history, NSX configurations and documents from another
+ldapmerge database, e.g. when upgrading or consolidating servers.
+
+The source is opened read-only and may be from any earlier release,
+including databases created before versioned migrations. Rows already in
+the target are skipped:
+  history         same timestamp and content
+  configurations  same name (soft-deleted source configurations are ignored)
+  documents       same kind and SHA-256
+
+History entries stored in an S3 artifact store are imported by key; the
+target must be configured with the same store to read them.`,
+	Example: `  # Preview an import
+  ldapmerge db import --from /backup/old.db --dry-run
+
+  # Consolidate another server's database into this one
+  ldapmerge db import --from /mnt/server2/data.db --db /var/lib/ldapmerge/data.db`,
+	RunE:         runDBImport,
+	SilenceUsage: true,
+}
+
+// dbMaintainCmd runs the database maintenance once
+var dbMaintainCmd = &cobra.Command{
+	Use:   "maintain",
+	Short: "Checkpoint the write-ahead log and remove stale files",
+	Long: `Run the maintenance the API server runs at startup and every
+--db-maintenance-interval:
+  - checkpoint the SQLite write-ahead log into the database, and truncate
+    it when larger than --wal-limit MB
+  - remove from the database directory the write-ahead log, shared memory
+    and journal files of databases that no longer exist
+  - remove temporary files of ldapmerge and SQLite older than a day
+
+Useful for databases of servers running without the scheduler feature, or
+before copying a database file.`,
+	Example: `  # Truncate the write-ahead log whatever its size
+  ldapmerge db maintain --wal-limit 0`,
+	RunE:         runDBMaintain,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbImportCmd)
+	dbCmd.AddCommand(dbMaintainCmd)
+
+	dbCmd.PersistentFlags().StringVar(&dbPath, "db", "", "path to SQLite database (default: ldapmerge/data.db in the user config directory)")
+	dbImportCmd.Flags().StringVar(&dbImportFrom, "from", "", "path to the source database (required)")
+	dbImportCmd.Flags().BoolVar(&dbImportDryRun, "dry-run", false, "report what would be imported without writing")
+
+	_ = dbImportCmd.MarkFlagRequired("from")
+
+	dbMaintainCmd.Flags().IntVar(&dbMaintainWALLimit, "wal-limit", int(maintenance.DefaultOptions().WALLimit>>20), "truncate the write-ahead log when larger than this many MB (0 truncates it when not empty)")
+}
+
+func runDBImport(cmd *cobra.Command, args []string) error {
+	repo, err := repository.New(getDBPath())
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	result, err := repo.ImportFrom(cmd.Context(), dbImportFrom, dbImportDryRun)
+	if err != nil {
+		return fmt.Errorf("import failed: %w", err)
+	}
+
+	title := i18n.T("db.import.done")
+	if dbImportDryRun {
+		title = i18n.T("db.import.dry_run")
+	}
+	headerStyle.Printf("%s: %s → %s\n\n", title, dbImportFrom, getDBPath())
+
+	if result.SourceVersion == 0 {
+		fmt.Println(i18n.T("db.import.schema.legacy"))
+	} else {
+		fmt.Println(i18n.T("db.import.schema", result.SourceVersion))
+	}
+	fmt.Println(i18n.T("db.import.history", result.HistoryImported, result.HistorySkipped))
+	fmt.Println(i18n.T("db.import.configs", result.ConfigsImported, result.ConfigsSkipped))
+	fmt.Println(i18n.T("db.import.documents", result.DocumentsImported, result.DocumentsSkipped))
+
+	return nil
+}
+
+func runDBMaintain(cmd *cobra.Command, args []string) error {
+	if dbMaintainWALLimit < 0 {
+		return fmt.Errorf("--wal-limit must not be negative")
+	}
+
+	repo, err := repository.New(getDBPath())
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	opts := maintenance.DefaultOptions()
+	opts.WALLimit = int64(dbMaintainWALLimit) << 20
+	report, err := maintenance.New(repo, opts).RunOnce(cmd.Context())
+	if report == nil {
+		return fmt.Errorf("maintenance failed: %w", err)
+	}
+
+	headerStyle.Printf("%s: %s\n\n", i18n.T("db.maintain.done"), repo.Path())
+	fmt.Println(i18n.T("db.maintain.wal", report.WALBefore, report.WALAfter))
+	if cp := report.Checkpoint; cp != nil {
+		switch {
+		case cp.Busy:
+			fmt.Println(i18n.T("db.maintain.busy"))
+		case cp.Truncated:
+			fmt.Println(i18n.T("db.maintain.truncated"))
+		}
+	}
+	if len(report.Removed) == 0 {
+		fmt.Println(i18n.T("db.maintain.none_removed"))
+	}
+	for _, file := range report.Removed {
+		fmt.Println(i18n.T("db.maintain.removed", file))
+	}
+
+	if err != nil {
+		return fmt.Errorf("maintenance failed: %w", err)
+	}
+	return nil
+}
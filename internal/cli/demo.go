@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/nsx/mock"
+	"ldapmerge/internal/repository"
+)
+
+var (
+	demoMockAddr string
+	demoHistory  int
+
+	demoGenSources int
+	demoGenServers int
+	demoLatency    time.Duration
+)
+
+// demoCmd represents the demo command group
+var demoCmd = &cobra.Command{
+	Use:   "demo",
+	Short: "🎓 Demo data and mock NSX server",
+	Long: `Commands for exploring ldapmerge without a real NSX Manager.
+
+Available operations:
+  seed - Populate the local database with example configs and history
+  nsx  - Run the built-in mock NSX API server`,
+}
+
+// demoSeedCmd populates the database with example data
+var demoSeedCmd = &cobra.Command{
+	Use:   "seed",
+	Short: "Populate the database with example data",
+	Long: `Populate the local database with example NSX configurations pointing at the
+built-in mock NSX server, plus sample merge history.
+
+Existing configurations with the same names are left untouched.`,
+	Example: `  # Seed data, then start the mock NSX server and the API server
+  ldapmerge demo seed
+  ldapmerge demo nsx &
+  ldapmerge server`,
+	RunE: runDemoSeed,
+}
+
+// demoNSXCmd runs the mock NSX server
+var demoNSXCmd = &cobra.Command{
+	Use:   "nsx",
+	Short: "Run the built-in mock NSX API server",
+	Long: `Run the mock NSX API server used by tests.
+
+Credentials: admin / secret. The server keeps its state in memory and
+starts with two example identity sources, or with synthesized sources
+when --sources is set, for load and performance testing.`,
+	Example: `  ldapmerge demo nsx --addr 127.0.0.1:8443
+  ldapmerge nsx pull --host http://127.0.0.1:8443 -u admin -P secret
+
+  # 300 identity sources with 4 servers each, 50ms per request
+  ldapmerge demo nsx --sources 300 --servers 4 --latency 50ms`,
+	RunE: runDemoNSX,
+}
+
+func init() {
+	rootCmd.AddCommand(demoCmd)
+	demoCmd.AddCommand(demoSeedCmd)
+	demoCmd.AddCommand(demoNSXCmd)
+
+	demoCmd.PersistentFlags().StringVar(&demoMockAddr, "addr", "127.0.0.1:8443", "mock NSX server address")
+
+	demoSeedCmd.Flags().StringVar(&dbPath, "db", "", "path to SQLite database (default: ldapmerge/data.db in the user config directory)")
+	demoSeedCmd.Flags().IntVar(&demoHistory, "history", 3, "number of sample history entries to create")
+
+	demoNSXCmd.Flags().IntVar(&demoGenSources, "sources", 0, "synthesize this many identity sources instead of the examples")
+	demoNSXCmd.Flags().IntVar(&demoGenServers, "servers", 2, "LDAP servers per synthesized identity source")
+	demoNSXCmd.Flags().DurationVar(&demoLatency, "latency", 0, "artificial delay added to every request")
+}
+
+func runDemoSeed(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	dbFile := getDBPath()
+	repo, err := repository.New(dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	fmt.Println(i18n.T("demo.seeding", dbFile))
+
+	host := "http://" + demoMockAddr
+	configs := []models.NSXConfig{
+		{
+			Name:        "demo-nsx",
+			Description: "Built-in mock NSX server (run: ldapmerge demo nsx)",
+			Host:        host,
+			Username:    "admin",
+			Password:    "secret",
+		},
+		{
+			Name:        "demo-nsx-bad-credentials",
+			Description: "Mock NSX server with wrong credentials, for exploring error paths",
+			Host:        host,
+			Username:    "admin",
+			Password:    "wrong",
+		},
+	}
+
+	// The demo configs belong to the default tenant
+	defaultTenant := repository.WithTenant(ctx, "")
+	for i := range configs {
+		_, err := repo.GetConfigByName(defaultTenant, configs[i].Name)
+		if err == nil {
+			fmt.Println(i18n.T("demo.config.skipped", configs[i].Name))
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to look up config %s: %w", configs[i].Name, err)
+		}
+
+		saved, err := repo.SaveConfig(ctx, &configs[i])
+		if err != nil {
+			return fmt.Errorf("failed to save config %s: %w", configs[i].Name, err)
+		}
+		fmt.Println(i18n.T("demo.config.created", saved.Name, saved.ID, saved.Host))
+	}
+
+	initial, response := demoMergeInputs()
+	m := merger.New()
+	for i := 0; i < demoHistory; i++ {
+		// Each entry adds certificates for one more server, so history diffs are non-trivial
+		partial := models.CertificateResponse{Results: response.Results[:min(i+1, len(response.Results))]}
+		result, stats, err := m.MergeWithStats(ctx, initial, &partial)
+		if err != nil {
+			return fmt.Errorf("failed to merge demo data: %w", err)
+		}
+		entry, err := repo.SaveHistoryWithStats(ctx, initial, partial, result, &stats)
+		if err != nil {
+			return fmt.Errorf("failed to save history: %w", err)
+		}
+		fmt.Println(i18n.T("demo.history.created", entry.ID, len(partial.Results)))
+	}
+
+	fmt.Println("\n" + i18n.T("demo.next_steps"))
+	fmt.Printf("  ldapmerge demo nsx --addr %s\n", demoMockAddr)
+	fmt.Println("  ldapmerge server")
+	return nil
+}
+
+// demoMergeInputs builds an initial document from the mock server's seed
+// sources, with certificates stripped, and a matching certificate response.
+func demoMergeInputs() ([]models.Domain, models.CertificateResponse) {
+	sources := mock.NewServer().GetSources()
+
+	ids := make([]string, 0, len(sources))
+	for id := range sources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	initial := make([]models.Domain, 0, len(ids))
+	var response models.CertificateResponse
+	for _, id := range ids {
+		domain := nsx.LDAPIdentitySourceToDomain(*sources[id])
+		for i := range domain.LDAPServers {
+			server := &domain.LDAPServers[i]
+			server.Certificates = nil
+			server.BindPassword = ""
+
+			response.Results = append(response.Results, models.CertificateResult{
+				JSON: models.CertificateJSON{
+					PEMEncoded: fmt.Sprintf("-----BEGIN CERTIFICATE-----\nDemo certificate for %s\n-----END CERTIFICATE-----", server.URL),
+				},
+				Item: models.ResponseItem{
+					URL:      server.URL,
+					StartTLS: server.StartTLS,
+					Enabled:  server.Enabled,
+				},
+			})
+		}
+		initial = append(initial, domain)
+	}
+
+	return initial, response
+}
+
+func runDemoNSX(cmd *cobra.Command, args []string) error {
+	mockServer := mock.NewServer()
+	if demoGenSources > 0 {
+		mockServer.Generate(demoGenSources, demoGenServers)
+		fmt.Println(i18n.T("demo.generated", demoGenSources, demoGenServers))
+	}
+	mockServer.SetLatency(demoLatency)
+
+	srv := &http.Server{
+		Addr:              demoMockAddr,
+		Handler:           mockServer,
+		ReadTimeout:       30 * time.Second,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+
+	fmt.Println(i18n.T("demo.listening", demoMockAddr))
+	return srv.ListenAndServe()
+}
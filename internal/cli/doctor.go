@@ -0,0 +1,286 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/repository"
+)
+
+var (
+	doctorTimeout int
+	doctorSkipNSX bool
+)
+
+// checkStatus is the outcome of a single doctor check.
+type checkStatus int
+
+const (
+	checkPass checkStatus = iota
+	checkWarn
+	checkFail
+)
+
+// checkResult is a single line of the doctor report.
+type checkResult struct {
+	Name    string
+	Status  checkStatus
+	Message string
+}
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "🩺 Diagnose the local installation",
+	Long: `Run diagnostic checks and print a pass/warn/fail report.
+
+Checks:
+  - Database file: existence, permissions, integrity, pending migrations
+  - Log directory: exists and is writable
+  - Config file: found and parses
+  - NSX managers: each saved configuration is reachable and accepts its credentials
+
+Exits with a non-zero status if any check fails.`,
+	Example: `  # Full report
+  ldapmerge doctor
+
+  # Specific database, skip NSX reachability
+  ldapmerge doctor --db /var/lib/ldapmerge/data.db --skip-nsx`,
+	RunE:         runDoctor,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().StringVar(&dbPath, "db", "", "path to SQLite database (default: ldapmerge/data.db in the user config directory)")
+	doctorCmd.Flags().IntVar(&doctorTimeout, "timeout", 10, "NSX reachability timeout in seconds")
+	doctorCmd.Flags().BoolVar(&doctorSkipNSX, "skip-nsx", false, "skip NSX manager reachability checks")
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	var results []checkResult
+	results = append(results, checkConfigFile())
+	results = append(results, checkLogDir())
+
+	dbResults, dbUsable := checkDatabase(ctx, getDBPath())
+	results = append(results, dbResults...)
+
+	if doctorSkipNSX {
+		results = append(results, checkResult{Name: "NSX managers", Status: checkWarn, Message: "skipped (--skip-nsx)"})
+	} else if !dbUsable {
+		results = append(results, checkResult{Name: "NSX managers", Status: checkWarn, Message: "skipped (database not usable)"})
+	} else {
+		results = append(results, checkNSXManagers(ctx, getDBPath())...)
+	}
+
+	return printCheckReport(i18n.T("doctor.title"), "doctor", results)
+}
+
+func checkConfigFile() checkResult {
+	r := checkResult{Name: "Config file"}
+
+	if err := viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) {
+			r.Status = checkWarn
+			r.Message = "no config file found, using defaults"
+			return r
+		}
+		r.Status = checkFail
+		r.Message = err.Error()
+		return r
+	}
+
+	r.Message = viper.ConfigFileUsed()
+	return r
+}
+
+func checkLogDir() checkResult {
+	dir := resolveLogDir()
+	r := checkResult{Name: "Log directory"}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		r.Status = checkFail
+		r.Message = fmt.Sprintf("%s: %v", dir, err)
+		return r
+	}
+	if !info.IsDir() {
+		r.Status = checkFail
+		r.Message = fmt.Sprintf("%s is not a directory", dir)
+		return r
+	}
+
+	f, err := os.CreateTemp(dir, ".ldapmerge-doctor-*")
+	if err != nil {
+		r.Status = checkFail
+		r.Message = fmt.Sprintf("%s is not writable: %v", dir, err)
+		return r
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+
+	r.Message = filepath.Join(dir, "ldapmerge.log")
+	return r
+}
+
+// checkDatabase inspects the database file. The second return value reports
+// whether the database can be opened for further checks.
+func checkDatabase(ctx context.Context, path string) ([]checkResult, bool) {
+	diag, err := repository.Diagnose(ctx, path)
+	if err != nil {
+		return []checkResult{{Name: "Database", Status: checkFail, Message: err.Error()}}, false
+	}
+
+	if !diag.Exists {
+		return []checkResult{{
+			Name:    "Database file",
+			Status:  checkWarn,
+			Message: fmt.Sprintf("%s does not exist yet (created on first server start)", path),
+		}}, false
+	}
+
+	results := make([]checkResult, 0, 3)
+
+	file := checkResult{
+		Name:    "Database file",
+		Message: fmt.Sprintf("%s (mode %04o, %d bytes)", path, diag.Mode, diag.Size),
+	}
+	if diag.Mode&0o077 != 0 {
+		file.Status = checkWarn
+		file.Message += " - readable by group/others, but stores NSX passwords; consider chmod 600"
+	}
+	results = append(results, file)
+
+	integrity := checkResult{Name: "Database integrity", Message: "ok"}
+	if !diag.IntegrityOK() {
+		integrity.Status = checkFail
+		integrity.Message = fmt.Sprintf("%d problem(s), first: %s", len(diag.Integrity), diag.Integrity[0])
+	}
+	results = append(results, integrity)
+
+	migrations := checkResult{
+		Name:    "Database migrations",
+		Message: fmt.Sprintf("schema version %d", diag.SchemaVersion),
+	}
+	switch {
+	case diag.SchemaVersion > diag.LatestVersion:
+		migrations.Status = checkFail
+		migrations.Message = fmt.Sprintf("schema version %d is newer than this build (%d)", diag.SchemaVersion, diag.LatestVersion)
+	case diag.MigrationsPending():
+		migrations.Status = checkWarn
+		migrations.Message = fmt.Sprintf("schema version %d, %d pending (applied on next server start)",
+			diag.SchemaVersion, diag.LatestVersion-diag.SchemaVersion)
+	}
+	results = append(results, migrations)
+
+	usable := diag.IntegrityOK() && !diag.MigrationsPending() && diag.SchemaVersion <= diag.LatestVersion
+	return results, usable
+}
+
+func checkNSXManagers(ctx context.Context, path string) []checkResult {
+	repo, err := repository.New(path)
+	if err != nil {
+		return []checkResult{{Name: "NSX managers", Status: checkFail, Message: err.Error()}}
+	}
+	defer func() { _ = repo.Close() }()
+
+	configs, err := repo.ListConfigs(ctx)
+	if err != nil {
+		return []checkResult{{Name: "NSX managers", Status: checkFail, Message: err.Error()}}
+	}
+
+	if len(configs) == 0 {
+		return []checkResult{{Name: "NSX managers", Status: checkWarn, Message: "no saved configurations"}}
+	}
+
+	results := make([]checkResult, 0, len(configs))
+	for _, c := range configs {
+		// ListConfigs omits passwords
+		full, err := repo.GetConfig(ctx, c.ID)
+		if err != nil {
+			results = append(results, checkResult{Name: "NSX " + c.Name, Status: checkFail, Message: err.Error()})
+			continue
+		}
+		results = append(results, checkNSXManager(ctx, full.Name, nsx.ClientConfig{
+			Host:        full.Host,
+			Username:    full.Username,
+			Password:    full.Password,
+			Insecure:    full.Insecure,
+			Timeout:     time.Duration(doctorTimeout) * time.Second,
+			Diagnostics: nsxDiagnostics(),
+		}))
+	}
+
+	return results
+}
+
+func checkNSXManager(ctx context.Context, name string, cfg nsx.ClientConfig) checkResult {
+	r := checkResult{Name: "NSX " + name}
+
+	start := time.Now()
+	result, err := nsx.NewClient(cfg).ListLDAPIdentitySources(ctx)
+	latency := time.Since(start).Round(time.Millisecond)
+
+	if err != nil {
+		r.Status = checkFail
+		var apiErr *nsx.APIError
+		if errors.As(err, &apiErr) && (apiErr.HTTPStatus == http.StatusUnauthorized || apiErr.HTTPStatus == http.StatusForbidden) {
+			r.Message = fmt.Sprintf("%s: authentication failed", cfg.Host)
+		} else {
+			r.Message = fmt.Sprintf("%s: %v", cfg.Host, err)
+		}
+		return r
+	}
+
+	r.Message = fmt.Sprintf("%s reachable in %s, %d identity sources", cfg.Host, latency, result.ResultCount)
+	return r
+}
+
+// printCheckReport prints results under title and returns an error naming
+// command if any check failed.
+func printCheckReport(title, command string, results []checkResult) error {
+	pass := color.New(color.FgHiGreen, color.Bold)
+	warn := color.New(color.FgHiYellow, color.Bold)
+	fail := color.New(color.FgHiRed, color.Bold)
+
+	headerStyle.Println(title)
+	fmt.Println()
+
+	var passed, warned, failed int
+	for _, r := range results {
+		switch r.Status {
+		case checkPass:
+			pass.Print(i18n.T("doctor.pass"))
+			passed++
+		case checkWarn:
+			warn.Print(i18n.T("doctor.warn"))
+			warned++
+		case checkFail:
+			fail.Print(i18n.T("doctor.fail"))
+			failed++
+		}
+		fmt.Printf(" %-22s %s\n", r.Name, r.Message)
+	}
+
+	fmt.Println("\n" + i18n.T("doctor.summary", passed, warned, failed))
+
+	if failed > 0 {
+		return fmt.Errorf("%s found %d failed check(s)", command, failed)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"ldapmerge/internal/features"
+)
+
+// enabledFeatures are the features of the "features:" config section,
+// resolved before each command runs
+var enabledFeatures features.Set
+
+// featureSettings are the settings of the features, such as
+// features.web_ui (LDAPMERGE_FEATURES_WEB_UI)
+func featureSettings() []setting {
+	s := make([]setting, len(features.All))
+	for i, f := range features.All {
+		s[i] = setting{Key: "features." + string(f)}
+	}
+	return s
+}
+
+// getFeatures returns the features enabled by the config file and the
+// environment. Unknown features are an error.
+func getFeatures() (features.Set, error) {
+	names := slices.Collect(maps.Keys(viper.GetStringMap("features")))
+	for _, f := range features.All {
+		names = append(names, string(f))
+	}
+
+	section := make(map[string]any)
+	for _, name := range names {
+		if key := "features." + name; viper.IsSet(key) {
+			section[name] = viper.Get(key)
+		}
+	}
+	return features.Parse(section)
+}
+
+// joinFeatures returns the names of fs separated by commas.
+func joinFeatures(fs []features.Feature) string {
+	names := make([]string, len(fs))
+	for i, f := range fs {
+		names[i] = string(f)
+	}
+	return strings.Join(names, ", ")
+}
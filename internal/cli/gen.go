@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+)
+
+var (
+	genURLsFile string
+	genOutput   string
+)
+
+// genCmd represents the gen command group
+var genCmd = &cobra.Command{
+	Use:   "gen",
+	Short: "🛠️ Generate input files from NSX",
+	Long: `Generate input files with NSX Manager instead of external tooling.
+
+Available operations:
+  response - Certificate response from NSX fetch_certificate`,
+}
+
+// genResponseCmd builds a certificate response with NSX fetch_certificate
+var genResponseCmd = &cobra.Command{
+	Use:   "response",
+	Short: "Certificate response from NSX fetch_certificate",
+	Long: `Fetch the certificate of every LDAP server of the identity sources on NSX
+Manager with its fetch_certificate action and write them as a certificate
+response, ready for merge and sync. This replaces the external certificate
+collection when NSX can reach the LDAP servers.
+
+--from-nsx selects the connection profile, as --profile does for the nsx
+commands; --host, --username and the other connection flags override it.
+With --urls, only the servers listed in the file are fetched, one URL per
+line; blank lines and lines starting with # are skipped.
+
+Servers NSX cannot fetch from are reported and left out of the response.
+The command fails only if no certificate could be fetched.`,
+	Example: `  # Certificates of all servers on the NSX of the "prod" profile
+  ldapmerge gen response --from-nsx prod -P secret -o response.json
+
+  # Only the listed servers, then merge with the pulled configuration
+  ldapmerge gen response --from-nsx prod -P secret --urls servers.txt -o response.json
+  ldapmerge merge -i pulled.json -r response.json -o result.json`,
+	Args:         cobra.NoArgs,
+	PreRunE:      requireNSXConnection,
+	RunE:         runGenResponse,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(genCmd)
+	genCmd.AddCommand(genResponseCmd)
+
+	// NSX connection flags (same as nsx command); the profile flag is --from-nsx
+	genResponseCmd.Flags().StringVar(&profileName, "from-nsx", "", "connection profile from the config file of the NSX Manager to fetch with (see ldapmerge nsx --help)")
+	genResponseCmd.Flags().StringVar(&nsxHost, "host", "", "NSX Manager host URL (required unless set by --from-nsx)")
+	genResponseCmd.Flags().StringVarP(&nsxUsername, "username", "u", "", "NSX API username (required unless set by --from-nsx)")
+	genResponseCmd.Flags().StringVarP(&nsxPassword, "password", "P", "", "NSX API password (required unless set by LDAPMERGE_NSX_PASSWORD)")
+	genResponseCmd.Flags().BoolVarP(&nsxInsecure, "insecure", "k", false, "Skip TLS certificate verification")
+	genResponseCmd.Flags().IntVar(&nsxTimeout, "timeout", 30, "API request timeout in seconds")
+
+	genResponseCmd.Flags().StringVar(&genURLsFile, "urls", "", "file with the LDAP server URLs to fetch, one per line (default: all servers of the identity sources on NSX)")
+	genResponseCmd.Flags().StringVarP(&genOutput, "output", "o", "", "output file (default: stdout)")
+
+	registerSettings(genResponseCmd, nsxSettings...)
+	_ = genResponseCmd.RegisterFlagCompletionFunc("from-nsx", completeProfiles)
+}
+
+func runGenResponse(cmd *cobra.Command, args []string) error {
+	startTime := time.Now()
+	ctx := cmd.Context()
+
+	log := slog.With(
+		"command", "gen.response",
+		"nsx_host", nsxHost,
+	)
+
+	client := getNSXClient()
+
+	var items []models.ResponseItem
+	if genURLsFile != "" {
+		urls, err := readURLs(genURLsFile)
+		if err != nil {
+			return err
+		}
+		for _, url := range urls {
+			items = append(items, models.ResponseItem{URL: url, StartTLS: "false", Enabled: "true"})
+		}
+	} else {
+		result, err := client.ListLDAPIdentitySources(ctx)
+		if err != nil {
+			log.Error("failed to fetch LDAP identity sources", "error", err)
+			return fmt.Errorf("failed to fetch LDAP identity sources: %w", err)
+		}
+		items = nsx.ResponseItems(result.Results)
+	}
+	if len(items) == 0 {
+		return errors.New("no LDAP servers to fetch certificates from")
+	}
+
+	log.Info("fetching certificates", "servers", len(items))
+
+	response, failures, err := client.FetchCertificateResponse(ctx, items)
+	if err != nil {
+		return err
+	}
+	for _, f := range failures {
+		log.Warn("failed to fetch certificate", "url", f.URL, "error", f.Err)
+		fmt.Fprintln(os.Stderr, i18n.T("gen.response.failed", f.URL, f.Err))
+	}
+	if len(response.Results) == 0 {
+		return fmt.Errorf("failed to fetch any of %d certificates", len(items))
+	}
+
+	log.Info("certificates fetched",
+		"fetched", len(response.Results),
+		"failed", len(failures),
+		"duration", time.Since(startTime),
+	)
+
+	err = writeOutput(genOutput, func(w io.Writer) error {
+		data, err := json.MarshalIndent(response, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write response: %w", err)
+	}
+	if genOutput != "" {
+		fmt.Println(i18n.T("gen.response.written", len(response.Results), len(items), genOutput))
+	}
+	return nil
+}
+
+// readURLs reads the URLs listed in path, one per line, skipping blank lines
+// and # comments.
+func readURLs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read URLs: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var urls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read URLs: %w", err)
+	}
+	return uniqueSorted(urls), nil
+}
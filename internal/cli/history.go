@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/diff"
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/repository"
+)
+
+var historyDiffJSON bool
+
+// historyCmd represents the history command group
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "📜 Inspect merge history",
+	Long: `Commands for inspecting merge history stored in the local database.
+
+Available operations:
+  diff - Compare the merged results of two history entries`,
+}
+
+// historyDiffCmd compares two history entries
+var historyDiffCmd = &cobra.Command{
+	Use:   "diff <id-a> <id-b>",
+	Short: "Compare the merged results of two history entries",
+	Long: `Compare the merged results of two history entries.
+
+Domains are matched by ID and LDAP servers by URL; certificates are compared
+by SHA-256 fingerprint. Lines are prefixed with + (only in B), - (only in A)
+and ~ (changed).`,
+	Example: `  # What changed between last week's sync and today's
+  ldapmerge history diff 12 15
+
+  # Structured output
+  ldapmerge history diff 12 15 --json`,
+	Args: cobra.ExactArgs(2),
+	RunE: runHistoryDiff,
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyDiffCmd)
+
+	historyCmd.PersistentFlags().StringVar(&dbPath, "db", "", "path to SQLite database (default: ldapmerge/data.db in the user config directory)")
+	historyDiffCmd.Flags().BoolVar(&historyDiffJSON, "json", false, "output the structured diff as JSON")
+}
+
+func runHistoryDiff(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	ids := make([]int64, len(args))
+	for i, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid history ID %q", arg)
+		}
+		ids[i] = id
+	}
+
+	repoOpts, err := getRepositoryOptions()
+	if err != nil {
+		return err
+	}
+
+	repo, err := repository.NewWithOptions(getDBPath(), repoOpts)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	a, err := repo.GetHistory(ctx, ids[0])
+	if err != nil {
+		return fmt.Errorf("failed to load history entry %d: %w", ids[0], err)
+	}
+	b, err := repo.GetHistory(ctx, ids[1])
+	if err != nil {
+		return fmt.Errorf("failed to load history entry %d: %w", ids[1], err)
+	}
+
+	r := diff.Compare(a.Result.Data, b.Result.Data)
+
+	if historyDiffJSON {
+		return writeJSON(r)
+	}
+
+	headerStyle.Println(i18n.T("history.diff.title",
+		a.ID, a.CreatedAt.Format("2006-01-02 15:04:05"),
+		b.ID, b.CreatedAt.Format("2006-01-02 15:04:05")) + "\n")
+
+	return printDiff(r)
+}
+
+// printDiff prints the text rendering of r with added, removed and changed
+// lines colored.
+func printDiff(r *diff.ResultDiff) error {
+	var text strings.Builder
+	_ = r.WriteText(&text)
+
+	added := color.New(color.FgHiGreen)
+	removed := color.New(color.FgHiRed)
+	changed := color.New(color.FgHiYellow)
+
+	scanner := bufio.NewScanner(strings.NewReader(text.String()))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch trimmed := strings.TrimLeft(line, " "); {
+		case strings.HasPrefix(trimmed, "+"):
+			added.Println(line)
+		case strings.HasPrefix(trimmed, "-"):
+			removed.Println(line)
+		case strings.HasPrefix(trimmed, "~"):
+			changed.Println(line)
+		default:
+			fmt.Println(line)
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+
+	"ldapmerge/internal/directory"
+	"ldapmerge/internal/models"
+)
+
+var (
+	initDomain       string
+	initBaseDN       string
+	initAltDomains   []string
+	initServers      []string
+	initStartTLS     bool
+	initBindUsername string
+	initDisplayName  string
+	initDescription  string
+	initFormat       string
+	initOutput       string
+)
+
+// initCmd represents the init command group
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "🧱 Scaffold input files",
+	Long: `Generate skeletons of input files for first-time setups.
+
+Available operations:
+  source - Initial JSON of a new identity source`,
+}
+
+// initSourceCmd generates the initial JSON of a new identity source
+var initSourceCmd = &cobra.Command{
+	Use:   "source",
+	Short: "Initial JSON of a new identity source",
+	Long: `Generate the initial domain of a new identity source from flags instead
+of writing JSON by hand. The domain and server URLs are checked as NSX
+Manager would; certificates are left out for the certificate collection
+and merge to add, and bind passwords are never written.
+
+The base DN defaults to the DC= components of the domain. Output is JSON,
+as merge and sync read it, or YAML (--format yaml), e.g. for Ansible
+variables.`,
+	Example: `  # One domain with two LDAPS servers
+  ldapmerge init source --domain example.lab \
+    --server ldaps://ad-01.example.lab:636 --server ldaps://ad-02.example.lab:636 \
+    --bind-username sync@example.lab -o initial.json
+
+  # Explicit base DN and alternative domain name, as YAML
+  ldapmerge init source --domain example.lab --base-dn "DC=example,DC=lab" \
+    --alt-domain corp.example.lab --server ldaps://dc1:636 --format yaml`,
+	Args:         cobra.NoArgs,
+	RunE:         runInitSource,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+	initCmd.AddCommand(initSourceCmd)
+
+	initSourceCmd.Flags().StringVar(&initDomain, "domain", "", "domain name, also the identity source ID (required)")
+	_ = initSourceCmd.MarkFlagRequired("domain")
+	initSourceCmd.Flags().StringVar(&initBaseDN, "base-dn", "", "LDAP base DN (default: DC= components of --domain)")
+	initSourceCmd.Flags().StringSliceVar(&initAltDomains, "alt-domain", nil, "alternative domain name (repeatable)")
+	initSourceCmd.Flags().StringSliceVar(&initServers, "server", nil, "LDAP server URL, ldap:// or ldaps:// (required, repeatable)")
+	_ = initSourceCmd.MarkFlagRequired("server")
+	initSourceCmd.Flags().BoolVar(&initStartTLS, "starttls", false, "use StartTLS on the ldap:// servers")
+	initSourceCmd.Flags().StringVar(&initBindUsername, "bind-username", "", "bind username of the servers")
+	initSourceCmd.Flags().StringVar(&initDisplayName, "display-name", "", "NSX display name")
+	initSourceCmd.Flags().StringVar(&initDescription, "description", "", "NSX description")
+	initSourceCmd.Flags().StringVar(&initFormat, "format", "json", "output format: json or yaml")
+	initSourceCmd.Flags().StringVarP(&initOutput, "output", "o", "", "output file (default: stdout)")
+}
+
+func runInitSource(cmd *cobra.Command, args []string) error {
+	log := slog.With(
+		"command", "init.source",
+		"domain", initDomain,
+	)
+
+	if initFormat != "json" && initFormat != "yaml" {
+		return fmt.Errorf("unknown format %q (valid: json, yaml)", initFormat)
+	}
+
+	source, err := directory.NewSource(directory.SourceOptions{
+		Domain:                 initDomain,
+		BaseDN:                 initBaseDN,
+		AlternativeDomainNames: initAltDomains,
+		Servers:                initServers,
+		StartTLS:               initStartTLS,
+		BindUsername:           initBindUsername,
+		DisplayName:            initDisplayName,
+		Description:            initDescription,
+	})
+	if err != nil {
+		return err
+	}
+	domains := []models.Domain{source}
+
+	log.Info("identity source scaffolded", "servers", len(source.LDAPServers), "format", initFormat)
+
+	if initFormat == "yaml" {
+		return writeOutput(initOutput, func(w io.Writer) error {
+			return writeYAML(w, domains)
+		})
+	}
+	return writeDomains(initOutput, domains, true)
+}
+
+// writeYAML writes v as block-style YAML with the keys and key order of its
+// JSON encoding.
+func writeYAML(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// JSON is YAML: decoding it into a node keeps the key order
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// blockStyle drops the flow style JSON decodes into, except for empty
+// collections, which block style cannot express.
+func blockStyle(node *yaml.Node) {
+	if len(node.Content) > 0 {
+		node.Style &^= yaml.FlowStyle
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+		node.Style &^= yaml.DoubleQuotedStyle
+	}
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
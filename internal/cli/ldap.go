@@ -0,0 +1,305 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"ldapmerge/internal/credentials"
+	"ldapmerge/internal/directory"
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+)
+
+var (
+	ldapURL       string
+	ldapBindDN    string
+	ldapPassword  string
+	ldapBaseDN    string
+	ldapCertFiles []string
+	ldapFile      string
+	ldapStartTLS  bool
+	ldapTimeout   time.Duration
+	ldapJSON      bool
+
+	ldapDNSServer string
+	ldapScaffold  bool
+	ldapOutput    string
+)
+
+// ldapCmd represents the ldap command group
+var ldapCmd = &cobra.Command{
+	Use:   "ldap",
+	Short: "📇 Direct LDAP server operations",
+	Long: `Commands that talk to LDAP servers directly, without NSX Manager.
+
+Available operations:
+  test     - Bind and search with the given credentials and certificates
+  discover - Find the domain controllers of a domain in DNS`,
+}
+
+// ldapTestCmd binds to an LDAP server and runs a base search
+var ldapTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Bind and search with the given credentials and certificates",
+	Long: `Connect to an LDAP server, bind and run a base search, trusting only the
+given certificates, as NSX Manager would with an identity source. Use it to
+check a bind account and certificates before pushing them to NSX.
+
+Certificates come from --cert files or, with -f, from the server with the
+same URL in a merged or initial JSON file, which also supplies StartTLS and
+the bind username. Without any, the system roots are trusted.
+
+The password comes from --password, LDAPMERGE_LDAP_PASSWORD or the
+LDAPMERGE_BIND_PASSWORDS map; on a terminal it is asked for otherwise.
+
+Without --base-dn the server's defaultNamingContext is searched.`,
+	Example: `  # Certificates and bind user of the server in the merged result
+  ldapmerge ldap test --url ldaps://ad-01.example.lab:636 -f result.json
+
+  # Explicit bind DN and CA certificate
+  ldapmerge ldap test --url ldaps://ad-01.example.lab:636 \
+    --bind-dn "CN=svc-nsx,OU=Service,DC=example,DC=lab" --cert ca.pem`,
+	Args:         cobra.NoArgs,
+	RunE:         runLDAPTest,
+	SilenceUsage: true,
+}
+
+// ldapDiscoverCmd lists the domain controllers of a domain from DNS
+var ldapDiscoverCmd = &cobra.Command{
+	Use:   "discover DOMAIN",
+	Short: "Find the domain controllers of a domain in DNS",
+	Long: `Resolve the _ldap._tcp SRV records of an Active Directory domain to list
+its domain controllers, by priority and weight.
+
+With --scaffold, print an initial domain JSON for a new identity source
+instead, with an ldaps:// URL on port 636 per controller, ready for the
+certificate collection and merge.`,
+	Example: `  # List the domain controllers
+  ldapmerge ldap discover example.lab
+
+  # Scaffold an initial JSON using a specific DNS server
+  ldapmerge ldap discover example.lab --dns-server 10.0.0.53 --scaffold -o initial.json`,
+	Args:         cobra.ExactArgs(1),
+	RunE:         runLDAPDiscover,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(ldapCmd)
+	ldapCmd.AddCommand(ldapTestCmd)
+	ldapCmd.AddCommand(ldapDiscoverCmd)
+
+	ldapTestCmd.Flags().StringVar(&ldapURL, "url", "", "LDAP server URL, ldap:// or ldaps:// (required)")
+	_ = ldapTestCmd.MarkFlagRequired("url")
+	ldapTestCmd.Flags().StringVar(&ldapBindDN, "bind-dn", "", "bind DN or user principal name (default: anonymous, or the bind username in -f)")
+	ldapTestCmd.Flags().StringVar(&ldapPassword, "password", "", "bind password")
+	ldapTestCmd.Flags().StringVar(&ldapBaseDN, "base-dn", "", "DN to search (default: the server's defaultNamingContext)")
+	ldapTestCmd.Flags().StringSliceVar(&ldapCertFiles, "cert", nil, "PEM file of a certificate to trust: the server's own or a CA of its chain (repeatable)")
+	ldapTestCmd.Flags().StringVarP(&ldapFile, "file", "f", "", "merged or initial JSON to take the server's certificates, StartTLS and bind username from")
+	ldapTestCmd.Flags().BoolVar(&ldapStartTLS, "starttls", false, "upgrade an ldap:// connection with StartTLS")
+	ldapTestCmd.Flags().DurationVar(&ldapTimeout, "timeout", directory.DefaultTimeout, "timeout of each step")
+	ldapTestCmd.Flags().BoolVar(&ldapJSON, "json", false, "output as JSON")
+
+	registerSettings(ldapTestCmd, setting{Key: "ldap.password", Flag: "password", Secret: true})
+
+	ldapDiscoverCmd.Flags().StringVar(&ldapDNSServer, "dns-server", "", "DNS server to query, host or host:port (default: the system resolver)")
+	ldapDiscoverCmd.Flags().BoolVar(&ldapScaffold, "scaffold", false, "print an initial domain JSON with an ldaps:// server per controller")
+	ldapDiscoverCmd.Flags().StringVarP(&ldapOutput, "output", "o", "", "output file for --scaffold (default: stdout)")
+	ldapDiscoverCmd.Flags().BoolVar(&ldapJSON, "json", false, "output as JSON")
+
+	registerSettings(ldapDiscoverCmd, setting{Key: "ldap.dns_server", Flag: "dns-server"})
+}
+
+func runLDAPTest(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	log := slog.With(
+		"command", "ldap.test",
+		"ldap_url", ldapURL,
+	)
+
+	opts := directory.TestOptions{
+		URL:      ldapURL,
+		StartTLS: ldapStartTLS,
+		BindDN:   ldapBindDN,
+		Password: ldapPassword,
+		BaseDN:   ldapBaseDN,
+		Timeout:  ldapTimeout,
+	}
+	for _, path := range ldapCertFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read certificate: %w", err)
+		}
+		opts.Certificates = append(opts.Certificates, string(data))
+	}
+	if ldapFile != "" {
+		server, err := findLDAPServer(cmd, ldapFile, ldapURL)
+		if err != nil {
+			return err
+		}
+		opts.Certificates = append(opts.Certificates, server.Certificates...)
+		if !cmd.Flags().Changed("starttls") {
+			opts.StartTLS, _ = strconv.ParseBool(server.StartTLS)
+		}
+		if opts.BindDN == "" {
+			opts.BindDN = server.BindUsername
+		}
+		if opts.Password == "" {
+			opts.Password = server.BindPassword
+		}
+	}
+	if opts.BindDN != "" && opts.Password == "" {
+		password, err := getLDAPPassword(ldapURL, opts.BindDN)
+		if err != nil {
+			return err
+		}
+		opts.Password = password
+	}
+
+	log.Info("testing LDAP server", "bind_dn", opts.BindDN, "certificates", len(opts.Certificates))
+
+	result, err := directory.Test(ctx, opts)
+	if err != nil {
+		log.Error("LDAP test failed", "error", err)
+	} else {
+		log.Info("LDAP test passed", "base_dn", result.BaseDN, "entries", result.Entries)
+	}
+
+	if ldapJSON {
+		output := struct {
+			*directory.TestResult
+			Error string `json:"error,omitempty"`
+		}{TestResult: result}
+		if err != nil {
+			output.Error = err.Error()
+		}
+		if jsonErr := writeJSON(output); jsonErr != nil {
+			return jsonErr
+		}
+	} else {
+		printLDAPTestResult(result, err)
+	}
+
+	if err != nil {
+		return fmt.Errorf("LDAP test of %s failed: %w", ldapURL, err)
+	}
+	return nil
+}
+
+func runLDAPDiscover(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+
+	log := slog.With(
+		"command", "ldap.discover",
+		"domain", domain,
+	)
+
+	controllers, err := directory.Discover(cmd.Context(), directory.NewResolver(ldapDNSServer), domain)
+	if err != nil {
+		log.Error("discovery failed", "error", err)
+		return err
+	}
+	log.Info("domain controllers discovered", "count", len(controllers))
+
+	switch {
+	case ldapScaffold:
+		return writeDomains(ldapOutput, []models.Domain{directory.Scaffold(domain, controllers)}, true)
+	case ldapJSON:
+		return writeJSON(controllers)
+	}
+
+	fmt.Println(i18n.T("ldap.discover.title", domain, len(controllers)))
+	for _, c := range controllers {
+		fmt.Println(i18n.T("ldap.discover.controller", c.Host, c.Port, c.Priority, c.Weight))
+	}
+	return nil
+}
+
+// findLDAPServer returns the server with url in the domains of file.
+func findLDAPServer(cmd *cobra.Command, file, url string) (*models.LDAPServer, error) {
+	domains, err := merger.New().LoadInitial(cmd.Context(), file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load file: %w", err)
+	}
+
+	want := merger.NormalizeURL(url)
+	for _, domain := range domains {
+		for i, server := range domain.LDAPServers {
+			if merger.NormalizeURL(server.URL) == want {
+				return &domain.LDAPServers[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no LDAP server %s in %s", url, file)
+}
+
+// getLDAPPassword returns the bind password of url from
+// LDAPMERGE_BIND_PASSWORDS or, on a terminal, asks for it.
+func getLDAPPassword(url, bindDN string) (string, error) {
+	passwords := credentials.New()
+	if err := passwords.LoadEnv(); err != nil {
+		return "", err
+	}
+	if password, ok := passwords.Lookup(url); ok {
+		return password, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("no password for %s: use --password or LDAPMERGE_LDAP_PASSWORD", bindDN)
+	}
+	fmt.Fprint(os.Stderr, i18n.T("ldap.test.password_prompt", bindDN))
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return string(password), nil
+}
+
+// printLDAPTestResult prints the steps of a test that passed.
+func printLDAPTestResult(result *directory.TestResult, err error) {
+	fmt.Println(i18n.T("ldap.test.title", result.URL))
+	if failedStep(err) == directory.StepConnect {
+		return
+	}
+
+	if result.TLSVersion == "" {
+		fmt.Println(i18n.T("ldap.test.connected_plain"))
+	} else {
+		fmt.Println(i18n.T("ldap.test.connected_tls", result.TLSVersion))
+	}
+	if c := result.PeerCert; c != nil {
+		fmt.Println(i18n.T("ldap.test.certificate", c.Subject, c.Issuer, c.NotAfter.Format(time.DateOnly)))
+	}
+	if failedStep(err) == directory.StepBind {
+		return
+	}
+
+	if result.BindDN == "" {
+		fmt.Println(i18n.T("ldap.test.bound_anonymous"))
+	} else {
+		fmt.Println(i18n.T("ldap.test.bound", result.BindDN))
+	}
+	if err == nil {
+		fmt.Println(i18n.T("ldap.test.searched", result.BaseDN, result.Entries))
+	}
+}
+
+// failedStep returns the step of a failed test, or "" if it passed.
+func failedStep(err error) string {
+	var testErr *directory.TestError
+	if errors.As(err, &testErr) {
+		return testErr.Step
+	}
+	return ""
+}
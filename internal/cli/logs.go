@@ -0,0 +1,232 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/logging"
+)
+
+var (
+	logsSince    string
+	logsUntil    string
+	logsRun      string
+	logsLevel    string
+	logsContains string
+	logsJSON     bool
+)
+
+// logsCmd represents the logs command group
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "📜 Read the log files",
+	Long: `Commands for the JSON log files in --log-dir, for hosts without a
+centralized log stack.
+
+Every record has time, level and msg; run_id ties the records of one merge,
+sync, push or API request together (see the log schema in docs/CLI.md).
+
+Available operations:
+  query - Filter and print log records`,
+}
+
+// logsQueryCmd filters the log files
+var logsQueryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Filter and print log records",
+	Long: `Print the records of the log file and its rotated backups, .gz included,
+oldest first, that match every filter given.
+
+--since and --until take a duration back from now (1h, 30m, 7d) or a time
+(2006-01-02, 2006-01-02T15:04:05 in local time, or RFC 3339). --level is the
+lowest level printed. Lines that are not JSON log records are skipped.`,
+	Example: `  # Errors of the last hour
+  ldapmerge logs query --since 1h --level error
+
+  # Everything one sync logged
+  ldapmerge logs query --run 20261016T120000Z-3f9a1c2b
+
+  # As JSON lines, for jq
+  ldapmerge logs query --since 2026-10-16 --json | jq .msg`,
+	Args:         cobra.NoArgs,
+	RunE:         runLogsQuery,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.AddCommand(logsQueryCmd)
+
+	logsQueryCmd.Flags().StringVar(&logsSince, "since", "", "only records at or after this time or duration ago")
+	logsQueryCmd.Flags().StringVar(&logsUntil, "until", "", "only records at or before this time or duration ago")
+	logsQueryCmd.Flags().StringVar(&logsRun, "run", "", "only records of this run ID")
+	logsQueryCmd.Flags().StringVar(&logsLevel, "level", "debug", "lowest level printed: debug, info, warn, error")
+	logsQueryCmd.Flags().StringVar(&logsContains, "contains", "", "only records whose message contains this text")
+	logsQueryCmd.Flags().BoolVar(&logsJSON, "json", false, "print the records as JSON lines")
+}
+
+func runLogsQuery(cmd *cobra.Command, args []string) error {
+	now := time.Now()
+	query := logging.Query{RunID: logsRun, Contains: logsContains}
+
+	var err error
+	if query.Since, err = parseLogTime(logsSince, now); err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	if query.Until, err = parseLogTime(logsUntil, now); err != nil {
+		return fmt.Errorf("invalid --until: %w", err)
+	}
+	if err := query.Level.UnmarshalText([]byte(logsLevel)); err != nil {
+		return fmt.Errorf("invalid --level %q: use debug, info, warn or error", logsLevel)
+	}
+
+	dir := resolveLogDir()
+	files, err := logging.Files(dir, logging.DefaultConfig().LogFile)
+	if err != nil {
+		return fmt.Errorf("failed to read log directory: %w", err)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no log files in %s", dir)
+	}
+
+	out := os.Stdout
+	matched := 0
+	skipped, err := query.Read(files, func(r logging.Record) error {
+		matched++
+		if logsJSON {
+			return writeLogRecordJSON(out, r)
+		}
+		writeLogRecord(out, r)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !logsJSON {
+		if skipped > 0 {
+			fmt.Fprintln(os.Stderr, i18n.T("logs.skipped", skipped))
+		}
+		if matched == 0 {
+			fmt.Fprintln(os.Stderr, i18n.T("logs.empty"))
+		}
+	}
+	return nil
+}
+
+// parseLogTime parses s as a duration back from now, with d for days, or
+// as a date or time. Empty s is the zero time.
+func parseLogTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if d, err := time.ParseDuration(days + "h"); err == nil {
+			return now.Add(-24 * d), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("use a duration such as 1h or 7d, or a time such as 2006-01-02T15:04:05")
+}
+
+// writeLogRecord prints r on one line: time, level, message and the other
+// attributes as key=value.
+func writeLogRecord(w io.Writer, r logging.Record) {
+	level := color.New(color.FgHiBlue)
+	switch {
+	case r.Level >= slog.LevelError:
+		level = color.New(color.FgHiRed, color.Bold)
+	case r.Level >= slog.LevelWarn:
+		level = color.New(color.FgHiYellow)
+	case r.Level < slog.LevelInfo:
+		level = color.New(color.Faint)
+	}
+	faint := color.New(color.Faint)
+
+	var sb strings.Builder
+	sb.WriteString(faint.Sprint(r.Time.Local().Format("2006-01-02 15:04:05.000")))
+	sb.WriteString(" ")
+	sb.WriteString(level.Sprintf("%-5s", r.Level.String()))
+	sb.WriteString(" ")
+	sb.WriteString(r.Message)
+	for _, a := range r.Attrs {
+		sb.WriteString(" ")
+		sb.WriteString(faint.Sprint(a.Key + "="))
+		sb.WriteString(formatLogValue(a.Value))
+	}
+	_, _ = fmt.Fprintln(w, sb.String())
+}
+
+// formatLogValue formats an attribute value for writeLogRecord, quoting
+// strings with spaces.
+func formatLogValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			return fmt.Sprintf("%q", v)
+		}
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return "null"
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+}
+
+// writeLogRecordJSON prints r as a JSON line with the keys in the order
+// they were logged.
+func writeLogRecordJSON(w io.Writer, r logging.Record) error {
+	var sb strings.Builder
+	sb.WriteString("{")
+	write := func(key string, value any) error {
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if sb.Len() > 1 {
+			sb.WriteString(",")
+		}
+		sb.Write(k)
+		sb.WriteString(":")
+		sb.Write(v)
+		return nil
+	}
+	_ = write(logging.KeyTime, r.Time.Format(time.RFC3339Nano))
+	_ = write(logging.KeyLevel, r.Level.String())
+	_ = write(logging.KeyMessage, r.Message)
+	for _, a := range r.Attrs {
+		if err := write(a.Key, a.Value); err != nil {
+			return err
+		}
+	}
+	sb.WriteString("}\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -1,20 +1,28 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/loader"
 	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
 )
 
 var (
 	initialFile  string
 	responseFile string
 	outputFile   string
+	splitOutput  string
 	compact      bool
 )
 
@@ -26,24 +34,58 @@ var mergeCmd = &cobra.Command{
 
 Takes an initial JSON file containing domain and LDAP server configurations,
 and a response JSON file containing certificate information.
-Outputs merged JSON with certificates added to matching LDAP servers.`,
+Outputs merged JSON with certificates added to matching LDAP servers.
+
+--initial and --response accept a path, "-" for stdin (one of them at most),
+or a URL: file://, http://, https:// or s3://bucket/key. S3 credentials,
+endpoint and region come from the "artifacts.s3" config.
+
+A --response ending in .zip, .tar.gz or .tgz is an archive of per-host
+certificate JSON files, such as Ansible fetch collects; each file is a
+response, an array of results or a single result.
+
+--initial may also hold identity sources as the NSX API returns them: a
+list result ({"results": [...]}), an array of sources or a single one. They
+are converted to domains before merging.
+
+--split-output writes one file per domain to a directory instead, named
+after the domain ID, so that per-domain configs kept in git get small
+diffs. Each file is a one-domain array that nsx push accepts as is.
+
+--meta embeds a {"_meta": ...} element at the top of output files with the
+ldapmerge version, the time and the SHA-256 of the inputs. nsx push and
+merge skip it when reading the file back.
+
+Merge behavior defaults can be set in the config file under "merge:" and
+overridden per invocation with --strategy, --normalize, --strict and --dedup.
+
+Response certificates signed with SHA-1 or MD5, with RSA keys shorter than
+2048 bits or that are expired CAs are weak. --weak-certificates sets what
+happens to them: warn (the default) reports them on stderr, fail stops the
+merge and ignore merges them silently.`,
 	RunE: runMerge,
 }
 
 func init() {
 	rootCmd.AddCommand(mergeCmd)
 
-	mergeCmd.Flags().StringVarP(&initialFile, "initial", "i", "", "path to initial JSON file (required)")
-	mergeCmd.Flags().StringVarP(&responseFile, "response", "r", "", "path to response JSON file (required)")
+	mergeCmd.Flags().StringVarP(&initialFile, "initial", "i", "", "initial JSON location: path, URL or - for stdin (required)")
+	mergeCmd.Flags().StringVarP(&responseFile, "response", "r", "", "response JSON or .zip/.tar.gz location: path, URL or - for stdin (required)")
 	mergeCmd.Flags().StringVarP(&outputFile, "output", "o", "", "path to output file (default: stdout)")
+	mergeCmd.Flags().StringVar(&splitOutput, "split-output", "", "directory to write one result file per domain to, instead of --output")
 	mergeCmd.Flags().BoolVarP(&compact, "compact", "c", false, "output compact JSON (no indentation)")
+	addMergeFlags(mergeCmd)
+	addMetaFlag(mergeCmd)
+	addInteractiveFlag(mergeCmd)
 
 	_ = mergeCmd.MarkFlagRequired("initial")
 	_ = mergeCmd.MarkFlagRequired("response")
+	mergeCmd.MarkFlagsMutuallyExclusive("output", "split-output")
 }
 
 func runMerge(cmd *cobra.Command, args []string) error {
 	startTime := time.Now()
+	startRun(cmd)
 
 	log := slog.With(
 		"command", "merge",
@@ -53,9 +95,31 @@ func runMerge(cmd *cobra.Command, args []string) error {
 
 	log.Info("starting merge operation")
 
-	m := merger.New()
+	if initialFile == loader.StdinLocation && responseFile == loader.StdinLocation {
+		return fmt.Errorf("--initial and --response cannot both read from stdin")
+	}
+
+	opts, err := getMergeOptions(cmd)
+	if err != nil {
+		return err
+	}
+	m := merger.NewWithOptions(opts)
+
+	initial, initialInput, err := m.LoadInitialWithInput(cmd.Context(), initialFile)
+	if err != nil {
+		return fmt.Errorf("merge failed: %w", err)
+	}
+	response, responseInput, err := m.LoadResponseWithInput(cmd.Context(), responseFile)
+	if err != nil {
+		return fmt.Errorf("merge failed: %w", err)
+	}
+	if err := m.Validate(initial, response); err != nil {
+		log.Error("merge validation failed", "error", err)
+		return fmt.Errorf("merge failed: %w", err)
+	}
+	warnWeakCertificates(log, opts.Weak, response)
 
-	result, err := m.MergeFromFiles(initialFile, responseFile)
+	result, err := m.Merge(cmd.Context(), initial, response)
 	if err != nil {
 		log.Error("merge failed", "error", err)
 		return fmt.Errorf("merge failed: %w", err)
@@ -66,24 +130,131 @@ func runMerge(cmd *cobra.Command, args []string) error {
 		"duration", time.Since(startTime),
 	)
 
-	jsonData, err := m.ToJSON(result, !compact)
-	if err != nil {
-		log.Error("failed to encode JSON", "error", err)
-		return fmt.Errorf("failed to encode JSON: %w", err)
+	meta := outputMeta("", initialInput, responseInput)
+	if splitOutput != "" {
+		if err := writeSplitOutput(cmd.Context(), log, splitOutput, result, meta); err != nil {
+			log.Error("failed to write split output", "error", err, "dir", splitOutput)
+			return fmt.Errorf("failed to write output: %w", err)
+		}
+		log.Info("merge operation finished", "total_duration", time.Since(startTime))
+		return nil
+	}
+
+	if err := writeResult(outputFile, result, meta, !compact); err != nil {
+		log.Error("failed to write output", "error", err, "file", outputFile)
+		return fmt.Errorf("failed to write output: %w", err)
 	}
 
 	if outputFile != "" {
-		if err := os.WriteFile(outputFile, jsonData, 0o600); err != nil {
-			log.Error("failed to write output file", "error", err, "file", outputFile)
-			return fmt.Errorf("failed to write output file: %w", err)
+		log.Info("output written to file", "file", outputFile)
+		fmt.Fprintln(os.Stderr, i18n.T("merge.output_written", outputFile))
+
+		sigPath, err := signOutput(cmd.Context(), outputFile)
+		if err != nil {
+			log.Error("failed to sign output", "error", err, "file", outputFile)
+			return fmt.Errorf("failed to sign output: %w", err)
+		}
+		if sigPath != "" {
+			log.Info("output signed", "signature", sigPath)
+			fmt.Fprintln(os.Stderr, i18n.T("merge.signature_written", sigPath))
 		}
-		log.Info("output written to file", "file", outputFile, "size_bytes", len(jsonData))
-		fmt.Fprintf(os.Stderr, "Output written to %s\n", outputFile)
-	} else {
-		fmt.Println(string(jsonData))
 	}
 
 	log.Info("merge operation finished", "total_duration", time.Since(startTime))
 
 	return nil
 }
+
+// addMergeFlags registers flags that override the "merge:" config section.
+func addMergeFlags(cmd *cobra.Command) {
+	cmd.Flags().String("strategy", "", "certificate merge strategy: replace, append, keep (default: merge.strategy or replace)")
+	cmd.Flags().Bool("normalize", false, "match URLs case-insensitively and with default ports")
+	cmd.Flags().Bool("alt-names", false, "also match response URLs with a host in an alternative domain name of the domain")
+	cmd.Flags().StringSlice("host-alias", nil, "match response URLs with host alias to the server with host: alias=host (repeatable)")
+	cmd.Flags().Bool("strict", false, "fail when response URLs match no LDAP server")
+	cmd.Flags().Bool("dedup", false, "remove duplicate certificates per server")
+	cmd.Flags().Int("merge-workers", 0, "goroutines merging domains in parallel (0: one per CPU, 1: sequential)")
+	cmd.Flags().String("weak-certificates", "", "policy for response certificates with SHA-1 signatures, RSA keys under 2048 bits or expired CAs: ignore, warn, fail (default: merge.weak_certificates or warn)")
+	registerSettings(cmd, mergeSettings...)
+}
+
+// getMergeOptions returns merge options resolved from the merge flags, env
+// and the "merge:" config section.
+func getMergeOptions(cmd *cobra.Command) (merger.Options, error) {
+	opts := merger.Options{
+		Strategy:  merger.Strategy(viper.GetString("merge.strategy")),
+		Normalize: viper.GetBool("merge.normalize"),
+		AltNames:  viper.GetBool("merge.alt_names"),
+		Strict:    viper.GetBool("merge.strict"),
+		Dedup:     viper.GetBool("merge.dedup"),
+		Workers:   viper.GetInt("merge.workers"),
+	}
+
+	aliases, err := merger.ParseHostAliases(viper.GetStringSlice("merge.host_aliases"))
+	if err != nil {
+		return opts, err
+	}
+	opts.HostAliases = aliases
+
+	if err := checkInteractive(); err != nil {
+		return opts, err
+	}
+	opts.ResolveConflict = conflicts.certificateResolver()
+
+	strategy, err := merger.ParseStrategy(string(opts.Strategy))
+	if err != nil {
+		return opts, err
+	}
+	opts.Strategy = strategy
+
+	if opts.Weak, err = merger.ParseWeakPolicy(viper.GetString("merge.weak_certificates")); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+// warnWeakCertificates reports the weak certificates of response on stderr
+// under merger.WeakWarn; merger.Validate enforces merger.WeakFail.
+func warnWeakCertificates(log *slog.Logger, policy merger.WeakPolicy, response *models.CertificateResponse) {
+	if policy != merger.WeakWarn {
+		return
+	}
+	for _, weak := range merger.WeakCertificates(response, time.Now()) {
+		log.Warn("weak certificate in response",
+			"url", weak.URL,
+			"subject", weak.Subject,
+			"fingerprint", weak.Fingerprint,
+			"reasons", weak.Reasons,
+		)
+		fmt.Fprintln(os.Stderr, i18n.T("merge.weak_certificate", weak.URL, weak.Subject, strings.Join(weak.Reasons, ", ")))
+	}
+}
+
+// writeSplitOutput writes each domain of result to its own file in dir, as
+// named by merger.SplitFileNames, and signs each file when signing is
+// configured. Files of domains no longer in result are left in place.
+func writeSplitOutput(ctx context.Context, log *slog.Logger, dir string, result []models.Domain, meta *merger.Meta) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	signed := 0
+	for i, name := range merger.SplitFileNames(result) {
+		path := filepath.Join(dir, name)
+		if err := writeResult(path, result[i:i+1], meta, !compact); err != nil {
+			return err
+		}
+		sigPath, err := signOutput(ctx, path)
+		if err != nil {
+			return fmt.Errorf("failed to sign %s: %w", path, err)
+		}
+		if sigPath != "" {
+			signed++
+		}
+	}
+
+	log.Info("split output written", "dir", dir, "files", len(result), "signed", signed)
+	fmt.Fprintln(os.Stderr, i18n.T("merge.split_written", len(result), dir))
+	return nil
+}
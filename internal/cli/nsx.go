@@ -2,15 +2,20 @@ package cli
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/diff"
+	"ldapmerge/internal/i18n"
 	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
 	"ldapmerge/internal/nsx"
 )
 
@@ -20,8 +25,35 @@ var (
 	nsxPassword string
 	nsxInsecure bool
 	nsxTimeout  int
+
+	// realizationTimeout is how long pushes wait for NSX to realize each
+	// source (--realization-timeout)
+	realizationTimeout time.Duration
+	// retryConflicts pushes sources that changed on NSX since the pull again
+	// (--retry-conflicts)
+	retryConflicts bool
+	// pushConcurrency is how many sources are pushed at once (--concurrency)
+	pushConcurrency int
+	// stopOnError skips the remaining sources after a failure (--stop-on-error)
+	stopOnError bool
+
+	nsxDiffJSON     bool
+	nsxDiffExitCode bool
 )
 
+// realizationSetting is the setting of --realization-timeout on the commands
+// that push to NSX
+var realizationSetting = setting{Key: "nsx.realization_timeout", Flag: "realization-timeout"}
+
+// retryConflictsSetting is the setting of --retry-conflicts
+var retryConflictsSetting = setting{Key: "nsx.retry_conflicts", Flag: "retry-conflicts"}
+
+// pushConcurrencySettings are the settings of --concurrency and --stop-on-error
+var pushConcurrencySettings = []setting{
+	{Key: "nsx.push_concurrency", Flag: "concurrency"},
+	{Key: "nsx.stop_on_error", Flag: "stop-on-error"},
+}
+
 // nsxCmd represents the nsx command group
 var nsxCmd = &cobra.Command{
 	Use:   "nsx",
@@ -31,11 +63,27 @@ var nsxCmd = &cobra.Command{
 Available operations:
   pull       - Fetch all LDAP identity sources
   push       - Update LDAP identity sources from file
+  diff       - Compare a file with the LDAP identity sources on NSX
   get        - Get specific LDAP identity source
   delete     - Delete LDAP identity source
   probe      - Test LDAP server connection
   fetch-cert - Fetch SSL certificate from LDAP server
-  search     - Search users/groups in LDAP identity source`,
+  search     - Search users/groups in LDAP identity source
+
+Connection settings can also come from LDAPMERGE_NSX_* environment variables,
+the "nsx:" config section or, except the password, a named profile in the
+config file, selected with --profile or the "profile" config key:
+
+  profiles:
+    prod:
+      host: https://nsx.example.com
+      username: admin
+      insecure: false
+      timeout: 60
+
+Flags override env, which overrides the profile, which overrides "nsx:".
+See "ldapmerge config effective nsx pull".`,
+	PersistentPreRunE: requireNSXConnection,
 }
 
 // nsxPullCmd pulls LDAP identity sources from NSX
@@ -52,8 +100,43 @@ var nsxPushCmd = &cobra.Command{
 	Use:   "push",
 	Short: "Push LDAP identity sources to NSX",
 	Long: `Push merged LDAP configuration to NSX Manager.
-Takes a JSON file (output from merge command) and updates NSX.`,
-	RunE: runNSXPush,
+Takes a JSON file (output from merge command) and updates NSX. A source
+counts as pushed once NSX has realized it, which the push waits for up to
+--realization-timeout.
+
+Sources carry the NSX _revision they were pulled at. A source changed on NSX
+since then is not overwritten: re-pull and merge again, or push with
+--retry-conflicts to overwrite the change.
+
+--reason is required. The push is recorded with its outcome in the audit log
+of the database (--db) and sent to the audit webhook, if one is configured.
+Sources matching audit.protected_sources in the config file are only pushed
+with --force-protected.`,
+	Example: `  ldapmerge nsx push -f merged.json --reason "CHG-1234: renew AD certificates"`,
+	RunE:    runNSXPush,
+}
+
+// nsxDiffCmd compares a domain file with the identity sources on NSX
+var nsxDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare a file with the LDAP identity sources on NSX",
+	Long: `Compare the domains of a file with the LDAP identity sources on NSX, as
+a push of the file would change them: lines are prefixed with + (only in the
+file), - (only on NSX; a push leaves such sources alone) and ~ (changed).
+
+Domains are matched by ID and LDAP servers by URL; certificates are compared
+by SHA-256 fingerprint. Bind passwords and revisions are not compared.
+
+With --exit-code the command fails when there are differences, so that a
+scheduled run reports sources changed on NSX outside ldapmerge (drift).`,
+	Example: `  # What a push of the merge result would change
+  ldapmerge nsx diff -f merged.json
+
+  # Drift check against the last pushed configuration
+  ldapmerge nsx diff -f pushed.json --exit-code`,
+	Args:         cobra.NoArgs,
+	RunE:         runNSXDiff,
+	SilenceUsage: true,
 }
 
 // nsxGetCmd gets a specific LDAP identity source
@@ -69,9 +152,15 @@ var nsxGetCmd = &cobra.Command{
 var nsxDeleteCmd = &cobra.Command{
 	Use:   "delete <id>",
 	Short: "Delete LDAP identity source",
-	Long:  `Delete an LDAP identity source from NSX Manager.`,
-	Args:  cobra.ExactArgs(1),
-	RunE:  runNSXDelete,
+	Long: `Delete an LDAP identity source from NSX Manager.
+
+--reason is required. The deletion is recorded in the audit log of the
+database (--db) and sent to the audit webhook, if one is configured.
+Sources matching audit.protected_sources in the config file are only deleted
+with --force-protected.`,
+	Example: `  ldapmerge nsx delete old.lab --reason "CHG-1235: domain decommissioned"`,
+	Args:    cobra.ExactArgs(1),
+	RunE:    runNSXDelete,
 }
 
 // nsxProbeCmd tests LDAP server connection
@@ -108,6 +197,7 @@ func init() {
 	rootCmd.AddCommand(nsxCmd)
 	nsxCmd.AddCommand(nsxPullCmd)
 	nsxCmd.AddCommand(nsxPushCmd)
+	nsxCmd.AddCommand(nsxDiffCmd)
 	nsxCmd.AddCommand(nsxGetCmd)
 	nsxCmd.AddCommand(nsxDeleteCmd)
 	nsxCmd.AddCommand(nsxProbeCmd)
@@ -115,34 +205,128 @@ func init() {
 	nsxCmd.AddCommand(nsxSearchCmd)
 
 	// Common flags for all nsx subcommands
+	nsxCmd.PersistentFlags().StringVar(&profileName, "profile", "", "connection profile from the config file")
 	nsxCmd.PersistentFlags().StringVar(&nsxHost, "host", "", "NSX Manager host URL (e.g., https://nsx.example.com)")
 	nsxCmd.PersistentFlags().StringVarP(&nsxUsername, "username", "u", "", "NSX API username")
 	nsxCmd.PersistentFlags().StringVarP(&nsxPassword, "password", "P", "", "NSX API password")
 	nsxCmd.PersistentFlags().BoolVarP(&nsxInsecure, "insecure", "k", false, "Skip TLS certificate verification")
 	nsxCmd.PersistentFlags().IntVar(&nsxTimeout, "timeout", 30, "API request timeout in seconds")
+	nsxCmd.PersistentFlags().StringVar(&dbPath, "db", "", "path to SQLite database for the server inventory and audit log (default: ldapmerge/data.db in the user config directory)")
+	nsxCmd.PersistentFlags().BoolVar(&noInventory, "no-inventory", false, "do not record pulls and probes in the server inventory")
 
-	_ = nsxCmd.MarkPersistentFlagRequired("host")
-	_ = nsxCmd.MarkPersistentFlagRequired("username")
-	_ = nsxCmd.MarkPersistentFlagRequired("password")
+	registerSettings(nsxCmd, nsxSettings...)
+	_ = nsxCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+	for _, c := range []*cobra.Command{nsxGetCmd, nsxDeleteCmd, nsxProbeCmd, nsxSearchCmd} {
+		c.ValidArgsFunction = completeSourceIDs
+	}
 
 	// Push-specific flags
-	nsxPushCmd.Flags().StringVarP(&initialFile, "file", "f", "", "path to merged JSON file (required)")
+	nsxPushCmd.Flags().StringVarP(&initialFile, "file", "f", "", "merged JSON location: path, URL or - for stdin (required)")
 	_ = nsxPushCmd.MarkFlagRequired("file")
+	addRealizationFlag(nsxPushCmd)
+	addRetryConflictsFlag(nsxPushCmd)
+	addInteractiveFlag(nsxPushCmd)
+	addPushConcurrencyFlags(nsxPushCmd)
+	addSimulateFlags(nsxPushCmd)
+	addBindPasswordFlags(nsxPushCmd)
+	addClearBindPasswordsFlag(nsxPushCmd)
+
+	nsxDiffCmd.Flags().StringVarP(&initialFile, "file", "f", "", "domain JSON location: path, URL or - for stdin (required)")
+	_ = nsxDiffCmd.MarkFlagRequired("file")
+	nsxDiffCmd.Flags().BoolVar(&nsxDiffJSON, "json", false, "output the structured diff as JSON")
+	nsxDiffCmd.Flags().BoolVar(&nsxDiffExitCode, "exit-code", false, "fail if the file and NSX differ")
+
+	// Destructive operations are audited
+	for _, c := range []*cobra.Command{nsxPushCmd, nsxDeleteCmd} {
+		c.Flags().StringVar(&auditReason, "reason", "", "justification for the change, stored in the audit log (required)")
+		_ = c.MarkFlagRequired("reason")
+		c.Flags().BoolVar(&forceProtected, "force-protected", false, "allow changes to sources matching audit.protected_sources")
+	}
 }
 
 func getNSXClient() *nsx.Client {
 	return nsx.NewClient(nsx.ClientConfig{
-		Host:     nsxHost,
-		Username: nsxUsername,
-		Password: nsxPassword,
-		Insecure: nsxInsecure,
-		Timeout:  time.Duration(nsxTimeout) * time.Second,
+		Host:        nsxHost,
+		Username:    nsxUsername,
+		Password:    nsxPassword,
+		Insecure:    nsxInsecure,
+		Timeout:     time.Duration(nsxTimeout) * time.Second,
+		Diagnostics: nsxDiagnostics(),
+		Chaos:       simulatedChaos,
 	})
 }
 
+// nsxDiagnostics returns the tracing settings of NSX clients:
+// nsx.correlation_header names the request id header ("none" disables it)
+// and calls slower than nsx.slow_threshold are logged.
+func nsxDiagnostics() nsx.Diagnostics {
+	return nsx.Diagnostics{
+		CorrelationHeader: viper.GetString("nsx.correlation_header"),
+		SlowThreshold:     viper.GetDuration("nsx.slow_threshold"),
+	}
+}
+
+// addRealizationFlag adds --realization-timeout to a command that pushes to NSX.
+func addRealizationFlag(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&realizationTimeout, "realization-timeout", nsx.DefaultRealizationTimeout, "how long to wait for NSX to realize each pushed source (0 does not wait)")
+	registerSettings(cmd, realizationSetting)
+}
+
+// addRetryConflictsFlag adds --retry-conflicts to a command that pushes
+// pulled sources to NSX.
+func addRetryConflictsFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&retryConflicts, "retry-conflicts", false, "push sources changed on NSX since the pull again at their current revision, overwriting the change")
+	registerSettings(cmd, retryConflictsSetting)
+}
+
+// addPushConcurrencyFlags adds --concurrency and --stop-on-error to a
+// command that pushes to NSX.
+func addPushConcurrencyFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&pushConcurrency, "concurrency", 1, fmt.Sprintf("identity sources pushed to NSX at once, at most %d; output keeps the order of the sources", nsx.MaxPushConcurrency))
+	cmd.Flags().BoolVar(&stopOnError, "stop-on-error", false, "skip the sources not yet pushed once one fails (default: push them all)")
+	registerSettings(cmd, pushConcurrencySettings...)
+}
+
+// checkPushConcurrency validates --concurrency.
+func checkPushConcurrency() error {
+	if pushConcurrency < 1 || pushConcurrency > nsx.MaxPushConcurrency {
+		return fmt.Errorf("--concurrency must be between 1 and %d", nsx.MaxPushConcurrency)
+	}
+	return nil
+}
+
+// pushSources puts sources on NSX and waits until NSX has realized each,
+// with the --retry-conflicts, --interactive, --realization-timeout,
+// --clear-bind-passwords, --concurrency and --stop-on-error of the command. done gets the outcome of
+// each source in the order of sources.
+func pushSources(ctx context.Context, log *slog.Logger, client *nsx.Client, sources []nsx.LDAPIdentitySource, opts nsx.BatchOptions, done func(nsx.PushResult)) []nsx.PushResult {
+	opts.PushOptions = nsx.PushOptions{
+		RetryConflicts:  retryConflicts,
+		Realization:     nsx.RealizationWait{Timeout: realizationTimeout},
+		ClearPasswords:  clearBindPasswords,
+		ResolveConflict: conflicts.revisionResolver(),
+	}
+	opts.Concurrency = pushConcurrency
+	if interactive {
+		// A push waiting for an answer must not time out
+		opts.Timeout = 0
+	}
+	opts.StopOnError = stopOnError
+	opts.Done = func(result nsx.PushResult) {
+		if result.Retried {
+			log.Warn("source changed on NSX since pull, pushed again at the current revision", "source_id", result.ID)
+		}
+		if result.Kept {
+			log.Warn("source changed on NSX since pull, kept as it is on NSX", "source_id", result.ID)
+		}
+		done(result)
+	}
+	return client.PushLDAPIdentitySources(ctx, sources, opts)
+}
+
 func runNSXPull(cmd *cobra.Command, args []string) error {
 	startTime := time.Now()
-	ctx := context.Background()
+	ctx := cmd.Context()
 
 	log := slog.With(
 		"command", "nsx.pull",
@@ -166,19 +350,19 @@ func runNSXPull(cmd *cobra.Command, args []string) error {
 		"duration", time.Since(startTime),
 	)
 
-	jsonData, err := json.MarshalIndent(domains, "", "    ")
-	if err != nil {
+	recordInventory(ctx, log, domains)
+
+	if err := writeDomains("", domains, true); err != nil {
 		log.Error("failed to encode JSON", "error", err)
 		return fmt.Errorf("failed to encode JSON: %w", err)
 	}
 
-	fmt.Println(string(jsonData))
 	return nil
 }
 
 func runNSXPush(cmd *cobra.Command, args []string) error {
 	startTime := time.Now()
-	ctx := context.Background()
+	ctx := startRun(cmd)
 
 	log := slog.With(
 		"command", "nsx.push",
@@ -188,34 +372,86 @@ func runNSXPush(cmd *cobra.Command, args []string) error {
 
 	log.Info("starting push operation")
 
+	if err := checkInteractive(); err != nil {
+		return err
+	}
+
+	auditLog, err := openAuditLog()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = auditLog.Close() }()
+
 	m := merger.New()
 
-	domains, err := m.LoadInitialFromFile(initialFile)
+	domains, err := m.LoadInitial(ctx, initialFile)
 	if err != nil {
 		log.Error("failed to load file", "error", err)
 		return fmt.Errorf("failed to load file: %w", err)
 	}
 
+	return pushDomains(ctx, log, auditLog, audit.OperationNSXPush, domains, startTime)
+}
+
+// pushDomains pushes domains to NSX as nsx push does: with bind passwords
+// injected, protected sources checked, a snapshot taken first and the
+// outcome audited as operation.
+func pushDomains(ctx context.Context, log *slog.Logger, audited *auditLog, operation string, domains []models.Domain, startTime time.Time) error {
+	if err := checkPushConcurrency(); err != nil {
+		return err
+	}
+	if err := checkSimulateFlags(log); err != nil {
+		return err
+	}
+
 	client := getNSXClient()
 	sources := nsx.DomainsToLDAPIdentitySources(domains)
+	if err := injectSourceBindPasswords(log, sources); err != nil {
+		return err
+	}
 
-	var successCount, errorCount int
+	sourceIDs := make([]string, 0, len(sources))
 	for _, source := range sources {
-		sourceLog := log.With("source_id", source.ID)
-		sourceLog.Info("updating LDAP identity source")
-
-		fmt.Printf("Updating LDAP identity source: %s\n", source.ID)
-		_, err := client.PutLDAPIdentitySource(ctx, &source)
-		if err != nil {
-			sourceLog.Error("failed to update source", "error", err)
-			fmt.Fprintf(os.Stderr, "  ERROR: %v\n", err)
+		sourceIDs = append(sourceIDs, source.ID)
+	}
+	if err := audited.checkProtected(ctx, log, operation, sourceIDs); err != nil {
+		return err
+	}
+	if err := audited.saveSnapshot(ctx, log, client, operation, sourceIDs); err != nil {
+		return err
+	}
+
+	var successCount, errorCount, skippedCount int
+	var firstErr error
+	pushSources(ctx, log, client, sources, nsx.BatchOptions{}, func(result nsx.PushResult) {
+		sourceLog := log.With("source_id", result.ID)
+		if result.Skipped {
+			skippedCount++
+			return
+		}
+
+		fmt.Println(i18n.T("nsx.push.updating", result.ID))
+		if result.Kept {
+			fmt.Println(i18n.T("nsx.push.kept"))
+			return
+		}
+		if result.Err != nil {
+			sourceLog.Error("failed to update source", "error", result.Err, "duration", result.Duration)
+			fmt.Fprintln(os.Stderr, i18n.T("nsx.push.error", result.Err))
+			if firstErr == nil {
+				firstErr = result.Err
+			}
 			errorCount++
-			continue
+			return
 		}
 
-		sourceLog.Info("source updated successfully")
-		fmt.Printf("  OK\n")
+		sourceLog.Info("source updated successfully", "duration", result.Duration)
+		fmt.Println(i18n.T("nsx.push.ok"))
 		successCount++
+	})
+	if skippedCount > 0 {
+		log.Warn("push stopped", "skipped_count", skippedCount)
+		fmt.Println(i18n.T("nsx.push.stopped", skippedCount))
 	}
 
 	log.Info("push completed",
@@ -224,12 +460,60 @@ func runNSXPush(cmd *cobra.Command, args []string) error {
 		"duration", time.Since(startTime),
 	)
 
+	return audited.record(ctx, log, operation, sourceIDs, successCount, errorCount, firstErr)
+}
+
+func runNSXDiff(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	log := slog.With(
+		"command", "nsx.diff",
+		"nsx_host", nsxHost,
+		"file", initialFile,
+	)
+
+	domains, err := merger.New().LoadInitial(ctx, initialFile)
+	if err != nil {
+		log.Error("failed to load file", "error", err)
+		return fmt.Errorf("failed to load file: %w", err)
+	}
+
+	result, err := getNSXClient().ListLDAPIdentitySources(ctx)
+	if err != nil {
+		log.Error("failed to fetch LDAP identity sources", "error", err)
+		return fmt.Errorf("failed to fetch LDAP identity sources: %w", err)
+	}
+	current := nsx.LDAPIdentitySourcesToDomains(result.Results)
+
+	// Compare the file as it would be pushed: with NSX defaults and flags
+	desired := nsx.LDAPIdentitySourcesToDomains(nsx.DomainsToLDAPIdentitySources(domains))
+	r := diff.Compare(current, desired)
+
+	log.Info("diff completed",
+		"added_count", len(r.AddedDomains),
+		"removed_count", len(r.RemovedDomains),
+		"changed_count", len(r.ChangedDomains),
+	)
+
+	if nsxDiffJSON {
+		err = writeJSON(r)
+	} else {
+		headerStyle.Println(i18n.T("nsx.diff.title", nsxHost, initialFile) + "\n")
+		err = printDiff(r)
+	}
+	if err != nil {
+		return err
+	}
+
+	if nsxDiffExitCode && !r.Empty() {
+		return errors.New("the file and NSX differ")
+	}
 	return nil
 }
 
 func runNSXGet(cmd *cobra.Command, args []string) error {
 	startTime := time.Now()
-	ctx := context.Background()
+	ctx := cmd.Context()
 
 	id := args[0]
 
@@ -253,18 +537,16 @@ func runNSXGet(cmd *cobra.Command, args []string) error {
 
 	log.Info("fetch completed", "duration", time.Since(startTime))
 
-	jsonData, err := json.MarshalIndent(domain, "", "    ")
-	if err != nil {
+	if err := writeJSON(domain); err != nil {
 		log.Error("failed to encode JSON", "error", err)
 		return fmt.Errorf("failed to encode JSON: %w", err)
 	}
 
-	fmt.Println(string(jsonData))
 	return nil
 }
 
 func runNSXDelete(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+	ctx := cmd.Context()
 	id := args[0]
 
 	log := slog.With(
@@ -275,20 +557,31 @@ func runNSXDelete(cmd *cobra.Command, args []string) error {
 
 	log.Info("deleting LDAP identity source")
 
+	auditLog, err := openAuditLog()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = auditLog.Close() }()
+
+	if err := auditLog.checkProtected(ctx, log, audit.OperationNSXDelete, []string{id}); err != nil {
+		return err
+	}
+
 	client := getNSXClient()
 
 	if err := client.DeleteLDAPIdentitySource(ctx, id); err != nil {
 		log.Error("failed to delete LDAP identity source", "error", err)
+		_ = auditLog.record(ctx, log, audit.OperationNSXDelete, []string{id}, 0, 1, err)
 		return fmt.Errorf("failed to delete: %w", err)
 	}
 
 	log.Info("LDAP identity source deleted successfully")
-	fmt.Printf("✓ Deleted LDAP identity source: %s\n", id)
-	return nil
+	fmt.Println(i18n.T("nsx.delete.done", id))
+	return auditLog.record(ctx, log, audit.OperationNSXDelete, []string{id}, 1, 0, nil)
 }
 
 func runNSXProbe(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+	ctx := cmd.Context()
 	id := args[0]
 
 	log := slog.With(
@@ -307,7 +600,9 @@ func runNSXProbe(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("probe failed: %w", err)
 	}
 
-	fmt.Printf("Probe results for %s:\n", id)
+	recordProbes(ctx, log, result)
+
+	fmt.Println(i18n.T("nsx.probe.results", id))
 	for _, item := range result.Results {
 		status := "✓"
 		if !item.Success {
@@ -330,7 +625,7 @@ func runNSXProbe(cmd *cobra.Command, args []string) error {
 }
 
 func runNSXFetchCert(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+	ctx := cmd.Context()
 	ldapURL := args[0]
 
 	log := slog.With(
@@ -352,26 +647,26 @@ func runNSXFetchCert(cmd *cobra.Command, args []string) error {
 	log.Info("certificate fetched successfully")
 
 	// Print certificate details
-	fmt.Printf("Certificate from %s:\n\n", ldapURL)
+	fmt.Println(i18n.T("nsx.cert.title", ldapURL) + "\n")
 	if len(result.Details) > 0 {
 		d := result.Details[0]
-		fmt.Printf("  Subject CN:  %s\n", d.SubjectCN)
-		fmt.Printf("  Subject DN:  %s\n", d.SubjectDN)
-		fmt.Printf("  Issuer CN:   %s\n", d.IssuerCN)
-		fmt.Printf("  Not Before:  %s\n", d.NotBefore)
-		fmt.Printf("  Not After:   %s\n", d.NotAfter)
-		fmt.Printf("  Algorithm:   %s\n", d.SignatureAlgorithm)
+		fmt.Println(i18n.T("nsx.cert.subject_cn", d.SubjectCN))
+		fmt.Println(i18n.T("nsx.cert.subject_dn", d.SubjectDN))
+		fmt.Println(i18n.T("nsx.cert.issuer_cn", d.IssuerCN))
+		fmt.Println(i18n.T("nsx.cert.not_before", d.NotBefore))
+		fmt.Println(i18n.T("nsx.cert.not_after", d.NotAfter))
+		fmt.Println(i18n.T("nsx.cert.algorithm", d.SignatureAlgorithm))
 		fmt.Println()
 	}
 
-	fmt.Println("PEM Certificate:")
+	fmt.Println(i18n.T("nsx.cert.pem"))
 	fmt.Println(result.PEMEncoded)
 
 	return nil
 }
 
 func runNSXSearch(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+	ctx := cmd.Context()
 	id := args[0]
 	filter := args[1]
 
@@ -394,7 +689,7 @@ func runNSXSearch(cmd *cobra.Command, args []string) error {
 
 	log.Info("search completed", "result_count", result.ResultCount)
 
-	fmt.Printf("Search results for '%s' in %s (%d found):\n\n", filter, id, result.ResultCount)
+	fmt.Println(i18n.T("nsx.search.results", filter, id, result.ResultCount) + "\n")
 
 	for _, item := range result.Results {
 		typeIcon := "👤"
@@ -404,10 +699,10 @@ func runNSXSearch(cmd *cobra.Command, args []string) error {
 		fmt.Printf("%s %s\n", typeIcon, item.Name)
 		fmt.Printf("   DN: %s\n", item.DN)
 		if item.DisplayName != "" {
-			fmt.Printf("   Display Name: %s\n", item.DisplayName)
+			fmt.Println(i18n.T("nsx.search.display_name", item.DisplayName))
 		}
 		if item.Email != "" {
-			fmt.Printf("   Email: %s\n", item.Email)
+			fmt.Println(i18n.T("nsx.search.email", item.Email))
 		}
 		fmt.Println()
 	}
@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/signing"
+	"ldapmerge/internal/version"
+)
+
+// writeOutput streams output produced by write to the file at path, or to
+// stdout when path is empty, through a buffered writer. Stdout output is
+// terminated with a newline.
+func writeOutput(path string, write func(w io.Writer) error) error {
+	if path != "" {
+		return writeFileAtomic(path, write)
+	}
+
+	bw := bufio.NewWriterSize(os.Stdout, 64*1024)
+	if err := write(bw); err != nil {
+		return err
+	}
+	if err := bw.WriteByte('\n'); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writeFileAtomic streams output produced by write to a temporary file next
+// to path and renames it over path once complete, so that a failed write
+// leaves an existing file untouched. A new file is created with mode 0600;
+// an existing one keeps its mode.
+func writeFileAtomic(path string, write func(w io.Writer) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	if info, err := os.Stat(path); err == nil {
+		if err := f.Chmod(info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriterSize(f, 64*1024)
+	if err := write(bw); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// writeDomains streams domains as JSON, one domain at a time.
+func writeDomains(path string, domains []models.Domain, indent bool) error {
+	return writeResult(path, domains, nil, indent)
+}
+
+// writeResult streams a merge result as writeDomains does, preceded by its
+// _meta element when meta is not nil.
+func writeResult(path string, domains []models.Domain, meta *merger.Meta, indent bool) error {
+	return writeOutput(path, func(w io.Writer) error {
+		return merger.New().WriteJSONWithMeta(w, domains, meta, indent)
+	})
+}
+
+// metaSettings are the settings of the flag added by addMetaFlag
+var metaSettings = []setting{
+	{Key: "output.meta", Flag: "meta"},
+}
+
+// addMetaFlag registers --meta on a command that writes merge results.
+func addMetaFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("meta", false, "embed a _meta element with the ldapmerge version, time, input SHA-256 and NSX host in output files")
+	registerSettings(cmd, metaSettings...)
+}
+
+// outputMeta returns the _meta of a result made from inputs, with NSX host
+// host if any, or nil unless --meta or output.meta is set.
+func outputMeta(host string, inputs ...merger.Input) *merger.Meta {
+	if !viper.GetBool("output.meta") {
+		return nil
+	}
+	return &merger.Meta{
+		Tool:      "ldapmerge",
+		Version:   version.Short(),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		NSXHost:   host,
+		Inputs:    inputs,
+	}
+}
+
+// writeJSON prints a single small value to stdout as indented JSON.
+func writeJSON(v any) error {
+	return writeOutput("", func(w io.Writer) error {
+		data, err := json.MarshalIndent(v, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+}
+
+// getSigner returns the output signer from the "signing:" config section,
+// or nil when signing is not configured.
+func getSigner() (signing.Signer, error) {
+	if key := viper.GetString("signing.key"); key != "" {
+		signer, err := signing.NewEd25519Signer(key)
+		if err != nil {
+			return nil, err
+		}
+		return signer, nil
+	}
+	if keyID := viper.GetString("signing.gpg_key"); keyID != "" {
+		signer, err := signing.NewGPGSigner(keyID)
+		if err != nil {
+			return nil, err
+		}
+		return signer, nil
+	}
+	return nil, nil
+}
+
+// signOutput writes a detached signature next to the file at path when
+// signing is configured. It returns the signature path, or "" if unsigned.
+func signOutput(ctx context.Context, path string) (string, error) {
+	signer, err := getSigner()
+	if err != nil || signer == nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	sig, err := signer.Sign(ctx, data)
+	if err != nil {
+		return "", err
+	}
+
+	sigPath := path + signer.Extension()
+	if err := os.WriteFile(sigPath, sig, 0o600); err != nil {
+		return "", err
+	}
+	return sigPath, nil
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteOutputFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "result.json")
+	if err := os.WriteFile(path, []byte(`["previous"]`), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed write leaves the file as it was and no temporary file behind
+	failure := errors.New("encode failed")
+	err := writeOutput(path, func(w io.Writer) error {
+		_, _ = io.WriteString(w, `["partial`)
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected the write error, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != `["previous"]` {
+		t.Errorf("Expected the file untouched, got %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the output file, got %d entries", len(entries))
+	}
+
+	if err := writeOutput(path, func(w io.Writer) error {
+		_, err := io.WriteString(w, `["new"]`)
+		return err
+	}); err != nil {
+		t.Fatalf("writeOutput failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	info, _ := os.Stat(path)
+	if string(data) != `["new"]` || info.Mode().Perm() != 0o640 {
+		t.Errorf("Expected the new content with the previous mode, got %q %v", data, info.Mode().Perm())
+	}
+
+	created := filepath.Join(dir, "created.json")
+	if err := writeOutput(created, func(w io.Writer) error { return nil }); err != nil {
+		t.Fatalf("writeOutput failed: %v", err)
+	}
+	if info, err := os.Stat(created); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected a new file with mode 0600, got %v (%v)", info, err)
+	}
+}
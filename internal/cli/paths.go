@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/paths"
+)
+
+var (
+	dataMigration sync.Once
+	logMigration  sync.Once
+
+	// movedLogs are the log files resolveLogDir moved from the executable
+	// directory, logged once logging is initialized
+	movedLogs []string
+)
+
+// migrateLegacy moves the files matching patterns from the default
+// directory of earlier versions, legacy, to dir and prints what it moved
+// to stderr. A failure is printed and leaves the files not yet moved where
+// they are.
+func migrateLegacy(legacy func() (string, error), dir string, patterns []string) []string {
+	from, err := legacy()
+	if err != nil {
+		return nil
+	}
+	moved, err := paths.Migrate(from, dir, patterns...)
+	for _, file := range moved {
+		fmt.Fprintln(os.Stderr, i18n.T("paths.moved", file))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, i18n.T("paths.move_failed", err))
+	}
+	return moved
+}
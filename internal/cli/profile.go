@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// profileName selects a profile from the "profiles:" config section
+var profileName string
+
+// Profile holds NSX connection defaults for the nsx and sync commands. The
+// password is deliberately not part of it. Profiles are applied by the
+// settings resolution in config.go, between env and the config file.
+type Profile struct {
+	Host     string `mapstructure:"host"`
+	Username string `mapstructure:"username"`
+	Insecure bool   `mapstructure:"insecure"`
+	Timeout  int    `mapstructure:"timeout"` // seconds
+}
+
+// getProfiles returns the profiles defined in the config file.
+func getProfiles() (map[string]Profile, error) {
+	var profiles map[string]Profile
+	if err := viper.UnmarshalKey("profiles", &profiles); err != nil {
+		return nil, fmt.Errorf("invalid profiles config: %w", err)
+	}
+	return profiles, nil
+}
+
+// profileNames returns the names of the configured profiles, sorted.
+func profileNames() []string {
+	profiles, err := getProfiles()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requireNSXConnection checks that the NSX connection settings resolved from
+// flags, env, the selected profile or the config file are complete.
+func requireNSXConnection(cmd *cobra.Command, _ []string) error {
+	var missing []string
+	if nsxHost == "" {
+		missing = append(missing, "host")
+	}
+	if nsxUsername == "" {
+		missing = append(missing, "username")
+	}
+	if nsxPassword == "" {
+		missing = append(missing, "password")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf(`required flag(s) "%s" not set (see "%s config effective %s")`,
+			strings.Join(missing, `", "`), rootCmd.Name(), strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()+" "))
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// progressLogInterval is how often progress is logged when stdout is not a TTY.
+const progressLogInterval = 10 * time.Second
+
+// progressBarWidth is the number of cells in the TTY progress bar.
+const progressBarWidth = 30
+
+// pushProgress tracks per-source push progress and estimates time remaining.
+// On a TTY it renders a progress bar below the per-source result lines;
+// otherwise it emits periodic slog entries.
+type pushProgress struct {
+	mu        sync.Mutex
+	out       io.Writer
+	log       *slog.Logger
+	tty       bool
+	total     int
+	done      int
+	failed    int
+	current   string
+	started   time.Time
+	lastLog   time.Time
+	latencies time.Duration
+}
+
+// newPushProgress creates a progress tracker for total sources.
+func newPushProgress(total int, log *slog.Logger) *pushProgress {
+	now := time.Now()
+	return &pushProgress{
+		out:     os.Stdout,
+		log:     log,
+		tty:     isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd()),
+		total:   total,
+		started: now,
+		lastLog: now,
+	}
+}
+
+// Start marks a source as currently being pushed.
+func (p *pushProgress) Start(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.current = id
+	if p.tty {
+		p.render()
+	}
+}
+
+// Done records the outcome and latency of a single source push.
+func (p *pushProgress) Done(id string, latency time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done++
+	p.latencies += latency
+	p.current = ""
+	if err != nil {
+		p.failed++
+	}
+
+	if p.tty {
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+	if err != nil {
+		fmt.Fprintf(p.out, "  ✗ %s (%s): %v\n", id, latency.Round(time.Millisecond), err)
+	} else {
+		fmt.Fprintf(p.out, "  ✓ %s (%s)\n", id, latency.Round(time.Millisecond))
+	}
+
+	if p.tty {
+		if p.done < p.total {
+			p.render()
+		}
+		return
+	}
+
+	if time.Since(p.lastLog) >= progressLogInterval || p.done == p.total {
+		p.lastLog = time.Now()
+		p.log.Info("push progress",
+			"done", p.done,
+			"total", p.total,
+			"failed", p.failed,
+			"avg_latency", p.avgLatency(),
+			"eta", p.eta(),
+		)
+	}
+}
+
+// Finish clears the progress bar line.
+func (p *pushProgress) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.tty {
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+}
+
+func (p *pushProgress) avgLatency() time.Duration {
+	if p.done == 0 {
+		return 0
+	}
+	return (p.latencies / time.Duration(p.done)).Round(time.Millisecond)
+}
+
+// eta estimates the remaining time by extrapolating the time elapsed since
+// the start over the sources not yet done, so time spent between pushes
+// counts as well as the push latencies.
+func (p *pushProgress) eta() time.Duration {
+	if p.done == 0 {
+		return 0
+	}
+	elapsed := time.Since(p.started)
+	perSource := elapsed / time.Duration(p.done)
+	return (perSource * time.Duration(p.total-p.done)).Round(time.Second)
+}
+
+func (p *pushProgress) render() {
+	filled := 0
+	if p.total > 0 {
+		filled = p.done * progressBarWidth / p.total
+	}
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled)
+
+	eta := "--"
+	if p.done > 0 {
+		eta = p.eta().String()
+	}
+
+	fmt.Fprintf(p.out, "\r\033[K  [%s] %d/%d ETA %s", bar, p.done, p.total, eta)
+	if p.current != "" {
+		fmt.Fprintf(p.out, " → %s", p.current)
+	}
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPushProgressETA(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		total   int
+		done    int
+		elapsed time.Duration
+		want    time.Duration
+	}{
+		{"nothing done", 4, 0, 10 * time.Second, 0},
+		{"half done", 4, 2, 10 * time.Second, 10 * time.Second},
+		{"one of ten", 10, 1, 3 * time.Second, 27 * time.Second},
+		{"all done", 3, 3, time.Minute, 0},
+		{"rounded", 3, 2, 3 * time.Second, 2 * time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &pushProgress{total: tc.total, done: tc.done, started: time.Now().Add(-tc.elapsed)}
+			if got := p.eta(); got != tc.want {
+				t.Errorf("eta() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPushProgressRender(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		total   int
+		done    int
+		current string
+		want    string
+	}{
+		{"start", 4, 0, "", "\r\033[K  [" + strings.Repeat("░", 30) + "] 0/4 ETA --"},
+		{"half", 4, 2, "ad-03", "\r\033[K  [" + strings.Repeat("█", 15) + strings.Repeat("░", 15) + "] 2/4 ETA 10s → ad-03"},
+		{"no sources", 0, 0, "", "\r\033[K  [" + strings.Repeat("░", 30) + "] 0/0 ETA --"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			p := &pushProgress{out: &out, total: tc.total, done: tc.done, current: tc.current, started: time.Now().Add(-10 * time.Second)}
+			p.render()
+			if out.String() != tc.want {
+				t.Errorf("render() = %q, want %q", out.String(), tc.want)
+			}
+		})
+	}
+}
+
+func TestPushProgressDone(t *testing.T) {
+	var out bytes.Buffer
+	p := &pushProgress{out: &out, log: slog.New(slog.NewTextHandler(io.Discard, nil)), total: 2, started: time.Now(), lastLog: time.Now()}
+	p.Done("ad-01", 1500*time.Microsecond, nil)
+	p.Done("ad-02", 20*time.Millisecond, errors.New("refused"))
+
+	want := "  ✓ ad-01 (2ms)\n  ✗ ad-02 (20ms): refused\n"
+	if out.String() != want {
+		t.Errorf("Unexpected output %q, want %q", out.String(), want)
+	}
+	if p.failed != 1 || p.avgLatency() != 11*time.Millisecond {
+		t.Errorf("Expected 1 failure and an 11ms average, got %d, %s", p.failed, p.avgLatency())
+	}
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/report"
+)
+
+var (
+	reportInput  string
+	reportOutput string
+	reportFormat string
+)
+
+// reportCmd represents the report command group
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "📋 Reports for audits",
+	Long: `Reports on the LDAP identity sources of NSX Manager or of a JSON file,
+rendered as HTML (printable to PDF), Markdown or JSON.
+
+Available operations:
+  security - LDAP security posture: transports, keys, signatures, expiry`,
+}
+
+// reportSecurityCmd reports the security posture of LDAP identity sources
+var reportSecurityCmd = &cobra.Command{
+	Use:   "security",
+	Short: "LDAP security posture: transports, keys, signatures, expiry",
+	Long: `Summarize the security posture of LDAP identity sources for auditors:
+
+  - per identity source, how many servers use LDAPS, StartTLS or plaintext LDAP
+  - the key types and sizes and signature algorithms of their certificates
+  - how many certificates expire within 30, 90 and 365 days or have expired
+  - servers using TLS without any certificate
+  - every server with its certificates
+
+The identity sources are pulled from NSX Manager (--profile, --host and the
+other connection flags) or, with -i, read from an initial or merged JSON.
+
+The format follows the extension of --output (.html, .md or .json) unless
+--format is set, and is HTML otherwise. The HTML is styled for printing, so
+a browser can save it as PDF.`,
+	Example: `  # Posture of the NSX of the "prod" profile, for the auditors
+  ldapmerge report security --profile prod -P secret -o ldap-security.html
+
+  # Posture of a merged result before pushing it
+  ldapmerge report security -i result.json --format markdown`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if reportInput != "" {
+			return nil
+		}
+		return requireNSXConnection(cmd, args)
+	},
+	RunE:         runReportSecurity,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+	reportCmd.AddCommand(reportSecurityCmd)
+
+	// NSX connection flags (same as nsx command)
+	reportSecurityCmd.Flags().StringVar(&profileName, "profile", "", "connection profile from the config file (see ldapmerge nsx --help)")
+	reportSecurityCmd.Flags().StringVar(&nsxHost, "host", "", "NSX Manager host URL (required unless set by --profile or -i is given)")
+	reportSecurityCmd.Flags().StringVarP(&nsxUsername, "username", "u", "", "NSX API username (required unless set by --profile or -i is given)")
+	reportSecurityCmd.Flags().StringVarP(&nsxPassword, "password", "P", "", "NSX API password (required unless set by LDAPMERGE_NSX_PASSWORD or -i is given)")
+	reportSecurityCmd.Flags().BoolVarP(&nsxInsecure, "insecure", "k", false, "Skip TLS certificate verification")
+	reportSecurityCmd.Flags().IntVar(&nsxTimeout, "timeout", 30, "API request timeout in seconds")
+
+	reportSecurityCmd.Flags().StringVarP(&reportInput, "input", "i", "", "initial or merged JSON to report on instead of NSX: path, URL or - for stdin")
+	reportSecurityCmd.Flags().StringVarP(&reportOutput, "output", "o", "", "output file (default: stdout)")
+	reportSecurityCmd.Flags().StringVar(&reportFormat, "format", "", "report format: html, markdown, json (default: from the --output extension, else html)")
+
+	registerSettings(reportSecurityCmd, nsxSettings...)
+	_ = reportSecurityCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+	_ = reportSecurityCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(
+		[]string{string(report.FormatHTML), string(report.FormatMarkdown), string(report.FormatJSON)}, cobra.ShellCompDirectiveNoFileComp))
+}
+
+// getReportFormat returns the format of --format or, without it, of the
+// --output extension; HTML for stdout.
+func getReportFormat() (report.Format, error) {
+	switch report.Format(reportFormat) {
+	case report.FormatHTML, report.FormatMarkdown, report.FormatJSON:
+		return report.Format(reportFormat), nil
+	case "":
+	default:
+		return "", fmt.Errorf("invalid --format %q (want html, markdown or json)", reportFormat)
+	}
+	if reportOutput == "" {
+		return report.FormatHTML, nil
+	}
+	return report.FormatOf(reportOutput)
+}
+
+func runReportSecurity(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	format, err := getReportFormat()
+	if err != nil {
+		return err
+	}
+
+	log := slog.With("command", "report.security")
+
+	var domains []models.Domain
+	source := reportInput
+	if reportInput != "" {
+		if domains, err = merger.New().LoadInitial(ctx, reportInput); err != nil {
+			return fmt.Errorf("failed to load input: %w", err)
+		}
+	} else {
+		source = nsxHost
+		log = log.With("nsx_host", nsxHost)
+		result, err := getNSXClient().ListLDAPIdentitySources(ctx)
+		if err != nil {
+			log.Error("failed to fetch LDAP identity sources", "error", err)
+			return fmt.Errorf("failed to fetch LDAP identity sources: %w", err)
+		}
+		domains = nsx.LDAPIdentitySourcesToDomains(result.Results)
+	}
+
+	r := report.NewSecurity(domains, source, time.Now())
+	log.Info("security report built",
+		"source", source,
+		"servers", r.Servers,
+		"plaintext", r.Plaintext,
+		"without_certificates", len(r.WithoutCertificates),
+	)
+
+	if err := writeOutput(reportOutput, func(w io.Writer) error { return r.Write(w, format) }); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if reportOutput != "" {
+		fmt.Println(i18n.T("report.security.written", reportOutput, len(r.Domains), r.Servers))
+	}
+	return nil
+}
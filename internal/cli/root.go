@@ -1,17 +1,23 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/loader"
 	"ldapmerge/internal/logging"
+	"ldapmerge/internal/paths"
+	"ldapmerge/internal/runid"
 	"ldapmerge/internal/version"
 )
 
@@ -20,6 +26,8 @@ var (
 	logDir     string
 	logLevel   string
 	logConsole bool
+	logFormat  string
+	language   string
 )
 
 // Color definitions
@@ -47,8 +55,23 @@ var rootCmd = &cobra.Command{
 	Short: "🔄 LDAP configuration merger for VMware NSX",
 	Long:  getLongDescription(),
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		// Skip logging init for version and help
-		if cmd.Name() == "version" || cmd.Name() == "help" {
+		if err := applySettings(cmd); err != nil {
+			return err
+		}
+		var err error
+		if enabledFeatures, err = getFeatures(); err != nil {
+			return err
+		}
+		if lang := viper.GetString("lang"); lang != "" {
+			if err := setLanguage(lang); err != nil {
+				return err
+			}
+		}
+
+		// Skip logging init for version and help, for doctor, which
+		// must still run when the log directory is broken, and for logs,
+		// which reads the log files
+		if cmd.Name() == "version" || cmd.Name() == "help" || cmd.Name() == "doctor" || cmd.Parent() == logsCmd {
 			return nil
 		}
 		return initLogging(cmd, args)
@@ -74,73 +97,47 @@ func getLongDescription() string {
 	titleStyle.Fprint(&sb, banner)
 	sb.WriteString("\n")
 
-	versionStyle.Fprintf(&sb, "  Version: %s\n\n", version.Short())
+	versionStyle.Fprint(&sb, "  "+i18n.T("root.version", version.Short())+"\n\n")
 
-	descStyle.Fprint(&sb, "  LDAP configuration merger tool for VMware NSX 4.2.\n")
-	descStyle.Fprint(&sb, "  Merges LDAP server configurations with SSL certificates.\n\n")
+	descStyle.Fprint(&sb, "  "+i18n.T("root.about")+"\n")
+	descStyle.Fprint(&sb, "  "+i18n.T("root.about.details")+"\n\n")
 
-	headerStyle.Fprint(&sb, "  ⚡ WORKFLOW\n")
+	headerStyle.Fprint(&sb, "  "+i18n.T("root.workflow")+"\n")
 	sb.WriteString("\n")
-	sb.WriteString("    ")
-	iconStyle.Fprint(&sb, "1. ")
-	cmdStyle.Fprint(&sb, "sync")
-	descStyle.Fprint(&sb, "    → Full pipeline: pull → merge → push\n")
-	sb.WriteString("    ")
-	iconStyle.Fprint(&sb, "2. ")
-	cmdStyle.Fprint(&sb, "merge")
-	descStyle.Fprint(&sb, "   → Merge JSON files locally\n")
-	sb.WriteString("    ")
-	iconStyle.Fprint(&sb, "3. ")
-	cmdStyle.Fprint(&sb, "nsx")
-	descStyle.Fprint(&sb, "     → Direct NSX API operations\n")
-	sb.WriteString("    ")
-	iconStyle.Fprint(&sb, "4. ")
-	cmdStyle.Fprint(&sb, "server")
-	descStyle.Fprint(&sb, "  → Start REST API server\n")
+	for i, name := range []string{"sync", "merge", "nsx", "server"} {
+		sb.WriteString("    ")
+		iconStyle.Fprintf(&sb, "%d. ", i+1)
+		cmdStyle.Fprintf(&sb, "%-8s", name)
+		descStyle.Fprint(&sb, i18n.T("root.workflow."+name)+"\n")
+	}
 	sb.WriteString("\n")
 
-	headerStyle.Fprint(&sb, "  📡 NSX OPERATIONS\n")
+	headerStyle.Fprint(&sb, "  "+i18n.T("root.nsx")+"\n")
 	sb.WriteString("\n")
-	sb.WriteString("    ")
-	cmdStyle.Fprint(&sb, "nsx pull")
-	descStyle.Fprint(&sb, "        📥 Fetch LDAP identity sources\n")
-	sb.WriteString("    ")
-	cmdStyle.Fprint(&sb, "nsx push")
-	descStyle.Fprint(&sb, "        📤 Update LDAP identity sources\n")
-	sb.WriteString("    ")
-	cmdStyle.Fprint(&sb, "nsx get")
-	descStyle.Fprint(&sb, "         🔍 Get specific source\n")
-	sb.WriteString("    ")
-	cmdStyle.Fprint(&sb, "nsx delete")
-	descStyle.Fprint(&sb, "      🗑️  Delete source\n")
-	sb.WriteString("    ")
-	cmdStyle.Fprint(&sb, "nsx probe")
-	descStyle.Fprint(&sb, "       🩺 Test LDAP connection\n")
-	sb.WriteString("    ")
-	cmdStyle.Fprint(&sb, "nsx fetch-cert")
-	descStyle.Fprint(&sb, "  🔐 Fetch SSL certificate\n")
-	sb.WriteString("    ")
-	cmdStyle.Fprint(&sb, "nsx search")
-	descStyle.Fprint(&sb, "      🔎 Search users/groups\n")
+	for _, name := range []string{"pull", "push", "get", "delete", "probe", "fetch-cert", "search"} {
+		sb.WriteString("    ")
+		cmdStyle.Fprintf(&sb, "%-16s", "nsx "+name)
+		descStyle.Fprint(&sb, i18n.T("root.nsx."+strings.ReplaceAll(name, "-", "_"))+"\n")
+	}
 	sb.WriteString("\n")
 
-	headerStyle.Fprint(&sb, "  📚 EXAMPLES\n")
-	sb.WriteString("\n")
-	descStyle.Fprint(&sb, "    # Full sync with NSX\n")
-	cmdStyle.Fprint(&sb, "    $ ldapmerge sync --host https://nsx.example.com -u admin -P secret -r certs.json\n")
-	sb.WriteString("\n")
-	descStyle.Fprint(&sb, "    # Local merge\n")
-	cmdStyle.Fprint(&sb, "    $ ldapmerge merge -i initial.json -r response.json -o result.json\n")
-	sb.WriteString("\n")
-	descStyle.Fprint(&sb, "    # Start API server\n")
-	cmdStyle.Fprint(&sb, "    $ ldapmerge server -p 8080\n")
+	headerStyle.Fprint(&sb, "  "+i18n.T("root.examples")+"\n")
 	sb.WriteString("\n")
+	for _, example := range []struct{ key, cmd string }{
+		{"sync", "ldapmerge sync --host https://nsx.example.com -u admin -P secret -r certs.json --reason CHG-1234"},
+		{"merge", "ldapmerge merge -i initial.json -r response.json -o result.json"},
+		{"server", "ldapmerge server -p 8080"},
+	} {
+		descStyle.Fprint(&sb, "    "+i18n.T("root.examples."+example.key)+"\n")
+		cmdStyle.Fprint(&sb, "    $ "+example.cmd+"\n")
+		sb.WriteString("\n")
+	}
 
-	headerStyle.Fprint(&sb, "  🔗 LINKS\n")
+	headerStyle.Fprint(&sb, "  "+i18n.T("root.links")+"\n")
 	sb.WriteString("\n")
-	descStyle.Fprint(&sb, "    Documentation: ")
+	descStyle.Fprintf(&sb, "    %-16s", i18n.T("root.links.docs"))
 	cmdStyle.Fprint(&sb, "http://localhost:8080/docs\n")
-	descStyle.Fprint(&sb, "    NSX API Docs:   ")
+	descStyle.Fprintf(&sb, "    %-16s", i18n.T("root.links.nsx"))
 	cmdStyle.Fprint(&sb, "https://developer.broadcom.com/xapis/nsx-t-data-center-rest-api/4.2/\n")
 
 	return sb.String()
@@ -148,54 +145,117 @@ func getLongDescription() string {
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		color.Red("✗ Error: %v", err)
+	// Ctrl+C and SIGTERM cancel the command's context, which stops NSX
+	// requests, file parsing and merges in progress
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	initLanguage(os.Args[1:])
+	initCompletionCmd()
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	// PersistentPostRun is skipped when a command fails: flush the log
+	// sinks here too
+	_ = logging.Close()
+	if err != nil {
+		color.Red("%s", i18n.T("error.prefix", err))
 		os.Exit(1)
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	// nsx checks its connection settings in its own persistent pre-run;
+	// settings and logging must still be initialized by the root one
+	cobra.EnableTraverseRunHooks = true
 
 	// Add version command
 	rootCmd.AddCommand(versionCmd)
 
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default: $HOME/.ldapmerge.yaml)")
-	rootCmd.PersistentFlags().StringVar(&logDir, "log-dir", "", "log directory (default: executable directory)")
+	rootCmd.PersistentFlags().StringVar(&logDir, "log-dir", "", "log directory (default: ldapmerge/logs in the user cache directory)")
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "log level: debug, info, warn, error")
 	rootCmd.PersistentFlags().BoolVar(&logConsole, "log-console", false, "also output logs to console")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "", "format of console logs: json or text; implies --log-console (default: json)")
+	rootCmd.PersistentFlags().StringVar(&language, "lang", "", "message language: "+strings.Join(i18n.Locales(), ", ")+" (default: from LC_ALL, LC_MESSAGES or LANG)")
 
 	// Bind to viper
-	_ = viper.BindPFlag("logging.dir", rootCmd.PersistentFlags().Lookup("log-dir"))
-	_ = viper.BindPFlag("logging.level", rootCmd.PersistentFlags().Lookup("log-level"))
-	_ = viper.BindPFlag("logging.console", rootCmd.PersistentFlags().Lookup("log-console"))
+	registerSettings(rootCmd,
+		setting{Key: "logging.dir", Flag: "log-dir"},
+		setting{Key: "logging.level", Flag: "log-level"},
+		setting{Key: "logging.console", Flag: "log-console"},
+		setting{Key: "logging.format", Flag: "log-format"},
+		setting{Key: "lang", Flag: "lang"},
+	)
+	registerSettings(rootCmd, featureSettings()...)
 
-	// Customize help template
+	// Customize help template; headings are translated when it is rendered
+	cobra.AddTemplateFunc("T", i18n.T)
 	rootCmd.SetUsageTemplate(getUsageTemplate())
+	defaultHelp := rootCmd.HelpFunc()
+	rootCmd.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		// --help skips the hooks; resolve --lang, env and config here
+		initConfig()
+		if applySettings(cmd) == nil && viper.GetString("lang") != "" {
+			_ = setLanguage(viper.GetString("lang"))
+		}
+		rootCmd.Long = getLongDescription()
+		defaultHelp(cmd, args)
+	})
 }
 
 func getUsageTemplate() string {
 	return `
-` + color.HiYellowString("📖 USAGE") + `
+` + color.HiYellowString(`{{T "help.usage"}}`) + `
   {{.UseLine}}
 
-{{if .HasAvailableSubCommands}}` + color.HiYellowString("📦 COMMANDS") + `
+{{if .HasAvailableSubCommands}}` + color.HiYellowString(`{{T "help.commands"}}`) + `
 {{range .Commands}}{{if .IsAvailableCommand}}  ` + color.HiGreenString("{{rpad .Name .NamePadding}}") + ` {{.Short}}
 {{end}}{{end}}{{end}}
-{{if .HasAvailableLocalFlags}}` + color.HiYellowString("🚩 FLAGS") + `
+{{if .HasAvailableLocalFlags}}` + color.HiYellowString(`{{T "help.flags"}}`) + `
 {{.LocalFlags.FlagUsages | trimTrailingWhitespaces}}
 {{end}}
-{{if .HasAvailableInheritedFlags}}` + color.HiYellowString("🌐 GLOBAL FLAGS") + `
+{{if .HasAvailableInheritedFlags}}` + color.HiYellowString(`{{T "help.global_flags"}}`) + `
 {{.InheritedFlags.FlagUsages | trimTrailingWhitespaces}}
 {{end}}
-{{if .HasExample}}` + color.HiYellowString("💡 EXAMPLES") + `
+{{if .HasExample}}` + color.HiYellowString(`{{T "help.examples"}}`) + `
 {{.Example}}
 {{end}}
-` + color.HiWhiteString("Use \"{{.CommandPath}} [command] --help\" for more information about a command.") + `
+` + color.HiWhiteString(`{{T "help.more" .CommandPath}}`) + `
 `
 }
 
+// initLanguage selects the message language before the command line is
+// parsed, so that flag errors and usage are translated too: --lang, then
+// LDAPMERGE_LANG, then the locale. Commands apply the fully resolved "lang"
+// setting, which also honours the config file, in the root pre-run.
+func initLanguage(args []string) {
+	lang := os.Getenv(envName("lang"))
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if v, ok := strings.CutPrefix(arg, "--lang="); ok {
+			lang = v
+		} else if arg == "--lang" && i+1 < len(args) {
+			lang = args[i+1]
+		}
+	}
+	if err := setLanguage(lang); err != nil {
+		_ = setLanguage("")
+	}
+	rootCmd.Long = getLongDescription()
+}
+
+// setLanguage selects the message language; empty means the locale of the
+// environment.
+func setLanguage(lang string) error {
+	if lang == "" {
+		lang = i18n.Detect()
+	}
+	return i18n.SetLocale(lang)
+}
+
 func initConfig() {
 	if cfgFile != "" {
 		viper.SetConfigFile(cfgFile)
@@ -209,37 +269,63 @@ func initConfig() {
 		viper.SetConfigName(".ldapmerge")
 	}
 
-	viper.AutomaticEnv()
 	viper.SetEnvPrefix("LDAPMERGE")
+	viper.SetEnvKeyReplacer(envKeyReplacer)
+	viper.AutomaticEnv()
 
 	_ = viper.ReadInConfig()
+
+	loader.Register("s3", loader.S3(getS3Config()))
+}
+
+// resolveLogDir returns the configured log directory or ldapmerge/logs in
+// the user cache directory, moving the logs earlier versions wrote to the
+// executable directory there.
+func resolveLogDir() string {
+	if dir := viper.GetString("logging.dir"); dir != "" {
+		return dir
+	}
+
+	dir, err := paths.LogDir()
+	if err != nil {
+		return "."
+	}
+	logMigration.Do(func() {
+		movedLogs = migrateLegacy(paths.LegacyLogDir, dir, paths.LogFiles(logging.DefaultConfig().LogFile))
+	})
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "."
+	}
+	return dir
 }
 
 func initLogging(cmd *cobra.Command, _ []string) error {
 	// Determine log directory
-	dir := viper.GetString("logging.dir")
-	if dir == "" {
-		exe, err := os.Executable()
-		if err != nil {
-			dir = "."
-		} else {
-			dir = filepath.Dir(exe)
-		}
-	}
+	dir := resolveLogDir()
 
 	// Parse log level
 	level := parseLogLevel(viper.GetString("logging.level"))
 
+	var sinks []logging.SinkConfig
+	if err := viper.UnmarshalKey("logging.sinks", &sinks); err != nil {
+		return fmt.Errorf("invalid logging.sinks config: %w", err)
+	}
+
+	// A console format is asked for by pipelines that parse the console
+	format := viper.GetString("logging.format")
+
 	cfg := logging.Config{
-		LogDir:     dir,
-		LogFile:    "ldapmerge.log",
-		MaxSize:    100, // 100 MB
-		MaxBackups: 5,
-		MaxAge:     30, // 30 days
-		Compress:   true,
-		Level:      level,
-		JSONFormat: true,
-		Console:    viper.GetBool("logging.console"),
+		LogDir:        dir,
+		LogFile:       logging.DefaultConfig().LogFile,
+		MaxSize:       100, // 100 MB
+		MaxBackups:    5,
+		MaxAge:        30, // 30 days
+		Compress:      true,
+		Level:         level,
+		JSONFormat:    true,
+		Console:       viper.GetBool("logging.console") || format != "",
+		ConsoleFormat: format,
+		Sinks:         sinks,
 	}
 
 	if err := logging.Init(cfg); err != nil {
@@ -247,15 +333,38 @@ func initLogging(cmd *cobra.Command, _ []string) error {
 	}
 
 	slog.Info("application started",
-		"command", cmd.Name(),
+		logging.KeyCommand, cmd.Name(),
 		"version", version.Short(),
 		"log_dir", dir,
 		"log_level", level.String(),
+		logging.KeySchema, logging.SchemaVersion,
 	)
+	for _, sink := range sinks {
+		slog.Info("shipping log", "sink", sink.Type, "url", sink.URL)
+	}
+	if len(movedLogs) > 0 {
+		slog.Info("moved logs to the default log directory", "files", movedLogs)
+	}
 
 	return nil
 }
 
+// startRun gives the merge, sync or push of cmd a run ID (see runid): it is
+// set on the context of cmd and logged with every record of the command.
+func startRun(cmd *cobra.Command) context.Context {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	id := runid.New()
+	ctx = runid.With(ctx, id)
+	cmd.SetContext(ctx)
+
+	slog.SetDefault(slog.Default().With(logging.KeyRunID, id))
+	slog.Info("run started", "command", cmd.CommandPath())
+	return ctx
+}
+
 func parseLogLevel(s string) slog.Level {
 	switch s {
 	case "debug":
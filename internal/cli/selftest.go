@@ -0,0 +1,358 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/api"
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/nsx/mock"
+	"ldapmerge/internal/repository"
+)
+
+var (
+	selftestTimeout time.Duration
+	selftestKeep    bool
+)
+
+// selftestCmd represents the selftest command
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "🧪 Run an end-to-end smoke test",
+	Long: `Run ldapmerge end to end against the built-in mock NSX server and a new
+SQLite database in a temporary directory, and print a pass/fail report.
+
+Steps:
+  - Start the mock NSX server and the API server on loopback ports
+  - Create the database and run its migrations
+  - Pull the identity sources and fetch their certificates from NSX
+  - Merge them through POST /api/merge
+  - Read the merge back from the history
+  - Push it to NSX through POST /api/history/{id}/push
+  - Pull again and check NSX has the merged certificates and the push was audited
+
+Nothing outside the temporary directory is read or written, and no network
+access is needed, so the command checks packaged builds and air-gapped
+installations. Exits with a non-zero status if any step fails.`,
+	Example: `  ldapmerge selftest
+
+  # Keep the database for inspection
+  ldapmerge selftest --keep`,
+	RunE:         runSelftest,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(selftestCmd)
+
+	selftestCmd.Flags().DurationVar(&selftestTimeout, "timeout", time.Minute, "abort the test after this long")
+	selftestCmd.Flags().BoolVar(&selftestKeep, "keep", false, "keep the temporary database instead of deleting it")
+}
+
+// selftest is the state passed between the steps of a self-test.
+type selftest struct {
+	dir    string
+	repo   *repository.Repository
+	nsxURL string
+	apiURL string
+	client *nsx.Client
+	http   *http.Client
+
+	initial   []models.Domain
+	response  *models.CertificateResponse
+	result    []models.Domain
+	historyID int64
+	configID  int64
+}
+
+// selftestStep is a step of the self-test; it returns what it checked.
+type selftestStep struct {
+	name string
+	run  func(ctx context.Context) (string, error)
+}
+
+func runSelftest(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(cmd.Context(), selftestTimeout)
+	defer cancel()
+
+	st := &selftest{http: &http.Client{Timeout: selftestTimeout}}
+	defer st.close()
+
+	steps := []selftestStep{
+		{"Mock NSX", st.startNSX},
+		{"Database", st.openDatabase},
+		{"API server", st.startAPI},
+		{"Pull", st.pull},
+		{"Merge", st.merge},
+		{"History", st.readHistory},
+		{"Push", st.push},
+		{"Verify", st.verify},
+	}
+
+	results := make([]checkResult, 0, len(steps))
+	failed := false
+	for _, step := range steps {
+		r := checkResult{Name: step.name}
+		if failed {
+			r.Status = checkWarn
+			r.Message = "skipped"
+		} else if msg, err := step.run(ctx); err != nil {
+			r.Status = checkFail
+			r.Message = err.Error()
+			failed = true
+		} else {
+			r.Message = msg
+		}
+		results = append(results, r)
+	}
+
+	err := printCheckReport(i18n.T("selftest.title"), "selftest", results)
+	if selftestKeep && st.dir != "" {
+		fmt.Println(i18n.T("selftest.kept", st.dir))
+	}
+	return err
+}
+
+// close stops the servers and removes the temporary directory unless
+// --keep is set.
+func (st *selftest) close() {
+	if st.repo != nil {
+		_ = st.repo.Close()
+	}
+	if st.dir != "" && !selftestKeep {
+		_ = os.RemoveAll(st.dir)
+	}
+}
+
+// serve serves handler on a loopback port until ctx is done and returns
+// its URL.
+func serve(ctx context.Context, handler http.Handler) (string, error) {
+	ln, err := (&net.ListenConfig{}).Listen(ctx, "tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() { _ = srv.Serve(ln) }()
+	context.AfterFunc(ctx, func() { _ = srv.Close() })
+	return "http://" + ln.Addr().String(), nil
+}
+
+func (st *selftest) startNSX(ctx context.Context) (string, error) {
+	var err error
+	if st.nsxURL, err = serve(ctx, mock.NewServer()); err != nil {
+		return "", err
+	}
+	st.client = nsx.NewClient(nsx.ClientConfig{Host: st.nsxURL, Username: "admin", Password: "secret", Timeout: selftestTimeout})
+	return st.nsxURL, nil
+}
+
+func (st *selftest) openDatabase(ctx context.Context) (string, error) {
+	var err error
+	if st.dir, err = os.MkdirTemp("", "ldapmerge-selftest-"); err != nil {
+		return "", err
+	}
+	path := filepath.Join(st.dir, "data.db")
+	if st.repo, err = repository.New(path); err != nil {
+		return "", err
+	}
+	info, err := st.repo.GetDBInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s, SQLite %s, %d tables", path, info.Version, info.Tables), nil
+}
+
+func (st *selftest) startAPI(ctx context.Context) (string, error) {
+	srv := api.NewServer("127.0.0.1:0", st.repo)
+	var err error
+	if st.apiURL, err = serve(ctx, srv.Handler()); err != nil {
+		return "", err
+	}
+
+	var health api.HealthOutput
+	if err := st.call(ctx, http.MethodGet, "/api/health", nil, &health.Body); err != nil {
+		return "", err
+	}
+	if health.Body.Status != "ok" || health.Body.Database == nil {
+		return "", fmt.Errorf("health is %q without database info", health.Body.Status)
+	}
+	return st.apiURL, nil
+}
+
+// call sends a JSON request to the API server and decodes the response
+// into out, if not nil. Statuses other than 2xx are errors.
+func (st *selftest) call(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, st.apiURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := st.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(data))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%s %s: invalid response: %w", method, path, err)
+	}
+	return nil
+}
+
+func (st *selftest) pull(ctx context.Context) (string, error) {
+	list, err := st.client.ListLDAPIdentitySources(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(list.Results) == 0 {
+		return "", errors.New("NSX has no identity sources")
+	}
+
+	st.initial = nsx.LDAPIdentitySourcesToDomains(list.Results)
+	for i := range st.initial {
+		for j := range st.initial[i].LDAPServers {
+			st.initial[i].LDAPServers[j].Certificates = nil
+		}
+	}
+
+	response, failures, err := st.client.FetchCertificateResponse(ctx, nsx.ResponseItems(list.Results))
+	if err != nil {
+		return "", err
+	}
+	if len(failures) > 0 {
+		return "", fmt.Errorf("certificate of %s not fetched: %w", failures[0].URL, failures[0].Err)
+	}
+	st.response = response
+	return fmt.Sprintf("%d identity sources, %d certificates fetched", len(st.initial), len(response.Results)), nil
+}
+
+func (st *selftest) merge(ctx context.Context) (string, error) {
+	body := map[string]any{"initial": st.initial, "response": st.response}
+	if err := st.call(ctx, http.MethodPost, "/api/merge", body, &st.result); err != nil {
+		return "", err
+	}
+
+	servers, certificates := 0, 0
+	for _, d := range st.result {
+		for _, s := range d.LDAPServers {
+			if len(s.Certificates) == 0 {
+				return "", fmt.Errorf("%s has no certificate after the merge", s.URL)
+			}
+			servers++
+			certificates += len(s.Certificates)
+		}
+	}
+	return fmt.Sprintf("%d domains, %d servers, %d certificates", len(st.result), servers, certificates), nil
+}
+
+func (st *selftest) readHistory(ctx context.Context) (string, error) {
+	var list []api.HistoryListEntry
+	if err := st.call(ctx, http.MethodGet, "/api/history", nil, &list); err != nil {
+		return "", err
+	}
+	if len(list) != 1 {
+		return "", fmt.Errorf("history has %d entries, want 1", len(list))
+	}
+	st.historyID = list[0].ID
+
+	var entry models.HistoryEntry
+	if err := st.call(ctx, http.MethodGet, fmt.Sprintf("/api/history/%d", st.historyID), nil, &entry); err != nil {
+		return "", err
+	}
+	got, _ := json.Marshal(entry.Result.Data)
+	want, _ := json.Marshal(st.result)
+	if !bytes.Equal(got, want) {
+		return "", fmt.Errorf("history entry %d differs from the merge result", st.historyID)
+	}
+	return fmt.Sprintf("entry %d matches the merge result", st.historyID), nil
+}
+
+func (st *selftest) push(ctx context.Context) (string, error) {
+	var config models.NSXConfig
+	newConfig := models.NSXConfig{Name: "selftest", Host: st.nsxURL, Username: "admin", Password: "secret"}
+	if err := st.call(ctx, http.MethodPost, "/api/configs", newConfig, &config); err != nil {
+		return "", err
+	}
+	st.configID = config.ID
+
+	var output api.PushOutput
+	body := map[string]any{"config_id": st.configID, "reason": "ldapmerge selftest"}
+	if err := st.call(ctx, http.MethodPost, fmt.Sprintf("/api/history/%d/push", st.historyID), body, &output.Body); err != nil {
+		return "", err
+	}
+	if output.Body.Failed > 0 {
+		for _, r := range output.Body.Results {
+			if !r.Success {
+				return "", fmt.Errorf("%s not pushed: %s", r.ID, r.Error)
+			}
+		}
+	}
+	if output.Body.Succeeded != len(st.result) {
+		return "", fmt.Errorf("%d of %d identity sources pushed", output.Body.Succeeded, len(st.result))
+	}
+	return fmt.Sprintf("%d identity sources pushed, snapshot %d", output.Body.Succeeded, output.Body.SnapshotID), nil
+}
+
+func (st *selftest) verify(ctx context.Context) (string, error) {
+	list, err := st.client.ListLDAPIdentitySources(ctx)
+	if err != nil {
+		return "", err
+	}
+	pushed := make(map[string][]string)
+	for _, d := range nsx.LDAPIdentitySourcesToDomains(list.Results) {
+		for _, s := range d.LDAPServers {
+			pushed[s.URL] = s.Certificates
+		}
+	}
+
+	servers := 0
+	for _, d := range st.result {
+		for _, s := range d.LDAPServers {
+			if !slices.Equal(pushed[s.URL], s.Certificates) {
+				return "", fmt.Errorf("NSX does not have the merged certificates of %s", s.URL)
+			}
+			servers++
+		}
+	}
+
+	var events []models.AuditEvent
+	if err := st.call(ctx, http.MethodGet, "/api/audit?operation=history.push", nil, &events); err != nil {
+		return "", err
+	}
+	if len(events) != 1 || events[0].Outcome != "success" {
+		return "", fmt.Errorf("push audit events are %+v, want one success", events)
+	}
+	return fmt.Sprintf("NSX has the merged certificates of %d servers, push audited", servers), nil
+}
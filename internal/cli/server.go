@@ -1,14 +1,32 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"net/netip"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"ldapmerge/internal/api"
+	"ldapmerge/internal/artifacts"
+	"ldapmerge/internal/features"
+	"ldapmerge/internal/healthcheck"
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/loader"
+	"ldapmerge/internal/logging"
+	"ldapmerge/internal/maintenance"
+	"ldapmerge/internal/oidc"
+	"ldapmerge/internal/paths"
+	"ldapmerge/internal/prober"
 	"ldapmerge/internal/repository"
 )
 
@@ -16,6 +34,37 @@ var (
 	serverHost string
 	serverPort int
 	dbPath     string
+
+	dbMaxOpenConns int
+	dbMaxIdleConns int
+	dbBusyTimeout  time.Duration
+	dbSynchronous  string
+	dbPingInterval time.Duration
+
+	dbMaintenanceInterval time.Duration
+	dbWALLimit            int
+
+	probeInterval         time.Duration
+	probeFailureThreshold int
+	probeRetention        time.Duration
+
+	healthInterval  time.Duration
+	healthRetention time.Duration
+
+	docsRenderer string
+	inputSchemes []string
+
+	tlsCertFile      string
+	tlsKeyFile       string
+	tlsClientCAFile  string
+	httpRedirectPort int
+
+	rateLimitIP    float64
+	rateLimitToken float64
+	rateLimitBurst int
+	trustedProxies []string
+
+	shutdownTimeout time.Duration
 )
 
 // serverCmd represents the server command
@@ -26,16 +75,90 @@ var serverCmd = &cobra.Command{
 
 Endpoints:
   POST /api/merge      - Merge initial and response JSON data
+  POST /api/merge/stream - Merge NDJSON domains, streaming results per line
   GET  /api/health     - Health check endpoint
+  GET  /api/health/history - Health snapshots with database and NSX trends
+  GET  /readyz         - Readiness check (503 while the database fails)
+  GET  /api/documents  - List uploaded documents
+  POST /api/documents  - Upload initial/response document
+  GET  /api/documents/:id - Get document with content
+  DELETE /api/documents/:id - Delete document
   GET  /api/history    - List merge history
+  GET  /api/history/diff?a=:id&b=:id - Diff two history entries
   GET  /api/history/:id - Get specific history entry
+  DELETE /api/history/:id - Delete history entry
+  DELETE /api/history?before=:time - Delete history entries older than a time
+  GET  /api/history/:id/result - Get merged result (?download=true for a file)
+  GET  /api/history/:id/result/signature - Detached signature of the download
+  POST /api/history/:id/push - Push stored result to NSX again
+  GET  /api/servers    - LDAP server inventory
+  GET  /api/servers/:id/probes - Probe history of a server
   GET  /api/configs    - List NSX configurations
   POST /api/configs    - Create NSX configuration
   GET  /api/configs/:id - Get specific configuration
-  DELETE /api/configs/:id - Delete configuration
+  DELETE /api/configs/:id - Delete configuration (soft delete)
+  DELETE /api/configs/:id/purge - Permanently remove configuration
+  GET  /api/nsx/:configId/sources - Pull identity sources through a configuration
+  POST /api/nsx/:configId/push - Push domains through a configuration
+  POST /api/sync       - Start a pull, merge and push in the background
+  GET  /api/sync       - List sync jobs
+  GET  /api/sync/:id   - Get a sync job
+
+Monitoring:
+  GET  /status         - Status page (health, probes, expiring certificates)
+  GET  /metrics        - Prometheus metrics
 
 Documentation:
-  GET  /docs           - Scalar API documentation`,
+  GET  /docs           - API documentation (see --docs-renderer)
+
+Merge requests may name initial_location and response_location URLs instead
+of inline documents for the schemes enabled with --input-schemes (file, http,
+https, s3). None are enabled by default: they let API clients make the server
+read local files and fetch URLs.
+
+The database is checked every --db-ping-interval and reopened when it is
+locked, closed or moved, so a transient filesystem issue does not need a
+restart; /readyz reports it meanwhile.
+
+At startup and every --db-maintenance-interval, the server checkpoints the
+SQLite write-ahead log, truncating it when larger than --db-wal-limit MB,
+and removes from the database directory the write-ahead log and shared
+memory files of databases that no longer exist and temporary files older
+than a day.
+
+With --probe-interval, the server also probes the LDAP servers of every saved
+NSX configuration on that schedule and records the results in the inventory.
+
+Every --health-interval, the server records a health snapshot: the state and
+size of the database and whether the NSX Manager of every saved configuration
+is reachable. GET /api/health/history returns them with the database growth
+and NSX Managers flapping between reachable and unreachable.
+
+With --tls-cert and --tls-key, the server serves HTTPS (TLS 1.2 or later)
+instead of plain HTTP; --http-redirect-port then also listens for plain HTTP
+and redirects every request to HTTPS with 308, which keeps the method.
+With --tls-client-ca, only clients presenting a certificate signed by that CA
+bundle are accepted (mutual TLS); they need no API key, and the certificate
+subject is logged as client_cert and recorded in the audit log. A certificate
+listed in the cert_subjects of an API key, by full subject or SHA-256
+fingerprint, acts as that key; any other is limited to the configurations
+without a tenant and refused the audit log and the server settings.
+
+--rate-limit-ip and --rate-limit-token limit the requests per second of each
+client IP and of each API key, OIDC user or client certificate with a token
+bucket of --rate-limit-burst requests; requests over a limit get 429 with
+Retry-After. Health, metrics and documentation endpoints are not limited.
+Behind a reverse proxy every client shares the proxy's IP; list the proxy in
+--rate-limit-trusted-proxies to limit by the X-Forwarded-For client instead.
+
+Ctrl+C or SIGTERM stops accepting connections and waits up to
+--shutdown-timeout for the requests in flight, such as merges and pushes, and
+the sync jobs of POST /api/sync to finish before closing the database; a
+second Ctrl+C stops at once.
+
+/docs works without internet access: "auto" serves Scalar when the binary was
+built with the bundle (make docs-assets) and a built-in renderer otherwise;
+"cdn" loads Scalar from jsdelivr in the browser.`,
 	RunE: runServer,
 }
 
@@ -44,11 +167,205 @@ func init() {
 
 	serverCmd.Flags().StringVar(&serverHost, "host", "0.0.0.0", "server host address")
 	serverCmd.Flags().IntVarP(&serverPort, "port", "p", 8080, "server port")
-	serverCmd.Flags().StringVar(&dbPath, "db", "", "path to SQLite database (default: $HOME/.ldapmerge/data.db)")
+	serverCmd.Flags().StringVar(&dbPath, "db", "", "path to SQLite database (default: ldapmerge/data.db in the user config directory)")
+
+	dbDefaults := repository.DefaultOptions()
+	serverCmd.Flags().IntVar(&dbMaxOpenConns, "db-max-open-conns", dbDefaults.MaxOpenConns, "maximum open database connections")
+	serverCmd.Flags().IntVar(&dbMaxIdleConns, "db-max-idle-conns", dbDefaults.MaxIdleConns, "maximum idle database connections")
+	serverCmd.Flags().DurationVar(&dbBusyTimeout, "db-busy-timeout", dbDefaults.BusyTimeout, "how long to wait on a locked database")
+	serverCmd.Flags().StringVar(&dbSynchronous, "db-synchronous", dbDefaults.Synchronous, "SQLite synchronous mode: OFF, NORMAL, FULL, EXTRA")
+	serverCmd.Flags().DurationVar(&dbPingInterval, "db-ping-interval", repository.DefaultPingInterval, "check the database on this schedule and reopen it after errors (0 disables)")
+	maintenanceDefaults := maintenance.DefaultOptions()
+	serverCmd.Flags().DurationVar(&dbMaintenanceInterval, "db-maintenance-interval", maintenanceDefaults.Interval, "checkpoint the write-ahead log and remove stale files on this schedule (0 runs it at startup only)")
+	serverCmd.Flags().IntVar(&dbWALLimit, "db-wal-limit", int(maintenanceDefaults.WALLimit>>20), "truncate the write-ahead log during maintenance when larger than this many MB")
+	probeDefaults := prober.DefaultOptions()
+	serverCmd.Flags().DurationVar(&probeInterval, "probe-interval", 0, "probe saved NSX configurations on this schedule (0 disables scheduled probes)")
+	serverCmd.Flags().IntVar(&probeFailureThreshold, "probe-failure-threshold", api.DefaultOptions().ProbeFailureThreshold, "consecutive failed probes after which a server is flagged as failing")
+	serverCmd.Flags().DurationVar(&probeRetention, "probe-retention", probeDefaults.Retention, "how long to keep probe history (0 keeps it forever)")
+	healthDefaults := healthcheck.DefaultOptions()
+	serverCmd.Flags().DurationVar(&healthInterval, "health-interval", healthDefaults.Interval, "record a health snapshot on this schedule (0 disables health history)")
+	serverCmd.Flags().DurationVar(&healthRetention, "health-retention", healthDefaults.Retention, "how long to keep health snapshots (0 keeps them forever)")
+	serverCmd.Flags().StringVar(&docsRenderer, "docs-renderer", string(api.DocsRendererAuto), "API docs renderer: auto, scalar, builtin, cdn")
+	serverCmd.Flags().StringSliceVar(&inputSchemes, "input-schemes", nil, "location schemes merge requests may load from, e.g. https,s3 (default: none)")
+	addMergeFlags(serverCmd)
+	addRealizationFlag(serverCmd)
+	serverCmd.Flags().StringVar(&bindPasswordsFile, "bind-passwords", "", "YAML or JSON file mapping LDAP server URLs to bind passwords, set on servers pushed without one")
+	serverCmd.Flags().StringVar(&tlsCertFile, "tls-cert", "", "PEM certificate file, with its chain, to serve HTTPS with (requires --tls-key)")
+	serverCmd.Flags().StringVar(&tlsKeyFile, "tls-key", "", "PEM private key file of --tls-cert")
+	serverCmd.Flags().StringVar(&tlsClientCAFile, "tls-client-ca", "", "PEM CA bundle: require clients to present a certificate it signed (mutual TLS)")
+	serverCmd.Flags().IntVar(&httpRedirectPort, "http-redirect-port", 0, "with TLS, also listen for plain HTTP on this port and redirect it to HTTPS (0 disables)")
+	serverCmd.Flags().Float64Var(&rateLimitIP, "rate-limit-ip", 0, "requests per second allowed from each client IP (0 disables)")
+	serverCmd.Flags().Float64Var(&rateLimitToken, "rate-limit-token", 0, "requests per second allowed for each API key, OIDC user or client certificate (0 disables)")
+	serverCmd.Flags().IntVar(&rateLimitBurst, "rate-limit-burst", api.DefaultRateLimitBurst, "requests allowed at once above the rate limits")
+	serverCmd.Flags().StringSliceVar(&trustedProxies, "rate-limit-trusted-proxies", nil, "reverse proxies (IPs or CIDRs) whose X-Forwarded-For gives the client IP of --rate-limit-ip")
+	serverCmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", api.DefaultShutdownTimeout, "how long to wait for requests in flight and sync jobs when stopping")
+
+	registerSettings(serverCmd,
+		setting{Key: "server.host", Flag: "host"},
+		setting{Key: "server.port", Flag: "port"},
+		setting{Key: "server.db", Flag: "db"},
+		setting{Key: "database.max_open_conns", Flag: "db-max-open-conns"},
+		setting{Key: "database.max_idle_conns", Flag: "db-max-idle-conns"},
+		setting{Key: "database.busy_timeout", Flag: "db-busy-timeout"},
+		setting{Key: "database.synchronous", Flag: "db-synchronous"},
+		setting{Key: "database.ping_interval", Flag: "db-ping-interval"},
+		setting{Key: "database.maintenance_interval", Flag: "db-maintenance-interval"},
+		setting{Key: "database.wal_limit", Flag: "db-wal-limit"},
+		setting{Key: "probes.interval", Flag: "probe-interval"},
+		setting{Key: "probes.failure_threshold", Flag: "probe-failure-threshold"},
+		setting{Key: "probes.retention", Flag: "probe-retention"},
+		setting{Key: "health.interval", Flag: "health-interval"},
+		setting{Key: "health.retention", Flag: "health-retention"},
+		setting{Key: "server.docs_renderer", Flag: "docs-renderer"},
+		setting{Key: "server.input_schemes", Flag: "input-schemes"},
+		setting{Key: "server.tls_cert", Flag: "tls-cert"},
+		setting{Key: "server.tls_key", Flag: "tls-key"},
+		setting{Key: "server.tls_client_ca", Flag: "tls-client-ca"},
+		setting{Key: "server.http_redirect_port", Flag: "http-redirect-port"},
+		setting{Key: "server.rate_limit.per_ip", Flag: "rate-limit-ip"},
+		setting{Key: "server.rate_limit.per_token", Flag: "rate-limit-token"},
+		setting{Key: "server.rate_limit.burst", Flag: "rate-limit-burst"},
+		setting{Key: "server.rate_limit.trusted_proxies", Flag: "rate-limit-trusted-proxies"},
+		setting{Key: "server.shutdown_timeout", Flag: "shutdown-timeout"},
+		bindPasswordsSetting,
+	)
+}
 
-	_ = viper.BindPFlag("server.host", serverCmd.Flags().Lookup("host"))
-	_ = viper.BindPFlag("server.port", serverCmd.Flags().Lookup("port"))
-	_ = viper.BindPFlag("server.db", serverCmd.Flags().Lookup("db"))
+// getRepositoryOptions returns database pool and artifact store options from
+// flags and config.
+func getRepositoryOptions() (repository.Options, error) {
+	opts := repository.DefaultOptions()
+	opts.MaxOpenConns = viper.GetInt("database.max_open_conns")
+	opts.MaxIdleConns = viper.GetInt("database.max_idle_conns")
+	opts.BusyTimeout = viper.GetDuration("database.busy_timeout")
+	opts.Synchronous = viper.GetString("database.synchronous")
+
+	store, err := getArtifactStore()
+	if err != nil {
+		return opts, err
+	}
+	opts.Artifacts = store
+
+	return opts, nil
+}
+
+// getArtifactStore returns the S3 artifact store from the artifacts.s3
+// config section, or nil when no bucket is configured. Credentials fall back
+// to AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+func getArtifactStore() (artifacts.Store, error) {
+	cfg := getS3Config()
+	if cfg.Bucket == "" {
+		return nil, nil
+	}
+
+	store, err := artifacts.NewS3(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid artifacts.s3 config: %w", err)
+	}
+	return store, nil
+}
+
+// getS3Config returns the "artifacts.s3" config, falling back to the standard
+// AWS environment variables for credentials. It also configures s3:// input
+// locations, which name their own bucket.
+func getS3Config() artifacts.S3Config {
+	cfg := artifacts.S3Config{
+		Endpoint:      viper.GetString("artifacts.s3.endpoint"),
+		Region:        viper.GetString("artifacts.s3.region"),
+		Bucket:        viper.GetString("artifacts.s3.bucket"),
+		Prefix:        viper.GetString("artifacts.s3.prefix"),
+		AccessKey:     viper.GetString("artifacts.s3.access_key"),
+		SecretKey:     viper.GetString("artifacts.s3.secret_key"),
+		VirtualHosted: viper.GetBool("artifacts.s3.virtual_hosted"),
+	}
+	if cfg.AccessKey == "" {
+		cfg.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if cfg.SecretKey == "" {
+		cfg.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	return cfg
+}
+
+// getAPIKeys returns the API keys of the "server.api_keys" config section.
+func getAPIKeys() ([]api.APIKey, error) {
+	var keys []api.APIKey
+	if err := viper.UnmarshalKey("server.api_keys", &keys); err != nil {
+		return nil, fmt.Errorf("invalid server.api_keys config: %w", err)
+	}
+	seen := make(map[string]bool, len(keys))
+	certs := make(map[string]string)
+	for i, key := range keys {
+		if key.Name == "" {
+			keys[i].Name = fmt.Sprintf("key%d", i+1)
+		}
+		if len(key.Key) < 16 {
+			return nil, fmt.Errorf("invalid server.api_keys config: key %s is shorter than 16 characters", keys[i].Name)
+		}
+		if seen[key.Key] {
+			return nil, fmt.Errorf("invalid server.api_keys config: key %s is listed twice", keys[i].Name)
+		}
+		seen[key.Key] = true
+		for _, subject := range key.CertSubjects {
+			if other, ok := certs[subject]; ok {
+				return nil, fmt.Errorf("invalid server.api_keys config: certificate %s is mapped to keys %s and %s", subject, other, keys[i].Name)
+			}
+			certs[subject] = keys[i].Name
+		}
+	}
+	return keys, nil
+}
+
+// getOIDC returns the OIDC issuer of the "server.oidc" config section, or
+// nil if none is set. The audience is required: without it, the tokens the
+// realm issues to any of its clients would be accepted.
+func getOIDC() (*api.OIDC, error) {
+	issuer := viper.GetString("server.oidc.issuer")
+	if issuer == "" {
+		return nil, nil
+	}
+	if viper.GetString("server.oidc.audience") == "" {
+		return nil, fmt.Errorf("invalid server.oidc config: audience is required with issuer %s", issuer)
+	}
+	return &api.OIDC{
+		Verifier: oidc.NewVerifier(oidc.Config{
+			Issuer:   issuer,
+			Audience: viper.GetString("server.oidc.audience"),
+			Leeway:   viper.GetDuration("server.oidc.leeway"),
+		}),
+		TenantClaim: viper.GetString("server.oidc.tenant_claim"),
+	}, nil
+}
+
+// getRateLimit returns the rate limits of the "server.rate_limit" config
+// section.
+func getRateLimit() (api.RateLimit, error) {
+	limit := api.RateLimit{
+		PerIP:    viper.GetFloat64("server.rate_limit.per_ip"),
+		PerToken: viper.GetFloat64("server.rate_limit.per_token"),
+		Burst:    viper.GetInt("server.rate_limit.burst"),
+	}
+	if limit.PerIP < 0 || limit.PerToken < 0 {
+		return limit, fmt.Errorf("--rate-limit-ip and --rate-limit-token must not be negative")
+	}
+	if limit.Burst < 1 {
+		return limit, fmt.Errorf("--rate-limit-burst must be at least 1")
+	}
+	for _, proxy := range viper.GetStringSlice("server.rate_limit.trusted_proxies") {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(proxy)
+			if aerr != nil {
+				return limit, fmt.Errorf("invalid --rate-limit-trusted-proxies entry %q: not an IP or CIDR", proxy)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		limit.TrustedProxies = append(limit.TrustedProxies, prefix.Masked())
+	}
+	return limit, nil
 }
 
 func getDBPath() string {
@@ -60,34 +377,225 @@ func getDBPath() string {
 		return p
 	}
 
-	home, err := os.UserHomeDir()
+	dataDir, err := paths.DataDir()
 	if err != nil {
 		return "ldapmerge.db"
 	}
-
-	dataDir := filepath.Join(home, ".ldapmerge")
-	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+	dataMigration.Do(func() {
+		if moved := migrateLegacy(paths.LegacyDataDir, dataDir, paths.DatabaseFiles); len(moved) > 0 {
+			slog.Info("moved database to the default data directory", "files", moved)
+		}
+	})
+	if err := os.MkdirAll(dataDir, 0o700); err != nil {
 		return "ldapmerge.db"
 	}
 
-	return filepath.Join(dataDir, "data.db")
+	return filepath.Join(dataDir, paths.DatabaseFile)
 }
 
 func runServer(cmd *cobra.Command, args []string) error {
 	addr := fmt.Sprintf("%s:%d", serverHost, serverPort)
 
+	tlsCert, tlsKey := viper.GetString("server.tls_cert"), viper.GetString("server.tls_key")
+	if (tlsCert == "") != (tlsKey == "") {
+		return fmt.Errorf("--tls-cert and --tls-key must be set together")
+	}
+	clientCA := viper.GetString("server.tls_client_ca")
+	scheme := "http"
+	var redirectAddr string
+	switch {
+	case tlsCert != "":
+		scheme = "https"
+		if port := viper.GetInt("server.http_redirect_port"); port > 0 {
+			redirectAddr = fmt.Sprintf("%s:%d", serverHost, port)
+		}
+	case viper.GetInt("server.http_redirect_port") > 0:
+		return fmt.Errorf("--http-redirect-port needs --tls-cert and --tls-key")
+	case clientCA != "":
+		return fmt.Errorf("--tls-client-ca needs --tls-cert and --tls-key")
+	}
+
 	dbFile := getDBPath()
-	fmt.Printf("Using database: %s\n", dbFile)
+	fmt.Println(i18n.T("server.database", dbFile))
 
-	repo, err := repository.New(dbFile)
+	repoOpts, err := getRepositoryOptions()
+	if err != nil {
+		return err
+	}
+	if repoOpts.Artifacts != nil {
+		fmt.Println(i18n.T("server.artifacts", viper.GetString("artifacts.s3.bucket"), viper.GetString("artifacts.s3.prefix")))
+	}
+
+	repo, err := repository.NewWithOptions(dbFile, repoOpts)
 	if err != nil {
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
 	defer func() { _ = repo.Close() }()
 
-	srv := api.NewServer(addr, repo)
+	if interval := viper.GetDuration("database.ping_interval"); interval > 0 {
+		go repo.Monitor(cmd.Context(), interval)
+	}
+
+	// Maintenance runs at startup, and then on its schedule
+	if viper.GetInt("database.wal_limit") < 0 {
+		return fmt.Errorf("--db-wal-limit must not be negative")
+	}
+	maintenanceOpts := maintenance.DefaultOptions()
+	maintenanceOpts.Interval = viper.GetDuration("database.maintenance_interval")
+	maintenanceOpts.WALLimit = int64(viper.GetInt("database.wal_limit")) << 20
+	maintainer := maintenance.New(repo, maintenanceOpts)
+	if maintenanceOpts.Interval > 0 && enabledFeatures.Enabled(features.Scheduler) {
+		go maintainer.Run(cmd.Context())
+		fmt.Println(i18n.T("server.maintenance", maintenanceOpts.Interval))
+	} else if _, err := maintainer.RunOnce(cmd.Context()); err != nil {
+		slog.Error("database maintenance failed", "error", err)
+	}
+
+	mergeOpts, err := getMergeOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	signer, err := getSigner()
+	if err != nil {
+		return fmt.Errorf("invalid signing config: %w", err)
+	}
+
+	renderer, err := api.ParseDocsRenderer(viper.GetString("server.docs_renderer"))
+	if err != nil {
+		return err
+	}
+	if renderer == api.DocsRendererScalar && !api.ScalarBundled() {
+		return fmt.Errorf("docs renderer %q needs the Scalar bundle embedded at build time (make docs-assets); use builtin or cdn", renderer)
+	}
+
+	schemes := viper.GetStringSlice("server.input_schemes")
+	for _, scheme := range schemes {
+		if !slices.Contains(loader.Schemes(), strings.ToLower(scheme)) {
+			return fmt.Errorf("unknown input scheme %q (supported: %s)", scheme, strings.Join(loader.Schemes(), ", "))
+		}
+	}
+
+	guard, err := getProtectedGuard()
+	if err != nil {
+		return fmt.Errorf("invalid audit.protected_sources: %w", err)
+	}
 
-	fmt.Printf("Starting API server on %s\n", addr)
-	fmt.Printf("API documentation available at http://%s/docs\n", addr)
-	return srv.Start()
+	bindPasswords, err := getBindPasswords()
+	if err != nil {
+		return err
+	}
+
+	apiKeys, err := getAPIKeys()
+	if err != nil {
+		return err
+	}
+	if len(apiKeys) > 0 {
+		fmt.Println(i18n.T("server.api_keys", len(apiKeys)))
+	}
+	issuer, err := getOIDC()
+	if err != nil {
+		return err
+	}
+	if issuer != nil {
+		fmt.Println(i18n.T("server.oidc", issuer.Verifier.Issuer()))
+	}
+
+	rateLimit, err := getRateLimit()
+	if err != nil {
+		return err
+	}
+	if rateLimit.PerIP > 0 || rateLimit.PerToken > 0 {
+		fmt.Println(i18n.T("server.rate_limit", rateLimit.PerIP, rateLimit.PerToken, rateLimit.Burst))
+	}
+
+	if disabled := enabledFeatures.Disabled(); len(disabled) > 0 {
+		fmt.Println(i18n.T("server.features_disabled", joinFeatures(disabled)))
+	}
+
+	var probes *prober.Prober
+	if interval := viper.GetDuration("probes.interval"); interval > 0 && enabledFeatures.Enabled(features.Scheduler) {
+		probeOpts := prober.DefaultOptions()
+		probeOpts.Interval = interval
+		probeOpts.Retention = viper.GetDuration("probes.retention")
+		probeOpts.Diagnostics = nsxDiagnostics()
+		probes = prober.New(repo, probeOpts)
+	}
+
+	// The level of the log is a runtime setting of the server
+	var level *slog.LevelVar
+	if logger := logging.Get(); logger != nil {
+		level = logger.Level()
+	}
+
+	srv := api.NewServerWithOptions(addr, repo, api.Options{
+		Merge:                 mergeOpts,
+		Signer:                signer,
+		ProbeFailureThreshold: viper.GetInt("probes.failure_threshold"),
+		Prober:                probes,
+		LogLevel:              level,
+		DocsRenderer:          renderer,
+		InputSchemes:          schemes,
+		AuditWebhook:          getAuditWebhook(),
+		Protected:             guard,
+		RealizationTimeout:    viper.GetDuration("nsx.realization_timeout"),
+		BindPasswords:         bindPasswords,
+		Features:              enabledFeatures,
+		APIKeys:               apiKeys,
+		OIDC:                  issuer,
+		NSXDiagnostics:        nsxDiagnostics(),
+		TLSCert:               tlsCert,
+		TLSKey:                tlsKey,
+		TLSClientCA:           clientCA,
+		HTTPRedirectAddr:      redirectAddr,
+		RateLimit:             rateLimit,
+		ShutdownTimeout:       viper.GetDuration("server.shutdown_timeout"),
+	})
+
+	// Settings changed through the API override the flags
+	ctx := cmd.Context()
+	if err := srv.LoadSettings(ctx); err != nil {
+		return err
+	}
+	if interval := viper.GetDuration("health.interval"); interval > 0 && enabledFeatures.Enabled(features.Scheduler) {
+		healthOpts := healthcheck.DefaultOptions()
+		healthOpts.Interval = interval
+		healthOpts.Retention = viper.GetDuration("health.retention")
+		healthOpts.Diagnostics = nsxDiagnostics()
+		go healthcheck.New(repo, healthOpts).Run(ctx)
+
+		fmt.Println(i18n.T("server.health", interval))
+	}
+	if probes != nil {
+		go probes.Run(ctx)
+
+		fmt.Println(i18n.T("server.probes", viper.GetDuration("probes.interval")))
+		if probes.Status().Paused {
+			fmt.Println(i18n.T("server.probes_paused"))
+		}
+	}
+
+	// Ctrl+C cancels the context and drains the server; restore the default
+	// signal handling then, so that a second Ctrl+C stops it at once
+	context.AfterFunc(ctx, func() {
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+		fmt.Println(i18n.T("server.stopping", viper.GetDuration("server.shutdown_timeout")))
+	})
+
+	fmt.Println(i18n.T("server.starting", addr))
+	if clientCA != "" {
+		fmt.Println(i18n.T("server.mtls", clientCA))
+	}
+	if redirectAddr != "" {
+		fmt.Println(i18n.T("server.redirect", redirectAddr))
+	}
+	if enabledFeatures.Enabled(features.WebUI) {
+		fmt.Println(i18n.T("server.docs", scheme, addr))
+		fmt.Println(i18n.T("server.status", scheme, addr))
+	}
+	if err := srv.Start(ctx); err != nil {
+		return err
+	}
+	fmt.Println(i18n.T("server.stopped"))
+	return nil
 }
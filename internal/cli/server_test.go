@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestGetOIDCRequiresAudience(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("server.oidc.issuer", "https://sso.example.lab/realms/ops")
+	if issuer, err := getOIDC(); err == nil || issuer != nil {
+		t.Errorf("Expected an error without an audience, got %v", issuer)
+	}
+
+	viper.Set("server.oidc.audience", "ldapmerge")
+	if issuer, err := getOIDC(); err != nil || issuer == nil || issuer.Verifier.Issuer() != "https://sso.example.lab/realms/ops" {
+		t.Errorf("Expected the issuer, got %v (%v)", issuer, err)
+	}
+}
+
+func TestGetAPIKeysCertSubjects(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("server.api_keys", []map[string]any{
+		{"name": "ansible", "key": "ansible-key-0123456789", "cert_subjects": []string{"CN=ansible-01,O=Example"}},
+		{"name": "team-a", "key": "team-a-key-0123456789", "tenant": "team-a"},
+	})
+	keys, err := getAPIKeys()
+	if err != nil || len(keys) != 2 || len(keys[0].CertSubjects) != 1 || keys[0].CertSubjects[0] != "CN=ansible-01,O=Example" {
+		t.Fatalf("Expected the certificate subject of ansible, got %+v (%v)", keys, err)
+	}
+
+	viper.Set("server.api_keys", []map[string]any{
+		{"name": "ansible", "key": "ansible-key-0123456789", "cert_subjects": []string{"CN=ansible-01,O=Example"}},
+		{"name": "team-a", "key": "team-a-key-0123456789", "cert_subjects": []string{"CN=ansible-01,O=Example"}},
+	})
+	if _, err := getAPIKeys(); err == nil {
+		t.Error("Expected an error for a certificate mapped to two keys")
+	}
+}
+
+func TestGetRateLimitTrustedProxies(t *testing.T) {
+	t.Cleanup(viper.Reset)
+
+	viper.Set("server.rate_limit.burst", 20)
+	viper.Set("server.rate_limit.trusted_proxies", []string{"10.0.0.7/24", "192.0.2.1", "2001:db8::1"})
+	limit, err := getRateLimit()
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/24"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+	}
+	if err != nil || !slices.Equal(limit.TrustedProxies, want) {
+		t.Fatalf("Expected %v, got %v (%v)", want, limit.TrustedProxies, err)
+	}
+
+	viper.Set("server.rate_limit.trusted_proxies", []string{"proxy.example.lab"})
+	if _, err := getRateLimit(); err == nil {
+		t.Error("Expected an error for a host name")
+	}
+}
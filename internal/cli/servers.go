@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/repository"
+)
+
+var (
+	serversListJSON   bool
+	serversListDomain string
+
+	// noInventory disables recording pulls and probes in the inventory
+	noInventory bool
+)
+
+// serversCmd represents the servers command group
+var serversCmd = &cobra.Command{
+	Use:   "servers",
+	Short: "🖥️ LDAP server inventory",
+	Long: `Commands for the LDAP server inventory.
+
+The inventory is updated by every "nsx pull" and "sync" (servers, enabled
+state, leaf certificate fingerprint and expiry) and by "nsx probe" (last
+probe status). Use --no-inventory on those commands to skip recording.
+
+Available operations:
+  list - List known LDAP servers`,
+}
+
+// serversListCmd lists the inventory
+var serversListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List known LDAP servers",
+	Example: `  # All servers
+  ldapmerge servers list
+
+  # One identity source, as JSON
+  ldapmerge servers list --domain example.lab --json`,
+	Args: cobra.NoArgs,
+	RunE: runServersList,
+}
+
+func init() {
+	rootCmd.AddCommand(serversCmd)
+	serversCmd.AddCommand(serversListCmd)
+
+	serversCmd.PersistentFlags().StringVar(&dbPath, "db", "", "path to SQLite database (default: ldapmerge/data.db in the user config directory)")
+	serversListCmd.Flags().BoolVar(&serversListJSON, "json", false, "output as JSON")
+	serversListCmd.Flags().StringVar(&serversListDomain, "domain", "", "only servers of this identity source")
+}
+
+func runServersList(cmd *cobra.Command, args []string) error {
+	repo, err := repository.New(getDBPath())
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	all, err := repo.ListServers(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to list servers: %w", err)
+	}
+
+	servers := make([]models.InventoryServer, 0, len(all))
+	for _, s := range all {
+		if serversListDomain == "" || s.DomainID == serversListDomain {
+			servers = append(servers, s)
+		}
+	}
+
+	if serversListJSON {
+		return writeJSON(servers)
+	}
+
+	if len(servers) == 0 {
+		fmt.Println(i18n.T("servers.empty"))
+		return nil
+	}
+
+	failed := color.New(color.FgHiRed)
+	ok := color.New(color.FgHiGreen)
+
+	threshold := viper.GetInt("probes.failure_threshold")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, i18n.T("servers.header"))
+	for _, s := range servers {
+		expires := "-"
+		if s.CertExpiresAt != nil {
+			expires = s.CertExpiresAt.Format("2006-01-02")
+		}
+
+		probe := "-"
+		if s.LastProbeOK != nil {
+			switch {
+			case *s.LastProbeOK:
+				probe = ok.Sprint(i18n.T("servers.probe.ok"))
+			case threshold > 0 && s.ConsecutiveFailures >= threshold:
+				probe = failed.Sprint(i18n.T("servers.probe.failing", s.ConsecutiveFailures))
+			default:
+				probe = failed.Sprint(i18n.T("servers.probe.failed"))
+			}
+		}
+
+		uptime := "-"
+		if s.Uptime != nil {
+			uptime = fmt.Sprintf("%.1f%%", *s.Uptime)
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%s\t%s\t%s\n",
+			s.DomainID, s.URL, s.Enabled, expires, probe, uptime, s.LastSeenAt.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
+
+// recordInventory adds pulled domains to the server inventory. Failures are
+// logged but do not fail the calling command.
+func recordInventory(ctx context.Context, log *slog.Logger, domains []models.Domain) {
+	if noInventory {
+		return
+	}
+
+	repo, err := repository.New(getDBPath())
+	if err != nil {
+		log.Warn("inventory not updated", "error", err)
+		return
+	}
+	defer func() { _ = repo.Close() }()
+
+	start := time.Now()
+	count, err := repo.UpdateInventory(ctx, nsxHost, domains)
+	if err != nil {
+		log.Warn("inventory not updated", "error", err)
+		return
+	}
+	log.Info("inventory updated", "servers_count", count, "duration", time.Since(start))
+}
+
+// recordProbes stores probe results in the server inventory. Failures are
+// logged but do not fail the calling command.
+func recordProbes(ctx context.Context, log *slog.Logger, result *nsx.ProbeResult) {
+	if noInventory {
+		return
+	}
+
+	repo, err := repository.New(getDBPath())
+	if err != nil {
+		log.Warn("probe results not recorded", "error", err)
+		return
+	}
+	defer func() { _ = repo.Close() }()
+
+	for _, item := range result.Results {
+		if err := repo.RecordProbe(ctx, nsxHost, item.LDAPServerURL, item.Success, item.ErrorMessage); err != nil {
+			log.Warn("probe result not recorded", "url", item.LDAPServerURL, "error", err)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package cli
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/diff"
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+)
+
+var (
+	simulateServer  string
+	simulateNewCert string
+	simulateJSON    bool
+)
+
+// simulateCmd represents the simulate command group
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "🧪 Preview changes without touching NSX",
+	Long: `Show what an operation would change in the identity sources and send to
+NSX Manager, without changing anything.
+
+Available operations:
+  rotate - Rotate the certificate of one LDAP server`,
+}
+
+// simulateRotateCmd previews the rotation of one server's certificate
+var simulateRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Preview rotating the certificate of one LDAP server",
+	Long: `Show the identity sources and the NSX API requests that rotating the
+certificate of one LDAP server would produce: the certificates of the server
+before and after, the diff of its identity source and the exact body a push
+would send, with bind passwords masked. Nothing is written to NSX.
+
+The identity sources are pulled from NSX Manager, or read from --initial
+without connecting to it. --new-cert holds the new certificate, with its
+chain if any, in PEM. The certificates are combined as merge does with
+--strategy (default replace); --normalize, --alt-names and --host-alias
+select the server as they match response URLs. Only the selected server
+changes, unlike a merge where servers missing from the response lose their
+certificates under the replace strategy.`,
+	Example: `  # Against the identity sources on NSX
+  ldapmerge simulate rotate --profile prod -P secret \
+    --server ldaps://dc1.example.lab:636 --new-cert dc1-2027.pem
+
+  # Against a pulled file, keeping the old certificate next to the new one
+  ldapmerge simulate rotate -i pulled.json --strategy append \
+    --server ldaps://dc1.example.lab:636 --new-cert dc1-2027.pem`,
+	Args: cobra.NoArgs,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if initialFile != "" {
+			return nil
+		}
+		return requireNSXConnection(cmd, args)
+	},
+	RunE:         runSimulateRotate,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+	simulateCmd.AddCommand(simulateRotateCmd)
+
+	simulateRotateCmd.Flags().StringVar(&simulateServer, "server", "", "URL of the LDAP server to rotate (required)")
+	simulateRotateCmd.Flags().StringVar(&simulateNewCert, "new-cert", "", "PEM file with the new certificate (required)")
+	simulateRotateCmd.Flags().StringVarP(&initialFile, "initial", "i", "", "domain JSON location to rotate in instead of the identity sources on NSX: path, URL or - for stdin")
+	simulateRotateCmd.Flags().BoolVar(&simulateJSON, "json", false, "output the rotated sources, the diff and the NSX requests as JSON")
+	_ = simulateRotateCmd.MarkFlagRequired("server")
+	_ = simulateRotateCmd.MarkFlagRequired("new-cert")
+	addMergeFlags(simulateRotateCmd)
+
+	// NSX connection flags (same as nsx command)
+	simulateRotateCmd.Flags().StringVar(&profileName, "profile", "", "connection profile from the config file (see ldapmerge nsx --help)")
+	simulateRotateCmd.Flags().StringVar(&nsxHost, "host", "", "NSX Manager host URL (required unless set by --profile or --initial is given)")
+	simulateRotateCmd.Flags().StringVarP(&nsxUsername, "username", "u", "", "NSX API username")
+	simulateRotateCmd.Flags().StringVarP(&nsxPassword, "password", "P", "", "NSX API password")
+	simulateRotateCmd.Flags().BoolVarP(&nsxInsecure, "insecure", "k", false, "Skip TLS certificate verification")
+	simulateRotateCmd.Flags().IntVar(&nsxTimeout, "timeout", 30, "API request timeout in seconds")
+	registerSettings(simulateRotateCmd, nsxSettings...)
+	_ = simulateRotateCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+}
+
+// simulatedRequest is an NSX API request a push would send.
+type simulatedRequest struct {
+	Method string                 `json:"method"`
+	Path   string                 `json:"path"`
+	Body   nsx.LDAPIdentitySource `json:"body"`
+}
+
+func runSimulateRotate(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+
+	log := slog.With(
+		"command", "simulate.rotate",
+		"server", simulateServer,
+		"new_cert", simulateNewCert,
+	)
+
+	certs, err := readPEMCertificates(simulateNewCert)
+	if err != nil {
+		return err
+	}
+
+	opts, err := getMergeOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	var domains []models.Domain
+	if initialFile != "" {
+		if domains, err = merger.New().LoadInitial(ctx, initialFile); err != nil {
+			log.Error("failed to load file", "error", err)
+			return fmt.Errorf("failed to load file: %w", err)
+		}
+	} else {
+		result, err := getNSXClient().ListLDAPIdentitySources(ctx)
+		if err != nil {
+			log.Error("failed to fetch LDAP identity sources", "error", err)
+			return fmt.Errorf("failed to fetch LDAP identity sources: %w", err)
+		}
+		domains = nsx.LDAPIdentitySourcesToDomains(result.Results)
+	}
+
+	rotated, count := merger.NewWithOptions(opts).Rotate(domains, simulateServer, certs)
+	if count == 0 {
+		return fmt.Errorf("no LDAP server matches %s", simulateServer)
+	}
+
+	changes := diff.Compare(domains, rotated)
+	changed := make(map[string]bool, len(changes.ChangedDomains))
+	for _, d := range changes.ChangedDomains {
+		changed[d.ID] = true
+	}
+
+	var sources []models.Domain
+	var requests []simulatedRequest
+	for _, domain := range rotated {
+		if !changed[domain.ID] {
+			continue
+		}
+		sources = append(sources, domain)
+		requests = append(requests, simulatedPush(domain))
+	}
+
+	log.Info("simulated rotation", "servers", count, "changed_sources", len(sources))
+
+	if simulateJSON {
+		return writeJSON(struct {
+			Diff     *diff.ResultDiff   `json:"diff"`
+			Sources  []models.Domain    `json:"sources"`
+			Requests []simulatedRequest `json:"requests"`
+		}{changes, sources, requests})
+	}
+
+	fmt.Println(i18n.T("simulate.rotate.title", simulateServer, count))
+	for i, domain := range rotated {
+		for j, server := range domain.LDAPServers {
+			before := domains[i].LDAPServers[j]
+			if strings.Join(before.Certificates, "\n") == strings.Join(server.Certificates, "\n") {
+				continue
+			}
+			fmt.Println("\n" + i18n.T("simulate.rotate.server", server.URL, domain.ID))
+			fmt.Println(i18n.T("simulate.rotate.before"))
+			writeCertificates(os.Stdout, server.URL, before.Certificates)
+			fmt.Println(i18n.T("simulate.rotate.after"))
+			writeCertificates(os.Stdout, server.URL, server.Certificates)
+		}
+	}
+
+	fmt.Println()
+	if err := printDiff(changes); err != nil {
+		return err
+	}
+
+	for _, request := range requests {
+		body, err := json.MarshalIndent(request.Body, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println("\n" + i18n.T("simulate.rotate.request", request.Method, request.Path))
+		fmt.Println(string(body))
+	}
+	fmt.Println("\n" + i18n.T("simulate.rotate.nothing_changed"))
+	return nil
+}
+
+// simulatedPush returns the request nsx push would send for domain, with
+// bind passwords masked.
+func simulatedPush(domain models.Domain) simulatedRequest {
+	source := nsx.DomainToLDAPIdentitySource(domain).Writable()
+	method := http.MethodPut
+	if source.LacksBindPassword() {
+		method = http.MethodPatch
+	}
+	for i := range source.LDAPServers {
+		if source.LDAPServers[i].Password != "" {
+			source.LDAPServers[i].Password = "********"
+		}
+	}
+	return simulatedRequest{Method: method, Path: nsx.SourcePath(source.ID), Body: source}
+}
+
+// readPEMCertificates returns the PEM certificates in the file at path, one
+// string per certificate.
+func readPEMCertificates(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	var certs []string
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, strings.TrimSpace(string(pem.EncodeToMemory(block))))
+		}
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM certificate in %s", path)
+	}
+	return certs, nil
+}
@@ -0,0 +1,307 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/credentials"
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/repository"
+)
+
+var (
+	snapshotListJSON  bool
+	snapshotListLimit int
+)
+
+// snapshotCmd represents the snapshot command group
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "📸 Restore points taken before pushes",
+	Long: `Commands for snapshots: the NSX state of identity sources saved before every
+push (nsx push, sync, POST /api/history/{id}/push) and restore.
+
+Available operations:
+  list    - List snapshots
+  get     - Show a snapshot as JSON
+  restore - Put the sources of a snapshot back on NSX Manager`,
+}
+
+// snapshotListCmd lists snapshots
+var snapshotListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List snapshots",
+	Args:  cobra.NoArgs,
+	RunE:  runSnapshotList,
+}
+
+// snapshotGetCmd prints a snapshot
+var snapshotGetCmd = &cobra.Command{
+	Use:   "get <id>",
+	Short: "Show a snapshot as JSON",
+	Long:  `Print a snapshot, including each source as NSX Manager returned it.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSnapshotGet,
+}
+
+// snapshotRestoreCmd restores a snapshot to NSX
+var snapshotRestoreCmd = &cobra.Command{
+	Use:   "restore <id>",
+	Short: "Put the sources of a snapshot back on NSX Manager",
+	Long: `Put the identity sources of a snapshot back on NSX Manager as they were
+captured, and delete those that did not exist then. --host must name the NSX
+Manager the snapshot was taken on.
+
+The current state is snapshotted first, so a restore can be rolled back too.
+--reason is required; the restore is recorded in the audit log as
+snapshot.restore. Sources matching audit.protected_sources need
+--force-protected.`,
+	Example: `  # Roll back the last push
+  ldapmerge snapshot list
+  ldapmerge snapshot restore 7 --profile prod -P secret --reason "CHG-1236: roll back renewal"`,
+	Args:    cobra.ExactArgs(1),
+	PreRunE: requireNSXConnection,
+	RunE:    runSnapshotRestore,
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotGetCmd)
+	snapshotCmd.AddCommand(snapshotRestoreCmd)
+
+	snapshotCmd.PersistentFlags().StringVar(&dbPath, "db", "", "path to SQLite database (default: ldapmerge/data.db in the user config directory)")
+	snapshotListCmd.Flags().BoolVar(&snapshotListJSON, "json", false, "output as JSON")
+	snapshotListCmd.Flags().IntVar(&snapshotListLimit, "limit", 20, "maximum number of snapshots to list")
+
+	// NSX connection flags (same as nsx command)
+	c := snapshotRestoreCmd
+	c.Flags().StringVar(&profileName, "profile", "", "connection profile from the config file (see ldapmerge nsx --help)")
+	c.Flags().StringVar(&nsxHost, "host", "", "NSX Manager host URL (required unless set by --profile)")
+	c.Flags().StringVarP(&nsxUsername, "username", "u", "", "NSX API username (required unless set by --profile)")
+	c.Flags().StringVarP(&nsxPassword, "password", "P", "", "NSX API password (required unless set by LDAPMERGE_NSX_PASSWORD)")
+	c.Flags().BoolVarP(&nsxInsecure, "insecure", "k", false, "Skip TLS certificate verification")
+	c.Flags().IntVar(&nsxTimeout, "timeout", 30, "API request timeout in seconds")
+	c.Flags().StringVar(&auditReason, "reason", "", "justification for the restore, stored in the audit log (required)")
+	_ = c.MarkFlagRequired("reason")
+	c.Flags().BoolVar(&forceProtected, "force-protected", false, "allow restoring sources matching audit.protected_sources")
+	addRealizationFlag(c)
+	addBindPasswordFlags(c)
+
+	registerSettings(c, nsxSettings...)
+	_ = c.RegisterFlagCompletionFunc("profile", completeProfiles)
+}
+
+// parseSnapshotID parses a snapshot ID argument.
+func parseSnapshotID(arg string) (int64, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid snapshot ID %q", arg)
+	}
+	return id, nil
+}
+
+func runSnapshotList(cmd *cobra.Command, args []string) error {
+	repo, err := repository.New(getDBPath())
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	snapshots, err := repo.ListSnapshots(cmd.Context(), snapshotListLimit)
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	if snapshotListJSON {
+		return writeJSON(snapshots)
+	}
+
+	if len(snapshots) == 0 {
+		fmt.Println(i18n.T("snapshot.empty"))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, i18n.T("snapshot.header"))
+	for _, s := range snapshots {
+		history := "-"
+		if s.HistoryID != nil {
+			history = strconv.FormatInt(*s.HistoryID, 10)
+		}
+
+		ids := make([]string, len(s.Sources))
+		for i, source := range s.Sources {
+			ids[i] = source.ID
+			if !source.Existed {
+				ids[i] += "*"
+			}
+		}
+
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			s.ID, s.CreatedAt.Local().Format("2006-01-02 15:04"), s.Operation, s.NSXHost, history, strings.Join(ids, ", "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Println(i18n.T("snapshot.absent_hint"))
+	return nil
+}
+
+func runSnapshotGet(cmd *cobra.Command, args []string) error {
+	id, err := parseSnapshotID(args[0])
+	if err != nil {
+		return err
+	}
+
+	repo, err := repository.New(getDBPath())
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	snapshot, err := repo.GetSnapshot(cmd.Context(), id)
+	if err != nil {
+		return fmt.Errorf("snapshot %d not found: %w", id, err)
+	}
+	return writeJSON(snapshot)
+}
+
+func runSnapshotRestore(cmd *cobra.Command, args []string) error {
+	startTime := time.Now()
+	ctx := cmd.Context()
+
+	id, err := parseSnapshotID(args[0])
+	if err != nil {
+		return err
+	}
+
+	log := slog.With(
+		"command", "snapshot.restore",
+		"nsx_host", nsxHost,
+		"snapshot_id", id,
+	)
+
+	log.Info("starting restore operation")
+
+	auditLog, err := openAuditLog()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = auditLog.Close() }()
+
+	snapshot, err := auditLog.repo.GetSnapshot(ctx, id)
+	if err != nil {
+		return fmt.Errorf("snapshot %d not found: %w", id, err)
+	}
+	if !nsx.SameHost(snapshot.NSXHost, nsxHost) {
+		return fmt.Errorf("snapshot %d was taken on %s, not on %s", id, snapshot.NSXHost, nsxHost)
+	}
+
+	sourceIDs := make([]string, len(snapshot.Sources))
+	for i, source := range snapshot.Sources {
+		sourceIDs[i] = source.ID
+	}
+	if err := auditLog.checkProtected(ctx, log, audit.OperationSnapshotRestore, sourceIDs); err != nil {
+		return err
+	}
+
+	// NSX does not return bind passwords, so snapshots have none; restores
+	// replace sources, clearing the passwords NSX has
+	err = injectBindPasswords(log, false, func(passwords *credentials.BindPasswords) ([]string, error) {
+		var missing []string
+		for i, source := range snapshot.Sources {
+			if !source.Existed {
+				continue
+			}
+			doc, urls, err := passwords.InjectDocument(source.Source)
+			if err != nil {
+				return nil, fmt.Errorf("invalid snapshot of %s: %w", source.ID, err)
+			}
+			snapshot.Sources[i].Source = doc
+			missing = append(missing, urls...)
+		}
+		return missing, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	client := getNSXClient()
+	if err := auditLog.saveSnapshot(ctx, log, client, audit.OperationSnapshotRestore, sourceIDs); err != nil {
+		return err
+	}
+
+	var successCount, errorCount int
+	var firstErr error
+	for _, source := range snapshot.Sources {
+		sourceLog := log.With("source_id", source.ID, "existed", source.Existed)
+		sourceLog.Info("restoring LDAP identity source")
+
+		if source.Existed {
+			fmt.Println(i18n.T("snapshot.restore.put", source.ID))
+		} else {
+			fmt.Println(i18n.T("snapshot.restore.delete", source.ID))
+		}
+		err := client.RestoreLDAPIdentitySource(ctx, source)
+		if err == nil && source.Existed {
+			err = client.WaitRealized(ctx, source.ID, nsx.RealizationWait{Timeout: realizationTimeout})
+		}
+		if err != nil {
+			sourceLog.Error("failed to restore source", "error", err)
+			fmt.Fprintln(os.Stderr, i18n.T("nsx.push.error", err))
+			if firstErr == nil {
+				firstErr = err
+			}
+			errorCount++
+			continue
+		}
+
+		sourceLog.Info("source restored successfully")
+		fmt.Println(i18n.T("nsx.push.ok"))
+		successCount++
+	}
+
+	log.Info("restore completed",
+		"success_count", successCount,
+		"error_count", errorCount,
+		"duration", time.Since(startTime),
+	)
+	fmt.Println(i18n.T("snapshot.restore.done", id, successCount, errorCount))
+
+	return auditLog.record(ctx, log, audit.OperationSnapshotRestore, sourceIDs, successCount, errorCount, firstErr)
+}
+
+// saveSnapshot stores the current NSX state of sourceIDs in the database of
+// the audit log before operation pushes them, so the push can be rolled
+// back. Pushes do not start without a snapshot; a push aborted for want of
+// one is recorded as failed.
+func (a *auditLog) saveSnapshot(ctx context.Context, log *slog.Logger, client *nsx.Client, operation string, sourceIDs []string) error {
+	sources, err := client.SnapshotLDAPIdentitySources(ctx, sourceIDs)
+	if err != nil {
+		log.Error("failed to snapshot identity sources", "error", err)
+		_ = a.record(ctx, log, operation, sourceIDs, 0, len(sourceIDs), err)
+		return fmt.Errorf("failed to snapshot identity sources before push: %w", err)
+	}
+
+	snapshot := &models.Snapshot{Operation: operation, NSXHost: nsxHost, Sources: sources}
+	if err := a.repo.AddSnapshot(ctx, snapshot); err != nil {
+		log.Error("failed to save snapshot", "error", err)
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+
+	log.Info("saved pre-push snapshot", "snapshot_id", snapshot.ID, "sources_count", len(sources))
+	fmt.Println(i18n.T("snapshot.saved", snapshot.ID, len(sources), snapshot.ID))
+	return nil
+}
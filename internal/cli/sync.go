@@ -2,26 +2,56 @@ package cli
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"os"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
+	"ldapmerge/internal/api"
+	"ldapmerge/internal/audit"
+	"ldapmerge/internal/i18n"
 	"ldapmerge/internal/merger"
 	"ldapmerge/internal/models"
 	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/report"
+	"ldapmerge/internal/repository"
+	"ldapmerge/internal/runid"
 )
 
 var (
 	// sync-specific flags
-	syncResponseFile string
-	syncOutputFile   string
-	syncDryRun       bool
+	syncResponseFile     string
+	syncResponseDocument int64
+	syncOutputFile       string
+	syncDryRun           bool
+	syncReportFile       string
+	syncProbe            bool
+	syncDomains          []string
+	syncCanary           string
+	syncPullTimeout      time.Duration
+	syncPushTimeout      time.Duration
+	syncProbeTimeout     time.Duration
+	syncDisableFailing   bool
 )
 
+// Default deadlines of the sync phases
+const (
+	defaultPullTimeout  = 2 * time.Minute
+	defaultPushTimeout  = 3 * time.Minute // per source, realization included
+	defaultProbeTimeout = time.Minute     // per source
+)
+
+// syncTimeoutSettings are the settings of the phase deadline flags
+var syncTimeoutSettings = []setting{
+	{Key: "sync.pull_timeout", Flag: "pull-timeout"},
+	{Key: "sync.push_timeout", Flag: "push-timeout"},
+	{Key: "sync.probe_timeout", Flag: "probe-timeout"},
+}
+
 // syncCmd represents the sync command - full pipeline
 var syncCmd = &cobra.Command{
 	Use:   "sync",
@@ -32,12 +62,41 @@ var syncCmd = &cobra.Command{
 2. MERGE - Combine with certificate response data (from Ansible)
 3. PUSH  - Update NSX Manager with merged configuration
 
-This command performs all three steps in sequence with a single invocation.`,
+This command performs all three steps in sequence with a single invocation.
+
+--reason is required unless --dry-run is set. The push is recorded with its
+outcome in the audit log of the database (--db) and sent to the audit
+webhook, if one is configured. Sources matching audit.protected_sources in
+the config file are only pushed with --force-protected.
+
+--report writes a change report for a change ticket: the changes against
+NSX, every certificate pushed with its fingerprint and expiry and, with
+--probe, whether NSX reaches the LDAP servers with the merged
+configuration. The format follows the extension: .html, .md or .json.
+
+--domain limits the sync to the identity sources whose IDs match one of the
+glob patterns, such as "*.example.lab"; it may be repeated. --canary pushes
+the named source first and the others only if NSX accepts it, so that a bad
+merge breaks one source rather than all of them.
+
+Each phase has its own deadline, on top of the --timeout of every NSX
+request: --pull-timeout for the pull, --push-timeout for each identity
+source pushed, realization wait included, and --probe-timeout for each
+source probed. A source that exceeds its deadline fails alone and the
+push goes on with the next one; 0 disables a deadline. Ctrl+C stops the
+push after the source in progress and records what was pushed.
+
+--disable-failing sets enabled to false on the LDAP servers that failed
+their last --probe-failure-threshold probes recorded in the server inventory
+or whose certificates all expired, so that NSX stops sending logins to a
+broken domain controller. A source keeps at least one enabled server. The
+disabled servers are printed and listed in --report.`,
 	Example: `  # Basic usage
   ldapmerge sync \
     --host https://nsx.example.com \
     -u admin -P secret \
-    -r certificates_response.json
+    -r certificates_response.json \
+    --reason "CHG-1234: renew AD certificates"
 
   # With output file and dry-run
   ldapmerge sync \
@@ -47,38 +106,140 @@ This command performs all three steps in sequence with a single invocation.`,
     -o merged_result.json \
     --dry-run
 
+  # Change report for the ticket, with the servers probed by NSX
+  ldapmerge sync \
+    --host https://nsx.example.com \
+    -u admin -P secret \
+    -r certificates_response.json \
+    --dry-run --report CHG-1234.html --probe
+
   # Skip TLS verification
   ldapmerge sync \
     --host https://nsx.example.com \
     -u admin -P secret -k \
-    -r certificates_response.json`,
-	RunE: runSync,
+    -r certificates_response.json \
+    --reason "CHG-1234"
+
+  # Connection settings from the "prod" profile in the config file
+  ldapmerge sync --profile prod -P secret -r certificates_response.json --reason "CHG-1234"
+
+  # Only the example.lab sources, lab.example.lab first as a canary
+  ldapmerge sync --profile prod -P secret -r certificates_response.json \
+    --domain "*.example.lab" --canary lab.example.lab --reason "CHG-1234"
+
+  # Use a response document uploaded to the API server
+  ldapmerge sync \
+    --host https://nsx.example.com \
+    -u admin -P secret \
+    --response-document 3 \
+    --reason "CHG-1234"`,
+	PreRunE: requireNSXConnection,
+	RunE:    runSync,
 }
 
 func init() {
 	rootCmd.AddCommand(syncCmd)
 
 	// NSX connection flags (same as nsx command)
-	syncCmd.Flags().StringVar(&nsxHost, "host", "", "NSX Manager host URL (required)")
-	syncCmd.Flags().StringVarP(&nsxUsername, "username", "u", "", "NSX API username (required)")
-	syncCmd.Flags().StringVarP(&nsxPassword, "password", "P", "", "NSX API password (required)")
+	syncCmd.Flags().StringVar(&profileName, "profile", "", "connection profile from the config file (see ldapmerge nsx --help)")
+	syncCmd.Flags().StringVar(&nsxHost, "host", "", "NSX Manager host URL (required unless set by --profile)")
+	syncCmd.Flags().StringVarP(&nsxUsername, "username", "u", "", "NSX API username (required unless set by --profile)")
+	syncCmd.Flags().StringVarP(&nsxPassword, "password", "P", "", "NSX API password (required unless set by LDAPMERGE_NSX_PASSWORD)")
 	syncCmd.Flags().BoolVarP(&nsxInsecure, "insecure", "k", false, "Skip TLS certificate verification")
 	syncCmd.Flags().IntVar(&nsxTimeout, "timeout", 30, "API request timeout in seconds")
 
 	// Sync-specific flags
-	syncCmd.Flags().StringVarP(&syncResponseFile, "response", "r", "", "Path to certificate response JSON file (required)")
+	syncCmd.Flags().StringVarP(&syncResponseFile, "response", "r", "", "Certificate response JSON or .zip/.tar.gz location: path, URL or - for stdin")
+	syncCmd.Flags().Int64Var(&syncResponseDocument, "response-document", 0, "ID of an uploaded response document to use instead of --response")
+	syncCmd.Flags().StringVar(&dbPath, "db", "", "path to SQLite database for --response-document, the server inventory and the audit log (default: ldapmerge/data.db in the user config directory)")
+	syncCmd.Flags().BoolVar(&noInventory, "no-inventory", false, "do not record pulled servers in the server inventory")
 	syncCmd.Flags().StringVarP(&syncOutputFile, "output", "o", "", "Save merged result to file (optional)")
 	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "Perform pull and merge, but skip push to NSX")
+	syncCmd.Flags().StringVar(&syncReportFile, "report", "", "write a change report to this file: .html, .md or .json")
+	syncCmd.Flags().BoolVar(&syncProbe, "probe", false, "probe the merged sources with NSX and include the results in --report")
+	syncCmd.Flags().StringVar(&auditReason, "reason", "", "justification for the push, stored in the audit log (required unless --dry-run)")
+	syncCmd.Flags().BoolVar(&forceProtected, "force-protected", false, "allow pushing sources matching audit.protected_sources")
+	syncCmd.Flags().StringSliceVar(&syncDomains, "domain", nil, "sync only the identity sources whose IDs match this glob pattern (repeatable)")
+	syncCmd.Flags().StringVar(&syncCanary, "canary", "", "push this identity source first and the others only if NSX accepts it")
+	syncCmd.Flags().DurationVar(&syncPullTimeout, "pull-timeout", defaultPullTimeout, "deadline of the pull from NSX (0 for none)")
+	syncCmd.Flags().DurationVar(&syncPushTimeout, "push-timeout", defaultPushTimeout, "deadline of pushing each identity source, realization wait included (0 for none)")
+	syncCmd.Flags().DurationVar(&syncProbeTimeout, "probe-timeout", defaultProbeTimeout, "deadline of probing each identity source with --probe (0 for none)")
+	syncCmd.Flags().BoolVar(&syncDisableFailing, "disable-failing", false, "disable servers failing their inventory probes or with only expired certificates in the pushed configuration")
+	syncCmd.Flags().Int("probe-failure-threshold", api.DefaultOptions().ProbeFailureThreshold, "consecutive failed probes after which --disable-failing disables a server (0 ignores probes)")
+	addMergeFlags(syncCmd)
+	addMetaFlag(syncCmd)
+	addRealizationFlag(syncCmd)
+	addRetryConflictsFlag(syncCmd)
+	addInteractiveFlag(syncCmd)
+	addPushConcurrencyFlags(syncCmd)
+	addSimulateFlags(syncCmd)
+	addBindPasswordFlags(syncCmd)
+	addClearBindPasswordsFlag(syncCmd)
+
+	registerSettings(syncCmd, nsxSettings...)
+	registerSettings(syncCmd, syncTimeoutSettings...)
+	registerSettings(syncCmd,
+		setting{Key: "sync.disable_failing", Flag: "disable-failing"},
+		setting{Key: "probes.failure_threshold", Flag: "probe-failure-threshold"},
+	)
+	_ = syncCmd.RegisterFlagCompletionFunc("profile", completeProfiles)
+	syncCmd.MarkFlagsOneRequired("response", "response-document")
+	syncCmd.MarkFlagsMutuallyExclusive("response", "response-document")
+}
+
+// loadSyncResponse loads the certificate response from --response or,
+// with --response-document, from a document stored in the database. It
+// also returns the response file's description for the _meta of --output.
+func loadSyncResponse(ctx context.Context, m *merger.Merger) (*models.CertificateResponse, []merger.Input, error) {
+	if syncResponseFile != "" {
+		response, input, err := m.LoadResponseWithInput(ctx, syncResponseFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load response file: %w", err)
+		}
+		return response, []merger.Input{input}, nil
+	}
 
-	_ = syncCmd.MarkFlagRequired("host")
-	_ = syncCmd.MarkFlagRequired("username")
-	_ = syncCmd.MarkFlagRequired("password")
-	_ = syncCmd.MarkFlagRequired("response")
+	repo, err := repository.New(getDBPath())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	response, err := repo.GetResponseDocument(ctx, syncResponseDocument)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load response document %d: %w", syncResponseDocument, err)
+	}
+	return response, nil, nil
 }
 
 func runSync(cmd *cobra.Command, args []string) error {
 	startTime := time.Now()
-	ctx := context.Background()
+	ctx := startRun(cmd)
+
+	mergeOpts, err := getMergeOptions(cmd)
+	if err != nil {
+		return err
+	}
+
+	filter, err := merger.NewFilter(syncDomains)
+	if err != nil {
+		return err
+	}
+	if syncCanary != "" && !filter.Match(syncCanary) {
+		return fmt.Errorf("--canary %s does not match --domain", syncCanary)
+	}
+	if err := checkPushConcurrency(); err != nil {
+		return err
+	}
+
+	var reportFormat report.Format
+	if syncReportFile != "" {
+		if reportFormat, err = report.FormatOf(syncReportFile); err != nil {
+			return err
+		}
+	} else if syncProbe {
+		return errors.New("--probe requires --report")
+	}
 
 	log := slog.With(
 		"command", "sync",
@@ -86,99 +247,220 @@ func runSync(cmd *cobra.Command, args []string) error {
 		"dry_run", syncDryRun,
 	)
 
+	if err := checkSimulateFlags(log); err != nil {
+		return err
+	}
+
 	log.Info("starting sync operation")
+	if id, ok := runid.From(ctx); ok {
+		fmt.Println(i18n.T("sync.run_id", id))
+	}
+
+	var auditLog *auditLog
+	if !syncDryRun {
+		if auditLog, err = openAuditLog(); err != nil {
+			return err
+		}
+		defer func() { _ = auditLog.Close() }()
+	}
 
 	// Step 1: PULL from NSX
 	log.Info("step 1/3: pulling LDAP identity sources from NSX")
-	fmt.Println("► Step 1/3: Pulling current configuration from NSX...")
+	fmt.Println(i18n.T("sync.step1"))
 
 	client := nsx.NewClient(nsx.ClientConfig{
-		Host:     nsxHost,
-		Username: nsxUsername,
-		Password: nsxPassword,
-		Insecure: nsxInsecure,
-		Timeout:  time.Duration(nsxTimeout) * time.Second,
+		Host:        nsxHost,
+		Username:    nsxUsername,
+		Password:    nsxPassword,
+		Insecure:    nsxInsecure,
+		Timeout:     time.Duration(nsxTimeout) * time.Second,
+		Diagnostics: nsxDiagnostics(),
+		Chaos:       simulatedChaos,
 	})
 
 	pullStart := time.Now()
-	result, err := client.ListLDAPIdentitySources(ctx)
+	pullCtx, cancel := phaseContext(ctx, syncPullTimeout)
+	result, err := client.ListLDAPIdentitySources(pullCtx)
+	cancel()
 	if err != nil {
+		err = phaseError(ctx, err, "pull-timeout", syncPullTimeout)
 		log.Error("failed to pull from NSX", "error", err, "duration", time.Since(pullStart))
 		return fmt.Errorf("pull failed: %w", err)
 	}
 
-	initial := nsx.LDAPIdentitySourcesToDomains(result.Results)
+	pulled := nsx.LDAPIdentitySourcesToDomains(result.Results)
 	log.Info("pull completed",
-		"sources_count", len(initial),
+		"sources_count", len(pulled),
 		"duration", time.Since(pullStart),
 	)
-	fmt.Printf("  ✓ Fetched %d LDAP identity sources\n", len(initial))
+	fmt.Println(i18n.T("sync.fetched", len(pulled)))
+
+	recordInventory(ctx, log, pulled)
+
+	initial := filter.Select(pulled)
+	if len(initial) < len(pulled) {
+		log.Info("filtered identity sources", "domains", syncDomains, "selected_count", len(initial))
+		fmt.Println(i18n.T("sync.filtered", len(initial), len(pulled)))
+	}
+	if len(initial) == 0 {
+		return errors.New("no identity sources match --domain")
+	}
 
 	// Step 2: MERGE with certificates
 	log.Info("step 2/3: merging with certificate response",
 		"response_file", syncResponseFile,
+		"response_document", syncResponseDocument,
+		"strategy", mergeOpts.Strategy,
 	)
-	fmt.Println("► Step 2/3: Merging with certificate data...")
+	fmt.Println(i18n.T("sync.step2"))
 
 	mergeStart := time.Now()
-	m := merger.New()
+	m := merger.NewWithOptions(mergeOpts)
 
-	response, err := m.LoadResponseFromFile(syncResponseFile)
+	response, inputs, err := loadSyncResponse(ctx, m)
 	if err != nil {
-		log.Error("failed to load response file", "error", err, "file", syncResponseFile)
-		return fmt.Errorf("failed to load response file: %w", err)
+		log.Error("failed to load response", "error", err, "file", syncResponseFile, "document", syncResponseDocument)
+		return err
+	}
+
+	if err := m.Validate(initial, response); err != nil {
+		log.Error("merge validation failed", "error", err)
+		return fmt.Errorf("merge failed: %w", err)
 	}
+	warnWeakCertificates(log, mergeOpts.Weak, response)
 
-	merged := m.Merge(initial, response)
+	merged, stats, err := m.MergeWithStats(ctx, initial, response)
+	if err != nil {
+		log.Error("merge failed", "error", err)
+		return fmt.Errorf("merge failed: %w", err)
+	}
 
 	// Count certificates added
 	certsAdded := countCertificates(merged)
 	log.Info("merge completed",
 		"domains_count", len(merged),
 		"certificates_added", certsAdded,
+		"servers_count", stats.Servers,
+		"matched_servers", stats.MatchedServers,
+		"match_ratio", stats.MatchRatio,
+		"merge_duration_ms", stats.DurationMS,
 		"duration", time.Since(mergeStart),
 	)
-	fmt.Printf("  ✓ Merged %d domains, %d certificates added\n", len(merged), certsAdded)
+	fmt.Println(i18n.T("sync.merged", len(merged), certsAdded))
+
+	var disabled []models.DisabledServer
+	if syncDisableFailing {
+		disabled = disableBrokenServers(ctx, log, merged)
+	}
 
 	// Save output file if requested
 	if syncOutputFile != "" {
-		if err := saveResultToFile(merged, syncOutputFile); err != nil {
+		if err := writeResult(syncOutputFile, merged, outputMeta(nsxHost, inputs...), true); err != nil {
 			log.Error("failed to save output file", "error", err, "file", syncOutputFile)
 			return fmt.Errorf("failed to save output: %w", err)
 		}
 		log.Info("saved merged result to file", "file", syncOutputFile)
-		fmt.Printf("  ✓ Saved result to %s\n", syncOutputFile)
+		fmt.Println(i18n.T("sync.saved", syncOutputFile))
+
+		sigPath, err := signOutput(ctx, syncOutputFile)
+		if err != nil {
+			log.Error("failed to sign output file", "error", err, "file", syncOutputFile)
+			return fmt.Errorf("failed to sign output: %w", err)
+		}
+		if sigPath != "" {
+			log.Info("signed merged result", "signature", sigPath)
+			fmt.Println(i18n.T("sync.signed", sigPath))
+		}
+	}
+
+	if syncReportFile != "" {
+		if err := writeSyncReport(ctx, log, client, reportFormat, initial, merged, disabled, stats, mergeOpts.Strategy); err != nil {
+			return err
+		}
 	}
 
 	// Step 3: PUSH to NSX (unless dry-run)
 	if syncDryRun {
 		log.Info("dry-run mode, skipping push to NSX")
-		fmt.Println("► Step 3/3: Skipped (dry-run mode)")
-		fmt.Println("\n✓ Sync completed (dry-run)")
+		fmt.Println(i18n.T("sync.step3.skipped"))
+		fmt.Println("\n" + i18n.T("sync.done.dry_run"))
 	} else {
 		log.Info("step 3/3: pushing merged configuration to NSX")
-		fmt.Println("► Step 3/3: Pushing configuration to NSX...")
+		fmt.Println(i18n.T("sync.step3"))
 
 		pushStart := time.Now()
-		sources := nsx.DomainsToLDAPIdentitySources(merged)
+		ordered, err := merger.CanaryFirst(merged, syncCanary)
+		if err != nil {
+			return err
+		}
+		sources := nsx.DomainsToLDAPIdentitySources(ordered)
+		if err := injectSourceBindPasswords(log, sources); err != nil {
+			return err
+		}
 
-		var successCount, errorCount int
+		sourceIDs := make([]string, 0, len(sources))
 		for _, source := range sources {
-			sourceLog := log.With("source_id", source.ID)
-			sourceLog.Info("updating LDAP identity source")
+			sourceIDs = append(sourceIDs, source.ID)
+		}
+		if err := auditLog.checkProtected(ctx, log, audit.OperationSyncPush, sourceIDs); err != nil {
+			return err
+		}
+		if err := auditLog.saveSnapshot(ctx, log, client, audit.OperationSyncPush, sourceIDs); err != nil {
+			return err
+		}
+
+		progress := newPushProgress(len(sources), log)
+
+		var successCount, errorCount, skippedCount int
+		var firstErr error
+		results := pushSources(ctx, log, client, sources, nsx.BatchOptions{
+			Canary:  syncCanary != "",
+			Timeout: syncPushTimeout,
+			Start: func(id string) {
+				log.Info("updating LDAP identity source", "source_id", id)
+				progress.Start(id)
+			},
+		}, func(result nsx.PushResult) {
+			if result.Skipped {
+				skippedCount++
+				return
+			}
 
-			_, err := client.PutLDAPIdentitySource(ctx, &source)
+			sourceLog := log.With("source_id", result.ID)
+			err := result.Err
 			if err != nil {
-				sourceLog.Error("failed to update source", "error", err)
-				fmt.Printf("  ✗ %s: %v\n", source.ID, err)
+				err = phaseError(ctx, err, "push-timeout", syncPushTimeout)
+			}
+			progress.Done(result.ID, result.Duration, err)
+			if result.Kept {
+				return
+			}
+			if err != nil {
+				sourceLog.Error("failed to update source", "error", err, "duration", result.Duration)
+				if firstErr == nil {
+					firstErr = err
+				}
 				errorCount++
-				continue
+				return
 			}
 
-			sourceLog.Info("source updated successfully")
-			fmt.Printf("  ✓ %s\n", source.ID)
+			sourceLog.Info("source updated successfully", "duration", result.Duration)
 			successCount++
+		})
+		if skippedCount > 0 {
+			switch {
+			case syncCanary != "" && results[0].Err != nil:
+				log.Warn("canary source failed, push stopped", "source_id", results[0].ID, "skipped_count", skippedCount)
+				fmt.Println(i18n.T("sync.canary_failed", results[0].ID, skippedCount))
+			case ctx.Err() != nil:
+				log.Warn("sync interrupted, push stopped", "skipped_count", skippedCount)
+				fmt.Println(i18n.T("sync.interrupted", skippedCount))
+			default:
+				log.Warn("push stopped after a failure", "skipped_count", skippedCount)
+				fmt.Println(i18n.T("sync.stopped", skippedCount))
+			}
 		}
+		progress.Finish()
 
 		log.Info("push completed",
 			"success_count", successCount,
@@ -186,10 +468,17 @@ func runSync(cmd *cobra.Command, args []string) error {
 			"duration", time.Since(pushStart),
 		)
 
+		if err := auditLog.record(ctx, log, audit.OperationSyncPush, sourceIDs, successCount, errorCount, firstErr); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("push interrupted: %w", err)
+		}
+
 		if errorCount > 0 {
-			fmt.Printf("\n⚠ Sync completed with errors: %d succeeded, %d failed\n", successCount, errorCount)
+			fmt.Println("\n" + i18n.T("sync.done.errors", successCount, errorCount))
 		} else {
-			fmt.Println("\n✓ Sync completed successfully")
+			fmt.Println("\n" + i18n.T("sync.done"))
 		}
 	}
 
@@ -200,6 +489,159 @@ func runSync(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// writeSyncReport writes the change report of pushing merged over initial
+// to --report, probing the merged sources with --probe.
+func writeSyncReport(ctx context.Context, log *slog.Logger, client *nsx.Client, format report.Format, initial, merged []models.Domain, disabled []models.DisabledServer, stats models.MergeStats, strategy merger.Strategy) error {
+	r := report.NewChange(initial, merged, stats, time.Now())
+	r.NSXHost = nsxHost
+	r.RunID, _ = runid.From(ctx)
+	r.Strategy = string(strategy)
+	r.DryRun = syncDryRun
+	r.Disabled = disabled
+
+	if syncProbe {
+		probes, err := probeSources(ctx, log, client, merged)
+		if err != nil {
+			return err
+		}
+		r.Probes = probes
+	}
+
+	if err := writeOutput(syncReportFile, func(w io.Writer) error { return r.Write(w, format) }); err != nil {
+		log.Error("failed to write change report", "error", err, "file", syncReportFile)
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	log.Info("wrote change report", "file", syncReportFile, "format", format)
+	fmt.Println(i18n.T("sync.report", syncReportFile))
+	return nil
+}
+
+// disableBrokenServers disables, with --disable-failing, the enabled servers
+// of domains that reached probes.failure_threshold consecutive failed probes
+// in the server inventory or have only expired certificates, and prints
+// them.
+func disableBrokenServers(ctx context.Context, log *slog.Logger, domains []models.Domain) []models.DisabledServer {
+	reasons := make(map[string]string)
+	if threshold := viper.GetInt("probes.failure_threshold"); threshold > 0 {
+		for _, server := range inventoryServers(ctx, log) {
+			if server.NSXHost == nsxHost && server.ConsecutiveFailures >= threshold {
+				reasons[server.DomainID+" "+server.URL] = fmt.Sprintf("failed the last %d probes", server.ConsecutiveFailures)
+			}
+		}
+	}
+
+	expired, valid := make(map[string]bool), make(map[string]bool)
+	for _, c := range report.Certificates(domains, time.Now(), 0) {
+		key := c.Domain + " " + c.URL
+		if c.Status == report.CertificateExpired {
+			expired[key] = true
+		} else {
+			valid[key] = true
+		}
+	}
+
+	disabled := merger.DisableServers(domains, func(domain *models.Domain, server *models.LDAPServer) string {
+		key := domain.ID + " " + server.URL
+		if reason, ok := reasons[key]; ok {
+			return reason
+		}
+		if expired[key] && !valid[key] {
+			return "all certificates expired"
+		}
+		return ""
+	})
+
+	for _, d := range disabled {
+		if d.Kept {
+			log.Warn("broken LDAP server kept enabled, the last enabled server of its source", "source_id", d.Domain, "url", d.URL, "reason", d.Reason)
+			fmt.Println(i18n.T("sync.disable_kept", d.URL, d.Domain, d.Reason))
+			continue
+		}
+		log.Warn("disabled broken LDAP server", "source_id", d.Domain, "url", d.URL, "reason", d.Reason)
+		fmt.Println(i18n.T("sync.disabled", d.URL, d.Domain, d.Reason))
+	}
+	return disabled
+}
+
+// inventoryServers returns the server inventory, or nil with
+// --no-inventory or if the database cannot be read.
+func inventoryServers(ctx context.Context, log *slog.Logger) []models.InventoryServer {
+	if noInventory {
+		return nil
+	}
+
+	repo, err := repository.New(getDBPath())
+	if err != nil {
+		log.Warn("server inventory not read", "error", err)
+		return nil
+	}
+	defer func() { _ = repo.Close() }()
+
+	servers, err := repo.ListServers(ctx)
+	if err != nil {
+		log.Warn("server inventory not read", "error", err)
+		return nil
+	}
+	return servers
+}
+
+// probeSources probes every LDAP server of domains as configured there,
+// certificates included, with NSX. A source NSX fails to probe is reported
+// as failed for each of its servers.
+func probeSources(ctx context.Context, log *slog.Logger, client *nsx.Client, domains []models.Domain) ([]report.Probe, error) {
+	passwords, err := getBindPasswords()
+	if err != nil {
+		return nil, err
+	}
+
+	var probes []report.Probe
+	for _, source := range nsx.DomainsToLDAPIdentitySources(domains) {
+		passwords.Inject(&source)
+
+		probeCtx, cancel := phaseContext(ctx, syncProbeTimeout)
+		result, err := client.ProbeIdentitySource(probeCtx, &source)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			err = phaseError(ctx, err, "probe-timeout", syncProbeTimeout)
+			log.Warn("failed to probe identity source", "source_id", source.ID, "error", err)
+			for _, server := range source.LDAPServers {
+				probes = append(probes, report.Probe{Domain: source.ID, URL: server.URL, Error: err.Error()})
+			}
+			continue
+		}
+		for _, item := range result.Results {
+			probes = append(probes, report.Probe{
+				Domain:  source.ID,
+				URL:     item.LDAPServerURL,
+				Success: item.Success,
+				Error:   item.ErrorMessage,
+			})
+		}
+	}
+	return probes, nil
+}
+
+// phaseContext returns a context of ctx for a sync phase that expires after
+// timeout, unless timeout is 0.
+func phaseContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// phaseError names the flag of the deadline err exceeded, if the phase ran
+// out of time rather than ctx being cancelled.
+func phaseError(ctx context.Context, err error, flag string, timeout time.Duration) error {
+	if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w (--%s %s)", err, flag, timeout)
+	}
+	return err
+}
+
 func countCertificates(domains []models.Domain) int {
 	count := 0
 	for _, d := range domains {
@@ -209,11 +651,3 @@ func countCertificates(domains []models.Domain) int {
 	}
 	return count
 }
-
-func saveResultToFile(domains []models.Domain, path string) error {
-	data, err := json.MarshalIndent(domains, "", "    ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(path, data, 0o600)
-}
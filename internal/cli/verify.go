@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"ldapmerge/internal/i18n"
+	"ldapmerge/internal/signing"
+)
+
+var (
+	verifySignatureFile string
+	verifyPublicKey     string
+)
+
+// verifyOutputCmd verifies a signed merge output
+var verifyOutputCmd = &cobra.Command{
+	Use:   "verify-output <file>",
+	Short: "Verify the signature of a merged output file",
+	Long: `Verify that a merged output file matches its detached signature.
+
+Output files are signed when the "signing:" config section is set:
+  signing.key      Ed25519 private key (PEM); writes <file>.sig
+  signing.gpg_key  GPG key ID; writes <file>.asc
+
+Ed25519 signatures are verified with --public-key; GPG signatures with the
+local GPG keyring. The signature file defaults to <file>.sig, then <file>.asc.
+
+Exits with a non-zero status if the file was modified after signing.`,
+	Example: `  # Create an Ed25519 key pair
+  openssl genpkey -algorithm ed25519 -out signing.pem
+  openssl pkey -in signing.pem -pubout -out signing.pub
+
+  # Verify an Ed25519-signed output
+  ldapmerge verify-output result.json --public-key signing.pub
+
+  # Verify a GPG-signed output
+  ldapmerge verify-output result.json --signature result.json.asc`,
+	Args:         cobra.ExactArgs(1),
+	RunE:         runVerifyOutput,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(verifyOutputCmd)
+
+	verifyOutputCmd.Flags().StringVarP(&verifySignatureFile, "signature", "s", "", "path to signature file (default: <file>.sig or <file>.asc)")
+	verifyOutputCmd.Flags().StringVar(&verifyPublicKey, "public-key", "", "path to Ed25519 public key (PEM) for .sig signatures")
+}
+
+func runVerifyOutput(cmd *cobra.Command, args []string) error {
+	file := args[0]
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read output file: %w", err)
+	}
+
+	sigFile := verifySignatureFile
+	if sigFile == "" {
+		sigFile = file + ".sig"
+		if _, err := os.Stat(sigFile); errors.Is(err, os.ErrNotExist) {
+			sigFile = file + ".asc"
+		}
+	}
+
+	sig, err := os.ReadFile(sigFile)
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	var result *signing.Result
+	if signing.IsGPG(sig) {
+		result, err = signing.VerifyGPG(cmd.Context(), data, sig)
+	} else {
+		if verifyPublicKey == "" {
+			return fmt.Errorf("--public-key is required to verify %s", sigFile)
+		}
+		pub, loadErr := signing.LoadPublicKey(verifyPublicKey)
+		if loadErr != nil {
+			return loadErr
+		}
+		result, err = signing.VerifyEd25519(data, sig, pub)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+
+	color.New(color.FgHiGreen).Println(i18n.T("verify.valid", file, result.Algorithm))
+	fmt.Println(i18n.T("verify.key", result.KeyID))
+	fmt.Println(i18n.T("verify.sha256", result.SHA256))
+	return nil
+}
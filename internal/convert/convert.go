@@ -0,0 +1,293 @@
+// Package convert detects which of the JSON documents ldapmerge works with a
+// file holds — a domain list, an NSX identity source list or an Ansible
+// certificate response — and converts between them with the converters of
+// package nsx.
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+)
+
+// Format is the shape of a JSON document.
+type Format string
+
+// Document formats
+const (
+	// FormatDomains is a domain list, as nsx pull and merge write it
+	FormatDomains Format = "domains"
+	// FormatNSX is an NSX identity source list result, as GET
+	// /policy/api/v1/aaa/ldap-identity-sources returns it; an array of
+	// identity sources or a single one is read as well
+	FormatNSX Format = "nsx"
+	// FormatResponse is an Ansible certificate response; an array of
+	// results or a single result is read as well
+	FormatResponse Format = "response"
+)
+
+// Formats lists the document formats.
+var Formats = []Format{FormatDomains, FormatNSX, FormatResponse}
+
+// ErrNoDomains is returned when converting a certificate response to a
+// format that describes identity sources: it only holds URLs and
+// certificates.
+var ErrNoDomains = errors.New("a certificate response has no domain configuration")
+
+// ParseFormat returns the format named s.
+func ParseFormat(s string) (Format, error) {
+	for _, f := range Formats {
+		if Format(s) == f {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unknown format %q (valid: domains, nsx, response)", s)
+}
+
+// Detect returns the format of a JSON document.
+func Detect(data []byte) (Format, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return "", errors.New("empty document")
+	}
+
+	switch data[0] {
+	case '[':
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err != nil {
+			return "", err
+		}
+		for _, elem := range elems {
+			if format, ok := detectElement(elem); ok {
+				return format, nil
+			}
+		}
+		if len(elems) == 0 || isMeta(elems[0]) {
+			return FormatDomains, nil
+		}
+		return "", errors.New("array of neither domains, NSX identity sources nor certificate results")
+
+	case '{':
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(data, &members); err != nil {
+			return "", err
+		}
+		results, ok := members["results"]
+		if !ok {
+			if format, ok := detectElement(data); ok {
+				return format, nil
+			}
+			return "", errors.New("object is neither a list result, an identity source nor a certificate result")
+		}
+
+		var elems []json.RawMessage
+		if err := json.Unmarshal(results, &elems); err != nil {
+			return "", fmt.Errorf("results: %w", err)
+		}
+		for _, elem := range elems {
+			format, ok := detectElement(elem)
+			if !ok {
+				continue
+			}
+			if format == FormatDomains {
+				format = FormatNSX // list results only hold identity sources
+			}
+			return format, nil
+		}
+		if _, ok := members["result_count"]; ok {
+			return FormatNSX, nil
+		}
+		return FormatResponse, nil
+	}
+
+	return "", errors.New("document is neither a JSON array nor an object")
+}
+
+// detectElement returns the format of a document of which elem is an
+// element, and whether it could tell.
+func detectElement(elem json.RawMessage) (Format, bool) {
+	var members map[string]json.RawMessage
+	if json.Unmarshal(elem, &members) != nil {
+		return "", false
+	}
+
+	if _, ok := members["ldap_servers"]; ok {
+		if IsNSXSource(elem) {
+			return FormatNSX, true
+		}
+		return FormatDomains, true
+	}
+	_, hasItem := members["item"]
+	_, hasJSON := members["json"]
+	if hasItem || hasJSON {
+		return FormatResponse, true
+	}
+	return "", false
+}
+
+// IsNSXSource reports whether a JSON object is an NSX identity source rather
+// than a domain: it has a resource_type, or its servers have NSX's
+// use_starttls and bind_identity members or boolean enabled flags.
+func IsNSXSource(data []byte) bool {
+	var source struct {
+		ResourceType string                       `json:"resource_type"`
+		LDAPServers  []map[string]json.RawMessage `json:"ldap_servers"`
+	}
+	if json.Unmarshal(data, &source) != nil {
+		return false
+	}
+	if source.ResourceType != "" {
+		return true
+	}
+	for _, server := range source.LDAPServers {
+		if _, ok := server["starttls"]; ok {
+			return false
+		}
+		if _, ok := server["bind_username"]; ok {
+			return false
+		}
+		if _, ok := server["use_starttls"]; ok {
+			return true
+		}
+		if _, ok := server["bind_identity"]; ok {
+			return true
+		}
+		if enabled, ok := server["enabled"]; ok {
+			_, err := strconv.ParseBool(string(enabled))
+			return err == nil
+		}
+	}
+	return false
+}
+
+// isMeta reports whether elem is the {"_meta": ...} element of a result.
+func isMeta(elem json.RawMessage) bool {
+	var members map[string]json.RawMessage
+	if json.Unmarshal(elem, &members) != nil {
+		return false
+	}
+	_, ok := members["_meta"]
+	return ok
+}
+
+// Domains converts a document of format from to domains. A leading _meta
+// element of a domain list is dropped.
+func Domains(data []byte, from Format) ([]models.Domain, error) {
+	switch from {
+	case FormatDomains:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err != nil {
+			return nil, err
+		}
+		if len(elems) > 0 && isMeta(elems[0]) {
+			elems = elems[1:]
+		}
+		domains := make([]models.Domain, len(elems))
+		for i, elem := range elems {
+			if err := json.Unmarshal(elem, &domains[i]); err != nil {
+				return nil, fmt.Errorf("domain %d: %w", i, err)
+			}
+		}
+		return domains, nil
+
+	case FormatNSX:
+		sources, err := nsxSources(data)
+		if err != nil {
+			return nil, err
+		}
+		return nsx.LDAPIdentitySourcesToDomains(sources), nil
+
+	case FormatResponse:
+		return nil, ErrNoDomains
+	}
+	return nil, fmt.Errorf("unknown format %q", from)
+}
+
+// nsxSources decodes a list result, an array of identity sources or a single
+// one.
+func nsxSources(data []byte) ([]nsx.LDAPIdentitySource, error) {
+	data = bytes.TrimSpace(data)
+	var sources []nsx.LDAPIdentitySource
+	if len(data) > 0 && data[0] == '[' {
+		err := json.Unmarshal(data, &sources)
+		return sources, err
+	}
+
+	var list struct {
+		Results *[]nsx.LDAPIdentitySource `json:"results"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	if list.Results != nil {
+		return *list.Results, nil
+	}
+	var source nsx.LDAPIdentitySource
+	if err := json.Unmarshal(data, &source); err != nil {
+		return nil, err
+	}
+	return []nsx.LDAPIdentitySource{source}, nil
+}
+
+// NSX returns domains as an NSX identity source list result.
+func NSX(domains []models.Domain) *nsx.LDAPIdentitySourceListResult {
+	sources := nsx.DomainsToLDAPIdentitySources(domains)
+	return &nsx.LDAPIdentitySourceListResult{Results: sources, ResultCount: len(sources)}
+}
+
+// Response converts a document of format from to a certificate response. A
+// response is returned in its canonical {"results": [...]} form; domain
+// and NSX lists give one result per certificate of each server.
+func Response(data []byte, from Format) (*models.CertificateResponse, error) {
+	if from != FormatResponse {
+		domains, err := Domains(data, from)
+		if err != nil {
+			return nil, err
+		}
+		return ResponseOf(domains), nil
+	}
+
+	data = bytes.TrimSpace(data)
+	response := &models.CertificateResponse{Results: []models.CertificateResult{}}
+	if len(data) > 0 && data[0] == '[' {
+		err := json.Unmarshal(data, &response.Results)
+		return response, err
+	}
+
+	var doc struct {
+		models.CertificateResult
+		Results *[]models.CertificateResult `json:"results"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Results != nil {
+		response.Results = *doc.Results
+	} else {
+		response.Results = append(response.Results, doc.CertificateResult)
+	}
+	return response, nil
+}
+
+// ResponseOf returns a certificate response with a result for every
+// certificate of the servers of domains, as the certificate collection
+// would return it.
+func ResponseOf(domains []models.Domain) *models.CertificateResponse {
+	response := &models.CertificateResponse{Results: []models.CertificateResult{}}
+	for _, domain := range domains {
+		for _, server := range domain.LDAPServers {
+			for _, cert := range server.Certificates {
+				response.Results = append(response.Results, models.CertificateResult{
+					JSON: models.CertificateJSON{PEMEncoded: cert},
+					Item: models.ResponseItem{URL: server.URL, StartTLS: server.StartTLS, Enabled: server.Enabled},
+				})
+			}
+		}
+	}
+	return response
+}
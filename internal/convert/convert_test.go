@@ -0,0 +1,92 @@
+package convert_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"ldapmerge/internal/convert"
+)
+
+const (
+	domainsDoc = `[
+		{"_meta": {"tool": "ldapmerge"}},
+		{"id": "example.lab", "domain_name": "example.lab", "base_dn": "DC=example,DC=lab",
+		 "ldap_servers": [{"url": "ldaps://ad-01.example.lab:636", "starttls": "false", "enabled": "true", "certificates": ["PEM-1"]}]}
+	]`
+	nsxDoc = `{"results": [
+		{"id": "example.lab", "resource_type": "LdapIdentitySource", "domain_name": "example.lab", "base_dn": "DC=example,DC=lab",
+		 "ldap_servers": [{"url": "ldaps://ad-01.example.lab:636", "use_starttls": false, "enabled": true, "certificates": ["PEM-1"]}],
+		 "_revision": 3, "path": "/aaa/ldap-identity-sources/example.lab"}
+	], "result_count": 1}`
+	responseDoc = `{"changed": false, "results": [
+		{"json": {"pem_encoded": "PEM-1"}, "item": {"url": "ldaps://ad-01.example.lab:636"}}
+	]}`
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		doc  string
+		want convert.Format
+	}{
+		{domainsDoc, convert.FormatDomains},
+		{`[]`, convert.FormatDomains},
+		{nsxDoc, convert.FormatNSX},
+		{`{"results": [], "result_count": 0}`, convert.FormatNSX},
+		{`[{"id": "a", "ldap_servers": [{"url": "ldap://a:389", "enabled": true}]}]`, convert.FormatNSX},
+		{`{"id": "a", "domain_name": "a", "ldap_servers": [{"url": "ldap://a:389", "use_starttls": true}]}`, convert.FormatNSX},
+		{responseDoc, convert.FormatResponse},
+		{`[{"json": {"pem_encoded": "PEM"}, "item": {"url": "ldap://a:389"}}]`, convert.FormatResponse},
+		{`{"json": {"pem_encoded": "PEM"}, "item": {"url": "ldap://a:389"}}`, convert.FormatResponse},
+	}
+	for _, tt := range tests {
+		got, err := convert.Detect([]byte(tt.doc))
+		if err != nil || got != tt.want {
+			t.Errorf("Detect(%s) = %q, %v; expected %q", tt.doc, got, err, tt.want)
+		}
+	}
+
+	for _, doc := range []string{``, `42`, `[1]`, `{"name": "x"}`} {
+		if _, err := convert.Detect([]byte(doc)); err == nil {
+			t.Errorf("Expected an error for %q", doc)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	for _, tt := range []struct {
+		doc    string
+		format convert.Format
+	}{{domainsDoc, convert.FormatDomains}, {nsxDoc, convert.FormatNSX}} {
+		domains, err := convert.Domains([]byte(tt.doc), tt.format)
+		if err != nil {
+			t.Fatalf("Domains(%s) failed: %v", tt.format, err)
+		}
+		if len(domains) != 1 || domains[0].ID != "example.lab" || domains[0].LDAPServers[0].Enabled != "true" || domains[0].LDAPServers[0].StartTLS != "false" {
+			t.Errorf("Unexpected domains from %s: %+v", tt.format, domains)
+		}
+
+		response, err := convert.Response([]byte(tt.doc), tt.format)
+		if err != nil || len(response.Results) != 1 || response.Results[0].JSON.PEMEncoded != "PEM-1" {
+			t.Errorf("Unexpected response from %s: %+v, %v", tt.format, response, err)
+		}
+	}
+
+	domains, _ := convert.Domains([]byte(domainsDoc), convert.FormatDomains)
+	list := convert.NSX(domains)
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format, err := convert.Detect(data); err != nil || format != convert.FormatNSX || list.ResultCount != 1 {
+		t.Errorf("Expected an NSX list result, got %s (%v): %s", format, err, data)
+	}
+
+	if _, err := convert.Domains([]byte(responseDoc), convert.FormatResponse); !errors.Is(err, convert.ErrNoDomains) {
+		t.Errorf("Expected ErrNoDomains, got %v", err)
+	}
+	response, err := convert.Response([]byte(responseDoc), convert.FormatResponse)
+	if err != nil || len(response.Results) != 1 {
+		t.Errorf("Unexpected response %+v: %v", response, err)
+	}
+}
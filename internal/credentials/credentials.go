@@ -0,0 +1,173 @@
+// Package credentials supplies the bind passwords of LDAP servers at push
+// time. NSX never returns bind passwords, so an identity source pulled and
+// pushed back as is would be pushed without them.
+package credentials
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"go.yaml.in/yaml/v3"
+
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/nsx"
+)
+
+// EnvVar holds bind passwords as a JSON object mapping LDAP server URLs to
+// passwords.
+const EnvVar = "LDAPMERGE_BIND_PASSWORDS"
+
+// BindPasswords maps LDAP server URLs to bind passwords. URLs match
+// regardless of case and default port, as with merge --normalize.
+type BindPasswords struct {
+	byURL map[string]string
+}
+
+// New returns an empty set of bind passwords.
+func New() *BindPasswords {
+	return &BindPasswords{byURL: make(map[string]string)}
+}
+
+// LoadFile reads bind passwords from a YAML or JSON file mapping LDAP server
+// URLs to passwords:
+//
+//	ldaps://ad-01.example.lab:636: s3cret
+func (p *BindPasswords) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read bind passwords: %w", err)
+	}
+
+	var entries map[string]string
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("invalid bind passwords file %s: %w", path, err)
+	}
+	p.add(entries)
+	return nil
+}
+
+// LoadEnv reads bind passwords from EnvVar, if set.
+func (p *BindPasswords) LoadEnv() error {
+	value, ok := os.LookupEnv(EnvVar)
+	if !ok || value == "" {
+		return nil
+	}
+
+	var entries map[string]string
+	if err := json.Unmarshal([]byte(value), &entries); err != nil {
+		return fmt.Errorf("invalid %s: expected a JSON object of URL to password: %w", EnvVar, err)
+	}
+	p.add(entries)
+	return nil
+}
+
+func (p *BindPasswords) add(entries map[string]string) {
+	for url, password := range entries {
+		p.Set(url, password)
+	}
+}
+
+// Set sets the bind password of url.
+func (p *BindPasswords) Set(url, password string) {
+	p.byURL[merger.NormalizeURL(url)] = password
+}
+
+// Lookup returns the bind password of url.
+func (p *BindPasswords) Lookup(url string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	password, ok := p.byURL[merger.NormalizeURL(url)]
+	return password, ok && password != ""
+}
+
+// Len returns the number of URLs with a password.
+func (p *BindPasswords) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.byURL)
+}
+
+// Inject sets the password of every server of source that binds with an
+// identity but has no password. It returns the URLs of such servers left
+// without one.
+func (p *BindPasswords) Inject(source *nsx.LDAPIdentitySource) (missing []string) {
+	for i := range source.LDAPServers {
+		server := &source.LDAPServers[i]
+		if server.BindIdentity == "" || server.Password != "" {
+			continue
+		}
+		if password, ok := p.Lookup(server.URL); ok {
+			server.Password = password
+			continue
+		}
+		missing = append(missing, server.URL)
+	}
+	return missing
+}
+
+// InjectDocument is Inject for an identity source document as NSX returns
+// it, such as a snapshotted one. Fields ldapmerge does not model are kept.
+func (p *BindPasswords) InjectDocument(doc json.RawMessage) (json.RawMessage, []string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return nil, nil, fmt.Errorf("invalid identity source document: %w", err)
+	}
+	var servers []map[string]any
+	if raw, ok := fields["ldap_servers"]; ok {
+		if err := json.Unmarshal(raw, &servers); err != nil {
+			return nil, nil, fmt.Errorf("invalid ldap_servers: %w", err)
+		}
+	}
+
+	var missing []string
+	for _, server := range servers {
+		url, _ := server["url"].(string)
+		identity, _ := server["bind_identity"].(string)
+		if password, _ := server["password"].(string); identity == "" || password != "" {
+			continue
+		}
+		if password, ok := p.Lookup(url); ok {
+			server["password"] = password
+			continue
+		}
+		missing = append(missing, url)
+	}
+	if servers == nil {
+		return doc, nil, nil
+	}
+
+	raw, err := json.Marshal(servers)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields["ldap_servers"] = raw
+	out, err := json.Marshal(fields)
+	return out, missing, err
+}
+
+// Missing returns the URLs of the servers of sources that bind with an
+// identity but have no password and none in p, sorted and without duplicates.
+func (p *BindPasswords) Missing(sources []nsx.LDAPIdentitySource) []string {
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		for _, server := range source.LDAPServers {
+			if server.BindIdentity == "" || server.Password != "" {
+				continue
+			}
+			if _, ok := p.Lookup(server.URL); !ok {
+				seen[server.URL] = true
+			}
+		}
+	}
+
+	missing := make([]string, 0, len(seen))
+	for url := range seen {
+		missing = append(missing, url)
+	}
+	sort.Strings(missing)
+	return missing
+}
@@ -0,0 +1,88 @@
+package credentials_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"ldapmerge/internal/credentials"
+	"ldapmerge/internal/nsx"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bind-passwords.yaml")
+	data := "ldaps://AD-01.example.lab: file-secret\nldap://ad-02.example.lab:389: other\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(credentials.EnvVar, `{"ldaps://ad-01.example.lab:636": "env-secret"}`)
+
+	p := credentials.New()
+	if err := p.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if err := p.LoadEnv(); err != nil {
+		t.Fatalf("LoadEnv failed: %v", err)
+	}
+
+	// The environment overrides the file, and URLs match normalized
+	if got, ok := p.Lookup("ldaps://ad-01.example.lab"); !ok || got != "env-secret" {
+		t.Errorf("Expected env-secret, got %q, %v", got, ok)
+	}
+	if got, ok := p.Lookup("ldap://ad-02.example.lab"); !ok || got != "other" {
+		t.Errorf("Expected other, got %q, %v", got, ok)
+	}
+
+	t.Setenv(credentials.EnvVar, "not json")
+	if err := p.LoadEnv(); err == nil {
+		t.Error("Expected error for an invalid environment variable")
+	}
+}
+
+func TestInject(t *testing.T) {
+	p := credentials.New()
+	p.Set("ldaps://ad-01.example.lab:636", "secret")
+
+	source := nsx.LDAPIdentitySource{LDAPServers: []nsx.LDAPServer{
+		{URL: "ldaps://ad-01.example.lab:636", BindIdentity: "svc@example.lab"},
+		{URL: "ldaps://ad-02.example.lab:636", BindIdentity: "svc@example.lab"},
+		{URL: "ldaps://ad-03.example.lab:636", BindIdentity: "svc@example.lab", Password: "kept"},
+		{URL: "ldaps://ad-04.example.lab:636"}, // anonymous bind
+	}}
+	if got := p.Missing([]nsx.LDAPIdentitySource{source}); !slices.Equal(got, []string{"ldaps://ad-02.example.lab:636"}) {
+		t.Errorf("Expected ad-02 missing, got %v", got)
+	}
+
+	missing := p.Inject(&source)
+	if !slices.Equal(missing, []string{"ldaps://ad-02.example.lab:636"}) {
+		t.Errorf("Expected ad-02 missing, got %v", missing)
+	}
+	for i, want := range []string{"secret", "", "kept", ""} {
+		if got := source.LDAPServers[i].Password; got != want {
+			t.Errorf("Server %d: expected password %q, got %q", i, want, got)
+		}
+	}
+
+	doc := json.RawMessage(`{"id":"example.lab","custom":1,"ldap_servers":[` +
+		`{"url":"ldaps://ad-01.example.lab:636","bind_identity":"svc@example.lab"},` +
+		`{"url":"ldaps://ad-02.example.lab:636","bind_identity":"svc@example.lab"}]}`)
+	out, missing, err := p.InjectDocument(doc)
+	if err != nil {
+		t.Fatalf("InjectDocument failed: %v", err)
+	}
+	if !slices.Equal(missing, []string{"ldaps://ad-02.example.lab:636"}) {
+		t.Errorf("Expected ad-02 missing, got %v", missing)
+	}
+	var got struct {
+		Custom      int              `json:"custom"`
+		LDAPServers []nsx.LDAPServer `json:"ldap_servers"`
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Custom != 1 || got.LDAPServers[0].Password != "secret" || got.LDAPServers[1].Password != "" {
+		t.Errorf("Unexpected document %s", out)
+	}
+}
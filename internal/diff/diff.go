@@ -0,0 +1,277 @@
+// Package diff compares domain documents: merge results, history entries,
+// files and the identity sources on NSX. Domains are matched by ID, LDAP
+// servers by URL and certificates by SHA-256 fingerprint.
+package diff
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"ldapmerge/internal/models"
+)
+
+// ResultDiff describes the differences between two domain lists.
+type ResultDiff struct {
+	AddedDomains   []string     `json:"added_domains,omitempty" doc:"IDs of domains only in the second result"`
+	RemovedDomains []string     `json:"removed_domains,omitempty" doc:"IDs of domains only in the first result"`
+	ChangedDomains []DomainDiff `json:"changed_domains,omitempty" doc:"Domains present in both results with differences"`
+}
+
+// DomainDiff describes the differences within one domain.
+type DomainDiff struct {
+	ID             string        `json:"id" doc:"Domain ID"`
+	Fields         []FieldChange `json:"fields,omitempty" doc:"Changed domain fields"`
+	AddedServers   []string      `json:"added_servers,omitempty" doc:"URLs of LDAP servers only in the second result"`
+	RemovedServers []string      `json:"removed_servers,omitempty" doc:"URLs of LDAP servers only in the first result"`
+	ChangedServers []ServerDiff  `json:"changed_servers,omitempty" doc:"LDAP servers present in both results with differences"`
+}
+
+// ServerDiff describes the differences within one LDAP server.
+type ServerDiff struct {
+	URL                 string        `json:"url" doc:"LDAP server URL"`
+	Fields              []FieldChange `json:"fields,omitempty" doc:"Changed server fields"`
+	AddedCertificates   []string      `json:"added_certificates,omitempty" doc:"SHA-256 fingerprints of added certificates"`
+	RemovedCertificates []string      `json:"removed_certificates,omitempty" doc:"SHA-256 fingerprints of removed certificates"`
+}
+
+// FieldChange is a changed scalar field. Fields ldapmerge does not know are
+// compared by their JSON.
+type FieldChange struct {
+	Field string `json:"field" doc:"Field name"`
+	Old   string `json:"old" doc:"Value in the first result"`
+	New   string `json:"new" doc:"Value in the second result"`
+}
+
+// Empty reports whether the two lists are identical.
+func (r *ResultDiff) Empty() bool {
+	return len(r.AddedDomains) == 0 && len(r.RemovedDomains) == 0 && len(r.ChangedDomains) == 0
+}
+
+// Compare compares two domain lists, a before b.
+func Compare(a, b []models.Domain) *ResultDiff {
+	r := &ResultDiff{}
+
+	oldDomains := indexDomains(a)
+	newDomains := indexDomains(b)
+
+	for _, id := range sortedKeys(oldDomains) {
+		if _, ok := newDomains[id]; !ok {
+			r.RemovedDomains = append(r.RemovedDomains, id)
+		}
+	}
+
+	for _, id := range sortedKeys(newDomains) {
+		oldDomain, ok := oldDomains[id]
+		if !ok {
+			r.AddedDomains = append(r.AddedDomains, id)
+			continue
+		}
+		if d := compareDomain(oldDomain, newDomains[id]); d != nil {
+			r.ChangedDomains = append(r.ChangedDomains, *d)
+		}
+	}
+
+	return r
+}
+
+func compareDomain(a, b *models.Domain) *DomainDiff {
+	d := &DomainDiff{ID: b.ID}
+	d.Fields = appendChange(d.Fields, "domain_name", a.DomainName, b.DomainName)
+	d.Fields = appendChange(d.Fields, "base_dn", a.BaseDN, b.BaseDN)
+	d.Fields = appendChange(d.Fields, "alternative_domain_names",
+		strings.Join(a.AlternativeDomainNames, ","), strings.Join(b.AlternativeDomainNames, ","))
+	d.Fields = appendChange(d.Fields, "display_name", a.DisplayName, b.DisplayName)
+	d.Fields = appendChange(d.Fields, "description", a.Description, b.Description)
+	d.Fields = appendChange(d.Fields, "tags", formatTags(a.Tags), formatTags(b.Tags))
+	d.Fields = appendExtraChanges(d.Fields, a.Extra, b.Extra)
+
+	oldServers := indexServers(a.LDAPServers)
+	newServers := indexServers(b.LDAPServers)
+
+	for _, u := range sortedKeys(oldServers) {
+		if _, ok := newServers[u]; !ok {
+			d.RemovedServers = append(d.RemovedServers, u)
+		}
+	}
+
+	for _, u := range sortedKeys(newServers) {
+		oldServer, ok := oldServers[u]
+		if !ok {
+			d.AddedServers = append(d.AddedServers, u)
+			continue
+		}
+		if s := compareServer(oldServer, newServers[u]); s != nil {
+			d.ChangedServers = append(d.ChangedServers, *s)
+		}
+	}
+
+	if len(d.Fields) == 0 && len(d.AddedServers) == 0 && len(d.RemovedServers) == 0 && len(d.ChangedServers) == 0 {
+		return nil
+	}
+	return d
+}
+
+func compareServer(a, b *models.LDAPServer) *ServerDiff {
+	s := &ServerDiff{URL: b.URL}
+	s.Fields = appendChange(s.Fields, "starttls", a.StartTLS, b.StartTLS)
+	s.Fields = appendChange(s.Fields, "enabled", a.Enabled, b.Enabled)
+	s.Fields = appendChange(s.Fields, "bind_username", a.BindUsername, b.BindUsername)
+	s.Fields = appendExtraChanges(s.Fields, a.Extra, b.Extra)
+
+	oldCerts := fingerprintSet(a.Certificates)
+	newCerts := fingerprintSet(b.Certificates)
+	for _, fp := range sortedKeys(oldCerts) {
+		if !newCerts[fp] {
+			s.RemovedCertificates = append(s.RemovedCertificates, fp)
+		}
+	}
+	for _, fp := range sortedKeys(newCerts) {
+		if !oldCerts[fp] {
+			s.AddedCertificates = append(s.AddedCertificates, fp)
+		}
+	}
+
+	if len(s.Fields) == 0 && len(s.AddedCertificates) == 0 && len(s.RemovedCertificates) == 0 {
+		return nil
+	}
+	return s
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a PEM certificate's DER
+// bytes, or of the trimmed text when it is not valid PEM.
+func Fingerprint(cert string) string {
+	data := []byte(strings.TrimSpace(cert))
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// WriteText writes a human-readable, unified-diff style rendering of r.
+func (r *ResultDiff) WriteText(w io.Writer) error {
+	var sb strings.Builder
+
+	if r.Empty() {
+		sb.WriteString("No differences\n")
+	}
+	for _, id := range r.RemovedDomains {
+		fmt.Fprintf(&sb, "- domain %s\n", id)
+	}
+	for _, id := range r.AddedDomains {
+		fmt.Fprintf(&sb, "+ domain %s\n", id)
+	}
+	for _, domain := range r.ChangedDomains {
+		fmt.Fprintf(&sb, "~ domain %s\n", domain.ID)
+		writeFieldChanges(&sb, "    ", domain.Fields)
+		for _, u := range domain.RemovedServers {
+			fmt.Fprintf(&sb, "    - server %s\n", u)
+		}
+		for _, u := range domain.AddedServers {
+			fmt.Fprintf(&sb, "    + server %s\n", u)
+		}
+		for _, server := range domain.ChangedServers {
+			fmt.Fprintf(&sb, "    ~ server %s\n", server.URL)
+			writeFieldChanges(&sb, "        ", server.Fields)
+			for _, fp := range server.RemovedCertificates {
+				fmt.Fprintf(&sb, "        - certificate %s\n", fp)
+			}
+			for _, fp := range server.AddedCertificates {
+				fmt.Fprintf(&sb, "        + certificate %s\n", fp)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeFieldChanges(sb *strings.Builder, indent string, changes []FieldChange) {
+	for _, c := range changes {
+		fmt.Fprintf(sb, "%s~ %s: %q → %q\n", indent, c.Field, c.Old, c.New)
+	}
+}
+
+func appendChange(changes []FieldChange, field, a, b string) []FieldChange {
+	if a == b {
+		return changes
+	}
+	return append(changes, FieldChange{Field: field, Old: a, New: b})
+}
+
+// appendExtraChanges appends the changes of the members ldapmerge does not
+// know, in name order.
+func appendExtraChanges(changes []FieldChange, a, b models.Extra) []FieldChange {
+	names := make(map[string]bool, len(a)+len(b))
+	for name := range a {
+		names[name] = true
+	}
+	for name := range b {
+		names[name] = true
+	}
+	for _, name := range sortedKeys(names) {
+		changes = appendChange(changes, name, compactJSON(a[name]), compactJSON(b[name]))
+	}
+	return changes
+}
+
+// compactJSON returns raw without insignificant whitespace, so that members
+// read from indented and compact documents compare equal.
+func compactJSON(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if json.Compact(&buf, raw) != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+func formatTags(tags []models.Tag) string {
+	parts := make([]string, len(tags))
+	for i, t := range tags {
+		parts[i] = t.Tag
+		if t.Scope != "" {
+			parts[i] = t.Scope + ":" + t.Tag
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func indexDomains(domains []models.Domain) map[string]*models.Domain {
+	index := make(map[string]*models.Domain, len(domains))
+	for i := range domains {
+		index[domains[i].ID] = &domains[i]
+	}
+	return index
+}
+
+func indexServers(servers []models.LDAPServer) map[string]*models.LDAPServer {
+	index := make(map[string]*models.LDAPServer, len(servers))
+	for i := range servers {
+		index[servers[i].URL] = &servers[i]
+	}
+	return index
+}
+
+func fingerprintSet(certs []string) map[string]bool {
+	set := make(map[string]bool, len(certs))
+	for _, cert := range certs {
+		set[Fingerprint(cert)] = true
+	}
+	return set
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
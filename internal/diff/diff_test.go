@@ -0,0 +1,92 @@
+package diff_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"ldapmerge/internal/diff"
+	"ldapmerge/internal/models"
+)
+
+const (
+	certOld = "-----BEGIN CERTIFICATE-----\nold\n-----END CERTIFICATE-----"
+	certNew = "-----BEGIN CERTIFICATE-----\nnew\n-----END CERTIFICATE-----"
+)
+
+func TestCompare(t *testing.T) {
+	a := []models.Domain{
+		{ID: "example.lab", BaseDN: "DC=example,DC=lab", LDAPServers: []models.LDAPServer{
+			{URL: "ldaps://ad-01.example.lab:636", Enabled: "true", Certificates: []string{certOld}},
+			{URL: "ldaps://ad-02.example.lab:636"},
+		}},
+		{ID: "old.lab"},
+	}
+	b := []models.Domain{
+		{ID: "example.lab", BaseDN: "DC=example,DC=lab", LDAPServers: []models.LDAPServer{
+			{URL: "ldaps://ad-01.example.lab:636", Enabled: "false", Certificates: []string{certNew}},
+			{URL: "ldaps://ad-03.example.lab:636"},
+		}},
+	}
+
+	r := diff.Compare(a, b)
+
+	if len(r.RemovedDomains) != 1 || r.RemovedDomains[0] != "old.lab" {
+		t.Errorf("Expected removed domain old.lab, got %v", r.RemovedDomains)
+	}
+	if len(r.ChangedDomains) != 1 {
+		t.Fatalf("Expected 1 changed domain, got %d", len(r.ChangedDomains))
+	}
+
+	domain := r.ChangedDomains[0]
+	if len(domain.AddedServers) != 1 || len(domain.RemovedServers) != 1 {
+		t.Errorf("Expected one added and one removed server, got %+v", domain)
+	}
+	if len(domain.ChangedServers) != 1 {
+		t.Fatalf("Expected 1 changed server, got %d", len(domain.ChangedServers))
+	}
+
+	server := domain.ChangedServers[0]
+	if len(server.Fields) != 1 || server.Fields[0].Field != "enabled" {
+		t.Errorf("Expected enabled change, got %+v", server.Fields)
+	}
+	if len(server.AddedCertificates) != 1 || server.AddedCertificates[0] != diff.Fingerprint(certNew) {
+		t.Errorf("Unexpected added certificates: %v", server.AddedCertificates)
+	}
+
+	if !diff.Compare(a, a).Empty() {
+		t.Error("Expected no differences comparing a result with itself")
+	}
+}
+
+func TestCompareMetadataAndExtra(t *testing.T) {
+	var a, b []models.Domain
+	if err := json.Unmarshal([]byte(`[{"id": "a", "description": "old", "tags": [{"scope": "owner", "tag": "iam"}],
+		"search_timeout": {"seconds": 30}, "ldap_servers": [{"url": "ldaps://a:636", "pool": 4}]}]`), &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`[{"id":"a","description":"new","tags":[{"scope":"owner","tag":"iam"}],
+		"search_timeout":{"seconds":30},"ldap_servers":[{"url":"ldaps://a:636","pool":8}]}]`), &b); err != nil {
+		t.Fatal(err)
+	}
+
+	r := diff.Compare(a, b)
+	if len(r.ChangedDomains) != 1 {
+		t.Fatalf("Expected 1 changed domain, got %+v", r)
+	}
+	domain := r.ChangedDomains[0]
+	if len(domain.Fields) != 1 || domain.Fields[0] != (diff.FieldChange{Field: "description", Old: "old", New: "new"}) {
+		t.Errorf("Expected only the description to change, got %+v", domain.Fields)
+	}
+	if len(domain.ChangedServers) != 1 || domain.ChangedServers[0].Fields[0] != (diff.FieldChange{Field: "pool", Old: "4", New: "8"}) {
+		t.Errorf("Expected the unknown server field to change, got %+v", domain.ChangedServers)
+	}
+
+	var text strings.Builder
+	if err := r.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	if want := "~ domain a\n    ~ description: \"old\" → \"new\"\n    ~ server ldaps://a:636\n        ~ pool: \"4\" → \"8\"\n"; text.String() != want {
+		t.Errorf("Unexpected text:\n%s", text.String())
+	}
+}
@@ -0,0 +1,238 @@
+// Package directory talks to LDAP servers directly, without NSX Manager, so
+// that bind credentials and certificates can be checked before they are
+// pushed to an identity source.
+package directory
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// DefaultTimeout bounds each step of a test.
+const DefaultTimeout = 10 * time.Second
+
+// Steps of a test, reported by TestError
+const (
+	StepConnect = "connect"
+	StepBind    = "bind"
+	StepSearch  = "search"
+)
+
+// TestOptions configures Test.
+type TestOptions struct {
+	URL      string // ldap:// or ldaps://
+	StartTLS bool   // upgrade an ldap:// connection with StartTLS
+	BindDN   string // empty binds anonymously
+	Password string
+	// BaseDN is searched with base scope; empty searches the
+	// defaultNamingContext of the server
+	BaseDN string
+	// Certificates are the PEM certificates the server is trusted by, as
+	// configured on the NSX identity source: its own certificate or a CA of
+	// its chain. Empty trusts the system roots.
+	Certificates []string
+	Timeout      time.Duration // per step; 0 means DefaultTimeout
+}
+
+// TestResult is what a test found out about a server.
+type TestResult struct {
+	URL        string       `json:"url"`
+	TLSVersion string       `json:"tls_version,omitempty"` // empty for plain LDAP
+	PeerCert   *Certificate `json:"peer_certificate,omitempty"`
+	BindDN     string       `json:"bind_dn,omitempty"` // empty for an anonymous bind
+	BaseDN     string       `json:"base_dn,omitempty"`
+	Entries    int          `json:"entries"`
+}
+
+// Certificate describes the certificate a server presented.
+type Certificate struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// TestError reports the step of a test that failed.
+type TestError struct {
+	Step string
+	Err  error
+}
+
+func (e *TestError) Error() string {
+	return fmt.Sprintf("%s failed: %v", e.Step, e.Err)
+}
+
+func (e *TestError) Unwrap() error {
+	return e.Err
+}
+
+// Test connects to opts.URL, binds and runs a base search, as NSX Manager
+// does with an identity source. The result holds what was learnt up to a
+// failure, which is returned as *TestError.
+func Test(ctx context.Context, opts TestOptions) (*TestResult, error) {
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	result := &TestResult{URL: opts.URL}
+
+	tlsConfig, err := tlsConfigFor(opts.URL, opts.Certificates)
+	if err != nil {
+		return result, &TestError{Step: StepConnect, Err: err}
+	}
+	conn, err := ldap.DialURL(opts.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return result, &TestError{Step: StepConnect, Err: err}
+	}
+	defer func() { _ = conn.Close() }()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	conn.SetTimeout(timeout)
+
+	if opts.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			return result, &TestError{Step: StepConnect, Err: fmt.Errorf("StartTLS: %w", err)}
+		}
+	}
+	if state, ok := conn.TLSConnectionState(); ok {
+		result.TLSVersion = tls.VersionName(state.Version)
+		if len(state.PeerCertificates) > 0 {
+			leaf := state.PeerCertificates[0]
+			result.PeerCert = &Certificate{Subject: leaf.Subject.String(), Issuer: leaf.Issuer.String(), NotAfter: leaf.NotAfter}
+		}
+	}
+
+	if opts.BindDN != "" {
+		if err := conn.Bind(opts.BindDN, opts.Password); err != nil {
+			return result, &TestError{Step: StepBind, Err: err}
+		}
+		result.BindDN = opts.BindDN
+	}
+
+	result.BaseDN = opts.BaseDN
+	if result.BaseDN == "" {
+		if result.BaseDN, err = defaultNamingContext(conn); err != nil {
+			return result, &TestError{Step: StepSearch, Err: err}
+		}
+	}
+	search := ldap.NewSearchRequest(result.BaseDN, ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+		0, int(timeout.Seconds()), false, "(objectClass=*)", []string{"objectClass"}, nil)
+	found, err := conn.Search(search)
+	if err != nil {
+		return result, &TestError{Step: StepSearch, Err: err}
+	}
+	result.Entries = len(found.Entries)
+	return result, nil
+}
+
+// defaultNamingContext reads the default naming context from the root DSE.
+func defaultNamingContext(conn *ldap.Conn) (string, error) {
+	search := ldap.NewSearchRequest("", ldap.ScopeBaseObject, ldap.NeverDerefAliases,
+		0, 0, false, "(objectClass=*)", []string{"defaultNamingContext"}, nil)
+	found, err := conn.Search(search)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the root DSE: %w", err)
+	}
+	if len(found.Entries) == 0 || found.Entries[0].GetAttributeValue("defaultNamingContext") == "" {
+		return "", errors.New("server has no defaultNamingContext, set a base DN")
+	}
+	return found.Entries[0].GetAttributeValue("defaultNamingContext"), nil
+}
+
+// tlsConfigFor returns the TLS configuration of a connection to rawURL that
+// trusts certs, or the system roots if there are none.
+func tlsConfigFor(rawURL string, certs []string) (*tls.Config, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	config := &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	if len(certs) == 0 {
+		return config, nil
+	}
+
+	trusted, err := ParseCertificates(certs)
+	if err != nil {
+		return nil, err
+	}
+	config.InsecureSkipVerify = true //nolint:gosec // G402: verified by VerifyPeerCertificate against certs
+	config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		return verifyPinned(rawCerts, trusted, config.ServerName)
+	}
+	return config, nil
+}
+
+// verifyPinned accepts a server whose chain contains one of trusted, as NSX
+// Manager does, or whose chain verifies up to one of them for serverName.
+func verifyPinned(rawCerts [][]byte, trusted []*x509.Certificate, serverName string) error {
+	if len(rawCerts) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	chain := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("invalid server certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+
+	roots := x509.NewCertPool()
+	for _, t := range trusted {
+		for _, c := range chain {
+			if bytes.Equal(c.Raw, t.Raw) {
+				return nil
+			}
+		}
+		roots.AddCert(t)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{DNSName: serverName, Roots: roots, Intermediates: intermediates})
+	if err != nil {
+		return fmt.Errorf("certificate of %s is not trusted by the given certificates: %w", chain[0].Subject, err)
+	}
+	return nil
+}
+
+// ParseCertificates parses PEM certificates; each entry may hold several.
+func ParseCertificates(pems []string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, p := range pems {
+		rest := []byte(strings.TrimSpace(p))
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("invalid certificate: %w", err)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificates found")
+	}
+	return certs, nil
+}
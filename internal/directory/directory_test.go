@@ -0,0 +1,253 @@
+package directory_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+
+	"ldapmerge/internal/directory"
+)
+
+// LDAP protocol operations and result codes used by the fake server
+const (
+	opBindRequest   = 0
+	opBindResponse  = 1
+	opUnbindRequest = 2
+	opSearchRequest = 3
+	opSearchEntry   = 4
+	opSearchDone    = 5
+
+	resultSuccess            = 0
+	resultInvalidCredentials = 49
+)
+
+// selfSigned returns a TLS certificate for 127.0.0.1 and its PEM encoding.
+func selfSigned(t *testing.T) (tls.Certificate, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ad-01.example.lab"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return cert, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+// serveLDAPS runs an LDAPS server that accepts one bind DN and password and
+// answers base searches; it returns its URL.
+func serveLDAPS(t *testing.T, cert tls.Certificate, bindDN, password string) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(conn, bindDN, password)
+		}
+	}()
+	return "ldaps://" + ln.Addr().String()
+}
+
+func serveConn(conn net.Conn, bindDN, password string) {
+	defer func() { _ = conn.Close() }()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case opBindRequest:
+			code := resultSuccess
+			if op.Children[1].Value.(string) != bindDN || op.Children[2].Data.String() != password {
+				code = resultInvalidCredentials
+			}
+			_, _ = conn.Write(response(id, opBindResponse, code).Bytes())
+		case opSearchRequest:
+			base := op.Children[0].Value.(string)
+			entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchEntry, nil, "")
+			entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, base, ""))
+			attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+			if base == "" {
+				attrs.AppendChild(attribute("defaultNamingContext", "DC=example,DC=lab"))
+			} else {
+				attrs.AppendChild(attribute("objectClass", "domain"))
+			}
+			entry.AppendChild(attrs)
+			_, _ = conn.Write(message(id, entry).Bytes())
+			_, _ = conn.Write(response(id, opSearchDone, resultSuccess).Bytes())
+		case opUnbindRequest:
+			return
+		}
+	}
+}
+
+func message(id int64, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+	packet.AppendChild(op)
+	return packet
+}
+
+func response(id int64, tag ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return message(id, op)
+}
+
+func attribute(name, value string) *ber.Packet {
+	attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "")
+	attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+	values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+	values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, ""))
+	attr.AppendChild(values)
+	return attr
+}
+
+func TestTest(t *testing.T) {
+	cert, certPEM := selfSigned(t)
+	url := serveLDAPS(t, cert, "svc@example.lab", "s3cret")
+	ctx := context.Background()
+	opts := directory.TestOptions{
+		URL:          url,
+		BindDN:       "svc@example.lab",
+		Password:     "s3cret",
+		Certificates: []string{certPEM},
+		Timeout:      5 * time.Second,
+	}
+
+	result, err := directory.Test(ctx, opts)
+	if err != nil {
+		t.Fatalf("Test failed: %v", err)
+	}
+	if result.TLSVersion == "" || result.PeerCert == nil || result.PeerCert.Subject != "CN=ad-01.example.lab" {
+		t.Errorf("Expected TLS details of the server, got %+v", result)
+	}
+	if result.BindDN != "svc@example.lab" || result.BaseDN != "DC=example,DC=lab" || result.Entries != 1 {
+		t.Errorf("Expected a bind and a search of the default naming context, got %+v", result)
+	}
+
+	var testErr *directory.TestError
+	wrong := opts
+	wrong.Password = "wrong"
+	if _, err := directory.Test(ctx, wrong); !errors.As(err, &testErr) || testErr.Step != directory.StepBind {
+		t.Errorf("Expected a bind failure for a wrong password, got %v", err)
+	}
+
+	_, otherPEM := selfSigned(t)
+	untrusted := opts
+	untrusted.Certificates = []string{otherPEM}
+	if _, err := directory.Test(ctx, untrusted); !errors.As(err, &testErr) || testErr.Step != directory.StepConnect {
+		t.Errorf("Expected a connect failure for an untrusted certificate, got %v", err)
+	}
+}
+
+// fakeResolver answers SRV lookups from a map of names to records.
+type fakeResolver map[string][]*net.SRV
+
+func (r fakeResolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	cname := "_" + service + "._" + proto + "." + name
+	records, ok := r[cname]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: cname, IsNotFound: true}
+	}
+	return cname, records, nil
+}
+
+func TestDiscover(t *testing.T) {
+	resolver := fakeResolver{"_ldap._tcp.example.lab": {
+		{Target: "ad-02.example.lab.", Port: 389, Priority: 0, Weight: 100},
+		{Target: "DR-01.Example.lab.", Port: 389, Priority: 10, Weight: 100},
+		{Target: "ad-01.example.lab.", Port: 389, Priority: 0, Weight: 100},
+		{Target: "ad-01.example.lab.", Port: 389, Priority: 0, Weight: 100},
+	}}
+
+	controllers, err := directory.Discover(context.Background(), resolver, "example.lab.")
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	var hosts []string
+	for _, c := range controllers {
+		hosts = append(hosts, c.Host)
+	}
+	if want := []string{"ad-01.example.lab", "ad-02.example.lab", "dr-01.example.lab"}; !slices.Equal(hosts, want) {
+		t.Errorf("Expected %v, got %v", want, hosts)
+	}
+
+	domain := directory.Scaffold("Example.lab", controllers)
+	if domain.ID != "example.lab" || domain.BaseDN != "DC=example,DC=lab" || len(domain.LDAPServers) != 3 {
+		t.Errorf("Unexpected scaffold %+v", domain)
+	}
+	if got := domain.LDAPServers[0]; got.URL != "ldaps://ad-01.example.lab:636" || got.StartTLS != "false" || got.Enabled != "true" {
+		t.Errorf("Unexpected server %+v", got)
+	}
+
+	if _, err := directory.Discover(context.Background(), resolver, "other.lab"); err == nil {
+		t.Error("Expected error for a domain without SRV records")
+	}
+}
+
+func TestNewSource(t *testing.T) {
+	source, err := directory.NewSource(directory.SourceOptions{
+		Domain:       "Example.lab",
+		Servers:      []string{"ldap://dc1.example.lab", "ldap://dc2.example.lab:389"},
+		StartTLS:     true,
+		BindUsername: "sync@example.lab",
+	})
+	if err != nil {
+		t.Fatalf("NewSource failed: %v", err)
+	}
+	if source.ID != "example.lab" || source.BaseDN != "DC=example,DC=lab" || source.AlternativeDomainNames == nil {
+		t.Errorf("Unexpected source %+v", source)
+	}
+	if got := source.LDAPServers[1]; got.URL != "ldap://dc2.example.lab:389" || got.StartTLS != "true" || got.BindUsername != "sync@example.lab" {
+		t.Errorf("Unexpected server %+v", got)
+	}
+
+	invalid := map[string]directory.SourceOptions{
+		"no domain":          {Servers: []string{"ldaps://dc1"}},
+		"bad base DN":        {Domain: "example.lab", BaseDN: "example", Servers: []string{"ldaps://dc1"}},
+		"bad scheme":         {Domain: "example.lab", Servers: []string{"https://dc1"}},
+		"duplicate server":   {Domain: "example.lab", Servers: []string{"ldaps://dc1", "LDAPS://DC1:636"}},
+		"StartTLS on ldaps:": {Domain: "example.lab", Servers: []string{"ldaps://dc1"}, StartTLS: true},
+	}
+	for name, opts := range invalid {
+		if _, err := directory.NewSource(opts); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
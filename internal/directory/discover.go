@@ -0,0 +1,179 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+)
+
+// LDAPSPort is the port of the ldaps:// URLs Scaffold builds.
+const LDAPSPort = 636
+
+// Resolver looks up SRV records; *net.Resolver implements it.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// Controller is a domain controller found by Discover.
+type Controller struct {
+	Host     string `json:"host"`
+	Port     uint16 `json:"port"`
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+}
+
+// NewResolver returns a resolver that queries server (host or host:port), or
+// the system resolver if server is empty.
+func NewResolver(server string) Resolver {
+	if server == "" {
+		return net.DefaultResolver
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// Discover resolves the _ldap._tcp SRV records of domain, as Active
+// Directory publishes them for its domain controllers, ordered by priority
+// and then by descending weight and host name.
+func Discover(ctx context.Context, resolver Resolver, domain string) ([]Controller, error) {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	if domain == "" {
+		return nil, errors.New("domain is required")
+	}
+
+	_, records, err := resolver.LookupSRV(ctx, "ldap", "tcp", domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve _ldap._tcp.%s: %w", domain, err)
+	}
+
+	controllers := make([]Controller, 0, len(records))
+	for _, r := range records {
+		host := strings.ToLower(strings.TrimSuffix(r.Target, "."))
+		// A single "." target means the service is not available
+		if host == "" {
+			continue
+		}
+		controllers = append(controllers, Controller{Host: host, Port: r.Port, Priority: r.Priority, Weight: r.Weight})
+	}
+	if len(controllers) == 0 {
+		return nil, fmt.Errorf("no domain controllers in _ldap._tcp.%s", domain)
+	}
+
+	slices.SortFunc(controllers, func(a, b Controller) int {
+		if a.Priority != b.Priority {
+			return int(a.Priority) - int(b.Priority)
+		}
+		if a.Weight != b.Weight {
+			return int(b.Weight) - int(a.Weight)
+		}
+		return strings.Compare(a.Host, b.Host)
+	})
+	return slices.CompactFunc(controllers, func(a, b Controller) bool {
+		return a.Host == b.Host
+	}), nil
+}
+
+// Scaffold returns an initial domain for a new identity source of domain
+// with an ldaps:// server per controller. Certificates and bind credentials
+// are left to fill in, as by a merge.
+func Scaffold(domain string, controllers []Controller) models.Domain {
+	opts := SourceOptions{Domain: domain}
+	for _, c := range controllers {
+		opts.Servers = append(opts.Servers, "ldaps://"+net.JoinHostPort(c.Host, strconv.Itoa(LDAPSPort)))
+	}
+	source, _ := NewSource(opts) // controller host names always make valid URLs
+	return source
+}
+
+// SourceOptions describes a new identity source for NewSource.
+type SourceOptions struct {
+	Domain                 string
+	BaseDN                 string // empty derives it from Domain
+	AlternativeDomainNames []string
+	Servers                []string // ldap:// or ldaps:// URLs
+	StartTLS               bool     // for the ldap:// servers
+	BindUsername           string
+	DisplayName            string
+	Description            string
+}
+
+// NewSource returns the initial domain of a new identity source, checking
+// what NSX Manager would reject: a missing domain, server URLs that are not
+// ldap:// or ldaps:// or appear twice, and StartTLS on an ldaps:// server.
+func NewSource(opts SourceOptions) (models.Domain, error) {
+	domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(opts.Domain), "."))
+	if domain == "" {
+		return models.Domain{}, errors.New("domain is required")
+	}
+	baseDN := opts.BaseDN
+	if baseDN == "" {
+		baseDN = BaseDN(domain)
+	}
+	if _, err := ldap.ParseDN(baseDN); err != nil {
+		return models.Domain{}, fmt.Errorf("invalid base DN %q: %w", baseDN, err)
+	}
+
+	source := models.Domain{
+		ID:                     domain,
+		DomainName:             domain,
+		BaseDN:                 baseDN,
+		AlternativeDomainNames: []string{},
+		LDAPServers:            make([]models.LDAPServer, 0, len(opts.Servers)),
+		DisplayName:            opts.DisplayName,
+		Description:            opts.Description,
+	}
+	for _, name := range opts.AlternativeDomainNames {
+		source.AlternativeDomainNames = append(source.AlternativeDomainNames, strings.ToLower(name))
+	}
+
+	seen := make(map[string]bool)
+	for _, rawURL := range opts.Servers {
+		u, err := url.Parse(strings.TrimSpace(rawURL))
+		if err != nil || u.Hostname() == "" || (u.Scheme != "ldap" && u.Scheme != "ldaps") {
+			return models.Domain{}, fmt.Errorf("invalid LDAP server URL %q: want ldap://host[:port] or ldaps://host[:port]", rawURL)
+		}
+		if opts.StartTLS && u.Scheme == "ldaps" {
+			return models.Domain{}, fmt.Errorf("StartTLS needs an ldap:// URL, not %s", rawURL)
+		}
+		key := merger.NormalizeURL(u.String())
+		if seen[key] {
+			return models.Domain{}, fmt.Errorf("duplicate LDAP server URL %s", rawURL)
+		}
+		seen[key] = true
+
+		source.LDAPServers = append(source.LDAPServers, models.LDAPServer{
+			URL:          u.String(),
+			StartTLS:     strconv.FormatBool(opts.StartTLS),
+			Enabled:      "true",
+			BindUsername: opts.BindUsername,
+		})
+	}
+	return source, nil
+}
+
+// BaseDN returns the DC= base DN of a DNS domain name.
+func BaseDN(domain string) string {
+	labels := strings.Split(strings.TrimSuffix(domain, "."), ".")
+	for i, label := range labels {
+		labels[i] = "DC=" + label
+	}
+	return strings.Join(labels, ",")
+}
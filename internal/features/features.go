@@ -0,0 +1,83 @@
+// Package features gates optional subsystems, so that minimal deployments
+// can turn off surface area they do not use. Every feature is enabled
+// unless the "features:" section of the config file disables it.
+package features
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Feature is an optional subsystem.
+type Feature string
+
+const (
+	// Scheduler runs the scheduled probes (probes.interval), health
+	// snapshots (health.interval) and database maintenance
+	// (database.maintenance_interval) of the API server
+	Scheduler Feature = "scheduler"
+	// Webhooks posts audit events to audit.webhook_url
+	Webhooks Feature = "webhooks"
+	// WebUI serves the /status page and the /docs API reference
+	WebUI Feature = "web_ui"
+)
+
+// All lists the features.
+var All = []Feature{Scheduler, Webhooks, WebUI}
+
+// Set records which features are enabled; features not in it are enabled.
+type Set map[Feature]bool
+
+// Enabled reports whether f is enabled.
+func (s Set) Enabled(f Feature) bool {
+	enabled, ok := s[f]
+	return enabled || !ok
+}
+
+// Disabled returns the disabled features in the order of All.
+func (s Set) Disabled() []Feature {
+	var disabled []Feature
+	for _, f := range All {
+		if !s.Enabled(f) {
+			disabled = append(disabled, f)
+		}
+	}
+	return disabled
+}
+
+// Parse returns the set of a "features:" config section, which maps
+// feature names to booleans or boolean strings (as set by environment
+// variables). Unknown names are an error, so a typo does not leave a
+// feature on.
+func Parse(section map[string]any) (Set, error) {
+	s := make(Set, len(section))
+	for name, value := range section {
+		f := Feature(strings.ToLower(name))
+		if !slices.Contains(All, f) {
+			return nil, fmt.Errorf("unknown feature %q (valid: %s)", name, names())
+		}
+		switch v := value.(type) {
+		case bool:
+			s[f] = v
+		case string:
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q of feature %s: want true or false", v, name)
+			}
+			s[f] = enabled
+		default:
+			return nil, fmt.Errorf("invalid value %v of feature %s: want true or false", value, name)
+		}
+	}
+	return s, nil
+}
+
+func names() string {
+	all := make([]string, len(All))
+	for i, f := range All {
+		all[i] = string(f)
+	}
+	return strings.Join(all, ", ")
+}
@@ -0,0 +1,34 @@
+package features_test
+
+import (
+	"slices"
+	"testing"
+
+	"ldapmerge/internal/features"
+)
+
+func TestParse(t *testing.T) {
+	s, err := features.Parse(map[string]any{"scheduler": false, "WEB_UI": "false", "webhooks": "true"})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if s.Enabled(features.Scheduler) || s.Enabled(features.WebUI) || !s.Enabled(features.Webhooks) {
+		t.Errorf("Unexpected set %v", s)
+	}
+	if got := s.Disabled(); !slices.Equal(got, []features.Feature{features.Scheduler, features.WebUI}) {
+		t.Errorf("Expected scheduler and web_ui disabled, got %v", got)
+	}
+
+	var empty features.Set
+	for _, f := range features.All {
+		if !empty.Enabled(f) {
+			t.Errorf("Expected %s enabled by default", f)
+		}
+	}
+
+	for _, section := range []map[string]any{{"grpc": false}, {"scheduler": "off-ish"}, {"webhooks": 0}} {
+		if _, err := features.Parse(section); err == nil {
+			t.Errorf("Expected an error for %v", section)
+		}
+	}
+}
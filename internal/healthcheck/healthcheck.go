@@ -0,0 +1,156 @@
+// Package healthcheck periodically records snapshots of the health of the
+// API server: the state and size of the database and the reachability of
+// the NSX Manager of every saved configuration. Kept over time, they show
+// slow degradations a single health check misses, such as a growing
+// database or an NSX Manager that is intermittently unreachable.
+package healthcheck
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/repository"
+)
+
+// Options configures the recorder.
+type Options struct {
+	// Interval between snapshots
+	Interval time.Duration
+	// Timeout for each NSX request
+	Timeout time.Duration
+	// Retention is how long snapshots are kept; zero keeps them forever
+	Retention time.Duration
+	// Diagnostics configures the request ids and slow-call logging of the
+	// NSX clients
+	Diagnostics nsx.Diagnostics
+}
+
+// DefaultOptions returns the default recorder options.
+func DefaultOptions() Options {
+	return Options{
+		Interval:  5 * time.Minute,
+		Timeout:   30 * time.Second,
+		Retention: 30 * 24 * time.Hour,
+	}
+}
+
+// Recorder records health snapshots.
+type Recorder struct {
+	repo *repository.Repository
+	opts Options
+	log  *slog.Logger
+}
+
+// New creates a recorder writing to repo.
+func New(repo *repository.Repository, opts Options) *Recorder {
+	return &Recorder{
+		repo: repo,
+		opts: opts,
+		log:  slog.With("component", "healthcheck"),
+	}
+}
+
+// Run records a snapshot immediately and then every Interval until ctx is
+// canceled.
+func (r *Recorder) Run(ctx context.Context) {
+	r.log.Info("health snapshots started", "interval", r.opts.Interval)
+
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RecordOnce(ctx); err != nil && ctx.Err() == nil {
+			r.log.Error("failed to record health snapshot", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			r.log.Info("health snapshots stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RecordOnce takes and stores a single health snapshot, and prunes those
+// older than Retention. A failed database check is recorded in the
+// snapshot; storing it then usually fails too.
+func (r *Recorder) RecordOnce(ctx context.Context) (*models.HealthSnapshot, error) {
+	snapshot := &models.HealthSnapshot{
+		TakenAt: time.Now().UTC().Truncate(time.Second),
+		NSX:     []models.NSXSample{},
+	}
+
+	if err := r.repo.Ping(ctx); err != nil {
+		snapshot.Database.Error = err.Error()
+	} else {
+		snapshot.Database.OK = true
+		if info, err := r.repo.GetDBInfo(ctx); err == nil {
+			snapshot.Database.Size = info.Size
+			snapshot.Database.HistoryCount = info.HistoryCount
+		}
+		snapshot.NSX = r.checkManagers(ctx)
+	}
+
+	if err := r.repo.AddHealthSnapshot(ctx, snapshot); err != nil {
+		return nil, err
+	}
+
+	if r.opts.Retention > 0 {
+		pruned, err := r.repo.PruneHealthSnapshots(ctx, time.Now().Add(-r.opts.Retention))
+		if err != nil {
+			r.log.Error("failed to prune health snapshots", "error", err)
+		} else if pruned > 0 {
+			r.log.Debug("health snapshots pruned", "deleted", pruned)
+		}
+	}
+
+	r.log.Debug("health snapshot recorded", "snapshot_id", snapshot.ID, "db_size", snapshot.Database.Size, "configs_count", len(snapshot.NSX))
+	return snapshot, nil
+}
+
+// checkManagers checks that the NSX Manager of every saved configuration
+// lists its identity sources with the stored credentials.
+func (r *Recorder) checkManagers(ctx context.Context) []models.NSXSample {
+	configs, err := r.repo.ListConfigs(ctx)
+	if err != nil {
+		r.log.Error("failed to list NSX configurations", "error", err)
+		return []models.NSXSample{}
+	}
+
+	samples := make([]models.NSXSample, 0, len(configs))
+	for _, c := range configs {
+		sample := models.NSXSample{ConfigID: c.ID, Name: c.Name, Host: c.Host}
+
+		// ListConfigs omits passwords
+		config, err := r.repo.GetConfig(ctx, c.ID)
+		if err != nil {
+			sample.Error = err.Error()
+			samples = append(samples, sample)
+			continue
+		}
+
+		client := nsx.NewClient(nsx.ClientConfig{
+			Host:        config.Host,
+			Username:    config.Username,
+			Password:    config.Password,
+			Insecure:    config.Insecure,
+			Timeout:     r.opts.Timeout,
+			Diagnostics: r.opts.Diagnostics,
+		})
+		start := time.Now()
+		_, err = client.ListLDAPIdentitySources(ctx)
+		sample.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+		if err != nil {
+			sample.Error = err.Error()
+			r.log.Warn("NSX Manager unreachable", "config_id", config.ID, "nsx_host", config.Host, "error", err)
+		} else {
+			sample.Reachable = true
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
@@ -0,0 +1,62 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx/mock"
+	"ldapmerge/internal/repository"
+)
+
+func TestRecordOnce(t *testing.T) {
+	ctx := context.Background()
+
+	ts := httptest.NewServer(mock.NewServer())
+	defer ts.Close()
+
+	repo, err := repository.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	for _, c := range []models.NSXConfig{
+		{Name: "mock", Host: ts.URL, Username: "admin", Password: "secret"},
+		{Name: "wrong-password", Host: ts.URL, Username: "admin", Password: "wrong"},
+		{Name: "down", Host: "http://127.0.0.1:1", Username: "admin", Password: "secret"},
+	} {
+		if _, err := repo.SaveConfig(ctx, &c); err != nil {
+			t.Fatalf("SaveConfig failed: %v", err)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.Timeout = 5 * time.Second
+	snapshot, err := New(repo, opts).RecordOnce(ctx)
+	if err != nil {
+		t.Fatalf("RecordOnce failed: %v", err)
+	}
+	if !snapshot.Database.OK || snapshot.Database.Size == 0 {
+		t.Errorf("Expected a readable database with a size, got %+v", snapshot.Database)
+	}
+
+	reachable := map[string]bool{}
+	for _, sample := range snapshot.NSX {
+		reachable[sample.Name] = sample.Reachable
+		if !sample.Reachable && sample.Error == "" {
+			t.Errorf("Expected the error of unreachable %s", sample.Name)
+		}
+	}
+	if len(reachable) != 3 || !reachable["mock"] || reachable["wrong-password"] || reachable["down"] {
+		t.Errorf("Expected only mock reachable, got %v", reachable)
+	}
+
+	stored, err := repo.ListHealthSnapshots(ctx, time.Time{}, 10)
+	if err != nil || len(stored) != 1 || stored[0].ID != snapshot.ID || len(stored[0].NSX) != 3 {
+		t.Errorf("Expected the snapshot stored, got %+v, %v", stored, err)
+	}
+}
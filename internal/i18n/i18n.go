@@ -0,0 +1,119 @@
+// Package i18n holds the message catalogs of the CLI. Catalogs are JSON files
+// embedded from locales/, one per language, mapping message keys to
+// fmt format strings. English is the reference catalog and the fallback for
+// keys a translation lacks.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultLocale is used when no supported language is selected.
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+var (
+	catalogs = mustLoad()
+	current  atomic.Value // string
+)
+
+func init() {
+	current.Store(DefaultLocale)
+}
+
+func mustLoad() map[string]map[string]string {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	out := make(map[string]map[string]string, len(entries))
+	for _, e := range entries {
+		data, err := files.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: invalid catalog %s: %v", e.Name(), err))
+		}
+		out[strings.TrimSuffix(e.Name(), ".json")] = messages
+	}
+	return out
+}
+
+// Locales returns the languages that have a catalog, sorted.
+func Locales() []string {
+	out := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		out = append(out, locale)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Match returns the catalog language of a locale name such as "ru",
+// "ru-RU" or "ru_RU.UTF-8".
+func Match(name string) (string, bool) {
+	lang := strings.ToLower(name)
+	if i := strings.IndexAny(lang, "_-.@"); i >= 0 {
+		lang = lang[:i]
+	}
+	_, ok := catalogs[lang]
+	return lang, ok
+}
+
+// Detect returns the language of the POSIX locale environment: the first
+// of LC_ALL, LC_MESSAGES and LANG that is set decides. An unset or
+// unsupported locale, including C and POSIX, gives DefaultLocale.
+func Detect() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if name := os.Getenv(env); name != "" {
+			if lang, ok := Match(name); ok {
+				return lang
+			}
+			return DefaultLocale
+		}
+	}
+	return DefaultLocale
+}
+
+// SetLocale selects the language of the messages returned by T.
+func SetLocale(name string) error {
+	lang, ok := Match(name)
+	if !ok {
+		return fmt.Errorf("unsupported language %q (available: %s)", name, strings.Join(Locales(), ", "))
+	}
+	current.Store(lang)
+	return nil
+}
+
+// Locale returns the selected language.
+func Locale() string {
+	return current.Load().(string)
+}
+
+// T returns the message of key in the selected language, formatted with
+// args. A key missing from the catalog falls back to English, then to the
+// key itself.
+func T(key string, args ...any) string {
+	format, ok := catalogs[Locale()][key]
+	if !ok {
+		if format, ok = catalogs[DefaultLocale][key]; !ok {
+			format = key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,96 @@
+package i18n
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+)
+
+var verbRe = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestCatalogsComplete(t *testing.T) {
+	reference := catalogs[DefaultLocale]
+	if len(reference) == 0 {
+		t.Fatal("Expected a non-empty English catalog")
+	}
+
+	for _, locale := range Locales() {
+		for key, format := range catalogs[locale] {
+			want, ok := reference[key]
+			if !ok {
+				t.Errorf("%s: key %q is not in the English catalog", locale, key)
+				continue
+			}
+			if got, want := verbRe.FindAllString(format, -1), verbRe.FindAllString(want, -1); !slices.Equal(got, want) {
+				t.Errorf("%s: %q has verbs %v; expected %v", locale, key, got, want)
+			}
+		}
+		for key := range reference {
+			if _, ok := catalogs[locale][key]; !ok {
+				t.Errorf("%s: missing key %q", locale, key)
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for name, want := range map[string]string{
+		"ru":          "ru",
+		"ru_RU.UTF-8": "ru",
+		"ru-RU":       "ru",
+		"EN_US":       "en",
+		"en@euro":     "en",
+	} {
+		if got, ok := Match(name); !ok || got != want {
+			t.Errorf("Match(%q) = %q, %t; expected %q", name, got, ok, want)
+		}
+	}
+	for _, name := range []string{"", "C", "POSIX", "de_DE.UTF-8"} {
+		if _, ok := Match(name); ok {
+			t.Errorf("Match(%q) succeeded; expected no catalog", name)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	t.Setenv("LANG", "ru_RU.UTF-8")
+	if got := Detect(); got != "ru" {
+		t.Errorf("Expected ru from LANG, got %q", got)
+	}
+
+	t.Setenv("LC_MESSAGES", "C")
+	if got := Detect(); got != DefaultLocale {
+		t.Errorf("Expected LC_MESSAGES=C to override LANG, got %q", got)
+	}
+
+	t.Setenv("LC_ALL", "ru_RU.UTF-8")
+	if got := Detect(); got != "ru" {
+		t.Errorf("Expected LC_ALL to override LC_MESSAGES, got %q", got)
+	}
+}
+
+func TestT(t *testing.T) {
+	defer func(locale string) { _ = SetLocale(locale) }(Locale())
+
+	if err := SetLocale("ru_RU.UTF-8"); err != nil {
+		t.Fatal(err)
+	}
+	if got := T("sync.fetched", 3); got != "  ✓ Получено источников LDAP: 3" {
+		t.Errorf("Unexpected Russian message %q", got)
+	}
+
+	defer func(m map[string]string) { catalogs["ru"] = m }(catalogs["ru"])
+	catalogs["ru"] = nil
+	if got := T("sync.fetched", 3); got != "  ✓ Fetched 3 LDAP identity sources" {
+		t.Errorf("Expected English fallback, got %q", got)
+	}
+	if got := T("no.such.key"); got != "no.such.key" {
+		t.Errorf("Expected the key for an unknown message, got %q", got)
+	}
+
+	if err := SetLocale("de"); err == nil {
+		t.Error("Expected error for a language without a catalog")
+	}
+}
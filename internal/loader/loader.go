@@ -0,0 +1,172 @@
+// Package loader opens input documents by location: a local path, "-" for
+// stdin, or a URL whose scheme has a registered Loader (file, http and https
+// are built in; s3 is registered by the CLI from the artifacts config).
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StdinLocation is the location that reads from standard input.
+const StdinLocation = "-"
+
+// ErrUnsupportedScheme is returned for locations whose scheme has no loader.
+var ErrUnsupportedScheme = errors.New("unsupported location scheme")
+
+// Stdin is read for StdinLocation; tests replace it.
+var Stdin io.Reader = os.Stdin
+
+// Loader opens the document at a URL of the scheme it is registered for.
+type Loader interface {
+	Open(ctx context.Context, u *url.URL) (io.ReadCloser, error)
+}
+
+// Func adapts a function to the Loader interface.
+type Func func(ctx context.Context, u *url.URL) (io.ReadCloser, error)
+
+// Open implements Loader.
+func (f Func) Open(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+	return f(ctx, u)
+}
+
+var (
+	mu      sync.RWMutex
+	loaders = map[string]Loader{
+		"file":  Func(openFile),
+		"http":  HTTP(nil),
+		"https": HTTP(nil),
+	}
+)
+
+// Register makes l the loader for scheme, replacing any previous one.
+func Register(scheme string, l Loader) {
+	mu.Lock()
+	defer mu.Unlock()
+	loaders[strings.ToLower(scheme)] = l
+}
+
+// Schemes returns the registered schemes, sorted.
+func Schemes() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	schemes := make([]string, 0, len(loaders))
+	for scheme := range loaders {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Scheme returns the scheme of location: "stdin" for "-", "file" for plain
+// paths, otherwise the lower-cased URL scheme.
+func Scheme(location string) string {
+	if location == StdinLocation {
+		return "stdin"
+	}
+	scheme, _, ok := strings.Cut(location, "://")
+	if !ok {
+		return "file"
+	}
+	return strings.ToLower(scheme)
+}
+
+// Open opens the document at location. Reads from the returned reader fail
+// once ctx is canceled.
+func Open(ctx context.Context, location string) (io.ReadCloser, error) {
+	if location == "" {
+		return nil, errors.New("empty location")
+	}
+
+	var (
+		rc  io.ReadCloser
+		err error
+	)
+	switch scheme := Scheme(location); scheme {
+	case "stdin":
+		rc = io.NopCloser(Stdin)
+	case "file":
+		if !strings.Contains(location, "://") {
+			rc, err = os.Open(location)
+			break
+		}
+		fallthrough
+	default:
+		var u *url.URL
+		if u, err = url.Parse(location); err != nil {
+			return nil, fmt.Errorf("invalid location %q: %w", location, err)
+		}
+
+		mu.RLock()
+		l, ok := loaders[scheme]
+		mu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("%w %q (supported: %s, or - for stdin)", ErrUnsupportedScheme, scheme, strings.Join(Schemes(), ", "))
+		}
+		rc, err = l.Open(ctx, u)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &contextReader{ctx: ctx, rc: rc}, nil
+}
+
+func openFile(_ context.Context, u *url.URL) (io.ReadCloser, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("file URL with remote host %q is not supported", u.Host)
+	}
+	return os.Open(u.Path)
+}
+
+// HTTP returns a loader that GETs http and https URLs with client; a nil
+// client uses a default one with a 60s timeout.
+func HTTP(client *http.Client) Loader {
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+	return Func(func(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("GET %s: unexpected status %s", u.Redacted(), resp.Status)
+		}
+		return resp.Body, nil
+	})
+}
+
+// contextReader fails reads once ctx is canceled.
+type contextReader struct {
+	ctx context.Context
+	rc  io.ReadCloser
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.rc.Read(p)
+}
+
+func (r *contextReader) Close() error {
+	return r.rc.Close()
+}
@@ -0,0 +1,144 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ldapmerge/internal/artifacts"
+)
+
+func readAll(t *testing.T, location string) string {
+	t.Helper()
+
+	r, err := Open(context.Background(), location)
+	if err != nil {
+		t.Fatalf("Open(%q) failed: %v", location, err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Read %q failed: %v", location, err)
+	}
+	return string(data)
+}
+
+func TestOpenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "initial.json")
+	if err := os.WriteFile(path, []byte("[]"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readAll(t, path); got != "[]" {
+		t.Errorf("Expected [] from path, got %q", got)
+	}
+	if got := readAll(t, "file://"+path); got != "[]" {
+		t.Errorf("Expected [] from file URL, got %q", got)
+	}
+	if _, err := Open(context.Background(), "file://remote"+path); err == nil {
+		t.Error("Expected error for a file URL with a remote host")
+	}
+}
+
+func TestOpenStdin(t *testing.T) {
+	defer func(r io.Reader) { Stdin = r }(Stdin)
+	Stdin = strings.NewReader(`{"results": []}`)
+
+	if got := readAll(t, StdinLocation); got != `{"results": []}` {
+		t.Errorf("Expected stdin content, got %q", got)
+	}
+}
+
+func TestOpenHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/response.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"results": []}`))
+	}))
+	defer srv.Close()
+
+	if got := readAll(t, srv.URL+"/response.json"); got != `{"results": []}` {
+		t.Errorf("Expected response body, got %q", got)
+	}
+	if _, err := Open(context.Background(), srv.URL+"/missing.json"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected 404 error, got %v", err)
+	}
+}
+
+func TestOpenS3(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/artifacts/prod/initial.json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	t.Cleanup(func() { delete(loaders, "s3") })
+	Register("s3", S3(artifacts.S3Config{Endpoint: srv.URL, Bucket: "ignored", Prefix: "ignored/", AccessKey: "key", SecretKey: "secret"}))
+
+	if got := readAll(t, "s3://artifacts/prod/initial.json"); got != "[]" {
+		t.Errorf("Expected object content, got %q", got)
+	}
+	if _, err := Open(context.Background(), "s3://artifacts/prod/missing.json"); !errors.Is(err, artifacts.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := Open(context.Background(), "s3://artifacts"); err == nil {
+		t.Error("Expected error for an S3 location without a key")
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	if _, err := Open(context.Background(), "ftp://host/initial.json"); !errors.Is(err, ErrUnsupportedScheme) {
+		t.Errorf("Expected ErrUnsupportedScheme, got %v", err)
+	}
+	if _, err := Open(context.Background(), ""); err == nil {
+		t.Error("Expected error for an empty location")
+	}
+
+	path := filepath.Join(t.TempDir(), "initial.json")
+	if err := os.WriteFile(path, []byte("[]"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := Open(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	cancel()
+	if _, err := io.ReadAll(r); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestScheme(t *testing.T) {
+	for location, want := range map[string]string{
+		"-":                      "stdin",
+		"initial.json":           "file",
+		"/data/initial.json":     "file",
+		"file:///initial.json":   "file",
+		"HTTPS://host/a.json":    "https",
+		"s3://bucket/a.json":     "s3",
+		`C:\data\initial.json`:   "file",
+		"./dir:with:colons.json": "file",
+	} {
+		if got := Scheme(location); got != want {
+			t.Errorf("Scheme(%q) = %q; expected %q", location, got, want)
+		}
+	}
+}
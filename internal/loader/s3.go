@@ -0,0 +1,46 @@
+package loader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"ldapmerge/internal/artifacts"
+)
+
+// S3 returns a loader for s3://bucket/key URLs. cfg supplies the endpoint,
+// region and credentials; its Bucket and Prefix are ignored. An empty
+// endpoint means AWS in cfg.Region.
+func S3(cfg artifacts.S3Config) Loader {
+	if cfg.Endpoint == "" {
+		region := cfg.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		cfg.Endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+
+	return Func(func(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
+		key := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || key == "" {
+			return nil, fmt.Errorf("invalid S3 location %q: expected s3://bucket/key", u.Redacted())
+		}
+
+		c := cfg
+		c.Bucket = u.Host
+		c.Prefix = ""
+		store, err := artifacts.NewS3(c)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := store.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+}
@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"ldapmerge/internal/runid"
+)
+
+// debugKey is the context key of WithDebug.
+type debugKey struct{}
+
+// WithDebug returns ctx with logging elevated to debug level: records
+// logged with it pass whatever the configured level and carry id as
+// debug_request, so that a single request can be traced without changing
+// the level of the whole process.
+func WithDebug(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, debugKey{}, id)
+}
+
+// DebugID returns the id WithDebug set on ctx, if any.
+func DebugID(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(debugKey{}).(string)
+	return id, ok
+}
+
+// attrsKey is the context key of WithAttrs.
+type attrsKey struct{}
+
+// WithAttrs returns ctx with attrs added to the records logged with it,
+// after those added before, such as the identity of an API client.
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev := Attrs(ctx)
+	return context.WithValue(ctx, attrsKey{}, append(prev[:len(prev):len(prev)], attrs...))
+}
+
+// Attrs returns the attributes WithAttrs set on ctx.
+func Attrs(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// contextHandler lets the records of a context marked by WithDebug through
+// at debug level and adds the run ID and the WithAttrs attributes of the
+// context to them.
+type contextHandler struct {
+	slog.Handler
+	// keys were added with WithAttrs, as by RunLogger: the attributes of
+	// the context with the same keys would repeat them
+	keys map[string]bool
+}
+
+// NewContextHandler wraps h so that it honours WithDebug and logs the run ID
+// of the context (see runid) as run_id, and the attributes of WithAttrs.
+func NewContextHandler(h slog.Handler) slog.Handler {
+	return &contextHandler{Handler: h}
+}
+
+// RunLogger returns the default logger with the run ID and the WithAttrs
+// attributes of ctx, if any, for code that logs without passing the
+// context.
+func RunLogger(ctx context.Context) *slog.Logger {
+	var args []any
+	if id, ok := runid.From(ctx); ok {
+		args = append(args, slog.String(KeyRunID, id))
+	}
+	for _, attr := range Attrs(ctx) {
+		args = append(args, attr)
+	}
+	if len(args) == 0 {
+		return slog.Default()
+	}
+	return slog.Default().With(args...)
+}
+
+func (h *contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	if _, ok := DebugID(ctx); ok && level >= slog.LevelDebug {
+		return true
+	}
+	return h.Handler.Enabled(ctx, level)
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	var attrs []slog.Attr
+	if run, ok := runid.From(ctx); ok && !h.keys[KeyRunID] {
+		attrs = append(attrs, slog.String(KeyRunID, run))
+	}
+	for _, attr := range Attrs(ctx) {
+		if !h.keys[attr.Key] {
+			attrs = append(attrs, attr)
+		}
+	}
+	if id, ok := DebugID(ctx); ok {
+		attrs = append(attrs, slog.String(KeyDebugRequest, id))
+	}
+	if len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	keys := make(map[string]bool, len(h.keys)+len(attrs))
+	for k := range h.keys {
+		keys[k] = true
+	}
+	for _, attr := range attrs {
+		keys[attr.Key] = true
+	}
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs), keys: keys}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name), keys: h.keys}
+}
@@ -1,18 +1,22 @@
 package logging
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 
 	"gopkg.in/natefinch/lumberjack.v2"
+
+	"ldapmerge/internal/paths"
 )
 
 // Config holds logging configuration.
 type Config struct {
 	// File settings
-	LogDir     string // Directory for log files (default: executable directory)
+	LogDir     string // Directory for log files (default: ldapmerge/logs in the user cache directory)
 	LogFile    string // Log file name (default: ldapmerge.log)
 	MaxSize    int    // Max size in MB before rotation (default: 100)
 	MaxBackups int    // Max number of old log files (default: 5)
@@ -20,34 +24,53 @@ type Config struct {
 	Compress   bool   // Compress rotated files (default: true)
 
 	// Output settings
-	Level      slog.Level // Log level (default: Info)
-	JSONFormat bool       // Use JSON format (default: true for file)
-	Console    bool       // Also output to console (default: false)
+	Level         slog.Level // Log level (default: Info)
+	JSONFormat    bool       // Use JSON format (default: true for file)
+	Console       bool       // Also output to stdout (default: false)
+	ConsoleFormat string     // Format of the console output: FormatJSON (default) or FormatText
+
+	// Sinks ship the log to Loki or Elasticsearch besides the file
+	Sinks []SinkConfig
 }
 
+// Formats of the console output.
+const (
+	// FormatJSON writes records as JSON lines, as in the log file
+	FormatJSON = "json"
+	// FormatText writes records as key=value lines
+	FormatText = "text"
+)
+
 // DefaultConfig returns default logging configuration.
 func DefaultConfig() Config {
 	return Config{
-		LogDir:     "",
-		LogFile:    "ldapmerge.log",
-		MaxSize:    100, // 100 MB
-		MaxBackups: 5,
-		MaxAge:     30, // 30 days
-		Compress:   true,
-		Level:      slog.LevelInfo,
-		JSONFormat: true,
-		Console:    false,
+		LogDir:        "",
+		LogFile:       "ldapmerge.log",
+		MaxSize:       100, // 100 MB
+		MaxBackups:    5,
+		MaxAge:        30, // 30 days
+		Compress:      true,
+		Level:         slog.LevelInfo,
+		JSONFormat:    true,
+		Console:       false,
+		ConsoleFormat: FormatJSON,
 	}
 }
 
 // Logger wraps slog.Logger with additional functionality.
 type Logger struct {
 	*slog.Logger
-	lj *lumberjack.Logger
+	lj    *lumberjack.Logger
+	sinks []*Sink
+	level *slog.LevelVar
 }
 
 // New creates a new logger with the given configuration.
 func New(cfg Config) (*Logger, error) {
+	if cfg.ConsoleFormat != "" && cfg.ConsoleFormat != FormatJSON && cfg.ConsoleFormat != FormatText {
+		return nil, fmt.Errorf("invalid log format %q: use %s or %s", cfg.ConsoleFormat, FormatJSON, FormatText)
+	}
+
 	logPath := getLogPath(cfg)
 
 	// Ensure log directory exists
@@ -66,15 +89,25 @@ func New(cfg Config) (*Logger, error) {
 		LocalTime:  true,
 	}
 
-	var writer io.Writer = lj
-	if cfg.Console {
-		writer = io.MultiWriter(lj, os.Stdout)
+	writers := []io.Writer{lj}
+	var sinks []*Sink
+	for _, sc := range cfg.Sinks {
+		sink, err := NewSink(sc)
+		if err != nil {
+			_ = closeSinks(sinks)
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+		writers = append(writers, sink)
 	}
+	writer := io.MultiWriter(writers...)
 
 	// Create handler based on format preference
 	var handler slog.Handler
+	level := new(slog.LevelVar)
+	level.Set(cfg.Level)
 	opts := &slog.HandlerOptions{
-		Level: cfg.Level,
+		Level: level,
 	}
 
 	if cfg.JSONFormat {
@@ -83,20 +116,41 @@ func New(cfg Config) (*Logger, error) {
 		handler = slog.NewTextHandler(writer, opts)
 	}
 
-	logger := slog.New(handler)
+	// The console gets its own handler, so that its format can differ from
+	// that of the file and sinks, which stay JSON for logs query and the
+	// log stacks.
+	if cfg.Console {
+		console := slog.Handler(slog.NewJSONHandler(os.Stdout, opts))
+		if cfg.ConsoleFormat == FormatText {
+			console = slog.NewTextHandler(os.Stdout, opts)
+		}
+		handler = teeHandler{handler, console}
+	}
+
+	logger := slog.New(NewContextHandler(handler))
 
 	return &Logger{
 		Logger: logger,
 		lj:     lj,
+		sinks:  sinks,
+		level:  level,
 	}, nil
 }
 
-// Close closes the underlying log file.
+// Level returns the level of the records the logger writes; setting it
+// changes the level of the running logger.
+func (l *Logger) Level() *slog.LevelVar {
+	return l.level
+}
+
+// Close flushes the sinks and closes the underlying log file.
 func (l *Logger) Close() error {
+	err := closeSinks(l.sinks)
+	l.sinks = nil
 	if l.lj != nil {
-		return l.lj.Close()
+		return errors.Join(err, l.lj.Close())
 	}
-	return nil
+	return err
 }
 
 // Rotate forces log rotation.
@@ -112,13 +166,12 @@ func getLogPath(cfg Config) string {
 	logDir := cfg.LogDir
 
 	if logDir == "" {
-		// Default: directory of executable
-		exe, err := os.Executable()
+		// Default: ldapmerge/logs in the user cache directory
+		dir, err := paths.LogDir()
 		if err != nil {
-			logDir = "."
-		} else {
-			logDir = filepath.Dir(exe)
+			dir = "."
 		}
+		logDir = dir
 	}
 
 	return filepath.Join(logDir, cfg.LogFile)
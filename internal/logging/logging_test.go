@@ -0,0 +1,115 @@
+package logging_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ldapmerge/internal/logging"
+)
+
+func TestConsoleFormat(t *testing.T) {
+	for _, format := range []string{logging.FormatJSON, logging.FormatText} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+
+			// The console handler writes to the os.Stdout of New
+			stdout, err := os.Create(filepath.Join(dir, "stdout"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved := os.Stdout
+			os.Stdout = stdout
+			defer func() { os.Stdout = saved }()
+
+			cfg := logging.DefaultConfig()
+			cfg.LogDir = dir
+			cfg.Console = true
+			cfg.ConsoleFormat = format
+			logger, err := logging.New(cfg)
+			os.Stdout = saved
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			logger.With("command", "sync").Info("sync started", "dry_run", true)
+			if err := logger.Close(); err != nil {
+				t.Fatal(err)
+			}
+			_ = stdout.Close()
+
+			console, err := os.ReadFile(stdout.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			line := strings.TrimSpace(string(console))
+			var record map[string]any
+			if isJSON := json.Unmarshal([]byte(line), &record) == nil; isJSON != (format == logging.FormatJSON) {
+				t.Errorf("Unexpected %s console output: %s", format, line)
+			}
+			if format == logging.FormatText && !strings.Contains(line, `msg="sync started" command=sync dry_run=true`) {
+				t.Errorf("Unexpected text console output: %s", line)
+			}
+
+			// The log file stays JSON for logs query and the sinks
+			file, err := os.ReadFile(filepath.Join(dir, cfg.LogFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r, err := logging.ParseRecord([]byte(strings.TrimSpace(string(file)))); err != nil || r.Message != "sync started" {
+				t.Errorf("Expected a JSON log file, got %q (%v)", file, err)
+			}
+		})
+	}
+
+	cfg := logging.DefaultConfig()
+	cfg.LogDir = t.TempDir()
+	cfg.ConsoleFormat = "xml"
+	if _, err := logging.New(cfg); err == nil {
+		t.Error("Expected an unknown format to fail")
+	}
+}
+
+func TestConsoleDebugRequest(t *testing.T) {
+	dir := t.TempDir()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = stdout
+	defer func() { os.Stdout = saved }()
+
+	cfg := logging.DefaultConfig()
+	cfg.LogDir = dir
+	cfg.Console = true
+	logger, err := logging.New(cfg)
+	os.Stdout = saved
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// Debug records of a debug request pass the info level of the file and
+	// the console alike
+	logger.DebugContext(logging.WithDebug(context.Background(), "dbg-1"), "debug request")
+	logger.Debug("filtered")
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_ = stdout.Close()
+
+	for _, name := range []string{cfg.LogFile, "stdout"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), `"msg":"debug request"`) || !strings.Contains(string(data), `"debug_request":"dbg-1"`) {
+			t.Errorf("Expected the debug request record in %s, got %q", name, data)
+		}
+		if strings.Contains(string(data), "filtered") {
+			t.Errorf("Expected debug records of other requests filtered from %s, got %q", name, data)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package logging
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat is the rotation time in the names of rotated log files,
+// as lumberjack writes them: ldapmerge-2006-01-02T15-04-05.000.log[.gz].
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// LogFile is a log file, current or rotated.
+type LogFile struct {
+	Path string
+	// Rotated is when the file was rotated, the time of its last record;
+	// zero for the current file
+	Rotated time.Time
+}
+
+// Files returns the log file name in dir and its rotated backups, oldest
+// first. A missing current file is left out.
+func Files(dir, name string) ([]LogFile, error) {
+	ext := filepath.Ext(name)
+	prefix := strings.TrimSuffix(name, ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []LogFile
+	var current *LogFile
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if e.Name() == name {
+			current = &LogFile{Path: filepath.Join(dir, name)}
+			continue
+		}
+		stamp, ok := strings.CutPrefix(strings.TrimSuffix(e.Name(), ".gz"), prefix)
+		if !ok || !strings.HasSuffix(stamp, ext) {
+			continue
+		}
+		rotated, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(stamp, ext), time.Local)
+		if err != nil {
+			continue
+		}
+		files = append(files, LogFile{Path: filepath.Join(dir, e.Name()), Rotated: rotated})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Rotated.Before(files[j].Rotated) })
+	if current != nil {
+		files = append(files, *current)
+	}
+	return files, nil
+}
+
+// Query selects log records. Zero fields select every record.
+type Query struct {
+	Since time.Time
+	Until time.Time
+	// RunID selects the records of one run
+	RunID string
+	// Level is the lowest level selected
+	Level slog.Level
+	// Contains selects records whose message contains it
+	Contains string
+}
+
+// Match reports whether r is selected by q.
+func (q Query) Match(r Record) bool {
+	switch {
+	case !q.Since.IsZero() && r.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && r.Time.After(q.Until):
+		return false
+	case r.Level < q.Level:
+		return false
+	case q.RunID != "" && r.RunID() != q.RunID:
+		return false
+	case q.Contains != "" && !strings.Contains(r.Message, q.Contains):
+		return false
+	}
+	return true
+}
+
+// Read calls fn with the records of files matching q, in order. Files
+// rotated before q.Since are skipped, and so are lines that are not JSON
+// log records, such as those of the console format. It returns the number
+// of lines skipped that way.
+func (q Query) Read(files []LogFile, fn func(Record) error) (skipped int, err error) {
+	for _, f := range files {
+		if !f.Rotated.IsZero() && !q.Since.IsZero() && f.Rotated.Before(q.Since) {
+			continue
+		}
+		n, err := q.readFile(f.Path, fn)
+		skipped += n
+		if err != nil {
+			return skipped, err
+		}
+	}
+	return skipped, nil
+}
+
+func (q Query) readFile(path string, fn func(Record) error) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	}
+
+	skipped := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		record, err := ParseRecord(line)
+		if err != nil {
+			skipped++
+			continue
+		}
+		if !q.Match(record) {
+			continue
+		}
+		if err := fn(record); err != nil {
+			return skipped, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return skipped, fmt.Errorf("%s: %w", path, err)
+	}
+	return skipped, nil
+}
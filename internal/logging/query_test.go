@@ -0,0 +1,100 @@
+package logging_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/logging"
+)
+
+func TestParseRecord(t *testing.T) {
+	r, err := logging.ParseRecord([]byte(`{"time":"2026-10-16T12:00:00.5Z","level":"WARN","msg":"slow NSX call","run_id":"r1","duration_ms":1200,"ok":false}`))
+	if err != nil {
+		t.Fatalf("ParseRecord failed: %v", err)
+	}
+	if !r.Time.Equal(time.Date(2026, 10, 16, 12, 0, 0, 5e8, time.UTC)) || r.Level != slog.LevelWarn || r.Message != "slow NSX call" || r.RunID() != "r1" {
+		t.Errorf("Unexpected record %+v", r)
+	}
+	if len(r.Attrs) != 3 || r.Attrs[1].Key != "duration_ms" || r.Attrs[1].Value != json.Number("1200") || r.Attrs[2].Value != false {
+		t.Errorf("Expected the attributes in order, got %+v", r.Attrs)
+	}
+
+	for _, line := range []string{`time=2026-10-16T12:00:00Z level=INFO msg=x`, `{"msg":"no time"}`, `{"time":"yesterday","level":"INFO"}`, `[]`} {
+		if _, err := logging.ParseRecord([]byte(line)); err == nil {
+			t.Errorf("Expected an error for %s", line)
+		}
+	}
+}
+
+func TestQueryRead(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, gz bool, lines ...string) {
+		t.Helper()
+		var buf bytes.Buffer
+		for _, l := range lines {
+			buf.WriteString(l + "\n")
+		}
+		data := buf.Bytes()
+		if gz {
+			var z bytes.Buffer
+			w := gzip.NewWriter(&z)
+			_, _ = w.Write(data)
+			_ = w.Close()
+			data = z.Bytes()
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("ldapmerge-2026-10-14T10-00-00.000.log.gz", true,
+		`{"time":"2026-10-14T09:00:00Z","level":"ERROR","msg":"oldest","run_id":"a"}`)
+	write("ldapmerge-2026-10-15T10-00-00.000.log", false,
+		`{"time":"2026-10-15T09:00:00Z","level":"INFO","msg":"run started","run_id":"b"}`,
+		`not a record`,
+		`{"time":"2026-10-15T09:30:00Z","level":"ERROR","msg":"push failed","run_id":"b"}`)
+	write("ldapmerge.log", false,
+		`{"time":"2026-10-16T09:00:00Z","level":"DEBUG","msg":"newest","run_id":"c"}`)
+	write("other.log", false, `{"time":"2026-10-16T09:00:00Z","level":"ERROR","msg":"other"}`)
+
+	files, err := logging.Files(dir, "ldapmerge.log")
+	if err != nil {
+		t.Fatalf("Files failed: %v", err)
+	}
+	if len(files) != 3 || filepath.Base(files[2].Path) != "ldapmerge.log" || !files[2].Rotated.IsZero() || !files[0].Rotated.Before(files[1].Rotated) {
+		t.Fatalf("Expected the backups oldest first, then the current file, got %+v", files)
+	}
+
+	read := func(q logging.Query) ([]string, int) {
+		t.Helper()
+		var msgs []string
+		skipped, err := q.Read(files, func(r logging.Record) error {
+			msgs = append(msgs, r.Message)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		return msgs, skipped
+	}
+
+	if msgs, skipped := read(logging.Query{Level: slog.LevelDebug}); len(msgs) != 4 || msgs[0] != "oldest" || msgs[3] != "newest" || skipped != 1 {
+		t.Errorf("Expected every record in order and 1 skipped line, got %v, %d", msgs, skipped)
+	}
+	if msgs, _ := read(logging.Query{Level: slog.LevelError}); len(msgs) != 2 || msgs[1] != "push failed" {
+		t.Errorf("Expected the errors, got %v", msgs)
+	}
+	if msgs, _ := read(logging.Query{RunID: "b", Contains: "push"}); len(msgs) != 1 || msgs[0] != "push failed" {
+		t.Errorf("Expected the push failure of run b, got %v", msgs)
+	}
+	since := time.Date(2026, 10, 15, 9, 15, 0, 0, time.UTC)
+	until := time.Date(2026, 10, 15, 23, 0, 0, 0, time.UTC)
+	if msgs, _ := read(logging.Query{Since: since, Until: until}); len(msgs) != 1 || msgs[0] != "push failed" {
+		t.Errorf("Expected the records between %s and %s, got %v", since, until, msgs)
+	}
+}
@@ -0,0 +1,120 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// SchemaVersion is the version of the JSON log schema, logged as
+// log_schema by "application started". It changes when a key below is
+// renamed or changes meaning; keys may be added without a new version.
+const SchemaVersion = 1
+
+// Keys of the JSON log schema. Every record has time, level and msg; the
+// others are set where they apply.
+const (
+	// KeyTime is the time of the record, in RFC 3339 with nanoseconds
+	KeyTime = slog.TimeKey
+	// KeyLevel is DEBUG, INFO, WARN or ERROR
+	KeyLevel = slog.LevelKey
+	// KeyMessage is the message, a constant string per event
+	KeyMessage = slog.MessageKey
+	// KeyRunID is the run ID of a merge, sync, push or API request (see
+	// runid)
+	KeyRunID = "run_id"
+	// KeyDebugRequest is the id of a request logged at debug level with
+	// X-Debug
+	KeyDebugRequest = "debug_request"
+	// KeyCommand is the CLI command that logged the record
+	KeyCommand = "command"
+	// KeyClientCert is the subject of the TLS client certificate of an API
+	// request made over mutual TLS
+	KeyClientCert = "client_cert"
+	// KeyError is the error of a failed operation
+	KeyError = "error"
+	// KeySchema is the schema version, in "application started"
+	KeySchema = "log_schema"
+)
+
+// Attr is an attribute of a Record other than its time, level and message.
+type Attr struct {
+	Key string
+	// Value is the decoded JSON value: a string, json.Number, bool, nil,
+	// []any or map[string]any
+	Value any
+}
+
+// Record is a record of the JSON log.
+type Record struct {
+	Time    time.Time
+	Level   slog.Level
+	Message string
+	// Attrs are the other keys of the record, in the order they were logged
+	Attrs []Attr
+}
+
+// Attr returns the value of the attribute key, or nil.
+func (r Record) Attr(key string) any {
+	for _, a := range r.Attrs {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+// RunID returns the run ID of the record, or "".
+func (r Record) RunID() string {
+	id, _ := r.Attr(KeyRunID).(string)
+	return id
+}
+
+// ParseRecord decodes a line of the JSON log.
+func ParseRecord(line []byte) (Record, error) {
+	var r Record
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return r, errors.New("not a JSON log record")
+	}
+	var hasTime, hasLevel bool
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return r, fmt.Errorf("invalid log record: %w", err)
+		}
+		key, _ := tok.(string)
+		var value any
+		if err := dec.Decode(&value); err != nil {
+			return r, fmt.Errorf("invalid log record: %w", err)
+		}
+
+		switch key {
+		case KeyTime:
+			s, _ := value.(string)
+			if r.Time, err = time.Parse(time.RFC3339Nano, s); err != nil {
+				return r, fmt.Errorf("invalid log record time: %w", err)
+			}
+			hasTime = true
+		case KeyLevel:
+			s, _ := value.(string)
+			if err := r.Level.UnmarshalText([]byte(s)); err != nil {
+				return r, fmt.Errorf("invalid log record level: %w", err)
+			}
+			hasLevel = true
+		case KeyMessage:
+			r.Message, _ = value.(string)
+		default:
+			r.Attrs = append(r.Attrs, Attr{Key: key, Value: value})
+		}
+	}
+	if !hasTime || !hasLevel {
+		return r, errors.New("not a JSON log record")
+	}
+	return r, nil
+}
@@ -0,0 +1,401 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ldapmerge/internal/metrics"
+)
+
+// Sink types
+const (
+	SinkLoki          = "loki"
+	SinkElasticsearch = "elasticsearch"
+)
+
+// Defaults of SinkConfig
+const (
+	DefaultSinkBatchSize     = 500
+	DefaultSinkFlushInterval = 2 * time.Second
+	DefaultSinkBufferSize    = 10000
+	DefaultSinkTimeout       = 10 * time.Second
+	DefaultSinkIndex         = "ldapmerge-{date}"
+)
+
+// sinkRetries is how many times a batch is sent again after a failure,
+// waiting 1s, 2s, 4s... in between, before its records are dropped.
+const sinkRetries = 3
+
+// sinkErrorInterval is the least time between two sink errors reported
+// on stderr.
+const sinkErrorInterval = time.Minute
+
+// sinkRecords counts the records of each sink by outcome: shipped, dropped
+// because the buffer was full, or failed because the sink refused them or
+// could not be reached.
+var sinkRecords = metrics.NewCounterVec("ldapmerge_log_sink_records_total",
+	"Log records sent to log sinks, by outcome (shipped, dropped, failed).", "sink", "outcome")
+
+// SinkConfig configures shipping the log to Loki or Elasticsearch.
+type SinkConfig struct {
+	// Type is SinkLoki or SinkElasticsearch
+	Type string `mapstructure:"type"`
+	// URL is the base URL of Loki, where /loki/api/v1/push is posted to,
+	// or of Elasticsearch, where /_bulk is posted to
+	URL string `mapstructure:"url"`
+	// Labels are the Loki stream labels besides level; app defaults to
+	// ldapmerge
+	Labels map[string]string `mapstructure:"labels"`
+	// Index is the Elasticsearch index or data stream, with {date} replaced
+	// by the UTC date of the record; empty means DefaultSinkIndex
+	Index string `mapstructure:"index"`
+	// Username and Password, if set, authenticate with HTTP basic auth
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// Headers are set on every request, e.g. X-Scope-OrgID for a Loki
+	// tenant or Authorization for an Elasticsearch API key
+	Headers map[string]string `mapstructure:"headers"`
+	// BatchSize is the most records sent in one request
+	BatchSize int `mapstructure:"batch_size"`
+	// FlushInterval is the longest a record waits before it is sent
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// BufferSize is the most records waiting to be sent; records logged
+	// while it is full are dropped rather than slowing the application
+	BufferSize int `mapstructure:"buffer_size"`
+	// Timeout bounds each request, and flushing the buffer on Close
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Sink ships the JSON lines written to it to Loki or Elasticsearch in
+// batches, from a background goroutine. Write never blocks or fails.
+type Sink struct {
+	cfg    SinkConfig
+	encode func(lines [][]byte) (body []byte, contentType string)
+	path   string
+	client *http.Client
+
+	lines   chan []byte
+	closing chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	// errOut receives sink errors, at most one per sinkErrorInterval
+	errOut     io.Writer
+	lastReport time.Time
+	dropped    int
+}
+
+// NewSink validates cfg, applies its defaults and starts shipping.
+func NewSink(cfg SinkConfig) (*Sink, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("log sink %s: no url", cfg.Type)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultSinkBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = DefaultSinkFlushInterval
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultSinkBufferSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultSinkTimeout
+	}
+
+	s := &Sink{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		lines:   make(chan []byte, cfg.BufferSize),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+		errOut:  os.Stderr,
+	}
+	switch cfg.Type {
+	case SinkLoki:
+		s.path = "/loki/api/v1/push"
+		labels := map[string]string{"app": "ldapmerge"}
+		for k, v := range cfg.Labels {
+			labels[k] = v
+		}
+		s.encode = func(lines [][]byte) ([]byte, string) { return encodeLoki(labels, lines) }
+	case SinkElasticsearch:
+		s.path = "/_bulk"
+		index := cfg.Index
+		if index == "" {
+			index = DefaultSinkIndex
+		}
+		s.encode = func(lines [][]byte) ([]byte, string) { return encodeBulk(index, lines) }
+	default:
+		return nil, fmt.Errorf("unknown log sink type %q: use %s or %s", cfg.Type, SinkLoki, SinkElasticsearch)
+	}
+
+	go s.run()
+	return s, nil
+}
+
+// Write queues the JSON line p, or drops it when the buffer is full or the
+// sink is closed.
+func (s *Sink) Write(p []byte) (int, error) {
+	line := bytes.TrimRight(p, "\n")
+	if len(line) == 0 {
+		return len(p), nil
+	}
+	select {
+	case <-s.closing:
+		sinkRecords.Inc(s.cfg.Type, "dropped")
+		return len(p), nil
+	default:
+	}
+	select {
+	case s.lines <- append([]byte(nil), line...):
+	default:
+		sinkRecords.Inc(s.cfg.Type, "dropped")
+	}
+	return len(p), nil
+}
+
+// Close sends the records still buffered, waiting at most the sink's
+// timeout, and stops the sink.
+func (s *Sink) Close() error {
+	s.once.Do(func() { close(s.closing) })
+	select {
+	case <-s.done:
+		return nil
+	case <-time.After(s.cfg.Timeout + time.Second):
+		return fmt.Errorf("log sink %s: timed out flushing %d records", s.cfg.Type, len(s.lines))
+	}
+}
+
+func (s *Sink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([][]byte, 0, s.cfg.BatchSize)
+	for {
+		select {
+		case line := <-s.lines:
+			if batch = append(batch, line); len(batch) >= s.cfg.BatchSize {
+				batch = s.flush(batch, sinkRetries)
+			}
+		case <-ticker.C:
+			batch = s.flush(batch, sinkRetries)
+		case <-s.closing:
+			for {
+				select {
+				case line := <-s.lines:
+					if batch = append(batch, line); len(batch) >= s.cfg.BatchSize {
+						batch = s.flush(batch, 0)
+					}
+				default:
+					s.flush(batch, 0)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush sends batch, retrying up to retries times, and returns it emptied.
+// Records of a batch that cannot be sent are dropped.
+func (s *Sink) flush(batch [][]byte, retries int) [][]byte {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	var err error
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		var failed int
+		if failed, err = s.send(batch); err == nil {
+			sinkRecords.Add(float64(len(batch)-failed), s.cfg.Type, "shipped")
+			sinkRecords.Add(float64(failed), s.cfg.Type, "failed")
+			break
+		}
+		if attempt >= retries {
+			sinkRecords.Add(float64(len(batch)), s.cfg.Type, "failed")
+			s.dropped += len(batch)
+			break
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-s.closing:
+			retries = attempt
+		}
+	}
+	if err != nil {
+		s.report(err)
+	}
+	return batch[:0]
+}
+
+// send posts batch and returns how many of its records the sink refused.
+func (s *Sink) send(batch [][]byte) (int, error) {
+	body, contentType := s.encode(batch)
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(s.cfg.URL, "/")+s.path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range s.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	if s.cfg.Username != "" {
+		req.SetBasicAuth(s.cfg.Username, s.cfg.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return 0, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	if s.cfg.Type == SinkElasticsearch {
+		failed, reason := bulkFailures(data)
+		if failed > 0 {
+			s.report(fmt.Errorf("%d of %d records refused: %s", failed, len(batch), reason))
+		}
+		return failed, nil
+	}
+	return 0, nil
+}
+
+// report writes err to errOut unless another error was reported within
+// sinkErrorInterval. The log itself is not used: the record would be
+// shipped to the failing sink again.
+func (s *Sink) report(err error) {
+	if time.Since(s.lastReport) < sinkErrorInterval {
+		return
+	}
+	s.lastReport = time.Now()
+	_, _ = fmt.Fprintf(s.errOut, "ldapmerge: log sink %s %s: %v (%d records dropped so far)\n", s.cfg.Type, s.cfg.URL, err, s.dropped)
+}
+
+// recordHeader holds the schema keys a sink needs from a line.
+type recordHeader struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"`
+}
+
+func parseHeader(line []byte) recordHeader {
+	var h recordHeader
+	_ = json.Unmarshal(line, &h)
+	if h.Time.IsZero() {
+		h.Time = time.Now()
+	}
+	return h
+}
+
+// encodeLoki returns the Loki push request of lines, with one stream per
+// level.
+func encodeLoki(labels map[string]string, lines [][]byte) ([]byte, string) {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	streams := map[string]*stream{}
+	var levels []string
+	for _, line := range lines {
+		h := parseHeader(line)
+		level := strings.ToLower(h.Level)
+		st, ok := streams[level]
+		if !ok {
+			st = &stream{Stream: map[string]string{"level": level}}
+			for k, v := range labels {
+				st.Stream[k] = v
+			}
+			streams[level] = st
+			levels = append(levels, level)
+		}
+		st.Values = append(st.Values, [2]string{strconv.FormatInt(h.Time.UnixNano(), 10), string(line)})
+	}
+	sort.Strings(levels)
+
+	var push struct {
+		Streams []*stream `json:"streams"`
+	}
+	for _, level := range levels {
+		push.Streams = append(push.Streams, streams[level])
+	}
+	body, _ := json.Marshal(push)
+	return body, "application/json"
+}
+
+// encodeBulk returns the Elasticsearch bulk request creating a document per
+// line in index, with @timestamp set from the record time.
+func encodeBulk(index string, lines [][]byte) ([]byte, string) {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		h := parseHeader(line)
+		action, _ := json.Marshal(map[string]map[string]string{
+			"create": {"_index": strings.ReplaceAll(index, "{date}", h.Time.UTC().Format("2006.01.02"))},
+		})
+		buf.Write(action)
+		buf.WriteString("\n{\"@timestamp\":\"")
+		buf.WriteString(h.Time.UTC().Format(time.RFC3339Nano))
+		buf.WriteString("\"")
+		if rest := bytes.TrimPrefix(line, []byte("{")); len(bytes.TrimSpace(rest)) > 1 {
+			buf.WriteString(",")
+			buf.Write(rest)
+		} else {
+			buf.WriteString("}")
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), "application/x-ndjson"
+}
+
+// bulkFailures returns the number of items of a bulk response that failed,
+// and the reason of the first.
+func bulkFailures(data []byte) (int, string) {
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil || !resp.Errors {
+		return 0, ""
+	}
+	failed, reason := 0, ""
+	for _, item := range resp.Items {
+		for _, result := range item {
+			if result.Status/100 == 2 {
+				continue
+			}
+			failed++
+			if reason == "" {
+				reason = result.Error.Type + ": " + result.Error.Reason
+			}
+		}
+	}
+	return failed, reason
+}
+
+// closeSinks closes every sink, returning the errors joined.
+func closeSinks(sinks []*Sink) error {
+	var errs []error
+	for _, s := range sinks {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,163 @@
+package logging_test
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/logging"
+)
+
+// collector records the bodies posted to it.
+type collector struct {
+	mu     sync.Mutex
+	bodies []string
+	status int
+	reply  string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.bodies = append(c.bodies, r.URL.Path+" "+r.Header.Get("Content-Type")+" "+r.Header.Get("X-Scope-OrgID")+"\n"+string(body))
+	if c.status != 0 {
+		w.WriteHeader(c.status)
+	}
+	_, _ = io.WriteString(w, c.reply)
+}
+
+func (c *collector) posted() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.bodies...)
+}
+
+func TestLokiSink(t *testing.T) {
+	c := &collector{status: http.StatusNoContent}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	cfg := logging.DefaultConfig()
+	cfg.LogDir = t.TempDir()
+	cfg.Level = slog.LevelDebug
+	cfg.Sinks = []logging.SinkConfig{{
+		Type:    logging.SinkLoki,
+		URL:     srv.URL + "/",
+		Labels:  map[string]string{"env": "test"},
+		Headers: map[string]string{"X-Scope-OrgID": "ops"},
+	}}
+	logger, err := logging.New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	logger.Info("sync started", "run_id", "r1")
+	logger.Error("push failed", "error", "409 Conflict")
+	logger.Info("sync finished")
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	posted := c.posted()
+	if len(posted) != 1 {
+		t.Fatalf("Expected the records flushed in one request on Close, got %d", len(posted))
+	}
+	header, body, _ := strings.Cut(posted[0], "\n")
+	if header != "/loki/api/v1/push application/json ops" {
+		t.Errorf("Unexpected request %q", header)
+	}
+	var push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal([]byte(body), &push); err != nil {
+		t.Fatalf("Invalid push body %s: %v", body, err)
+	}
+	if len(push.Streams) != 2 || push.Streams[0].Stream["level"] != "error" || push.Streams[1].Stream["level"] != "info" {
+		t.Fatalf("Expected an error and an info stream, got %s", body)
+	}
+	info := push.Streams[1]
+	if info.Stream["app"] != "ldapmerge" || info.Stream["env"] != "test" || len(info.Values) != 2 {
+		t.Errorf("Unexpected info stream %+v", info)
+	}
+	r, err := logging.ParseRecord([]byte(info.Values[0][1]))
+	if err != nil || r.Message != "sync started" || r.RunID() != "r1" || info.Values[0][0] != strconv.FormatInt(r.Time.UnixNano(), 10) {
+		t.Errorf("Expected the JSON record with its time in ns, got %v (%v)", info.Values[0], err)
+	}
+}
+
+func TestElasticsearchSink(t *testing.T) {
+	c := &collector{reply: `{"errors":true,"items":[{"create":{"status":201}},{"create":{"status":400,"error":{"type":"mapper_parsing_exception","reason":"bad"}}}]}`}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	sink, err := logging.NewSink(logging.SinkConfig{Type: logging.SinkElasticsearch, URL: srv.URL, BatchSize: 2, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewSink failed: %v", err)
+	}
+	_, _ = sink.Write([]byte(`{"time":"2026-10-16T23:59:59Z","level":"INFO","msg":"a"}` + "\n"))
+	_, _ = sink.Write([]byte(`{"time":"2026-10-17T00:00:01Z","level":"INFO","msg":"b"}` + "\n"))
+
+	// A full batch is sent without waiting for the flush interval
+	deadline := time.Now().Add(5 * time.Second)
+	for len(c.posted()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	posted := c.posted()
+	if len(posted) != 1 {
+		t.Fatalf("Expected one bulk request, got %d", len(posted))
+	}
+	want := "/_bulk application/x-ndjson \n" +
+		`{"create":{"_index":"ldapmerge-2026.10.16"}}` + "\n" +
+		`{"@timestamp":"2026-10-16T23:59:59Z","time":"2026-10-16T23:59:59Z","level":"INFO","msg":"a"}` + "\n" +
+		`{"create":{"_index":"ldapmerge-2026.10.17"}}` + "\n" +
+		`{"@timestamp":"2026-10-17T00:00:01Z","time":"2026-10-17T00:00:01Z","level":"INFO","msg":"b"}` + "\n"
+	if posted[0] != want {
+		t.Errorf("Unexpected bulk request:\n%s\nwant:\n%s", posted[0], want)
+	}
+}
+
+func TestSinkDropsWhenFull(t *testing.T) {
+	block := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-block }))
+	defer srv.Close()
+	defer close(block)
+
+	sink, err := logging.NewSink(logging.SinkConfig{Type: logging.SinkLoki, URL: srv.URL, BatchSize: 1, BufferSize: 2, Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewSink failed: %v", err)
+	}
+
+	// Writes return at once while the sink hangs
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if n, err := sink.Write([]byte(`{"time":"2026-10-16T12:00:00Z","level":"INFO","msg":"x"}` + "\n")); err != nil || n == 0 {
+			t.Fatalf("Write failed: %d, %v", n, err)
+		}
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected writes not to block, took %s", d)
+	}
+	_ = sink.Close()
+}
+
+func TestNewSinkInvalid(t *testing.T) {
+	for _, cfg := range []logging.SinkConfig{{Type: "splunk", URL: "http://x"}, {Type: logging.SinkLoki}} {
+		if _, err := logging.NewSink(cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+}
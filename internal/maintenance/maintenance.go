@@ -0,0 +1,200 @@
+// Package maintenance keeps the directory of the database from growing on
+// long-lived servers: it checkpoints the SQLite write-ahead log, truncates
+// it when it grew too large, and removes files left behind by processes
+// that did not exit cleanly, such as the write-ahead log of a database that
+// was moved or deleted and stale temporary files.
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ldapmerge/internal/repository"
+)
+
+// Options configures the maintenance.
+type Options struct {
+	// Interval between runs
+	Interval time.Duration
+	// WALLimit is the size in bytes of the write-ahead log above which it
+	// is truncated after the checkpoint
+	WALLimit int64
+	// TempAge is the age from which temporary files are removed
+	TempAge time.Duration
+}
+
+// DefaultOptions returns the default maintenance options.
+func DefaultOptions() Options {
+	return Options{
+		Interval: time.Hour,
+		WALLimit: 64 << 20,
+		TempAge:  24 * time.Hour,
+	}
+}
+
+// sidecars are the suffixes of the files SQLite keeps next to a database.
+var sidecars = []string{"-wal", "-shm", "-journal"}
+
+// tempPatterns match the temporary files of ldapmerge, such as those of
+// doctor, and of SQLite when SQLITE_TMPDIR points at the directory.
+var tempPatterns = []string{".ldapmerge-*", "etilqs_*"}
+
+// Report is the outcome of a run.
+type Report struct {
+	WALBefore  int64                  `json:"wal_before"` // size in bytes of the write-ahead log before the checkpoint
+	WALAfter   int64                  `json:"wal_after"`  // and after it
+	Checkpoint *repository.Checkpoint `json:"checkpoint"`
+	Removed    []string               `json:"removed"` // files removed from the database directory
+}
+
+// Maintainer runs the maintenance of a database.
+type Maintainer struct {
+	repo *repository.Repository
+	opts Options
+	log  *slog.Logger
+}
+
+// New creates a maintainer of repo.
+func New(repo *repository.Repository, opts Options) *Maintainer {
+	return &Maintainer{
+		repo: repo,
+		opts: opts,
+		log:  slog.With("component", "maintenance"),
+	}
+}
+
+// Run runs the maintenance immediately and then every Interval until ctx
+// is canceled.
+func (m *Maintainer) Run(ctx context.Context) {
+	m.log.Info("database maintenance started", "interval", m.opts.Interval)
+
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			m.log.Error("database maintenance failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			m.log.Info("database maintenance stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce checkpoints the write-ahead log, truncating it when it is larger
+// than WALLimit, and removes the orphaned SQLite files and stale temporary
+// files of the database directory. A failed checkpoint does not stop the
+// cleanup; the errors of both are returned.
+func (m *Maintainer) RunOnce(ctx context.Context) (*Report, error) {
+	path := m.repo.Path()
+	report := &Report{WALBefore: fileSize(path + "-wal")}
+
+	var errs []error
+	cp, err := m.repo.Checkpoint(ctx, report.WALBefore > m.opts.WALLimit)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	report.Checkpoint = cp
+	report.WALAfter = fileSize(path + "-wal")
+
+	removed, err := sweep(filepath.Dir(path), time.Now().Add(-m.opts.TempAge))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	report.Removed = removed
+
+	if cp != nil && cp.Busy {
+		m.log.Warn("write-ahead log checkpoint incomplete: the database is busy", "wal_size", report.WALAfter, "frames", cp.Frames, "checkpointed", cp.Checkpointed)
+	}
+	if cp != nil && cp.Truncated {
+		m.log.Info("write-ahead log truncated", "wal_size_before", report.WALBefore, "wal_limit", m.opts.WALLimit)
+	}
+	for _, file := range removed {
+		m.log.Info("stale file removed", "path", file)
+	}
+	m.log.Debug("database maintenance done", "wal_size_before", report.WALBefore, "wal_size", report.WALAfter, "removed_count", len(removed))
+
+	return report, errors.Join(errs...)
+}
+
+// fileSize returns the size of a file, or zero if it cannot be read.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// sweep removes from dir the SQLite write-ahead log, shared memory and
+// journal files whose database no longer exists, and the temporary files
+// last modified before cutoff. It returns the paths removed.
+func sweep(dir string, cutoff time.Time) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	var removed []string
+	var errs []error
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name := entry.Name()
+		if !orphaned(dir, name) && !stale(entry, cutoff) {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("failed to remove %s: %w", path, err))
+			continue
+		}
+		removed = append(removed, path)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// orphaned reports whether the file name of dir is an SQLite sidecar file
+// of a database that does not exist.
+func orphaned(dir, name string) bool {
+	for _, suffix := range sidecars {
+		db, ok := strings.CutSuffix(name, suffix)
+		if !ok || db == "" {
+			continue
+		}
+		_, err := os.Stat(filepath.Join(dir, db))
+		return errors.Is(err, fs.ErrNotExist)
+	}
+	return false
+}
+
+// stale reports whether entry is a temporary file last modified before
+// cutoff.
+func stale(entry fs.DirEntry, cutoff time.Time) bool {
+	temp := false
+	for _, pattern := range tempPatterns {
+		if ok, _ := filepath.Match(pattern, entry.Name()); ok {
+			temp = true
+			break
+		}
+	}
+	if !temp {
+		return false
+	}
+
+	info, err := entry.Info()
+	return err == nil && info.ModTime().Before(cutoff)
+}
@@ -0,0 +1,83 @@
+package maintenance
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+)
+
+func TestRunOnce(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	repo, err := repository.New(filepath.Join(dir, "data.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+	for range 20 {
+		if _, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, []models.Domain{{ID: "example.lab"}}); err != nil {
+			t.Fatalf("SaveHistory failed: %v", err)
+		}
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"moved.db-wal", "moved.db-shm", ".ldapmerge-doctor-123", ".ldapmerge-fresh", "notes.txt", "kept.db", "kept.db-wal"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if name != ".ldapmerge-fresh" {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// A limit below the size of the log truncates it
+	opts := DefaultOptions()
+	opts.WALLimit = 1
+	report, err := New(repo, opts).RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if report.WALBefore == 0 || report.WALAfter != 0 || !report.Checkpoint.Truncated {
+		t.Errorf("Expected the write-ahead log truncated, got %+v, %+v", report, report.Checkpoint)
+	}
+
+	var removed []string
+	for _, path := range report.Removed {
+		removed = append(removed, filepath.Base(path))
+	}
+	slices.Sort(removed)
+	if want := []string{".ldapmerge-doctor-123", "moved.db-shm", "moved.db-wal"}; !slices.Equal(removed, want) {
+		t.Errorf("Expected %v removed, got %v", want, removed)
+	}
+	for _, name := range []string{"data.db", ".ldapmerge-fresh", "notes.txt", "kept.db", "kept.db-wal"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s kept: %v", name, err)
+		}
+	}
+
+	if entries, err := repo.ListHistorySummaries(ctx, repository.HistoryFilter{}); err != nil || len(entries) != 20 {
+		t.Errorf("Expected the history intact, got %d, %v", len(entries), err)
+	}
+
+	// Under the limit, the log is only checkpointed
+	if _, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, nil); err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	report, err = New(repo, DefaultOptions()).RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+	if report.Checkpoint.Truncated || report.WALAfter == 0 || len(report.Removed) != 0 {
+		t.Errorf("Expected a passive checkpoint only, got %+v, %+v", report, report.Checkpoint)
+	}
+}
@@ -0,0 +1,124 @@
+package merger
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"ldapmerge/internal/models"
+)
+
+// ParseHostAliases parses alias=host pairs, as given to --host-alias, into
+// Options.HostAliases.
+func ParseHostAliases(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	aliases := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		alias, host, ok := strings.Cut(pair, "=")
+		alias, host = strings.TrimSpace(alias), strings.TrimSpace(host)
+		if !ok || alias == "" || host == "" {
+			return nil, fmt.Errorf("invalid host alias %q (want alias=host)", pair)
+		}
+		aliases[alias] = host
+	}
+	return aliases, nil
+}
+
+// aliasResolver maps response URLs with an alias host to the match keys of
+// the LDAP servers they stand for.
+type aliasResolver struct {
+	m *Merger
+	// known are the match keys of the servers of the initial
+	known map[string]bool
+	// hosts are Options.HostAliases with lowercased keys
+	hosts map[string]string
+	// suffixes map ".alternative.name" to ".domain.name" of the domains,
+	// keys lowercased; the first domain wins if several share a name
+	suffixes map[string]string
+}
+
+// newAliasResolver returns the resolver of the AltNames and HostAliases
+// options for domains, or nil if neither is set.
+func (m *Merger) newAliasResolver(domains []models.Domain) *aliasResolver {
+	if !m.opts.AltNames && len(m.opts.HostAliases) == 0 {
+		return nil
+	}
+
+	r := &aliasResolver{m: m, known: make(map[string]bool)}
+	for _, domain := range domains {
+		for _, server := range domain.LDAPServers {
+			r.known[m.matchKey(server.URL)] = true
+		}
+	}
+	if len(m.opts.HostAliases) > 0 {
+		r.hosts = make(map[string]string, len(m.opts.HostAliases))
+		for alias, host := range m.opts.HostAliases {
+			r.hosts[strings.ToLower(alias)] = host
+		}
+	}
+	if m.opts.AltNames {
+		r.suffixes = make(map[string]string)
+		for _, domain := range domains {
+			if domain.DomainName == "" {
+				continue
+			}
+			for _, name := range domain.AlternativeDomainNames {
+				key := "." + strings.ToLower(strings.Trim(name, "."))
+				if _, ok := r.suffixes[key]; !ok && key != "." {
+					r.suffixes[key] = "." + strings.Trim(domain.DomainName, ".")
+				}
+			}
+		}
+	}
+	return r
+}
+
+// key returns the match key of the server rawURL stands for: its own if a
+// server has it, otherwise that of the first server found under its alias
+// host or with an alternative domain name replaced by the domain name.
+func (r *aliasResolver) key(rawURL string) string {
+	key := r.m.matchKey(rawURL)
+	if r.known[key] {
+		return key
+	}
+
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return key
+	}
+	for _, host := range r.hostsFor(u.Hostname()) {
+		alias := *u
+		alias.Host = host
+		if port := u.Port(); port != "" {
+			alias.Host = net.JoinHostPort(host, port)
+		}
+		if k := r.m.matchKey(alias.String()); r.known[k] {
+			return k
+		}
+	}
+	return key
+}
+
+// hostsFor returns the hosts an alias host may stand for, the configured
+// one first.
+func (r *aliasResolver) hostsFor(host string) []string {
+	var hosts []string
+	lower := strings.ToLower(host)
+	if h, ok := r.hosts[lower]; ok {
+		hosts = append(hosts, h)
+	}
+	for i := strings.IndexByte(lower, '.'); i >= 0; {
+		if suffix, ok := r.suffixes[lower[i:]]; ok {
+			hosts = append(hosts, host[:i]+suffix)
+		}
+		next := strings.IndexByte(lower[i+1:], '.')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return hosts
+}
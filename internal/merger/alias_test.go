@@ -0,0 +1,102 @@
+package merger_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+)
+
+func aliasInput() ([]models.Domain, *models.CertificateResponse) {
+	domains := []models.Domain{
+		{
+			ID:                     "example.lab",
+			DomainName:             "example.lab",
+			AlternativeDomainNames: []string{"EXAMPLE.local", "site2.example.net"},
+			LDAPServers: []models.LDAPServer{
+				{URL: "ldaps://dc01.example.lab:636"},
+				{URL: "ldaps://dc02.example.lab:636"},
+				{URL: "ldaps://dc03.example.lab:636"},
+			},
+		},
+	}
+
+	response := &models.CertificateResponse{
+		Results: []models.CertificateResult{
+			{JSON: models.CertificateJSON{PEMEncoded: "A"}, Item: models.ResponseItem{URL: "ldaps://dc01.example.local:636"}},
+			{JSON: models.CertificateJSON{PEMEncoded: "B"}, Item: models.ResponseItem{URL: "ldaps://dc02.site2.example.net:636"}},
+			{JSON: models.CertificateJSON{PEMEncoded: "C"}, Item: models.ResponseItem{URL: "ldaps://ad-dc3.example.org:636"}},
+		},
+	}
+
+	return domains, response
+}
+
+func TestAltNames(t *testing.T) {
+	domains, response := aliasInput()
+
+	result, err := merger.New().Merge(context.Background(), domains, response)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	for _, server := range result[0].LDAPServers {
+		if server.Certificates != nil {
+			t.Errorf("Expected no alias matches by default, got %s: %q", server.URL, server.Certificates)
+		}
+	}
+
+	m := merger.NewWithOptions(merger.Options{
+		AltNames:    true,
+		HostAliases: map[string]string{"AD-DC3.example.org": "dc03.example.lab"},
+		Strict:      true,
+	})
+	if err := m.Validate(domains, response); err != nil {
+		t.Errorf("Expected every URL to match a server, got %v", err)
+	}
+	result, err = m.Merge(context.Background(), domains, response)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	for i, want := range []string{"A", "B", "C"} {
+		if certs := result[0].LDAPServers[i].Certificates; len(certs) != 1 || certs[0] != want {
+			t.Errorf("Expected %s for %s, got %q", want, result[0].LDAPServers[i].URL, certs)
+		}
+	}
+
+	// A server under the URL as it is wins over the alias
+	domains[0].LDAPServers = append(domains[0].LDAPServers, models.LDAPServer{URL: "ldaps://dc01.example.local:636"})
+	result, err = m.Merge(context.Background(), domains, response)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if certs := result[0].LDAPServers[0].Certificates; certs != nil {
+		t.Errorf("Expected no certificates for dc01.example.lab, got %q", certs)
+	}
+	if certs := result[0].LDAPServers[3].Certificates; len(certs) != 1 || certs[0] != "A" {
+		t.Errorf("Expected A for dc01.example.local, got %q", certs)
+	}
+
+	var unmatched *merger.UnmatchedError
+	m = merger.NewWithOptions(merger.Options{Strict: true})
+	if err := m.Validate(domains, response); !errors.As(err, &unmatched) || len(unmatched.URLs) != 2 {
+		t.Errorf("Expected 2 unmatched URLs without aliases, got %v", err)
+	}
+}
+
+func TestParseHostAliases(t *testing.T) {
+	aliases, err := merger.ParseHostAliases([]string{"dc01-site2.example.net=dc01.example.lab", " a = b "})
+	if err != nil {
+		t.Fatalf("ParseHostAliases failed: %v", err)
+	}
+	if len(aliases) != 2 || aliases["dc01-site2.example.net"] != "dc01.example.lab" || aliases["a"] != "b" {
+		t.Errorf("Unexpected aliases %v", aliases)
+	}
+
+	for _, pair := range []string{"dc01", "=dc01", "dc01="} {
+		if _, err := merger.ParseHostAliases([]string{pair}); err == nil {
+			t.Errorf("Expected an error for %q", pair)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package merger
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"ldapmerge/internal/models"
+)
+
+// maxArchiveEntrySize bounds each JSON file read from a response archive.
+const maxArchiveEntrySize = 64 << 20
+
+// responseArchive returns the archive format of a response location, "zip"
+// or "tar.gz", or "" if it is a JSON document.
+func responseArchive(location string) string {
+	name, _, _ := strings.Cut(strings.ToLower(location), "?")
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	}
+	return ""
+}
+
+// decodeResponseArchive reads a .zip or .tar.gz of certificate JSON files,
+// such as those Ansible fetches from each host, and calls fn with their
+// results in archive order. Each .json file is a response document, an
+// array of results or a single result; other files are ignored.
+func decodeResponseArchive(ctx context.Context, r io.Reader, format string, fn func(models.CertificateResult) error) error {
+	files := 0
+	each := func(name string, entry io.Reader) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		files++
+		if err := decodeResultFile(entry, fn); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}
+
+	if format == "zip" {
+		// zip needs random access: the archive is read into memory
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() || !isResultFile(f.Name) {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+			err = each(f.Name, rc)
+			_ = rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return noResultFiles(files)
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return noResultFiles(files)
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg || !isResultFile(header.Name) {
+			continue
+		}
+		if err := each(header.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func noResultFiles(files int) error {
+	if files == 0 {
+		return errors.New("archive holds no .json files")
+	}
+	return nil
+}
+
+// isResultFile reports whether an archive file is a certificate JSON file,
+// leaving out the metadata macOS adds to archives.
+func isResultFile(name string) bool {
+	base := path.Base(name)
+	return strings.EqualFold(path.Ext(base), ".json") &&
+		!strings.HasPrefix(base, "._") &&
+		!strings.Contains(name, "__MACOSX/")
+}
+
+// decodeResultFile passes the results of one JSON file of a response
+// archive to fn.
+func decodeResultFile(r io.Reader, fn func(models.CertificateResult) error) error {
+	data, err := io.ReadAll(io.LimitReader(r, maxArchiveEntrySize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxArchiveEntrySize {
+		return fmt.Errorf("larger than %d bytes", maxArchiveEntrySize)
+	}
+
+	var results []models.CertificateResult
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &results); err != nil {
+			return err
+		}
+	} else {
+		var doc struct {
+			models.CertificateResult
+			Results *[]models.CertificateResult `json:"results"`
+		}
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return err
+		}
+		switch {
+		case doc.Results != nil:
+			results = *doc.Results
+		case doc.Item.URL != "":
+			results = []models.CertificateResult{doc.CertificateResult}
+		default:
+			return errors.New("neither a response with results nor a result with item.url")
+		}
+	}
+
+	for _, result := range results {
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package merger
+
+import (
+	"slices"
+	"strings"
+
+	"ldapmerge/internal/models"
+)
+
+// CertificateConflict is a server URL for which the response holds more
+// than one distinct certificate, as when several hosts behind one name
+// answered with different certificates.
+type CertificateConflict struct {
+	// URL of the server, as in the initial
+	URL string
+	// Existing are the certificates the server has in the initial, as
+	// pulled from NSX
+	Existing []string
+	// Response are the distinct certificates of the response for the URL
+	Response []string
+}
+
+// ConflictResolver chooses how the certificates of a conflicting server are
+// combined: StrategyKeep keeps the existing ones, StrategyReplace uses the
+// response and StrategyAppend merges both. An error stops the merge.
+type ConflictResolver func(CertificateConflict) (Strategy, error)
+
+// resolveConflicts calls Options.ResolveConflict for every server URL with
+// conflicting response certificates, in the order of domains, and returns
+// the chosen strategies by match key. It is nil without a resolver or
+// conflicts.
+func (m *Merger) resolveConflicts(domains []models.Domain, certMap map[string][]string) (map[string]Strategy, error) {
+	if m.opts.ResolveConflict == nil {
+		return nil, nil
+	}
+
+	var strategies map[string]Strategy
+	for _, domain := range domains {
+		for _, server := range domain.LDAPServers {
+			key := m.matchKey(server.URL)
+			if _, ok := strategies[key]; ok {
+				continue
+			}
+			certs := distinctCertificates(certMap[key])
+			if len(certs) < 2 {
+				continue
+			}
+
+			strategy, err := m.opts.ResolveConflict(CertificateConflict{
+				URL:      server.URL,
+				Existing: server.Certificates,
+				Response: certs,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if strategies == nil {
+				strategies = make(map[string]Strategy)
+			}
+			strategies[key] = strategy
+		}
+	}
+	return strategies, nil
+}
+
+// distinctCertificates returns certs without repeated PEM blocks, ignoring
+// surrounding whitespace.
+func distinctCertificates(certs []string) []string {
+	var distinct []string
+	for _, cert := range certs {
+		if !slices.ContainsFunc(distinct, func(c string) bool {
+			return strings.TrimSpace(c) == strings.TrimSpace(cert)
+		}) {
+			distinct = append(distinct, cert)
+		}
+	}
+	return distinct
+}
@@ -0,0 +1,45 @@
+package merger
+
+import (
+	"strconv"
+
+	"ldapmerge/internal/models"
+)
+
+// DisableServers sets enabled to false, in place, on the enabled servers of
+// domains for which reason returns a reason, and returns them. A domain
+// keeps one enabled server: if reason is given for all of them, the first
+// stays enabled and is returned with Kept set.
+func DisableServers(domains []models.Domain, reason func(domain *models.Domain, server *models.LDAPServer) string) []models.DisabledServer {
+	var disabled []models.DisabledServer
+	for i := range domains {
+		domain := &domains[i]
+
+		enabled := 0
+		var broken []int
+		reasons := make(map[int]string)
+		for j := range domain.LDAPServers {
+			server := &domain.LDAPServers[j]
+			if on, _ := strconv.ParseBool(server.Enabled); !on {
+				continue
+			}
+			enabled++
+			if r := reason(domain, server); r != "" {
+				broken = append(broken, j)
+				reasons[j] = r
+			}
+		}
+
+		for k, j := range broken {
+			server := &domain.LDAPServers[j]
+			d := models.DisabledServer{Domain: domain.ID, URL: server.URL, Reason: reasons[j]}
+			if k == 0 && len(broken) == enabled {
+				d.Kept = true
+			} else {
+				server.Enabled = "false"
+			}
+			disabled = append(disabled, d)
+		}
+	}
+	return disabled
+}
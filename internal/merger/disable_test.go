@@ -0,0 +1,56 @@
+package merger_test
+
+import (
+	"testing"
+
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+)
+
+func TestDisableServers(t *testing.T) {
+	domains := []models.Domain{
+		{ID: "a", LDAPServers: []models.LDAPServer{
+			{URL: "ldaps://a1:636", Enabled: "true"},
+			{URL: "ldaps://a2:636", Enabled: "true"},
+			{URL: "ldaps://a3:636", Enabled: "false"},
+		}},
+		{ID: "b", LDAPServers: []models.LDAPServer{
+			{URL: "ldaps://b1:636", Enabled: "true"},
+			{URL: "ldaps://b2:636", Enabled: "true"},
+		}},
+	}
+	broken := map[string]bool{"ldaps://a1:636": true, "ldaps://a3:636": true, "ldaps://b1:636": true, "ldaps://b2:636": true}
+
+	disabled := merger.DisableServers(domains, func(_ *models.Domain, server *models.LDAPServer) string {
+		if broken[server.URL] {
+			return "broken"
+		}
+		return ""
+	})
+
+	want := []models.DisabledServer{
+		{Domain: "a", URL: "ldaps://a1:636", Reason: "broken"},
+		{Domain: "b", URL: "ldaps://b1:636", Reason: "broken", Kept: true},
+		{Domain: "b", URL: "ldaps://b2:636", Reason: "broken"},
+	}
+	if len(disabled) != len(want) {
+		t.Fatalf("Expected %d disabled servers, got %+v", len(want), disabled)
+	}
+	for i := range want {
+		if disabled[i] != want[i] {
+			t.Errorf("Expected %+v, got %+v", want[i], disabled[i])
+		}
+	}
+
+	var enabled []string
+	for _, domain := range domains {
+		for _, server := range domain.LDAPServers {
+			if server.Enabled == "true" {
+				enabled = append(enabled, server.URL)
+			}
+		}
+	}
+	if len(enabled) != 2 || enabled[0] != "ldaps://a2:636" || enabled[1] != "ldaps://b1:636" {
+		t.Errorf("Expected a2 and b1 left enabled, got %v", enabled)
+	}
+}
@@ -0,0 +1,74 @@
+package merger
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"ldapmerge/internal/models"
+)
+
+// Filter selects the domains whose IDs match one of a set of glob patterns
+// (path.Match syntax, case-insensitive), such as "*.example.lab".
+type Filter struct {
+	patterns []string
+}
+
+// NewFilter returns a filter for patterns. Without patterns it selects every
+// domain.
+func NewFilter(patterns []string) (*Filter, error) {
+	f := &Filter{}
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid domain pattern %q: %w", p, err)
+		}
+		f.patterns = append(f.patterns, p)
+	}
+	return f, nil
+}
+
+// Match reports whether the filter selects the domain id. A nil filter
+// selects every domain.
+func (f *Filter) Match(id string) bool {
+	if f == nil || len(f.patterns) == 0 {
+		return true
+	}
+	for _, p := range f.patterns {
+		if ok, _ := path.Match(p, strings.ToLower(id)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the domains the filter selects, in order.
+func (f *Filter) Select(domains []models.Domain) []models.Domain {
+	selected := make([]models.Domain, 0, len(domains))
+	for _, d := range domains {
+		if f.Match(d.ID) {
+			selected = append(selected, d)
+		}
+	}
+	return selected
+}
+
+// CanaryFirst returns domains with the domain canary moved first, so that it
+// can be pushed before the others. An empty canary returns domains as is.
+func CanaryFirst(domains []models.Domain, canary string) ([]models.Domain, error) {
+	if canary == "" {
+		return domains, nil
+	}
+	i := slices.IndexFunc(domains, func(d models.Domain) bool { return strings.EqualFold(d.ID, canary) })
+	if i < 0 {
+		return nil, fmt.Errorf("canary source %q is not among the sources to push", canary)
+	}
+	ordered := make([]models.Domain, 0, len(domains))
+	ordered = append(ordered, domains[i])
+	ordered = append(ordered, domains[:i]...)
+	return append(ordered, domains[i+1:]...), nil
+}
@@ -0,0 +1,40 @@
+package merger_test
+
+import (
+	"testing"
+
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+)
+
+func TestFilter(t *testing.T) {
+	domains := []models.Domain{{ID: "corp.example.lab"}, {ID: "lab.example.lab"}, {ID: "partner.test"}}
+
+	f, err := merger.NewFilter([]string{"*.Example.lab", " "})
+	if err != nil {
+		t.Fatalf("NewFilter failed: %v", err)
+	}
+	selected := f.Select(domains)
+	if len(selected) != 2 || selected[0].ID != "corp.example.lab" || selected[1].ID != "lab.example.lab" {
+		t.Errorf("Unexpected selection %+v", selected)
+	}
+
+	var none *merger.Filter
+	if len(none.Select(domains)) != 3 {
+		t.Error("Expected a nil filter to select every domain")
+	}
+	if _, err := merger.NewFilter([]string{"[a-"}); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+
+	ordered, err := merger.CanaryFirst(domains, "LAB.example.lab")
+	if err != nil {
+		t.Fatalf("CanaryFirst failed: %v", err)
+	}
+	if ordered[0].ID != "lab.example.lab" || ordered[1].ID != "corp.example.lab" || ordered[2].ID != "partner.test" {
+		t.Errorf("Unexpected order %+v", ordered)
+	}
+	if _, err := merger.CanaryFirst(selected, "partner.test"); err == nil {
+		t.Error("Expected an error for a canary that is not pushed")
+	}
+}
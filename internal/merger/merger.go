@@ -1,119 +1,318 @@
 package merger
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"os"
+	"hash"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"ldapmerge/internal/loader"
 	"ldapmerge/internal/models"
 )
 
 // Merger handles the merging of initial and response data.
-type Merger struct{}
+type Merger struct {
+	opts Options
+}
 
-// New creates a new Merger instance.
+// New creates a new Merger instance with default options.
 func New() *Merger {
-	return &Merger{}
+	return NewWithOptions(DefaultOptions())
+}
+
+// NewWithOptions creates a new Merger instance with the given options.
+// An empty strategy falls back to StrategyReplace.
+func NewWithOptions(opts Options) *Merger {
+	if opts.Strategy == "" {
+		opts.Strategy = StrategyReplace
+	}
+	return &Merger{opts: opts}
+}
+
+// Options returns the merger's options.
+func (m *Merger) Options() Options {
+	return m.opts
+}
+
+// LoadInitial loads the initial domains from a JSON document at location:
+// a path, "-" for stdin, or a URL with a registered loader scheme. A
+// leading {"_meta": ...} element, as WriteJSONWithMeta writes, is skipped,
+// so merged outputs load as they are. Parsing stops when ctx is canceled.
+func (m *Merger) LoadInitial(ctx context.Context, location string) ([]models.Domain, error) {
+	domains, _, err := m.LoadInitialWithInput(ctx, location)
+	return domains, err
 }
 
-// LoadInitialFromFile loads the initial domains from a JSON file.
-func (m *Merger) LoadInitialFromFile(path string) ([]models.Domain, error) {
-	data, err := os.ReadFile(path)
+// LoadInitialWithInput loads the initial domains as LoadInitial and also
+// returns the document's description for the Meta of outputs.
+func (m *Merger) LoadInitialWithInput(ctx context.Context, location string) ([]models.Domain, Input, error) {
+	doc, err := openDocument(ctx, location, InputInitial)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read initial file: %w", err)
+		return nil, Input{}, err
 	}
+	defer doc.Close()
 
-	var domains []models.Domain
-	if err := json.Unmarshal(data, &domains); err != nil {
-		return nil, fmt.Errorf("failed to parse initial JSON: %w", err)
+	domains, err := decodeDomains(doc)
+	if err == nil {
+		err = doc.finish()
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, Input{}, ctxErr
+		}
+		return nil, Input{}, fmt.Errorf("failed to parse initial JSON: %w", err)
 	}
+	return domains, doc.input, nil
+}
+
+// LoadResponse loads the certificate response from a JSON document at
+// location, as LoadInitial. The results are decoded one at a time with
+// DecodeResponse rather than after reading the whole document. A location
+// ending in .zip, .tar.gz or .tgz is an archive of JSON files, each a
+// response, an array of results or a single result, whose results are
+// combined in archive order.
+func (m *Merger) LoadResponse(ctx context.Context, location string) (*models.CertificateResponse, error) {
+	response, _, err := loadResponse(ctx, location)
+	return response, err
+}
+
+// LoadResponseWithInput loads the certificate response as LoadResponse and
+// also returns the document's description for the Meta of outputs.
+func (m *Merger) LoadResponseWithInput(ctx context.Context, location string) (*models.CertificateResponse, Input, error) {
+	return loadResponse(ctx, location)
+}
 
-	return domains, nil
+// document is an input document being read, hashed as it is.
+type document struct {
+	io.ReadCloser
+	input Input
+	hash  hash.Hash
 }
 
-// LoadResponseFromFile loads the certificate response from a JSON file.
-func (m *Merger) LoadResponseFromFile(path string) (*models.CertificateResponse, error) {
-	data, err := os.ReadFile(path)
+// openDocument opens the kind JSON document at location.
+func openDocument(ctx context.Context, location, kind string) (*document, error) {
+	r, err := loader.Open(ctx, location)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response file: %w", err)
+		return nil, fmt.Errorf("failed to read %s document: %w", kind, err)
 	}
+	return &document{ReadCloser: r, input: Input{Role: kind, Location: location}, hash: sha256.New()}, nil
+}
 
-	var response models.CertificateResponse
-	if err := json.Unmarshal(data, &response); err != nil {
-		return nil, fmt.Errorf("failed to parse response JSON: %w", err)
-	}
+func (d *document) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	d.hash.Write(p[:n])
+	d.input.Size += int64(n)
+	return n, err
+}
 
-	return &response, nil
+// finish reads the rest of the document, which decoders leave unread after
+// the JSON value, and records its digest.
+func (d *document) finish() error {
+	if _, err := io.Copy(io.Discard, d); err != nil {
+		return err
+	}
+	d.input.SHA256 = hex.EncodeToString(d.hash.Sum(nil))
+	return nil
 }
 
-// buildCertificateMap creates a map from URL to certificates.
-func (m *Merger) buildCertificateMap(response *models.CertificateResponse) map[string][]string {
-	certMap := make(map[string][]string)
+// buildCertificateMap creates a map from URL to certificates. URLs without
+// certificates map to nil so they still count as matched. With aliases,
+// response URLs with an alias host are keyed by the server they stand for.
+//
+// Responses repeat the same PEM, such as a CA shared by many servers, once
+// per result; the copies are interned so that the merged servers share one
+// string and deduplication compares them by pointer.
+func (m *Merger) buildCertificateMap(response *models.CertificateResponse, aliases *aliasResolver) map[string][]string {
+	certMap := make(map[string][]string, len(response.Results))
+	pems := make(map[string]string)
 
-	for _, result := range response.Results {
-		url := result.Item.URL
-		if url == "" {
+	for i := range response.Results {
+		result := &response.Results[i]
+		if result.Item.URL == "" {
 			continue
 		}
-
-		if _, exists := certMap[url]; !exists {
-			certMap[url] = []string{}
+		var url string
+		if aliases != nil {
+			url = aliases.key(result.Item.URL)
+		} else {
+			url = m.matchKey(result.Item.URL)
 		}
 
-		if result.JSON.PEMEncoded != "" {
-			certMap[url] = append(certMap[url], result.JSON.PEMEncoded)
+		certs := certMap[url]
+		if pem := result.JSON.PEMEncoded; pem != "" {
+			if interned, ok := pems[pem]; ok {
+				pem = interned
+			} else {
+				pems[pem] = pem
+			}
+			certs = append(certs, pem)
 		}
+		certMap[url] = certs
 	}
 
 	return certMap
 }
 
 // Merge combines the initial domains with certificates from the response.
-func (m *Merger) Merge(domains []models.Domain, response *models.CertificateResponse) []models.Domain {
-	certMap := m.buildCertificateMap(response)
+// It returns ctx's error if ctx is canceled before the merge completes.
+func (m *Merger) Merge(ctx context.Context, domains []models.Domain, response *models.CertificateResponse) ([]models.Domain, error) {
+	result, _, err := m.MergeWithStats(ctx, domains, response)
+	return result, err
+}
+
+// MergeWithStats merges like Merge and also returns statistics about the
+// merge, which are recorded in the merge metrics. Large inputs are merged by
+// a pool of Options.Workers goroutines, one domain at a time.
+func (m *Merger) MergeWithStats(ctx context.Context, domains []models.Domain, response *models.CertificateResponse) ([]models.Domain, models.MergeStats, error) {
+	start := time.Now()
+	stats := models.MergeStats{
+		Domains:         len(domains),
+		ResponseResults: len(response.Results),
+	}
+
+	certMap := m.buildCertificateMap(response, m.newAliasResolver(domains))
+	strategies, err := m.resolveConflicts(domains, certMap)
+	if err != nil {
+		return nil, stats, err
+	}
 
 	result := make([]models.Domain, len(domains))
 
-	for i, domain := range domains {
-		result[i] = models.Domain{
-			ID:                     domain.ID,
-			DomainName:             domain.DomainName,
-			BaseDN:                 domain.BaseDN,
-			AlternativeDomainNames: domain.AlternativeDomainNames,
-			LDAPServers:            make([]models.LDAPServer, len(domain.LDAPServers)),
+	workers := m.workers(len(domains))
+	if workers == 1 {
+		for i := range domains {
+			if ctx.Err() != nil {
+				break
+			}
+			m.mergeDomain(&domains[i], &result[i], certMap, strategies, &stats)
 		}
+	} else {
+		var (
+			next int64 = -1
+			mu   sync.Mutex
+			wg   sync.WaitGroup
+		)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
 
-		for j, server := range domain.LDAPServers {
-			result[i].LDAPServers[j] = models.LDAPServer{
-				URL:          server.URL,
-				StartTLS:     server.StartTLS,
-				Enabled:      server.Enabled,
-				BindUsername: server.BindUsername,
-				BindPassword: server.BindPassword,
-			}
+				var local models.MergeStats
+				for {
+					i := int(atomic.AddInt64(&next, 1))
+					if i >= len(domains) || ctx.Err() != nil {
+						break
+					}
+					m.mergeDomain(&domains[i], &result[i], certMap, strategies, &local)
+				}
 
-			if certs, exists := certMap[server.URL]; exists && len(certs) > 0 {
-				result[i].LDAPServers[j].Certificates = certs
-			}
+				mu.Lock()
+				stats.Servers += local.Servers
+				stats.MatchedServers += local.MatchedServers
+				stats.ResultCertificates += local.ResultCertificates
+				mu.Unlock()
+			}()
 		}
+		wg.Wait()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, stats, err
+	}
+
+	duration := time.Since(start)
+	stats.DurationMS = float64(duration.Microseconds()) / 1000
+	if stats.Servers > 0 {
+		stats.MatchRatio = float64(stats.MatchedServers) / float64(stats.Servers)
+	}
+	observeMerge(duration, stats)
+
+	return result, stats, nil
+}
+
+// workers returns the number of goroutines to merge n domains with.
+func (m *Merger) workers(n int) int {
+	workers := m.opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if n < parallelMinDomains || workers < 1 {
+		return 1
+	}
+	if workers > n {
+		workers = n
+	}
+	return workers
+}
+
+// mergeDomain writes the merged copy of domain to out and counts its servers
+// in stats. Servers with a strategy in strategies, by match key, are merged
+// with it. certMap and strategies are only read, so domains can be merged
+// concurrently.
+func (m *Merger) mergeDomain(domain, out *models.Domain, certMap map[string][]string, strategies map[string]Strategy, stats *models.MergeStats) {
+	*out = models.Domain{
+		ID:                     domain.ID,
+		DomainName:             domain.DomainName,
+		BaseDN:                 domain.BaseDN,
+		AlternativeDomainNames: domain.AlternativeDomainNames,
+		LDAPServers:            make([]models.LDAPServer, len(domain.LDAPServers)),
+		DisplayName:            domain.DisplayName,
+		Description:            domain.Description,
+		Tags:                   domain.Tags,
+		Revision:               domain.Revision,
+		Extra:                  domain.Extra,
 	}
 
-	return result
+	for j := range domain.LDAPServers {
+		server, merged := &domain.LDAPServers[j], &out.LDAPServers[j]
+		merged.URL = server.URL
+		merged.StartTLS = server.StartTLS
+		merged.Enabled = server.Enabled
+		merged.BindUsername = server.BindUsername
+		merged.BindPassword = server.BindPassword
+		merged.Extra = server.Extra
+
+		key := m.matchKey(server.URL)
+		certs, matched := certMap[key]
+		strategy, ok := strategies[key]
+		if !ok {
+			strategy = m.opts.Strategy
+		}
+		merged.Certificates = m.combine(strategy, server.Certificates, certs)
+
+		stats.Servers++
+		if matched {
+			stats.MatchedServers++
+		}
+		stats.ResultCertificates += len(merged.Certificates)
+	}
 }
 
-// MergeFromFiles loads files and performs the merge operation.
-func (m *Merger) MergeFromFiles(initialPath, responsePath string) ([]models.Domain, error) {
-	domains, err := m.LoadInitialFromFile(initialPath)
+// MergeFrom loads the documents at the initial and response locations and
+// performs the merge operation.
+func (m *Merger) MergeFrom(ctx context.Context, initial, response string) ([]models.Domain, error) {
+	domains, err := m.LoadInitial(ctx, initial)
 	if err != nil {
 		return nil, err
 	}
 
-	response, err := m.LoadResponseFromFile(responsePath)
+	resp, err := m.LoadResponse(ctx, response)
 	if err != nil {
 		return nil, err
 	}
 
-	return m.Merge(domains, response), nil
+	if err := m.Validate(domains, resp); err != nil {
+		return nil, err
+	}
+
+	return m.Merge(ctx, domains, resp)
 }
 
 // ToJSON converts the result to formatted JSON.
@@ -123,3 +322,75 @@ func (m *Merger) ToJSON(domains []models.Domain, indent bool) ([]byte, error) {
 	}
 	return json.Marshal(domains)
 }
+
+// WriteJSON streams the result to w one domain at a time, producing the same
+// output as ToJSON without holding the whole document in memory.
+func (m *Merger) WriteJSON(w io.Writer, domains []models.Domain, indent bool) error {
+	return m.WriteJSONWithMeta(w, domains, nil, indent)
+}
+
+// WriteJSONWithMeta streams the result as WriteJSON does, preceded by a
+// {"_meta": meta} element when meta is not nil. LoadInitial skips that
+// element, so the output can still be pushed or merged again.
+func (m *Merger) WriteJSONWithMeta(w io.Writer, domains []models.Domain, meta *Meta, indent bool) error {
+	if domains == nil && meta == nil {
+		_, err := io.WriteString(w, "null")
+		return err
+	}
+	if len(domains) == 0 && meta == nil {
+		_, err := io.WriteString(w, "[]")
+		return err
+	}
+
+	open, sep, end := "[", ",", "]"
+	if indent {
+		open, sep, end = "[\n    ", ",\n    ", "\n]"
+	}
+
+	if _, err := io.WriteString(w, open); err != nil {
+		return err
+	}
+
+	if meta != nil {
+		var data []byte
+		var err error
+		element := map[string]*Meta{MetaKey: meta}
+		if indent {
+			data, err = json.MarshalIndent(element, "    ", "    ")
+		} else {
+			data, err = json.Marshal(element)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", MetaKey, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	for i := range domains {
+		if i > 0 || meta != nil {
+			if _, err := io.WriteString(w, sep); err != nil {
+				return err
+			}
+		}
+
+		var data []byte
+		var err error
+		if indent {
+			data, err = json.MarshalIndent(&domains[i], "    ", "    ")
+		} else {
+			data, err = json.Marshal(&domains[i])
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode domain %s: %w", domains[i].ID, err)
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(w, end)
+	return err
+}
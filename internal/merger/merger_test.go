@@ -0,0 +1,251 @@
+package merger_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+)
+
+// largeInput generates domains with serversPerDomain servers each; every
+// other server has a certificate in the response.
+func largeInput(domains, serversPerDomain int) ([]models.Domain, *models.CertificateResponse) {
+	initial := make([]models.Domain, domains)
+	response := &models.CertificateResponse{Results: make([]models.CertificateResult, 0, domains*serversPerDomain/2)}
+
+	for i := range initial {
+		initial[i] = models.Domain{
+			ID:          fmt.Sprintf("domain-%04d.lab", i),
+			DomainName:  fmt.Sprintf("domain-%04d.lab", i),
+			LDAPServers: make([]models.LDAPServer, serversPerDomain),
+		}
+		for j := range initial[i].LDAPServers {
+			url := fmt.Sprintf("ldaps://dc-%02d.domain-%04d.lab:636", j, i)
+			initial[i].LDAPServers[j] = models.LDAPServer{URL: url, Enabled: "true", Certificates: []string{certOld}}
+			if j%2 == 0 {
+				response.Results = append(response.Results, models.CertificateResult{
+					JSON: models.CertificateJSON{PEMEncoded: certNew},
+					Item: models.ResponseItem{URL: url},
+				})
+			}
+		}
+	}
+
+	return initial, response
+}
+
+func TestMergeParallel(t *testing.T) {
+	domains, response := largeInput(500, 4)
+
+	ctx := context.Background()
+	opts := merger.Options{Strategy: merger.StrategyAppend, Normalize: true, Dedup: true, Workers: 1}
+	sequential, seqStats, err := merger.NewWithOptions(opts).MergeWithStats(ctx, domains, response)
+	if err != nil {
+		t.Fatalf("MergeWithStats failed: %v", err)
+	}
+
+	opts.Workers = 8
+	parallel, parStats, err := merger.NewWithOptions(opts).MergeWithStats(ctx, domains, response)
+	if err != nil {
+		t.Fatalf("MergeWithStats failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(sequential, parallel) {
+		t.Error("Expected parallel merge to produce the sequential result")
+	}
+
+	seqStats.DurationMS, parStats.DurationMS = 0, 0
+	if seqStats != parStats {
+		t.Errorf("Expected equal stats, got %+v and %+v", seqStats, parStats)
+	}
+	if parStats.Servers != 2000 || parStats.MatchedServers != 1000 || parStats.ResultCertificates != 3000 {
+		t.Errorf("Unexpected stats: %+v", parStats)
+	}
+}
+
+func TestMergeKeepsExtra(t *testing.T) {
+	var initial []models.Domain
+	if err := json.Unmarshal([]byte(`[{"id": "a", "domain_name": "a", "base_dn": "DC=a", "search_timeout": 30,
+		"ldap_servers": [{"url": "ldaps://a:636", "starttls": "false", "enabled": "true", "pool_size": 4}]}]`), &initial); err != nil {
+		t.Fatal(err)
+	}
+	response := &models.CertificateResponse{Results: []models.CertificateResult{
+		{JSON: models.CertificateJSON{PEMEncoded: "PEM"}, Item: models.ResponseItem{URL: "ldaps://a:636"}},
+	}}
+
+	result, err := merger.New().Merge(context.Background(), initial, response)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"id":"a","domain_name":"a","base_dn":"DC=a","alternative_domain_names":null,` +
+		`"ldap_servers":[{"url":"ldaps://a:636","starttls":"false","enabled":"true","certificates":["PEM"],"pool_size":4}],"search_timeout":30}]`
+	if string(data) != want {
+		t.Errorf("Expected unknown members to be kept, got %s", data)
+	}
+}
+
+func TestResolveConflict(t *testing.T) {
+	initial := []models.Domain{{ID: "a", LDAPServers: []models.LDAPServer{
+		{URL: "ldaps://a:636", Certificates: []string{"OLD"}},
+		{URL: "ldaps://b:636", Certificates: []string{"OLD"}},
+	}}}
+	response := &models.CertificateResponse{Results: []models.CertificateResult{
+		{JSON: models.CertificateJSON{PEMEncoded: "A1"}, Item: models.ResponseItem{URL: "ldaps://a:636"}},
+		{JSON: models.CertificateJSON{PEMEncoded: "A2"}, Item: models.ResponseItem{URL: "ldaps://a:636"}},
+		{JSON: models.CertificateJSON{PEMEncoded: "A1"}, Item: models.ResponseItem{URL: "ldaps://a:636"}},
+		{JSON: models.CertificateJSON{PEMEncoded: "B1"}, Item: models.ResponseItem{URL: "ldaps://b:636"}},
+	}}
+
+	var conflicts []merger.CertificateConflict
+	m := merger.NewWithOptions(merger.Options{
+		Strategy: merger.StrategyReplace,
+		ResolveConflict: func(c merger.CertificateConflict) (merger.Strategy, error) {
+			conflicts = append(conflicts, c)
+			return merger.StrategyAppend, nil
+		},
+	})
+	result, err := m.Merge(context.Background(), initial, response)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].URL != "ldaps://a:636" || len(conflicts[0].Response) != 2 {
+		t.Fatalf("Expected one conflict for a with 2 certificates, got %+v", conflicts)
+	}
+	if certs := result[0].LDAPServers[0].Certificates; strings.Join(certs, ",") != "OLD,A1,A2,A1" {
+		t.Errorf("Expected the chosen append for a, got %q", certs)
+	}
+	if certs := result[0].LDAPServers[1].Certificates; len(certs) != 1 || certs[0] != "B1" {
+		t.Errorf("Expected the replace strategy for b, got %q", certs)
+	}
+
+	aborted := errors.New("aborted")
+	m = merger.NewWithOptions(merger.Options{
+		ResolveConflict: func(merger.CertificateConflict) (merger.Strategy, error) { return "", aborted },
+	})
+	if _, err := m.Merge(context.Background(), initial, response); !errors.Is(err, aborted) {
+		t.Errorf("Expected the resolver error, got %v", err)
+	}
+}
+
+func TestMergeCanceled(t *testing.T) {
+	domains, response := largeInput(500, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, workers := range []int{1, 8} {
+		m := merger.NewWithOptions(merger.Options{Workers: workers})
+		if _, err := m.Merge(ctx, domains, response); !errors.Is(err, context.Canceled) {
+			t.Errorf("workers=%d: expected context.Canceled, got %v", workers, err)
+		}
+	}
+}
+
+func TestLoadCanceled(t *testing.T) {
+	domains, _ := largeInput(500, 4)
+	data, err := json.Marshal(domains)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "initial.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := merger.New()
+	loaded, err := m.LoadInitial(context.Background(), path)
+	if err != nil || len(loaded) != 500 {
+		t.Fatalf("Expected 500 domains, got %d: %v", len(loaded), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.LoadInitial(ctx, path); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func benchmarkMerge(b *testing.B, domains, workers int, normalize bool) {
+	initial, response := largeInput(domains, 4)
+	m := merger.NewWithOptions(merger.Options{Normalize: normalize, Dedup: true, Workers: workers})
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.Merge(ctx, initial, response); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMerge(b *testing.B) {
+	for _, domains := range []int{100, 1000, 5000} {
+		for _, workers := range []int{1, 0} {
+			for _, normalize := range []bool{false, true} {
+				name := fmt.Sprintf("domains=%d/workers=%d/normalize=%v", domains, workers, normalize)
+				b.Run(name, func(b *testing.B) {
+					benchmarkMerge(b, domains, workers, normalize)
+				})
+			}
+		}
+	}
+}
+
+// decodedInput is largeInput after a JSON round trip, as merges see it:
+// every copy of a repeated PEM is a string of its own.
+func decodedInput(b *testing.B, domains, serversPerDomain int) ([]models.Domain, *models.CertificateResponse) {
+	b.Helper()
+	initial, response := largeInput(domains, serversPerDomain)
+	var decoded struct {
+		Initial  []models.Domain
+		Response *models.CertificateResponse
+	}
+	data, err := json.Marshal(map[string]any{"Initial": initial, "Response": response})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		b.Fatal(err)
+	}
+	return decoded.Initial, decoded.Response
+}
+
+// BenchmarkMergeLarge merges decoded inputs of 4 servers per domain with
+// normalization and dedup on one worker. On one CPU, -benchtime 5x:
+//
+//	                  before                   after
+//	replace/10000      92ms  21.4MB   230k allocs   22ms   7.7MB   30k allocs
+//	replace/50000     460ms 105.5MB  1150k allocs  128ms  36.7MB  150k allocs
+//	append/10000       99ms  23.3MB   310k allocs   24ms   8.6MB   70k allocs
+//	append/50000      500ms 115.1MB  1550k allocs  148ms  41.5MB  350k allocs
+func BenchmarkMergeLarge(b *testing.B) {
+	for _, strategy := range []merger.Strategy{merger.StrategyReplace, merger.StrategyAppend} {
+		for _, domains := range []int{10000, 50000} {
+			b.Run(fmt.Sprintf("strategy=%s/domains=%d", strategy, domains), func(b *testing.B) {
+				initial, response := decodedInput(b, domains, 4)
+				m := merger.NewWithOptions(merger.Options{Strategy: strategy, Normalize: true, Dedup: true, Workers: 1})
+				ctx := context.Background()
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := m.Merge(ctx, initial, response); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
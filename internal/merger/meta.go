@@ -0,0 +1,151 @@
+package merger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"ldapmerge/internal/convert"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+)
+
+// MetaKey is the member of the first element of an output array that holds
+// its Meta.
+const MetaKey = "_meta"
+
+// Input roles
+const (
+	InputInitial  = "initial"
+	InputResponse = "response"
+)
+
+// Meta records where a merged output file comes from, so that an artifact
+// can be traced back to the tool and the inputs that produced it.
+type Meta struct {
+	Tool      string    `json:"tool"`
+	Version   string    `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	NSXHost   string    `json:"nsx_host,omitempty"` // pulled from and pushed to, for sync
+	Inputs    []Input   `json:"inputs,omitempty"`
+}
+
+// Input describes a document a merge was made from.
+type Input struct {
+	Role     string `json:"role"` // InputInitial or InputResponse
+	Location string `json:"location"`
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size"` // bytes
+}
+
+// decodeDomains decodes a JSON array of domains one domain at a time,
+// skipping a leading {"_meta": ...} element. NSX identity sources, as an
+// NSX list result, an array or a single source, are converted to domains.
+func decodeDomains(r io.Reader) ([]models.Domain, error) {
+	br := bufio.NewReader(r)
+	if first, err := peekNonSpace(br); err == nil && first == '{' {
+		return decodeNSXObject(br)
+	}
+
+	dec := json.NewDecoder(br)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, nil
+	}
+	if tok != json.Delim('[') {
+		return nil, fmt.Errorf("expected an array of domains, got %v", tok)
+	}
+
+	domains := []models.Domain{}
+	nsxSources := false
+	for i := 0; dec.More(); i++ {
+		if i == 0 {
+			var first json.RawMessage
+			if err := dec.Decode(&first); err != nil {
+				return nil, fmt.Errorf("domain %d: %w", i, err)
+			}
+			var meta struct {
+				Meta *json.RawMessage `json:"_meta"`
+			}
+			if json.Unmarshal(first, &meta) == nil && meta.Meta != nil {
+				continue
+			}
+			nsxSources = convert.IsNSXSource(first)
+			domain, err := decodeDomain(first, nsxSources)
+			if err != nil {
+				return nil, fmt.Errorf("domain %d: %w", i, err)
+			}
+			domains = append(domains, domain)
+			continue
+		}
+
+		if nsxSources {
+			var source nsx.LDAPIdentitySource
+			if err := dec.Decode(&source); err != nil {
+				return nil, fmt.Errorf("domain %d: %w", i, err)
+			}
+			domains = append(domains, nsx.LDAPIdentitySourceToDomain(source))
+			continue
+		}
+		domains = append(domains, models.Domain{})
+		if err := dec.Decode(&domains[len(domains)-1]); err != nil {
+			return nil, fmt.Errorf("domain %d: %w", i, err)
+		}
+	}
+
+	_, err = dec.Token() // the closing bracket
+	return domains, err
+}
+
+// decodeDomain decodes a domain, or an NSX identity source as a domain.
+func decodeDomain(data []byte, nsxSource bool) (models.Domain, error) {
+	if !nsxSource {
+		var domain models.Domain
+		err := json.Unmarshal(data, &domain)
+		return domain, err
+	}
+	var source nsx.LDAPIdentitySource
+	if err := json.Unmarshal(data, &source); err != nil {
+		return models.Domain{}, err
+	}
+	return nsx.LDAPIdentitySourceToDomain(source), nil
+}
+
+// decodeNSXObject decodes an NSX list result or a single identity source
+// as domains.
+func decodeNSXObject(r io.Reader) ([]models.Domain, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	format, err := convert.Detect(data)
+	if err != nil {
+		return nil, err
+	}
+	if format != convert.FormatNSX {
+		return nil, fmt.Errorf("expected domains or NSX identity sources, got a %s document", format)
+	}
+	return convert.Domains(data, format)
+}
+
+// peekNonSpace returns the first byte of r other than JSON whitespace,
+// without consuming it.
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\n', '\r':
+			_, _ = r.ReadByte()
+		default:
+			return b[0], nil
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package merger_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/merger"
+)
+
+func TestMetaRoundTrip(t *testing.T) {
+	domains, _ := largeInput(3, 2)
+	meta := &merger.Meta{
+		Tool:      "ldapmerge",
+		Version:   "1.2.3",
+		CreatedAt: time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC),
+		NSXHost:   "https://nsx.example.lab",
+		Inputs:    []merger.Input{{Role: merger.InputInitial, Location: "initial.json", SHA256: "abc", Size: 3}},
+	}
+	m := merger.New()
+	dir := t.TempDir()
+
+	for _, indent := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := m.WriteJSONWithMeta(&buf, domains, meta, indent); err != nil {
+			t.Fatalf("WriteJSONWithMeta failed: %v", err)
+		}
+		if !strings.Contains(buf.String(), `"_meta"`) || !strings.Contains(buf.String(), `"nsx_host"`) {
+			t.Errorf("Expected a _meta element, got %s", buf.String())
+		}
+
+		path := filepath.Join(dir, "result.json")
+		if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		loaded, input, err := m.LoadInitialWithInput(context.Background(), path)
+		if err != nil {
+			t.Fatalf("LoadInitialWithInput failed: %v", err)
+		}
+		if !reflect.DeepEqual(loaded, domains) {
+			t.Errorf("Expected the domains without _meta, got %+v", loaded)
+		}
+
+		sum := sha256.Sum256(buf.Bytes())
+		if input.Role != merger.InputInitial || input.Location != path || input.SHA256 != hex.EncodeToString(sum[:]) || input.Size != int64(buf.Len()) {
+			t.Errorf("Unexpected input %+v", input)
+		}
+	}
+
+	// Only meta
+	var buf bytes.Buffer
+	if err := m.WriteJSONWithMeta(&buf, nil, meta, false); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "empty.json")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := m.LoadInitial(context.Background(), path); err != nil || len(loaded) != 0 {
+		t.Errorf("Expected no domains, got %+v: %v", loaded, err)
+	}
+}
+
+func TestLoadInitialNSX(t *testing.T) {
+	source := `{"id": "example.lab", "resource_type": "LdapIdentitySource", "domain_name": "example.lab", "base_dn": "DC=example,DC=lab",
+		"ldap_servers": [{"url": "ldaps://ad-01.example.lab:636", "use_starttls": false, "enabled": true, "certificates": ["PEM"]}],
+		"_revision": 4, "path": "/aaa/ldap-identity-sources/example.lab"}`
+	docs := map[string]string{
+		"list":   `{"results": [` + source + `, ` + source + `], "result_count": 2}`,
+		"array":  `[` + source + `, ` + source + `]`,
+		"single": source,
+	}
+	dir := t.TempDir()
+	m := merger.New()
+
+	for name, doc := range docs {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name+".json")
+			if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			domains, err := m.LoadInitial(context.Background(), path)
+			if err != nil {
+				t.Fatalf("LoadInitial failed: %v", err)
+			}
+			if len(domains) == 0 || domains[0].ID != "example.lab" || domains[0].LDAPServers[0].Enabled != "true" ||
+				domains[0].LDAPServers[0].StartTLS != "false" || domains[0].Revision == nil || *domains[0].Revision != 4 {
+				t.Errorf("Unexpected domains %+v", domains)
+			}
+		})
+	}
+
+	path := filepath.Join(dir, "response.json")
+	if err := os.WriteFile(path, []byte(`{"results": [{"json": {"pem_encoded": "PEM"}, "item": {"url": "ldaps://a:636"}}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.LoadInitial(context.Background(), path); err == nil || !strings.Contains(err.Error(), "response") {
+		t.Errorf("Expected an error naming the response, got %v", err)
+	}
+}
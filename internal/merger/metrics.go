@@ -0,0 +1,29 @@
+package merger
+
+import (
+	"time"
+
+	"ldapmerge/internal/metrics"
+	"ldapmerge/internal/models"
+)
+
+// sizeBuckets suit counts of domains, servers and response results
+var sizeBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 5000}
+
+var (
+	mergeDuration = metrics.NewHistogramVec("ldapmerge_merge_duration_seconds",
+		"Duration of merge operations.", []float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5})
+	mergeServers = metrics.NewHistogramVec("ldapmerge_merge_servers",
+		"LDAP servers in the initial domains of a merge.", sizeBuckets)
+	mergeResponseResults = metrics.NewHistogramVec("ldapmerge_merge_response_results",
+		"Results in the certificate response of a merge.", sizeBuckets)
+	mergeMatchRatio = metrics.NewHistogramVec("ldapmerge_merge_match_ratio",
+		"Share of LDAP servers that matched a response URL.", []float64{0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 1})
+)
+
+func observeMerge(duration time.Duration, stats models.MergeStats) {
+	mergeDuration.Observe(duration.Seconds())
+	mergeServers.Observe(float64(stats.Servers))
+	mergeResponseResults.Observe(float64(stats.ResponseResults))
+	mergeMatchRatio.Observe(stats.MatchRatio)
+}
@@ -0,0 +1,288 @@
+package merger
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"ldapmerge/internal/models"
+)
+
+// Strategy controls how response certificates combine with certificates
+// already present on a server.
+type Strategy string
+
+const (
+	// StrategyReplace uses only the certificates from the response
+	StrategyReplace Strategy = "replace"
+	// StrategyAppend keeps existing certificates and adds response certificates
+	StrategyAppend Strategy = "append"
+	// StrategyKeep keeps existing certificates and uses the response only for
+	// servers that have none
+	StrategyKeep Strategy = "keep"
+)
+
+// Strategies lists all supported merge strategies.
+var Strategies = []Strategy{StrategyReplace, StrategyAppend, StrategyKeep}
+
+// Options configures merge behavior.
+type Options struct {
+	// Strategy for combining response and existing certificates
+	Strategy Strategy
+	// Normalize matches URLs case-insensitively and with default ports
+	// (ldaps://dc01 matches ldaps://DC01:636)
+	Normalize bool
+	// AltNames also matches response URLs whose host is in one of the
+	// AlternativeDomainNames of a domain to the servers of the domain:
+	// ldaps://dc01.example.local matches ldaps://dc01.example.lab when
+	// example.local is an alternative name of example.lab
+	AltNames bool
+	// HostAliases maps hosts used in response URLs to the hosts of LDAP
+	// servers (dc01-site2.example.net: dc01.example.lab), ignoring case.
+	// URLs that match a server as they are are not mapped.
+	HostAliases map[string]string
+	// Strict fails the merge when the response contains URLs that match
+	// no LDAP server
+	Strict bool
+	// Dedup removes duplicate PEM blocks per server
+	Dedup bool
+	// Weak is the policy for weak certificates in the response (SHA-1
+	// signatures, short RSA keys, expired CAs); empty is WeakWarn
+	Weak WeakPolicy
+	// Workers bounds the goroutines merging domains in parallel; 0 uses one
+	// per CPU and 1 merges sequentially. Inputs with fewer than 64 domains
+	// are always merged sequentially.
+	Workers int
+	// ResolveConflict, if set, is asked how to combine the certificates of
+	// each server URL for which the response holds different certificates,
+	// before merging; Strategy applies to the other servers
+	ResolveConflict ConflictResolver
+}
+
+// parallelMinDomains is the smallest input merged by more than one worker;
+// below it the goroutines cost more than they save.
+const parallelMinDomains = 64
+
+// DefaultOptions returns the options matching the historical merge behavior.
+func DefaultOptions() Options {
+	return Options{Strategy: StrategyReplace}
+}
+
+// ParseStrategy parses a strategy name; an empty name is StrategyReplace.
+func ParseStrategy(s string) (Strategy, error) {
+	if s == "" {
+		return StrategyReplace, nil
+	}
+	for _, strategy := range Strategies {
+		if strings.EqualFold(s, string(strategy)) {
+			return strategy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown merge strategy %q (valid: replace, append, keep)", s)
+}
+
+// UnmatchedError lists response URLs that match no LDAP server in strict mode.
+type UnmatchedError struct {
+	URLs []string
+}
+
+func (e *UnmatchedError) Error() string {
+	return fmt.Sprintf("%d response URL(s) match no LDAP server: %s", len(e.URLs), strings.Join(e.URLs, ", "))
+}
+
+// Validate checks that the response can be merged into domains under the
+// merger's options. It only reports errors in strict mode and, with
+// WeakFail, for weak certificates.
+func (m *Merger) Validate(domains []models.Domain, response *models.CertificateResponse) error {
+	if m.opts.Weak == WeakFail {
+		if weak := WeakCertificates(response, time.Now()); len(weak) > 0 {
+			return &WeakCertificateError{Certificates: weak}
+		}
+	}
+	if !m.opts.Strict {
+		return nil
+	}
+
+	servers := 0
+	for _, domain := range domains {
+		servers += len(domain.LDAPServers)
+	}
+	known := make(map[string]bool, servers)
+	for _, domain := range domains {
+		for _, server := range domain.LDAPServers {
+			known[m.matchKey(server.URL)] = true
+		}
+	}
+	key := m.matchKey
+	if aliases := m.newAliasResolver(domains); aliases != nil {
+		key = aliases.key
+	}
+
+	seen := make(map[string]bool)
+	var unmatched []string
+	for _, result := range response.Results {
+		u := result.Item.URL
+		if u == "" || seen[u] || known[key(u)] {
+			continue
+		}
+		seen[u] = true
+		unmatched = append(unmatched, u)
+	}
+
+	if len(unmatched) > 0 {
+		sort.Strings(unmatched)
+		return &UnmatchedError{URLs: unmatched}
+	}
+	return nil
+}
+
+// matchKey returns the key used to match response URLs to servers.
+func (m *Merger) matchKey(rawURL string) string {
+	if !m.opts.Normalize {
+		return rawURL
+	}
+	return NormalizeURL(rawURL)
+}
+
+// NormalizeURL lowercases the scheme and host of an LDAP URL, adds the
+// default port and drops a trailing slash. Unparseable URLs are returned
+// lowercased and trimmed.
+func NormalizeURL(rawURL string) string {
+	trimmed := strings.TrimRight(strings.TrimSpace(rawURL), "/")
+	if isNormalURL(trimmed) {
+		return trimmed
+	}
+
+	u, err := url.Parse(trimmed)
+	if err != nil || u.Host == "" {
+		return strings.ToLower(trimmed)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" {
+		switch scheme {
+		case "ldaps":
+			port = "636"
+		case "ldap":
+			port = "389"
+		}
+	}
+
+	if port != "" {
+		host += ":" + port
+	}
+	return scheme + "://" + host + u.EscapedPath()
+}
+
+// isNormalURL reports whether rawURL is already in the form NormalizeURL
+// returns, as most URLs are: a lowercase ldap or ldaps scheme and host and
+// an explicit port, without a path. It spares merges a url.Parse per server.
+func isNormalURL(rawURL string) bool {
+	var hostPort string
+	switch {
+	case strings.HasPrefix(rawURL, "ldaps://"):
+		hostPort = rawURL[len("ldaps://"):]
+	case strings.HasPrefix(rawURL, "ldap://"):
+		hostPort = rawURL[len("ldap://"):]
+	default:
+		return false
+	}
+
+	colon := strings.LastIndexByte(hostPort, ':')
+	if colon <= 0 || colon == len(hostPort)-1 {
+		return false
+	}
+	for i := 0; i < len(hostPort); i++ {
+		c := hostPort[i]
+		switch {
+		case i > colon && c >= '0' && c <= '9':
+		case i < colon && (c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-'):
+		case i == colon:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// combine applies the strategy and dedup options to a server's certificates.
+func (m *Merger) combine(strategy Strategy, existing, response []string) []string {
+	var certs []string
+	switch strategy {
+	case StrategyAppend:
+		certs = make([]string, 0, len(existing)+len(response))
+		certs = append(append(certs, existing...), response...)
+	case StrategyKeep:
+		if len(existing) > 0 {
+			certs = existing
+		} else {
+			certs = response
+		}
+	default:
+		certs = response
+	}
+
+	if m.opts.Dedup {
+		certs = dedupCertificates(certs)
+	}
+
+	if len(certs) == 0 {
+		return nil
+	}
+	return certs
+}
+
+// dedupPairwiseMax is the largest certificate list deduplicated by comparing
+// every pair rather than through a map.
+const dedupPairwiseMax = 16
+
+// dedupCertificates removes repeated PEM blocks, ignoring surrounding
+// whitespace. Servers have a handful of certificates, so they are compared
+// pairwise; certs is returned as is, clipped, if it has no duplicates.
+func dedupCertificates(certs []string) []string {
+	if len(certs) > dedupPairwiseMax {
+		return dedupCertificatesMap(certs)
+	}
+
+	var result []string
+	for i, cert := range certs {
+		key := strings.TrimSpace(cert)
+		dup := false
+		for _, prev := range certs[:i] {
+			if strings.TrimSpace(prev) == key {
+				dup = true
+				break
+			}
+		}
+		switch {
+		case dup && result == nil:
+			result = append(make([]string, 0, len(certs)-1), certs[:i]...)
+		case !dup && result != nil:
+			result = append(result, cert)
+		}
+	}
+	if result == nil {
+		return slices.Clip(certs)
+	}
+	return result
+}
+
+// dedupCertificatesMap is dedupCertificates for long lists.
+func dedupCertificatesMap(certs []string) []string {
+	seen := make(map[string]bool, len(certs))
+	result := make([]string, 0, len(certs))
+	for _, cert := range certs {
+		key := strings.TrimSpace(cert)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, cert)
+	}
+	return result
+}
@@ -0,0 +1,150 @@
+package merger_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+)
+
+const (
+	certOld = "-----BEGIN CERTIFICATE-----\nold\n-----END CERTIFICATE-----"
+	certNew = "-----BEGIN CERTIFICATE-----\nnew\n-----END CERTIFICATE-----"
+)
+
+func testInput() ([]models.Domain, *models.CertificateResponse) {
+	domains := []models.Domain{
+		{
+			ID: "example.lab",
+			LDAPServers: []models.LDAPServer{
+				{URL: "ldaps://ad-01.example.lab:636", Certificates: []string{certOld}},
+				{URL: "ldaps://ad-02.example.lab:636"},
+			},
+		},
+	}
+
+	response := &models.CertificateResponse{
+		Results: []models.CertificateResult{
+			{JSON: models.CertificateJSON{PEMEncoded: certNew}, Item: models.ResponseItem{URL: "ldaps://AD-01.example.lab"}},
+			{JSON: models.CertificateJSON{PEMEncoded: certNew}, Item: models.ResponseItem{URL: "ldaps://ad-02.example.lab:636"}},
+			{JSON: models.CertificateJSON{PEMEncoded: certNew}, Item: models.ResponseItem{URL: "ldaps://ad-02.example.lab:636"}},
+		},
+	}
+
+	return domains, response
+}
+
+func TestMergeStrategies(t *testing.T) {
+	cases := []struct {
+		opts merger.Options
+		want [][]string
+	}{
+		{merger.DefaultOptions(), [][]string{nil, {certNew, certNew}}},
+		{merger.Options{Normalize: true}, [][]string{{certNew}, {certNew, certNew}}},
+		{merger.Options{Strategy: merger.StrategyAppend, Normalize: true, Dedup: true}, [][]string{{certOld, certNew}, {certNew}}},
+		{merger.Options{Strategy: merger.StrategyKeep, Normalize: true, Dedup: true}, [][]string{{certOld}, {certNew}}},
+	}
+
+	for _, tc := range cases {
+		domains, response := testInput()
+		result, err := merger.NewWithOptions(tc.opts).Merge(context.Background(), domains, response)
+		if err != nil {
+			t.Fatalf("Merge failed: %v", err)
+		}
+
+		for i, want := range tc.want {
+			got := result[0].LDAPServers[i].Certificates
+			if len(got) != len(want) {
+				t.Errorf("%+v: expected %d certificates for server %d, got %d", tc.opts, len(want), i, len(got))
+				continue
+			}
+			for j := range want {
+				if got[j] != want[j] {
+					t.Errorf("%+v: unexpected certificate %d for server %d: %q", tc.opts, j, i, got[j])
+				}
+			}
+		}
+	}
+}
+
+func TestMergeWithStats(t *testing.T) {
+	domains, response := testInput()
+
+	_, stats, err := merger.New().MergeWithStats(context.Background(), domains, response)
+	if err != nil {
+		t.Fatalf("MergeWithStats failed: %v", err)
+	}
+	if stats.Domains != 1 || stats.Servers != 2 || stats.ResponseResults != 3 {
+		t.Errorf("Unexpected input counts: %+v", stats)
+	}
+	if stats.MatchedServers != 1 || stats.MatchRatio != 0.5 || stats.ResultCertificates != 2 {
+		t.Errorf("Expected only ad-02 to match without normalization, got %+v", stats)
+	}
+
+	_, stats, _ = merger.NewWithOptions(merger.Options{Normalize: true}).MergeWithStats(context.Background(), domains, response)
+	if stats.MatchedServers != 2 || stats.MatchRatio != 1 {
+		t.Errorf("Expected both servers to match with normalization, got %+v", stats)
+	}
+}
+
+func TestMergeStrict(t *testing.T) {
+	domains, response := testInput()
+
+	err := merger.NewWithOptions(merger.Options{Strict: true}).Validate(domains, response)
+	var unmatched *merger.UnmatchedError
+	if !errors.As(err, &unmatched) {
+		t.Fatalf("Expected UnmatchedError, got %v", err)
+	}
+	if len(unmatched.URLs) != 1 || unmatched.URLs[0] != "ldaps://AD-01.example.lab" {
+		t.Errorf("Unexpected unmatched URLs: %v", unmatched.URLs)
+	}
+
+	if err := merger.NewWithOptions(merger.Options{Strict: true, Normalize: true}).Validate(domains, response); err != nil {
+		t.Errorf("Expected normalized URLs to match, got %v", err)
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	cases := map[string]string{
+		"ldaps://dc01.example.lab:636":        "ldaps://dc01.example.lab:636",
+		" ldap://dc01.example.lab:3268/ ":     "ldap://dc01.example.lab:3268",
+		"ldaps://DC01.Example.lab":            "ldaps://dc01.example.lab:636",
+		"LDAP://dc01":                         "ldap://dc01:389",
+		"ldaps://dc01.example.lab:636/ou=Lab": "ldaps://dc01.example.lab:636/ou=Lab",
+		"ldaps://dc01.example.lab:":           "ldaps://dc01.example.lab:636",
+		"not a url":                           "not a url",
+	}
+	for in, want := range cases {
+		if got := merger.NormalizeURL(in); got != want {
+			t.Errorf("NormalizeURL(%q) = %q, expected %q", in, got, want)
+		}
+	}
+}
+
+func TestDedupLongLists(t *testing.T) {
+	var existing []string
+	for i := 0; i < 20; i++ {
+		existing = append(existing, certOld, " "+certNew+"\n")
+	}
+	domains, response := testInput()
+	domains[0].LDAPServers[0].Certificates = existing
+
+	result, err := merger.NewWithOptions(merger.Options{Strategy: merger.StrategyAppend, Normalize: true, Dedup: true}).Merge(context.Background(), domains, response)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	if got := result[0].LDAPServers[0].Certificates; len(got) != 2 || got[0] != certOld {
+		t.Errorf("Expected the two distinct certificates, got %q", got)
+	}
+}
+
+func TestParseStrategy(t *testing.T) {
+	if s, err := merger.ParseStrategy("Append"); err != nil || s != merger.StrategyAppend {
+		t.Errorf("Expected append, got %q (%v)", s, err)
+	}
+	if _, err := merger.ParseStrategy("overwrite"); err == nil {
+		t.Error("Expected error for unknown strategy")
+	}
+}
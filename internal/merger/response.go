@@ -0,0 +1,162 @@
+package merger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"ldapmerge/internal/models"
+)
+
+// DecodeResponse reads a certificate response from r and calls fn with each
+// of its results in order. Results are decoded one at a time, so a response
+// of hundreds of MB is never held in memory as a whole; members other than
+// results, such as Ansible's changed and msg, are skipped. It stops at the
+// first error of fn, which it returns, or when ctx is canceled. Data after
+// the top-level value is an error.
+func DecodeResponse(ctx context.Context, r io.Reader, fn func(models.CertificateResult) error) error {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return expectEnd(dec) // null, as an empty response
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("expected a JSON object, got %v", tok)
+	}
+
+	for dec.More() {
+		if tok, err = dec.Token(); err != nil {
+			return err
+		}
+		if key, _ := tok.(string); key != "results" {
+			if err := skipValue(dec); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := decodeResults(ctx, dec, fn); err != nil {
+			return err
+		}
+	}
+
+	if _, err = dec.Token(); err != nil { // the closing brace
+		return err
+	}
+	return expectEnd(dec)
+}
+
+// expectEnd checks that nothing but whitespace follows the top-level value
+// read by dec.
+func expectEnd(dec *json.Decoder) error {
+	offset := dec.InputOffset()
+	switch _, err := dec.Token(); {
+	case err == io.EOF:
+		return nil
+	case err != nil:
+		return fmt.Errorf("after the response at offset %d: %w", offset, err)
+	default:
+		return fmt.Errorf("unexpected data after the response at offset %d", offset)
+	}
+}
+
+// decodeResults passes the elements of the results array at the decoder's
+// position to fn.
+func decodeResults(ctx context.Context, dec *json.Decoder, fn func(models.CertificateResult) error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("results: expected an array at offset %d, got %v", dec.InputOffset(), tok)
+	}
+
+	for i := 0; dec.More(); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var result models.CertificateResult
+		if err := dec.Decode(&result); err != nil {
+			return fmt.Errorf("results[%d]: %w", i, err)
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+
+	_, err = dec.Token() // the closing bracket
+	return err
+}
+
+// skipValue reads past the value at the decoder's position without keeping
+// it.
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// loadResponse streams the response document at location into a
+// CertificateResponse; a .zip or .tar.gz location is read as an archive of
+// per-host certificate files, see decodeResponseArchive. Repeated PEMs, such as a CA shared by many servers,
+// are interned so that each is kept once.
+func loadResponse(ctx context.Context, location string) (*models.CertificateResponse, Input, error) {
+	r, err := openDocument(ctx, location, InputResponse)
+	if err != nil {
+		return nil, Input{}, err
+	}
+	defer r.Close()
+
+	decode := func(fn func(models.CertificateResult) error) error {
+		return DecodeResponse(ctx, r, fn)
+	}
+	if format := responseArchive(location); format != "" {
+		decode = func(fn func(models.CertificateResult) error) error {
+			return decodeResponseArchive(ctx, r, format, fn)
+		}
+	}
+
+	response := &models.CertificateResponse{}
+	pems := make(map[string]string)
+	err = decode(func(result models.CertificateResult) error {
+		if pem := result.JSON.PEMEncoded; pem != "" {
+			if interned, ok := pems[pem]; ok {
+				result.JSON.PEMEncoded = interned
+			} else {
+				pems[pem] = pem
+			}
+		}
+		response.Results = append(response.Results, result)
+		return nil
+	})
+	if err == nil {
+		err = r.finish()
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, Input{}, ctxErr
+		}
+		return nil, Input{}, fmt.Errorf("failed to parse response JSON: %w", err)
+	}
+	return response, r.input, nil
+}
@@ -0,0 +1,216 @@
+package merger_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+)
+
+func TestDecodeResponse(t *testing.T) {
+	doc := `{
+		"changed": false,
+		"msg": {"nested": [1, {"x": null}]},
+		"results": [
+			{"json": {"pem_encoded": "MIIC"}, "item": {"url": "ldaps://ad-01:636"}, "invocation": {"module_args": {}}},
+			{"json": {}, "item": {"url": "ldaps://ad-02:636"}}
+		],
+		"skipped": false
+	}`
+	var urls []string
+	err := merger.DecodeResponse(context.Background(), strings.NewReader(doc), func(r models.CertificateResult) error {
+		urls = append(urls, r.Item.URL)
+		return nil
+	})
+	if err != nil || len(urls) != 2 || urls[1] != "ldaps://ad-02:636" {
+		t.Errorf("Unexpected results %q: %v", urls, err)
+	}
+
+	for _, doc := range []string{`null`, `{}`, `{"results": null}`, "{\"results\": []}\n"} {
+		if err := merger.DecodeResponse(context.Background(), strings.NewReader(doc), func(models.CertificateResult) error {
+			t.Errorf("Unexpected result in %s", doc)
+			return nil
+		}); err != nil {
+			t.Errorf("DecodeResponse(%s) failed: %v", doc, err)
+		}
+	}
+	for _, doc := range []string{`[]`, `{"results": {}}`, `{"results": [{"item": 1}]}`, `{"results": [{}`, `{"results": []} {}`, `{"results": []}x`, `{}]`, `null null`} {
+		if err := merger.DecodeResponse(context.Background(), strings.NewReader(doc), func(models.CertificateResult) error { return nil }); err == nil {
+			t.Errorf("Expected an error for %s", doc)
+		}
+	}
+
+	stop := errors.New("stop")
+	if err := merger.DecodeResponse(context.Background(), strings.NewReader(doc), func(models.CertificateResult) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("Expected the callback error, got %v", err)
+	}
+}
+
+// TestDecodeResponseStreams checks that results are passed on before the
+// rest of the document is read.
+func TestDecodeResponseStreams(t *testing.T) {
+	pr, pw := io.Pipe()
+	first := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- merger.DecodeResponse(context.Background(), pr, func(r models.CertificateResult) error {
+			select {
+			case first <- r.Item.URL:
+			default:
+			}
+			return nil
+		})
+	}()
+
+	_, _ = io.WriteString(pw, `{"results": [{"item": {"url": "ldaps://ad-01:636"}}, `)
+	select {
+	case url := <-first:
+		if url != "ldaps://ad-01:636" {
+			t.Errorf("Unexpected first result %q", url)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("First result not decoded before the end of the document")
+	}
+	_, _ = io.WriteString(pw, `{"item": {"url": "ldaps://ad-02:636"}}]}`)
+	_ = pw.Close()
+	if err := <-done; err != nil {
+		t.Errorf("DecodeResponse failed: %v", err)
+	}
+}
+
+func TestLoadResponseInternsPEMs(t *testing.T) {
+	_, response := largeInput(100, 4)
+	for i := range response.Results {
+		response.Results[i].JSON.PEMEncoded = certNew
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "response.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := merger.New().LoadResponse(context.Background(), path)
+	if err != nil {
+		t.Fatalf("LoadResponse failed: %v", err)
+	}
+	if len(loaded.Results) != len(response.Results) {
+		t.Fatalf("Expected %d results, got %d", len(response.Results), len(loaded.Results))
+	}
+	first := loaded.Results[0].JSON.PEMEncoded
+	for _, r := range loaded.Results {
+		if r.JSON.PEMEncoded != certNew || unsafe.StringData(r.JSON.PEMEncoded) != unsafe.StringData(first) {
+			t.Fatal("Expected every result to share one PEM string")
+		}
+	}
+}
+
+func BenchmarkLoadResponse(b *testing.B) {
+	_, response := decodedInput(b, 50000, 4)
+	data, err := json.Marshal(response)
+	if err != nil {
+		b.Fatal(err)
+	}
+	path := filepath.Join(b.TempDir(), "response.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		b.Fatal(err)
+	}
+	m := merger.New()
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := m.LoadResponse(ctx, path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestLoadResponseArchive(t *testing.T) {
+	files := []struct{ name, data string }{
+		{"hosts/ad-01/cert.json", `{"json": {"pem_encoded": "PEM-1"}, "item": {"url": "ldaps://ad-01:636"}, "changed": false}`},
+		{"hosts/ad-02/cert.json", `[{"json": {"pem_encoded": "PEM-2"}, "item": {"url": "ldaps://ad-02:636"}}]`},
+		{"hosts/ad-03/response.json", `{"changed": false, "results": [{"json": {"pem_encoded": "PEM-3"}, "item": {"url": "ldaps://ad-03:636"}}]}`},
+		{"hosts/README.txt", "not JSON"},
+		{"__MACOSX/hosts/ad-01/._cert.json", "\x00\x05"},
+	}
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	var tarred bytes.Buffer
+	gz := gzip.NewWriter(&tarred)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.WriteString(w, f.data)
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o600, Size: int64(len(f.data))}); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.WriteString(tw, f.data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	archives := map[string][]byte{"certs.zip": zipped.Bytes(), "certs.tar.gz": tarred.Bytes(), "certs.tgz": tarred.Bytes()}
+	for name, data := range archives {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			response, err := merger.New().LoadResponse(context.Background(), path)
+			if err != nil {
+				t.Fatalf("LoadResponse failed: %v", err)
+			}
+			var pems []string
+			for _, r := range response.Results {
+				pems = append(pems, r.JSON.PEMEncoded)
+			}
+			if strings.Join(pems, ",") != "PEM-1,PEM-2,PEM-3" {
+				t.Errorf("Unexpected results %q", pems)
+			}
+		})
+	}
+
+	// A file that is not a result names itself in the error
+	var bad bytes.Buffer
+	zw = zip.NewWriter(&bad)
+	w, _ := zw.Create("hosts/ad-04/cert.json")
+	_, _ = io.WriteString(w, `{"json": {}}`)
+	_ = zw.Close()
+	path := filepath.Join(dir, "bad.zip")
+	if err := os.WriteFile(path, bad.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := merger.New().LoadResponse(context.Background(), path); err == nil || !strings.Contains(err.Error(), "hosts/ad-04/cert.json") {
+		t.Errorf("Expected an error naming the file, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package merger
+
+import (
+	"slices"
+
+	"ldapmerge/internal/models"
+)
+
+// Rotate returns a copy of domains in which the servers that url matches,
+// as a response URL would, have their certificates combined with certs
+// under the merger's strategy, and the number of such servers. Unlike a
+// merge, the other servers are left as they are.
+func (m *Merger) Rotate(domains []models.Domain, url string, certs []string) ([]models.Domain, int) {
+	key := m.matchKey(url)
+	if aliases := m.newAliasResolver(domains); aliases != nil {
+		key = aliases.key(url)
+	}
+
+	rotated := slices.Clone(domains)
+	count := 0
+	for i := range rotated {
+		cloned := false
+		for j, server := range domains[i].LDAPServers {
+			if m.matchKey(server.URL) != key {
+				continue
+			}
+			if !cloned {
+				rotated[i].LDAPServers = slices.Clone(domains[i].LDAPServers)
+				cloned = true
+			}
+			rotated[i].LDAPServers[j].Certificates = m.combine(m.opts.Strategy, server.Certificates, certs)
+			count++
+		}
+	}
+	return rotated, count
+}
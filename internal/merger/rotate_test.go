@@ -0,0 +1,47 @@
+package merger_test
+
+import (
+	"testing"
+
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+)
+
+func TestRotate(t *testing.T) {
+	domains := []models.Domain{
+		{ID: "a", LDAPServers: []models.LDAPServer{
+			{URL: "ldaps://dc1.example.lab:636", Certificates: []string{certOld}},
+			{URL: "ldaps://dc2.example.lab:636", Certificates: []string{certOld}},
+		}},
+		{ID: "b", LDAPServers: []models.LDAPServer{
+			{URL: "ldaps://dc3.example.lab:636", Certificates: []string{certOld}},
+		}},
+	}
+
+	m := merger.NewWithOptions(merger.Options{Normalize: true})
+	rotated, count := m.Rotate(domains, "ldaps://DC1.example.lab", []string{certNew})
+	if count != 1 {
+		t.Fatalf("Expected 1 server rotated, got %d", count)
+	}
+	if certs := rotated[0].LDAPServers[0].Certificates; len(certs) != 1 || certs[0] != certNew {
+		t.Errorf("Expected the new certificate for dc1, got %q", certs)
+	}
+	for _, server := range []models.LDAPServer{rotated[0].LDAPServers[1], rotated[1].LDAPServers[0]} {
+		if len(server.Certificates) != 1 || server.Certificates[0] != certOld {
+			t.Errorf("Expected %s left as it is, got %q", server.URL, server.Certificates)
+		}
+	}
+	if certs := domains[0].LDAPServers[0].Certificates; certs[0] != certOld {
+		t.Errorf("Expected the input unchanged, got %q", certs)
+	}
+
+	m = merger.NewWithOptions(merger.Options{Strategy: merger.StrategyAppend})
+	rotated, _ = m.Rotate(domains, "ldaps://dc3.example.lab:636", []string{certNew})
+	if certs := rotated[1].LDAPServers[0].Certificates; len(certs) != 2 {
+		t.Errorf("Expected the new certificate appended, got %q", certs)
+	}
+
+	if _, count := m.Rotate(domains, "ldaps://unknown:636", []string{certNew}); count != 0 {
+		t.Errorf("Expected no server rotated, got %d", count)
+	}
+}
@@ -0,0 +1,50 @@
+package merger
+
+import (
+	"fmt"
+	"strings"
+
+	"ldapmerge/internal/models"
+)
+
+// SplitFileNames returns the name of the file of each domain when a result
+// is split into one file per domain: the domain ID with characters other
+// than letters, digits, dots, dashes and underscores replaced by "_", and
+// ".json". Domains without an ID use their name, then their position. Names
+// that would collide, ignoring case, get a "-2", "-3"... suffix in order.
+func SplitFileNames(domains []models.Domain) []string {
+	names := make([]string, len(domains))
+	used := make(map[string]bool, len(domains))
+
+	for i, domain := range domains {
+		base := sanitizeFileName(domain.ID)
+		if base == "" {
+			base = sanitizeFileName(domain.DomainName)
+		}
+		if base == "" {
+			base = fmt.Sprintf("domain-%d", i+1)
+		}
+
+		name := base
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[strings.ToLower(name)] = true
+		names[i] = name + ".json"
+	}
+
+	return names
+}
+
+// sanitizeFileName makes s safe to use as a file name on every platform.
+func sanitizeFileName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(s))
+	// No hidden files, "." or ".."
+	return strings.TrimLeft(s, ".")
+}
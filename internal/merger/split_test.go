@@ -0,0 +1,25 @@
+package merger_test
+
+import (
+	"reflect"
+	"testing"
+
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+)
+
+func TestSplitFileNames(t *testing.T) {
+	domains := []models.Domain{
+		{ID: "example.lab"},
+		{ID: "Example.lab"},
+		{ID: "corp/emea lab"},
+		{DomainName: "named.lab"},
+		{ID: "../etc"},
+		{},
+		{ID: "example.lab-2"},
+	}
+	want := []string{"example.lab.json", "Example.lab-2.json", "corp_emea_lab.json", "named.lab.json", "_etc.json", "domain-6.json", "example.lab-2-2.json"}
+	if got := merger.SplitFileNames(domains); !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitFileNames = %q, expected %q", got, want)
+	}
+}
@@ -0,0 +1,118 @@
+package merger
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"ldapmerge/internal/diff"
+	"ldapmerge/internal/models"
+)
+
+// WeakPolicy controls how a merge treats weak certificates in the response.
+type WeakPolicy string
+
+const (
+	// WeakIgnore merges weak certificates silently
+	WeakIgnore WeakPolicy = "ignore"
+	// WeakWarn merges weak certificates; callers report them
+	WeakWarn WeakPolicy = "warn"
+	// WeakFail fails validation when the response has weak certificates
+	WeakFail WeakPolicy = "fail"
+)
+
+// WeakPolicies lists all supported weak certificate policies.
+var WeakPolicies = []WeakPolicy{WeakIgnore, WeakWarn, WeakFail}
+
+// MinRSABits is the smallest RSA key that is not weak.
+const MinRSABits = 2048
+
+// ParseWeakPolicy parses a policy name; an empty name is WeakWarn.
+func ParseWeakPolicy(s string) (WeakPolicy, error) {
+	if s == "" {
+		return WeakWarn, nil
+	}
+	for _, policy := range WeakPolicies {
+		if strings.EqualFold(s, string(policy)) {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown weak certificate policy %q (valid: ignore, warn, fail)", s)
+}
+
+// WeakCertificate is a response certificate that should not be trusted.
+type WeakCertificate struct {
+	URL         string   `json:"url"`
+	Fingerprint string   `json:"fingerprint"`
+	Subject     string   `json:"subject"`
+	Reasons     []string `json:"reasons"`
+}
+
+func (w WeakCertificate) String() string {
+	return fmt.Sprintf("%s: %s (%s)", w.URL, w.Subject, strings.Join(w.Reasons, ", "))
+}
+
+// WeakCertificateError lists the weak certificates of a response under
+// WeakFail.
+type WeakCertificateError struct {
+	Certificates []WeakCertificate
+}
+
+func (e *WeakCertificateError) Error() string {
+	weak := make([]string, len(e.Certificates))
+	for i, w := range e.Certificates {
+		weak[i] = w.String()
+	}
+	return fmt.Sprintf("%d weak certificate(s) in the response: %s", len(e.Certificates), strings.Join(weak, "; "))
+}
+
+// WeakCertificates returns the certificates of response signed with SHA-1
+// or MD5, with RSA keys shorter than MinRSABits or that are expired CAs as
+// of now. Certificates that do not parse are left to NSX to reject.
+func WeakCertificates(response *models.CertificateResponse, now time.Time) []WeakCertificate {
+	var weak []WeakCertificate
+	for _, result := range response.Results {
+		// A PEM may hold a chain, whose CAs NSX trusts as well
+		rest := []byte(result.JSON.PEMEncoded)
+		for {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				continue
+			}
+			if reasons := weakReasons(cert, now); len(reasons) > 0 {
+				weak = append(weak, WeakCertificate{
+					URL:         result.Item.URL,
+					Fingerprint: diff.Fingerprint(string(pem.EncodeToMemory(block))),
+					Subject:     cert.Subject.String(),
+					Reasons:     reasons,
+				})
+			}
+		}
+	}
+	return weak
+}
+
+// weakReasons returns why cert is weak, if it is.
+func weakReasons(cert *x509.Certificate, now time.Time) []string {
+	var reasons []string
+	if slices.Contains([]x509.SignatureAlgorithm{
+		x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1,
+	}, cert.SignatureAlgorithm) {
+		reasons = append(reasons, cert.SignatureAlgorithm.String()+" signature")
+	}
+	if key, ok := cert.PublicKey.(*rsa.PublicKey); ok && key.N.BitLen() < MinRSABits {
+		reasons = append(reasons, fmt.Sprintf("RSA %d key", key.N.BitLen()))
+	}
+	if cert.IsCA && now.After(cert.NotAfter) {
+		reasons = append(reasons, "CA expired "+cert.NotAfter.UTC().Format(time.DateOnly))
+	}
+	return reasons
+}
@@ -0,0 +1,98 @@
+package merger_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/merger"
+	"ldapmerge/internal/models"
+)
+
+// weakTestCert returns a self-signed PEM certificate for cn with key,
+// signed with alg and valid until notAfter.
+func weakTestCert(t *testing.T, cn string, key crypto.Signer, alg x509.SignatureAlgorithm, isCA bool, notAfter time.Time) string {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:              notAfter,
+		SignatureAlgorithm:    alg,
+		IsCA:                  isCA,
+		BasicConstraintsValid: isCA,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestWeakCertificates(t *testing.T) {
+	now := time.Now()
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strong := weakTestCert(t, "ad-01.example.lab", ecKey, x509.ECDSAWithSHA256, false, now.Add(24*time.Hour))
+	shortRSA := weakTestCert(t, "ad-02.example.lab", rsaKey, x509.SHA1WithRSA, false, now.Add(24*time.Hour))
+	expiredCA := weakTestCert(t, "Example Lab CA", ecKey, x509.ECDSAWithSHA256, true, now.Add(-24*time.Hour))
+
+	domains := []models.Domain{{ID: "example.lab", LDAPServers: []models.LDAPServer{
+		{URL: "ldaps://ad-01.example.lab:636"},
+		{URL: "ldaps://ad-02.example.lab:636"},
+	}}}
+	response := &models.CertificateResponse{Results: []models.CertificateResult{
+		{JSON: models.CertificateJSON{PEMEncoded: strong + expiredCA}, Item: models.ResponseItem{URL: "ldaps://ad-01.example.lab:636"}},
+		{JSON: models.CertificateJSON{PEMEncoded: shortRSA}, Item: models.ResponseItem{URL: "ldaps://ad-02.example.lab:636"}},
+	}}
+
+	weak := merger.WeakCertificates(response, now)
+	if len(weak) != 2 {
+		t.Fatalf("Expected 2 weak certificates, got %+v", weak)
+	}
+	if weak[0].URL != "ldaps://ad-01.example.lab:636" || weak[0].Subject != "CN=Example Lab CA" || len(weak[0].Reasons) != 1 {
+		t.Errorf("Expected the expired CA of ad-01, got %+v", weak[0])
+	}
+	if weak[1].URL != "ldaps://ad-02.example.lab:636" || !slices.Equal(weak[1].Reasons, []string{"SHA1-RSA signature", "RSA 1024 key"}) {
+		t.Errorf("Expected the SHA-1 signature and RSA 1024 key of ad-02, got %+v", weak[1])
+	}
+
+	for _, policy := range []merger.WeakPolicy{merger.WeakIgnore, merger.WeakWarn} {
+		if err := merger.NewWithOptions(merger.Options{Weak: policy}).Validate(domains, response); err != nil {
+			t.Errorf("%s: expected no error, got %v", policy, err)
+		}
+	}
+	var weakErr *merger.WeakCertificateError
+	err = merger.NewWithOptions(merger.Options{Weak: merger.WeakFail}).Validate(domains, response)
+	if !errors.As(err, &weakErr) || len(weakErr.Certificates) != 2 {
+		t.Errorf("Expected WeakCertificateError with 2 certificates, got %v", err)
+	}
+}
+
+func TestParseWeakPolicy(t *testing.T) {
+	for input, want := range map[string]merger.WeakPolicy{"": merger.WeakWarn, "FAIL": merger.WeakFail, "ignore": merger.WeakIgnore} {
+		if got, err := merger.ParseWeakPolicy(input); err != nil || got != want {
+			t.Errorf("ParseWeakPolicy(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	if _, err := merger.ParseWeakPolicy("block"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
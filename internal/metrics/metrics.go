@@ -0,0 +1,201 @@
+// Package metrics implements a minimal Prometheus-compatible metrics registry
+// and the text exposition format served at /metrics.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Type is a Prometheus metric type.
+type Type string
+
+const (
+	// TypeCounter is a monotonically increasing value
+	TypeCounter Type = "counter"
+	// TypeGauge is a value that can go up and down
+	TypeGauge Type = "gauge"
+	// TypeHistogram is a set of cumulative buckets with a sum and count
+	TypeHistogram Type = "histogram"
+)
+
+// Labels are metric label names and values.
+type Labels map[string]string
+
+// Sample is a single value of a metric family.
+type Sample struct {
+	// Suffix is appended to the family name (_bucket, _sum, _count)
+	Suffix string
+	Labels Labels
+	Value  float64
+}
+
+// Family is a named group of samples with the same type and help text.
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []Sample
+}
+
+// Collector produces metric families at scrape time.
+type Collector interface {
+	Collect(ctx context.Context) ([]Family, error)
+}
+
+// CollectorFunc adapts a function to the Collector interface.
+type CollectorFunc func(ctx context.Context) ([]Family, error)
+
+// Collect calls f.
+func (f CollectorFunc) Collect(ctx context.Context) ([]Family, error) {
+	return f(ctx)
+}
+
+// Registry holds collectors and renders their metrics.
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the process-wide registry; the API server exposes it at /metrics.
+var Default = NewRegistry()
+
+// Register adds a collector to the registry.
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Collect implements Collector, so registries can be nested.
+func (r *Registry) Collect(ctx context.Context) ([]Family, error) {
+	return r.Gather(ctx), nil
+}
+
+// Gather collects all families, sorted by name. Families with the same name
+// from different collectors are merged. A failing collector is logged and
+// skipped so one broken source does not blank the whole scrape.
+func (r *Registry) Gather(ctx context.Context) []Family {
+	r.mu.RLock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	byName := make(map[string]*Family)
+	var names []string
+	for _, c := range collectors {
+		families, err := c.Collect(ctx)
+		if err != nil {
+			slog.Warn("metrics collector failed", "error", err)
+			continue
+		}
+		for _, f := range families {
+			existing, ok := byName[f.Name]
+			if !ok {
+				f := f
+				byName[f.Name] = &f
+				names = append(names, f.Name)
+				continue
+			}
+			existing.Samples = append(existing.Samples, f.Samples...)
+		}
+	}
+
+	sort.Strings(names)
+	result := make([]Family, 0, len(names))
+	for _, name := range names {
+		result = append(result, *byName[name])
+	}
+	return result
+}
+
+// WriteText writes all metrics in the Prometheus text exposition format.
+func (r *Registry) WriteText(ctx context.Context, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range r.Gather(ctx) {
+		if f.Help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		}
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.Name, f.Type)
+		for _, s := range f.Samples {
+			bw.WriteString(f.Name)
+			bw.WriteString(s.Suffix)
+			writeLabels(bw, s.Labels)
+			bw.WriteByte(' ')
+			bw.WriteString(formatValue(s.Value))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler returns an HTTP handler serving the registry's metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteText(req.Context(), w)
+	})
+}
+
+func writeLabels(w *bufio.Writer, labels Labels) {
+	if len(labels) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(name)
+		w.WriteString(`="`)
+		w.WriteString(escapeLabelValue(labels[name]))
+		w.WriteByte('"')
+	}
+	w.WriteByte('}')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
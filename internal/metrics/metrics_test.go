@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	r.Register(CollectorFunc(func(context.Context) ([]Family, error) {
+		return []Family{{
+			Name: "test_gauge",
+			Help: "A gauge\nwith two lines.",
+			Type: TypeGauge,
+			Samples: []Sample{
+				{Labels: Labels{"url": `ldaps://a"b`, "domain": "example.lab"}, Value: 1.5},
+				{Value: math.Inf(1)},
+			},
+		}}, nil
+	}))
+	r.Register(CollectorFunc(func(context.Context) ([]Family, error) {
+		return nil, errors.New("broken")
+	}))
+
+	nested := NewRegistry()
+	nested.Register(CollectorFunc(func(context.Context) ([]Family, error) {
+		return []Family{
+			{Name: "test_gauge", Type: TypeGauge, Samples: []Sample{{Labels: Labels{"domain": "example.org"}, Value: 2}}},
+			{Name: "a_counter", Type: TypeCounter, Samples: []Sample{{Value: 3}}},
+		}, nil
+	}))
+	r.Register(nested)
+
+	var sb strings.Builder
+	if err := r.WriteText(context.Background(), &sb); err != nil {
+		t.Fatalf("WriteText failed: %v", err)
+	}
+
+	expected := `# TYPE a_counter counter
+a_counter 3
+# HELP test_gauge A gauge\nwith two lines.
+# TYPE test_gauge gauge
+test_gauge{domain="example.lab",url="ldaps://a\"b"} 1.5
+test_gauge +Inf
+test_gauge{domain="example.org"} 2
+`
+	if sb.String() != expected {
+		t.Errorf("Unexpected exposition:\n%s\nExpected:\n%s", sb.String(), expected)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "Test durations.", []float64{1, 0.1}, "op")
+	h.Observe(0.05, "pull")
+	h.Observe(0.5, "pull")
+	h.Observe(5, "pull")
+
+	families, err := h.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	var sb strings.Builder
+	for _, s := range families[0].Samples {
+		sb.WriteString(s.Suffix + " " + s.Labels["le"] + " " + formatValue(s.Value) + "\n")
+	}
+
+	expected := `_bucket 0.1 1
+_bucket 1 2
+_bucket +Inf 3
+_sum  5.55
+_count  3
+`
+	if sb.String() != expected {
+		t.Errorf("Unexpected samples:\n%s\nExpected:\n%s", sb.String(), expected)
+	}
+}
@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefBuckets are the default histogram buckets, in seconds, suited to
+// request and merge latencies.
+var DefBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// vec holds one value per combination of label values.
+type vec[V any] struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]*V
+	newV   func() *V
+}
+
+func newVec[V any](name, help string, labelNames []string, newV func() *V) *vec[V] {
+	return &vec[V]{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		values:     make(map[string]*V),
+		newV:       newV,
+	}
+}
+
+// get returns the value for labelValues, creating it on first use. Missing
+// label values are treated as empty; extra values are ignored.
+func (v *vec[V]) get(labelValues []string) *V {
+	key := strings.Join(labelValues, "\xff")
+	value, ok := v.values[key]
+	if !ok {
+		value = v.newV()
+		v.values[key] = value
+	}
+	return value
+}
+
+// each calls fn for every value in a stable order, with v.mu held.
+func (v *vec[V]) each(fn func(labels Labels, value *V)) {
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		labels := make(Labels, len(v.labelNames))
+		values := strings.Split(key, "\xff")
+		for i, name := range v.labelNames {
+			if i < len(values) {
+				labels[name] = values[i]
+			} else {
+				labels[name] = ""
+			}
+		}
+		fn(labels, v.values[key])
+	}
+}
+
+// CounterVec is a set of counters partitioned by labels.
+type CounterVec struct {
+	*vec[float64]
+}
+
+// NewCounterVec creates a counter family and registers it with Default.
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{newVec(name, help, labelNames, func() *float64 { return new(float64) })}
+	Default.Register(c)
+	return c
+}
+
+// Inc increments the counter for labelValues by one.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for labelValues by delta, which must not be negative.
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.get(labelValues) += delta
+}
+
+// Collect implements Collector.
+func (c *CounterVec) Collect(context.Context) ([]Family, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f := Family{Name: c.name, Help: c.help, Type: TypeCounter}
+	c.each(func(labels Labels, value *float64) {
+		f.Samples = append(f.Samples, Sample{Labels: labels, Value: *value})
+	})
+	return []Family{f}, nil
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is a set of histograms partitioned by labels.
+type HistogramVec struct {
+	*vec[histogram]
+	buckets []float64
+}
+
+// NewHistogramVec creates a histogram family with the given upper bucket
+// bounds and registers it with Default. Nil buckets use DefBuckets.
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{buckets: buckets}
+	h.vec = newVec(name, help, labelNames, func() *histogram {
+		return &histogram{counts: make([]uint64, len(buckets))}
+	})
+	Default.Register(h)
+	return h
+}
+
+// Observe adds a value to the histogram for labelValues.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hist := h.get(labelValues)
+	for i, bound := range h.buckets {
+		if value <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.sum += value
+	hist.count++
+}
+
+// ObserveDuration adds the seconds elapsed since start to the histogram.
+func (h *HistogramVec) ObserveDuration(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Collect implements Collector.
+func (h *HistogramVec) Collect(context.Context) ([]Family, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f := Family{Name: h.name, Help: h.help, Type: TypeHistogram}
+	h.each(func(labels Labels, hist *histogram) {
+		for i, bound := range h.buckets {
+			f.Samples = append(f.Samples, Sample{
+				Suffix: "_bucket",
+				Labels: withLabel(labels, "le", formatValue(bound)),
+				Value:  float64(hist.counts[i]),
+			})
+		}
+		f.Samples = append(f.Samples,
+			Sample{Suffix: "_bucket", Labels: withLabel(labels, "le", formatValue(math.Inf(1))), Value: float64(hist.count)},
+			Sample{Suffix: "_sum", Labels: labels, Value: hist.sum},
+			Sample{Suffix: "_count", Labels: labels, Value: float64(hist.count)},
+		)
+	})
+	return []Family{f}, nil
+}
+
+func withLabel(labels Labels, name, value string) Labels {
+	result := make(Labels, len(labels)+1)
+	for k, v := range labels {
+		result[k] = v
+	}
+	result[name] = value
+	return result
+}
+
+// StatusLabel formats an HTTP status code for use as a label value; zero
+// (no response) becomes "error".
+func StatusLabel(code int) string {
+	if code == 0 {
+		return "error"
+	}
+	return strconv.Itoa(code)
+}
@@ -0,0 +1,174 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Extra holds the members of a JSON object that its Go type has no field
+// for, such as fields newer NSX releases add to identity sources, so that
+// decoding and encoding the object again does not drop them.
+type Extra map[string]json.RawMessage
+
+// knownMembers caches the member names of struct types, lowercased.
+var knownMembers sync.Map // reflect.Type -> map[string]bool
+
+// DecodeExtra decodes the JSON object data into v, a pointer to a struct,
+// and returns the members v has no field for, or nil if there are none.
+// Like encoding/json, it matches member names to fields ignoring case.
+func DecodeExtra(data []byte, v any) (Extra, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return nil, nil // null
+	}
+
+	known := members(reflect.TypeOf(v))
+	var extra Extra
+	// data is valid JSON: scan the members of the object without decoding
+	// them, so that objects without extra members cost no allocations
+	for i := 1; ; {
+		i = skipSpace(data, i)
+		if data[i] == '}' {
+			return extra, nil
+		}
+		keyStart, keyEnd := i, skipString(data, i)
+		key := data[keyStart+1 : keyEnd-1]
+		i = skipSpace(data, keyEnd) + 1 // ':'
+		i = skipSpace(data, i)
+		valueEnd := skipValue(data, i)
+
+		if !known[string(key)] {
+			name := string(key)
+			if bytes.IndexByte(key, '\\') >= 0 {
+				_ = json.Unmarshal(data[keyStart:keyEnd], &name)
+			}
+			if !known[strings.ToLower(name)] {
+				if extra == nil {
+					extra = make(Extra)
+				}
+				extra[name] = bytes.Clone(data[i:valueEnd])
+			}
+		}
+
+		i = skipSpace(data, valueEnd)
+		if data[i] == ',' {
+			i++
+		}
+	}
+}
+
+// EncodeExtra encodes v, a struct, with the members of extra appended in
+// name order. Members v has a field for are left out.
+func EncodeExtra(v any, extra Extra) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	known := members(reflect.TypeOf(v))
+	names := make([]string, 0, len(extra))
+	for name := range extra {
+		if !known[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	data = data[:len(data)-1] // '}'
+	for _, name := range names {
+		if data[len(data)-1] != '{' {
+			data = append(data, ',')
+		}
+		key, _ := json.Marshal(name)
+		data = append(data, key...)
+		data = append(data, ':')
+		data = append(data, extra[name]...)
+	}
+	return append(data, '}'), nil
+}
+
+// members returns the lowercased JSON member names of the fields of the
+// struct type t.
+func members(t reflect.Type) map[string]bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if known, ok := knownMembers.Load(t); ok {
+		return known.(map[string]bool)
+	}
+
+	known := make(map[string]bool)
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			switch {
+			case name == "-":
+				continue
+			case f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct:
+				add(f.Type)
+				continue
+			case !f.IsExported():
+				continue
+			case name == "":
+				name = f.Name
+			}
+			known[strings.ToLower(name)] = true
+		}
+	}
+	add(t)
+
+	knownMembers.Store(t, known)
+	return known
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// skipString returns the index after the JSON string starting at data[i].
+func skipString(data []byte, i int) int {
+	for i++; data[i] != '"'; i++ {
+		if data[i] == '\\' {
+			i++
+		}
+	}
+	return i + 1
+}
+
+// skipValue returns the index after the JSON value starting at data[i].
+func skipValue(data []byte, i int) int {
+	switch data[i] {
+	case '"':
+		return skipString(data, i)
+	case '{', '[':
+		depth := 0
+		for ; ; i++ {
+			switch data[i] {
+			case '"':
+				i = skipString(data, i) - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+		}
+	}
+	for i < len(data) && !strings.ContainsRune(",}] \t\n\r", rune(data[i])) {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,51 @@
+package models_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"ldapmerge/internal/models"
+)
+
+func TestDomainExtra(t *testing.T) {
+	doc := `{ "id" : "a", "URL_mode": "x", "Domain_Name": "a.lab", "ldap_servers": [{"url": "ldap://a:389", "pool": [1, {"s": "}]\""}]}],
+		"future": {"nested": ["{", "]"]}, "name": null, "flag": true, "\u0066lag2": 2, "\u0062ase_dn": "DC=a" }`
+
+	var domain models.Domain
+	if err := json.Unmarshal([]byte(doc), &domain); err != nil {
+		t.Fatal(err)
+	}
+	if domain.DomainName != "a.lab" || domain.BaseDN != "DC=a" {
+		t.Errorf("Expected members to match fields ignoring case, got %+v", domain)
+	}
+	want := map[string]string{"URL_mode": `"x"`, "future": `{"nested": ["{", "]"]}`, "name": "null", "flag": "true", "flag2": "2"}
+	if len(domain.Extra) != len(want) {
+		t.Errorf("Expected extra members %v, got %v", want, domain.Extra)
+	}
+	for name, value := range want {
+		if string(domain.Extra[name]) != value {
+			t.Errorf("Extra[%q] = %s; expected %s", name, domain.Extra[name], value)
+		}
+	}
+	if got := string(domain.LDAPServers[0].Extra["pool"]); got != `[1, {"s": "}]\""}]` {
+		t.Errorf("Unexpected server extra %s", got)
+	}
+
+	data, err := json.Marshal(domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again models.Domain
+	if err := json.Unmarshal(data, &again); err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Extra) != len(want) || len(again.LDAPServers[0].Extra) != 1 {
+		t.Errorf("Expected extra members to survive encoding, got %s", data)
+	}
+
+	// Extra members do not override fields
+	domain.Extra["id"] = json.RawMessage(`"b"`)
+	if data, _ := json.Marshal(domain); json.Unmarshal(data, &again) != nil || again.ID != "a" {
+		t.Errorf("Expected the field to win over Extra, got %s", data)
+	}
+}
@@ -15,6 +15,25 @@ type LDAPServer struct {
 	BindUsername string   `json:"bind_username,omitempty" doc:"Bind username for LDAP authentication" example:"sync@example.lab"`
 	BindPassword string   `json:"bind_password,omitempty" doc:"Bind password (write-only)"`
 	Certificates []string `json:"certificates,omitempty" doc:"PEM-encoded SSL certificates"`
+
+	// Extra holds the members ldapmerge does not know, such as NSX fields
+	// added in newer releases; they are kept through conversions.
+	Extra Extra    `json:"-"`
+	_     struct{} `additionalProperties:"true"`
+}
+
+// UnmarshalJSON decodes s, keeping unknown members in s.Extra.
+func (s *LDAPServer) UnmarshalJSON(data []byte) error {
+	type plain LDAPServer
+	extra, err := DecodeExtra(data, (*plain)(s))
+	s.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes s with the members of s.Extra.
+func (s LDAPServer) MarshalJSON() ([]byte, error) {
+	type plain LDAPServer
+	return EncodeExtra(plain(s), s.Extra)
 }
 
 // Domain represents a domain configuration with LDAP servers.
@@ -24,6 +43,35 @@ type Domain struct {
 	BaseDN                 string       `json:"base_dn" doc:"LDAP base distinguished name" example:"DC=example,DC=lab"`
 	AlternativeDomainNames []string     `json:"alternative_domain_names" doc:"Alternative domain names for this domain"`
 	LDAPServers            []LDAPServer `json:"ldap_servers" doc:"List of LDAP servers for this domain"`
+	DisplayName            string       `json:"display_name,omitempty" doc:"NSX display name; the domain name if empty" example:"Example Lab Domain"`
+	Description            string       `json:"description,omitempty" doc:"NSX description of the identity source"`
+	Tags                   []Tag        `json:"tags,omitempty" doc:"NSX tags of the identity source"`
+	Revision               *int64       `json:"_revision,omitempty" doc:"NSX revision of the identity source when pulled; a push fails if it has changed since"`
+
+	// Extra holds the members ldapmerge does not know, such as NSX fields
+	// added in newer releases; they are kept through conversions.
+	Extra Extra    `json:"-"`
+	_     struct{} `additionalProperties:"true"`
+}
+
+// UnmarshalJSON decodes d, keeping unknown members in d.Extra.
+func (d *Domain) UnmarshalJSON(data []byte) error {
+	type plain Domain
+	extra, err := DecodeExtra(data, (*plain)(d))
+	d.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes d with the members of d.Extra.
+func (d Domain) MarshalJSON() ([]byte, error) {
+	type plain Domain
+	return EncodeExtra(plain(d), d.Extra)
+}
+
+// Tag is an NSX tag.
+type Tag struct {
+	Scope string `json:"scope,omitempty" doc:"Tag scope" example:"owner"`
+	Tag   string `json:"tag" doc:"Tag value" example:"iam-team"`
 }
 
 // CertificateDetail contains certificate subject info.
@@ -98,11 +146,73 @@ func (j *JSON[T]) Scan(value interface{}) error {
 
 // HistoryEntry represents a merge operation history record.
 type HistoryEntry struct {
-	ID        int64                     `json:"id" doc:"Unique identifier" example:"1"`
-	CreatedAt time.Time                 `json:"created_at" doc:"Timestamp when merge was performed" format:"date-time"`
-	Initial   JSON[[]Domain]            `json:"initial" doc:"Original domain configurations before merge"`
-	Response  JSON[CertificateResponse] `json:"response" doc:"Certificate response data used for merge"`
-	Result    JSON[[]Domain]            `json:"result" doc:"Final merged domain configurations with certificates"`
+	ID          int64                     `json:"id" doc:"Unique identifier" example:"1"`
+	CreatedAt   time.Time                 `json:"created_at" doc:"Timestamp when merge was performed" format:"date-time"`
+	Initial     JSON[[]Domain]            `json:"initial" doc:"Original domain configurations before merge"`
+	Response    JSON[CertificateResponse] `json:"response" doc:"Certificate response data used for merge"`
+	Result      JSON[[]Domain]            `json:"result" doc:"Final merged domain configurations with certificates"`
+	ArtifactKey string                    `json:"artifact_key,omitempty" doc:"Object store key prefix when the data is stored outside the database" example:"history/20250115T103000Z-3f9a2c1b"`
+	Stats       *MergeStats               `json:"stats,omitempty" doc:"Merge timing and matching statistics; absent for entries recorded by older versions"`
+	Size        int64                     `json:"size" doc:"Size in bytes of the uncompressed initial, response and result JSON" example:"48213"`
+	Tenant      string                    `json:"tenant,omitempty" doc:"Tenant of the entry; empty for the default tenant" example:"team-a"`
+	RunID       string                    `json:"run_id,omitempty" doc:"Run ID of the merge, also in its log records and NSX request ids" example:"20250115T103000Z-3f9a2c1b"`
+}
+
+// Summary returns the entry without its data.
+func (e *HistoryEntry) Summary() HistorySummary {
+	summary := HistorySummary{
+		ID:          e.ID,
+		CreatedAt:   e.CreatedAt,
+		ArtifactKey: e.ArtifactKey,
+		Stats:       e.Stats,
+		Size:        e.Size,
+		Tenant:      e.Tenant,
+		RunID:       e.RunID,
+		Domains:     len(e.Result.Data),
+	}
+	for _, domain := range e.Result.Data {
+		summary.Servers += len(domain.LDAPServers)
+		for _, server := range domain.LDAPServers {
+			summary.Certificates += len(server.Certificates)
+		}
+	}
+	return summary
+}
+
+// HistorySummary describes a merge operation history record without its
+// data.
+type HistorySummary struct {
+	ID           int64       `json:"id" doc:"Unique identifier" example:"1"`
+	CreatedAt    time.Time   `json:"created_at" doc:"Timestamp when merge was performed" format:"date-time"`
+	ArtifactKey  string      `json:"artifact_key,omitempty" doc:"Object store key prefix when the data is stored outside the database" example:"history/20250115T103000Z-3f9a2c1b"`
+	Stats        *MergeStats `json:"stats,omitempty" doc:"Merge timing and matching statistics; absent for entries recorded by older versions"`
+	Size         int64       `json:"size" doc:"Size in bytes of the uncompressed initial, response and result JSON" example:"48213"`
+	Domains      int         `json:"domains" doc:"Domains in the merged result" example:"2"`
+	Servers      int         `json:"servers" doc:"LDAP servers in the merged result" example:"3"`
+	Certificates int         `json:"certificates" doc:"Certificates in the merged result" example:"3"`
+	Tenant       string      `json:"tenant,omitempty" doc:"Tenant of the entry; empty for the default tenant" example:"team-a"`
+	RunID        string      `json:"run_id,omitempty" doc:"Run ID of the merge, also in its log records and NSX request ids" example:"20250115T103000Z-3f9a2c1b"`
+}
+
+// MergeStats describes the inputs, matching and timing of a merge.
+type MergeStats struct {
+	DurationMS         float64 `json:"duration_ms" doc:"Merge duration in milliseconds" example:"1.8"`
+	Domains            int     `json:"domains" doc:"Number of initial domains" example:"2"`
+	Servers            int     `json:"servers" doc:"Number of LDAP servers in the initial domains" example:"3"`
+	ResponseResults    int     `json:"response_results" doc:"Number of results in the certificate response" example:"3"`
+	MatchedServers     int     `json:"matched_servers" doc:"LDAP servers that matched a response URL" example:"2"`
+	MatchRatio         float64 `json:"match_ratio" doc:"matched_servers / servers; 0 without servers" example:"0.67"`
+	ResultCertificates int     `json:"result_certificates" doc:"Certificates in the merged result" example:"2"`
+	InputBytes         int64   `json:"input_bytes,omitempty" doc:"Size of the initial and response JSON" example:"5120"`
+}
+
+// DisabledServer is an LDAP server disabled before a push because it kept
+// failing probes or its certificates expired.
+type DisabledServer struct {
+	Domain string `json:"domain" doc:"Identity source (domain) ID" example:"example.lab"`
+	URL    string `json:"url" doc:"LDAP server URL" example:"ldaps://ad-01.example.lab:636"`
+	Reason string `json:"reason" doc:"Why the server was disabled" example:"failed the last 3 probes"`
+	Kept   bool   `json:"kept,omitempty" doc:"True when the server was left enabled as the last enabled server of its domain"`
 }
 
 // NSXConfig represents a saved NSX configuration.
@@ -116,4 +226,155 @@ type NSXConfig struct {
 	Insecure    bool      `json:"insecure" doc:"Skip TLS certificate verification" example:"false"`
 	CreatedAt   time.Time `json:"created_at,omitempty" doc:"Creation timestamp" format:"date-time"`
 	UpdatedAt   time.Time `json:"updated_at,omitempty" doc:"Last update timestamp" format:"date-time"`
+	Tenant      string    `json:"tenant,omitempty" doc:"Tenant of the configuration; set from the API key, or by API keys without a tenant" example:"team-a"`
+
+	SyncDefaults *SyncDefaults `json:"sync_defaults,omitempty" doc:"Options of syncs and pushes to this NSX Manager that do not set them"`
+}
+
+// SyncDefaults are the sync options saved with an NSX configuration, so that
+// every sync and push to its manager behaves the same without repeating them.
+type SyncDefaults struct {
+	DryRun   bool     `json:"dry_run,omitempty" doc:"Merge and report without pushing to NSX unless the request sets dry_run to false"`
+	Strategy string   `json:"strategy,omitempty" enum:"replace,append,keep" doc:"Certificate merge strategy; empty uses the server's" example:"append"`
+	Domains  []string `json:"domains,omitempty" doc:"Glob patterns of the identity source IDs to sync; empty syncs all" example:"[\"*.example.lab\"]"`
+	Canary   string   `json:"canary,omitempty" doc:"ID of an identity source pushed first; the others are pushed only if NSX accepts it" example:"lab.example.lab"`
+}
+
+// DocumentKind identifies what a stored document contains.
+type DocumentKind string
+
+const (
+	// DocumentInitial is an array of domain configurations
+	DocumentInitial DocumentKind = "initial"
+	// DocumentResponse is a certificate response
+	DocumentResponse DocumentKind = "response"
+)
+
+// Document is an uploaded initial or response JSON document that merge and
+// sync requests can reference by ID instead of resending it.
+type Document struct {
+	ID        int64           `json:"id,omitempty" doc:"Unique identifier" example:"1"`
+	Name      string          `json:"name" doc:"Document name" minLength:"1" maxLength:"255" example:"prod-initial"`
+	Kind      DocumentKind    `json:"kind" doc:"Document content type" enum:"initial,response" example:"initial"`
+	Size      int64           `json:"size,omitempty" doc:"Content size in bytes" example:"2048"`
+	SHA256    string          `json:"sha256,omitempty" doc:"SHA-256 of the content" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	CreatedAt time.Time       `json:"created_at,omitempty" doc:"Upload timestamp" format:"date-time"`
+	Tenant    string          `json:"tenant,omitempty" doc:"Tenant of the document, set from the API key; empty for the default tenant" example:"team-a"`
+	Content   json.RawMessage `json:"content,omitempty" doc:"Document content; omitted in lists"`
+}
+
+// InventoryServer is an LDAP server in the inventory, as last seen in an
+// NSX pull and probe.
+type InventoryServer struct {
+	ID                  int64      `json:"id" doc:"Unique identifier" example:"1"`
+	NSXHost             string     `json:"nsx_host" doc:"NSX Manager the server was pulled from" example:"https://nsx.example.com"`
+	DomainID            string     `json:"domain_id" doc:"Identity source (domain) ID" example:"example.lab"`
+	URL                 string     `json:"url" doc:"LDAP server URL" example:"ldaps://ad-01.example.lab:636"`
+	Enabled             bool       `json:"enabled" doc:"Server enabled in NSX"`
+	CertFingerprint     string     `json:"cert_fingerprint,omitempty" doc:"SHA-256 fingerprint of the server's leaf certificate"`
+	CertSubject         string     `json:"cert_subject,omitempty" doc:"Certificate subject common name" example:"ad-01.example.lab"`
+	CertExpiresAt       *time.Time `json:"cert_expires_at,omitempty" doc:"Certificate expiry" format:"date-time"`
+	CertCount           int        `json:"cert_count" doc:"Number of certificates configured for the server in NSX" example:"2"`
+	LastProbeAt         *time.Time `json:"last_probe_at,omitempty" doc:"Time of the last probe" format:"date-time"`
+	LastProbeOK         *bool      `json:"last_probe_ok,omitempty" doc:"Result of the last probe"`
+	LastProbeError      string     `json:"last_probe_error,omitempty" doc:"Error reported by the last failed probe"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty" doc:"Time of the last failed probe in the probe history" format:"date-time"`
+	ConsecutiveFailures int        `json:"consecutive_failures" doc:"Failed probes since the last successful one" example:"0"`
+	Uptime              *float64   `json:"uptime,omitempty" doc:"Percentage of successful probes in the probe history; omitted before the first probe" example:"99.5"`
+	ProbeCount          int        `json:"probe_count" doc:"Number of probes in the probe history" example:"200"`
+	Failing             bool       `json:"failing" doc:"True when consecutive_failures reached the server's failure threshold"`
+	FirstSeenAt         time.Time  `json:"first_seen_at" doc:"First pull that included the server" format:"date-time"`
+	LastSeenAt          time.Time  `json:"last_seen_at" doc:"Last pull that included the server" format:"date-time"`
+}
+
+// ProbeRecord is one entry of an inventory server's probe history.
+type ProbeRecord struct {
+	ProbedAt time.Time `json:"probed_at" doc:"Probe timestamp" format:"date-time"`
+	Success  bool      `json:"success" doc:"True if NSX reached the server"`
+	Error    string    `json:"error,omitempty" doc:"Error reported by NSX" example:"connection refused"`
+}
+
+// AuditEvent records a change made to NSX identity sources and the reason
+// given for it.
+type AuditEvent struct {
+	ID        int64     `json:"id" doc:"Unique identifier" example:"1"`
+	CreatedAt time.Time `json:"created_at" doc:"Time of the change" format:"date-time"`
+	Operation string    `json:"operation" doc:"What was done" enum:"nsx.push,nsx.delete,sync.push,history.push,snapshot.restore,bundle.push,api.request" example:"nsx.push"`
+	Origin    string    `json:"origin" doc:"Where the change was made" enum:"cli,api" example:"cli"`
+	Actor     string    `json:"actor,omitempty" doc:"Operating system user for CLI changes; API key name, oidc:<user> or cert:<subject> for API requests" example:"jdoe"`
+	NSXHost   string    `json:"nsx_host" doc:"NSX Manager the change was made on; empty for api.request" example:"https://nsx.example.com"`
+	SourceIDs []string  `json:"source_ids" doc:"Identity sources the change targeted" example:"[\"example.lab\"]"`
+	Protected []string  `json:"protected_source_ids,omitempty" doc:"Targeted sources matching a protected_sources pattern" example:"[\"prod.example.com\"]"`
+	Reason    string    `json:"reason" doc:"Justification given by the operator" example:"CHG-1234: renew AD certificates"`
+	Outcome   string    `json:"outcome" doc:"success if every source was changed, partial if some failed, failed if none was, refused if protected sources were targeted without force" enum:"success,partial,failed,refused" example:"success"`
+	Error     string    `json:"error,omitempty" doc:"First error reported by NSX, or why the change was refused"`
+	RunID     string    `json:"run_id,omitempty" doc:"Run ID of the command or API request that made the change, also in its log records and NSX request ids" example:"20250115T103000Z-3f9a2c1b"`
+	// ClientCert is the subject of the client certificate of an API change
+	// made over mutual TLS
+	ClientCert string `json:"client_cert,omitempty" doc:"Subject of the TLS client certificate of an API change made over mutual TLS" example:"CN=ansible,OU=Automation,O=Example"`
+	// SourceIP is the address of the client of an API change; behind a
+	// reverse proxy, the proxy
+	SourceIP string `json:"source_ip,omitempty" doc:"IP address of the client of an API change" example:"192.0.2.10"`
+	// Method, Path, Status and BodySHA256 describe an api.request; the
+	// body is hashed rather than stored because it may hold credentials
+	Method     string `json:"method,omitempty" doc:"HTTP method of an api.request" example:"POST"`
+	Path       string `json:"path,omitempty" doc:"Path of an api.request" example:"/api/configs"`
+	Status     int    `json:"status,omitempty" doc:"HTTP status of the response to an api.request" example:"201"`
+	BodySHA256 string `json:"body_sha256,omitempty" doc:"Hex SHA-256 of the body of an api.request" example:"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"`
+}
+
+// Snapshot is the state of NSX identity sources captured before a push, so
+// the push can be rolled back.
+type Snapshot struct {
+	ID        int64            `json:"id" doc:"Unique identifier" example:"1"`
+	CreatedAt time.Time        `json:"created_at" doc:"Time the state was captured" format:"date-time"`
+	HistoryID *int64           `json:"history_id,omitempty" doc:"History entry whose push the snapshot precedes" example:"12"`
+	Operation string           `json:"operation" doc:"Push or restore the snapshot precedes" enum:"nsx.push,sync.push,history.push,snapshot.restore" example:"sync.push"`
+	NSXHost   string           `json:"nsx_host" doc:"NSX Manager the state was read from" example:"https://nsx.example.com"`
+	Tenant    string           `json:"tenant,omitempty" doc:"Tenant of the push; empty for the default tenant" example:"team-a"`
+	Sources   []SnapshotSource `json:"sources" doc:"State of each pushed identity source"`
+}
+
+// SnapshotSource is the state of one identity source before a push.
+type SnapshotSource struct {
+	ID      string          `json:"id" doc:"Identity source ID" example:"example.lab"`
+	Existed bool            `json:"existed" doc:"False if the source did not exist; restoring the snapshot deletes it"`
+	Source  json.RawMessage `json:"source,omitempty" doc:"Identity source as returned by NSX Manager; absent if it did not exist or in snapshot lists"`
+}
+
+// Setting is a runtime setting of the API server, stored as text in the
+// format of the API.
+type Setting struct {
+	Key       string    `json:"key"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+}
+
+// HealthSnapshot is the health of the API server at one point in time,
+// recorded periodically so that slow degradations show over time.
+type HealthSnapshot struct {
+	ID       int64          `json:"id" doc:"Unique identifier" example:"1"`
+	TakenAt  time.Time      `json:"taken_at" doc:"Time the snapshot was taken" format:"date-time"`
+	Database DatabaseSample `json:"database" doc:"State of the database"`
+	NSX      []NSXSample    `json:"nsx" doc:"Reachability of each saved NSX configuration"`
+}
+
+// DatabaseSample is the state of the database in a health snapshot.
+type DatabaseSample struct {
+	OK           bool   `json:"ok" doc:"Whether the database could be read"`
+	Error        string `json:"error,omitempty" doc:"Error of the database check"`
+	Size         int64  `json:"size" doc:"Database file size in bytes" example:"45056"`
+	HistoryCount int64  `json:"history_count" doc:"Number of history entries" example:"10"`
+}
+
+// NSXSample is the reachability of the NSX Manager of a saved
+// configuration in a health snapshot.
+type NSXSample struct {
+	ConfigID  int64   `json:"config_id" doc:"NSX configuration ID" example:"1"`
+	Name      string  `json:"name" doc:"NSX configuration name" example:"production-nsx"`
+	Host      string  `json:"host" doc:"NSX Manager URL" example:"https://nsx.example.com"`
+	Reachable bool    `json:"reachable" doc:"Whether the NSX Manager listed its identity sources with the stored credentials"`
+	Error     string  `json:"error,omitempty" doc:"Error of an unreachable NSX Manager"`
+	LatencyMS float64 `json:"latency_ms" doc:"Duration of the check in milliseconds" example:"84.2"`
 }
@@ -0,0 +1,149 @@
+package nsx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// MaxPushConcurrency bounds the identity sources pushed to one NSX Manager
+// at once.
+const MaxPushConcurrency = 16
+
+// BatchOptions configures PushLDAPIdentitySources.
+type BatchOptions struct {
+	PushOptions
+	// Concurrency is how many sources are pushed at once, at most
+	// MaxPushConcurrency; 0 and 1 push them one at a time
+	Concurrency int
+	// Canary pushes the first source alone and skips the others if it fails
+	Canary bool
+	// StopOnError skips the sources not yet started once one fails; those
+	// in flight finish
+	StopOnError bool
+	// Abort reports whether a failure affects every source, such as
+	// rejected credentials, and stops the push as StopOnError does
+	Abort func(error) bool
+	// Timeout bounds the push of each source, realization wait included;
+	// 0 for none
+	Timeout time.Duration
+
+	// Start is called when the push of a source starts, and Done with the
+	// outcome of each source in the order of the sources. They are never
+	// called concurrently.
+	Start func(id string)
+	Done  func(PushResult)
+}
+
+// PushResult is the outcome of pushing one identity source.
+type PushResult struct {
+	ID       string
+	Err      error
+	Retried  bool          // pushed again after a revision conflict
+	Skipped  bool          // not pushed: the canary failed, the push stopped or ctx is done
+	Kept     bool          // not pushed: changed on NSX and kept as it is there (KeepNSX)
+	Duration time.Duration // of the push, realization wait included
+}
+
+// PushLDAPIdentitySources pushes sources as PushLDAPIdentitySource does,
+// up to opts.Concurrency at once, and returns their outcomes in the order of
+// sources whatever order the pushes finish in. Sources not started when ctx
+// is done are skipped.
+func (c *Client) PushLDAPIdentitySources(ctx context.Context, sources []LDAPIdentitySource, opts BatchOptions) []PushResult {
+	b := &batch{
+		opts:    opts,
+		results: make([]PushResult, len(sources)),
+		done:    make([]bool, len(sources)),
+	}
+
+	first := 0
+	if opts.Canary && len(sources) > 0 {
+		b.push(ctx, c, sources[0], 0)
+		first = 1
+	}
+
+	workers := min(max(opts.Concurrency, 1), MaxPushConcurrency)
+	slots := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := first; i < len(sources); i++ {
+		slots <- struct{}{}
+		if b.stopped() || ctx.Err() != nil {
+			<-slots
+			b.finish(i, PushResult{ID: sources[i].ID, Skipped: true})
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			b.push(ctx, c, sources[i], i)
+		}()
+	}
+	wg.Wait()
+	return b.results
+}
+
+// batch tracks the outcomes of a PushLDAPIdentitySources call.
+type batch struct {
+	opts BatchOptions
+
+	mu      sync.Mutex
+	results []PushResult
+	done    []bool
+	next    int // first outcome not yet passed to Done
+	halted  bool
+}
+
+// push pushes source, the i-th of the batch.
+func (b *batch) push(ctx context.Context, c *Client, source LDAPIdentitySource, i int) {
+	b.mu.Lock()
+	if b.opts.Start != nil {
+		b.opts.Start(source.ID)
+	}
+	b.mu.Unlock()
+
+	if b.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.opts.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	retried, err := c.PushLDAPIdentitySource(ctx, &source, b.opts.PushOptions)
+	result := PushResult{ID: source.ID, Err: err, Retried: retried, Duration: time.Since(start)}
+	if errors.Is(err, ErrConflictKept) {
+		result.Err, result.Kept = nil, true
+	}
+	b.finish(i, result)
+}
+
+// finish records the outcome of the i-th source and passes the outcomes now
+// complete in order to Done.
+func (b *batch) finish(i int, result PushResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.results[i], b.done[i] = result, true
+	if result.Err != nil {
+		canary := b.opts.Canary && i == 0
+		aborted := b.opts.Abort != nil && b.opts.Abort(result.Err)
+		if canary || aborted || b.opts.StopOnError {
+			b.halted = true
+		}
+	}
+
+	for b.next < len(b.results) && b.done[b.next] {
+		if b.opts.Done != nil {
+			b.opts.Done(b.results[b.next])
+		}
+		b.next++
+	}
+}
+
+// stopped reports whether the sources not yet started are to be skipped.
+func (b *batch) stopped() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.halted
+}
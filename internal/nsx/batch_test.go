@@ -0,0 +1,74 @@
+package nsx_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/nsx/mock"
+)
+
+func TestPushLDAPIdentitySources(t *testing.T) {
+	mockServer := mock.NewServer()
+	mockServer.Generate(8, 1)
+	mockServer.SetLatency(10 * time.Millisecond)
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	client := nsx.NewClient(nsx.ClientConfig{Host: ts.URL, Username: "admin", Password: "secret"})
+	ctx := context.Background()
+	list, err := client.ListLDAPIdentitySources(ctx)
+	if err != nil {
+		t.Fatalf("ListLDAPIdentitySources failed: %v", err)
+	}
+	sources := list.Results
+	mockServer.SetRealization(sources[2].ID, 0, nsx.RealizationError, "LDAP server unreachable")
+	wait := nsx.RealizationWait{Timeout: time.Second, Interval: 5 * time.Millisecond}
+
+	tests := []struct {
+		name    string
+		opts    nsx.BatchOptions
+		failed  int // index of the failing source
+		skipped int // trailing sources skipped
+	}{
+		{"parallel", nsx.BatchOptions{Concurrency: 4}, 2, 0},
+		{"stop on error", nsx.BatchOptions{StopOnError: true}, 2, 5},
+		{"canary", nsx.BatchOptions{Canary: true, Concurrency: 4}, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var order []string
+			opts := tt.opts
+			opts.Realization = wait
+			opts.Done = func(r nsx.PushResult) { order = append(order, r.ID) }
+
+			results := client.PushLDAPIdentitySources(ctx, sources, opts)
+			if len(results) != len(sources) || len(order) != len(sources) {
+				t.Fatalf("Expected %d results, got %d (%d reported)", len(sources), len(results), len(order))
+			}
+			for i, r := range results {
+				if r.ID != sources[i].ID || order[i] != sources[i].ID {
+					t.Errorf("Result %d is %s, reported %s; expected %s", i, r.ID, order[i], sources[i].ID)
+				}
+				failed := i == tt.failed
+				skipped := i >= len(sources)-tt.skipped
+				if (r.Err != nil) != failed || r.Skipped != skipped {
+					t.Errorf("Unexpected result %d: %+v", i, r)
+				}
+			}
+		})
+	}
+
+	// A failed canary skips the others
+	mockServer.SetRealization(sources[0].ID, 0, nsx.RealizationError, "LDAP server unreachable")
+	results := client.PushLDAPIdentitySources(ctx, sources, nsx.BatchOptions{
+		PushOptions: nsx.PushOptions{Realization: wait},
+		Canary:      true,
+		Concurrency: 4,
+	})
+	if results[0].Err == nil || !results[1].Skipped || !results[len(results)-1].Skipped {
+		t.Errorf("Expected the canary to fail and the others to be skipped, got %+v", results)
+	}
+}
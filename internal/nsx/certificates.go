@@ -0,0 +1,66 @@
+package nsx
+
+import (
+	"context"
+	"strconv"
+
+	"ldapmerge/internal/models"
+)
+
+// CertificateFailure is an LDAP server whose certificate NSX could not fetch.
+type CertificateFailure struct {
+	URL string
+	Err error
+}
+
+// ResponseItems returns the response items of the LDAP servers of sources,
+// once per URL, in order.
+func ResponseItems(sources []LDAPIdentitySource) []models.ResponseItem {
+	seen := make(map[string]bool)
+	var items []models.ResponseItem
+	for _, source := range sources {
+		for _, server := range source.LDAPServers {
+			if seen[server.URL] {
+				continue
+			}
+			seen[server.URL] = true
+			items = append(items, models.ResponseItem{
+				URL:      server.URL,
+				StartTLS: strconv.FormatBool(server.UseStartTLS),
+				Enabled:  strconv.FormatBool(server.Enabled),
+			})
+		}
+	}
+	return items
+}
+
+// FetchCertificateResponse fetches the certificate of each item's server
+// through NSX and returns them as a certificate response, shaped as the one
+// collected by Ansible, ready to merge. Servers NSX cannot fetch from are
+// returned as failures; an error is only returned if ctx is done.
+func (c *Client) FetchCertificateResponse(ctx context.Context, items []models.ResponseItem) (*models.CertificateResponse, []CertificateFailure, error) {
+	response := &models.CertificateResponse{Results: make([]models.CertificateResult, 0, len(items))}
+	var failures []CertificateFailure
+
+	for _, item := range items {
+		result, err := c.FetchCertificate(ctx, item.URL)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, nil, ctxErr
+			}
+			failures = append(failures, CertificateFailure{URL: item.URL, Err: err})
+			continue
+		}
+
+		details := make([]models.CertificateDetail, 0, len(result.Details))
+		for _, d := range result.Details {
+			details = append(details, models.CertificateDetail{SubjectCN: d.SubjectCN})
+		}
+		response.Results = append(response.Results, models.CertificateResult{
+			JSON:           models.CertificateJSON{PEMEncoded: result.PEMEncoded, Details: details},
+			Item:           item,
+			AnsibleLoopVar: "item",
+		})
+	}
+	return response, failures, nil
+}
@@ -0,0 +1,156 @@
+package nsx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Chaos injects faults into the calls of a client, so that tests against
+// the mock server can drive the partial-failure, retry and rollback paths of
+// a push deterministically. It is not meant for a real NSX Manager.
+type Chaos struct {
+	// PushFailures fails the puts and patches of the matching identity
+	// sources; the first matching entry applies
+	PushFailures []PushFailure
+	// Latency delays every call before it is sent
+	Latency time.Duration
+}
+
+// PushFailure fails the pushes of the identity sources whose IDs match a
+// glob pattern.
+type PushFailure struct {
+	Pattern string
+	// Status is the HTTP status of the simulated NSX error; 412 simulates a
+	// revision conflict
+	Status int
+	// Times is how many pushes fail before the next ones reach NSX; 0
+	// fails them all
+	Times int
+}
+
+// ParsePushFailure parses a push failure written as PATTERN[:STATUS[:TIMES]],
+// such as "lab.example.lab", "*:503" or "lab.example.lab:412:1". The status
+// defaults to 500.
+func ParsePushFailure(s string) (PushFailure, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 || parts[0] == "" {
+		return PushFailure{}, fmt.Errorf("invalid push failure %q: want PATTERN[:STATUS[:TIMES]]", s)
+	}
+	if _, err := path.Match(parts[0], ""); err != nil {
+		return PushFailure{}, fmt.Errorf("invalid push failure %q: %w", s, err)
+	}
+
+	f := PushFailure{Pattern: parts[0], Status: http.StatusInternalServerError}
+	if len(parts) > 1 {
+		status, err := strconv.Atoi(parts[1])
+		if err != nil || status < 400 || status > 599 {
+			return PushFailure{}, fmt.Errorf("invalid push failure %q: status must be between 400 and 599", s)
+		}
+		f.Status = status
+	}
+	if len(parts) > 2 {
+		times, err := strconv.Atoi(parts[2])
+		if err != nil || times < 0 {
+			return PushFailure{}, fmt.Errorf("invalid push failure %q: times must be a non-negative number", s)
+		}
+		f.Times = times
+	}
+	return f, nil
+}
+
+// chaosTransport applies a Chaos to the requests of next.
+type chaosTransport struct {
+	next  http.RoundTripper
+	chaos Chaos
+
+	mu     sync.Mutex
+	failed map[int]int // pushes failed so far by index in PushFailures
+}
+
+func newChaosTransport(next http.RoundTripper, chaos Chaos) *chaosTransport {
+	return &chaosTransport{next: next, chaos: chaos, failed: make(map[int]int)}
+}
+
+func (t *chaosTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.chaos.Latency > 0 {
+		timer := time.NewTimer(t.chaos.Latency)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+
+	if id, ok := pushedSource(req); ok {
+		if status, fail := t.fail(id); fail {
+			return simulatedError(req, id, status), nil
+		}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// fail reports whether the push of the source id is to fail, and with
+// which status, counting the failure.
+func (t *chaosTransport) fail(id string) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, f := range t.chaos.PushFailures {
+		if ok, _ := path.Match(f.Pattern, id); !ok {
+			continue
+		}
+		if f.Times > 0 && t.failed[i] >= f.Times {
+			return 0, false
+		}
+		t.failed[i]++
+		return f.Status, true
+	}
+	return 0, false
+}
+
+// pushedSource returns the ID of the identity source req puts or patches.
+func pushedSource(req *http.Request) (string, bool) {
+	if req.Method != http.MethodPut && req.Method != http.MethodPatch {
+		return "", false
+	}
+	prefix := SourcePath("")
+	i := strings.Index(req.URL.Path, prefix)
+	if i < 0 {
+		return "", false
+	}
+	id := req.URL.Path[i+len(prefix):]
+	if id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
+
+// simulatedError is the NSX error response of a simulated push failure.
+func simulatedError(req *http.Request, id string, status int) *http.Response {
+	body, _ := json.Marshal(APIError{
+		HTTPStatus:   status,
+		ErrorCode:    status,
+		ModuleName:   "ldapmerge-chaos",
+		ErrorMessage: fmt.Sprintf("simulated push failure of %s", id),
+	})
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
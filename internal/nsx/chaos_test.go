@@ -0,0 +1,104 @@
+package nsx_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/nsx/mock"
+)
+
+func TestParsePushFailure(t *testing.T) {
+	tests := []struct {
+		in   string
+		want nsx.PushFailure
+	}{
+		{"example.lab", nsx.PushFailure{Pattern: "example.lab", Status: 500}},
+		{"*:503", nsx.PushFailure{Pattern: "*", Status: 503}},
+		{"*.lab:412:1", nsx.PushFailure{Pattern: "*.lab", Status: 412, Times: 1}},
+	}
+	for _, tt := range tests {
+		got, err := nsx.ParsePushFailure(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParsePushFailure(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", ":500", "a:200", "a:500:-1", "a:500:1:2", "[:500"} {
+		if _, err := nsx.ParsePushFailure(in); err == nil {
+			t.Errorf("Expected ParsePushFailure(%q) to fail", in)
+		}
+	}
+}
+
+func TestChaos(t *testing.T) {
+	ts := httptest.NewServer(mock.NewServer())
+	defer ts.Close()
+
+	client := nsx.NewClient(nsx.ClientConfig{
+		Host:     ts.URL,
+		Username: "admin",
+		Password: "secret",
+		Chaos: &nsx.Chaos{
+			PushFailures: []nsx.PushFailure{
+				{Pattern: "example.lab", Status: http.StatusPreconditionFailed, Times: 1},
+				{Pattern: "*", Status: http.StatusServiceUnavailable},
+			},
+			Latency: 20 * time.Millisecond,
+		},
+	})
+	ctx := context.Background()
+
+	start := time.Now()
+	list, err := client.ListLDAPIdentitySources(ctx)
+	if err != nil {
+		t.Fatalf("ListLDAPIdentitySources failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected at least 20ms latency, got %s", elapsed)
+	}
+
+	var example, other *nsx.LDAPIdentitySource
+	for i := range list.Results {
+		if list.Results[i].ID == "example.lab" {
+			example = &list.Results[i]
+		} else {
+			other = &list.Results[i]
+		}
+	}
+	if example == nil || other == nil {
+		t.Fatalf("Expected example.lab and another source, got %+v", list.Results)
+	}
+
+	// The simulated conflict fails once and is retried at the current revision
+	retried, err := client.PushLDAPIdentitySource(ctx, example, nsx.PushOptions{RetryConflicts: true})
+	if err != nil || !retried {
+		t.Errorf("Expected the push to be retried after the simulated conflict, got %t, %v", retried, err)
+	}
+
+	var apiErr *nsx.APIError
+	_, err = client.PushLDAPIdentitySource(ctx, other, nsx.PushOptions{})
+	if !errors.As(err, &apiErr) || apiErr.HTTPStatus != http.StatusServiceUnavailable {
+		t.Errorf("Expected a simulated 503 for %s, got %v", other.ID, err)
+	}
+
+	// Reads are not failed
+	if _, err := client.GetLDAPIdentitySource(ctx, other.ID); err != nil {
+		t.Errorf("Expected reads to go through, got %v", err)
+	}
+
+	timeout := nsx.NewClient(nsx.ClientConfig{
+		Host:     ts.URL,
+		Username: "admin",
+		Password: "secret",
+		Timeout:  10 * time.Millisecond,
+		Chaos:    &nsx.Chaos{Latency: time.Second},
+	})
+	if _, err := timeout.ListLDAPIdentitySources(ctx); err == nil {
+		t.Error("Expected the simulated latency to exceed the timeout")
+	}
+}
@@ -3,13 +3,25 @@ package nsx
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"ldapmerge/internal/metrics"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/runid"
 )
 
 // Client is an NSX API client.
@@ -18,8 +30,26 @@ type Client struct {
 	username   string
 	password   string
 	httpClient *http.Client
+	host       string // host label of the metrics
+
+	// correlationHeader carries a request id on every call; empty for none
+	correlationHeader string
+	correlationBase   string
+	sequence          atomic.Uint64
+	slowThreshold     time.Duration
 }
 
+// DefaultCorrelationHeader is the header that carries the id of each request,
+// logged on both sides so that calls can be found in NSX support bundles.
+const DefaultCorrelationHeader = "X-NSX-Request-Id"
+
+// NoCorrelationHeader as Diagnostics.CorrelationHeader sends no request ids.
+const NoCorrelationHeader = "none"
+
+// DefaultSlowThreshold is the duration above which NSX API calls are logged
+// as slow.
+const DefaultSlowThreshold = 5 * time.Second
+
 // ClientConfig holds configuration for NSX client.
 type ClientConfig struct {
 	Host     string
@@ -27,6 +57,19 @@ type ClientConfig struct {
 	Password string
 	Insecure bool
 	Timeout  time.Duration
+	Diagnostics
+	// Chaos, if set, injects faults into the calls for tests
+	Chaos *Chaos
+}
+
+// Diagnostics configures how a client helps trace its calls.
+type Diagnostics struct {
+	// CorrelationHeader names the request id header; empty means
+	// DefaultCorrelationHeader and NoCorrelationHeader disables it
+	CorrelationHeader string
+	// SlowThreshold is the duration above which a call is logged as slow;
+	// zero means DefaultSlowThreshold and a negative value disables it
+	SlowThreshold time.Duration
 }
 
 // LDAPIdentitySource represents NSX LDAP identity source.
@@ -40,9 +83,93 @@ type LDAPIdentitySource struct {
 	BaseDN                 string       `json:"base_dn"`
 	AlternativeDomainNames []string     `json:"alternative_domain_names,omitempty"`
 	LDAPServers            []LDAPServer `json:"ldap_servers"`
-	Path                   string       `json:"path,omitempty"`
-	RealizationID          string       `json:"realization_id,omitempty"`
-	RelativePath           string       `json:"relative_path,omitempty"`
+	Tags                   []Tag        `json:"tags,omitempty"`
+	Revision               *int64       `json:"_revision,omitempty"` // sent on PUT; NSX rejects stale revisions
+
+	// Populated by NSX; Writable clears them
+	Path             string `json:"path,omitempty"`
+	ParentPath       string `json:"parent_path,omitempty"`
+	RelativePath     string `json:"relative_path,omitempty"`
+	RealizationID    string `json:"realization_id,omitempty"`
+	UniqueID         string `json:"unique_id,omitempty"`
+	MarkedForDelete  bool   `json:"marked_for_delete,omitempty"`
+	CreateUser       string `json:"_create_user,omitempty"`
+	CreateTime       int64  `json:"_create_time,omitempty"`
+	LastModifiedUser string `json:"_last_modified_user,omitempty"`
+	LastModifiedTime int64  `json:"_last_modified_time,omitempty"`
+	SystemOwned      bool   `json:"_system_owned,omitempty"`
+	Protection       string `json:"_protection,omitempty"`
+
+	// Extra holds the members this client does not know, such as fields
+	// added in newer NSX releases; they are kept through conversions.
+	Extra models.Extra `json:"-"`
+}
+
+// UnmarshalJSON decodes s, keeping unknown members in s.Extra.
+func (s *LDAPIdentitySource) UnmarshalJSON(data []byte) error {
+	type plain LDAPIdentitySource
+	extra, err := models.DecodeExtra(data, (*plain)(s))
+	s.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes s with the members of s.Extra.
+func (s LDAPIdentitySource) MarshalJSON() ([]byte, error) {
+	type plain LDAPIdentitySource
+	return models.EncodeExtra(plain(s), s.Extra)
+}
+
+// Tag is an NSX tag.
+type Tag struct {
+	Scope string `json:"scope,omitempty"`
+	Tag   string `json:"tag"`
+}
+
+// ReadOnlyFields are the fields of an identity source that NSX populates
+// itself. Pulls return them; pushes leave them out, as NSX rejects or
+// ignores them on PUT.
+var ReadOnlyFields = []string{
+	"path", "parent_path", "relative_path", "realization_id", "unique_id",
+	"marked_for_delete", "overridden",
+	"_create_user", "_create_time", "_last_modified_user", "_last_modified_time",
+	"_system_owned", "_protection",
+}
+
+// Writable returns a copy of s without the fields NSX populates itself, for
+// sending in a PUT or PATCH.
+func (s LDAPIdentitySource) Writable() LDAPIdentitySource {
+	s.Path, s.ParentPath, s.RelativePath, s.RealizationID, s.UniqueID = "", "", "", "", ""
+	s.MarkedForDelete, s.SystemOwned = false, false
+	s.CreateUser, s.LastModifiedUser, s.Protection = "", "", ""
+	s.CreateTime, s.LastModifiedTime = 0, 0
+	s.Extra = withoutReadOnly(s.Extra)
+	return s
+}
+
+// withoutReadOnly returns a copy of extra without ReadOnlyFields.
+func withoutReadOnly(extra models.Extra) models.Extra {
+	var out models.Extra
+	for name, value := range extra {
+		if slices.Contains(ReadOnlyFields, name) {
+			continue
+		}
+		if out == nil {
+			out = make(models.Extra, len(extra))
+		}
+		out[name] = value
+	}
+	return out
+}
+
+// LacksBindPassword reports whether a server of s binds with an identity
+// but has no password, as in every source read from NSX.
+func (s *LDAPIdentitySource) LacksBindPassword() bool {
+	for _, server := range s.LDAPServers {
+		if server.BindIdentity != "" && server.Password == "" {
+			return true
+		}
+	}
+	return false
 }
 
 // LDAPServer represents an LDAP server in NSX.
@@ -53,6 +180,23 @@ type LDAPServer struct {
 	BindIdentity string   `json:"bind_identity,omitempty"`
 	Password     string   `json:"password,omitempty"`
 	Certificates []string `json:"certificates,omitempty"`
+
+	// Extra holds the members this client does not know.
+	Extra models.Extra `json:"-"`
+}
+
+// UnmarshalJSON decodes s, keeping unknown members in s.Extra.
+func (s *LDAPServer) UnmarshalJSON(data []byte) error {
+	type plain LDAPServer
+	extra, err := models.DecodeExtra(data, (*plain)(s))
+	s.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes s with the members of s.Extra.
+func (s LDAPServer) MarshalJSON() ([]byte, error) {
+	type plain LDAPServer
+	return models.EncodeExtra(plain(s), s.Extra)
 }
 
 // LDAPIdentitySourceListResult represents list response.
@@ -123,12 +267,39 @@ type APIError struct {
 	ErrorCode    int    `json:"error_code"`
 	ModuleName   string `json:"module_name"`
 	ErrorMessage string `json:"error_message"`
+	// RequestID is the correlation id sent with the request, if any
+	RequestID string `json:"-"`
 }
 
 func (e *APIError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("NSX API error %d: %s (code: %d, request: %s)", e.HTTPStatus, e.ErrorMessage, e.ErrorCode, e.RequestID)
+	}
 	return fmt.Sprintf("NSX API error %d: %s (code: %d)", e.HTTPStatus, e.ErrorMessage, e.ErrorCode)
 }
 
+// requestDuration records the latency of NSX API calls
+var requestDuration = metrics.NewHistogramVec("ldapmerge_nsx_request_duration_seconds",
+	"Latency of NSX Manager API requests.", nil, "host", "method", "endpoint", "code")
+
+// endpoint returns the metric label of an API path: the path below
+// /policy/api/v1 with identity source ids replaced by {id}, and the action
+// if any, e.g. "aaa/ldap-identity-sources/{id}?action=probe".
+func endpoint(path string) string {
+	path, query, _ := strings.Cut(path, "?")
+	segments := strings.Split(strings.TrimPrefix(path, "/policy/api/v1/"), "/")
+	for i := 1; i < len(segments); i++ {
+		if segments[i-1] == "ldap-identity-sources" {
+			segments[i] = "{id}"
+		}
+	}
+	label := strings.Join(segments, "/")
+	if values, err := url.ParseQuery(query); err == nil && values.Has("action") {
+		label += "?action=" + values.Get("action")
+	}
+	return label
+}
+
 // NewClient creates a new NSX API client.
 func NewClient(cfg ClientConfig) *Client {
 	transport := &http.Transport{
@@ -137,22 +308,78 @@ func NewClient(cfg ClientConfig) *Client {
 		},
 	}
 
+	var roundTripper http.RoundTripper = transport
+	if cfg.Chaos != nil {
+		roundTripper = newChaosTransport(transport, *cfg.Chaos)
+	}
+
 	timeout := cfg.Timeout
 	if timeout == 0 {
 		timeout = 30 * time.Second
 	}
 
+	header := cfg.CorrelationHeader
+	switch {
+	case header == "":
+		header = DefaultCorrelationHeader
+	case strings.EqualFold(header, NoCorrelationHeader):
+		header = ""
+	}
+
+	slow := cfg.SlowThreshold
+	if slow == 0 {
+		slow = DefaultSlowThreshold
+	}
+
+	host := cfg.Host
+	if u, err := url.Parse(cfg.Host); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
 	return &Client{
 		baseURL:  cfg.Host,
 		username: cfg.Username,
 		password: cfg.Password,
 		httpClient: &http.Client{
-			Transport: transport,
+			Transport: roundTripper,
 			Timeout:   timeout,
 		},
+		host:              host,
+		correlationHeader: header,
+		correlationBase:   newCorrelationBase(),
+		slowThreshold:     slow,
 	}
 }
 
+// newCorrelationBase returns the random prefix of the request ids of a client.
+func newCorrelationBase() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return "ldapmerge-" + hex.EncodeToString(b)
+}
+
+// nextRequestID returns the correlation id of the next request made with
+// ctx, or "" if the client sends none. It starts with the run ID of ctx, if
+// any, instead of the random prefix of the client.
+func (c *Client) nextRequestID(ctx context.Context) string {
+	if c.correlationHeader == "" {
+		return ""
+	}
+	base := c.correlationBase
+	if id, ok := runid.From(ctx); ok {
+		base = id
+	}
+	return fmt.Sprintf("%s-%04d", base, c.sequence.Add(1))
+}
+
+// withRequestID annotates err with the correlation id of the failed request.
+func withRequestID(err error, id string) error {
+	if id == "" {
+		return err
+	}
+	return fmt.Errorf("request %s: %w", id, err)
+}
+
 // doRequest performs an HTTP request to NSX API.
 //
 //nolint:unparam // statusCode return value used for future error handling
@@ -176,30 +403,61 @@ func (c *Client) doRequest(ctx context.Context, method, path string, body interf
 	req.SetBasicAuth(c.username, c.password)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
+	requestID := c.nextRequestID(ctx)
+	if requestID != "" {
+		req.Header.Set(c.correlationHeader, requestID)
+	}
 
+	label := endpoint(path)
+	start := time.Now()
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, 0, fmt.Errorf("request failed: %w", err)
+		requestDuration.ObserveDuration(start, c.host, method, label, metrics.StatusLabel(0))
+		slog.WarnContext(ctx, "NSX API request failed", "nsx_host", c.host, "method", method, "path", path, "request_id", requestID, "duration", time.Since(start), "error", err)
+		return nil, 0, withRequestID(fmt.Errorf("request failed: %w", err), requestID)
 	}
 	defer func() { _ = resp.Body.Close() }()
+	requestDuration.ObserveDuration(start, c.host, method, label, metrics.StatusLabel(resp.StatusCode))
 
 	respBody, err := io.ReadAll(resp.Body)
+	c.logCall(ctx, method, path, label, requestID, resp.StatusCode, len(respBody), time.Since(start))
 	if err != nil {
-		return nil, resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
+		return nil, resp.StatusCode, withRequestID(fmt.Errorf("failed to read response: %w", err), requestID)
 	}
 
 	if resp.StatusCode >= 400 {
 		var apiErr APIError
 		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.ErrorMessage != "" {
 			apiErr.HTTPStatus = resp.StatusCode
+			apiErr.RequestID = requestID
 			return nil, resp.StatusCode, &apiErr
 		}
-		return nil, resp.StatusCode, fmt.Errorf("API error %d: %s", resp.StatusCode, string(respBody))
+		return nil, resp.StatusCode, withRequestID(fmt.Errorf("API error %d: %s", resp.StatusCode, string(respBody)), requestID)
 	}
 
 	return respBody, resp.StatusCode, nil
 }
 
+// logCall logs a completed NSX API call at debug level, or as a warning if it
+// took longer than the slow threshold of the client.
+func (c *Client) logCall(ctx context.Context, method, path, label, requestID string, status, size int, elapsed time.Duration) {
+	attrs := []any{
+		"nsx_host", c.host,
+		"method", method,
+		"path", path,
+		"endpoint", label,
+		"request_id", requestID,
+		"status", status,
+		"response_bytes", size,
+		"duration", elapsed,
+	}
+	if c.slowThreshold > 0 && elapsed > c.slowThreshold {
+		slog.WarnContext(ctx, "slow NSX API request", append(attrs, "threshold", c.slowThreshold)...)
+		return
+	}
+	slog.DebugContext(ctx, "NSX API request", attrs...)
+}
+
 // ListLDAPIdentitySources retrieves all LDAP identity sources
 // GET /policy/api/v1/aaa/ldap-identity-sources
 func (c *Client) ListLDAPIdentitySources(ctx context.Context) (*LDAPIdentitySourceListResult, error) {
@@ -216,10 +474,15 @@ func (c *Client) ListLDAPIdentitySources(ctx context.Context) (*LDAPIdentitySour
 	return &result, nil
 }
 
+// SourcePath returns the API path of the LDAP identity source id.
+func SourcePath(id string) string {
+	return "/policy/api/v1/aaa/ldap-identity-sources/" + url.PathEscape(id)
+}
+
 // GetLDAPIdentitySource retrieves a specific LDAP identity source by ID
 // GET /policy/api/v1/aaa/ldap-identity-sources/{ldap-identity-source-id}
 func (c *Client) GetLDAPIdentitySource(ctx context.Context, id string) (*LDAPIdentitySource, error) {
-	path := fmt.Sprintf("/policy/api/v1/aaa/ldap-identity-sources/%s", url.PathEscape(id))
+	path := SourcePath(id)
 	data, _, err := c.doRequest(ctx, http.MethodGet, path, nil)
 	if err != nil {
 		return nil, err
@@ -233,13 +496,111 @@ func (c *Client) GetLDAPIdentitySource(ctx context.Context, id string) (*LDAPIde
 	return &result, nil
 }
 
+// SameHost reports whether two NSX Manager URLs name the same manager,
+// ignoring case and trailing slashes.
+func SameHost(a, b string) bool {
+	return strings.EqualFold(strings.TrimRight(a, "/"), strings.TrimRight(b, "/"))
+}
+
+// IsNotFound reports whether err is an NSX API error for a missing object.
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.HTTPStatus == http.StatusNotFound
+}
+
+// ErrRevisionConflict is returned by updates NSX rejected because the object
+// changed since it was read: its _revision no longer matches.
+var ErrRevisionConflict = errors.New("object changed on NSX since pull, re-pull and retry")
+
+// isConflict reports whether err is an NSX API error for a stale _revision.
+func isConflict(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) &&
+		(apiErr.HTTPStatus == http.StatusConflict || apiErr.HTTPStatus == http.StatusPreconditionFailed)
+}
+
+// conflictError wraps an NSX error for a stale revision of id in
+// ErrRevisionConflict.
+func conflictError(id string, err error) error {
+	if isConflict(err) {
+		return fmt.Errorf("%s: %w: %w", id, ErrRevisionConflict, err)
+	}
+	return err
+}
+
+// SnapshotLDAPIdentitySources reads the identity sources ids as NSX returns
+// them, for restoring them later. A source that does not exist is captured
+// without a document.
+func (c *Client) SnapshotLDAPIdentitySources(ctx context.Context, ids []string) ([]models.SnapshotSource, error) {
+	out := make([]models.SnapshotSource, 0, len(ids))
+	for _, id := range ids {
+		path := SourcePath(id)
+		data, _, err := c.doRequest(ctx, http.MethodGet, path, nil)
+		switch {
+		case IsNotFound(err):
+			out = append(out, models.SnapshotSource{ID: id})
+		case err != nil:
+			return nil, fmt.Errorf("failed to read %s: %w", id, err)
+		case !json.Valid(data):
+			return nil, fmt.Errorf("failed to read %s: invalid JSON response", id)
+		default:
+			out = append(out, models.SnapshotSource{ID: id, Existed: true, Source: json.RawMessage(data)})
+		}
+	}
+	return out, nil
+}
+
+// RestoreLDAPIdentitySource puts a snapshotted identity source back as it was
+// captured, or deletes it if it did not exist then.
+func (c *Client) RestoreLDAPIdentitySource(ctx context.Context, source models.SnapshotSource) error {
+	path := SourcePath(source.ID)
+	if !source.Existed {
+		if _, _, err := c.doRequest(ctx, http.MethodDelete, path, nil); err != nil && !IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+	doc, err := c.restorableDocument(ctx, source.ID, source.Source)
+	if err != nil {
+		return err
+	}
+	_, _, err = c.doRequest(ctx, http.MethodPut, path, doc)
+	return err
+}
+
+// restorableDocument returns the captured document doc of the identity
+// source id without read-only fields and with the _revision NSX has now, so
+// that putting it replaces whatever changed since doc was captured.
+func (c *Client) restorableDocument(ctx context.Context, id string, doc json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return nil, fmt.Errorf("invalid document of %s: %w", id, err)
+	}
+	for _, field := range ReadOnlyFields {
+		delete(fields, field)
+	}
+
+	current, err := c.GetLDAPIdentitySource(ctx, id)
+	switch {
+	case IsNotFound(err):
+		delete(fields, "_revision")
+	case err != nil:
+		return nil, err
+	case current.Revision == nil:
+		delete(fields, "_revision")
+	default:
+		fields["_revision"] = json.RawMessage(strconv.FormatInt(*current.Revision, 10))
+	}
+	return json.Marshal(fields)
+}
+
 // CreateOrUpdateLDAPIdentitySource creates or updates an LDAP identity source (PATCH)
 // PATCH /policy/api/v1/aaa/ldap-identity-sources/{ldap-identity-source-id}
 func (c *Client) CreateOrUpdateLDAPIdentitySource(ctx context.Context, source *LDAPIdentitySource) (*LDAPIdentitySource, error) {
-	path := fmt.Sprintf("/policy/api/v1/aaa/ldap-identity-sources/%s", url.PathEscape(source.ID))
-	data, _, err := c.doRequest(ctx, http.MethodPatch, path, source)
+	path := SourcePath(source.ID)
+	data, _, err := c.doRequest(ctx, http.MethodPatch, path, source.Writable())
 	if err != nil {
-		return nil, err
+		return nil, conflictError(source.ID, err)
 	}
 
 	var result LDAPIdentitySource
@@ -250,13 +611,15 @@ func (c *Client) CreateOrUpdateLDAPIdentitySource(ctx context.Context, source *L
 	return &result, nil
 }
 
-// PutLDAPIdentitySource creates or replaces an LDAP identity source (PUT - full update)
+// PutLDAPIdentitySource creates or replaces an LDAP identity source (PUT - full update).
+// Read-only fields are not sent. A source whose _revision is stale fails with
+// ErrRevisionConflict.
 // PUT /policy/api/v1/aaa/ldap-identity-sources/{ldap-identity-source-id}
 func (c *Client) PutLDAPIdentitySource(ctx context.Context, source *LDAPIdentitySource) (*LDAPIdentitySource, error) {
-	path := fmt.Sprintf("/policy/api/v1/aaa/ldap-identity-sources/%s", url.PathEscape(source.ID))
-	data, _, err := c.doRequest(ctx, http.MethodPut, path, source)
+	path := SourcePath(source.ID)
+	data, _, err := c.doRequest(ctx, http.MethodPut, path, source.Writable())
 	if err != nil {
-		return nil, err
+		return nil, conflictError(source.ID, err)
 	}
 
 	var result LDAPIdentitySource
@@ -267,10 +630,80 @@ func (c *Client) PutLDAPIdentitySource(ctx context.Context, source *LDAPIdentity
 	return &result, nil
 }
 
+// RefreshRevision sets the _revision of source to the one NSX has now, or
+// clears it if the source no longer exists.
+func (c *Client) RefreshRevision(ctx context.Context, source *LDAPIdentitySource) error {
+	current, err := c.GetLDAPIdentitySource(ctx, source.ID)
+	switch {
+	case IsNotFound(err):
+		source.Revision = nil
+	case err != nil:
+		return fmt.Errorf("failed to re-read %s: %w", source.ID, err)
+	default:
+		source.Revision = current.Revision
+	}
+	return nil
+}
+
+// PushOptions configures PushLDAPIdentitySource.
+type PushOptions struct {
+	// RetryConflicts re-reads the revision of a source that changed on NSX
+	// since it was pulled and puts it again, overwriting that change
+	RetryConflicts bool
+	// Realization configures the wait for NSX to realize the source
+	Realization RealizationWait
+	// ClearPasswords puts sources that lack bind passwords too, clearing
+	// the ones NSX has
+	ClearPasswords bool
+	// ResolveConflict, if set and RetryConflicts is not, chooses how to
+	// push a source that changed on NSX since it was pulled. It is called
+	// from the goroutine pushing the source, so calls for a batch may be
+	// concurrent.
+	ResolveConflict ConflictResolver
+}
+
+// PushLDAPIdentitySource puts source on NSX and waits until NSX has realized
+// it. retried reports whether the put was repeated after a revision conflict.
+// A source kept as it is on NSX by opts.ResolveConflict fails with
+// ErrConflictKept.
+//
+// A source that lacks bind passwords is patched instead, unless
+// opts.ClearPasswords is set: NSX keeps the bind password of a patched
+// server sent without one, where a put clears it.
+func (c *Client) PushLDAPIdentitySource(ctx context.Context, source *LDAPIdentitySource, opts PushOptions) (retried bool, err error) {
+	push := c.pushFunc(source, opts)
+
+	_, err = push(ctx, source)
+	if errors.Is(err, ErrRevisionConflict) {
+		switch {
+		case opts.RetryConflicts:
+			retried = true
+			if err = c.RefreshRevision(ctx, source); err == nil {
+				_, err = push(ctx, source)
+			}
+		case opts.ResolveConflict != nil:
+			retried, err = c.resolveConflict(ctx, source, opts)
+		}
+	}
+	if err != nil {
+		return retried, err
+	}
+	return retried, c.WaitRealized(ctx, source.ID, opts.Realization)
+}
+
+// pushFunc returns how PushLDAPIdentitySource sends source: put, or patch
+// if it lacks bind passwords.
+func (c *Client) pushFunc(source *LDAPIdentitySource, opts PushOptions) func(context.Context, *LDAPIdentitySource) (*LDAPIdentitySource, error) {
+	if !opts.ClearPasswords && source.LacksBindPassword() {
+		return c.CreateOrUpdateLDAPIdentitySource
+	}
+	return c.PutLDAPIdentitySource
+}
+
 // DeleteLDAPIdentitySource deletes an LDAP identity source
 // DELETE /policy/api/v1/aaa/ldap-identity-sources/{ldap-identity-source-id}
 func (c *Client) DeleteLDAPIdentitySource(ctx context.Context, id string) error {
-	path := fmt.Sprintf("/policy/api/v1/aaa/ldap-identity-sources/%s", url.PathEscape(id))
+	path := SourcePath(id)
 	_, _, err := c.doRequest(ctx, http.MethodDelete, path, nil)
 	return err
 }
@@ -1,12 +1,23 @@
 package nsx_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
 	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"ldapmerge/internal/metrics"
+	"ldapmerge/internal/models"
 	"ldapmerge/internal/nsx"
 	"ldapmerge/internal/nsx/mock"
+	"ldapmerge/internal/runid"
 )
 
 func setupTestServer() (*httptest.Server, *nsx.Client) {
@@ -154,6 +165,317 @@ func TestDeleteLDAPIdentitySource(t *testing.T) {
 	}
 }
 
+func TestSnapshotLDAPIdentitySources(t *testing.T) {
+	ts, client := setupTestServer()
+	defer ts.Close()
+
+	ctx := context.Background()
+
+	snapshot, err := client.SnapshotLDAPIdentitySources(ctx, []string{"example.lab", "nonexistent"})
+	if err != nil {
+		t.Fatalf("SnapshotLDAPIdentitySources failed: %v", err)
+	}
+	if len(snapshot) != 2 {
+		t.Fatalf("Expected 2 sources, got %d", len(snapshot))
+	}
+
+	var source nsx.LDAPIdentitySource
+	if err := json.Unmarshal(snapshot[0].Source, &source); err != nil || source.DomainName != "example.lab" {
+		t.Errorf("Expected the NSX document of example.lab, got %s (%v)", snapshot[0].Source, err)
+	}
+	if !snapshot[0].Existed || snapshot[1].ID != "nonexistent" || snapshot[1].Existed || snapshot[1].Source != nil {
+		t.Errorf("Expected a missing source without a document, got %+v", snapshot[1])
+	}
+
+	_, err = client.GetLDAPIdentitySource(ctx, "nonexistent")
+	if !nsx.IsNotFound(err) {
+		t.Errorf("Expected IsNotFound for a missing source, got %v", err)
+	}
+
+	// Restore after example.lab was changed and nonexistent created
+	if err := client.DeleteLDAPIdentitySource(ctx, "example.lab"); err != nil {
+		t.Fatalf("DeleteLDAPIdentitySource failed: %v", err)
+	}
+	if _, err := client.PutLDAPIdentitySource(ctx, &nsx.LDAPIdentitySource{ID: "nonexistent", DomainName: "nonexistent"}); err != nil {
+		t.Fatalf("PutLDAPIdentitySource failed: %v", err)
+	}
+	for _, s := range snapshot {
+		if err := client.RestoreLDAPIdentitySource(ctx, s); err != nil {
+			t.Fatalf("RestoreLDAPIdentitySource(%s) failed: %v", s.ID, err)
+		}
+	}
+	if restored, err := client.GetLDAPIdentitySource(ctx, "example.lab"); err != nil || restored.DomainName != "example.lab" {
+		t.Errorf("Expected example.lab to be restored, got %+v (%v)", restored, err)
+	}
+	if _, err := client.GetLDAPIdentitySource(ctx, "nonexistent"); !nsx.IsNotFound(err) {
+		t.Errorf("Expected nonexistent to be deleted again, got %v", err)
+	}
+	// Deleting a source that is already gone is not an error
+	if err := client.RestoreLDAPIdentitySource(ctx, snapshot[1]); err != nil {
+		t.Errorf("Expected restoring an absent source twice to succeed, got %v", err)
+	}
+}
+
+func TestRevisionConflict(t *testing.T) {
+	ts, client := setupTestServer()
+	defer ts.Close()
+
+	ctx := context.Background()
+
+	pulled, err := client.GetLDAPIdentitySource(ctx, "example.lab")
+	if err != nil {
+		t.Fatalf("GetLDAPIdentitySource failed: %v", err)
+	}
+	if pulled.Revision == nil || *pulled.Revision != 0 {
+		t.Fatalf("Expected _revision 0, got %v", pulled.Revision)
+	}
+	snapshot, err := client.SnapshotLDAPIdentitySources(ctx, []string{"example.lab"})
+	if err != nil {
+		t.Fatalf("SnapshotLDAPIdentitySources failed: %v", err)
+	}
+
+	// Someone else changes the source after the pull
+	changed := *pulled
+	changed.Description = "changed elsewhere"
+	if _, err := client.PutLDAPIdentitySource(ctx, &changed); err != nil {
+		t.Fatalf("PutLDAPIdentitySource failed: %v", err)
+	}
+
+	stale := *pulled
+	if _, err := client.PutLDAPIdentitySource(ctx, &stale); !errors.Is(err, nsx.ErrRevisionConflict) {
+		t.Fatalf("Expected ErrRevisionConflict for a stale _revision, got %v", err)
+	}
+	if retried, err := client.PushLDAPIdentitySource(ctx, &stale, nsx.PushOptions{}); retried || !errors.Is(err, nsx.ErrRevisionConflict) {
+		t.Errorf("Expected the push to fail without RetryConflicts, got %t, %v", retried, err)
+	}
+
+	retried, err := client.PushLDAPIdentitySource(ctx, &stale, nsx.PushOptions{RetryConflicts: true})
+	if err != nil || !retried {
+		t.Fatalf("Expected the push to be retried at the current revision, got %t, %v", retried, err)
+	}
+	current, err := client.GetLDAPIdentitySource(ctx, "example.lab")
+	if err != nil {
+		t.Fatalf("GetLDAPIdentitySource failed: %v", err)
+	}
+	if current.Description != pulled.Description || *current.Revision != 2 {
+		t.Errorf("Expected the pushed source at revision 2, got %+v", current)
+	}
+
+	// A restore replaces the source whatever its revision
+	if err := client.RestoreLDAPIdentitySource(ctx, snapshot[0]); err != nil {
+		t.Errorf("Expected a restore over newer revisions to succeed, got %v", err)
+	}
+}
+
+func TestResolveConflict(t *testing.T) {
+	ts, client := setupTestServer()
+	defer ts.Close()
+
+	ctx := context.Background()
+
+	pulled, err := client.GetLDAPIdentitySource(ctx, "example.lab")
+	if err != nil {
+		t.Fatalf("GetLDAPIdentitySource failed: %v", err)
+	}
+
+	// Someone else adds a certificate after the pull
+	changed := *pulled
+	changed.LDAPServers = slices.Clone(pulled.LDAPServers)
+	changed.LDAPServers[0].Certificates = append(slices.Clone(pulled.LDAPServers[0].Certificates), "NSX-CERT")
+	if _, err := client.PutLDAPIdentitySource(ctx, &changed); err != nil {
+		t.Fatalf("PutLDAPIdentitySource failed: %v", err)
+	}
+
+	stale := *pulled
+	stale.LDAPServers = slices.Clone(pulled.LDAPServers)
+	stale.LDAPServers[0].Certificates = append(slices.Clone(pulled.LDAPServers[0].Certificates), "LOCAL-CERT")
+
+	resolve := func(choice nsx.ConflictChoice) nsx.ConflictResolver {
+		return func(local, current *nsx.LDAPIdentitySource) (nsx.ConflictChoice, error) {
+			if current == nil || !slices.Contains(current.LDAPServers[0].Certificates, "NSX-CERT") {
+				t.Errorf("Expected the current source from NSX, got %+v", current)
+			}
+			return choice, nil
+		}
+	}
+	certificates := func() []string {
+		current, err := client.GetLDAPIdentitySource(ctx, "example.lab")
+		if err != nil {
+			t.Fatalf("GetLDAPIdentitySource failed: %v", err)
+		}
+		return current.LDAPServers[0].Certificates
+	}
+
+	results := client.PushLDAPIdentitySources(ctx, []nsx.LDAPIdentitySource{stale}, nsx.BatchOptions{
+		PushOptions: nsx.PushOptions{ResolveConflict: resolve(nsx.KeepNSX)},
+	})
+	if !results[0].Kept || results[0].Err != nil {
+		t.Errorf("Expected the source kept as it is on NSX, got %+v", results[0])
+	}
+	if certs := certificates(); slices.Contains(certs, "LOCAL-CERT") {
+		t.Errorf("Expected NSX unchanged, got %v", certs)
+	}
+
+	if retried, err := client.PushLDAPIdentitySource(ctx, &stale, nsx.PushOptions{ResolveConflict: resolve(nsx.MergeBoth)}); err != nil || !retried {
+		t.Fatalf("Expected the merged source pushed, got %t, %v", retried, err)
+	}
+	if certs := certificates(); !slices.Contains(certs, "LOCAL-CERT") || !slices.Contains(certs, "NSX-CERT") {
+		t.Errorf("Expected the certificates of both, got %v", certs)
+	}
+
+	stale.Revision = pulled.Revision
+	if _, err := client.PushLDAPIdentitySource(ctx, &stale, nsx.PushOptions{ResolveConflict: resolve(nsx.KeepLocal)}); err != nil {
+		t.Fatalf("Expected the local source pushed, got %v", err)
+	}
+	if certs := certificates(); slices.Contains(certs, "NSX-CERT") {
+		t.Errorf("Expected the local certificates only, got %v", certs)
+	}
+
+	failed := errors.New("aborted")
+	_, err = client.PushLDAPIdentitySource(ctx, &nsx.LDAPIdentitySource{ID: "example.lab", Revision: pulled.Revision},
+		nsx.PushOptions{ResolveConflict: func(_, _ *nsx.LDAPIdentitySource) (nsx.ConflictChoice, error) { return nsx.KeepLocal, failed }})
+	if !errors.Is(err, failed) {
+		t.Errorf("Expected the resolver error, got %v", err)
+	}
+}
+
+func TestPushPulledSource(t *testing.T) {
+	ts, client := setupTestServer()
+	defer ts.Close()
+
+	ctx := context.Background()
+
+	pulled, err := client.GetLDAPIdentitySource(ctx, "example.lab")
+	if err != nil {
+		t.Fatalf("GetLDAPIdentitySource failed: %v", err)
+	}
+	if pulled.Path == "" || pulled.CreateUser == "" {
+		t.Fatalf("Expected NSX-populated fields on a pulled source, got %+v", pulled)
+	}
+
+	// None of the read-only fields are sent back
+	data, err := json.Marshal(pulled.Writable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range nsx.ReadOnlyFields {
+		if _, ok := fields[field]; ok {
+			t.Errorf("Expected Writable to clear %s", field)
+		}
+	}
+
+	// A pull → push round trip through the domain model keeps the metadata
+	source := nsx.DomainToLDAPIdentitySource(nsx.LDAPIdentitySourceToDomain(*pulled))
+	source.Path = pulled.Path
+	if _, err := client.PutLDAPIdentitySource(ctx, &source); err != nil {
+		t.Fatalf("PutLDAPIdentitySource of a pulled source failed: %v", err)
+	}
+	pushed, err := client.GetLDAPIdentitySource(ctx, "example.lab")
+	if err != nil {
+		t.Fatalf("GetLDAPIdentitySource failed: %v", err)
+	}
+	if pushed.DisplayName != "Example Lab Domain" || pushed.Description != pulled.Description {
+		t.Errorf("Expected display name and description to survive the round trip, got %q, %q", pushed.DisplayName, pushed.Description)
+	}
+	if pushed.CreateUser != pulled.CreateUser || pushed.CreateTime != pulled.CreateTime {
+		t.Errorf("Expected creation metadata to be kept, got %+v", pushed)
+	}
+}
+
+func TestPushKeepsUnknownFields(t *testing.T) {
+	ts, client := setupTestServer()
+	defer ts.Close()
+
+	ctx := context.Background()
+
+	// Fields of a newer NSX release that this client has no field for
+	var source nsx.LDAPIdentitySource
+	if err := json.Unmarshal([]byte(`{"id": "future.lab", "domain_name": "future.lab", "base_dn": "DC=future,DC=lab",
+		"ldap_search_timeout": 30,
+		"ldap_servers": [{"url": "ldaps://ad-01.future.lab:636", "enabled": true, "connection_timeout": {"seconds": 10}}]}`), &source); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.PutLDAPIdentitySource(ctx, &source); err != nil {
+		t.Fatalf("PutLDAPIdentitySource with unknown fields failed: %v", err)
+	}
+
+	// pull → domain file → push
+	pulled, err := client.GetLDAPIdentitySource(ctx, "future.lab")
+	if err != nil {
+		t.Fatalf("GetLDAPIdentitySource failed: %v", err)
+	}
+	pulled.Extra["overridden"] = json.RawMessage("false") // read-only
+	data, err := json.Marshal(nsx.LDAPIdentitySourceToDomain(*pulled))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"ldap_search_timeout":30`) || !strings.Contains(string(data), `"connection_timeout":{"seconds":10}`) {
+		t.Errorf("Expected unknown fields in the domain, got %s", data)
+	}
+	if strings.Contains(string(data), "overridden") {
+		t.Errorf("Expected read-only fields to be left out of the domain, got %s", data)
+	}
+	var domain models.Domain
+	if err := json.Unmarshal(data, &domain); err != nil {
+		t.Fatal(err)
+	}
+	domain.Description = "merged"
+	pushed := nsx.DomainToLDAPIdentitySource(domain)
+	if _, err := client.PutLDAPIdentitySource(ctx, &pushed); err != nil {
+		t.Fatalf("PutLDAPIdentitySource of a converted source failed: %v", err)
+	}
+
+	got, err := client.GetLDAPIdentitySource(ctx, "future.lab")
+	if err != nil {
+		t.Fatalf("GetLDAPIdentitySource failed: %v", err)
+	}
+	if string(got.Extra["ldap_search_timeout"]) != "30" || string(got.LDAPServers[0].Extra["connection_timeout"]) != `{"seconds":10}` {
+		t.Errorf("Expected unknown fields to survive the round trip, got %v and %v", got.Extra, got.LDAPServers[0].Extra)
+	}
+	if got.Description != "merged" {
+		t.Errorf("Expected the merged description, got %q", got.Description)
+	}
+}
+
+func TestPushKeepsBindPasswords(t *testing.T) {
+	mockServer := mock.NewServer()
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+	client := nsx.NewClient(nsx.ClientConfig{Host: ts.URL, Username: "admin", Password: "secret"})
+
+	ctx := context.Background()
+	pulled, err := client.GetLDAPIdentitySource(ctx, "example.lab")
+	if err != nil {
+		t.Fatalf("GetLDAPIdentitySource failed: %v", err)
+	}
+	if !pulled.LacksBindPassword() {
+		t.Fatalf("Expected NSX to return no bind passwords, got %+v", pulled.LDAPServers)
+	}
+
+	// Patched without passwords, the servers keep theirs
+	pulled.LDAPServers[0].Certificates = []string{"new-cert"}
+	if _, err := client.PushLDAPIdentitySource(ctx, pulled, nsx.PushOptions{}); err != nil {
+		t.Fatalf("PushLDAPIdentitySource failed: %v", err)
+	}
+	stored := mockServer.GetSources()["example.lab"]
+	if stored.LDAPServers[0].Password != "secret" || stored.LDAPServers[0].Certificates[0] != "new-cert" {
+		t.Errorf("Expected the certificate updated and the bind password kept, got %+v", stored.LDAPServers[0])
+	}
+
+	// Put, they lose them
+	pulled.Revision = stored.Revision
+	if _, err := client.PushLDAPIdentitySource(ctx, pulled, nsx.PushOptions{ClearPasswords: true}); err != nil {
+		t.Fatalf("PushLDAPIdentitySource failed: %v", err)
+	}
+	if stored := mockServer.GetSources()["example.lab"]; stored.LDAPServers[0].Password != "" {
+		t.Errorf("Expected ClearPasswords to clear the bind password, got %+v", stored.LDAPServers[0])
+	}
+}
+
 func TestProbeConfiguredSource(t *testing.T) {
 	ts, client := setupTestServer()
 	defer ts.Close()
@@ -196,6 +518,158 @@ func TestFetchCertificate(t *testing.T) {
 	}
 }
 
+func TestProbeConfiguredSourceFailure(t *testing.T) {
+	mockServer := mock.NewServer()
+	mockServer.SetProbeResult("ldaps://ad-02.example.lab:636", false, "Connection refused")
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	client := nsx.NewClient(nsx.ClientConfig{
+		Host:     ts.URL,
+		Username: "admin",
+		Password: "secret",
+	})
+
+	result, err := client.ProbeConfiguredSource(context.Background(), "example.lab")
+	if err != nil {
+		t.Fatalf("ProbeConfiguredSource failed: %v", err)
+	}
+
+	for _, item := range result.Results {
+		switch item.LDAPServerURL {
+		case "ldaps://ad-02.example.lab:636":
+			if item.Success || item.ErrorMessage != "Connection refused" {
+				t.Errorf("Expected registered failure for %s, got %+v", item.LDAPServerURL, item)
+			}
+		default:
+			if !item.Success {
+				t.Errorf("Expected probe success for %s", item.LDAPServerURL)
+			}
+		}
+	}
+}
+
+func TestFetchCertificateOutcomes(t *testing.T) {
+	mockServer := mock.NewServer()
+	mockServer.SetCertificate("ldaps://custom.example.com:636", nsx.FetchCertificateResult{
+		PEMEncoded: "-----BEGIN CERTIFICATE-----\ncustom\n-----END CERTIFICATE-----",
+	})
+	mockServer.SetCertificateError("ldaps://down.example.com:636", 400, "Unable to establish connection")
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	client := nsx.NewClient(nsx.ClientConfig{
+		Host:     ts.URL,
+		Username: "admin",
+		Password: "secret",
+	})
+
+	ctx := context.Background()
+
+	result, err := client.FetchCertificate(ctx, "ldaps://custom.example.com:636")
+	if err != nil {
+		t.Fatalf("FetchCertificate failed: %v", err)
+	}
+	if result.PEMEncoded != "-----BEGIN CERTIFICATE-----\ncustom\n-----END CERTIFICATE-----" {
+		t.Errorf("Expected registered certificate, got %q", result.PEMEncoded)
+	}
+
+	_, err = client.FetchCertificate(ctx, "ldaps://down.example.com:636")
+	var apiErr *nsx.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected APIError, got %v", err)
+	}
+	if apiErr.HTTPStatus != 400 || apiErr.ErrorMessage != "Unable to establish connection" {
+		t.Errorf("Unexpected API error: %+v", apiErr)
+	}
+
+	mockServer.ResetOutcomes()
+	if _, err := client.FetchCertificate(ctx, "ldaps://down.example.com:636"); err != nil {
+		t.Errorf("Expected default certificate after reset, got %v", err)
+	}
+}
+
+func TestFetchCertificateResponse(t *testing.T) {
+	mockServer := mock.NewServer()
+	mockServer.SetCertificateError("ldaps://ad-02.example.lab:636", 400, "Unable to establish connection")
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	client := nsx.NewClient(nsx.ClientConfig{
+		Host:     ts.URL,
+		Username: "admin",
+		Password: "secret",
+	})
+
+	ctx := context.Background()
+	sources, err := client.ListLDAPIdentitySources(ctx)
+	if err != nil {
+		t.Fatalf("ListLDAPIdentitySources failed: %v", err)
+	}
+	items := nsx.ResponseItems(append(sources.Results, sources.Results...))
+	if len(items) == 0 {
+		t.Fatal("Expected response items")
+	}
+
+	response, failures, err := client.FetchCertificateResponse(ctx, items)
+	if err != nil {
+		t.Fatalf("FetchCertificateResponse failed: %v", err)
+	}
+	if len(failures) != 1 || failures[0].URL != "ldaps://ad-02.example.lab:636" {
+		t.Errorf("Expected ad-02 to fail, got %+v", failures)
+	}
+	if len(response.Results) != len(items)-1 {
+		t.Fatalf("Expected %d results, got %d", len(items)-1, len(response.Results))
+	}
+	result := response.Results[0]
+	if result.Item.URL != items[0].URL || result.JSON.PEMEncoded == "" || len(result.JSON.Details) != 1 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
+
+func TestWaitRealized(t *testing.T) {
+	mockServer := mock.NewServer()
+	mockServer.SetRealization("example.lab", 2, nsx.RealizationSuccess, "")
+	mockServer.SetRealization("example.org", 1, nsx.RealizationError, "LDAP server unreachable")
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	client := nsx.NewClient(nsx.ClientConfig{
+		Host:     ts.URL,
+		Username: "admin",
+		Password: "secret",
+	})
+
+	ctx := context.Background()
+	wait := nsx.RealizationWait{Timeout: time.Second, Interval: 10 * time.Millisecond}
+
+	if err := client.WaitRealized(ctx, "example.lab", wait); err != nil {
+		t.Errorf("Expected example.lab to be realized after two polls, got %v", err)
+	}
+
+	var failed *nsx.RealizationFailedError
+	err := client.WaitRealized(ctx, "example.org", wait)
+	if !errors.As(err, &failed) || len(failed.Messages) != 1 || failed.Messages[0] != "LDAP server unreachable" {
+		t.Errorf("Expected realization failure with the alarm message, got %v", err)
+	}
+
+	// Sources NSX does not track count as realized
+	if err := client.WaitRealized(ctx, "missing.lab", wait); err != nil {
+		t.Errorf("Expected no error for an untracked source, got %v", err)
+	}
+
+	mockServer.SetRealization("example.lab", 1000, nsx.RealizationSuccess, "")
+	wait.Timeout = 50 * time.Millisecond
+	if err := client.WaitRealized(ctx, "example.lab", wait); !errors.Is(err, nsx.ErrRealizationTimeout) {
+		t.Errorf("Expected ErrRealizationTimeout, got %v", err)
+	}
+
+	// A zero timeout does not poll
+	if err := client.WaitRealized(ctx, "example.lab", nsx.RealizationWait{}); err != nil {
+		t.Errorf("Expected no wait without a timeout, got %v", err)
+	}
+}
+
 func TestSearch(t *testing.T) {
 	ts, client := setupTestServer()
 	defer ts.Close()
@@ -250,3 +724,191 @@ func TestAuthenticationFailure(t *testing.T) {
 		t.Error("Expected authentication error")
 	}
 }
+
+func TestCorrelationHeader(t *testing.T) {
+	mockServer := mock.NewServer()
+	var ids []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get(nsx.DefaultCorrelationHeader))
+		mockServer.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	client := nsx.NewClient(nsx.ClientConfig{Host: ts.URL, Username: "admin", Password: "secret"})
+	ctx := context.Background()
+	if _, err := client.ListLDAPIdentitySources(ctx); err != nil {
+		t.Fatalf("ListLDAPIdentitySources failed: %v", err)
+	}
+	_, err := client.GetLDAPIdentitySource(ctx, "missing.lab")
+
+	if len(ids) != 2 || ids[0] == "" || ids[0] == ids[1] || !strings.HasPrefix(ids[0], "ldapmerge-") {
+		t.Fatalf("Expected distinct request ids, got %q", ids)
+	}
+	var apiErr *nsx.APIError
+	if !errors.As(err, &apiErr) || apiErr.RequestID != ids[1] || !strings.Contains(err.Error(), ids[1]) {
+		t.Errorf("Expected an error with request id %s, got %v", ids[1], err)
+	}
+
+	// Requests of a run are prefixed with its run ID
+	ids = nil
+	if _, err := client.ListLDAPIdentitySources(runid.With(ctx, "20250115T103000Z-3f9a2c1b")); err != nil {
+		t.Fatalf("ListLDAPIdentitySources failed: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "20250115T103000Z-3f9a2c1b-0003" {
+		t.Errorf("Expected a request id with the run ID, got %q", ids)
+	}
+
+	ids = nil
+	client = nsx.NewClient(nsx.ClientConfig{Host: ts.URL, Username: "admin", Password: "secret", Diagnostics: nsx.Diagnostics{CorrelationHeader: nsx.NoCorrelationHeader}})
+	if _, err := client.ListLDAPIdentitySources(ctx); err != nil {
+		t.Fatalf("ListLDAPIdentitySources failed: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "" {
+		t.Errorf("Expected no request id, got %q", ids)
+	}
+}
+
+func TestSlowCallsAndEndpointMetrics(t *testing.T) {
+	mockServer := mock.NewServer()
+	mockServer.SetLatency(20 * time.Millisecond)
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	client := nsx.NewClient(nsx.ClientConfig{
+		Host:        ts.URL,
+		Username:    "admin",
+		Password:    "secret",
+		Diagnostics: nsx.Diagnostics{SlowThreshold: 10 * time.Millisecond},
+	})
+	ctx := context.Background()
+	if _, err := client.GetLDAPIdentitySource(ctx, "example.lab"); err != nil {
+		t.Fatalf("GetLDAPIdentitySource failed: %v", err)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected one log entry, got %q", logs.String())
+	}
+	if entry["msg"] != "slow NSX API request" || entry["endpoint"] != "aaa/ldap-identity-sources/{id}" || entry["request_id"] == "" {
+		t.Errorf("Unexpected slow call entry %v", entry)
+	}
+
+	found := false
+	for _, family := range metrics.Default.Gather(ctx) {
+		for _, sample := range family.Samples {
+			if family.Name == "ldapmerge_nsx_request_duration_seconds" && sample.Suffix == "_count" &&
+				sample.Labels["endpoint"] == "aaa/ldap-identity-sources/{id}" && sample.Labels["host"] == strings.TrimPrefix(ts.URL, "http://") {
+				found = true
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected a latency sample of the endpoint and host")
+	}
+}
+
+func TestGeneratedSources(t *testing.T) {
+	mockServer := mock.NewServer()
+	mockServer.Generate(25, 3)
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	client := nsx.NewClient(nsx.ClientConfig{
+		Host:     ts.URL,
+		Username: "admin",
+		Password: "secret",
+	})
+
+	result, err := client.ListLDAPIdentitySources(context.Background())
+	if err != nil {
+		t.Fatalf("ListLDAPIdentitySources failed: %v", err)
+	}
+
+	if result.ResultCount != 25 {
+		t.Errorf("Expected 25 sources, got %d", result.ResultCount)
+	}
+
+	for _, source := range result.Results {
+		if len(source.LDAPServers) != 3 {
+			t.Errorf("Expected 3 servers for %s, got %d", source.ID, len(source.LDAPServers))
+		}
+	}
+
+	response := mock.GenerateResponse(result.Results)
+	if len(response.Results) != 75 {
+		t.Errorf("Expected 75 certificate results, got %d", len(response.Results))
+	}
+}
+
+func TestMockLatency(t *testing.T) {
+	mockServer := mock.NewServer()
+	mockServer.SetLatency(50 * time.Millisecond)
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	client := nsx.NewClient(nsx.ClientConfig{
+		Host:     ts.URL,
+		Username: "admin",
+		Password: "secret",
+	})
+
+	start := time.Now()
+	if _, err := client.ListLDAPIdentitySources(context.Background()); err != nil {
+		t.Fatalf("ListLDAPIdentitySources failed: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected at least 50ms latency, got %s", elapsed)
+	}
+}
+
+func benchmarkClient(b *testing.B, sources, servers int) (*httptest.Server, *nsx.Client) {
+	b.Helper()
+
+	mockServer := mock.NewServer()
+	mockServer.Generate(sources, servers)
+	ts := httptest.NewServer(mockServer)
+
+	client := nsx.NewClient(nsx.ClientConfig{
+		Host:     ts.URL,
+		Username: "admin",
+		Password: "secret",
+	})
+
+	return ts, client
+}
+
+func BenchmarkPullLarge(b *testing.B) {
+	ts, client := benchmarkClient(b, 500, 4)
+	defer ts.Close()
+
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		result, err := client.ListLDAPIdentitySources(ctx)
+		if err != nil {
+			b.Fatalf("ListLDAPIdentitySources failed: %v", err)
+		}
+		_ = nsx.LDAPIdentitySourcesToDomains(result.Results)
+	}
+}
+
+func BenchmarkPushLarge(b *testing.B) {
+	ts, client := benchmarkClient(b, 200, 4)
+	defer ts.Close()
+
+	ctx := context.Background()
+	sources := mock.GenerateSources(200, 4)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range sources {
+			if _, err := client.PutLDAPIdentitySource(ctx, &sources[j]); err != nil {
+				b.Fatalf("PutLDAPIdentitySource failed: %v", err)
+			}
+		}
+	}
+}
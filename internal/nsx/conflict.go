@@ -0,0 +1,104 @@
+package nsx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ConflictChoice is how a push resolves a revision conflict: the source
+// changed on NSX since it was pulled.
+type ConflictChoice int
+
+const (
+	// KeepNSX leaves the source on NSX as it is
+	KeepNSX ConflictChoice = iota
+	// KeepLocal puts the pushed source at the current revision,
+	// overwriting the change on NSX
+	KeepLocal
+	// MergeBoth puts the source on NSX with the servers and certificates
+	// of the pushed source added; see MergeSources
+	MergeBoth
+)
+
+// ConflictResolver chooses how to push local, which changed on NSX since it
+// was pulled and is now current there; current is nil if the source was
+// deleted. An error fails the push of the source.
+type ConflictResolver func(local, current *LDAPIdentitySource) (ConflictChoice, error)
+
+// ErrConflictKept is returned for a source left as it is on NSX after a
+// revision conflict (KeepNSX).
+var ErrConflictKept = errors.New("source changed on NSX since pull, kept as it is on NSX")
+
+// resolveConflict pushes source, which failed to push with a revision
+// conflict, as resolve chooses. pushed reports whether it was put again.
+func (c *Client) resolveConflict(ctx context.Context, source *LDAPIdentitySource, opts PushOptions) (pushed bool, err error) {
+	current, err := c.GetLDAPIdentitySource(ctx, source.ID)
+	if IsNotFound(err) {
+		current, err = nil, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to re-read %s: %w", source.ID, err)
+	}
+
+	choice, err := opts.ResolveConflict(source, current)
+	if err != nil {
+		return false, err
+	}
+
+	var revision *int64
+	if current != nil {
+		revision = current.Revision
+	}
+	switch choice {
+	case KeepLocal:
+		source.Revision = revision
+	case MergeBoth:
+		if current != nil {
+			merged := MergeSources(current, source)
+			source = &merged
+		}
+		source.Revision = revision
+	default:
+		return false, fmt.Errorf("%s: %w", source.ID, ErrConflictKept)
+	}
+
+	_, err = c.pushFunc(source, opts)(ctx, source)
+	return true, err
+}
+
+// MergeSources returns current, the source on NSX, with the servers of local
+// it lacks added and the certificates of local added to the servers both
+// have. Bind passwords set on local are kept.
+func MergeSources(current, local *LDAPIdentitySource) LDAPIdentitySource {
+	merged := *current
+	merged.LDAPServers = slices.Clone(current.LDAPServers)
+
+	for _, server := range local.LDAPServers {
+		i := slices.IndexFunc(merged.LDAPServers, func(s LDAPServer) bool {
+			return strings.EqualFold(s.URL, server.URL)
+		})
+		if i < 0 {
+			merged.LDAPServers = append(merged.LDAPServers, server)
+			continue
+		}
+
+		existing := &merged.LDAPServers[i]
+		certs := slices.Clone(existing.Certificates)
+		for _, cert := range server.Certificates {
+			if !slices.ContainsFunc(certs, func(c string) bool {
+				return strings.TrimSpace(c) == strings.TrimSpace(cert)
+			}) {
+				certs = append(certs, cert)
+			}
+		}
+		existing.Certificates = certs
+		if server.Password != "" {
+			existing.Password = server.Password
+		}
+	}
+
+	return merged
+}
@@ -6,7 +6,9 @@ import (
 	"ldapmerge/internal/models"
 )
 
-// DomainToLDAPIdentitySource converts internal Domain model to NSX LDAPIdentitySource
+// DomainToLDAPIdentitySource converts internal Domain model to NSX LDAPIdentitySource.
+// Members of Extra are passed on, so a pull, merge and push keeps the fields
+// of newer NSX releases.
 func DomainToLDAPIdentitySource(d models.Domain) LDAPIdentitySource {
 	servers := make([]LDAPServer, len(d.LDAPServers))
 	for i, s := range d.LDAPServers {
@@ -20,21 +22,32 @@ func DomainToLDAPIdentitySource(d models.Domain) LDAPIdentitySource {
 			BindIdentity: s.BindUsername,
 			Password:     s.BindPassword,
 			Certificates: s.Certificates,
+			Extra:        s.Extra,
 		}
 	}
 
+	displayName := d.DisplayName
+	if displayName == "" {
+		displayName = d.DomainName
+	}
+
 	return LDAPIdentitySource{
 		ID:                     d.ID,
-		DisplayName:            d.DomainName,
+		DisplayName:            displayName,
+		Description:            d.Description,
 		DomainName:             d.DomainName,
 		BaseDN:                 d.BaseDN,
 		AlternativeDomainNames: d.AlternativeDomainNames,
 		LDAPServers:            servers,
 		ResourceType:           "LdapIdentitySource",
+		Tags:                   tagsToNSX(d.Tags),
+		Revision:               d.Revision,
+		Extra:                  d.Extra,
 	}
 }
 
-// LDAPIdentitySourceToDomain converts NSX LDAPIdentitySource to internal Domain model
+// LDAPIdentitySourceToDomain converts NSX LDAPIdentitySource to internal Domain model.
+// Members the client does not know are kept in Extra, except read-only ones.
 func LDAPIdentitySourceToDomain(s LDAPIdentitySource) models.Domain {
 	servers := make([]models.LDAPServer, len(s.LDAPServers))
 	for i, srv := range s.LDAPServers {
@@ -45,6 +58,7 @@ func LDAPIdentitySourceToDomain(s LDAPIdentitySource) models.Domain {
 			BindUsername: srv.BindIdentity,
 			BindPassword: srv.Password,
 			Certificates: srv.Certificates,
+			Extra:        srv.Extra,
 		}
 	}
 
@@ -54,7 +68,34 @@ func LDAPIdentitySourceToDomain(s LDAPIdentitySource) models.Domain {
 		BaseDN:                 s.BaseDN,
 		AlternativeDomainNames: s.AlternativeDomainNames,
 		LDAPServers:            servers,
+		DisplayName:            s.DisplayName,
+		Description:            s.Description,
+		Tags:                   tagsFromNSX(s.Tags),
+		Revision:               s.Revision,
+		Extra:                  withoutReadOnly(s.Extra),
+	}
+}
+
+func tagsToNSX(tags []models.Tag) []Tag {
+	if tags == nil {
+		return nil
+	}
+	out := make([]Tag, len(tags))
+	for i, t := range tags {
+		out[i] = Tag{Scope: t.Scope, Tag: t.Tag}
+	}
+	return out
+}
+
+func tagsFromNSX(tags []Tag) []models.Tag {
+	if tags == nil {
+		return nil
+	}
+	out := make([]models.Tag, len(tags))
+	for i, t := range tags {
+		out[i] = models.Tag{Scope: t.Scope, Tag: t.Tag}
 	}
+	return out
 }
 
 // DomainsToLDAPIdentitySources converts slice of Domains to LDAPIdentitySources
@@ -0,0 +1,96 @@
+package mock
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+)
+
+// SetLatency sets an artificial delay applied to every request
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Latency returns the artificial delay applied to every request
+func (s *Server) Latency() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.latency
+}
+
+// Generate replaces all sources with n synthesized identity sources having
+// m LDAP servers each, for load and performance testing.
+func (s *Server) Generate(n, m int) {
+	sources := make(map[string]*nsx.LDAPIdentitySource, n)
+	for _, source := range GenerateSources(n, m) {
+		sources[source.ID] = &source
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sources = sources
+}
+
+// GenerateSources synthesizes n identity sources with m LDAP servers each.
+// Names are deterministic: load-0001.example.lab, dc01.load-0001.example.lab, ...
+func GenerateSources(n, m int) []nsx.LDAPIdentitySource {
+	sources := make([]nsx.LDAPIdentitySource, n)
+	for i := range sources {
+		domain := fmt.Sprintf("load-%04d.example.lab", i+1)
+
+		servers := make([]nsx.LDAPServer, m)
+		for j := range servers {
+			url := fmt.Sprintf("ldaps://dc%02d.%s:636", j+1, domain)
+			servers[j] = nsx.LDAPServer{
+				URL:          url,
+				Enabled:      true,
+				BindIdentity: "sync@" + domain,
+				Certificates: []string{generatePEM(url)},
+			}
+		}
+
+		sources[i] = nsx.LDAPIdentitySource{
+			ID:           domain,
+			DisplayName:  domain,
+			ResourceType: "LdapIdentitySource",
+			DomainName:   domain,
+			BaseDN:       fmt.Sprintf("DC=load-%04d,DC=example,DC=lab", i+1),
+			LDAPServers:  servers,
+		}
+	}
+	return sources
+}
+
+// GenerateResponse builds a certificate response with a fresh certificate
+// for every server of the given sources, as Ansible would produce.
+func GenerateResponse(sources []nsx.LDAPIdentitySource) models.CertificateResponse {
+	var response models.CertificateResponse
+	for _, source := range sources {
+		for _, server := range source.LDAPServers {
+			response.Results = append(response.Results, models.CertificateResult{
+				JSON: models.CertificateJSON{
+					PEMEncoded: generatePEM("renewed " + server.URL),
+					Details:    []models.CertificateDetail{{SubjectCN: extractHostFromURL(server.URL)}},
+				},
+				Item: models.ResponseItem{
+					URL:      server.URL,
+					StartTLS: "false",
+					Enabled:  "true",
+				},
+				AnsibleLoopVar: "item",
+			})
+		}
+	}
+	return response
+}
+
+// generatePEM returns a placeholder PEM block of realistic size.
+func generatePEM(seed string) string {
+	const line = "MIIDdzCCAl+gAwIBAgIEAgAAuTANBgkqhkiG9w0BAQUFADBaMQswCQYDVQQGEwJJ\n"
+	return "-----BEGIN CERTIFICATE-----\n" + strings.Repeat(line, 20) + "# " + seed + "\n-----END CERTIFICATE-----"
+}
@@ -0,0 +1,142 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"ldapmerge/internal/nsx"
+)
+
+// certificateOutcome is a registered fetch_certificate response for one URL
+type certificateOutcome struct {
+	result  *nsx.FetchCertificateResult
+	status  int
+	message string
+}
+
+// realizationOutcome is a registered realization outcome for one source
+type realizationOutcome struct {
+	pending int // polls still answered with IN_PROGRESS
+	status  string
+	message string
+}
+
+// SetProbeResult registers the probe outcome for an LDAP server URL.
+// An empty errorMessage with success=false reports a generic failure.
+func (s *Server) SetProbeResult(url string, success bool, errorMessage string) {
+	if !success && errorMessage == "" {
+		errorMessage = fmt.Sprintf("Unable to connect to %s", url)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.probeResults[url] = nsx.ProbeResultItem{
+		LDAPServerURL: url,
+		Success:       success,
+		ErrorMessage:  errorMessage,
+	}
+}
+
+// SetCertificate registers the fetch_certificate payload returned for an LDAP server URL
+func (s *Server) SetCertificate(url string, result nsx.FetchCertificateResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.certificates[url] = certificateOutcome{result: &result}
+}
+
+// SetCertificateError makes fetch_certificate for an LDAP server URL fail
+// with the given HTTP status and NSX error message
+func (s *Server) SetCertificateError(url string, status int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.certificates[url] = certificateOutcome{status: status, message: message}
+}
+
+// SetRealization registers the realization outcome of an identity source.
+// The status endpoint reports IN_PROGRESS for the first pending polls, then
+// status; an ERROR status carries message as the alarm of the realized entity.
+func (s *Server) SetRealization(id string, pending int, status, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.realizations[id] = &realizationOutcome{pending: pending, status: status, message: message}
+}
+
+// ResetOutcomes removes all registered probe, fetch_certificate and
+// realization outcomes
+func (s *Server) ResetOutcomes() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.probeResults = make(map[string]nsx.ProbeResultItem)
+	s.certificates = make(map[string]certificateOutcome)
+	s.realizations = make(map[string]*realizationOutcome)
+}
+
+// probeServers builds probe results for the given servers, using registered
+// outcomes where present and success otherwise
+func (s *Server) probeServers(servers []nsx.LDAPServer) nsx.ProbeResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	results := make([]nsx.ProbeResultItem, len(servers))
+	for i, server := range servers {
+		if item, ok := s.probeResults[server.URL]; ok {
+			results[i] = item
+			continue
+		}
+		results[i] = nsx.ProbeResultItem{
+			LDAPServerURL: server.URL,
+			Success:       true,
+		}
+	}
+
+	return nsx.ProbeResult{Results: results}
+}
+
+// pollRealization returns the realization state and alarm of the source at
+// an intent path, counting the poll. Sources without a registered outcome
+// are realized; ok is false for an unknown source.
+func (s *Server) pollRealization(intentPath string) (status, message string, ok bool) {
+	id := strings.TrimPrefix(intentPath, nsx.LDAPIdentitySourcePath(""))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sources[id]; !ok {
+		return "", "", false
+	}
+	outcome, ok := s.realizations[id]
+	if !ok {
+		return nsx.RealizationSuccess, "", true
+	}
+	if outcome.pending > 0 {
+		outcome.pending--
+		return nsx.RealizationInProgress, "", true
+	}
+	return outcome.status, outcome.message, true
+}
+
+// writeCertificateOutcome writes a registered fetch_certificate response.
+// It returns false if nothing is registered for the URL.
+func (s *Server) writeCertificateOutcome(w http.ResponseWriter, url string) bool {
+	s.mu.RLock()
+	outcome, ok := s.certificates[url]
+	s.mu.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	if outcome.result != nil {
+		_ = json.NewEncoder(w).Encode(outcome.result)
+		return true
+	}
+
+	w.WriteHeader(outcome.status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error_code":    outcome.status,
+		"error_message": outcome.message,
+	})
+	return true
+}
@@ -3,9 +3,11 @@ package mock
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"ldapmerge/internal/nsx"
 )
@@ -15,8 +17,13 @@ type Server struct {
 	mux      *http.ServeMux
 	mu       sync.RWMutex
 	sources  map[string]*nsx.LDAPIdentitySource
+	latency  time.Duration
 	Username string
 	Password string
+
+	probeResults map[string]nsx.ProbeResultItem
+	certificates map[string]certificateOutcome
+	realizations map[string]*realizationOutcome
 }
 
 // NewServer creates a new mock NSX server
@@ -26,6 +33,10 @@ func NewServer() *Server {
 		sources:  make(map[string]*nsx.LDAPIdentitySource),
 		Username: "admin",
 		Password: "secret",
+
+		probeResults: make(map[string]nsx.ProbeResultItem),
+		certificates: make(map[string]certificateOutcome),
+		realizations: make(map[string]*realizationOutcome),
 	}
 
 	s.setupRoutes()
@@ -36,6 +47,14 @@ func NewServer() *Server {
 
 // ServeHTTP implements http.Handler
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if latency := s.Latency(); latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
 	// Basic auth check
 	user, pass, ok := r.BasicAuth()
 	if !ok || user != s.Username || pass != s.Password {
@@ -54,6 +73,8 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (s *Server) setupRoutes() {
 	s.mux.HandleFunc("/policy/api/v1/aaa/ldap-identity-sources", s.handleLDAPIdentitySources)
 	s.mux.HandleFunc("/policy/api/v1/aaa/ldap-identity-sources/", s.handleLDAPIdentitySource)
+	s.mux.HandleFunc("/policy/api/v1/infra/realized-state/status", s.realizationStatus)
+	s.mux.HandleFunc("/policy/api/v1/infra/realized-state/realized-entities", s.realizedEntities)
 }
 
 func (s *Server) seedData() {
@@ -109,6 +130,10 @@ func (s *Server) seedData() {
 			},
 		},
 	}
+
+	for _, source := range s.sources {
+		s.stamp(source, nil)
+	}
 }
 
 func (s *Server) handleLDAPIdentitySources(w http.ResponseWriter, r *http.Request) {
@@ -178,7 +203,7 @@ func (s *Server) listSources(w http.ResponseWriter, _ *http.Request) {
 
 	results := make([]nsx.LDAPIdentitySource, 0, len(s.sources))
 	for _, source := range s.sources {
-		results = append(results, *source)
+		results = append(results, redacted(source))
 	}
 
 	response := nsx.LDAPIdentitySourceListResult{
@@ -203,17 +228,12 @@ func (s *Server) getSource(w http.ResponseWriter, _ *http.Request, id string) {
 		return
 	}
 
-	_ = json.NewEncoder(w).Encode(source)
+	_ = json.NewEncoder(w).Encode(redacted(source))
 }
 
 func (s *Server) putSource(w http.ResponseWriter, r *http.Request, id string) {
 	var source nsx.LDAPIdentitySource
-	if err := json.NewDecoder(r.Body).Decode(&source); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"error_code":    400,
-			"error_message": "Invalid JSON body",
-		})
+	if !decodeSource(w, r, &source) {
 		return
 	}
 
@@ -223,10 +243,17 @@ func (s *Server) putSource(w http.ResponseWriter, r *http.Request, id string) {
 	}
 
 	s.mu.Lock()
+	existing, ok := s.sources[id]
+	if ok && source.Revision != nil && *source.Revision != revision(existing) {
+		s.mu.Unlock()
+		writeRevisionConflict(w, id)
+		return
+	}
+	s.stamp(&source, existing)
 	s.sources[id] = &source
 	s.mu.Unlock()
 
-	_ = json.NewEncoder(w).Encode(source)
+	_ = json.NewEncoder(w).Encode(redacted(&source))
 }
 
 func (s *Server) patchSource(w http.ResponseWriter, r *http.Request, id string) {
@@ -234,20 +261,22 @@ func (s *Server) patchSource(w http.ResponseWriter, r *http.Request, id string)
 	defer s.mu.Unlock()
 
 	existing, ok := s.sources[id]
+	previous := existing
 	if !ok {
 		existing = &nsx.LDAPIdentitySource{ID: id, ResourceType: "LdapIdentitySource"}
 	}
 
 	var patch nsx.LDAPIdentitySource
-	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		_ = json.NewEncoder(w).Encode(map[string]interface{}{
-			"error_code":    400,
-			"error_message": "Invalid JSON body",
-		})
+	if !decodeSource(w, r, &patch) {
 		return
 	}
 
+	if ok && patch.Revision != nil && *patch.Revision != revision(existing) {
+		writeRevisionConflict(w, id)
+		return
+	}
+	s.stamp(existing, previous)
+
 	// Apply patch (simplified)
 	if patch.DisplayName != "" {
 		existing.DisplayName = patch.DisplayName
@@ -265,11 +294,107 @@ func (s *Server) patchSource(w http.ResponseWriter, r *http.Request, id string)
 		existing.AlternativeDomainNames = patch.AlternativeDomainNames
 	}
 	if len(patch.LDAPServers) > 0 {
-		existing.LDAPServers = patch.LDAPServers
+		existing.LDAPServers = keepPasswords(patch.LDAPServers, existing.LDAPServers)
 	}
 
 	s.sources[id] = existing
-	_ = json.NewEncoder(w).Encode(existing)
+	_ = json.NewEncoder(w).Encode(redacted(existing))
+}
+
+// decodeSource decodes the identity source in the body of r into source.
+// Like a strict NSX Manager, it rejects bodies that set read-only fields.
+func decodeSource(w http.ResponseWriter, r *http.Request, source *nsx.LDAPIdentitySource) bool {
+	var fields map[string]json.RawMessage
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &fields)
+	}
+	if err == nil {
+		err = json.Unmarshal(body, source)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error_code":    400,
+			"error_message": "Invalid JSON body",
+		})
+		return false
+	}
+
+	for _, field := range nsx.ReadOnlyFields {
+		if _, ok := fields[field]; ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error_code":    255,
+				"error_message": fmt.Sprintf("Field '%s' is read-only", field),
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// stamp sets the fields NSX populates itself on source, which replaces
+// existing; existing is nil for a new source.
+func (s *Server) stamp(source, existing *nsx.LDAPIdentitySource) {
+	now := time.Now().UnixMilli()
+	next, createUser, createTime := int64(0), s.Username, now
+	if existing != nil {
+		next, createUser, createTime = revision(existing)+1, existing.CreateUser, existing.CreateTime
+	}
+
+	source.Revision = &next
+	source.Path = nsx.LDAPIdentitySourcePath(source.ID)
+	source.RelativePath = source.ID
+	source.CreateUser, source.CreateTime = createUser, createTime
+	source.LastModifiedUser, source.LastModifiedTime = s.Username, now
+	source.Protection = "NOT_PROTECTED"
+}
+
+// keepPasswords returns servers with the bind password of the matching
+// server in stored set on those patched without one, as NSX does
+func keepPasswords(servers, stored []nsx.LDAPServer) []nsx.LDAPServer {
+	for i := range servers {
+		if servers[i].Password != "" {
+			continue
+		}
+		for _, old := range stored {
+			if strings.EqualFold(old.URL, servers[i].URL) && old.BindIdentity == servers[i].BindIdentity {
+				servers[i].Password = old.Password
+				break
+			}
+		}
+	}
+	return servers
+}
+
+// redacted returns source as NSX returns it, without bind passwords
+func redacted(source *nsx.LDAPIdentitySource) nsx.LDAPIdentitySource {
+	out := *source
+	out.LDAPServers = make([]nsx.LDAPServer, len(source.LDAPServers))
+	for i, server := range source.LDAPServers {
+		server.Password = ""
+		out.LDAPServers[i] = server
+	}
+	return out
+}
+
+// revision returns the _revision of a stored source; sources stored without
+// one are at revision 0
+func revision(source *nsx.LDAPIdentitySource) int64 {
+	if source.Revision == nil {
+		return 0
+	}
+	return *source.Revision
+}
+
+// writeRevisionConflict rejects an update with a stale _revision as NSX does
+func writeRevisionConflict(w http.ResponseWriter, id string) {
+	w.WriteHeader(http.StatusConflict)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error_code":    604,
+		"error_message": fmt.Sprintf("The object LdapIdentitySource/%s was modified by somebody else", id),
+	})
 }
 
 func (s *Server) deleteSource(w http.ResponseWriter, _ *http.Request, id string) {
@@ -296,15 +421,7 @@ func (s *Server) probeLDAPServer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	results := make([]nsx.ProbeResultItem, len(source.LDAPServers))
-	for i, server := range source.LDAPServers {
-		results[i] = nsx.ProbeResultItem{
-			LDAPServerURL: server.URL,
-			Success:       true,
-		}
-	}
-
-	_ = json.NewEncoder(w).Encode(nsx.ProbeResult{Results: results})
+	_ = json.NewEncoder(w).Encode(s.probeServers(source.LDAPServers))
 }
 
 func (s *Server) probeIdentitySource(w http.ResponseWriter, r *http.Request) {
@@ -314,15 +431,7 @@ func (s *Server) probeIdentitySource(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	results := make([]nsx.ProbeResultItem, len(source.LDAPServers))
-	for i, server := range source.LDAPServers {
-		results[i] = nsx.ProbeResultItem{
-			LDAPServerURL: server.URL,
-			Success:       true,
-		}
-	}
-
-	_ = json.NewEncoder(w).Encode(nsx.ProbeResult{Results: results})
+	_ = json.NewEncoder(w).Encode(s.probeServers(source.LDAPServers))
 }
 
 func (s *Server) probeConfiguredSource(w http.ResponseWriter, _ *http.Request, id string) {
@@ -339,15 +448,7 @@ func (s *Server) probeConfiguredSource(w http.ResponseWriter, _ *http.Request, i
 		return
 	}
 
-	results := make([]nsx.ProbeResultItem, len(source.LDAPServers))
-	for i, server := range source.LDAPServers {
-		results[i] = nsx.ProbeResultItem{
-			LDAPServerURL: server.URL,
-			Success:       true,
-		}
-	}
-
-	_ = json.NewEncoder(w).Encode(nsx.ProbeResult{Results: results})
+	_ = json.NewEncoder(w).Encode(s.probeServers(source.LDAPServers))
 }
 
 func (s *Server) fetchCertificate(w http.ResponseWriter, r *http.Request) {
@@ -357,6 +458,10 @@ func (s *Server) fetchCertificate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.writeCertificateOutcome(w, req.LDAPServerURL) {
+		return
+	}
+
 	// Generate mock certificate
 	result := nsx.FetchCertificateResult{
 		PEMEncoded: fmt.Sprintf("-----BEGIN CERTIFICATE-----\nMock certificate for %s\n-----END CERTIFICATE-----", req.LDAPServerURL),
@@ -418,6 +523,46 @@ func (s *Server) searchSource(w http.ResponseWriter, r *http.Request, id string)
 	_ = json.NewEncoder(w).Encode(result)
 }
 
+func (s *Server) realizationStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	intentPath := r.URL.Query().Get("intent_path")
+	status, _, ok := s.pollRealization(intentPath)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"error_code":    404,
+			"error_message": fmt.Sprintf("Intent path '%s' not found", intentPath),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(nsx.RealizationStatus{
+		IntentPath:         intentPath,
+		ConsolidatedStatus: nsx.ConsolidatedStatus{ConsolidatedStatus: status},
+	})
+}
+
+func (s *Server) realizedEntities(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	intentPath := r.URL.Query().Get("intent_path")
+	s.mu.RLock()
+	outcome := s.realizations[strings.TrimPrefix(intentPath, nsx.LDAPIdentitySourcePath(""))]
+	s.mu.RUnlock()
+
+	entity := nsx.RealizedEntity{ID: intentPath, State: "REALIZED"}
+	if outcome != nil && outcome.status == nsx.RealizationError {
+		entity.State = "ERROR"
+		entity.Alarms = []nsx.RealizedAlarm{{Message: outcome.message}}
+	}
+
+	_ = json.NewEncoder(w).Encode(nsx.RealizedEntityListResult{
+		Results:     []nsx.RealizedEntity{entity},
+		ResultCount: 1,
+	})
+}
+
 func extractHostFromURL(urlStr string) string {
 	// Simple extraction of host from URL like ldaps://host:port
 	urlStr = strings.TrimPrefix(urlStr, "ldaps://")
@@ -0,0 +1,196 @@
+package nsx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Consolidated realization states reported by NSX Manager
+const (
+	RealizationSuccess    = "SUCCESS"
+	RealizationInProgress = "IN_PROGRESS"
+	RealizationError      = "ERROR"
+	RealizationUnknown    = "UNKNOWN"
+)
+
+// Realization wait defaults
+const (
+	DefaultRealizationTimeout  = 60 * time.Second
+	DefaultRealizationInterval = 2 * time.Second
+)
+
+// ErrRealizationTimeout is returned by WaitRealized when NSX has not
+// realized a change within the timeout.
+var ErrRealizationTimeout = errors.New("timed out waiting for NSX to realize the change")
+
+// RealizationStatus is the realization state of a policy intent.
+// GET /policy/api/v1/infra/realized-state/status?intent_path={path}
+type RealizationStatus struct {
+	IntentPath         string             `json:"intent_path,omitempty"`
+	PublishStatus      string             `json:"publish_status,omitempty"`
+	ConsolidatedStatus ConsolidatedStatus `json:"consolidated_status"`
+}
+
+// ConsolidatedStatus is the realization state across enforcement points
+type ConsolidatedStatus struct {
+	ConsolidatedStatus string `json:"consolidated_status"`
+}
+
+// State returns the consolidated realization state, RealizationUnknown if
+// NSX reported none.
+func (s *RealizationStatus) State() string {
+	if s.ConsolidatedStatus.ConsolidatedStatus == "" {
+		return RealizationUnknown
+	}
+	return s.ConsolidatedStatus.ConsolidatedStatus
+}
+
+// RealizedEntity is an object NSX realized for a policy intent
+type RealizedEntity struct {
+	ID     string          `json:"id,omitempty"`
+	State  string          `json:"state,omitempty"`
+	Alarms []RealizedAlarm `json:"alarms,omitempty"`
+}
+
+// RealizedAlarm is an error raised while realizing an entity
+type RealizedAlarm struct {
+	Message string `json:"message"`
+}
+
+// RealizedEntityListResult is the response of the realized entities endpoint
+type RealizedEntityListResult struct {
+	Results     []RealizedEntity `json:"results"`
+	ResultCount int              `json:"result_count"`
+}
+
+// RealizationFailedError reports that NSX accepted a change but failed to
+// realize it.
+type RealizationFailedError struct {
+	ID       string
+	Messages []string // alarms of the realized entities
+}
+
+func (e *RealizationFailedError) Error() string {
+	if len(e.Messages) == 0 {
+		return fmt.Sprintf("NSX failed to realize %s", e.ID)
+	}
+	return fmt.Sprintf("NSX failed to realize %s: %s", e.ID, strings.Join(e.Messages, "; "))
+}
+
+// RealizationWait configures WaitRealized.
+type RealizationWait struct {
+	Timeout  time.Duration // 0 does not wait
+	Interval time.Duration // between polls; 0 means DefaultRealizationInterval
+}
+
+// LDAPIdentitySourcePath returns the policy intent path of an identity source.
+func LDAPIdentitySourcePath(id string) string {
+	return "/aaa/ldap-identity-sources/" + id
+}
+
+// GetRealizationStatus retrieves the realization state of a policy intent
+// GET /policy/api/v1/infra/realized-state/status?intent_path={path}
+func (c *Client) GetRealizationStatus(ctx context.Context, intentPath string) (*RealizationStatus, error) {
+	path := "/policy/api/v1/infra/realized-state/status?intent_path=" + url.QueryEscape(intentPath)
+	data, _, err := c.doRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result RealizationStatus
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// ListRealizedEntities retrieves the entities realized for a policy intent
+// GET /policy/api/v1/infra/realized-state/realized-entities?intent_path={path}
+func (c *Client) ListRealizedEntities(ctx context.Context, intentPath string) (*RealizedEntityListResult, error) {
+	path := "/policy/api/v1/infra/realized-state/realized-entities?intent_path=" + url.QueryEscape(intentPath)
+	data, _, err := c.doRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result RealizedEntityListResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &result, nil
+}
+
+// WaitRealized polls the realization state of the identity source id until
+// NSX reports it realized, failed or wait.Timeout expires. A failure is
+// returned as *RealizationFailedError with the alarms NSX raised, an expired
+// timeout as ErrRealizationTimeout. NSX Manager versions that do not track
+// the realization of identity sources answer 404, which counts as realized.
+func (c *Client) WaitRealized(ctx context.Context, id string, wait RealizationWait) error {
+	if wait.Timeout <= 0 {
+		return nil
+	}
+	interval := wait.Interval
+	if interval <= 0 {
+		interval = DefaultRealizationInterval
+	}
+
+	pollCtx, cancel := context.WithTimeout(ctx, wait.Timeout)
+	defer cancel()
+
+	intentPath := LDAPIdentitySourcePath(id)
+	state := RealizationUnknown
+	for {
+		status, err := c.GetRealizationStatus(pollCtx, intentPath)
+		switch {
+		case err == nil:
+			state = status.State()
+		case IsNotFound(err):
+			return nil
+		case pollCtx.Err() == nil:
+			return fmt.Errorf("failed to read realization status of %s: %w", id, err)
+		}
+
+		switch state {
+		case RealizationSuccess:
+			return nil
+		case RealizationError:
+			return &RealizationFailedError{ID: id, Messages: c.realizationAlarms(ctx, intentPath)}
+		}
+
+		select {
+		case <-pollCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("%w: %s still %s after %s", ErrRealizationTimeout, id, state, wait.Timeout)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// realizationAlarms returns the alarm messages of the entities realized for
+// intentPath. They only explain a failure, so errors reading them are ignored.
+func (c *Client) realizationAlarms(ctx context.Context, intentPath string) []string {
+	result, err := c.ListRealizedEntities(ctx, intentPath)
+	if err != nil {
+		return nil
+	}
+
+	var messages []string
+	for _, entity := range result.Results {
+		for _, alarm := range entity.Alarms {
+			if alarm.Message != "" {
+				messages = append(messages, alarm.Message)
+			}
+		}
+	}
+	return messages
+}
@@ -0,0 +1,367 @@
+package oidc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// token is a parsed compact JWS.
+type token struct {
+	header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	payload   []byte
+	signed    []byte // header.payload, as signed
+	signature []byte
+}
+
+// parse splits a compact JWS into its parts without verifying it.
+func parse(raw string) (*token, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("not a JWT")
+	}
+
+	t := &token{signed: []byte(parts[0] + "." + parts[1])}
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	if err := json.Unmarshal(header, &t.header); err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	if t.payload, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+	if t.signature, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	return t, nil
+}
+
+// IsJWT reports whether s has the shape of a compact JWT, so that bearer
+// tokens can be told from API keys before verifying them.
+func IsJWT(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(parts[0])
+	return err == nil && strings.HasPrefix(parts[0], "eyJ")
+}
+
+// Claims are the claims of a verified token.
+type Claims struct {
+	Issuer    string     `json:"iss"`
+	Subject   string     `json:"sub"`
+	Audience  audience   `json:"aud"`
+	ExpiresAt *time.Time `json:"-"`
+	NotBefore *time.Time `json:"-"`
+	IssuedAt  *time.Time `json:"-"`
+	// Username is preferred_username, as set by Keycloak
+	Username string `json:"preferred_username"`
+	Email    string `json:"email"`
+	// Raw holds every claim of the token
+	Raw map[string]any `json:"-"`
+}
+
+// String returns the claim name as a string: a string claim as it is, the
+// first element of a list of strings, or "" for other claims.
+func (c *Claims) String(name string) string {
+	switch v := c.Raw[name].(type) {
+	case string:
+		return v
+	case []any:
+		if len(v) > 0 {
+			if s, ok := v[0].(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// Principal returns the name a token identifies its bearer with in logs:
+// the preferred username, the email address or the subject.
+func (c *Claims) Principal() string {
+	switch {
+	case c.Username != "":
+		return c.Username
+	case c.Email != "":
+		return c.Email
+	default:
+		return c.Subject
+	}
+}
+
+// parseClaims decodes the payload of a token.
+func parseClaims(payload []byte) (*Claims, error) {
+	var c Claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(&c.Raw); err != nil {
+		return nil, fmt.Errorf("invalid claims: %w", err)
+	}
+	for name, dst := range map[string]**time.Time{"exp": &c.ExpiresAt, "nbf": &c.NotBefore, "iat": &c.IssuedAt} {
+		v, ok := c.Raw[name]
+		if !ok {
+			continue
+		}
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s claim", name)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s claim: %w", name, err)
+		}
+		t := time.Unix(int64(f), 0)
+		*dst = &t
+	}
+	return &c, nil
+}
+
+// audience is the aud claim: one string or a list of them.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return errors.New("invalid aud claim")
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// jwks is a JSON Web Key Set.
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwk is a public JSON Web Key.
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC and OKP
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+// publicKey is a signing key of the issuer.
+type publicKey struct {
+	key crypto.PublicKey
+	// algorithm the key is restricted to; empty allows any of its type
+	algorithm string
+}
+
+// publicKeys returns the signing keys of the set by key ID. Encryption keys
+// and keys of unsupported types are skipped.
+func (s jwks) publicKeys() (map[string]publicKey, error) {
+	keys := make(map[string]publicKey, len(s.Keys))
+	for _, k := range s.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.KeyID, err)
+		}
+		if key != nil {
+			keys[k.KeyID] = publicKey{key: key, algorithm: k.Algorithm}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+	return keys, nil
+}
+
+// publicKey decodes the key, or returns nil for an unsupported type.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, nil
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if _, err := key.ECDH(); err != nil {
+			return nil, errors.New("EC point not on the curve")
+		}
+		return key, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// verify checks signature over signed with alg. Only asymmetric algorithms
+// are accepted, and only with a key of their type.
+func (k publicKey) verify(alg string, signed, signature []byte) error {
+	if k.algorithm != "" && k.algorithm != alg {
+		return fmt.Errorf("algorithm %s does not match the key's %s", alg, k.algorithm)
+	}
+
+	switch key := k.key.(type) {
+	case *rsa.PublicKey:
+		hash, pss := rsaHash(alg)
+		if hash == 0 {
+			break
+		}
+		digest := sum(hash, signed)
+		if pss {
+			return rsa.VerifyPSS(key, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		hash, size := ecHash(alg, key.Curve)
+		if hash == 0 {
+			break
+		}
+		if len(signature) != 2*size {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, sum(hash, signed), r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			break
+		}
+		if !ed25519.Verify(key, signed, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+func rsaHash(alg string) (hash crypto.Hash, pss bool) {
+	switch alg {
+	case "RS256":
+		return crypto.SHA256, false
+	case "RS384":
+		return crypto.SHA384, false
+	case "RS512":
+		return crypto.SHA512, false
+	case "PS256":
+		return crypto.SHA256, true
+	case "PS384":
+		return crypto.SHA384, true
+	case "PS512":
+		return crypto.SHA512, true
+	}
+	return 0, false
+}
+
+// ecHash returns the hash of alg and the size of r and s on curve, or 0 if
+// alg does not match the curve.
+func ecHash(alg string, curve elliptic.Curve) (crypto.Hash, int) {
+	switch {
+	case alg == "ES256" && curve == elliptic.P256():
+		return crypto.SHA256, 32
+	case alg == "ES384" && curve == elliptic.P384():
+		return crypto.SHA384, 48
+	case alg == "ES512" && curve == elliptic.P521():
+		return crypto.SHA512, 66
+	}
+	return 0, 0
+}
+
+func sum(hash crypto.Hash, data []byte) []byte {
+	switch hash {
+	case crypto.SHA384:
+		s := sha512.Sum384(data)
+		return s[:]
+	case crypto.SHA512:
+		s := sha512.Sum512(data)
+		return s[:]
+	default:
+		s := sha256.Sum256(data)
+		return s[:]
+	}
+}
@@ -0,0 +1,246 @@
+// Package oidc verifies JWT bearer tokens issued by an OpenID Connect
+// provider such as Keycloak. The signing keys of the issuer are found by
+// discovery (/.well-known/openid-configuration) and fetched from its JWKS
+// endpoint when first needed, then again when a token is signed with an
+// unknown key.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of Config
+const (
+	DefaultLeeway  = time.Minute
+	DefaultTimeout = 10 * time.Second
+)
+
+// minRefresh is the least time between two fetches of the signing keys, so
+// that tokens with unknown key IDs cannot make the verifier hammer the
+// issuer.
+const minRefresh = time.Minute
+
+// keysTTL is how long fetched signing keys are used before they are fetched
+// again, to pick up rotations.
+const keysTTL = time.Hour
+
+// ErrInvalidToken wraps every reason a token is rejected for.
+var ErrInvalidToken = errors.New("invalid token")
+
+// Config configures a Verifier.
+type Config struct {
+	// Issuer is the issuer URL, as in the iss claim of its tokens
+	Issuer string
+	// Audience must be among the aud claim of a token. It is required: a
+	// realm issues tokens to all of its clients, and without it the
+	// verifier rejects every token
+	Audience string
+	// Leeway is the clock skew allowed for exp, nbf and iat; zero means
+	// DefaultLeeway
+	Leeway time.Duration
+	// Client fetches the discovery document and the keys; nil uses one
+	// with DefaultTimeout
+	Client *http.Client
+}
+
+// Verifier verifies the tokens of one issuer.
+type Verifier struct {
+	cfg Config
+	now func() time.Time
+
+	mu        sync.Mutex
+	jwksURI   string
+	keys      map[string]publicKey
+	fetchedAt time.Time
+}
+
+// NewVerifier returns a verifier for cfg. Nothing is fetched until the
+// first token is verified.
+func NewVerifier(cfg Config) *Verifier {
+	cfg.Issuer = strings.TrimRight(cfg.Issuer, "/")
+	if cfg.Leeway == 0 {
+		cfg.Leeway = DefaultLeeway
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &Verifier{cfg: cfg, now: time.Now}
+}
+
+// Issuer returns the issuer URL of the verifier.
+func (v *Verifier) Issuer() string {
+	return v.cfg.Issuer
+}
+
+// Verify checks the signature, issuer, audience and validity period of
+// token and returns its claims. Errors other than failures to fetch the
+// keys wrap ErrInvalidToken.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	parsed, err := parse(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	key, err := v.key(ctx, parsed.header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := key.verify(parsed.header.Algorithm, parsed.signed, parsed.signature); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	claims, err := parseClaims(parsed.payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if err := v.check(claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// check validates the registered claims of a token.
+func (v *Verifier) check(c *Claims) error {
+	if strings.TrimRight(c.Issuer, "/") != v.cfg.Issuer {
+		return fmt.Errorf("issuer %q is not %q", c.Issuer, v.cfg.Issuer)
+	}
+	if v.cfg.Audience == "" {
+		return errors.New("no audience configured")
+	}
+	if !c.Audience.contains(v.cfg.Audience) {
+		return fmt.Errorf("audience %v does not include %q", []string(c.Audience), v.cfg.Audience)
+	}
+
+	now := v.now()
+	if c.ExpiresAt == nil {
+		return errors.New("no exp claim")
+	}
+	if now.After(c.ExpiresAt.Add(v.cfg.Leeway)) {
+		return fmt.Errorf("expired at %s", c.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	if c.NotBefore != nil && now.Add(v.cfg.Leeway).Before(*c.NotBefore) {
+		return fmt.Errorf("not valid before %s", c.NotBefore.UTC().Format(time.RFC3339))
+	}
+	if c.IssuedAt != nil && now.Add(v.cfg.Leeway).Before(*c.IssuedAt) {
+		return fmt.Errorf("issued in the future at %s", c.IssuedAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// key returns the signing key with id kid, fetching the keys of the issuer
+// if they were never fetched, are older than keysTTL or lack kid.
+func (v *Verifier) key(ctx context.Context, kid string) (publicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	stale := v.keys == nil || v.now().Sub(v.fetchedAt) > keysTTL
+	if _, ok := v.lookup(kid); !ok && v.now().Sub(v.fetchedAt) > minRefresh {
+		stale = true
+	}
+	if stale {
+		if err := v.refresh(ctx); err != nil {
+			if v.keys == nil {
+				return publicKey{}, err
+			}
+			// The keys fetched before still verify tokens while the
+			// issuer is unreachable
+			slog.Warn("failed to refresh OIDC signing keys", "issuer", v.cfg.Issuer, "error", err)
+		}
+	}
+
+	key, ok := v.lookup(kid)
+	if !ok {
+		return publicKey{}, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+// lookup returns the key with id kid, or the only key if kid is empty.
+func (v *Verifier) lookup(kid string) (publicKey, bool) {
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+// refresh fetches the signing keys, discovering the JWKS URL first.
+func (v *Verifier) refresh(ctx context.Context) error {
+	v.fetchedAt = v.now()
+
+	if v.jwksURI == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := v.get(ctx, v.cfg.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return fmt.Errorf("OIDC discovery failed: %w", err)
+		}
+		if strings.TrimRight(discovery.Issuer, "/") != v.cfg.Issuer {
+			return fmt.Errorf("OIDC discovery failed: issuer %q is not %q", discovery.Issuer, v.cfg.Issuer)
+		}
+		if discovery.JWKSURI == "" {
+			return errors.New("OIDC discovery failed: no jwks_uri")
+		}
+		v.jwksURI = discovery.JWKSURI
+	}
+
+	var set jwks
+	if err := v.get(ctx, v.jwksURI, &set); err != nil {
+		return fmt.Errorf("failed to fetch OIDC signing keys: %w", err)
+	}
+	keys, err := set.publicKeys()
+	if err != nil {
+		return fmt.Errorf("failed to fetch OIDC signing keys: %w", err)
+	}
+	v.keys = keys
+	return nil
+}
+
+// get fetches the JSON document at url into dst.
+func (v *Verifier) get(ctx context.Context, url string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := v.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+		return fmt.Errorf("GET %s: %w", url, err)
+	}
+	return nil
+}
+
+// claimsKey is the context key of the claims of a request.
+type claimsKey struct{}
+
+// WithClaims returns ctx carrying the claims of the token a request was
+// authenticated with.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFrom returns the claims of ctx, if it has them.
+func ClaimsFrom(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok && claims != nil
+}
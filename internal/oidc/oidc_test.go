@@ -0,0 +1,203 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// issuer is a minimal OpenID Connect provider serving discovery and JWKS.
+type issuer struct {
+	*httptest.Server
+	rsaKey     *rsa.PrivateKey
+	ecKey      *ecdsa.PrivateKey
+	keyFetches atomic.Int32
+	// rotated adds the key "rsa-2" to the key set
+	rotated atomic.Bool
+	rsaKey2 *rsa.PrivateKey
+}
+
+func newIssuer(t *testing.T) *issuer {
+	t.Helper()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	rsaKey2, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	iss := &issuer{rsaKey: rsaKey, rsaKey2: rsaKey2, ecKey: ecKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/realms/ops/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   iss.URL + "/realms/ops",
+			"jwks_uri": iss.URL + "/realms/ops/certs",
+		})
+	})
+	mux.HandleFunc("/realms/ops/certs", func(w http.ResponseWriter, r *http.Request) {
+		iss.keyFetches.Add(1)
+		keys := []map[string]string{
+			rsaJWK("rsa-1", &rsaKey.PublicKey),
+			{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		}
+		if iss.rotated.Load() {
+			keys = append(keys, rsaJWK("rsa-2", &rsaKey2.PublicKey))
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "alg": "RS256", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sign returns a token with claims signed by the key kid with alg.
+func (iss *issuer) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch alg {
+	case "RS256":
+		key := iss.rsaKey
+		if kid == "rsa-2" {
+			key = iss.rsaKey2
+		}
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case "ES256":
+		r, s, _ := ecdsa.Sign(rand.Reader, iss.ecKey, digest[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + b64(sig)
+}
+
+func (iss *issuer) claims(overrides map[string]any) map[string]any {
+	now := time.Now()
+	claims := map[string]any{
+		"iss":                iss.URL + "/realms/ops",
+		"sub":                "f3a1c2e0",
+		"aud":                []string{"ldapmerge", "account"},
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"iat":                now.Unix(),
+		"preferred_username": "jdoe",
+		"tenant":             "team-a",
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(claims, k)
+			continue
+		}
+		claims[k] = v
+	}
+	return claims
+}
+
+func TestVerify(t *testing.T) {
+	iss := newIssuer(t)
+	v := NewVerifier(Config{Issuer: iss.URL + "/realms/ops/", Audience: "ldapmerge"})
+	ctx := context.Background()
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		kid := map[string]string{"RS256": "rsa-1", "ES256": "ec-1"}[alg]
+		claims, err := v.Verify(ctx, iss.sign(t, alg, kid, iss.claims(nil)))
+		if err != nil {
+			t.Fatalf("%s: Verify failed: %v", alg, err)
+		}
+		if claims.Principal() != "jdoe" || claims.String("tenant") != "team-a" || claims.Subject != "f3a1c2e0" {
+			t.Errorf("%s: unexpected claims %+v", alg, claims)
+		}
+	}
+	if n := iss.keyFetches.Load(); n != 1 {
+		t.Errorf("Expected the keys fetched once, got %d", n)
+	}
+
+	for name, token := range map[string]string{
+		"expired":         iss.sign(t, "RS256", "rsa-1", iss.claims(map[string]any{"exp": time.Now().Add(-2 * time.Minute).Unix()})),
+		"no exp":          iss.sign(t, "RS256", "rsa-1", iss.claims(map[string]any{"exp": nil})),
+		"not yet valid":   iss.sign(t, "RS256", "rsa-1", iss.claims(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()})),
+		"other issuer":    iss.sign(t, "RS256", "rsa-1", iss.claims(map[string]any{"iss": "https://evil.example.com"})),
+		"other audience":  iss.sign(t, "RS256", "rsa-1", iss.claims(map[string]any{"aud": "account"})),
+		"no audience":     iss.sign(t, "RS256", "rsa-1", iss.claims(map[string]any{"aud": nil})),
+		"wrong algorithm": iss.sign(t, "ES256", "rsa-1", iss.claims(nil)),
+		"tampered":        strings.Replace(iss.sign(t, "RS256", "rsa-1", iss.claims(nil)), ".", ".e30", 1),
+		"alg none":        b64([]byte(`{"alg":"none","kid":"rsa-1"}`)) + "." + b64([]byte(`{}`)) + ".",
+		"HS256":           b64([]byte(`{"alg":"HS256","kid":"rsa-1"}`)) + "." + b64([]byte(`{}`)) + "." + b64([]byte("mac")),
+		"not a JWT":       "admin-key-0123456789",
+	} {
+		if _, err := v.Verify(ctx, token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+	if n := iss.keyFetches.Load(); n != 1 {
+		t.Errorf("Expected no key fetch for known keys, got %d", n)
+	}
+
+	// A verifier without an audience accepts no token of the realm
+	unbound := NewVerifier(Config{Issuer: iss.URL + "/realms/ops"})
+	if _, err := unbound.Verify(ctx, iss.sign(t, "RS256", "rsa-1", iss.claims(nil))); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken without an audience, got %v", err)
+	}
+}
+
+func TestVerifyKeyRotation(t *testing.T) {
+	iss := newIssuer(t)
+	v := NewVerifier(Config{Issuer: iss.URL + "/realms/ops", Audience: "ldapmerge"})
+	ctx := context.Background()
+
+	if _, err := v.Verify(ctx, iss.sign(t, "RS256", "rsa-1", iss.claims(nil))); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	// An unknown key is looked up again at most once a minute
+	iss.rotated.Store(true)
+	token := iss.sign(t, "RS256", "rsa-2", iss.claims(nil))
+	if _, err := v.Verify(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected the new key to be unknown within a minute, got %v", err)
+	}
+	if n := iss.keyFetches.Load(); n != 1 {
+		t.Errorf("Expected 1 key fetch, got %d", n)
+	}
+
+	v.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := v.Verify(ctx, token); err != nil {
+		t.Errorf("Expected the rotated key to be fetched, got %v", err)
+	}
+	if n := iss.keyFetches.Load(); n != 2 {
+		t.Errorf("Expected 2 key fetches, got %d", n)
+	}
+}
+
+func TestIsJWT(t *testing.T) {
+	for s, want := range map[string]bool{
+		"eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiJ4In0.c2ln": true,
+		"admin-key-0123456789":                      false,
+		"team.a.key-0123456789":                     false,
+		"eyJ..":                                     false,
+	} {
+		if got := IsJWT(s); got != want {
+			t.Errorf("IsJWT(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
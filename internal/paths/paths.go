@@ -0,0 +1,168 @@
+// Package paths resolves the default locations of the database and the
+// logs in the per-user directories of the platform, and moves the files
+// left at the locations of earlier versions there.
+package paths
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// name is the directory of ldapmerge in the user directories.
+const name = "ldapmerge"
+
+// DatabaseFile is the file name of the default database.
+const DatabaseFile = "data.db"
+
+// DataDir returns the directory of the default database: ldapmerge in the
+// user configuration directory, that is $XDG_CONFIG_HOME or ~/.config on
+// Linux, %AppData% on Windows and ~/Library/Application Support on macOS.
+func DataDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// LogDir returns the directory of the default log file: ldapmerge/logs in
+// the user cache directory, that is $XDG_CACHE_HOME or ~/.cache on Linux,
+// %LocalAppData% on Windows and ~/Library/Caches on macOS.
+func LogDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name, "logs"), nil
+}
+
+// LegacyDataDir returns ~/.ldapmerge, the directory of the default database
+// of earlier versions.
+func LegacyDataDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".ldapmerge"), nil
+}
+
+// LegacyLogDir returns the directory of the executable, where earlier
+// versions wrote their logs by default.
+func LegacyLogDir() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(exe), nil
+}
+
+// DatabaseFiles are the patterns of the default database and its SQLite
+// write-ahead log and shared memory files.
+var DatabaseFiles = []string{DatabaseFile, DatabaseFile + "-wal", DatabaseFile + "-shm"}
+
+// LogFiles returns the patterns of the log file named file and its rotated
+// backups, such as ldapmerge-2025-01-15T10-30-00.000.log.gz.
+func LogFiles(file string) []string {
+	ext := filepath.Ext(file)
+	base := file[:len(file)-len(ext)]
+	return []string{file, base + "-*" + ext, base + "-*" + ext + ".gz"}
+}
+
+// Migrate moves the files of the directory from matching the glob patterns
+// to the directory to, creating it, and returns the paths they were moved
+// to. Nothing is moved if from is to, or if to already has a file matching
+// the first pattern: the files there are the current ones. Files are
+// renamed, or copied and removed across file systems.
+func Migrate(from, to string, patterns ...string) ([]string, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	if none, err := nothingToMove(from, to); err != nil || none {
+		return nil, err
+	}
+	if current, _ := filepath.Glob(filepath.Join(to, patterns[0])); len(current) > 0 {
+		return nil, nil
+	}
+
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(from, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(to, 0o700); err != nil {
+		return nil, err
+	}
+	moved := make([]string, 0, len(files))
+	for _, file := range files {
+		target := filepath.Join(to, filepath.Base(file))
+		if err := move(file, target); err != nil {
+			return moved, fmt.Errorf("failed to move %s to %s: %w", file, to, err)
+		}
+		moved = append(moved, target)
+	}
+	return moved, nil
+}
+
+// nothingToMove reports whether the directory from does not exist or is
+// the directory to.
+func nothingToMove(from, to string) (bool, error) {
+	fromInfo, err := os.Stat(from)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	toInfo, err := os.Stat(to)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(fromInfo, toInfo), nil
+}
+
+// move renames src to dst, copying it when they are on different file
+// systems.
+func move(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,101 @@
+package paths_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"ldapmerge/internal/paths"
+)
+
+func TestDirsXDG(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("XDG directories are used on Linux")
+	}
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	t.Setenv("XDG_CACHE_HOME", "/xdg/cache")
+
+	if dir, err := paths.DataDir(); err != nil || dir != "/xdg/config/ldapmerge" {
+		t.Errorf("DataDir() = %q, %v; want /xdg/config/ldapmerge", dir, err)
+	}
+	if dir, err := paths.LogDir(); err != nil || dir != "/xdg/cache/ldapmerge/logs" {
+		t.Errorf("LogDir() = %q, %v; want /xdg/cache/ldapmerge/logs", dir, err)
+	}
+}
+
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	legacy := filepath.Join(t.TempDir(), ".ldapmerge")
+	data := filepath.Join(t.TempDir(), "config", "ldapmerge")
+	writeFiles(t, legacy, "data.db", "data.db-wal", "data.db-shm", "other.txt")
+
+	moved, err := paths.Migrate(legacy, data, paths.DatabaseFiles...)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if len(moved) != 3 {
+		t.Fatalf("Expected the database and its WAL and SHM files to move, got %v", moved)
+	}
+	for _, name := range paths.DatabaseFiles {
+		content, err := os.ReadFile(filepath.Join(data, name))
+		if err != nil || string(content) != name {
+			t.Errorf("Expected %s moved, got %q, %v", name, content, err)
+		}
+		if _, err := os.Stat(filepath.Join(legacy, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s removed from the legacy directory, got %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(legacy, "other.txt")); err != nil {
+		t.Errorf("Expected other files to stay: %v", err)
+	}
+
+	// A database at the new location is the current one
+	writeFiles(t, legacy, "data.db")
+	if moved, err := paths.Migrate(legacy, data, paths.DatabaseFiles...); err != nil || len(moved) != 0 {
+		t.Errorf("Expected nothing moved over the current database, got %v, %v", moved, err)
+	}
+
+	// Nor from a directory that does not exist or into itself
+	if moved, err := paths.Migrate(filepath.Join(legacy, "missing"), data, paths.DatabaseFiles...); err != nil || len(moved) != 0 {
+		t.Errorf("Expected nothing moved from a missing directory, got %v, %v", moved, err)
+	}
+	if moved, err := paths.Migrate(data, data, "*"); err != nil || len(moved) != 0 {
+		t.Errorf("Expected nothing moved into the same directory, got %v, %v", moved, err)
+	}
+}
+
+func TestMigrateLogs(t *testing.T) {
+	exe := t.TempDir()
+	logs := filepath.Join(t.TempDir(), "logs")
+	writeFiles(t, exe, "ldapmerge", "ldapmerge.log", "ldapmerge-2025-01-15T10-30-00.000.log", "ldapmerge-2025-01-14T10-30-00.000.log.gz")
+
+	moved, err := paths.Migrate(exe, logs, paths.LogFiles("ldapmerge.log")...)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	var names []string
+	for _, file := range moved {
+		names = append(names, filepath.Base(file))
+	}
+	slices.Sort(names)
+	want := []string{"ldapmerge-2025-01-14T10-30-00.000.log.gz", "ldapmerge-2025-01-15T10-30-00.000.log", "ldapmerge.log"}
+	if !slices.Equal(names, want) {
+		t.Errorf("Expected the log and its backups to move, got %v", names)
+	}
+	if _, err := os.Stat(filepath.Join(exe, "ldapmerge")); err != nil {
+		t.Errorf("Expected the executable to stay: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+// Package prober periodically probes the LDAP servers of every saved NSX
+// configuration and records the results in the server inventory.
+package prober
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx"
+	"ldapmerge/internal/repository"
+)
+
+// Options configures the prober.
+type Options struct {
+	// Interval between probe rounds
+	Interval time.Duration
+	// Timeout for each NSX request
+	Timeout time.Duration
+	// Retention is how long probe history is kept; zero keeps it forever
+	Retention time.Duration
+	// Diagnostics configures the request ids and slow-call logging of the
+	// NSX clients
+	Diagnostics nsx.Diagnostics
+}
+
+// DefaultOptions returns the default prober options.
+func DefaultOptions() Options {
+	return Options{
+		Interval:  5 * time.Minute,
+		Timeout:   30 * time.Second,
+		Retention: 30 * 24 * time.Hour,
+	}
+}
+
+// Status is the scheduler state of a prober.
+type Status struct {
+	Interval  time.Duration
+	Retention time.Duration
+	// Paused rounds are skipped until the prober is resumed
+	Paused       bool
+	LastRunAt    time.Time
+	LastDuration time.Duration
+	NextRunAt    time.Time
+	// LastErrors are the failures of the last round, one per NSX configuration
+	LastErrors []string
+	Configs    int
+	Servers    int
+	Rounds     int
+}
+
+// Prober probes the identity sources of saved NSX configurations.
+type Prober struct {
+	repo *repository.Repository
+	opts Options
+	log  *slog.Logger
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New creates a prober writing to repo.
+func New(repo *repository.Repository, opts Options) *Prober {
+	return &Prober{
+		repo:   repo,
+		opts:   opts,
+		log:    slog.With("component", "prober"),
+		status: Status{Interval: opts.Interval, Retention: opts.Retention},
+	}
+}
+
+// Status returns the prober's current scheduler state.
+func (p *Prober) Status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := p.status
+	status.LastErrors = append([]string(nil), p.status.LastErrors...)
+	return status
+}
+
+// SetPaused pauses or resumes the scheduled rounds of Run. A round in
+// progress is completed.
+func (p *Prober) SetPaused(paused bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.status.Paused != paused {
+		p.log.Info("scheduled probes paused", "paused", paused)
+	}
+	p.status.Paused = paused
+}
+
+// SetRetention changes how long probe history is kept from the next round
+// on; zero keeps it forever.
+func (p *Prober) SetRetention(retention time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.Retention = retention
+}
+
+// Run probes immediately and then every Interval until ctx is canceled,
+// skipping rounds while paused.
+func (p *Prober) Run(ctx context.Context) {
+	p.log.Info("scheduled probes started", "interval", p.opts.Interval)
+
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if !p.Status().Paused {
+			p.RunOnce(ctx)
+		}
+
+		p.mu.Lock()
+		p.status.NextRunAt = time.Now().Add(p.opts.Interval)
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			p.log.Info("scheduled probes stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce runs a single probe round over all saved NSX configurations.
+// Failures are logged; one unreachable NSX Manager does not stop the round.
+func (p *Prober) RunOnce(ctx context.Context) {
+	start := time.Now()
+
+	var errs []string
+	configs, err := p.repo.ListConfigs(ctx)
+	if err != nil {
+		p.log.Error("failed to list NSX configurations", "error", err)
+		errs = append(errs, fmt.Sprintf("failed to list NSX configurations: %v", err))
+	}
+
+	probed := 0
+	for _, c := range configs {
+		// ListConfigs omits passwords
+		config, err := p.repo.GetConfig(ctx, c.ID)
+		if err != nil {
+			p.log.Error("failed to load NSX configuration", "config_id", c.ID, "error", err)
+			errs = append(errs, fmt.Sprintf("%s: %v", c.Name, err))
+			continue
+		}
+
+		n, err := p.probeConfig(ctx, config)
+		if err != nil {
+			p.log.Warn("probe round failed", "config_id", config.ID, "nsx_host", config.Host, "error", err)
+			errs = append(errs, fmt.Sprintf("%s (%s): %v", config.Name, config.Host, err))
+		}
+		probed += n
+	}
+
+	p.mu.Lock()
+	p.status.LastRunAt = start
+	p.status.LastDuration = time.Since(start)
+	p.status.LastErrors = errs
+	p.status.Configs = len(configs)
+	p.status.Servers = probed
+	p.status.Rounds++
+	retention := p.status.Retention
+	p.mu.Unlock()
+
+	if retention > 0 {
+		pruned, err := p.repo.PruneProbes(ctx, time.Now().Add(-retention))
+		if err != nil {
+			p.log.Error("failed to prune probe history", "error", err)
+		} else if pruned > 0 {
+			p.log.Debug("probe history pruned", "deleted", pruned)
+		}
+	}
+
+	p.log.Info("probe round completed", "configs_count", len(configs), "servers_count", probed, "duration", time.Since(start))
+}
+
+// probeConfig pulls the identity sources of one NSX Manager into the
+// inventory and probes each of them. It returns the number of probed servers.
+func (p *Prober) probeConfig(ctx context.Context, config *models.NSXConfig) (int, error) {
+	log := p.log.With("config_id", config.ID, "nsx_host", config.Host)
+
+	client := nsx.NewClient(nsx.ClientConfig{
+		Host:        config.Host,
+		Username:    config.Username,
+		Password:    config.Password,
+		Insecure:    config.Insecure,
+		Timeout:     p.opts.Timeout,
+		Diagnostics: p.opts.Diagnostics,
+	})
+
+	sources, err := client.ListLDAPIdentitySources(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list identity sources: %w", err)
+	}
+
+	if _, err := p.repo.UpdateInventory(ctx, config.Host, nsx.LDAPIdentitySourcesToDomains(sources.Results)); err != nil {
+		return 0, fmt.Errorf("failed to update inventory: %w", err)
+	}
+
+	probed := 0
+	for _, source := range sources.Results {
+		result, err := client.ProbeConfiguredSource(ctx, source.ID)
+		if err != nil {
+			log.Warn("probe failed", "source_id", source.ID, "error", err)
+			continue
+		}
+
+		for _, item := range result.Results {
+			if !item.Success {
+				log.Warn("LDAP server unreachable", "source_id", source.ID, "url", item.LDAPServerURL, "error", item.ErrorMessage)
+			}
+			if err := p.repo.RecordProbe(ctx, config.Host, item.LDAPServerURL, item.Success, item.ErrorMessage); err != nil {
+				return probed, fmt.Errorf("failed to record probe of %s: %w", item.LDAPServerURL, err)
+			}
+			probed++
+		}
+	}
+
+	return probed, nil
+}
@@ -0,0 +1,115 @@
+package prober
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/nsx/mock"
+	"ldapmerge/internal/repository"
+)
+
+func TestRunOnce(t *testing.T) {
+	ctx := context.Background()
+
+	mockServer := mock.NewServer()
+	mockServer.SetProbeResult("ldaps://ad-02.example.lab:636", false, "connection refused")
+	ts := httptest.NewServer(mockServer)
+	defer ts.Close()
+
+	repo, err := repository.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	if _, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "mock", Host: ts.URL, Username: "admin", Password: "secret"}); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	p := New(repo, DefaultOptions())
+	p.RunOnce(ctx)
+	p.RunOnce(ctx)
+
+	servers, err := repo.ListServers(ctx)
+	if err != nil {
+		t.Fatalf("ListServers failed: %v", err)
+	}
+	if len(servers) != 3 {
+		t.Fatalf("Expected 3 servers in inventory, got %d", len(servers))
+	}
+
+	byURL := make(map[string]models.InventoryServer)
+	for _, s := range servers {
+		byURL[s.URL] = s
+	}
+
+	healthy := byURL["ldaps://ad-01.example.lab:636"]
+	if healthy.ProbeCount != 2 || healthy.ConsecutiveFailures != 0 {
+		t.Errorf("Expected 2 successful probes for ad-01, got %+v", healthy)
+	}
+	if healthy.Uptime == nil || *healthy.Uptime != 100 {
+		t.Errorf("Expected 100%% uptime for ad-01, got %v", healthy.Uptime)
+	}
+
+	failing := byURL["ldaps://ad-02.example.lab:636"]
+	if failing.ConsecutiveFailures != 2 || failing.LastFailureAt == nil {
+		t.Errorf("Expected 2 consecutive failures for ad-02, got %+v", failing)
+	}
+
+	mockServer.ResetOutcomes()
+	p.RunOnce(ctx)
+
+	recovered, err := repo.GetServer(ctx, failing.ID)
+	if err != nil {
+		t.Fatalf("GetServer failed: %v", err)
+	}
+	if recovered.ConsecutiveFailures != 0 {
+		t.Errorf("Expected failure count reset after a successful probe, got %d", recovered.ConsecutiveFailures)
+	}
+	if recovered.Uptime == nil || *recovered.Uptime < 33 || *recovered.Uptime > 34 {
+		t.Errorf("Expected ~33%% uptime for ad-02, got %v", recovered.Uptime)
+	}
+
+	probes, err := repo.ListProbes(ctx, failing.ID, 10)
+	if err != nil {
+		t.Fatalf("ListProbes failed: %v", err)
+	}
+	if len(probes) != 3 || !probes[0].Success || probes[2].Error != "connection refused" {
+		t.Errorf("Expected newest-first probe history, got %+v", probes)
+	}
+}
+
+func TestRunPaused(t *testing.T) {
+	repo, err := repository.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	opts := DefaultOptions()
+	opts.Interval = 10 * time.Millisecond
+	p := New(repo, opts)
+	p.SetPaused(true)
+	p.SetRetention(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p.Run(ctx)
+
+	status := p.Status()
+	if !status.Paused || status.Rounds != 0 || status.Retention != time.Hour {
+		t.Errorf("Expected no rounds while paused, got %+v", status)
+	}
+
+	p.SetPaused(false)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p.Run(ctx)
+	if status := p.Status(); status.Rounds == 0 {
+		t.Errorf("Expected rounds once resumed, got %+v", status)
+	}
+}
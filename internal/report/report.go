@@ -0,0 +1,204 @@
+// Package report builds reports of planned and current NSX configuration
+// for change management and audits, rendered as JSON, Markdown or HTML.
+package report
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ldapmerge/internal/diff"
+	"ldapmerge/internal/models"
+)
+
+// DefaultExpiryWarning is how close to expiry a certificate is reported as
+// expiring.
+const DefaultExpiryWarning = 30 * 24 * time.Hour
+
+// Format is a report format.
+type Format string
+
+// Report formats
+const (
+	FormatJSON     Format = "json"
+	FormatMarkdown Format = "markdown"
+	FormatHTML     Format = "html"
+)
+
+// FormatOf returns the report format of a file name: .json, .md or .html.
+func FormatOf(name string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".md", ".markdown":
+		return FormatMarkdown, nil
+	case ".html", ".htm":
+		return FormatHTML, nil
+	}
+	return "", fmt.Errorf("unknown report format of %s (want .json, .md or .html)", name)
+}
+
+// Certificate states
+const (
+	CertificateOK       = "ok"
+	CertificateExpiring = "expiring"
+	CertificateExpired  = "expired"
+	CertificateInvalid  = "invalid" // not a parseable PEM certificate
+)
+
+// Certificate describes a certificate of an LDAP server.
+type Certificate struct {
+	Domain      string     `json:"domain"`
+	URL         string     `json:"url"`
+	Fingerprint string     `json:"fingerprint"`
+	Subject     string     `json:"subject,omitempty"`
+	Issuer      string     `json:"issuer,omitempty"`
+	NotAfter    *time.Time `json:"not_after,omitempty"`
+	DaysLeft    int        `json:"days_left"`
+	Status      string     `json:"status"`
+	Added       bool       `json:"added,omitempty"` // added by the change
+
+	KeyAlgorithm       string `json:"key_algorithm,omitempty"`
+	KeySize            int    `json:"key_size,omitempty"` // bits
+	SignatureAlgorithm string `json:"signature_algorithm,omitempty"`
+}
+
+// Probe is the outcome of probing an LDAP server with NSX.
+type Probe struct {
+	Domain  string `json:"domain"`
+	URL     string `json:"url"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Change is the report of a planned push: what changes against NSX, the
+// certificates pushed and, if probed, whether NSX can reach the servers
+// with them.
+type Change struct {
+	GeneratedAt  time.Time         `json:"generated_at"`
+	NSXHost      string            `json:"nsx_host"`
+	RunID        string            `json:"run_id,omitempty"`
+	Strategy     string            `json:"strategy"`
+	DryRun       bool              `json:"dry_run"`
+	Stats        models.MergeStats `json:"stats"`
+	Diff         *diff.ResultDiff  `json:"diff"`
+	Certificates []Certificate     `json:"certificates"`
+	Probes       []Probe           `json:"probes,omitempty"`
+	// Disabled are the servers disabled before the push
+	Disabled []models.DisabledServer `json:"disabled,omitempty"`
+}
+
+// NewChange returns the report of pushing merged over current, as of now.
+func NewChange(current, merged []models.Domain, stats models.MergeStats, now time.Time) *Change {
+	changes := diff.Compare(current, merged)
+
+	added := make(map[string]bool)
+	for _, domain := range changes.ChangedDomains {
+		for _, server := range domain.ChangedServers {
+			for _, fp := range server.AddedCertificates {
+				added[server.URL+" "+fp] = true
+			}
+		}
+	}
+	addedDomains := make(map[string]bool)
+	for _, id := range changes.AddedDomains {
+		addedDomains[id] = true
+	}
+
+	certs := Certificates(merged, now, DefaultExpiryWarning)
+	for i, c := range certs {
+		certs[i].Added = addedDomains[c.Domain] || added[c.URL+" "+c.Fingerprint]
+	}
+
+	return &Change{
+		GeneratedAt:  now.UTC(),
+		Stats:        stats,
+		Diff:         changes,
+		Certificates: certs,
+	}
+}
+
+// Certificates describes every certificate of the servers of domains as of
+// now; those expiring within warn are reported as expiring.
+func Certificates(domains []models.Domain, now time.Time, warn time.Duration) []Certificate {
+	certs := []Certificate{}
+	for _, domain := range domains {
+		for _, server := range domain.LDAPServers {
+			for _, pemCert := range server.Certificates {
+				certs = append(certs, describe(domain.ID, server.URL, pemCert, now, warn))
+			}
+		}
+	}
+	return certs
+}
+
+func describe(domain, url, pemCert string, now time.Time, warn time.Duration) Certificate {
+	c := Certificate{Domain: domain, URL: url, Fingerprint: diff.Fingerprint(pemCert), Status: CertificateInvalid}
+
+	block, _ := pem.Decode([]byte(strings.TrimSpace(pemCert)))
+	if block == nil {
+		return c
+	}
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return c
+	}
+
+	notAfter := parsed.NotAfter.UTC()
+	c.Subject = parsed.Subject.String()
+	c.Issuer = parsed.Issuer.String()
+	c.NotAfter = &notAfter
+	c.DaysLeft = int(notAfter.Sub(now).Hours() / 24)
+	c.KeyAlgorithm = parsed.PublicKeyAlgorithm.String()
+	c.KeySize = keySize(parsed.PublicKey)
+	c.SignatureAlgorithm = parsed.SignatureAlgorithm.String()
+	switch {
+	case !now.Before(notAfter):
+		c.Status = CertificateExpired
+	case notAfter.Sub(now) < warn:
+		c.Status = CertificateExpiring
+	default:
+		c.Status = CertificateOK
+	}
+	return c
+}
+
+// keySize returns the size in bits of a public key, or 0 if unknown.
+func keySize(pub any) int {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256
+	}
+	return 0
+}
+
+// Write renders the report in format.
+func (r *Change) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, r)
+	case FormatMarkdown:
+		return changeMarkdown.Execute(w, r)
+	case FormatHTML:
+		return changeHTML.Execute(w, r)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(v)
+}
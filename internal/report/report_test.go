@@ -0,0 +1,138 @@
+package report_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/report"
+)
+
+// certificate returns a self-signed PEM certificate for cn valid until notAfter.
+func certificate(t *testing.T, cn string, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestChange(t *testing.T) {
+	now := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	oldCert := certificate(t, "ad-01.example.lab", now.Add(10*24*time.Hour))
+	newCert := certificate(t, "ad-01.example.lab", now.Add(400*24*time.Hour))
+
+	current := []models.Domain{{ID: "example.lab", LDAPServers: []models.LDAPServer{
+		{URL: "ldaps://ad-01.example.lab:636", Certificates: []string{oldCert}},
+	}}}
+	merged := []models.Domain{{ID: "example.lab", LDAPServers: []models.LDAPServer{
+		{URL: "ldaps://ad-01.example.lab:636", Certificates: []string{oldCert, newCert, "not a certificate"}},
+	}}}
+
+	r := report.NewChange(current, merged, models.MergeStats{Domains: 1, Servers: 1, ResultCertificates: 3}, now)
+	r.NSXHost = "https://nsx.example.com"
+	r.RunID = "20250115T103000Z-3f9a2c1b"
+	r.Probes = []report.Probe{{Domain: "example.lab", URL: "ldaps://ad-01.example.lab:636", Error: "Connection refused"}}
+	r.Disabled = []models.DisabledServer{{Domain: "example.lab", URL: "ldaps://ad-01.example.lab:636", Reason: "failed the last 3 probes", Kept: true}}
+
+	if r.Diff.Empty() || len(r.Certificates) != 3 {
+		t.Fatalf("Expected a diff and 3 certificates, got %+v", r)
+	}
+	for i, want := range []struct {
+		status string
+		added  bool
+	}{{report.CertificateExpiring, false}, {report.CertificateOK, true}, {report.CertificateInvalid, true}} {
+		if got := r.Certificates[i]; got.Status != want.status || got.Added != want.added {
+			t.Errorf("Certificate %d: expected %s (added %v), got %s (added %v)", i, want.status, want.added, got.Status, got.Added)
+		}
+	}
+	if r.Certificates[0].DaysLeft != 10 || r.Certificates[0].Subject != "CN=ad-01.example.lab" {
+		t.Errorf("Unexpected certificate %+v", r.Certificates[0])
+	}
+
+	for _, format := range []report.Format{report.FormatJSON, report.FormatMarkdown, report.FormatHTML} {
+		var buf bytes.Buffer
+		if err := r.Write(&buf, format); err != nil {
+			t.Fatalf("%s: Write failed: %v", format, err)
+		}
+		out := buf.String()
+		for _, want := range []string{"nsx.example.com", "ldaps://ad-01.example.lab:636", "Connection refused", "failed the last 3 probes", r.RunID, r.Certificates[1].Fingerprint[:16]} {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s: expected %q in report", format, want)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	_ = r.Write(&buf, report.FormatJSON)
+	var decoded report.Change
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded.Certificates) != 3 {
+		t.Errorf("Expected the JSON report to decode, got %v", err)
+	}
+}
+
+func TestSecurity(t *testing.T) {
+	now := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	domains := []models.Domain{
+		{ID: "example.lab", DomainName: "example.lab", LDAPServers: []models.LDAPServer{
+			{URL: "ldaps://ad-01.example.lab:636", Enabled: "true", Certificates: []string{
+				certificate(t, "ad-01.example.lab", now.Add(10*24*time.Hour)),
+				certificate(t, "ca.example.lab", now.Add(-24*time.Hour)),
+			}},
+			{URL: "ldap://ad-02.example.lab:389", StartTLS: "true", Enabled: "false"},
+		}},
+		{ID: "example.org", DomainName: "example.org", LDAPServers: []models.LDAPServer{
+			{URL: "ldap://dc01.example.org:389", StartTLS: "false", Enabled: "true"},
+		}},
+	}
+
+	r := report.NewSecurity(domains, "nsx.example.com", now)
+	if r.Servers != 3 || r.LDAPS != 1 || r.StartTLS != 1 || r.Plaintext != 1 || r.Certificates != 2 {
+		t.Errorf("Unexpected totals %+v", r)
+	}
+	if len(r.WithoutCertificates) != 1 || r.WithoutCertificates[0].URL != "ldap://ad-02.example.lab:389" || r.WithoutCertificates[0].Enabled {
+		t.Errorf("Expected only the disabled StartTLS server without certificates, got %+v", r.WithoutCertificates)
+	}
+	if r.Expiry != (report.Expiry{Expired: 1, Within30Days: 1}) {
+		t.Errorf("Unexpected expiry %+v", r.Expiry)
+	}
+	if len(r.KeyTypes) != 1 || r.KeyTypes[0] != (report.Count{Name: "ECDSA 256", Count: 2}) {
+		t.Errorf("Unexpected key types %+v", r.KeyTypes)
+	}
+	if len(r.SignatureAlgorithms) != 1 || r.SignatureAlgorithms[0].Name != "ECDSA-SHA256" {
+		t.Errorf("Unexpected signature algorithms %+v", r.SignatureAlgorithms)
+	}
+
+	for _, format := range []report.Format{report.FormatJSON, report.FormatMarkdown, report.FormatHTML} {
+		var buf bytes.Buffer
+		if err := r.Write(&buf, format); err != nil {
+			t.Fatalf("%s: Write failed: %v", format, err)
+		}
+		for _, want := range []string{"nsx.example.com", "ldap://dc01.example.org:389", "ECDSA-SHA256"} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%s: expected %q in report", format, want)
+			}
+		}
+	}
+}
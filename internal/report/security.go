@@ -0,0 +1,194 @@
+package report
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"ldapmerge/internal/models"
+)
+
+// Transports of LDAP servers
+const (
+	TransportLDAPS     = "ldaps"
+	TransportStartTLS  = "starttls"
+	TransportPlaintext = "plaintext"
+)
+
+// Transport returns how a client talks to server: LDAPS, StartTLS or
+// plaintext LDAP.
+func Transport(server models.LDAPServer) string {
+	switch {
+	case strings.HasPrefix(strings.ToLower(server.URL), "ldaps://"):
+		return TransportLDAPS
+	case strings.EqualFold(server.StartTLS, "true"):
+		return TransportStartTLS
+	}
+	return TransportPlaintext
+}
+
+// SecurityServer is an LDAP server in a security report.
+type SecurityServer struct {
+	Domain       string        `json:"domain"`
+	URL          string        `json:"url"`
+	Transport    string        `json:"transport"`
+	Enabled      bool          `json:"enabled"`
+	Certificates []Certificate `json:"certificates"`
+}
+
+// SecurityDomain is an identity source in a security report.
+type SecurityDomain struct {
+	ID         string           `json:"id"`
+	DomainName string           `json:"domain_name"`
+	LDAPS      int              `json:"ldaps"`
+	StartTLS   int              `json:"starttls"`
+	Plaintext  int              `json:"plaintext"`
+	Servers    []SecurityServer `json:"servers"`
+}
+
+// Count is the number of certificates with a property, such as a key type.
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Expiry counts certificates by how soon they expire.
+type Expiry struct {
+	Expired       int `json:"expired"`
+	Within30Days  int `json:"within_30_days"`
+	Within90Days  int `json:"within_90_days"`
+	Within365Days int `json:"within_365_days"`
+	Later         int `json:"later"`
+	Invalid       int `json:"invalid"` // not parseable
+}
+
+// Security is the security posture of LDAP identity sources for auditors:
+// the transport of every server, the keys, signatures and expiry of their
+// certificates and the servers without any.
+type Security struct {
+	GeneratedAt time.Time        `json:"generated_at"`
+	Source      string           `json:"source"` // where the configuration comes from
+	Domains     []SecurityDomain `json:"domains"`
+
+	Servers             int              `json:"servers"`
+	LDAPS               int              `json:"ldaps"`
+	StartTLS            int              `json:"starttls"`
+	Plaintext           int              `json:"plaintext"`
+	Certificates        int              `json:"certificates"`
+	KeyTypes            []Count          `json:"key_types"`
+	SignatureAlgorithms []Count          `json:"signature_algorithms"`
+	Expiry              Expiry           `json:"expiry"`
+	WithoutCertificates []SecurityServer `json:"without_certificates"` // servers using TLS without certificates
+}
+
+// NewSecurity returns the security report of domains as of now.
+func NewSecurity(domains []models.Domain, source string, now time.Time) *Security {
+	r := &Security{
+		GeneratedAt:         now.UTC(),
+		Source:              source,
+		Domains:             []SecurityDomain{},
+		WithoutCertificates: []SecurityServer{},
+	}
+	keyTypes := make(map[string]int)
+	signatures := make(map[string]int)
+
+	for _, domain := range domains {
+		d := SecurityDomain{ID: domain.ID, DomainName: domain.DomainName, Servers: []SecurityServer{}}
+		for _, server := range domain.LDAPServers {
+			s := SecurityServer{
+				Domain:       domain.ID,
+				URL:          server.URL,
+				Transport:    Transport(server),
+				Enabled:      !strings.EqualFold(server.Enabled, "false"),
+				Certificates: []Certificate{},
+			}
+			for _, pemCert := range server.Certificates {
+				c := describe(domain.ID, server.URL, pemCert, now, DefaultExpiryWarning)
+				s.Certificates = append(s.Certificates, c)
+				r.Expiry.add(c, now)
+				if c.Status != CertificateInvalid {
+					keyTypes[keyType(c)]++
+					signatures[c.SignatureAlgorithm]++
+				}
+			}
+
+			switch s.Transport {
+			case TransportLDAPS:
+				d.LDAPS++
+			case TransportStartTLS:
+				d.StartTLS++
+			default:
+				d.Plaintext++
+			}
+			if s.Transport != TransportPlaintext && len(s.Certificates) == 0 {
+				r.WithoutCertificates = append(r.WithoutCertificates, s)
+			}
+			r.Certificates += len(s.Certificates)
+			d.Servers = append(d.Servers, s)
+		}
+		r.Servers += len(d.Servers)
+		r.LDAPS += d.LDAPS
+		r.StartTLS += d.StartTLS
+		r.Plaintext += d.Plaintext
+		r.Domains = append(r.Domains, d)
+	}
+
+	r.KeyTypes = counts(keyTypes)
+	r.SignatureAlgorithms = counts(signatures)
+	return r
+}
+
+func (e *Expiry) add(c Certificate, now time.Time) {
+	if c.NotAfter == nil {
+		e.Invalid++
+		return
+	}
+	switch left := c.NotAfter.Sub(now); {
+	case left <= 0:
+		e.Expired++
+	case left < 30*24*time.Hour:
+		e.Within30Days++
+	case left < 90*24*time.Hour:
+		e.Within90Days++
+	case left < 365*24*time.Hour:
+		e.Within365Days++
+	default:
+		e.Later++
+	}
+}
+
+// keyType names the key of a certificate with its size, such as RSA 2048.
+func keyType(c Certificate) string {
+	if c.KeySize == 0 {
+		return c.KeyAlgorithm
+	}
+	return fmt.Sprintf("%s %d", c.KeyAlgorithm, c.KeySize)
+}
+
+// counts returns the counts of m, most frequent first.
+func counts(m map[string]int) []Count {
+	out := make([]Count, 0, len(m))
+	for name, n := range m {
+		out = append(out, Count{Name: name, Count: n})
+	}
+	slices.SortFunc(out, func(a, b Count) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+	})
+	return out
+}
+
+// Write renders the report in format.
+func (r *Security) Write(w io.Writer, format Format) error {
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, r)
+	case FormatMarkdown:
+		return securityMarkdown.Execute(w, r)
+	case FormatHTML:
+		return securityHTML.Execute(w, r)
+	}
+	return fmt.Errorf("unknown report format %q", format)
+}
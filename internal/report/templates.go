@@ -0,0 +1,64 @@
+package report
+
+import (
+	_ "embed"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed report.css
+var style string
+
+//go:embed change.html
+var changeHTMLSource string
+
+//go:embed change.md
+var changeMarkdownSource string
+
+//go:embed security.html
+var securityHTMLSource string
+
+//go:embed security.md
+var securityMarkdownSource string
+
+// funcs are the template functions shared by the report templates
+var funcs = map[string]any{
+	"style": func() htmltemplate.CSS {
+		return htmltemplate.CSS(style)
+	},
+	"datetime": func(t time.Time) string {
+		if t.IsZero() {
+			return "—"
+		}
+		return t.UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"date": func(t *time.Time) string {
+		if t == nil {
+			return "—"
+		}
+		return t.Format(time.DateOnly)
+	},
+	"short": func(fingerprint string) string {
+		if len(fingerprint) > 16 {
+			return fingerprint[:16]
+		}
+		return fingerprint
+	},
+	"percent": func(f float64) int {
+		return int(f*100 + 0.5)
+	},
+	// cell escapes a Markdown table cell
+	"cell": func(s string) string {
+		return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+	},
+}
+
+var (
+	changeHTML     = htmltemplate.Must(htmltemplate.New("change").Funcs(funcs).Parse(changeHTMLSource))
+	changeMarkdown = template.Must(template.New("change").Funcs(funcs).Parse(changeMarkdownSource))
+
+	securityHTML     = htmltemplate.Must(htmltemplate.New("security").Funcs(funcs).Parse(securityHTMLSource))
+	securityMarkdown = template.Must(template.New("security").Funcs(funcs).Parse(securityMarkdownSource))
+)
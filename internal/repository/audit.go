@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"ldapmerge/internal/models"
+)
+
+// AddAuditEvent appends an event to the audit log and sets its ID and
+// creation time.
+func (r *Repository) AddAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	sourceIDs := event.SourceIDs
+	if sourceIDs == nil {
+		sourceIDs = []string{}
+	}
+	sources, err := json.Marshal(sourceIDs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal source IDs: %w", err)
+	}
+
+	var protected sql.NullString
+	if len(event.Protected) > 0 {
+		data, err := json.Marshal(event.Protected)
+		if err != nil {
+			return fmt.Errorf("failed to marshal protected source IDs: %w", err)
+		}
+		protected = sql.NullString{String: string(data), Valid: true}
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	err = r.statements().insertAudit.QueryRowContext(ctx,
+		formatTimestamp(now), event.Operation, event.Origin, nullString(event.Actor), event.NSXHost,
+		string(sources), protected, event.Reason, event.Outcome, nullString(event.Error), nullString(event.RunID),
+		nullString(event.ClientCert), nullString(event.Method), nullString(event.Path), nullInt(event.Status),
+		nullString(event.BodySHA256), nullString(event.SourceIP),
+	).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit event: %w", err)
+	}
+
+	event.CreatedAt = now
+	event.SourceIDs = sourceIDs
+	return nil
+}
+
+// DefaultAuditLimit is the number of events ListAuditEvents returns when
+// AuditFilter.Limit is not set.
+const DefaultAuditLimit = 100
+
+// AuditFilter selects audit events. Empty fields match every event.
+type AuditFilter struct {
+	Actor      string
+	SourceIP   string
+	Operation  string
+	BodySHA256 string
+	Since      time.Time // events at or after
+	Until      time.Time // events at or before
+	Limit      int       // at most; less than 1 means DefaultAuditLimit
+}
+
+// args returns the arguments of auditFilter and the limit.
+func (f AuditFilter) args() []any {
+	var args []any
+	for _, v := range []string{f.Actor, f.SourceIP, f.Operation, f.BodySHA256} {
+		arg := nullString(v)
+		args = append(args, arg, arg)
+	}
+	for _, t := range []time.Time{f.Since, f.Until} {
+		var arg sql.NullString
+		if !t.IsZero() {
+			arg = sql.NullString{String: formatTimestamp(t), Valid: true}
+		}
+		args = append(args, arg, arg)
+	}
+	return append(args, f.limit())
+}
+
+func (f AuditFilter) limit() int {
+	if f.Limit < 1 {
+		return DefaultAuditLimit
+	}
+	return f.Limit
+}
+
+// match reports whether event is selected by f, ignoring the limit. Times
+// are compared to the second, as they are stored.
+func (f AuditFilter) match(event *models.AuditEvent) bool {
+	return (f.Actor == "" || event.Actor == f.Actor) &&
+		(f.SourceIP == "" || event.SourceIP == f.SourceIP) &&
+		(f.Operation == "" || event.Operation == f.Operation) &&
+		(f.BodySHA256 == "" || event.BodySHA256 == f.BodySHA256) &&
+		(f.Since.IsZero() || !event.CreatedAt.Before(f.Since.Truncate(time.Second))) &&
+		(f.Until.IsZero() || !event.CreatedAt.After(f.Until.Truncate(time.Second)))
+}
+
+// ListAuditEvents returns the audit events selected by filter, newest first.
+func (r *Repository) ListAuditEvents(ctx context.Context, filter AuditFilter) ([]models.AuditEvent, error) {
+	rows, err := r.statements().listAudit.QueryContext(ctx, filter.args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var e models.AuditEvent
+		var createdAt, sources string
+		var actor, protected, errMsg, runID, clientCert, method, path, bodySum, sourceIP sql.NullString
+		var status sql.NullInt64
+		if err := rows.Scan(&e.ID, &createdAt, &e.Operation, &e.Origin, &actor, &e.NSXHost,
+			&sources, &protected, &e.Reason, &e.Outcome, &errMsg, &runID, &clientCert,
+			&method, &path, &status, &bodySum, &sourceIP); err != nil {
+			return nil, err
+		}
+		if e.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+			return nil, fmt.Errorf("audit event %d: %w", e.ID, err)
+		}
+		if err := json.Unmarshal([]byte(sources), &e.SourceIDs); err != nil {
+			return nil, fmt.Errorf("audit event %d: invalid source IDs: %w", e.ID, err)
+		}
+		if protected.Valid {
+			if err := json.Unmarshal([]byte(protected.String), &e.Protected); err != nil {
+				return nil, fmt.Errorf("audit event %d: invalid protected source IDs: %w", e.ID, err)
+			}
+		}
+		e.Actor = actor.String
+		e.Error = errMsg.String
+		e.RunID = runID.String
+		e.ClientCert = clientCert.String
+		e.Method = method.String
+		e.Path = path.String
+		e.Status = int(status.Int64)
+		e.BodySHA256 = bodySum.String
+		e.SourceIP = sourceIP.String
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
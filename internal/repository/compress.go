@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressThreshold is the size of the history data from which it is
+// stored compressed. Smaller rows are kept as plain JSON, readable with
+// the sqlite3 shell.
+const compressThreshold = 4 << 10
+
+// encodingZstd marks history data stored as zstd frames.
+const encodingZstd = "zstd"
+
+// maxDecodedSize bounds each decompressed history column.
+const maxDecodedSize = 256 << 20
+
+// The encoder and decoder are safe for concurrent use with EncodeAll and
+// DecodeAll, so they are shared by all repositories.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecodedSize))
+)
+
+// encodeHistory returns the values to store for the JSON columns of a
+// history entry with their encoding: zstd blobs if together they reach
+// compressThreshold, else text.
+func encodeHistory(columns ...[]byte) ([]any, sql.NullString) {
+	size := 0
+	for _, data := range columns {
+		size += len(data)
+	}
+
+	values := make([]any, len(columns))
+	if size < compressThreshold {
+		for i, data := range columns {
+			values[i] = string(data)
+		}
+		return values, sql.NullString{}
+	}
+	for i, data := range columns {
+		values[i] = zstdEncoder.EncodeAll(data, nil)
+	}
+	return values, sql.NullString{String: encodingZstd, Valid: true}
+}
+
+// decodeHistory returns the JSON of a history column stored with encoding.
+func decodeHistory(encoding string, data []byte) ([]byte, error) {
+	switch encoding {
+	case "":
+		return data, nil
+	case encodingZstd:
+		decoded, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress history: %w", err)
+		}
+		return decoded, nil
+	}
+	return nil, fmt.Errorf("unknown history encoding %q", encoding)
+}
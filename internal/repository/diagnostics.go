@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pressly/goose/v3"
+)
+
+// Diagnostics describes the state of a database file.
+type Diagnostics struct {
+	Path          string      `json:"path"`
+	Exists        bool        `json:"exists"`
+	Mode          fs.FileMode `json:"mode"`
+	Size          int64       `json:"size"`
+	Integrity     []string    `json:"integrity"`
+	SchemaVersion int64       `json:"schema_version"`
+	LatestVersion int64       `json:"latest_version"`
+}
+
+// IntegrityOK reports whether PRAGMA integrity_check found no problems.
+func (d *Diagnostics) IntegrityOK() bool {
+	return len(d.Integrity) == 1 && d.Integrity[0] == "ok"
+}
+
+// MigrationsPending reports whether the schema is older than this build expects.
+func (d *Diagnostics) MigrationsPending() bool {
+	return d.SchemaVersion < d.LatestVersion
+}
+
+// Diagnose inspects a database file without modifying it: the file is opened
+// read-only and migrations are not applied.
+func Diagnose(ctx context.Context, dbPath string) (*Diagnostics, error) {
+	diag := &Diagnostics{Path: dbPath}
+
+	latest, err := latestMigrationVersion()
+	if err != nil {
+		return nil, err
+	}
+	diag.LatestVersion = latest
+
+	info, err := os.Stat(dbPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return diag, nil
+		}
+		return nil, fmt.Errorf("failed to stat database: %w", err)
+	}
+	diag.Exists = true
+	diag.Mode = info.Mode().Perm()
+	diag.Size = info.Size()
+
+	dsn, err := readOnlyDSN(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, "PRAGMA integrity_check")
+	if err != nil {
+		return nil, fmt.Errorf("failed to run integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, fmt.Errorf("failed to read integrity check: %w", err)
+		}
+		diag.Integrity = append(diag.Integrity, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to run integrity check: %w", err)
+	}
+
+	var version sql.NullInt64
+	err = db.QueryRowContext(ctx, "SELECT MAX(version_id) FROM goose_db_version WHERE is_applied").Scan(&version)
+	if err != nil && !strings.Contains(err.Error(), "no such table") {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	diag.SchemaVersion = version.Int64
+
+	return diag, nil
+}
+
+// readOnlyDSN returns a read-only SQLite URI for dbPath. The path is made
+// absolute and escaped, so "?" and "#" in it are not taken for URI
+// parameters or a fragment.
+func readOnlyDSN(dbPath string) (string, error) {
+	abs, err := filepath.Abs(dbPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve database path: %w", err)
+	}
+	path := filepath.ToSlash(abs)
+	if !strings.HasPrefix(path, "/") {
+		// A Windows drive letter: file:///C:/data/ldapmerge.db
+		path = "/" + path
+	}
+	u := url.URL{Scheme: "file", Path: path, RawQuery: "mode=ro"}
+	return u.String(), nil
+}
+
+// latestMigrationVersion returns the highest embedded migration version.
+func latestMigrationVersion() (int64, error) {
+	files, err := fs.Glob(migrationsFS, "migrations/*.sql")
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int64
+	for _, f := range files {
+		v, err := goose.NumericComponent(f)
+		if err != nil {
+			return 0, fmt.Errorf("invalid migration file %q: %w", f, err)
+		}
+		latest = max(latest, v)
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// "?" and "#" would end the path of an unescaped URI
+	healthy := filepath.Join(dir, "ldap?merge#1.db")
+	created := filepath.Join(dir, "created.db")
+	repo, err := New(created)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	_ = repo.Close()
+	if err := os.Rename(created, healthy); err != nil {
+		t.Fatal(err)
+	}
+
+	diag, err := Diagnose(ctx, healthy)
+	if err != nil {
+		t.Fatalf("Diagnose failed: %v", err)
+	}
+	if !diag.Exists || diag.Size == 0 || !diag.IntegrityOK() || diag.MigrationsPending() || diag.SchemaVersion == 0 {
+		t.Errorf("Expected a healthy, migrated database, got %+v", diag)
+	}
+
+	missing := filepath.Join(dir, "missing.db")
+	diag, err = Diagnose(ctx, missing)
+	if err != nil {
+		t.Fatalf("Diagnose of a missing file failed: %v", err)
+	}
+	if diag.Exists || diag.SchemaVersion != 0 || diag.LatestVersion == 0 {
+		t.Errorf("Expected a missing database, got %+v", diag)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("Expected Diagnose not to create %s, got %v", missing, err)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.db")
+	if err := os.WriteFile(corrupt, []byte("not a database, just some text long enough to fill a header"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if diag, err := Diagnose(ctx, corrupt); err == nil {
+		t.Errorf("Expected an error for a corrupt file, got %+v", diag)
+	}
+}
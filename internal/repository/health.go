@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// DefaultPingInterval is how often Monitor checks the database by default.
+const DefaultPingInterval = 30 * time.Second
+
+// pingTimeout bounds a database check.
+const pingTimeout = 5 * time.Second
+
+// Health is the state of the database as of the last check.
+type Health struct {
+	OK         bool       `json:"ok"`
+	Error      string     `json:"error,omitempty"`
+	CheckedAt  time.Time  `json:"checked_at"`
+	Reopens    int        `json:"reopens"`               // times the database was reopened after an error
+	ReopenedAt *time.Time `json:"reopened_at,omitempty"` // last reopen
+}
+
+// Health returns the state of the database as of the last check.
+func (r *Repository) Health() Health {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.health
+}
+
+// Ping checks that the database can be read. When the check fails with an
+// error a new connection may recover from, such as a locked, closed or
+// moved database file, the database is reopened and checked again. The
+// outcome is recorded in Health.
+func (r *Repository) Ping(ctx context.Context) error {
+	err := ping(ctx, r.sqlDB())
+	if err != nil && reopenable(err) {
+		if reopenErr := r.reopen(); reopenErr != nil {
+			err = fmt.Errorf("%w (reopen failed: %v)", err, reopenErr)
+		} else {
+			err = ping(ctx, r.sqlDB())
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.health.OK = err == nil
+	r.health.Error = ""
+	if err != nil {
+		r.health.Error = err.Error()
+	}
+	r.health.CheckedAt = time.Now().UTC()
+	return err
+}
+
+// Monitor pings the database every interval until ctx is done, reopening
+// it after errors; see Ping.
+func (r *Repository) Monitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = r.Ping(ctx)
+		}
+	}
+}
+
+// ping reads the schema, which touches the database file.
+func ping(ctx context.Context, db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	var n int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master").Scan(&n); err != nil {
+		return fmt.Errorf("database check failed: %w", err)
+	}
+	return nil
+}
+
+// reopen replaces the database and its statements with new ones. The old
+// database is closed once its running queries finish.
+func (r *Repository) reopen() error {
+	db, stmts, err := open(r.dbPath, r.opts)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	if r.closing {
+		r.mu.Unlock()
+		stmts.close()
+		_ = db.Close()
+		return errors.New("repository is closed")
+	}
+	oldDB, oldStmts := r.db, r.stmts
+	r.db, r.stmts = db, stmts
+	now := time.Now().UTC()
+	r.health.Reopens++
+	r.health.ReopenedAt = &now
+	r.mu.Unlock()
+
+	oldStmts.close()
+	_ = oldDB.Close()
+	return nil
+}
+
+// reopenable reports whether err may be recovered from by reopening the
+// database.
+func reopenable(err error) bool {
+	if errors.Is(err, sql.ErrConnDone) || strings.Contains(err.Error(), "sql: database is closed") {
+		return true
+	}
+
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED, sqlite3.SQLITE_IOERR, sqlite3.SQLITE_CANTOPEN,
+		sqlite3.SQLITE_READONLY, sqlite3.SQLITE_NOTADB:
+		return true
+	}
+	return false
+}
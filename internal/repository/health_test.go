@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"ldapmerge/internal/models"
+)
+
+func TestPingReopensClosedDatabase(t *testing.T) {
+	repo, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+	ctx := context.Background()
+
+	if err := repo.Ping(ctx); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+
+	// As after a failure the pool does not recover from
+	_ = repo.sqlDB().Close()
+	if _, err := repo.ListHistory(ctx, HistoryFilter{}); err == nil {
+		t.Fatal("Expected an error from the closed database")
+	}
+
+	if err := repo.Ping(ctx); err != nil {
+		t.Fatalf("Ping after close failed: %v", err)
+	}
+	health := repo.Health()
+	if !health.OK || health.Reopens != 1 || health.ReopenedAt == nil {
+		t.Errorf("Expected a healthy, reopened database, got %+v", health)
+	}
+
+	if _, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, nil); err != nil {
+		t.Errorf("SaveHistory after reopen failed: %v", err)
+	}
+}
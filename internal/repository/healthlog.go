@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"ldapmerge/internal/models"
+)
+
+// AddHealthSnapshot stores a health snapshot and sets its ID. A zero
+// TakenAt is set to the current time.
+func (r *Repository) AddHealthSnapshot(ctx context.Context, snapshot *models.HealthSnapshot) error {
+	if snapshot.NSX == nil {
+		snapshot.NSX = []models.NSXSample{}
+	}
+	nsx, err := json.Marshal(snapshot.NSX)
+	if err != nil {
+		return fmt.Errorf("failed to marshal NSX samples: %w", err)
+	}
+	if snapshot.TakenAt.IsZero() {
+		snapshot.TakenAt = time.Now().UTC().Truncate(time.Second)
+	}
+
+	db := snapshot.Database
+	err = r.statements().insertHealth.QueryRowContext(ctx,
+		formatTimestamp(snapshot.TakenAt), db.OK, nullString(db.Error), db.Size, db.HistoryCount, string(nsx),
+	).Scan(&snapshot.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert health snapshot: %w", err)
+	}
+	return nil
+}
+
+// ListHealthSnapshots returns up to limit health snapshots taken at or
+// after since, newest first. A zero since returns the latest snapshots.
+func (r *Repository) ListHealthSnapshots(ctx context.Context, since time.Time, limit int) ([]models.HealthSnapshot, error) {
+	rows, err := r.statements().listHealth.QueryContext(ctx, formatTimestamp(since), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []models.HealthSnapshot{}
+	for rows.Next() {
+		var s models.HealthSnapshot
+		var takenAt, nsx string
+		var dbError sql.NullString
+		if err := rows.Scan(&s.ID, &takenAt, &s.Database.OK, &dbError, &s.Database.Size, &s.Database.HistoryCount, &nsx); err != nil {
+			return nil, err
+		}
+		if s.TakenAt, err = parseTimestamp(takenAt); err != nil {
+			return nil, fmt.Errorf("health snapshot %d: %w", s.ID, err)
+		}
+		s.Database.Error = dbError.String
+		if err := json.Unmarshal([]byte(nsx), &s.NSX); err != nil {
+			return nil, fmt.Errorf("health snapshot %d: invalid NSX samples: %w", s.ID, err)
+		}
+		snapshots = append(snapshots, s)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// PruneHealthSnapshots deletes the health snapshots taken before the given
+// time and returns the number of deleted snapshots.
+func (r *Repository) PruneHealthSnapshots(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.statements().pruneHealth.ExecContext(ctx, formatTimestamp(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
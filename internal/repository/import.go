@@ -0,0 +1,362 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ImportResult summarizes a database import.
+type ImportResult struct {
+	SourceVersion     int64 `json:"source_version"`
+	HistoryImported   int   `json:"history_imported"`
+	HistorySkipped    int   `json:"history_skipped"`
+	ConfigsImported   int   `json:"configs_imported"`
+	ConfigsSkipped    int   `json:"configs_skipped"`
+	DocumentsImported int   `json:"documents_imported"`
+	DocumentsSkipped  int   `json:"documents_skipped"`
+}
+
+// legacyTimestampLayouts are timestamp formats written by releases before
+// timestamps were normalized to RFC3339 UTC (see 002_utc_timestamps.sql).
+var legacyTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05 -0700 MST",
+}
+
+// parseLegacyTimestamp parses a timestamp in any format used by past releases.
+func parseLegacyTimestamp(s string) (time.Time, error) {
+	for _, layout := range legacyTimestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
+
+// ImportFrom copies history, NSX configurations and documents from another
+// ldapmerge database into this one. The source is opened read-only and may
+// use any earlier schema, including layouts created before versioned
+// migrations. Rows already present are skipped: history by timestamp and
+// content, configurations by name, documents by tenant, kind and checksum. Soft-
+// deleted configurations are not imported.
+//
+// With dryRun set, the import runs in a transaction that is rolled back.
+func (r *Repository) ImportFrom(ctx context.Context, srcPath string, dryRun bool) (*ImportResult, error) {
+	if _, err := os.Stat(srcPath); err != nil {
+		return nil, fmt.Errorf("source database: %w", err)
+	}
+	if sameFile(srcPath, r.dbPath) {
+		return nil, fmt.Errorf("source database %s is the target database", srcPath)
+	}
+
+	dsn, err := readOnlyDSN(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	src, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source database: %w", err)
+	}
+	defer src.Close()
+
+	result := &ImportResult{}
+
+	var version sql.NullInt64
+	err = src.QueryRowContext(ctx, "SELECT MAX(version_id) FROM goose_db_version WHERE is_applied").Scan(&version)
+	if err != nil && !strings.Contains(err.Error(), "no such table") {
+		return nil, fmt.Errorf("failed to read source schema version: %w", err)
+	}
+	result.SourceVersion = version.Int64
+
+	tx, err := r.sqlDB().BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := importHistory(ctx, src, tx, result); err != nil {
+		return nil, err
+	}
+	if err := importConfigs(ctx, src, tx, result); err != nil {
+		return nil, err
+	}
+	if err := importDocuments(ctx, src, tx, result); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return result, nil
+}
+
+// sameFile reports whether a and b refer to the same existing file.
+func sameFile(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fa, fb)
+}
+
+// tableColumns returns the column names of table, or nil if it does not exist.
+func tableColumns(ctx context.Context, db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect source table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns map[string]bool
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if columns == nil {
+			columns = make(map[string]bool)
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+// optionalColumn returns column if present, or the SQL literal fallback.
+func optionalColumn(columns map[string]bool, column, fallback string) string {
+	if columns[column] {
+		return column
+	}
+	return fallback
+}
+
+// historyKey identifies a history row for de-duplication by its
+// decompressed data, so that rows match whatever their encoding.
+func historyKey(createdAt, artifactKey, encoding string, columns ...[]byte) (string, error) {
+	if artifactKey != "" {
+		return "artifact:" + artifactKey, nil
+	}
+	h := sha256.New()
+	for _, data := range columns {
+		decoded, err := decodeHistory(encoding, data)
+		if err != nil {
+			return "", err
+		}
+		h.Write(decoded)
+		h.Write([]byte{0})
+	}
+	return createdAt + "|" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func importHistory(ctx context.Context, src *sql.DB, tx *sql.Tx, result *ImportResult) error {
+	columns, err := tableColumns(ctx, src, "history")
+	if err != nil || columns == nil {
+		return err
+	}
+
+	existing := make(map[string]bool)
+	rows, err := tx.QueryContext(ctx, `SELECT created_at, initial, response, result, COALESCE(artifact_key, ''), COALESCE(encoding, '') FROM history`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var createdAt, artifactKey, encoding string
+		var initial, response, res []byte
+		if err := rows.Scan(&createdAt, &initial, &response, &res, &artifactKey, &encoding); err != nil {
+			rows.Close()
+			return err
+		}
+		key, err := historyKey(createdAt, artifactKey, encoding, initial, response, res)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		existing[key] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`SELECT COALESCE(CAST(created_at AS TEXT), ''), initial, response, result, COALESCE(%s, ''), %s, COALESCE(%s, ''),
+		%s, %s, %s, %s, %s, %s, %s FROM history ORDER BY id`,
+		optionalColumn(columns, "artifact_key", "NULL"), optionalColumn(columns, "stats", "NULL"), optionalColumn(columns, "encoding", "NULL"),
+		optionalColumn(columns, "size", "length(CAST(initial AS BLOB)) + length(CAST(response AS BLOB)) + length(CAST(result AS BLOB))"),
+		optionalColumn(columns, "domains", "NULL"), optionalColumn(columns, "servers", "NULL"), optionalColumn(columns, "certificates", "NULL"),
+		optionalColumn(columns, "tenant", "''"), optionalColumn(columns, "run_id", "NULL"), optionalColumn(columns, "domain_ids", "NULL"))
+	srcRows, err := src.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to read source history: %w", err)
+	}
+	defer srcRows.Close()
+
+	for srcRows.Next() {
+		var createdAt, artifactKey, encoding, tenant string
+		var initial, response, res any
+		var stats, runID, domainIDs sql.NullString
+		var size, domains, servers, certificates sql.NullInt64
+		if err := srcRows.Scan(&createdAt, &initial, &response, &res, &artifactKey, &stats, &encoding, &size, &domains, &servers, &certificates, &tenant, &runID, &domainIDs); err != nil {
+			return fmt.Errorf("failed to read source history: %w", err)
+		}
+
+		created := time.Now()
+		if createdAt != "" {
+			if created, err = parseLegacyTimestamp(createdAt); err != nil {
+				return fmt.Errorf("source history: %w", err)
+			}
+		}
+		createdAt = formatTimestamp(created)
+
+		key, err := historyKey(createdAt, artifactKey, encoding, columnBytes(initial), columnBytes(response), columnBytes(res))
+		if err != nil {
+			return fmt.Errorf("source history: %w", err)
+		}
+		if existing[key] {
+			result.HistorySkipped++
+			continue
+		}
+		existing[key] = true
+
+		// The data is copied as stored: text or compressed blobs. Counts and
+		// domain IDs missing from older databases are computed when first
+		// listed.
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO history (created_at, initial, response, result, artifact_key, stats, encoding, size, domains, servers, certificates, tenant, run_id, domain_ids)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			createdAt, initial, response, res, sql.NullString{String: artifactKey, Valid: artifactKey != ""}, stats,
+			sql.NullString{String: encoding, Valid: encoding != ""}, size, domains, servers, certificates, tenant, runID, domainIDs)
+		if err != nil {
+			return fmt.Errorf("failed to import history: %w", err)
+		}
+		result.HistoryImported++
+	}
+
+	return srcRows.Err()
+}
+
+// columnBytes returns the content of a text or blob column scanned into any.
+func columnBytes(v any) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return nil
+}
+
+func importConfigs(ctx context.Context, src *sql.DB, tx *sql.Tx, result *ImportResult) error {
+	columns, err := tableColumns(ctx, src, "nsx_configs")
+	if err != nil || columns == nil {
+		return err
+	}
+
+	where := ""
+	if columns["deleted_at"] {
+		where = "WHERE deleted_at IS NULL"
+	}
+	query := fmt.Sprintf(`SELECT name, COALESCE(description, ''), host, username, COALESCE(password, ''), COALESCE(insecure, 0),
+		COALESCE(CAST(created_at AS TEXT), ''), COALESCE(CAST(updated_at AS TEXT), ''), %s, %s FROM nsx_configs %s ORDER BY id`,
+		optionalColumn(columns, "tenant", "''"), optionalColumn(columns, "sync_defaults", "NULL"), where)
+
+	rows, err := src.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to read source configs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, description, host, username, password, createdAt, updatedAt, tenant string
+		var insecure bool
+		var defaults sql.NullString
+		if err := rows.Scan(&name, &description, &host, &username, &password, &insecure, &createdAt, &updatedAt, &tenant, &defaults); err != nil {
+			return fmt.Errorf("failed to read source configs: %w", err)
+		}
+
+		var exists int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM nsx_configs WHERE tenant = ? AND name = ? AND deleted_at IS NULL`, tenant, name).Scan(&exists); err != nil {
+			return err
+		}
+		if exists > 0 {
+			result.ConfigsSkipped++
+			continue
+		}
+
+		created, updated := time.Now(), time.Now()
+		if createdAt != "" {
+			if created, err = parseLegacyTimestamp(createdAt); err != nil {
+				return fmt.Errorf("source config %q: %w", name, err)
+			}
+		}
+		if updatedAt != "" {
+			if updated, err = parseLegacyTimestamp(updatedAt); err != nil {
+				return fmt.Errorf("source config %q: %w", name, err)
+			}
+		}
+
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO nsx_configs (name, description, host, username, password, insecure, created_at, updated_at, tenant, sync_defaults) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			name, description, host, username, password, insecure, formatTimestamp(created), formatTimestamp(updated), tenant, defaults)
+		if err != nil {
+			return fmt.Errorf("failed to import config %q: %w", name, err)
+		}
+		result.ConfigsImported++
+	}
+
+	return rows.Err()
+}
+
+func importDocuments(ctx context.Context, src *sql.DB, tx *sql.Tx, result *ImportResult) error {
+	columns, err := tableColumns(ctx, src, "documents")
+	if err != nil || columns == nil {
+		return err
+	}
+
+	rows, err := src.QueryContext(ctx, fmt.Sprintf(`SELECT name, kind, content, size, sha256, created_at, %s FROM documents ORDER BY id`,
+		optionalColumn(columns, "tenant", "''")))
+	if err != nil {
+		return fmt.Errorf("failed to read source documents: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, kind, content, sum, createdAt, tenant string
+		var size int64
+		if err := rows.Scan(&name, &kind, &content, &size, &sum, &createdAt, &tenant); err != nil {
+			return fmt.Errorf("failed to read source documents: %w", err)
+		}
+
+		var exists int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM documents WHERE tenant = ? AND kind = ? AND sha256 = ?`, tenant, kind, sum).Scan(&exists); err != nil {
+			return err
+		}
+		if exists > 0 {
+			result.DocumentsSkipped++
+			continue
+		}
+
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO documents (name, kind, content, size, sha256, created_at, tenant) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			name, kind, content, size, sum, createdAt, tenant)
+		if err != nil {
+			return fmt.Errorf("failed to import document %q: %w", name, err)
+		}
+		result.DocumentsImported++
+	}
+
+	return rows.Err()
+}
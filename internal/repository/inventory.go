@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	"ldapmerge/internal/diff"
+	"ldapmerge/internal/models"
+)
+
+// UpdateInventory records the LDAP servers of domains pulled from the NSX
+// Manager at nsxHost. Known servers are updated; new ones are added. Servers
+// no longer present keep their last_seen_at, so stale entries can be spotted.
+func (r *Repository) UpdateInventory(ctx context.Context, nsxHost string, domains []models.Domain) (int, error) {
+	now := formatTimestamp(time.Now())
+
+	tx, err := r.sqlDB().BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt := tx.StmtContext(ctx, r.statements().upsertServer)
+
+	count := 0
+	for _, domain := range domains {
+		for _, server := range domain.LDAPServers {
+			fingerprint, subject, expires := leafCertificate(server.Certificates)
+			_, err := stmt.ExecContext(ctx,
+				nsxHost, domain.ID, server.URL, server.Enabled != "false",
+				nullString(fingerprint), nullString(subject), nullTimestamp(expires), len(server.Certificates),
+				now, now,
+			)
+			if err != nil {
+				return 0, fmt.Errorf("failed to update server %s: %w", server.URL, err)
+			}
+			count++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// RecordProbe stores the outcome of probing the server at url through the
+// NSX Manager at nsxHost and appends it to the server's probe history.
+// Servers not in the inventory are ignored.
+func (r *Repository) RecordProbe(ctx context.Context, nsxHost, url string, success bool, errMsg string) error {
+	now := formatTimestamp(time.Now())
+
+	tx, err := r.sqlDB().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.StmtContext(ctx, r.statements().recordProbe).ExecContext(ctx,
+		now, success, nullString(errMsg), success, nsxHost, url)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.StmtContext(ctx, r.statements().insertProbe).ExecContext(ctx,
+		now, success, nullString(errMsg), nsxHost, url)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListServers returns the server inventory ordered by NSX host, domain and URL.
+func (r *Repository) ListServers(ctx context.Context) ([]models.InventoryServer, error) {
+	rows, err := r.statements().listServers.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var servers []models.InventoryServer
+	for rows.Next() {
+		server, err := scanServer(rows)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, *server)
+	}
+
+	return servers, rows.Err()
+}
+
+// GetServer returns an inventory server by ID, or sql.ErrNoRows.
+func (r *Repository) GetServer(ctx context.Context, id int64) (*models.InventoryServer, error) {
+	return scanServer(r.statements().getServer.QueryRowContext(ctx, id))
+}
+
+// ListProbes returns up to limit entries of a server's probe history, newest first.
+func (r *Repository) ListProbes(ctx context.Context, serverID int64, limit int) ([]models.ProbeRecord, error) {
+	rows, err := r.statements().listProbes.QueryContext(ctx, serverID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var probes []models.ProbeRecord
+	for rows.Next() {
+		var p models.ProbeRecord
+		var probedAt string
+		var errMsg sql.NullString
+		if err := rows.Scan(&probedAt, &p.Success, &errMsg); err != nil {
+			return nil, err
+		}
+		if p.ProbedAt, err = parseTimestamp(probedAt); err != nil {
+			return nil, err
+		}
+		p.Error = errMsg.String
+		probes = append(probes, p)
+	}
+
+	return probes, rows.Err()
+}
+
+// PruneProbes deletes probe history recorded before the given time and
+// returns the number of deleted entries.
+func (r *Repository) PruneProbes(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.statements().pruneProbes.ExecContext(ctx, formatTimestamp(before))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanServer(row rowScanner) (*models.InventoryServer, error) {
+	var s models.InventoryServer
+	var fingerprint, subject, expires, probeAt, probeErr, lastFailure sql.NullString
+	var probeOK sql.NullBool
+	var successes int
+	var firstSeen, lastSeen string
+
+	err := row.Scan(&s.ID, &s.NSXHost, &s.DomainID, &s.URL, &s.Enabled, &fingerprint, &subject, &expires, &s.CertCount,
+		&probeAt, &probeOK, &probeErr, &s.ConsecutiveFailures, &s.ProbeCount, &successes, &lastFailure,
+		&firstSeen, &lastSeen)
+	if err != nil {
+		return nil, err
+	}
+
+	s.CertFingerprint = fingerprint.String
+	s.CertSubject = subject.String
+	s.LastProbeError = probeErr.String
+	if probeOK.Valid {
+		s.LastProbeOK = &probeOK.Bool
+	}
+	if s.ProbeCount > 0 {
+		uptime := float64(successes) * 100 / float64(s.ProbeCount)
+		s.Uptime = &uptime
+	}
+	if s.CertExpiresAt, err = parseNullTimestamp(expires); err != nil {
+		return nil, fmt.Errorf("server %d: %w", s.ID, err)
+	}
+	if s.LastProbeAt, err = parseNullTimestamp(probeAt); err != nil {
+		return nil, fmt.Errorf("server %d: %w", s.ID, err)
+	}
+	if s.LastFailureAt, err = parseNullTimestamp(lastFailure); err != nil {
+		return nil, fmt.Errorf("server %d: %w", s.ID, err)
+	}
+	if s.FirstSeenAt, err = parseTimestamp(firstSeen); err != nil {
+		return nil, fmt.Errorf("server %d: %w", s.ID, err)
+	}
+	if s.LastSeenAt, err = parseTimestamp(lastSeen); err != nil {
+		return nil, fmt.Errorf("server %d: %w", s.ID, err)
+	}
+
+	return &s, nil
+}
+
+// leafCertificate returns the fingerprint, subject CN and expiry of the
+// first parseable certificate; NSX lists the leaf certificate first.
+func leafCertificate(certs []string) (fingerprint, subject string, expires *time.Time) {
+	for _, cert := range certs {
+		block, _ := pem.Decode([]byte(strings.TrimSpace(cert)))
+		if block == nil {
+			continue
+		}
+		parsed, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		notAfter := parsed.NotAfter.UTC()
+		return diff.Fingerprint(cert), parsed.Subject.CommonName, &notAfter
+	}
+	return "", "", nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+func nullTimestamp(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: formatTimestamp(*t), Valid: true}
+}
+
+func parseNullTimestamp(s sql.NullString) (*time.Time, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	t, err := parseTimestamp(s.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
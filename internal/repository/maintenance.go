@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+// Checkpoint is the outcome of a WAL checkpoint.
+type Checkpoint struct {
+	Busy         bool `json:"busy"`         // a reader or writer kept the checkpoint from completing
+	Frames       int  `json:"frames"`       // frames in the write-ahead log
+	Checkpointed int  `json:"checkpointed"` // frames copied back into the database
+	Truncated    bool `json:"truncated"`    // the write-ahead log was truncated to zero bytes
+}
+
+// Path returns the path of the database file.
+func (r *Repository) Path() string {
+	return r.dbPath
+}
+
+// Checkpoint copies the write-ahead log back into the database. A passive
+// checkpoint does not wait for readers and writers; with truncate, it waits
+// for them (up to the busy timeout) and then truncates the log file, which
+// SQLite otherwise only reuses and never shrinks.
+func (r *Repository) Checkpoint(ctx context.Context, truncate bool) (*Checkpoint, error) {
+	mode := "PASSIVE"
+	if truncate {
+		mode = "TRUNCATE"
+	}
+
+	var busy int
+	cp := &Checkpoint{}
+	row := r.sqlDB().QueryRowContext(ctx, "PRAGMA wal_checkpoint("+mode+")")
+	if err := row.Scan(&busy, &cp.Frames, &cp.Checkpointed); err != nil {
+		return nil, fmt.Errorf("failed to checkpoint the write-ahead log: %w", err)
+	}
+	cp.Busy = busy != 0
+	cp.Truncated = truncate && !cp.Busy
+	return cp, nil
+}
@@ -0,0 +1,748 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/runid"
+)
+
+// MemoryPath is the DBInfo path of a Memory repository.
+const MemoryPath = ":memory:"
+
+// Memory is a repository that keeps everything in memory, for tests of the
+// code built on Repository. It behaves like Repository for history, NSX
+// configurations, documents, snapshots, the audit log, settings and health
+// snapshots, including tenant scoping and sql.ErrNoRows for missing rows,
+// but has no server inventory.
+// Values are copied in and out, so callers cannot change stored data.
+type Memory struct {
+	mu        sync.Mutex
+	lastID    int64
+	history   []memoryHistory
+	configs   []memoryConfig
+	documents []models.Document
+	snapshots []models.Snapshot
+	audit     []models.AuditEvent
+	settings  map[string]models.Setting
+	healthLog []models.HealthSnapshot
+	health    Health
+}
+
+// memoryHistory is a history entry with its data kept as JSON.
+type memoryHistory struct {
+	entry                     models.HistoryEntry
+	initial, response, result []byte
+}
+
+type memoryConfig struct {
+	config  models.NSXConfig
+	deleted bool
+}
+
+// NewMemory returns an empty in-memory repository.
+func NewMemory() *Memory {
+	return &Memory{health: Health{OK: true, CheckedAt: time.Now().UTC()}}
+}
+
+// nextID returns the next row ID; IDs are unique across tables.
+func (m *Memory) nextID() int64 {
+	m.lastID++
+	return m.lastID
+}
+
+// visible reports whether a row of tenant is seen with ctx; see TenantFrom.
+func visible(ctx context.Context, tenant string) bool {
+	t, ok := TenantFrom(ctx)
+	return !ok || t == tenant
+}
+
+// copyJSON deep-copies src into dst through JSON.
+func copyJSON(dst, src any) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// Ping always succeeds and records the check in Health.
+func (m *Memory) Ping(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.health.CheckedAt = time.Now().UTC()
+	return nil
+}
+
+// Health returns the state as of the last Ping.
+func (m *Memory) Health() Health {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.health
+}
+
+// GetDBInfo returns the row counts; the path is MemoryPath.
+func (m *Memory) GetDBInfo(context.Context) (*DBInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info := &DBInfo{
+		Path:          MemoryPath,
+		SizeHuman:     formatBytes(0),
+		Version:       "memory",
+		HistoryCount:  int64(len(m.history)),
+		DocumentCount: int64(len(m.documents)),
+	}
+	for _, c := range m.configs {
+		if !c.deleted {
+			info.ConfigCount++
+		}
+	}
+	return info, nil
+}
+
+// SaveHistory saves a merge operation to history.
+func (m *Memory) SaveHistory(ctx context.Context, initial []models.Domain, response models.CertificateResponse, result []models.Domain) (*models.HistoryEntry, error) {
+	return m.SaveHistoryWithStats(ctx, initial, response, result, nil)
+}
+
+// SaveHistoryWithStats saves a merge operation with its statistics.
+func (m *Memory) SaveHistoryWithStats(ctx context.Context, initial []models.Domain, response models.CertificateResponse, result []models.Domain, stats *models.MergeStats) (*models.HistoryEntry, error) {
+	var h memoryHistory
+	var err error
+	if h.initial, err = json.Marshal(initial); err != nil {
+		return nil, fmt.Errorf("failed to marshal initial: %w", err)
+	}
+	if h.response, err = json.Marshal(response); err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	if h.result, err = json.Marshal(result); err != nil {
+		return nil, fmt.Errorf("failed to marshal result: %w", err)
+	}
+	if stats != nil {
+		stats.InputBytes = int64(len(h.initial) + len(h.response))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	h.entry = models.HistoryEntry{
+		ID:        m.nextID(),
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Size:      int64(len(h.initial) + len(h.response) + len(h.result)),
+		Tenant:    tenantOf(ctx),
+	}
+	h.entry.RunID, _ = runid.From(ctx)
+	if stats != nil {
+		h.entry.Stats = &models.MergeStats{}
+		if err := copyJSON(h.entry.Stats, stats); err != nil {
+			return nil, fmt.Errorf("failed to marshal stats: %w", err)
+		}
+	}
+	m.history = append(m.history, h)
+
+	return h.load()
+}
+
+// load returns a copy of the entry with its data.
+func (h memoryHistory) load() (*models.HistoryEntry, error) {
+	entry := h.entry
+	if h.entry.Stats != nil {
+		stats := *h.entry.Stats
+		entry.Stats = &stats
+	}
+	if err := unmarshalHistory(&entry, h.initial, h.response, h.result); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GetHistory retrieves a history entry by ID.
+func (m *Memory) GetHistory(ctx context.Context, id int64) (*models.HistoryEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, h := range m.history {
+		if h.entry.ID == id && visible(ctx, h.entry.Tenant) {
+			return h.load()
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// ListHistory retrieves the history entries selected by filter.
+func (m *Memory) ListHistory(ctx context.Context, filter HistoryFilter) ([]models.HistoryEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries, err := m.findHistory(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return pageHistory(entries, filter), nil
+}
+
+// ListHistorySummaries retrieves the history entries selected by filter
+// without their data.
+func (m *Memory) ListHistorySummaries(ctx context.Context, filter HistoryFilter) ([]models.HistorySummary, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries, err := m.findHistory(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	summaries := []models.HistorySummary{}
+	for _, entry := range pageHistory(entries, filter) {
+		summaries = append(summaries, entry.Summary())
+	}
+	return summaries, nil
+}
+
+// CountHistory returns the number of history entries selected by filter,
+// ignoring its limit and offset.
+func (m *Memory) CountHistory(ctx context.Context, filter HistoryFilter) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries, err := m.findHistory(ctx, filter)
+	return int64(len(entries)), err
+}
+
+// DeleteHistory removes a history entry by ID.
+func (m *Memory) DeleteHistory(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, h := range m.history {
+		if h.entry.ID == id && visible(ctx, h.entry.Tenant) {
+			m.history = slices.Delete(m.history, i, i+1)
+			m.unlinkSnapshots(id)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// PurgeHistory removes the history entries created before the given time
+// and returns how many were removed.
+func (m *Memory) PurgeHistory(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	m.history = slices.DeleteFunc(m.history, func(h memoryHistory) bool {
+		if !h.entry.CreatedAt.Before(before) || !visible(ctx, h.entry.Tenant) {
+			return false
+		}
+		deleted++
+		m.unlinkSnapshots(h.entry.ID)
+		return true
+	})
+	return deleted, nil
+}
+
+// unlinkSnapshots clears the history reference of the snapshots of a
+// deleted entry, as the foreign key of Repository does.
+func (m *Memory) unlinkSnapshots(historyID int64) {
+	for i := range m.snapshots {
+		if h := m.snapshots[i].HistoryID; h != nil && *h == historyID {
+			m.snapshots[i].HistoryID = nil
+		}
+	}
+}
+
+// findHistory returns the entries seen with ctx and selected by filter, in
+// its order.
+func (m *Memory) findHistory(ctx context.Context, filter HistoryFilter) ([]models.HistoryEntry, error) {
+	if _, ok := historySortColumns[filter.Sort]; !ok {
+		return nil, fmt.Errorf("invalid history sort %q", filter.Sort)
+	}
+
+	var entries []models.HistoryEntry
+	for _, h := range m.history {
+		if !visible(ctx, h.entry.Tenant) {
+			continue
+		}
+		entry, err := h.load()
+		if err != nil {
+			return nil, err
+		}
+		if filter.match(entry) {
+			entries = append(entries, *entry)
+		}
+	}
+
+	key := func(entry *models.HistoryEntry) int64 {
+		switch filter.Sort {
+		case "size":
+			return entry.Size
+		case "domains":
+			return int64(entry.Summary().Domains)
+		case "servers":
+			return int64(entry.Summary().Servers)
+		case "certificates":
+			return int64(entry.Summary().Certificates)
+		}
+		return entry.CreatedAt.Unix()
+	}
+	slices.SortFunc(entries, func(a, b models.HistoryEntry) int {
+		c := cmp.Or(cmp.Compare(key(&a), key(&b)), cmp.Compare(a.ID, b.ID))
+		if !filter.Asc {
+			return -c
+		}
+		return c
+	})
+	return entries, nil
+}
+
+// pageHistory returns the page of entries selected by the limit and offset
+// of filter.
+func pageHistory(entries []models.HistoryEntry, filter HistoryFilter) []models.HistoryEntry {
+	limit := filter.Limit
+	if limit < 1 {
+		limit = DefaultHistoryLimit
+	}
+	start := min(max(filter.Offset, 0), len(entries))
+	return entries[start:min(start+limit, len(entries))]
+}
+
+// SaveConfig saves or updates an NSX configuration, with the tenant rules
+// of Repository.SaveConfig. Names are unique per tenant.
+func (m *Memory) SaveConfig(ctx context.Context, config *models.NSXConfig) (*models.NSXConfig, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	saved := copyConfig(*config)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if config.ID == 0 {
+		if tenant, ok := TenantFrom(ctx); ok {
+			saved.Tenant = tenant
+		}
+		if m.configNamed(saved.Tenant, saved.Name, 0) {
+			return nil, fmt.Errorf("failed to insert config: name %q is already used", saved.Name)
+		}
+		saved.ID = m.nextID()
+		saved.CreatedAt = now
+		saved.UpdatedAt = now
+		m.configs = append(m.configs, memoryConfig{config: copyConfig(saved)})
+		return &saved, nil
+	}
+
+	c := m.findConfig(ctx, config.ID)
+	if c == nil {
+		return nil, sql.ErrNoRows
+	}
+	if m.configNamed(c.config.Tenant, saved.Name, saved.ID) {
+		return nil, fmt.Errorf("failed to update config: name %q is already used", saved.Name)
+	}
+	saved.Tenant = c.config.Tenant
+	saved.CreatedAt = c.config.CreatedAt
+	saved.UpdatedAt = now
+	c.config = copyConfig(saved)
+	return &saved, nil
+}
+
+// configNamed reports whether a config other than id of tenant has name.
+func (m *Memory) configNamed(tenant, name string, id int64) bool {
+	for _, c := range m.configs {
+		if !c.deleted && c.config.ID != id && c.config.Tenant == tenant && c.config.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findConfig returns the config id seen with ctx, or nil.
+func (m *Memory) findConfig(ctx context.Context, id int64) *memoryConfig {
+	for i := range m.configs {
+		c := &m.configs[i]
+		if c.config.ID == id && !c.deleted && visible(ctx, c.config.Tenant) {
+			return c
+		}
+	}
+	return nil
+}
+
+// copyConfig returns a copy of config that shares nothing with it.
+func copyConfig(config models.NSXConfig) models.NSXConfig {
+	if config.SyncDefaults != nil {
+		defaults := *config.SyncDefaults
+		defaults.Domains = slices.Clone(defaults.Domains)
+		config.SyncDefaults = &defaults
+	}
+	return config
+}
+
+// GetConfig retrieves an NSX configuration by ID.
+func (m *Memory) GetConfig(ctx context.Context, id int64) (*models.NSXConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := m.findConfig(ctx, id)
+	if c == nil {
+		return nil, sql.ErrNoRows
+	}
+	config := copyConfig(c.config)
+	return &config, nil
+}
+
+// ListConfigs retrieves all NSX configurations without their passwords,
+// ordered by name and tenant.
+func (m *Memory) ListConfigs(ctx context.Context) ([]models.NSXConfig, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var configs []models.NSXConfig
+	for _, c := range m.configs {
+		if c.deleted || !visible(ctx, c.config.Tenant) {
+			continue
+		}
+		config := copyConfig(c.config)
+		config.Password = ""
+		configs = append(configs, config)
+	}
+	slices.SortFunc(configs, func(a, b models.NSXConfig) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Tenant, b.Tenant))
+	})
+	return configs, nil
+}
+
+// DeleteConfig soft-deletes an NSX configuration by ID.
+func (m *Memory) DeleteConfig(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := m.findConfig(ctx, id)
+	if c == nil {
+		return sql.ErrNoRows
+	}
+	c.deleted = true
+	return nil
+}
+
+// PurgeConfig permanently removes an NSX configuration by ID, whether or
+// not it has been soft-deleted.
+func (m *Memory) PurgeConfig(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, c := range m.configs {
+		if c.config.ID == id && visible(ctx, c.config.Tenant) {
+			m.configs = slices.Delete(m.configs, i, i+1)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// SaveDocument stores an uploaded document; see Repository.SaveDocument.
+func (m *Memory) SaveDocument(ctx context.Context, doc *models.Document) (*models.Document, error) {
+	if err := validateDocument(doc.Kind, doc.Content); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(doc.Content)
+	saved := *doc
+	saved.Content = slices.Clone(doc.Content)
+	saved.Size = int64(len(doc.Content))
+	saved.SHA256 = hex.EncodeToString(sum[:])
+	saved.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	saved.Tenant = tenantOf(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved.ID = m.nextID()
+	m.documents = append(m.documents, saved)
+
+	saved.Content = slices.Clone(saved.Content)
+	return &saved, nil
+}
+
+// GetDocument retrieves a document with its content by ID.
+func (m *Memory) GetDocument(ctx context.Context, id int64) (*models.Document, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, doc := range m.documents {
+		if doc.ID == id && visible(ctx, doc.Tenant) {
+			doc.Content = slices.Clone(doc.Content)
+			return &doc, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// ListDocuments retrieves all documents without their content, newest
+// first.
+func (m *Memory) ListDocuments(ctx context.Context) ([]models.Document, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var docs []models.Document
+	for i := len(m.documents) - 1; i >= 0; i-- {
+		doc := m.documents[i]
+		if !visible(ctx, doc.Tenant) {
+			continue
+		}
+		doc.Content = nil
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// DeleteDocument removes a document by ID.
+func (m *Memory) DeleteDocument(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, doc := range m.documents {
+		if doc.ID == id && visible(ctx, doc.Tenant) {
+			m.documents = slices.Delete(m.documents, i, i+1)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// GetInitialDocument loads a document of kind initial as domain
+// configurations.
+func (m *Memory) GetInitialDocument(ctx context.Context, id int64) ([]models.Domain, error) {
+	doc, err := m.documentOfKind(ctx, id, models.DocumentInitial)
+	if err != nil {
+		return nil, err
+	}
+
+	var domains []models.Domain
+	if err := json.Unmarshal(doc.Content, &domains); err != nil {
+		return nil, fmt.Errorf("document %d: %w", id, err)
+	}
+	return domains, nil
+}
+
+// GetResponseDocument loads a document of kind response as a certificate
+// response.
+func (m *Memory) GetResponseDocument(ctx context.Context, id int64) (*models.CertificateResponse, error) {
+	doc, err := m.documentOfKind(ctx, id, models.DocumentResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	var response models.CertificateResponse
+	if err := json.Unmarshal(doc.Content, &response); err != nil {
+		return nil, fmt.Errorf("document %d: %w", id, err)
+	}
+	return &response, nil
+}
+
+func (m *Memory) documentOfKind(ctx context.Context, id int64, kind models.DocumentKind) (*models.Document, error) {
+	doc, err := m.GetDocument(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Kind != kind {
+		return nil, fmt.Errorf("%w: document %d is a %s document, not %s", ErrInvalidDocument, id, doc.Kind, kind)
+	}
+	return doc, nil
+}
+
+// AddSnapshot stores the pre-push state of identity sources and sets the
+// snapshot's ID, creation time and tenant, that of ctx.
+func (m *Memory) AddSnapshot(ctx context.Context, snapshot *models.Snapshot) error {
+	if snapshot.Sources == nil {
+		snapshot.Sources = []models.SnapshotSource{}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var saved models.Snapshot
+	if err := copyJSON(&saved, snapshot); err != nil {
+		return fmt.Errorf("failed to marshal snapshot sources: %w", err)
+	}
+	snapshot.ID = m.nextID()
+	snapshot.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	snapshot.Tenant = tenantOf(ctx)
+	saved.ID, saved.CreatedAt, saved.Tenant = snapshot.ID, snapshot.CreatedAt, snapshot.Tenant
+	m.snapshots = append(m.snapshots, saved)
+	return nil
+}
+
+// GetSnapshot returns a snapshot by ID, or sql.ErrNoRows.
+func (m *Memory) GetSnapshot(ctx context.Context, id int64) (*models.Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.snapshots {
+		if s.ID == id && visible(ctx, s.Tenant) {
+			var snapshot models.Snapshot
+			if err := copyJSON(&snapshot, s); err != nil {
+				return nil, fmt.Errorf("snapshot %d: invalid sources: %w", id, err)
+			}
+			return &snapshot, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// ListSnapshots returns up to limit snapshots, newest first, without the
+// documents of their sources.
+func (m *Memory) ListSnapshots(ctx context.Context, limit int) ([]models.Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshots := []models.Snapshot{}
+	for i := len(m.snapshots) - 1; i >= 0 && len(snapshots) < limit; i-- {
+		s := m.snapshots[i]
+		if !visible(ctx, s.Tenant) {
+			continue
+		}
+		s.Sources = slices.Clone(s.Sources)
+		for j := range s.Sources {
+			s.Sources[j].Source = nil
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, nil
+}
+
+// AddAuditEvent appends an event to the audit log and sets its ID and
+// creation time.
+func (m *Memory) AddAuditEvent(_ context.Context, event *models.AuditEvent) error {
+	if event.SourceIDs == nil {
+		event.SourceIDs = []string{}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event.ID = m.nextID()
+	event.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	saved := *event
+	saved.SourceIDs = slices.Clone(event.SourceIDs)
+	saved.Protected = slices.Clone(event.Protected)
+	m.audit = append(m.audit, saved)
+	return nil
+}
+
+// ListAuditEvents returns the audit events selected by filter, newest
+// first.
+func (m *Memory) ListAuditEvents(_ context.Context, filter AuditFilter) ([]models.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []models.AuditEvent{}
+	for i := len(m.audit) - 1; i >= 0 && len(events) < filter.limit(); i-- {
+		e := m.audit[i]
+		if !filter.match(&e) {
+			continue
+		}
+		e.SourceIDs = slices.Clone(e.SourceIDs)
+		e.Protected = slices.Clone(e.Protected)
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// ListSettings returns the stored runtime settings of the API server,
+// ordered by key.
+func (m *Memory) ListSettings(context.Context) ([]models.Setting, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	settings := []models.Setting{}
+	for _, s := range m.settings {
+		settings = append(settings, s)
+	}
+	slices.SortFunc(settings, func(a, b models.Setting) int { return cmp.Compare(a.Key, b.Key) })
+	return settings, nil
+}
+
+// SaveSettings stores settings, replacing those with the same keys, and
+// sets their update time.
+func (m *Memory) SaveSettings(_ context.Context, settings []models.Setting) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.settings == nil {
+		m.settings = make(map[string]models.Setting)
+	}
+	for i := range settings {
+		settings[i].UpdatedAt = now
+		m.settings[settings[i].Key] = settings[i]
+	}
+	return nil
+}
+
+// AddHealthSnapshot stores a health snapshot and sets its ID. A zero
+// TakenAt is set to the current time.
+func (m *Memory) AddHealthSnapshot(_ context.Context, snapshot *models.HealthSnapshot) error {
+	if snapshot.NSX == nil {
+		snapshot.NSX = []models.NSXSample{}
+	}
+	if snapshot.TakenAt.IsZero() {
+		snapshot.TakenAt = time.Now().UTC().Truncate(time.Second)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved := *snapshot
+	saved.NSX = slices.Clone(snapshot.NSX)
+	snapshot.ID = m.nextID()
+	saved.ID = snapshot.ID
+	m.healthLog = append(m.healthLog, saved)
+	return nil
+}
+
+// ListHealthSnapshots returns up to limit health snapshots taken at or
+// after since, newest first. A zero since returns the latest snapshots.
+func (m *Memory) ListHealthSnapshots(_ context.Context, since time.Time, limit int) ([]models.HealthSnapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshots := []models.HealthSnapshot{}
+	for _, s := range m.healthLog {
+		if s.TakenAt.Before(since) {
+			continue
+		}
+		s.NSX = slices.Clone(s.NSX)
+		snapshots = append(snapshots, s)
+	}
+	slices.SortStableFunc(snapshots, func(a, b models.HealthSnapshot) int {
+		return cmp.Or(b.TakenAt.Compare(a.TakenAt), cmp.Compare(b.ID, a.ID))
+	})
+	return snapshots[:min(len(snapshots), limit)], nil
+}
+
+// UpdateInventory records nothing: Memory has no server inventory.
+func (m *Memory) UpdateInventory(context.Context, string, []models.Domain) (int, error) {
+	return 0, nil
+}
+
+// ListServers returns no servers: Memory has no server inventory.
+func (m *Memory) ListServers(context.Context) ([]models.InventoryServer, error) {
+	return nil, nil
+}
+
+// GetServer returns sql.ErrNoRows: Memory has no server inventory.
+func (m *Memory) GetServer(context.Context, int64) (*models.InventoryServer, error) {
+	return nil, sql.ErrNoRows
+}
+
+// ListProbes returns no probes: Memory has no server inventory.
+func (m *Memory) ListProbes(context.Context, int64, int) ([]models.ProbeRecord, error) {
+	return nil, nil
+}
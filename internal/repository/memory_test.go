@@ -0,0 +1,134 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+)
+
+func TestMemoryTenants(t *testing.T) {
+	repo := repository.NewMemory()
+	ctx := context.Background()
+	teamA := repository.WithTenant(ctx, "team-a")
+	teamB := repository.WithTenant(ctx, "team-b")
+
+	configA, err := repo.SaveConfig(teamA, &models.NSXConfig{Name: "prod", Host: "https://nsx-a", Username: "admin", Password: "secret"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	if _, err := repo.SaveConfig(teamB, &models.NSXConfig{Name: "prod", Host: "https://nsx-b", Username: "admin"}); err != nil {
+		t.Fatalf("SaveConfig with the same name in another tenant failed: %v", err)
+	}
+	if _, err := repo.SaveConfig(teamA, &models.NSXConfig{Name: "prod", Host: "https://nsx-a", Username: "admin"}); err == nil {
+		t.Error("Expected a duplicate name in the same tenant to fail")
+	}
+
+	if _, err := repo.GetConfig(teamB, configA.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows for a config of another tenant, got %v", err)
+	}
+	all, err := repo.ListConfigs(ctx)
+	if err != nil || len(all) != 2 {
+		t.Fatalf("Expected both configs without a tenant, got %d (%v)", len(all), err)
+	}
+	if all[0].Password != "" {
+		t.Error("Expected ListConfigs to leave out passwords")
+	}
+
+	if err := repo.DeleteConfig(teamA, configA.ID); err != nil {
+		t.Fatalf("DeleteConfig failed: %v", err)
+	}
+	if _, err := repo.GetConfig(teamA, configA.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected deleted config to be hidden, got %v", err)
+	}
+	if err := repo.PurgeConfig(teamA, configA.ID); err != nil {
+		t.Errorf("PurgeConfig of a deleted config failed: %v", err)
+	}
+
+	entry, err := repo.SaveHistory(teamA, nil, models.CertificateResponse{}, testDomains())
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	if _, err := repo.GetHistory(teamB, entry.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows for history of another tenant, got %v", err)
+	}
+	summaries, err := repo.ListHistorySummaries(teamA, repository.HistoryFilter{})
+	if err != nil || len(summaries) != 1 || summaries[0].Domains != len(testDomains()) {
+		t.Errorf("Expected the summary of team-a, got %+v (%v)", summaries, err)
+	}
+
+	if err := repo.DeleteHistory(teamB, entry.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows deleting history of another tenant, got %v", err)
+	}
+	if deleted, err := repo.PurgeHistory(teamB, time.Now().Add(time.Minute)); err != nil || deleted != 0 {
+		t.Errorf("Expected no history of team-b purged, got %d (%v)", deleted, err)
+	}
+	if err := repo.DeleteHistory(teamA, entry.ID); err != nil {
+		t.Errorf("DeleteHistory failed: %v", err)
+	}
+
+	doc, err := repo.SaveDocument(teamA, &models.Document{Name: "initial", Kind: models.DocumentInitial, Content: []byte(`[]`)})
+	if err != nil {
+		t.Fatalf("SaveDocument failed: %v", err)
+	}
+	if _, err := repo.GetDocument(teamB, doc.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows for a document of another tenant, got %v", err)
+	}
+	if docs, err := repo.ListDocuments(teamB); err != nil || len(docs) != 0 {
+		t.Errorf("Expected no documents for team-b, got %+v (%v)", docs, err)
+	}
+	if err := repo.DeleteDocument(teamB, doc.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows deleting a document of another tenant, got %v", err)
+	}
+
+	snapshot := &models.Snapshot{Operation: "nsx.push", NSXHost: "https://nsx-a"}
+	if err := repo.AddSnapshot(teamA, snapshot); err != nil || snapshot.Tenant != "team-a" {
+		t.Fatalf("AddSnapshot failed: %+v (%v)", snapshot, err)
+	}
+	if _, err := repo.GetSnapshot(teamB, snapshot.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows for a snapshot of another tenant, got %v", err)
+	}
+	if snapshots, err := repo.ListSnapshots(teamB, 10); err != nil || len(snapshots) != 0 {
+		t.Errorf("Expected no snapshots for team-b, got %+v (%v)", snapshots, err)
+	}
+	if snapshots, err := repo.ListSnapshots(ctx, 10); err != nil || len(snapshots) != 1 {
+		t.Errorf("Expected the snapshot without a tenant, got %+v (%v)", snapshots, err)
+	}
+}
+
+func TestMemoryCopies(t *testing.T) {
+	repo := repository.NewMemory()
+	ctx := context.Background()
+
+	entry, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, testDomains())
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	entry.Result.Data[0].DomainName = "changed"
+
+	stored, err := repo.GetHistory(ctx, entry.ID)
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if stored.Result.Data[0].DomainName == "changed" {
+		t.Error("Expected the stored entry not to change with the returned one")
+	}
+
+	content := json.RawMessage(`{"results":[]}`)
+	doc, err := repo.SaveDocument(ctx, &models.Document{Name: "response", Kind: models.DocumentResponse, Content: content})
+	if err != nil {
+		t.Fatalf("SaveDocument failed: %v", err)
+	}
+	content[2] = 'X'
+	if _, err := repo.GetResponseDocument(ctx, doc.ID); err != nil {
+		t.Errorf("Expected the stored document not to change with its content: %v", err)
+	}
+	if _, err := repo.GetInitialDocument(ctx, doc.ID); !errors.Is(err, repository.ErrInvalidDocument) {
+		t.Errorf("Expected ErrInvalidDocument loading a response as initial, got %v", err)
+	}
+}
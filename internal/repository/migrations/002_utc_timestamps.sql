@@ -0,0 +1,44 @@
+-- Normalize timestamps to RFC3339 UTC ("2006-01-02T15:04:05Z").
+--
+-- Existing rows hold either SQLite CURRENT_TIMESTAMP values
+-- ("2006-01-02 15:04:05", already UTC) or Go time.Time strings written by
+-- older releases ("2006-01-02 15:04:05.999999999 -0700 MST", local zone).
+-- For the latter the numeric offset is spliced in as "+HH:MM" so that
+-- strftime converts the value to UTC.
+
+-- +goose Up
+-- +goose StatementBegin
+UPDATE history
+SET created_at = strftime('%Y-%m-%dT%H:%M:%SZ', created_at)
+WHERE length(created_at) = 19;
+
+UPDATE nsx_configs
+SET created_at = CASE
+    WHEN length(created_at) = 19 THEN strftime('%Y-%m-%dT%H:%M:%SZ', created_at)
+    ELSE strftime('%Y-%m-%dT%H:%M:%SZ',
+        substr(created_at, 1, 19)
+        || substr(substr(created_at, 20), instr(substr(created_at, 20), ' ') + 1, 3)
+        || ':'
+        || substr(substr(created_at, 20), instr(substr(created_at, 20), ' ') + 4, 2))
+END
+WHERE created_at NOT LIKE '____-__-__T__:__:__Z';
+
+UPDATE nsx_configs
+SET updated_at = CASE
+    WHEN length(updated_at) = 19 THEN strftime('%Y-%m-%dT%H:%M:%SZ', updated_at)
+    ELSE strftime('%Y-%m-%dT%H:%M:%SZ',
+        substr(updated_at, 1, 19)
+        || substr(substr(updated_at, 20), instr(substr(updated_at, 20), ' ') + 1, 3)
+        || ':'
+        || substr(substr(updated_at, 20), instr(substr(updated_at, 20), ' ') + 4, 2))
+END
+WHERE updated_at NOT LIKE '____-__-__T__:__:__Z';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+UPDATE history SET created_at = strftime('%Y-%m-%d %H:%M:%S', created_at);
+UPDATE nsx_configs SET
+    created_at = strftime('%Y-%m-%d %H:%M:%S', created_at),
+    updated_at = strftime('%Y-%m-%d %H:%M:%S', updated_at);
+-- +goose StatementEnd
@@ -0,0 +1,55 @@
+-- Soft delete for NSX configurations.
+--
+-- The table is rebuilt because the column-level UNIQUE constraint on name
+-- cannot be dropped in SQLite; uniqueness is now enforced only among
+-- configurations that have not been deleted.
+
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE nsx_configs_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT,
+    host TEXT NOT NULL,
+    username TEXT NOT NULL,
+    password TEXT,
+    insecure INTEGER DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME
+);
+
+INSERT INTO nsx_configs_new (id, name, description, host, username, password, insecure, created_at, updated_at)
+SELECT id, name, description, host, username, password, insecure, created_at, updated_at FROM nsx_configs;
+
+DROP INDEX IF EXISTS idx_nsx_configs_name;
+DROP TABLE nsx_configs;
+ALTER TABLE nsx_configs_new RENAME TO nsx_configs;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_nsx_configs_name ON nsx_configs(name) WHERE deleted_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE TABLE nsx_configs_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+    host TEXT NOT NULL,
+    username TEXT NOT NULL,
+    password TEXT,
+    insecure INTEGER DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO nsx_configs_old (id, name, description, host, username, password, insecure, created_at, updated_at)
+SELECT id, name, description, host, username, password, insecure, created_at, updated_at
+FROM nsx_configs WHERE deleted_at IS NULL;
+
+DROP INDEX IF EXISTS idx_nsx_configs_name;
+DROP TABLE nsx_configs;
+ALTER TABLE nsx_configs_old RENAME TO nsx_configs;
+
+CREATE INDEX IF NOT EXISTS idx_nsx_configs_name ON nsx_configs(name);
+-- +goose StatementEnd
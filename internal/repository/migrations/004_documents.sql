@@ -0,0 +1,23 @@
+-- Uploaded initial and response documents, referenced by ID from merge and
+-- sync requests so large payloads are not resent on every call.
+
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS documents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('initial', 'response')),
+    content TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    sha256 TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_documents_kind ON documents(kind);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_documents_kind;
+DROP TABLE IF EXISTS documents;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- History data stored in an external object store.
+--
+-- When artifact_key is set, initial/response/result are empty and the JSON
+-- lives under that key prefix in the configured artifact store.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE history ADD COLUMN artifact_key TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE history DROP COLUMN artifact_key;
+-- +goose StatementEnd
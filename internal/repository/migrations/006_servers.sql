@@ -0,0 +1,29 @@
+-- LDAP server inventory, populated from NSX pulls and probes.
+
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS servers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    nsx_host TEXT NOT NULL,
+    domain_id TEXT NOT NULL,
+    url TEXT NOT NULL,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    cert_fingerprint TEXT,
+    cert_subject TEXT,
+    cert_expires_at DATETIME,
+    last_probe_at DATETIME,
+    last_probe_ok INTEGER,
+    last_probe_error TEXT,
+    first_seen_at DATETIME NOT NULL,
+    last_seen_at DATETIME NOT NULL,
+    UNIQUE (nsx_host, domain_id, url)
+);
+
+CREATE INDEX IF NOT EXISTS idx_servers_url ON servers(url);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_servers_url;
+DROP TABLE IF EXISTS servers;
+-- +goose StatementEnd
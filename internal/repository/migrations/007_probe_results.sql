@@ -0,0 +1,24 @@
+-- Probe history for the server inventory, written by nsx probe and the
+-- server's scheduled prober.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE servers ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS probe_results (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    server_id INTEGER NOT NULL REFERENCES servers(id) ON DELETE CASCADE,
+    probed_at DATETIME NOT NULL,
+    success INTEGER NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_probe_results_server ON probe_results(server_id, probed_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_probe_results_server;
+DROP TABLE IF EXISTS probe_results;
+ALTER TABLE servers DROP COLUMN consecutive_failures;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- Merge timing and matching statistics per history entry, as JSON.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE history ADD COLUMN stats TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE history DROP COLUMN stats;
+-- +goose StatementEnd
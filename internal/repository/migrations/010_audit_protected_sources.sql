@@ -0,0 +1,11 @@
+-- Protected identity sources targeted by an audited change, as a JSON array.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE audit_log ADD COLUMN protected_source_ids TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE audit_log DROP COLUMN protected_source_ids;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- State of NSX identity sources captured before each push, for rollback.
+
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL,
+    history_id INTEGER REFERENCES history(id) ON DELETE SET NULL,
+    operation TEXT NOT NULL,
+    nsx_host TEXT NOT NULL,
+    sources TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_snapshots_history ON snapshots(history_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_snapshots_history;
+DROP TABLE IF EXISTS snapshots;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- Encoding of the history data ('zstd' or NULL for plain JSON) and its
+-- uncompressed size in bytes.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE history ADD COLUMN encoding TEXT;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE history ADD COLUMN size INTEGER;
+-- +goose StatementEnd
+-- +goose StatementBegin
+UPDATE history SET size = length(CAST(initial AS BLOB)) + length(CAST(response AS BLOB)) + length(CAST(result AS BLOB));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE history DROP COLUMN size;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE history DROP COLUMN encoding;
+-- +goose StatementEnd
@@ -0,0 +1,36 @@
+-- Domain, LDAP server and certificate counts of the merged result, so that
+-- history can be listed without reading the data.
+--
+-- Counts are filled in for rows stored as plain JSON; for compressed rows and
+-- rows in an artifact store they are computed and saved when first listed.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE history ADD COLUMN domains INTEGER;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE history ADD COLUMN servers INTEGER;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE history ADD COLUMN certificates INTEGER;
+-- +goose StatementEnd
+-- +goose StatementBegin
+UPDATE history SET
+    domains = json_array_length(result),
+    servers = (SELECT COUNT(*) FROM json_each(history.result) d, json_each(d.value, '$.ldap_servers') s
+               WHERE s.type = 'object'),
+    certificates = (SELECT COUNT(*) FROM json_each(history.result) d, json_each(d.value, '$.ldap_servers') s,
+                    json_each(s.value, '$.certificates') c WHERE s.type = 'object' AND c.type = 'text')
+WHERE encoding IS NULL AND artifact_key IS NULL AND json_valid(result) AND json_type(result) = 'array';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE history DROP COLUMN certificates;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE history DROP COLUMN servers;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE history DROP COLUMN domains;
+-- +goose StatementEnd
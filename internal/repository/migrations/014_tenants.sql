@@ -0,0 +1,29 @@
+-- Tenant of NSX configurations and history entries, so that API keys bound
+-- to a tenant see only its rows. Existing rows belong to the default tenant
+-- (''). Configuration names are unique per tenant.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE nsx_configs ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE history ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_nsx_configs_name;
+CREATE UNIQUE INDEX idx_nsx_configs_name ON nsx_configs(tenant, name) WHERE deleted_at IS NULL;
+CREATE INDEX idx_history_tenant ON history(tenant, created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_history_tenant;
+DROP INDEX IF EXISTS idx_nsx_configs_name;
+CREATE UNIQUE INDEX idx_nsx_configs_name ON nsx_configs(name) WHERE deleted_at IS NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE history DROP COLUMN tenant;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE nsx_configs DROP COLUMN tenant;
+-- +goose StatementEnd
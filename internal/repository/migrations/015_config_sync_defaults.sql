@@ -0,0 +1,13 @@
+-- Default sync options of NSX configurations (dry run, merge strategy,
+-- domain filter, canary source) as JSON, used by syncs and pushes to the
+-- manager that do not set them. NULL means no defaults.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE nsx_configs ADD COLUMN sync_defaults TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE nsx_configs DROP COLUMN sync_defaults;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- Run ID of the merge or sync that recorded history entries and audit
+-- events, also logged with every record of the run and sent to NSX as the
+-- prefix of its request ids. NULL for rows recorded without one.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE history ADD COLUMN run_id TEXT;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE audit_log ADD COLUMN run_id TEXT;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX idx_history_run_id ON history(run_id) WHERE run_id IS NOT NULL;
+CREATE INDEX idx_audit_log_run_id ON audit_log(run_id) WHERE run_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_audit_log_run_id;
+DROP INDEX IF EXISTS idx_history_run_id;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE audit_log DROP COLUMN run_id;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE history DROP COLUMN run_id;
+-- +goose StatementEnd
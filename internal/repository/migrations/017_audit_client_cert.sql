@@ -0,0 +1,12 @@
+-- Subject of the TLS client certificate of API changes made over mutual
+-- TLS. NULL for other changes.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE audit_log ADD COLUMN client_cert TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE audit_log DROP COLUMN client_cert;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- Method, path, response status and body SHA-256 of API requests recorded
+-- as api.request events. NULL for other events.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE audit_log ADD COLUMN method TEXT;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE audit_log ADD COLUMN path TEXT;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE audit_log ADD COLUMN status INTEGER;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE audit_log ADD COLUMN body_sha256 TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE audit_log DROP COLUMN body_sha256;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE audit_log DROP COLUMN status;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE audit_log DROP COLUMN path;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE audit_log DROP COLUMN method;
+-- +goose StatementEnd
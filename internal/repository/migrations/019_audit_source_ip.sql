@@ -0,0 +1,25 @@
+-- IP address of the client of API changes, as seen by the server (behind a
+-- reverse proxy, the proxy). NULL for CLI changes. Actors and operations are
+-- indexed for GET /api/audit filters.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE audit_log ADD COLUMN source_ip TEXT;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX idx_audit_log_actor ON audit_log(actor) WHERE actor IS NOT NULL;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX idx_audit_log_operation ON audit_log(operation);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_audit_log_operation;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_audit_log_actor;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE audit_log DROP COLUMN source_ip;
+-- +goose StatementEnd
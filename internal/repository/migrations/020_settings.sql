@@ -0,0 +1,18 @@
+-- Runtime settings of the API server changed through PATCH
+-- /api/admin/settings, applied again when the server starts. Values are
+-- text in the format of the API.
+
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at DATETIME NOT NULL,
+    updated_by TEXT
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS settings;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- Periodic snapshots of the health of the API server: the database and
+-- the reachability of each saved NSX Manager, kept as JSON.
+
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS health_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    taken_at DATETIME NOT NULL,
+    db_ok INTEGER NOT NULL,
+    db_error TEXT,
+    db_size INTEGER NOT NULL,
+    history_count INTEGER NOT NULL,
+    nsx TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_health_snapshots_taken_at ON health_snapshots(taken_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_health_snapshots_taken_at;
+DROP TABLE IF EXISTS health_snapshots;
+-- +goose StatementEnd
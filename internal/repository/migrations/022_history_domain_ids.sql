@@ -0,0 +1,28 @@
+-- IDs of the domains in the merged result, as a JSON array, so that history
+-- can be filtered by domain without reading the data.
+--
+-- IDs are filled in for rows stored as plain JSON; for compressed rows and
+-- rows in an artifact store they are computed and saved when first listed,
+-- with the counts of 013_history_counts.sql; the partial index finds them.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE history ADD COLUMN domain_ids TEXT;
+-- +goose StatementEnd
+-- +goose StatementBegin
+UPDATE history SET
+    domain_ids = (SELECT json_group_array(json_extract(d.value, '$.id')) FROM json_each(history.result) d
+                  WHERE d.type = 'object' AND json_type(d.value, '$.id') = 'text')
+WHERE encoding IS NULL AND artifact_key IS NULL AND json_valid(result) AND json_type(result) = 'array';
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX idx_history_unsummarized ON history(id) WHERE domain_ids IS NULL OR domains IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_history_unsummarized;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE history DROP COLUMN domain_ids;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- Number of certificates configured for each inventory server, for the
+-- per-domain certificate metrics. Servers with a leaf certificate count one
+-- until the next pull records the full count.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE servers ADD COLUMN cert_count INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+-- +goose StatementBegin
+UPDATE servers SET cert_count = 1 WHERE cert_fingerprint IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE servers DROP COLUMN cert_count;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- Tenant of uploaded documents and snapshots, so that API keys bound to a
+-- tenant see only their own. Existing documents belong to the default
+-- tenant (''); snapshots belong to the tenant of their history entry.
+
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE documents ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE snapshots ADD COLUMN tenant TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+-- +goose StatementBegin
+UPDATE snapshots SET tenant = COALESCE((SELECT tenant FROM history WHERE history.id = snapshots.history_id), '')
+ WHERE history_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE snapshots DROP COLUMN tenant;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE documents DROP COLUMN tenant;
+-- +goose StatementEnd
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pressly/goose/v3"
+)
+
+func TestMigrateLegacyTimestamps(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "legacy.db")
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	goose.SetBaseFS(migrationsFS)
+	if err := goose.SetDialect("sqlite3"); err != nil {
+		t.Fatalf("Failed to set dialect: %v", err)
+	}
+	if err := goose.UpTo(db, "migrations", 1); err != nil {
+		t.Fatalf("Failed to migrate to version 1: %v", err)
+	}
+
+	// Rows as written by releases before timestamps were normalized
+	_, err = db.ExecContext(ctx, `INSERT INTO history (created_at, initial, response, result) VALUES ('2025-12-17 10:30:00', '[]', '{}', '[]')`)
+	if err != nil {
+		t.Fatalf("Failed to insert legacy history: %v", err)
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO nsx_configs (name, host, username, created_at, updated_at)
+		VALUES ('lab', 'https://nsx', 'admin', '2025-12-17 13:30:00.123456789 +0300 MSK', '2025-12-17 10:30:00')`)
+	if err != nil {
+		t.Fatalf("Failed to insert legacy config: %v", err)
+	}
+	_ = db.Close()
+
+	repo, err := New(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	want := time.Date(2025, 12, 17, 10, 30, 0, 0, time.UTC)
+
+	entry, err := repo.GetHistory(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if !entry.CreatedAt.Equal(want) {
+		t.Errorf("Expected history created_at %v, got %v", want, entry.CreatedAt)
+	}
+
+	config, err := repo.GetConfigByName(ctx, "lab")
+	if err != nil {
+		t.Fatalf("GetConfigByName failed: %v", err)
+	}
+	if !config.CreatedAt.Equal(want) {
+		t.Errorf("Expected config created_at %v, got %v", want, config.CreatedAt)
+	}
+	if !config.UpdatedAt.Equal(want) {
+		t.Errorf("Expected config updated_at %v, got %v", want, config.UpdatedAt)
+	}
+}
+
+func TestImportFromLegacy(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// Layout created by releases before versioned migrations
+	src, err := sql.Open("sqlite", filepath.Join(dir, "old.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE history (id INTEGER PRIMARY KEY AUTOINCREMENT, created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			initial TEXT NOT NULL, response TEXT NOT NULL, result TEXT NOT NULL)`,
+		`CREATE TABLE nsx_configs (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE, description TEXT,
+			host TEXT NOT NULL, username TEXT NOT NULL, password TEXT, insecure INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP, updated_at DATETIME DEFAULT CURRENT_TIMESTAMP)`,
+		`INSERT INTO history (created_at, initial, response, result) VALUES ('2025-12-17 10:30:00', '[]', '{}', '[]')`,
+		`INSERT INTO history (created_at, initial, response, result) VALUES ('2025-12-17 13:31:00.5 +0300 MSK', '[]', '{}', '[{"id":"example.lab"}]')`,
+		`INSERT INTO nsx_configs (name, host, username, created_at, updated_at) VALUES ('lab', 'https://nsx', 'admin', '2025-12-17 10:30:00', '2025-12-17 10:30:00')`,
+		`INSERT INTO nsx_configs (name, host, username) VALUES ('prod', 'https://nsx-prod', 'admin')`,
+	} {
+		if _, err := src.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("Failed to build legacy database: %v", err)
+		}
+	}
+	_ = src.Close()
+
+	repo, err := New(filepath.Join(dir, "new.db"))
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	// Already present: same timestamp and content, and a config with the same name
+	if _, err := repo.sqlDB().ExecContext(ctx, `INSERT INTO history (created_at, initial, response, result) VALUES ('2025-12-17T10:30:00Z', '[]', '{}', '[]')`); err != nil {
+		t.Fatalf("Failed to insert history: %v", err)
+	}
+	if _, err := repo.sqlDB().ExecContext(ctx, `INSERT INTO nsx_configs (name, host, username, created_at, updated_at) VALUES ('lab', 'https://nsx', 'admin', '2025-12-17T10:30:00Z', '2025-12-17T10:30:00Z')`); err != nil {
+		t.Fatalf("Failed to insert config: %v", err)
+	}
+
+	dry, err := repo.ImportFrom(ctx, filepath.Join(dir, "old.db"), true)
+	if err != nil {
+		t.Fatalf("ImportFrom (dry run) failed: %v", err)
+	}
+	if dry.HistoryImported != 1 {
+		t.Errorf("Expected dry run to report 1 history entry, got %d", dry.HistoryImported)
+	}
+	if entries, _ := repo.ListHistory(ctx, HistoryFilter{}); len(entries) != 1 {
+		t.Errorf("Expected dry run to leave 1 history entry, got %d", len(entries))
+	}
+
+	res, err := repo.ImportFrom(ctx, filepath.Join(dir, "old.db"), false)
+	if err != nil {
+		t.Fatalf("ImportFrom failed: %v", err)
+	}
+	if res.SourceVersion != 0 {
+		t.Errorf("Expected pre-goose source version 0, got %d", res.SourceVersion)
+	}
+	if res.HistoryImported != 1 || res.HistorySkipped != 1 {
+		t.Errorf("Expected 1 history imported and 1 skipped, got %+v", res)
+	}
+	if res.ConfigsImported != 1 || res.ConfigsSkipped != 1 {
+		t.Errorf("Expected 1 config imported and 1 skipped, got %+v", res)
+	}
+
+	entries, err := repo.ListHistory(ctx, HistoryFilter{})
+	if err != nil {
+		t.Fatalf("ListHistory failed: %v", err)
+	}
+	want := time.Date(2025, 12, 17, 10, 31, 0, 500000000, time.UTC).Truncate(time.Second)
+	if len(entries) != 2 || !entries[0].CreatedAt.Truncate(time.Second).Equal(want) {
+		t.Errorf("Expected imported entry at %v, got %+v", want, entries)
+	}
+
+	// Importing again is a no-op
+	again, err := repo.ImportFrom(ctx, filepath.Join(dir, "old.db"), false)
+	if err != nil {
+		t.Fatalf("Second ImportFrom failed: %v", err)
+	}
+	if again.HistoryImported != 0 || again.ConfigsImported != 0 {
+		t.Errorf("Expected second import to skip everything, got %+v", again)
+	}
+}
+
+func TestMigrateHistoryCounts(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "counts.db")
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	goose.SetBaseFS(migrationsFS)
+	if err := goose.SetDialect("sqlite3"); err != nil {
+		t.Fatalf("Failed to set dialect: %v", err)
+	}
+	if err := goose.UpTo(db, "migrations", 12); err != nil {
+		t.Fatalf("Failed to migrate to version 12: %v", err)
+	}
+
+	result := `[{"id":"example.lab","ldap_servers":[{"url":"ldaps://ad-01","certificates":["a","b"]},{"url":"ldaps://ad-02"}]},
+		{"id":"example.org","ldap_servers":null}]`
+	_, err = db.ExecContext(ctx, `INSERT INTO history (created_at, initial, response, result) VALUES ('2025-12-17T10:30:00Z', '[]', '{}', ?)`, result)
+	if err != nil {
+		t.Fatalf("Failed to insert history: %v", err)
+	}
+	_ = db.Close()
+
+	repo, err := New(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	var domains, servers, certificates int
+	err = repo.sqlDB().QueryRowContext(ctx, `SELECT domains, servers, certificates FROM history`).Scan(&domains, &servers, &certificates)
+	if err != nil {
+		t.Fatalf("Failed to read counts: %v", err)
+	}
+	if domains != 2 || servers != 2 || certificates != 2 {
+		t.Errorf("Expected 2 domains, 2 servers and 2 certificates, got %d, %d and %d", domains, servers, certificates)
+	}
+}
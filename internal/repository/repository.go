@@ -2,17 +2,28 @@ package repository
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"embed"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/pressly/goose/v3"
 	_ "modernc.org/sqlite" // SQLite driver for database/sql
 
+	"ldapmerge/internal/artifacts"
 	"ldapmerge/internal/models"
+	"ldapmerge/internal/runid"
 )
 
 //go:embed migrations/*.sql
@@ -20,65 +31,172 @@ var migrationsFS embed.FS
 
 // Repository handles database operations.
 type Repository struct {
-	db     *sql.DB
-	dbPath string
+	dbPath    string
+	opts      Options
+	artifacts artifacts.Store
+
+	// The database and its statements are replaced when it is reopened
+	mu      sync.RWMutex
+	db      *sql.DB
+	stmts   *statements
+	health  Health
+	closing bool
 }
 
-// New creates a new repository with the given database path.
+// Options holds connection pool and SQLite tuning settings.
+type Options struct {
+	MaxOpenConns    int             // Max open connections (default: 4)
+	MaxIdleConns    int             // Max idle connections (default: 4)
+	ConnMaxIdleTime time.Duration   // Max time a connection may sit idle (default: 5m)
+	BusyTimeout     time.Duration   // How long SQLite waits on a locked database (default: 5s)
+	Synchronous     string          // PRAGMA synchronous value: OFF, NORMAL, FULL, EXTRA (default: NORMAL)
+	Artifacts       artifacts.Store // Object store for history data (default: nil, stored inline)
+}
+
+// DefaultOptions returns default repository options.
+func DefaultOptions() Options {
+	return Options{
+		MaxOpenConns:    4,
+		MaxIdleConns:    4,
+		ConnMaxIdleTime: 5 * time.Minute,
+		BusyTimeout:     5 * time.Second,
+		Synchronous:     "NORMAL",
+	}
+}
+
+// dsn builds the SQLite data source name. Pragmas are passed through the DSN
+// so that every pooled connection gets them, not just the first one.
+func (o Options) dsn(dbPath string) string {
+	q := url.Values{}
+	q.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", o.BusyTimeout.Milliseconds()))
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", fmt.Sprintf("synchronous(%s)", o.Synchronous))
+
+	sep := "?"
+	if strings.Contains(dbPath, "?") {
+		sep = "&"
+	}
+	return dbPath + sep + q.Encode()
+}
+
+// validate checks option values.
+func (o Options) validate() error {
+	switch strings.ToUpper(o.Synchronous) {
+	case "OFF", "NORMAL", "FULL", "EXTRA":
+	default:
+		return fmt.Errorf("invalid synchronous mode %q", o.Synchronous)
+	}
+	if o.BusyTimeout < 0 {
+		return fmt.Errorf("invalid busy timeout %s", o.BusyTimeout)
+	}
+	return nil
+}
+
+// New creates a new repository with the given database path and default options.
 func New(dbPath string) (*Repository, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	return NewWithOptions(dbPath, DefaultOptions())
+}
+
+// NewWithOptions creates a new repository with the given database path and options.
+func NewWithOptions(dbPath string, opts Options) (*Repository, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	db, stmts, err := open(dbPath, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
-	// Enable WAL mode for better concurrency
+	return &Repository{
+		dbPath:    dbPath,
+		opts:      opts,
+		artifacts: opts.Artifacts,
+		db:        db,
+		stmts:     stmts,
+		health:    Health{OK: true, CheckedAt: time.Now().UTC()},
+	}, nil
+}
+
+// open opens and migrates the database and prepares its statements.
+func open(dbPath string, opts Options) (*sql.DB, *statements, error) {
+	db, err := sql.Open("sqlite", opts.dsn(dbPath))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+
+	// Enable WAL mode for better concurrency (persisted in the database file)
 	if _, err := db.ExecContext(context.Background(), "PRAGMA journal_mode=WAL"); err != nil {
 		_ = db.Close()
-		return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
+		return nil, nil, fmt.Errorf("failed to enable WAL mode: %w", err)
 	}
 
-	// Enable foreign keys
-	if _, err := db.ExecContext(context.Background(), "PRAGMA foreign_keys=ON"); err != nil {
+	if err := migrate(db); err != nil {
 		_ = db.Close()
-		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
+		return nil, nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
-	repo := &Repository{db: db, dbPath: dbPath}
-
-	if err := repo.migrate(); err != nil {
+	stmts, err := prepareStatements(context.Background(), db)
+	if err != nil {
 		_ = db.Close()
-		return nil, fmt.Errorf("failed to run migrations: %w", err)
+		return nil, nil, fmt.Errorf("failed to prepare statements: %w", err)
 	}
 
-	return repo, nil
+	return db, stmts, nil
 }
 
 // migrate runs database migrations.
-func (r *Repository) migrate() error {
+func migrate(db *sql.DB) error {
 	goose.SetBaseFS(migrationsFS)
 
 	if err := goose.SetDialect("sqlite3"); err != nil {
 		return err
 	}
 
-	return goose.Up(r.db, "migrations")
+	return goose.Up(db, "migrations")
+}
+
+// sqlDB returns the current database connection pool.
+func (r *Repository) sqlDB() *sql.DB {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.db
+}
+
+// statements returns the prepared statements of the current database.
+func (r *Repository) statements() *statements {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.stmts
 }
 
-// Close closes the database connection.
+// Close closes prepared statements and the database connection.
 func (r *Repository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closing = true
+	if r.stmts != nil {
+		r.stmts.close()
+	}
 	return r.db.Close()
 }
 
 // DBInfo contains database information.
 type DBInfo struct {
-	Path         string `json:"path"`
-	Size         int64  `json:"size"`
-	SizeHuman    string `json:"size_human"`
-	Version      string `json:"version"`
-	Tables       int    `json:"tables"`
-	WALMode      bool   `json:"wal_mode"`
-	HistoryCount int64  `json:"history_count"`
-	ConfigCount  int64  `json:"config_count"`
+	Path          string `json:"path"`
+	Size          int64  `json:"size"`
+	SizeHuman     string `json:"size_human"`
+	Version       string `json:"version"`
+	Tables        int    `json:"tables"`
+	WALMode       bool   `json:"wal_mode"`
+	HistoryCount  int64  `json:"history_count"`
+	ConfigCount   int64  `json:"config_count"`
+	DocumentCount int64  `json:"document_count"`
 }
 
 // GetDBInfo returns database information
@@ -88,36 +206,42 @@ func (r *Repository) GetDBInfo(ctx context.Context) (*DBInfo, error) {
 	}
 
 	// Get SQLite version
-	row := r.db.QueryRowContext(ctx, "SELECT sqlite_version()")
+	row := r.sqlDB().QueryRowContext(ctx, "SELECT sqlite_version()")
 	if err := row.Scan(&info.Version); err != nil {
 		info.Version = "unknown"
 	}
 
 	// Get journal mode (WAL or not)
 	var journalMode string
-	row = r.db.QueryRowContext(ctx, "PRAGMA journal_mode")
+	row = r.sqlDB().QueryRowContext(ctx, "PRAGMA journal_mode")
 	if err := row.Scan(&journalMode); err == nil {
 		info.WALMode = journalMode == "wal"
 	}
 
 	// Get table count
-	row = r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' AND name NOT LIKE 'goose_%'")
+	row = r.sqlDB().QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' AND name NOT LIKE 'goose_%'")
 	if err := row.Scan(&info.Tables); err != nil {
 		info.Tables = 0
 	}
 
 	// Get history count
-	row = r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM history")
+	row = r.sqlDB().QueryRowContext(ctx, "SELECT COUNT(*) FROM history")
 	if err := row.Scan(&info.HistoryCount); err != nil {
 		info.HistoryCount = 0
 	}
 
 	// Get config count
-	row = r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM nsx_configs")
+	row = r.sqlDB().QueryRowContext(ctx, "SELECT COUNT(*) FROM nsx_configs WHERE deleted_at IS NULL")
 	if err := row.Scan(&info.ConfigCount); err != nil {
 		info.ConfigCount = 0
 	}
 
+	// Get document count
+	row = r.sqlDB().QueryRowContext(ctx, "SELECT COUNT(*) FROM documents")
+	if err := row.Scan(&info.DocumentCount); err != nil {
+		info.DocumentCount = 0
+	}
+
 	// Get file size
 	if fileInfo, err := os.Stat(r.dbPath); err == nil {
 		info.Size = fileInfo.Size()
@@ -141,8 +265,36 @@ func formatBytes(b int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
 }
 
-// SaveHistory saves a merge operation to history
+// formatTimestamp formats a time for storage as an RFC3339 UTC string.
+// The fixed-width layout keeps lexical and chronological order identical.
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseTimestamp parses a stored RFC3339 timestamp.
+func parseTimestamp(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q: %w", s, err)
+	}
+	return t.UTC(), nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// SaveHistory saves a merge operation to history. With an artifact store
+// configured, the JSON is uploaded there and only its key is stored in the row;
+// otherwise large JSON is stored zstd-compressed.
 func (r *Repository) SaveHistory(ctx context.Context, initial []models.Domain, response models.CertificateResponse, result []models.Domain) (*models.HistoryEntry, error) {
+	return r.SaveHistoryWithStats(ctx, initial, response, result, nil)
+}
+
+// SaveHistoryWithStats saves a merge operation with its statistics. The
+// input size is filled in from the stored JSON.
+func (r *Repository) SaveHistoryWithStats(ctx context.Context, initial []models.Domain, response models.CertificateResponse, result []models.Domain, stats *models.MergeStats) (*models.HistoryEntry, error) {
 	initialJSON, err := json.Marshal(initial)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal initial: %w", err)
@@ -158,55 +310,251 @@ func (r *Repository) SaveHistory(ctx context.Context, initial []models.Domain, r
 		return nil, fmt.Errorf("failed to marshal result: %w", err)
 	}
 
-	res, err := r.db.ExecContext(ctx,
-		`INSERT INTO history (initial, response, result) VALUES (?, ?, ?)`,
-		string(initialJSON), string(responseJSON), string(resultJSON),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to insert history: %w", err)
+	var statsJSON sql.NullString
+	if stats != nil {
+		stats.InputBytes = int64(len(initialJSON) + len(responseJSON))
+		data, err := json.Marshal(stats)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal stats: %w", err)
+		}
+		statsJSON = sql.NullString{String: string(data), Valid: true}
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	entry := &models.HistoryEntry{
+		CreatedAt: now,
+		Initial:   models.JSON[[]models.Domain]{Data: initial},
+		Response:  models.JSON[models.CertificateResponse]{Data: response},
+		Result:    models.JSON[[]models.Domain]{Data: result},
+		Stats:     stats,
+		Size:      int64(len(initialJSON) + len(responseJSON) + len(resultJSON)),
+		Tenant:    tenantOf(ctx),
 	}
+	entry.RunID, _ = runid.From(ctx)
 
-	id, err := res.LastInsertId()
+	var artifactKey sql.NullString
+	if r.artifacts != nil {
+		key, err := newArtifactKey(now)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, data := range map[string][]byte{"initial": initialJSON, "response": responseJSON, "result": resultJSON} {
+			if err := r.artifacts.Put(ctx, key+"/"+name+".json", data); err != nil {
+				return nil, fmt.Errorf("failed to upload %s artifact: %w", name, err)
+			}
+		}
+
+		entry.ArtifactKey = key
+		artifactKey = sql.NullString{String: key, Valid: true}
+		initialJSON, responseJSON, resultJSON = nil, nil, nil
+	}
+
+	columns, encoding := encodeHistory(initialJSON, responseJSON, resultJSON)
+	summary := entry.Summary()
+	err = r.statements().insertHistory.QueryRowContext(ctx,
+		formatTimestamp(now), columns[0], columns[1], columns[2], artifactKey, statsJSON, encoding, entry.Size,
+		summary.Domains, summary.Servers, summary.Certificates, entry.Tenant, nullString(entry.RunID), domainIDs(result),
+	).Scan(&entry.ID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get last insert id: %w", err)
+		return nil, fmt.Errorf("failed to insert history: %w", err)
 	}
 
-	return r.GetHistory(ctx, id)
+	return entry, nil
 }
 
-// GetHistory retrieves a history entry by ID
-func (r *Repository) GetHistory(ctx context.Context, id int64) (*models.HistoryEntry, error) {
-	row := r.db.QueryRowContext(ctx,
-		`SELECT id, created_at, initial, response, result FROM history WHERE id = ?`, id)
+// newArtifactKey returns a unique key prefix for a history entry's artifacts.
+func newArtifactKey(t time.Time) (string, error) {
+	var suffix [4]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", fmt.Errorf("failed to generate artifact key: %w", err)
+	}
+	return "history/" + t.Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix[:]), nil
+}
 
+// scanHistory scans a history row into an entry, decompressing its data.
+// Entries stored in the artifact store are returned with ArtifactKey set and
+// no data.
+func scanHistory(row rowScanner) (*models.HistoryEntry, error) {
 	var entry models.HistoryEntry
-	var initialStr, responseStr, resultStr string
+	var initial, response, result []byte
 	var createdAt string
+	var artifactKey, stats, encoding, runID sql.NullString
+	var size sql.NullInt64
 
-	err := row.Scan(&entry.ID, &createdAt, &initialStr, &responseStr, &resultStr)
-	if err != nil {
+	if err := row.Scan(&entry.ID, &createdAt, &initial, &response, &result, &artifactKey, &stats, &encoding, &size, &entry.Tenant, &runID); err != nil {
 		return nil, err
 	}
+	entry.Size = size.Int64
+	entry.RunID = runID.String
+
+	var err error
+	if entry.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return nil, fmt.Errorf("history %d: %w", entry.ID, err)
+	}
 
-	entry.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+	if stats.Valid {
+		entry.Stats = &models.MergeStats{}
+		if err := json.Unmarshal([]byte(stats.String), entry.Stats); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stats: %w", err)
+		}
+	}
 
-	if err := json.Unmarshal([]byte(initialStr), &entry.Initial.Data); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal initial: %w", err)
+	if artifactKey.Valid {
+		entry.ArtifactKey = artifactKey.String
+		return &entry, nil
 	}
-	if err := json.Unmarshal([]byte(responseStr), &entry.Response.Data); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+
+	columns := [][]byte{initial, response, result}
+	for i, data := range columns {
+		decoded, err := decodeHistory(encoding.String, data)
+		if err != nil {
+			return nil, fmt.Errorf("history %d: %w", entry.ID, err)
+		}
+		columns[i] = decoded
 	}
-	if err := json.Unmarshal([]byte(resultStr), &entry.Result.Data); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	if err := unmarshalHistory(&entry, columns[0], columns[1], columns[2]); err != nil {
+		return nil, err
 	}
 
 	return &entry, nil
 }
 
-// ListHistory retrieves all history entries
-func (r *Repository) ListHistory(ctx context.Context) ([]models.HistoryEntry, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, created_at, initial, response, result FROM history ORDER BY created_at DESC LIMIT 100`)
+func unmarshalHistory(entry *models.HistoryEntry, initial, response, result []byte) error {
+	if err := json.Unmarshal(initial, &entry.Initial.Data); err != nil {
+		return fmt.Errorf("failed to unmarshal initial: %w", err)
+	}
+	if err := json.Unmarshal(response, &entry.Response.Data); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	if err := json.Unmarshal(result, &entry.Result.Data); err != nil {
+		return fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+	return nil
+}
+
+// loadArtifacts downloads the data of an entry kept in the artifact store.
+func (r *Repository) loadArtifacts(ctx context.Context, entry *models.HistoryEntry) error {
+	if entry.ArtifactKey == "" {
+		return nil
+	}
+	if r.artifacts == nil {
+		return fmt.Errorf("history %d is stored in an artifact store, but none is configured", entry.ID)
+	}
+
+	var data [3][]byte
+	for i, name := range []string{"initial", "response", "result"} {
+		b, err := r.artifacts.Get(ctx, entry.ArtifactKey+"/"+name+".json")
+		if err != nil {
+			return fmt.Errorf("history %d: failed to download %s artifact: %w", entry.ID, name, err)
+		}
+		data[i] = b
+	}
+
+	return unmarshalHistory(entry, data[0], data[1], data[2])
+}
+
+// GetHistory retrieves a history entry by ID
+func (r *Repository) GetHistory(ctx context.Context, id int64) (*models.HistoryEntry, error) {
+	entry, err := scanHistory(r.statements().getHistory.QueryRowContext(ctx, tenantArgs(ctx, id)...))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadArtifacts(ctx, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// DefaultHistoryLimit is the number of history entries listed when
+// HistoryFilter.Limit is not set.
+const DefaultHistoryLimit = 100
+
+// historySortColumns are the columns history can be sorted by, by
+// HistoryFilter.Sort.
+var historySortColumns = map[string]string{
+	"":             "created_at",
+	"created_at":   "created_at",
+	"size":         "size",
+	"domains":      "domains",
+	"servers":      "servers",
+	"certificates": "certificates",
+}
+
+// historyFilter restricts history to the entries matching a HistoryFilter;
+// see HistoryFilter.args.
+const historyFilter = tenantFilter + ` AND (? IS NULL OR created_at >= ?) AND (? IS NULL OR created_at <= ?)
+	 AND (? IS NULL OR EXISTS (SELECT 1 FROM json_each(history.domain_ids) WHERE value = ? COLLATE NOCASE))`
+
+// HistoryFilter selects and orders history entries. Empty fields match
+// every entry.
+type HistoryFilter struct {
+	From   time.Time // entries created at or after
+	To     time.Time // entries created at or before
+	Domain string    // entries with a domain of this ID in the merged result, ignoring case
+	Sort   string    // created_at (default), size, domains, servers or certificates
+	Asc    bool      // ascending order; descending, newest first, by default
+	Limit  int       // at most; less than 1 means DefaultHistoryLimit
+	Offset int       // entries skipped, for paging
+}
+
+// args returns the arguments of historyFilter for the tenant of ctx.
+func (f HistoryFilter) args(ctx context.Context) []any {
+	args := tenantArgs(ctx)
+	for _, t := range []time.Time{f.From, f.To} {
+		var arg sql.NullString
+		if !t.IsZero() {
+			arg = sql.NullString{String: formatTimestamp(t), Valid: true}
+		}
+		args = append(args, arg, arg)
+	}
+	domain := nullString(f.Domain)
+	return append(args, domain, domain)
+}
+
+// order returns the ORDER BY, LIMIT and OFFSET clauses of f and their
+// arguments. Ties are broken by ID, so that pages do not overlap.
+func (f HistoryFilter) order() (string, []any, error) {
+	column, ok := historySortColumns[f.Sort]
+	if !ok {
+		return "", nil, fmt.Errorf("invalid history sort %q", f.Sort)
+	}
+	dir := "DESC"
+	if f.Asc {
+		dir = "ASC"
+	}
+	limit := f.Limit
+	if limit < 1 {
+		limit = DefaultHistoryLimit
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT ? OFFSET ?", column, dir, dir), []any{limit, max(f.Offset, 0)}, nil
+}
+
+// match reports whether entry is selected by f, for Memory.
+func (f HistoryFilter) match(entry *models.HistoryEntry) bool {
+	return (f.From.IsZero() || !entry.CreatedAt.Before(f.From.Truncate(time.Second))) &&
+		(f.To.IsZero() || !entry.CreatedAt.After(f.To.Truncate(time.Second))) &&
+		(f.Domain == "" || slices.ContainsFunc(entry.Result.Data, func(d models.Domain) bool { return strings.EqualFold(d.ID, f.Domain) }))
+}
+
+// queryHistory runs a query of the history columns selected by filter.
+func (r *Repository) queryHistory(ctx context.Context, columns string, filter HistoryFilter) (*sql.Rows, error) {
+	order, orderArgs, err := filter.order()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.summarizeHistory(ctx); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + columns + ` FROM history WHERE ` + historyFilter + order
+	return r.sqlDB().QueryContext(ctx, query, append(filter.args(ctx), orderArgs...)...)
+}
+
+// ListHistory retrieves the history entries selected by filter
+func (r *Repository) ListHistory(ctx context.Context, filter HistoryFilter) ([]models.HistoryEntry, error) {
+	rows, err := r.queryHistory(ctx, `id, created_at, initial, response, result, artifact_key, stats, encoding, size, tenant, run_id`, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -214,96 +562,323 @@ func (r *Repository) ListHistory(ctx context.Context) ([]models.HistoryEntry, er
 
 	var entries []models.HistoryEntry
 	for rows.Next() {
-		var entry models.HistoryEntry
-		var initialStr, responseStr, resultStr string
+		entry, err := scanHistory(rows)
+		if err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				continue
+			}
+			return nil, err
+		}
+
+		entries = append(entries, *entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		if err := r.loadArtifacts(ctx, &entries[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return entries, nil
+}
+
+// ListHistorySummaries retrieves the history entries selected by filter
+// without their data.
+func (r *Repository) ListHistorySummaries(ctx context.Context, filter HistoryFilter) ([]models.HistorySummary, error) {
+	rows, err := r.queryHistory(ctx, `id, created_at, artifact_key, stats, size, domains, servers, certificates, tenant, run_id`, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []models.HistorySummary{}
+	for rows.Next() {
+		var summary models.HistorySummary
 		var createdAt string
+		var artifactKey, stats, runID sql.NullString
+		var size, domains, servers, certificates sql.NullInt64
+		if err := rows.Scan(&summary.ID, &createdAt, &artifactKey, &stats, &size, &domains, &servers, &certificates, &summary.Tenant, &runID); err != nil {
+			return nil, err
+		}
+
+		if summary.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+			return nil, fmt.Errorf("history %d: %w", summary.ID, err)
+		}
+		if stats.Valid {
+			summary.Stats = &models.MergeStats{}
+			if err := json.Unmarshal([]byte(stats.String), summary.Stats); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal stats: %w", err)
+			}
+		}
+		summary.ArtifactKey = artifactKey.String
+		summary.RunID = runID.String
+		summary.Size = size.Int64
+		summary.Domains, summary.Servers, summary.Certificates = int(domains.Int64), int(servers.Int64), int(certificates.Int64)
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, rows.Err()
+}
+
+// CountHistory returns the number of history entries selected by filter,
+// ignoring its limit and offset.
+func (r *Repository) CountHistory(ctx context.Context, filter HistoryFilter) (int64, error) {
+	if err := r.summarizeHistory(ctx); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	err := r.sqlDB().QueryRowContext(ctx, `SELECT COUNT(*) FROM history WHERE `+historyFilter, filter.args(ctx)...).Scan(&count)
+	return count, err
+}
+
+// summarizeHistory computes and saves the counts and domain IDs missing
+// from rows written before they were recorded, or imported from such a
+// database, so that they can be filtered and sorted by.
+func (r *Repository) summarizeHistory(ctx context.Context) error {
+	rows, err := r.sqlDB().QueryContext(ctx, `SELECT id FROM history WHERE (domain_ids IS NULL OR domains IS NULL) AND `+tenantFilter, tenantArgs(ctx)...)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
-		err := rows.Scan(&entry.ID, &createdAt, &initialStr, &responseStr, &resultStr)
+	for _, id := range ids {
+		entry, err := r.GetHistory(ctx, id)
 		if err != nil {
-			return nil, err
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				continue
+			}
+			return fmt.Errorf("history %d: %w", id, err)
+		}
+		summary := entry.Summary()
+		_, err = r.sqlDB().ExecContext(ctx, `UPDATE history SET domains = ?, servers = ?, certificates = ?, domain_ids = ? WHERE id = ?`,
+			summary.Domains, summary.Servers, summary.Certificates, domainIDs(entry.Result.Data), id)
+		if err != nil {
+			return fmt.Errorf("failed to save history %d counts: %w", id, err)
 		}
+	}
+	return nil
+}
 
-		entry.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+// domainIDs returns the IDs of domains as the JSON array stored in
+// history.domain_ids.
+func domainIDs(domains []models.Domain) string {
+	ids := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		ids = append(ids, domain.ID)
+	}
+	data, _ := json.Marshal(ids)
+	return string(data)
+}
 
-		if err := json.Unmarshal([]byte(initialStr), &entry.Initial.Data); err != nil {
-			continue
+// DeleteHistory removes a history entry by ID, with its data in the
+// artifact store. Snapshots taken by the entry's push are kept, without
+// their reference to it. An entry whose artifacts could not be deleted is
+// still removed, and the error wraps ErrArtifactsKept.
+func (r *Repository) DeleteHistory(ctx context.Context, id int64) error {
+	var artifactKey sql.NullString
+	if err := r.statements().deleteHistory.QueryRowContext(ctx, tenantArgs(ctx, id)...).Scan(&artifactKey); err != nil {
+		return err
+	}
+
+	return r.deleteArtifacts(ctx, []string{artifactKey.String})
+}
+
+// PurgeHistory removes the history entries created before the given time,
+// with their data in the artifact store, and returns how many were removed.
+// Artifacts are handled as by DeleteHistory.
+func (r *Repository) PurgeHistory(ctx context.Context, before time.Time) (int64, error) {
+	rows, err := r.statements().purgeHistory.QueryContext(ctx, tenantArgs(ctx, formatTimestamp(before))...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var deleted int64
+	var keys []string
+	for rows.Next() {
+		var artifactKey sql.NullString
+		if err := rows.Scan(&artifactKey); err != nil {
+			return 0, err
 		}
-		if err := json.Unmarshal([]byte(responseStr), &entry.Response.Data); err != nil {
+		deleted++
+		keys = append(keys, artifactKey.String)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+
+	return deleted, r.deleteArtifacts(ctx, keys)
+}
+
+// ErrArtifactsKept is returned, joined with the causes, when history
+// entries were deleted but some of their artifacts could not be.
+var ErrArtifactsKept = errors.New("history artifacts kept")
+
+// deleteArtifacts deletes the artifacts of deleted history entries; empty
+// keys are those of entries stored inline. The entries are deleted first,
+// so a failure leaves unreferenced objects rather than broken entries.
+func (r *Repository) deleteArtifacts(ctx context.Context, keys []string) error {
+	var errs []error
+	for _, key := range keys {
+		if key == "" {
 			continue
 		}
-		if err := json.Unmarshal([]byte(resultStr), &entry.Result.Data); err != nil {
+		if r.artifacts == nil {
+			errs = append(errs, fmt.Errorf("artifacts of %s are kept: no artifact store is configured", key))
 			continue
 		}
-
-		entries = append(entries, entry)
+		for _, name := range []string{"initial", "response", "result"} {
+			if err := r.artifacts.Delete(ctx, key+"/"+name+".json"); err != nil {
+				errs = append(errs, fmt.Errorf("failed to delete %s artifact of %s: %w", name, key, err))
+			}
+		}
 	}
-
-	return entries, rows.Err()
+	if len(errs) > 0 {
+		return errors.Join(append([]error{ErrArtifactsKept}, errs...)...)
+	}
+	return nil
 }
 
-// SaveConfig saves or updates an NSX configuration
+// SaveConfig saves or updates an NSX configuration. New configurations
+// belong to the tenant of ctx; without one, to config.Tenant. Updates keep
+// the tenant.
 func (r *Repository) SaveConfig(ctx context.Context, config *models.NSXConfig) (*models.NSXConfig, error) {
-	now := time.Now()
+	now := time.Now().UTC().Truncate(time.Second)
+	saved := *config
+
+	defaults, err := syncDefaultsValue(config.SyncDefaults)
+	if err != nil {
+		return nil, err
+	}
 
 	if config.ID == 0 {
-		// Insert new config
-		res, err := r.db.ExecContext(ctx,
-			`INSERT INTO nsx_configs (name, description, host, username, password, insecure, created_at, updated_at)
-			 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-			config.Name, config.Description, config.Host, config.Username, config.Password, config.Insecure, now, now,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to insert config: %w", err)
+		if tenant, ok := TenantFrom(ctx); ok {
+			saved.Tenant = tenant
 		}
 
-		id, err := res.LastInsertId()
+		// Insert new config
+		err := r.statements().insertConfig.QueryRowContext(ctx,
+			config.Name, config.Description, config.Host, config.Username, config.Password, config.Insecure,
+			formatTimestamp(now), formatTimestamp(now), saved.Tenant, defaults,
+		).Scan(&saved.ID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get last insert id: %w", err)
+			return nil, fmt.Errorf("failed to insert config: %w", err)
 		}
 
-		return r.GetConfig(ctx, id)
+		saved.CreatedAt = now
+		saved.UpdatedAt = now
+		return &saved, nil
 	}
 
 	// Update existing config
-	_, err := r.db.ExecContext(ctx,
-		`UPDATE nsx_configs SET name=?, description=?, host=?, username=?, password=?, insecure=?, updated_at=? WHERE id=?`,
-		config.Name, config.Description, config.Host, config.Username, config.Password, config.Insecure, now, config.ID,
-	)
+	var createdAt string
+	err = r.statements().updateConfig.QueryRowContext(ctx, tenantArgs(ctx,
+		config.Name, config.Description, config.Host, config.Username, config.Password, config.Insecure,
+		formatTimestamp(now), defaults, config.ID,
+	)...).Scan(&createdAt, &saved.Tenant)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to update config: %w", err)
 	}
 
-	return r.GetConfig(ctx, config.ID)
+	if saved.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return nil, fmt.Errorf("config %d: %w", config.ID, err)
+	}
+	saved.UpdatedAt = now
+	return &saved, nil
 }
 
-// GetConfig retrieves an NSX configuration by ID
-func (r *Repository) GetConfig(ctx context.Context, id int64) (*models.NSXConfig, error) {
-	row := r.db.QueryRowContext(ctx,
-		`SELECT id, name, description, host, username, password, insecure, created_at, updated_at
-		 FROM nsx_configs WHERE id = ?`, id)
-
+// scanConfig scans a full config row including the password.
+func scanConfig(row rowScanner) (*models.NSXConfig, error) {
 	var config models.NSXConfig
 	var createdAt, updatedAt string
-	var description, password sql.NullString
+	var description, password, defaults sql.NullString
 
-	err := row.Scan(&config.ID, &config.Name, &description, &config.Host, &config.Username, &password, &config.Insecure, &createdAt, &updatedAt)
+	err := row.Scan(&config.ID, &config.Name, &description, &config.Host, &config.Username, &password, &config.Insecure, &createdAt, &updatedAt, &config.Tenant, &defaults)
 	if err != nil {
 		return nil, err
 	}
 
 	config.Description = description.String
 	config.Password = password.String
-	config.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
-	config.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+	if err := parseConfigTimestamps(&config, createdAt, updatedAt); err != nil {
+		return nil, err
+	}
+	if config.SyncDefaults, err = parseSyncDefaults(config.ID, defaults); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
 
+// parseConfigTimestamps sets the created/updated timestamps of a config.
+func parseConfigTimestamps(config *models.NSXConfig, createdAt, updatedAt string) error {
+	var err error
+	if config.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return fmt.Errorf("config %d created_at: %w", config.ID, err)
+	}
+	if config.UpdatedAt, err = parseTimestamp(updatedAt); err != nil {
+		return fmt.Errorf("config %d updated_at: %w", config.ID, err)
+	}
+	return nil
+}
+
+// syncDefaultsValue returns the sync_defaults column of defaults: NULL for
+// none, otherwise JSON.
+func syncDefaultsValue(defaults *models.SyncDefaults) (sql.NullString, error) {
+	if defaults == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(defaults)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to marshal sync defaults: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// parseSyncDefaults decodes the sync_defaults column of config id.
+func parseSyncDefaults(id int64, column sql.NullString) (*models.SyncDefaults, error) {
+	if !column.Valid {
+		return nil, nil
+	}
+	var defaults models.SyncDefaults
+	if err := json.Unmarshal([]byte(column.String), &defaults); err != nil {
+		return nil, fmt.Errorf("config %d sync_defaults: %w", id, err)
+	}
+	return &defaults, nil
+}
+
+// GetConfig retrieves an NSX configuration by ID
+func (r *Repository) GetConfig(ctx context.Context, id int64) (*models.NSXConfig, error) {
+	return scanConfig(r.statements().getConfig.QueryRowContext(ctx, tenantArgs(ctx, id)...))
+}
+
 // ListConfigs retrieves all NSX configurations
 func (r *Repository) ListConfigs(ctx context.Context) ([]models.NSXConfig, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, name, description, host, username, insecure, created_at, updated_at
-		 FROM nsx_configs ORDER BY name`)
+	rows, err := r.statements().listConfigs.QueryContext(ctx, tenantArgs(ctx)...)
 	if err != nil {
 		return nil, err
 	}
@@ -313,17 +888,21 @@ func (r *Repository) ListConfigs(ctx context.Context) ([]models.NSXConfig, error
 	for rows.Next() {
 		var config models.NSXConfig
 		var createdAt, updatedAt string
-		var description sql.NullString
+		var description, defaults sql.NullString
 
-		err := rows.Scan(&config.ID, &config.Name, &description, &config.Host, &config.Username, &config.Insecure, &createdAt, &updatedAt)
+		err := rows.Scan(&config.ID, &config.Name, &description, &config.Host, &config.Username, &config.Insecure, &createdAt, &updatedAt, &config.Tenant, &defaults)
 		if err != nil {
 			return nil, err
 		}
 
 		config.Description = description.String
 		// Don't return password in list
-		config.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
-		config.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+		if err := parseConfigTimestamps(&config, createdAt, updatedAt); err != nil {
+			return nil, err
+		}
+		if config.SyncDefaults, err = parseSyncDefaults(config.ID, defaults); err != nil {
+			return nil, err
+		}
 
 		configs = append(configs, config)
 	}
@@ -331,13 +910,31 @@ func (r *Repository) ListConfigs(ctx context.Context) ([]models.NSXConfig, error
 	return configs, rows.Err()
 }
 
-// DeleteConfig deletes an NSX configuration by ID
+// DeleteConfig soft-deletes an NSX configuration by ID.
+// The row is kept so that records referring to it stay intact, but it is
+// hidden from lookups and lists and its name becomes available again.
 func (r *Repository) DeleteConfig(ctx context.Context, id int64) error {
-	res, err := r.db.ExecContext(ctx, `DELETE FROM nsx_configs WHERE id = ?`, id)
+	res, err := r.statements().deleteConfig.ExecContext(ctx, tenantArgs(ctx, formatTimestamp(time.Now()), id)...)
 	if err != nil {
 		return err
 	}
 
+	return requireAffected(res)
+}
+
+// PurgeConfig permanently removes an NSX configuration by ID,
+// whether or not it has been soft-deleted.
+func (r *Repository) PurgeConfig(ctx context.Context, id int64) error {
+	res, err := r.statements().purgeConfig.ExecContext(ctx, tenantArgs(ctx, id)...)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(res)
+}
+
+// requireAffected returns sql.ErrNoRows if the statement changed no rows.
+func requireAffected(res sql.Result) error {
 	affected, err := res.RowsAffected()
 	if err != nil {
 		return err
@@ -350,25 +947,187 @@ func (r *Repository) DeleteConfig(ctx context.Context, id int64) error {
 	return nil
 }
 
-// GetConfigByName retrieves an NSX configuration by name
+// ErrAmbiguousConfig is returned when a lookup without a tenant finds NSX
+// configurations of the same name in several tenants.
+var ErrAmbiguousConfig = errors.New("ambiguous NSX configuration name")
+
+// GetConfigByName retrieves an NSX configuration by name. Names are unique
+// per tenant only: without a tenant in ctx, a name used by several tenants
+// returns ErrAmbiguousConfig rather than one of them.
 func (r *Repository) GetConfigByName(ctx context.Context, name string) (*models.NSXConfig, error) {
-	row := r.db.QueryRowContext(ctx,
-		`SELECT id, name, description, host, username, password, insecure, created_at, updated_at
-		 FROM nsx_configs WHERE name = ?`, name)
+	rows, err := r.statements().getConfigByName.QueryContext(ctx, tenantArgs(ctx, name)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	var config models.NSXConfig
-	var createdAt, updatedAt string
-	var description, password sql.NullString
+	var configs []*models.NSXConfig
+	for rows.Next() {
+		config, err := scanConfig(rows)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, config)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	switch len(configs) {
+	case 0:
+		return nil, sql.ErrNoRows
+	case 1:
+		return configs[0], nil
+	}
+	tenants := make([]string, len(configs))
+	for i, config := range configs {
+		tenants[i] = strconv.Quote(config.Tenant)
+	}
+	return nil, fmt.Errorf("%w: %q exists in tenants %s", ErrAmbiguousConfig, name, strings.Join(tenants, ", "))
+}
+
+// ErrInvalidDocument is returned when document content does not match its kind.
+var ErrInvalidDocument = errors.New("invalid document")
+
+// SaveDocument stores an uploaded document of the tenant of ctx. The content
+// must decode as the document's kind; size, checksum and creation time are
+// set from the content.
+func (r *Repository) SaveDocument(ctx context.Context, doc *models.Document) (*models.Document, error) {
+	if err := validateDocument(doc.Kind, doc.Content); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(doc.Content)
+	saved := *doc
+	saved.Size = int64(len(doc.Content))
+	saved.SHA256 = hex.EncodeToString(sum[:])
+	saved.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	saved.Tenant = tenantOf(ctx)
+
+	err := r.statements().insertDocument.QueryRowContext(ctx,
+		saved.Name, string(saved.Kind), string(saved.Content), saved.Size, saved.SHA256, formatTimestamp(saved.CreatedAt), saved.Tenant,
+	).Scan(&saved.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert document: %w", err)
+	}
 
-	err := row.Scan(&config.ID, &config.Name, &description, &config.Host, &config.Username, &password, &config.Insecure, &createdAt, &updatedAt)
+	return &saved, nil
+}
+
+// validateDocument checks that content decodes as kind.
+func validateDocument(kind models.DocumentKind, content json.RawMessage) error {
+	var err error
+	switch kind {
+	case models.DocumentInitial:
+		var domains []models.Domain
+		err = json.Unmarshal(content, &domains)
+	case models.DocumentResponse:
+		var response models.CertificateResponse
+		err = json.Unmarshal(content, &response)
+	default:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidDocument, kind)
+	}
 	if err != nil {
+		return fmt.Errorf("%w: content is not a valid %s document: %v", ErrInvalidDocument, kind, err)
+	}
+	return nil
+}
+
+// scanDocument scans a document row; content is scanned only when withContent is set.
+func scanDocument(row rowScanner, withContent bool) (*models.Document, error) {
+	var doc models.Document
+	var kind, createdAt, content string
+
+	dest := []any{&doc.ID, &doc.Name, &kind, &doc.Size, &doc.SHA256, &createdAt, &doc.Tenant}
+	if withContent {
+		dest = append(dest, &content)
+	}
+	if err := row.Scan(dest...); err != nil {
 		return nil, err
 	}
 
-	config.Description = description.String
-	config.Password = password.String
-	config.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
-	config.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+	var err error
+	if doc.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return nil, fmt.Errorf("document %d: %w", doc.ID, err)
+	}
+	doc.Kind = models.DocumentKind(kind)
+	if withContent {
+		doc.Content = json.RawMessage(content)
+	}
 
-	return &config, nil
+	return &doc, nil
+}
+
+// GetDocument retrieves a document with its content by ID
+func (r *Repository) GetDocument(ctx context.Context, id int64) (*models.Document, error) {
+	return scanDocument(r.statements().getDocument.QueryRowContext(ctx, tenantArgs(ctx, id)...), true)
+}
+
+// ListDocuments retrieves all documents without their content, newest first
+func (r *Repository) ListDocuments(ctx context.Context) ([]models.Document, error) {
+	rows, err := r.statements().listDocuments.QueryContext(ctx, tenantArgs(ctx)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []models.Document
+	for rows.Next() {
+		doc, err := scanDocument(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, *doc)
+	}
+
+	return docs, rows.Err()
+}
+
+// DeleteDocument removes a document by ID
+func (r *Repository) DeleteDocument(ctx context.Context, id int64) error {
+	res, err := r.statements().deleteDocument.ExecContext(ctx, tenantArgs(ctx, id)...)
+	if err != nil {
+		return err
+	}
+
+	return requireAffected(res)
+}
+
+// GetInitialDocument loads a document of kind initial as domain configurations.
+func (r *Repository) GetInitialDocument(ctx context.Context, id int64) ([]models.Domain, error) {
+	doc, err := r.getDocumentOfKind(ctx, id, models.DocumentInitial)
+	if err != nil {
+		return nil, err
+	}
+
+	var domains []models.Domain
+	if err := json.Unmarshal(doc.Content, &domains); err != nil {
+		return nil, fmt.Errorf("document %d: %w", id, err)
+	}
+	return domains, nil
+}
+
+// GetResponseDocument loads a document of kind response as a certificate response.
+func (r *Repository) GetResponseDocument(ctx context.Context, id int64) (*models.CertificateResponse, error) {
+	doc, err := r.getDocumentOfKind(ctx, id, models.DocumentResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	var response models.CertificateResponse
+	if err := json.Unmarshal(doc.Content, &response); err != nil {
+		return nil, fmt.Errorf("document %d: %w", id, err)
+	}
+	return &response, nil
+}
+
+func (r *Repository) getDocumentOfKind(ctx context.Context, id int64, kind models.DocumentKind) (*models.Document, error) {
+	doc, err := r.GetDocument(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Kind != kind {
+		return nil, fmt.Errorf("%w: document %d is a %s document, not %s", ErrInvalidDocument, id, doc.Kind, kind)
+	}
+	return doc, nil
 }
@@ -0,0 +1,952 @@
+package repository_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"ldapmerge/internal/artifacts"
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/repository"
+	"ldapmerge/internal/runid"
+)
+
+func setupTestRepo(t *testing.T) *repository.Repository {
+	t.Helper()
+
+	repo, err := repository.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	t.Cleanup(func() { _ = repo.Close() })
+
+	return repo
+}
+
+func testDomains() []models.Domain {
+	return []models.Domain{
+		{
+			ID:         "example.lab",
+			DomainName: "example.lab",
+			BaseDN:     "DC=example,DC=lab",
+			LDAPServers: []models.LDAPServer{
+				{URL: "ldaps://ad-01.example.lab:636", StartTLS: "false", Enabled: "true"},
+			},
+		},
+	}
+}
+
+func TestSaveHistory(t *testing.T) {
+	repo := setupTestRepo(t)
+	ctx := context.Background()
+
+	initial := testDomains()
+	result := testDomains()
+	result[0].LDAPServers[0].Certificates = []string{"-----BEGIN CERTIFICATE-----\ncert\n-----END CERTIFICATE-----"}
+
+	saved, err := repo.SaveHistory(runid.With(ctx, "20250115T103000Z-3f9a2c1b"), initial, models.CertificateResponse{}, result)
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+
+	if saved.ID == 0 {
+		t.Fatal("Expected non-zero history ID")
+	}
+
+	loaded, err := repo.GetHistory(ctx, saved.ID)
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+
+	if len(loaded.Result.Data) != 1 || len(loaded.Result.Data[0].LDAPServers[0].Certificates) != 1 {
+		t.Errorf("Unexpected stored result: %+v", loaded.Result.Data)
+	}
+	if loaded.RunID != "20250115T103000Z-3f9a2c1b" {
+		t.Errorf("Expected the run ID of the context, got %q", loaded.RunID)
+	}
+
+	if saved.CreatedAt.IsZero() || saved.CreatedAt.Location() != time.UTC {
+		t.Errorf("Expected non-zero UTC created_at, got %v", saved.CreatedAt)
+	}
+
+	if !loaded.CreatedAt.Equal(saved.CreatedAt) {
+		t.Errorf("Expected created_at %v, got %v", saved.CreatedAt, loaded.CreatedAt)
+	}
+}
+
+func TestSaveHistoryCompressed(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	repo, err := repository.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+	ctx := context.Background()
+
+	// A chain repeated for many servers, as in a merge of dozens of DCs
+	chain := testCertificate(t, "ca.example.lab", time.Now().Add(365*24*time.Hour))
+	result := testDomains()
+	for i := range 50 {
+		result[0].LDAPServers = append(result[0].LDAPServers, models.LDAPServer{
+			URL:          fmt.Sprintf("ldaps://ad-%02d.example.lab:636", i),
+			Certificates: []string{chain, chain},
+		})
+	}
+
+	saved, err := repo.SaveHistory(ctx, testDomains(), models.CertificateResponse{}, result)
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+
+	var encoding string
+	var stored, size int64
+	err = db.QueryRowContext(ctx, `SELECT encoding, length(initial) + length(response) + length(result), size FROM history WHERE id = ?`, saved.ID).
+		Scan(&encoding, &stored, &size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoding != "zstd" || size != saved.Size {
+		t.Errorf("Expected zstd encoding and size %d, got %q and %d", saved.Size, encoding, size)
+	}
+	if stored*4 > size {
+		t.Errorf("Expected compressed data much smaller than %d bytes, got %d", size, stored)
+	}
+
+	loaded, err := repo.GetHistory(ctx, saved.ID)
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if len(loaded.Result.Data[0].LDAPServers) != 51 || loaded.Result.Data[0].LDAPServers[50].Certificates[1] != chain {
+		t.Errorf("Unexpected decompressed result")
+	}
+	if loaded.Size != saved.Size {
+		t.Errorf("Expected size %d, got %d", saved.Size, loaded.Size)
+	}
+
+	// Compressed rows are imported as stored and de-duplicated by content
+	other := setupTestRepo(t)
+	for _, want := range []int{1, 0} {
+		res, err := other.ImportFrom(ctx, dbPath, false)
+		if err != nil {
+			t.Fatalf("ImportFrom failed: %v", err)
+		}
+		if res.HistoryImported != want {
+			t.Errorf("Expected %d imported, got %d", want, res.HistoryImported)
+		}
+	}
+	imported, err := other.ListHistory(ctx, repository.HistoryFilter{})
+	if err != nil {
+		t.Fatalf("ListHistory failed: %v", err)
+	}
+	if len(imported) != 1 || imported[0].Size != saved.Size || len(imported[0].Result.Data[0].LDAPServers) != 51 {
+		t.Errorf("Unexpected imported history %+v", imported)
+	}
+}
+
+func TestListHistorySummaries(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	repo, err := repository.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+	ctx := context.Background()
+
+	result := testDomains()
+	result[0].LDAPServers[0].Certificates = []string{"cert-a", "cert-b"}
+	saved, err := repo.SaveHistory(ctx, testDomains(), models.CertificateResponse{}, result)
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+
+	// Clear the counts, as for rows written before they were recorded
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	if _, err := db.ExecContext(ctx, `UPDATE history SET domains = NULL, servers = NULL, certificates = NULL, domain_ids = NULL`); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		summaries, err := repo.ListHistorySummaries(ctx, repository.HistoryFilter{})
+		if err != nil {
+			t.Fatalf("ListHistorySummaries failed: %v", err)
+		}
+		if len(summaries) != 1 {
+			t.Fatalf("Expected 1 summary, got %d", len(summaries))
+		}
+		want := saved.Summary()
+		if got := summaries[0]; got.ID != want.ID || got.Domains != 1 || got.Servers != 1 || got.Certificates != 2 || got.Size != want.Size {
+			t.Errorf("Expected %+v, got %+v", want, got)
+		}
+	}
+
+	var domains sql.NullInt64
+	if err := db.QueryRowContext(ctx, `SELECT domains FROM history WHERE id = ?`, saved.ID).Scan(&domains); err != nil {
+		t.Fatal(err)
+	}
+	if !domains.Valid {
+		t.Error("Expected the computed counts to be saved")
+	}
+	if summaries, err := repo.ListHistorySummaries(ctx, repository.HistoryFilter{Domain: "EXAMPLE.lab"}); err != nil || len(summaries) != 1 {
+		t.Errorf("Expected the entry found by its computed domain IDs, got %+v (%v)", summaries, err)
+	}
+}
+
+// historyRepository is implemented by Repository and Memory.
+type historyRepository interface {
+	SaveHistory(ctx context.Context, initial []models.Domain, response models.CertificateResponse, result []models.Domain) (*models.HistoryEntry, error)
+	ListHistory(ctx context.Context, filter repository.HistoryFilter) ([]models.HistoryEntry, error)
+	ListHistorySummaries(ctx context.Context, filter repository.HistoryFilter) ([]models.HistorySummary, error)
+	CountHistory(ctx context.Context, filter repository.HistoryFilter) (int64, error)
+}
+
+func TestHistoryFilter(t *testing.T) {
+	ctx := context.Background()
+	repos := map[string]historyRepository{
+		"sqlite": setupTestRepo(t),
+		"memory": repository.NewMemory(),
+	}
+
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			var ids []int64
+			for _, domains := range [][]string{{"a.lab"}, {"a.lab", "B.lab"}, {"c.lab"}} {
+				var result []models.Domain
+				for _, id := range domains {
+					result = append(result, models.Domain{ID: id})
+				}
+				entry, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, result)
+				if err != nil {
+					t.Fatalf("SaveHistory failed: %v", err)
+				}
+				ids = append(ids, entry.ID)
+			}
+
+			tests := []struct {
+				name   string
+				filter repository.HistoryFilter
+				want   []int64
+			}{
+				{"newest first", repository.HistoryFilter{}, []int64{ids[2], ids[1], ids[0]}},
+				{"page", repository.HistoryFilter{Limit: 2, Offset: 1}, []int64{ids[1], ids[0]}},
+				{"past the end", repository.HistoryFilter{Offset: 3}, nil},
+				{"domain ignoring case", repository.HistoryFilter{Domain: "b.LAB"}, []int64{ids[1]}},
+				{"sorted ascending", repository.HistoryFilter{Sort: "domains", Asc: true}, []int64{ids[0], ids[2], ids[1]}},
+				{"sorted descending", repository.HistoryFilter{Sort: "domains", Limit: 1}, []int64{ids[1]}},
+				{"to before the first", repository.HistoryFilter{To: time.Now().Add(-time.Hour)}, nil},
+				{"from and domain", repository.HistoryFilter{From: time.Now().Add(-time.Hour), Domain: "a.lab"}, []int64{ids[1], ids[0]}},
+			}
+			for _, tt := range tests {
+				summaries, err := repo.ListHistorySummaries(ctx, tt.filter)
+				if err != nil {
+					t.Fatalf("%s: ListHistorySummaries failed: %v", tt.name, err)
+				}
+				var got []int64
+				for _, summary := range summaries {
+					got = append(got, summary.ID)
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+				}
+			}
+
+			entries, err := repo.ListHistory(ctx, repository.HistoryFilter{Domain: "c.lab"})
+			if err != nil || len(entries) != 1 || entries[0].ID != ids[2] || len(entries[0].Result.Data) != 1 {
+				t.Errorf("Expected the full entry of c.lab, got %+v (%v)", entries, err)
+			}
+			if count, err := repo.CountHistory(ctx, repository.HistoryFilter{Domain: "a.lab", Limit: 1}); err != nil || count != 2 {
+				t.Errorf("Expected 2 entries counted, got %d (%v)", count, err)
+			}
+			if _, err := repo.ListHistorySummaries(ctx, repository.HistoryFilter{Sort: "id; DROP TABLE history"}); err == nil {
+				t.Error("Expected an invalid sort to fail")
+			}
+		})
+	}
+}
+
+func TestSaveConfig(t *testing.T) {
+	repo := setupTestRepo(t)
+	ctx := context.Background()
+
+	created, err := repo.SaveConfig(ctx, &models.NSXConfig{
+		Name:     "lab",
+		Host:     "https://nsx.example.lab",
+		Username: "admin",
+		Password: "secret",
+	})
+	if err != nil {
+		t.Fatalf("SaveConfig (insert) failed: %v", err)
+	}
+
+	if created.ID == 0 {
+		t.Fatal("Expected non-zero config ID")
+	}
+
+	created.Description = "updated"
+	updated, err := repo.SaveConfig(ctx, created)
+	if err != nil {
+		t.Fatalf("SaveConfig (update) failed: %v", err)
+	}
+
+	loaded, err := repo.GetConfigByName(ctx, "lab")
+	if err != nil {
+		t.Fatalf("GetConfigByName failed: %v", err)
+	}
+
+	if loaded.Description != "updated" || updated.Description != "updated" {
+		t.Errorf("Expected description 'updated', got '%s'", loaded.Description)
+	}
+
+	_, err = repo.SaveConfig(ctx, &models.NSXConfig{ID: 999, Name: "missing", Host: "h", Username: "u"})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for unknown config, got %v", err)
+	}
+}
+
+func TestTenants(t *testing.T) {
+	repo := setupTestRepo(t)
+	ctx := context.Background()
+	teamA := repository.WithTenant(ctx, "team-a")
+	teamB := repository.WithTenant(ctx, "team-b")
+
+	// Names are unique per tenant
+	configA, err := repo.SaveConfig(teamA, &models.NSXConfig{Name: "prod", Host: "https://nsx-a", Username: "admin"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	if _, err := repo.SaveConfig(teamB, &models.NSXConfig{Name: "prod", Host: "https://nsx-b", Username: "admin", Tenant: "team-a"}); err != nil {
+		t.Fatalf("SaveConfig with the same name in another tenant failed: %v", err)
+	}
+	if _, err := repo.SaveConfig(teamA, &models.NSXConfig{Name: "prod", Host: "https://nsx-a", Username: "admin"}); err == nil {
+		t.Error("Expected a duplicate name in the same tenant to fail")
+	}
+
+	configs, err := repo.ListConfigs(teamB)
+	if err != nil {
+		t.Fatalf("ListConfigs failed: %v", err)
+	}
+	if len(configs) != 1 || configs[0].Host != "https://nsx-b" || configs[0].Tenant != "team-b" {
+		t.Errorf("Expected only the config of team-b, got %+v", configs)
+	}
+	if _, err := repo.GetConfig(teamB, configA.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows for a config of another tenant, got %v", err)
+	}
+	if err := repo.DeleteConfig(teamB, configA.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows deleting a config of another tenant, got %v", err)
+	}
+	if all, err := repo.ListConfigs(ctx); err != nil || len(all) != 2 {
+		t.Errorf("Expected both configs without a tenant, got %d (%v)", len(all), err)
+	}
+
+	// A name shared by tenants needs one to pick the config
+	if config, err := repo.GetConfigByName(ctx, "prod"); !errors.Is(err, repository.ErrAmbiguousConfig) {
+		t.Errorf("Expected ErrAmbiguousConfig without a tenant, got %+v (%v)", config, err)
+	}
+	if config, err := repo.GetConfigByName(teamB, "prod"); err != nil || config.Host != "https://nsx-b" {
+		t.Errorf("Expected the config of team-b, got %+v (%v)", config, err)
+	}
+	if _, err := repo.GetConfigByName(repository.WithTenant(ctx, ""), "prod"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows in the default tenant, got %v", err)
+	}
+
+	entry, err := repo.SaveHistory(teamA, nil, models.CertificateResponse{}, testDomains())
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	if _, err := repo.GetHistory(teamB, entry.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows for history of another tenant, got %v", err)
+	}
+	if summaries, err := repo.ListHistorySummaries(teamB, repository.HistoryFilter{}); err != nil || len(summaries) != 0 {
+		t.Errorf("Expected no history for team-b, got %d (%v)", len(summaries), err)
+	}
+	if entries, err := repo.ListHistory(teamA, repository.HistoryFilter{}); err != nil || len(entries) != 1 || entries[0].Tenant != "team-a" {
+		t.Errorf("Expected the entry of team-a, got %+v (%v)", entries, err)
+	}
+
+	doc, err := repo.SaveDocument(teamA, &models.Document{Name: "initial", Kind: models.DocumentInitial, Content: []byte(`[]`)})
+	if err != nil || doc.Tenant != "team-a" {
+		t.Fatalf("SaveDocument failed: %+v (%v)", doc, err)
+	}
+	if _, err := repo.GetDocument(teamB, doc.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows for a document of another tenant, got %v", err)
+	}
+	if docs, err := repo.ListDocuments(teamB); err != nil || len(docs) != 0 {
+		t.Errorf("Expected no documents for team-b, got %+v (%v)", docs, err)
+	}
+	if err := repo.DeleteDocument(teamB, doc.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows deleting a document of another tenant, got %v", err)
+	}
+	if docs, err := repo.ListDocuments(ctx); err != nil || len(docs) != 1 || docs[0].Tenant != "team-a" {
+		t.Errorf("Expected the document of team-a without a tenant, got %+v (%v)", docs, err)
+	}
+
+	snapshot := &models.Snapshot{Operation: "nsx.push", NSXHost: "https://nsx-a"}
+	if err := repo.AddSnapshot(teamA, snapshot); err != nil || snapshot.Tenant != "team-a" {
+		t.Fatalf("AddSnapshot failed: %+v (%v)", snapshot, err)
+	}
+	if _, err := repo.GetSnapshot(teamB, snapshot.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows for a snapshot of another tenant, got %v", err)
+	}
+	if snapshots, err := repo.ListSnapshots(teamB, 10); err != nil || len(snapshots) != 0 {
+		t.Errorf("Expected no snapshots for team-b, got %+v (%v)", snapshots, err)
+	}
+	if snapshots, err := repo.ListSnapshots(teamA, 10); err != nil || len(snapshots) != 1 || snapshots[0].Tenant != "team-a" {
+		t.Errorf("Expected the snapshot of team-a, got %+v (%v)", snapshots, err)
+	}
+}
+
+func TestNewWithOptionsInvalidSynchronous(t *testing.T) {
+	opts := repository.DefaultOptions()
+	opts.Synchronous = "SOMETIMES"
+
+	_, err := repository.NewWithOptions(filepath.Join(t.TempDir(), "test.db"), opts)
+	if err == nil {
+		t.Error("Expected error for invalid synchronous mode")
+	}
+}
+
+func TestDeleteConfigSoft(t *testing.T) {
+	repo := setupTestRepo(t)
+	ctx := context.Background()
+
+	config, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "lab", Host: "https://nsx.example.lab", Username: "admin"})
+	if err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	if err := repo.DeleteConfig(ctx, config.ID); err != nil {
+		t.Fatalf("DeleteConfig failed: %v", err)
+	}
+
+	if _, err := repo.GetConfig(ctx, config.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected deleted config to be hidden, got %v", err)
+	}
+
+	configs, err := repo.ListConfigs(ctx)
+	if err != nil {
+		t.Fatalf("ListConfigs failed: %v", err)
+	}
+	if len(configs) != 0 {
+		t.Errorf("Expected no configs after delete, got %d", len(configs))
+	}
+
+	if err := repo.DeleteConfig(ctx, config.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows deleting twice, got %v", err)
+	}
+
+	// Name is free again once the config is deleted
+	if _, err := repo.SaveConfig(ctx, &models.NSXConfig{Name: "lab", Host: "https://nsx2.example.lab", Username: "admin"}); err != nil {
+		t.Fatalf("SaveConfig with reused name failed: %v", err)
+	}
+
+	if err := repo.PurgeConfig(ctx, config.ID); err != nil {
+		t.Fatalf("PurgeConfig failed: %v", err)
+	}
+	if err := repo.PurgeConfig(ctx, config.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows purging twice, got %v", err)
+	}
+}
+
+func TestDocuments(t *testing.T) {
+	repo := setupTestRepo(t)
+	ctx := context.Background()
+
+	content := json.RawMessage(`[{"id":"example.lab","domain_name":"example.lab","base_dn":"DC=example,DC=lab","ldap_servers":[]}]`)
+	doc, err := repo.SaveDocument(ctx, &models.Document{Name: "prod", Kind: models.DocumentInitial, Content: content})
+	if err != nil {
+		t.Fatalf("SaveDocument failed: %v", err)
+	}
+	if doc.ID == 0 {
+		t.Error("Expected document ID to be set")
+	}
+	if doc.Size != int64(len(content)) {
+		t.Errorf("Expected size %d, got %d", len(content), doc.Size)
+	}
+	if len(doc.SHA256) != 64 {
+		t.Errorf("Expected hex SHA-256, got %q", doc.SHA256)
+	}
+
+	domains, err := repo.GetInitialDocument(ctx, doc.ID)
+	if err != nil {
+		t.Fatalf("GetInitialDocument failed: %v", err)
+	}
+	if len(domains) != 1 || domains[0].ID != "example.lab" {
+		t.Errorf("Expected example.lab domain, got %+v", domains)
+	}
+
+	if _, err := repo.GetResponseDocument(ctx, doc.ID); !errors.Is(err, repository.ErrInvalidDocument) {
+		t.Errorf("Expected ErrInvalidDocument loading initial as response, got %v", err)
+	}
+
+	_, err = repo.SaveDocument(ctx, &models.Document{Name: "bad", Kind: models.DocumentResponse, Content: json.RawMessage(`[1, 2]`)})
+	if !errors.Is(err, repository.ErrInvalidDocument) {
+		t.Errorf("Expected ErrInvalidDocument for mismatched content, got %v", err)
+	}
+
+	docs, err := repo.ListDocuments(ctx)
+	if err != nil {
+		t.Fatalf("ListDocuments failed: %v", err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("Expected 1 document, got %d", len(docs))
+	}
+	if docs[0].Content != nil {
+		t.Error("Expected list to omit content")
+	}
+
+	if err := repo.DeleteDocument(ctx, doc.ID); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+	if _, err := repo.GetDocument(ctx, doc.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows after delete, got %v", err)
+	}
+}
+
+// memStore is an in-memory artifacts.Store.
+type memStore map[string][]byte
+
+func (m memStore) Put(_ context.Context, key string, data []byte) error {
+	m[key] = data
+	return nil
+}
+
+func (m memStore) Get(_ context.Context, key string) ([]byte, error) {
+	data, ok := m[key]
+	if !ok {
+		return nil, artifacts.ErrNotFound
+	}
+	return data, nil
+}
+
+func (m memStore) Delete(_ context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func TestSaveHistoryArtifacts(t *testing.T) {
+	store := memStore{}
+	opts := repository.DefaultOptions()
+	opts.Artifacts = store
+
+	repo, err := repository.NewWithOptions(filepath.Join(t.TempDir(), "test.db"), opts)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+	ctx := context.Background()
+
+	saved, err := repo.SaveHistory(ctx, testDomains(), models.CertificateResponse{}, testDomains())
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	if saved.ArtifactKey == "" {
+		t.Fatal("Expected artifact key to be set")
+	}
+	if len(store) != 3 {
+		t.Errorf("Expected 3 artifacts, got %d", len(store))
+	}
+
+	entry, err := repo.GetHistory(ctx, saved.ID)
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	if len(entry.Result.Data) != 1 || entry.Result.Data[0].ID != "example.lab" {
+		t.Errorf("Expected result loaded from artifact store, got %+v", entry.Result.Data)
+	}
+
+	entries, err := repo.ListHistory(ctx, repository.HistoryFilter{})
+	if err != nil {
+		t.Fatalf("ListHistory failed: %v", err)
+	}
+	if len(entries) != 1 || len(entries[0].Initial.Data) != 1 {
+		t.Errorf("Expected list to load artifacts, got %+v", entries)
+	}
+
+	delete(store, saved.ArtifactKey+"/result.json")
+	if _, err := repo.GetHistory(ctx, saved.ID); !errors.Is(err, artifacts.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for missing artifact, got %v", err)
+	}
+}
+
+func TestDeleteHistory(t *testing.T) {
+	store := memStore{}
+	opts := repository.DefaultOptions()
+	opts.Artifacts = store
+
+	repo, err := repository.NewWithOptions(filepath.Join(t.TempDir(), "test.db"), opts)
+	if err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	defer func() { _ = repo.Close() }()
+	ctx := context.Background()
+	teamA := repository.WithTenant(ctx, "team-a")
+	teamB := repository.WithTenant(ctx, "team-b")
+
+	entry, err := repo.SaveHistory(teamA, testDomains(), models.CertificateResponse{}, testDomains())
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+	snapshot := &models.Snapshot{HistoryID: &entry.ID, Operation: "history.push", NSXHost: "https://nsx.example.lab"}
+	if err := repo.AddSnapshot(ctx, snapshot); err != nil {
+		t.Fatalf("AddSnapshot failed: %v", err)
+	}
+
+	if err := repo.DeleteHistory(teamB, entry.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows deleting history of another tenant, got %v", err)
+	}
+	if err := repo.DeleteHistory(teamA, entry.ID); err != nil {
+		t.Fatalf("DeleteHistory failed: %v", err)
+	}
+	if _, err := repo.GetHistory(ctx, entry.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows after delete, got %v", err)
+	}
+	if len(store) != 0 {
+		t.Errorf("Expected the artifacts deleted, got %d", len(store))
+	}
+	if got, err := repo.GetSnapshot(ctx, snapshot.ID); err != nil || got.HistoryID != nil {
+		t.Errorf("Expected the snapshot kept without its history ID, got %+v, %v", got, err)
+	}
+	if err := repo.DeleteHistory(teamA, entry.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected ErrNoRows deleting a deleted entry, got %v", err)
+	}
+}
+
+func TestPurgeHistory(t *testing.T) {
+	repo := setupTestRepo(t)
+	ctx := context.Background()
+	teamA := repository.WithTenant(ctx, "team-a")
+
+	for _, c := range []context.Context{ctx, teamA, teamA} {
+		if _, err := repo.SaveHistory(c, nil, models.CertificateResponse{}, testDomains()); err != nil {
+			t.Fatalf("SaveHistory failed: %v", err)
+		}
+	}
+
+	if deleted, err := repo.PurgeHistory(ctx, time.Now().Add(-time.Hour)); err != nil || deleted != 0 {
+		t.Errorf("Expected nothing purged before an hour ago, got %d, %v", deleted, err)
+	}
+	if deleted, err := repo.PurgeHistory(teamA, time.Now().Add(time.Minute)); err != nil || deleted != 2 {
+		t.Errorf("Expected the 2 entries of team-a purged, got %d, %v", deleted, err)
+	}
+	if summaries, err := repo.ListHistorySummaries(ctx, repository.HistoryFilter{}); err != nil || len(summaries) != 1 || summaries[0].Tenant != "" {
+		t.Errorf("Expected the entry without a tenant left, got %+v, %v", summaries, err)
+	}
+}
+
+func testCertificate(t *testing.T, cn string, notAfter time.Time) string {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestUpdateInventory(t *testing.T) {
+	repo := setupTestRepo(t)
+	ctx := context.Background()
+
+	expires := time.Date(2027, 3, 1, 12, 0, 0, 0, time.UTC)
+	domains := testDomains()
+	domains[0].LDAPServers[0].Certificates = []string{testCertificate(t, "ad-01.example.lab", expires)}
+	domains[0].LDAPServers = append(domains[0].LDAPServers, models.LDAPServer{URL: "ldaps://ad-02.example.lab:636", Enabled: "false"})
+
+	count, err := repo.UpdateInventory(ctx, "https://nsx.example.lab", domains)
+	if err != nil {
+		t.Fatalf("UpdateInventory failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 servers recorded, got %d", count)
+	}
+
+	// A second pull updates rather than duplicates
+	if _, err := repo.UpdateInventory(ctx, "https://nsx.example.lab", domains); err != nil {
+		t.Fatalf("UpdateInventory failed: %v", err)
+	}
+	if err := repo.RecordProbe(ctx, "https://nsx.example.lab", "ldaps://ad-02.example.lab:636", false, "connection refused"); err != nil {
+		t.Fatalf("RecordProbe failed: %v", err)
+	}
+
+	servers, err := repo.ListServers(ctx)
+	if err != nil {
+		t.Fatalf("ListServers failed: %v", err)
+	}
+	if len(servers) != 2 {
+		t.Fatalf("Expected 2 servers, got %d", len(servers))
+	}
+
+	first := servers[0]
+	if first.CertSubject != "ad-01.example.lab" || first.CertExpiresAt == nil || !first.CertExpiresAt.Equal(expires) || first.CertCount != 1 {
+		t.Errorf("Expected certificate details for ad-01, got %+v", first)
+	}
+	if len(first.CertFingerprint) != 64 {
+		t.Errorf("Expected SHA-256 fingerprint, got %q", first.CertFingerprint)
+	}
+	if first.LastProbeOK != nil {
+		t.Errorf("Expected no probe result for ad-01, got %v", *first.LastProbeOK)
+	}
+
+	second := servers[1]
+	if second.Enabled || second.CertCount != 0 {
+		t.Errorf("Expected ad-02 to be disabled and without certificates, got %+v", second)
+	}
+	if second.LastProbeOK == nil || *second.LastProbeOK || second.LastProbeError != "connection refused" {
+		t.Errorf("Expected failed probe for ad-02, got %+v", second)
+	}
+}
+
+func TestAuditEvents(t *testing.T) {
+	repo := setupTestRepo(t)
+	ctx := context.Background()
+
+	for _, event := range []*models.AuditEvent{
+		{Operation: "nsx.push", Origin: "cli", Actor: "jdoe", NSXHost: "https://nsx.example.lab",
+			SourceIDs: []string{"example.lab", "corp.lab"}, Reason: "CHG-1", Outcome: "partial", Error: "NSX API error 400",
+			Protected: []string{"corp.lab"}, RunID: "20250115T103000Z-3f9a2c1b"},
+		{Operation: "nsx.delete", Origin: "api", NSXHost: "https://nsx.example.lab", Reason: "CHG-2", Outcome: "success",
+			ClientCert: "CN=ansible,O=Example"},
+	} {
+		if err := repo.AddAuditEvent(ctx, event); err != nil {
+			t.Fatalf("AddAuditEvent failed: %v", err)
+		}
+		if event.ID == 0 || event.CreatedAt.IsZero() {
+			t.Errorf("Expected ID and created_at to be set, got %+v", event)
+		}
+	}
+
+	events, err := repo.ListAuditEvents(ctx, repository.AuditFilter{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListAuditEvents failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+	if events[0].Operation != "nsx.delete" || events[0].SourceIDs == nil || len(events[0].SourceIDs) != 0 || events[0].Protected != nil ||
+		events[0].ClientCert != "CN=ansible,O=Example" {
+		t.Errorf("Expected newest event first with empty source IDs, got %+v", events[0])
+	}
+	if e := events[1]; e.Actor != "jdoe" || e.Reason != "CHG-1" || len(e.SourceIDs) != 2 || e.Error != "NSX API error 400" ||
+		len(e.Protected) != 1 || e.Protected[0] != "corp.lab" || e.RunID != "20250115T103000Z-3f9a2c1b" || e.ClientCert != "" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+}
+
+func TestAuditEventsFilter(t *testing.T) {
+	for name, repo := range map[string]interface {
+		AddAuditEvent(context.Context, *models.AuditEvent) error
+		ListAuditEvents(context.Context, repository.AuditFilter) ([]models.AuditEvent, error)
+	}{"sqlite": setupTestRepo(t), "memory": repository.NewMemory()} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for _, event := range []*models.AuditEvent{
+				{Operation: "nsx.push", Origin: "cli", Actor: "jdoe", Outcome: "success"},
+				{Operation: "api.request", Origin: "api", Actor: "ansible", Outcome: "success", SourceIP: "192.0.2.1", BodySHA256: "aa"},
+				{Operation: "api.request", Origin: "api", Actor: "ansible", Outcome: "failed", SourceIP: "192.0.2.2", BodySHA256: "bb"},
+			} {
+				if err := repo.AddAuditEvent(ctx, event); err != nil {
+					t.Fatalf("AddAuditEvent failed: %v", err)
+				}
+			}
+
+			for _, tc := range []struct {
+				filter repository.AuditFilter
+				want   int
+			}{
+				{repository.AuditFilter{}, 3},
+				{repository.AuditFilter{Limit: 2}, 2},
+				{repository.AuditFilter{Actor: "ansible"}, 2},
+				{repository.AuditFilter{Operation: "nsx.push"}, 1},
+				{repository.AuditFilter{SourceIP: "192.0.2.2"}, 1},
+				{repository.AuditFilter{Actor: "ansible", BodySHA256: "aa"}, 1},
+				{repository.AuditFilter{Actor: "jdoe", BodySHA256: "aa"}, 0},
+				{repository.AuditFilter{Since: time.Now().Add(-time.Minute), Until: time.Now().Add(time.Minute)}, 3},
+				{repository.AuditFilter{Since: time.Now().Add(time.Hour)}, 0},
+			} {
+				events, err := repo.ListAuditEvents(ctx, tc.filter)
+				if err != nil {
+					t.Fatalf("ListAuditEvents(%+v) failed: %v", tc.filter, err)
+				}
+				if len(events) != tc.want {
+					t.Errorf("ListAuditEvents(%+v) returned %d events, want %d", tc.filter, len(events), tc.want)
+				}
+			}
+
+			events, _ := repo.ListAuditEvents(ctx, repository.AuditFilter{SourceIP: "192.0.2.1"})
+			if len(events) != 1 || events[0].BodySHA256 != "aa" {
+				t.Errorf("Expected the event from 192.0.2.1, got %+v", events)
+			}
+		})
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	repo := setupTestRepo(t)
+	ctx := context.Background()
+
+	entry, err := repo.SaveHistory(ctx, nil, models.CertificateResponse{}, nil)
+	if err != nil {
+		t.Fatalf("SaveHistory failed: %v", err)
+	}
+
+	snapshot := &models.Snapshot{
+		HistoryID: &entry.ID,
+		Operation: "history.push",
+		NSXHost:   "https://nsx.example.lab",
+		Sources: []models.SnapshotSource{
+			{ID: "example.lab", Existed: true, Source: json.RawMessage(`{"id":"example.lab","domain_name":"example.lab"}`)},
+			{ID: "new.lab"},
+		},
+	}
+	if err := repo.AddSnapshot(ctx, snapshot); err != nil {
+		t.Fatalf("AddSnapshot failed: %v", err)
+	}
+	if snapshot.ID == 0 || snapshot.CreatedAt.IsZero() {
+		t.Errorf("Expected ID and created_at to be set, got %+v", snapshot)
+	}
+
+	got, err := repo.GetSnapshot(ctx, snapshot.ID)
+	if err != nil {
+		t.Fatalf("GetSnapshot failed: %v", err)
+	}
+	if got.HistoryID == nil || *got.HistoryID != entry.ID || got.Operation != "history.push" || len(got.Sources) != 2 {
+		t.Fatalf("Unexpected snapshot %+v", got)
+	}
+	if got.Sources[1].Existed || got.Sources[1].Source != nil {
+		t.Errorf("Expected no state for a source that did not exist, got %s", got.Sources[1].Source)
+	}
+	var source map[string]string
+	if err := json.Unmarshal(got.Sources[0].Source, &source); err != nil || source["domain_name"] != "example.lab" {
+		t.Errorf("Expected the stored NSX document, got %s (%v)", got.Sources[0].Source, err)
+	}
+
+	if _, err := repo.GetSnapshot(ctx, 999); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for unknown snapshot, got %v", err)
+	}
+
+	if err := repo.AddSnapshot(ctx, &models.Snapshot{Operation: "nsx.push", NSXHost: "https://nsx.example.lab"}); err != nil {
+		t.Fatalf("AddSnapshot failed: %v", err)
+	}
+	list, err := repo.ListSnapshots(ctx, 10)
+	if err != nil {
+		t.Fatalf("ListSnapshots failed: %v", err)
+	}
+	if len(list) != 2 || list[0].Operation != "nsx.push" || list[0].HistoryID != nil {
+		t.Fatalf("Expected newest snapshot first, got %+v", list)
+	}
+	if s := list[1].Sources; len(s) != 2 || !s[0].Existed || s[0].Source != nil {
+		t.Errorf("Expected listed sources without documents, got %+v", s)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	repo := setupTestRepo(t)
+	ctx := context.Background()
+
+	if settings, err := repo.ListSettings(ctx); err != nil || len(settings) != 0 {
+		t.Fatalf("Expected no settings, got %+v, %v", settings, err)
+	}
+
+	if err := repo.SaveSettings(ctx, []models.Setting{
+		{Key: "log_level", Value: "debug", UpdatedBy: "ops"},
+		{Key: "probes_paused", Value: "true"},
+	}); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+	update := []models.Setting{{Key: "log_level", Value: "warn", UpdatedBy: "admin"}}
+	if err := repo.SaveSettings(ctx, update); err != nil {
+		t.Fatalf("SaveSettings failed: %v", err)
+	}
+	if update[0].UpdatedAt.IsZero() {
+		t.Error("Expected the update time to be set")
+	}
+
+	settings, err := repo.ListSettings(ctx)
+	if err != nil {
+		t.Fatalf("ListSettings failed: %v", err)
+	}
+	if len(settings) != 2 {
+		t.Fatalf("Expected 2 settings, got %+v", settings)
+	}
+	if s := settings[0]; s.Key != "log_level" || s.Value != "warn" || s.UpdatedBy != "admin" || !s.UpdatedAt.Equal(update[0].UpdatedAt) {
+		t.Errorf("Expected the replaced log_level, got %+v", s)
+	}
+	if s := settings[1]; s.Key != "probes_paused" || s.Value != "true" || s.UpdatedBy != "" {
+		t.Errorf("Unexpected probes_paused %+v", s)
+	}
+}
+
+func TestHealthSnapshots(t *testing.T) {
+	repo := setupTestRepo(t)
+	ctx := context.Background()
+
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		snapshot := &models.HealthSnapshot{
+			TakenAt:  start.Add(time.Duration(i) * time.Hour),
+			Database: models.DatabaseSample{OK: true, Size: int64(1000 * (i + 1)), HistoryCount: int64(i)},
+			NSX:      []models.NSXSample{{ConfigID: 1, Name: "lab", Host: "https://nsx", Reachable: i != 1, LatencyMS: 12.5}},
+		}
+		if i == 1 {
+			snapshot.NSX[0].Error = "connection refused"
+		}
+		if err := repo.AddHealthSnapshot(ctx, snapshot); err != nil || snapshot.ID == 0 {
+			t.Fatalf("AddHealthSnapshot failed: %v", err)
+		}
+	}
+	if err := repo.AddHealthSnapshot(ctx, &models.HealthSnapshot{Database: models.DatabaseSample{Error: "database is locked"}}); err != nil {
+		t.Fatalf("AddHealthSnapshot failed: %v", err)
+	}
+
+	list, err := repo.ListHealthSnapshots(ctx, start.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatalf("ListHealthSnapshots failed: %v", err)
+	}
+	if len(list) != 3 || list[0].Database.Error != "database is locked" || len(list[0].NSX) != 0 {
+		t.Fatalf("Expected the snapshots since the second one, newest first, got %+v", list)
+	}
+	if s := list[2]; !s.TakenAt.Equal(start.Add(time.Hour)) || s.Database.Size != 2000 || s.NSX[0].Reachable || s.NSX[0].Error != "connection refused" {
+		t.Errorf("Unexpected snapshot %+v", s)
+	}
+
+	if list, err := repo.ListHealthSnapshots(ctx, time.Time{}, 2); err != nil || len(list) != 2 {
+		t.Errorf("Expected the latest 2 snapshots, got %d, %v", len(list), err)
+	}
+
+	pruned, err := repo.PruneHealthSnapshots(ctx, start.Add(90*time.Minute))
+	if err != nil || pruned != 2 {
+		t.Errorf("Expected 2 snapshots pruned, got %d, %v", pruned, err)
+	}
+}
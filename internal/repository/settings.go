@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"ldapmerge/internal/models"
+)
+
+// ListSettings returns the stored runtime settings of the API server,
+// ordered by key.
+func (r *Repository) ListSettings(ctx context.Context) ([]models.Setting, error) {
+	rows, err := r.statements().listSettings.QueryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := []models.Setting{}
+	for rows.Next() {
+		var s models.Setting
+		var updatedAt string
+		var updatedBy sql.NullString
+		if err := rows.Scan(&s.Key, &s.Value, &updatedAt, &updatedBy); err != nil {
+			return nil, err
+		}
+		if s.UpdatedAt, err = parseTimestamp(updatedAt); err != nil {
+			return nil, fmt.Errorf("setting %s: %w", s.Key, err)
+		}
+		s.UpdatedBy = updatedBy.String
+		settings = append(settings, s)
+	}
+
+	return settings, rows.Err()
+}
+
+// SaveSettings stores settings, replacing those with the same keys, in one
+// transaction, and sets their update time.
+func (r *Repository) SaveSettings(ctx context.Context, settings []models.Setting) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	tx, err := r.sqlDB().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt := tx.StmtContext(ctx, r.statements().upsertSetting)
+	for i := range settings {
+		s := &settings[i]
+		if _, err := stmt.ExecContext(ctx, s.Key, s.Value, formatTimestamp(now), nullString(s.UpdatedBy)); err != nil {
+			return fmt.Errorf("failed to save setting %s: %w", s.Key, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for i := range settings {
+		settings[i].UpdatedAt = now
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"ldapmerge/internal/models"
+)
+
+// AddSnapshot stores the pre-push state of identity sources and sets the
+// snapshot's ID, creation time and tenant, that of ctx.
+func (r *Repository) AddSnapshot(ctx context.Context, snapshot *models.Snapshot) error {
+	if snapshot.Sources == nil {
+		snapshot.Sources = []models.SnapshotSource{}
+	}
+	sources, err := json.Marshal(snapshot.Sources)
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot sources: %w", err)
+	}
+
+	var historyID sql.NullInt64
+	if snapshot.HistoryID != nil {
+		historyID = sql.NullInt64{Int64: *snapshot.HistoryID, Valid: true}
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	tenant := tenantOf(ctx)
+	err = r.statements().insertSnapshot.QueryRowContext(ctx,
+		formatTimestamp(now), historyID, snapshot.Operation, snapshot.NSXHost, tenant, string(sources),
+	).Scan(&snapshot.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert snapshot: %w", err)
+	}
+
+	snapshot.CreatedAt = now
+	snapshot.Tenant = tenant
+	return nil
+}
+
+// GetSnapshot returns a snapshot by ID, or sql.ErrNoRows.
+func (r *Repository) GetSnapshot(ctx context.Context, id int64) (*models.Snapshot, error) {
+	return scanSnapshot(r.statements().getSnapshot.QueryRowContext(ctx, tenantArgs(ctx, id)...))
+}
+
+// ListSnapshots returns up to limit snapshots, newest first, without the
+// documents of their sources.
+func (r *Repository) ListSnapshots(ctx context.Context, limit int) ([]models.Snapshot, error) {
+	rows, err := r.statements().listSnapshots.QueryContext(ctx, append(tenantArgs(ctx), limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []models.Snapshot{}
+	for rows.Next() {
+		s, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		for i := range s.Sources {
+			s.Sources[i].Source = nil
+		}
+		snapshots = append(snapshots, *s)
+	}
+
+	return snapshots, rows.Err()
+}
+
+func scanSnapshot(row rowScanner) (*models.Snapshot, error) {
+	var s models.Snapshot
+	var createdAt, sources string
+	var historyID sql.NullInt64
+	if err := row.Scan(&s.ID, &createdAt, &historyID, &s.Operation, &s.NSXHost, &s.Tenant, &sources); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if s.CreatedAt, err = parseTimestamp(createdAt); err != nil {
+		return nil, fmt.Errorf("snapshot %d: %w", s.ID, err)
+	}
+	if historyID.Valid {
+		s.HistoryID = &historyID.Int64
+	}
+	if err := json.Unmarshal([]byte(sources), &s.Sources); err != nil {
+		return nil, fmt.Errorf("snapshot %d: invalid sources: %w", s.ID, err)
+	}
+	return &s, nil
+}
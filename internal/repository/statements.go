@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// serverColumns and serverProbeStats select an inventory server with
+// aggregates over its probe history, in the order scanned by scanServer.
+const (
+	serverColumns = `s.id, s.nsx_host, s.domain_id, s.url, s.enabled, s.cert_fingerprint, s.cert_subject,
+		 s.cert_expires_at, s.cert_count, s.last_probe_at, s.last_probe_ok, s.last_probe_error, s.consecutive_failures,
+		 COALESCE(p.probes, 0), COALESCE(p.successes, 0), p.last_failure, s.first_seen_at, s.last_seen_at`
+	serverProbeStats = `LEFT JOIN (SELECT server_id, COUNT(*) AS probes, SUM(success) AS successes,
+		 MAX(CASE WHEN success = 0 THEN probed_at END) AS last_failure
+		 FROM probe_results GROUP BY server_id) p ON p.server_id = s.id`
+)
+
+// auditFilter restricts audit events to those matching an AuditFilter; see
+// AuditFilter.args.
+const auditFilter = `(? IS NULL OR actor = ?) AND (? IS NULL OR source_ip = ?) AND (? IS NULL OR operation = ?)
+	 AND (? IS NULL OR body_sha256 = ?) AND (? IS NULL OR created_at >= ?) AND (? IS NULL OR created_at <= ?)`
+
+// tenantFilter restricts a query to the rows of a tenant; a NULL tenant
+// matches every row (see tenantArgs).
+const tenantFilter = `(? IS NULL OR tenant = ?)`
+
+// statements holds prepared statements reused across requests.
+type statements struct {
+	insertHistory   *sql.Stmt
+	getHistory      *sql.Stmt
+	deleteHistory   *sql.Stmt
+	purgeHistory    *sql.Stmt
+	insertConfig    *sql.Stmt
+	updateConfig    *sql.Stmt
+	getConfig       *sql.Stmt
+	getConfigByName *sql.Stmt
+	listConfigs     *sql.Stmt
+	deleteConfig    *sql.Stmt
+	purgeConfig     *sql.Stmt
+	insertDocument  *sql.Stmt
+	getDocument     *sql.Stmt
+	listDocuments   *sql.Stmt
+	deleteDocument  *sql.Stmt
+	upsertServer    *sql.Stmt
+	recordProbe     *sql.Stmt
+	insertProbe     *sql.Stmt
+	listServers     *sql.Stmt
+	getServer       *sql.Stmt
+	listProbes      *sql.Stmt
+	pruneProbes     *sql.Stmt
+	insertAudit     *sql.Stmt
+	listAudit       *sql.Stmt
+	insertSnapshot  *sql.Stmt
+	getSnapshot     *sql.Stmt
+	listSnapshots   *sql.Stmt
+	listSettings    *sql.Stmt
+	upsertSetting   *sql.Stmt
+	insertHealth    *sql.Stmt
+	listHealth      *sql.Stmt
+	pruneHealth     *sql.Stmt
+}
+
+// prepareStatements prepares all fixed queries used by the repository.
+func prepareStatements(ctx context.Context, db *sql.DB) (*statements, error) {
+	st := &statements{}
+
+	queries := []struct {
+		dst   **sql.Stmt
+		query string
+	}{
+		{&st.insertHistory, `INSERT INTO history (created_at, initial, response, result, artifact_key, stats, encoding, size, domains, servers, certificates, tenant, run_id, domain_ids)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`},
+		{&st.getHistory, `SELECT id, created_at, initial, response, result, artifact_key, stats, encoding, size, tenant, run_id FROM history
+			 WHERE id = ? AND ` + tenantFilter},
+		{&st.deleteHistory, `DELETE FROM history WHERE id = ? AND ` + tenantFilter + ` RETURNING artifact_key`},
+		{&st.purgeHistory, `DELETE FROM history WHERE created_at < ? AND ` + tenantFilter + ` RETURNING artifact_key`},
+		{&st.insertConfig, `INSERT INTO nsx_configs (name, description, host, username, password, insecure, created_at, updated_at, tenant, sync_defaults)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`},
+		{&st.updateConfig, `UPDATE nsx_configs SET name=?, description=?, host=?, username=?, password=?, insecure=?, updated_at=?, sync_defaults=?
+			 WHERE id=? AND deleted_at IS NULL AND ` + tenantFilter + ` RETURNING created_at, tenant`},
+		{&st.getConfig, `SELECT id, name, description, host, username, password, insecure, created_at, updated_at, tenant, sync_defaults
+			 FROM nsx_configs WHERE id = ? AND deleted_at IS NULL AND ` + tenantFilter},
+		{&st.getConfigByName, `SELECT id, name, description, host, username, password, insecure, created_at, updated_at, tenant, sync_defaults
+			 FROM nsx_configs WHERE name = ? AND deleted_at IS NULL AND ` + tenantFilter + ` ORDER BY tenant`},
+		{&st.listConfigs, `SELECT id, name, description, host, username, insecure, created_at, updated_at, tenant, sync_defaults
+			 FROM nsx_configs WHERE deleted_at IS NULL AND ` + tenantFilter + ` ORDER BY name, tenant`},
+		{&st.deleteConfig, `UPDATE nsx_configs SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL AND ` + tenantFilter},
+		{&st.purgeConfig, `DELETE FROM nsx_configs WHERE id = ? AND ` + tenantFilter},
+		{&st.insertDocument, `INSERT INTO documents (name, kind, content, size, sha256, created_at, tenant)
+			 VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`},
+		{&st.getDocument, `SELECT id, name, kind, size, sha256, created_at, tenant, content FROM documents WHERE id = ? AND ` + tenantFilter},
+		{&st.listDocuments, `SELECT id, name, kind, size, sha256, created_at, tenant FROM documents WHERE ` + tenantFilter + `
+			 ORDER BY created_at DESC, id DESC`},
+		{&st.deleteDocument, `DELETE FROM documents WHERE id = ? AND ` + tenantFilter},
+		{&st.upsertServer, `INSERT INTO servers (nsx_host, domain_id, url, enabled, cert_fingerprint, cert_subject, cert_expires_at, cert_count, first_seen_at, last_seen_at)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT (nsx_host, domain_id, url) DO UPDATE SET enabled=excluded.enabled,
+			 cert_fingerprint=excluded.cert_fingerprint, cert_subject=excluded.cert_subject,
+			 cert_expires_at=excluded.cert_expires_at, cert_count=excluded.cert_count, last_seen_at=excluded.last_seen_at`},
+		{&st.recordProbe, `UPDATE servers SET last_probe_at=?, last_probe_ok=?, last_probe_error=?,
+			 consecutive_failures = CASE WHEN ? THEN 0 ELSE consecutive_failures + 1 END
+			 WHERE nsx_host=? AND url=?`},
+		{&st.insertProbe, `INSERT INTO probe_results (server_id, probed_at, success, error)
+			 SELECT id, ?, ?, ? FROM servers WHERE nsx_host=? AND url=?`},
+		{&st.listServers, `SELECT ` + serverColumns + ` FROM servers s ` + serverProbeStats + ` ORDER BY s.nsx_host, s.domain_id, s.url`},
+		{&st.getServer, `SELECT ` + serverColumns + ` FROM servers s ` + serverProbeStats + ` WHERE s.id = ?`},
+		{&st.listProbes, `SELECT probed_at, success, error FROM probe_results WHERE server_id = ?
+			 ORDER BY probed_at DESC, id DESC LIMIT ?`},
+		{&st.pruneProbes, `DELETE FROM probe_results WHERE probed_at < ?`},
+		{&st.insertAudit, `INSERT INTO audit_log (created_at, operation, origin, actor, nsx_host, source_ids, protected_source_ids, reason, outcome, error, run_id, client_cert, method, path, status, body_sha256, source_ip)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`},
+		{&st.listAudit, `SELECT id, created_at, operation, origin, actor, nsx_host, source_ids, protected_source_ids, reason, outcome, error, run_id, client_cert,
+			 method, path, status, body_sha256, source_ip
+			 FROM audit_log WHERE ` + auditFilter + ` ORDER BY created_at DESC, id DESC LIMIT ?`},
+		{&st.insertSnapshot, `INSERT INTO snapshots (created_at, history_id, operation, nsx_host, tenant, sources)
+			 VALUES (?, ?, ?, ?, ?, ?) RETURNING id`},
+		{&st.getSnapshot, `SELECT id, created_at, history_id, operation, nsx_host, tenant, sources FROM snapshots WHERE id = ? AND ` + tenantFilter},
+		{&st.listSnapshots, `SELECT id, created_at, history_id, operation, nsx_host, tenant, sources FROM snapshots
+			 WHERE ` + tenantFilter + ` ORDER BY created_at DESC, id DESC LIMIT ?`},
+		{&st.listSettings, `SELECT key, value, updated_at, updated_by FROM settings ORDER BY key`},
+		{&st.upsertSetting, `INSERT INTO settings (key, value, updated_at, updated_by) VALUES (?, ?, ?, ?)
+			 ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=excluded.updated_at, updated_by=excluded.updated_by`},
+		{&st.insertHealth, `INSERT INTO health_snapshots (taken_at, db_ok, db_error, db_size, history_count, nsx)
+			 VALUES (?, ?, ?, ?, ?, ?) RETURNING id`},
+		{&st.listHealth, `SELECT id, taken_at, db_ok, db_error, db_size, history_count, nsx FROM health_snapshots
+			 WHERE taken_at >= ? ORDER BY taken_at DESC, id DESC LIMIT ?`},
+		{&st.pruneHealth, `DELETE FROM health_snapshots WHERE taken_at < ?`},
+	}
+
+	for _, q := range queries {
+		stmt, err := db.PrepareContext(ctx, q.query)
+		if err != nil {
+			st.close()
+			return nil, fmt.Errorf("failed to prepare %q: %w", q.query, err)
+		}
+		*q.dst = stmt
+	}
+
+	return st, nil
+}
+
+// close closes all prepared statements.
+func (st *statements) close() {
+	for _, stmt := range []*sql.Stmt{
+		st.insertHistory, st.getHistory, st.deleteHistory, st.purgeHistory,
+		st.insertConfig, st.updateConfig, st.getConfig,
+		st.getConfigByName, st.listConfigs, st.deleteConfig,
+		st.purgeConfig, st.insertDocument, st.getDocument,
+		st.listDocuments, st.deleteDocument, st.upsertServer,
+		st.recordProbe, st.insertProbe, st.listServers, st.getServer, st.listProbes,
+		st.pruneProbes, st.insertAudit, st.listAudit, st.insertSnapshot, st.getSnapshot,
+		st.listSnapshots, st.listSettings, st.upsertSetting, st.insertHealth, st.listHealth,
+		st.pruneHealth,
+	} {
+		if stmt != nil {
+			_ = stmt.Close()
+		}
+	}
+}
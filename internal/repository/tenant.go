@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// tenantKey is the context key of the tenant.
+type tenantKey struct{}
+
+// WithTenant returns a context in which the repository sees and writes only
+// the NSX configurations and history of tenant. The default tenant is "".
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFrom returns the tenant of ctx, if it has one. Without a tenant,
+// the repository sees the rows of every tenant and writes to the default one.
+func TenantFrom(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// tenantArgs returns args followed by the arguments of tenantFilter for the
+// tenant of ctx.
+func tenantArgs(ctx context.Context, args ...any) []any {
+	tenant, ok := TenantFrom(ctx)
+	arg := sql.NullString{String: tenant, Valid: ok}
+	return append(args, arg, arg)
+}
+
+// tenantOf returns the tenant rows written with ctx belong to.
+func tenantOf(ctx context.Context) string {
+	tenant, _ := TenantFrom(ctx)
+	return tenant
+}
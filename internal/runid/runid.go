@@ -0,0 +1,57 @@
+// Package runid identifies a merge or sync run across systems: the run ID
+// carried by a context is logged with every record, stored with history
+// entries and audit events, and prefixes the request ids sent to NSX, so
+// that one grep finds everything a run did.
+package runid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// maxLength bounds the run IDs accepted from clients.
+const maxLength = 64
+
+// key is the context key of the run ID.
+type key struct{}
+
+// New returns a new run ID: the UTC time and a random suffix, as in
+// 20250115T103000Z-3f9a2c1b.
+func New() string {
+	var suffix [4]byte
+	_, _ = rand.Read(suffix[:])
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix[:])
+}
+
+// With returns ctx carrying the run ID id.
+func With(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, key{}, id)
+}
+
+// From returns the run ID of ctx, if it has one.
+func From(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(key{}).(string)
+	return id, ok && id != ""
+}
+
+// Valid reports whether id, given by a client, may be used as a run ID: 1
+// to 64 letters, digits, dots, dashes and underscores, so that it is safe
+// in logs and headers.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package runid_test
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"ldapmerge/internal/runid"
+)
+
+func TestNew(t *testing.T) {
+	id := runid.New()
+	if !regexp.MustCompile(`^\d{8}T\d{6}Z-[0-9a-f]{8}$`).MatchString(id) || !runid.Valid(id) {
+		t.Errorf("Unexpected run ID %q", id)
+	}
+	if id == runid.New() {
+		t.Errorf("Expected distinct run IDs, got %q twice", id)
+	}
+
+	ctx := runid.With(context.Background(), id)
+	if got, ok := runid.From(ctx); !ok || got != id {
+		t.Errorf("Expected %q from the context, got %q", id, got)
+	}
+	if _, ok := runid.From(context.Background()); ok {
+		t.Error("Expected no run ID without one")
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, id := range []string{"CHG-1234", "ansible.run_42"} {
+		if !runid.Valid(id) {
+			t.Errorf("Expected %q to be valid", id)
+		}
+	}
+	for _, id := range []string{"", "a b", "a\nb", "ключ", strings.Repeat("a", 65)} {
+		if runid.Valid(id) {
+			t.Errorf("Expected %q to be invalid", id)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Package signing signs merged output files so downstream change management
+// can prove that a pushed artifact was produced by ldapmerge and not edited
+// by hand.
+//
+// Two backends are supported: Ed25519 keys in PEM files (signatures are PEM
+// blocks with an "LDAPMERGE SIGNATURE" type), and GPG via the gpg binary
+// (ASCII-armored detached signatures).
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidSignature is returned when a signature does not match the data.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+const (
+	signatureType = "LDAPMERGE SIGNATURE"
+	pgpArmorStart = "-----BEGIN PGP SIGNATURE-----"
+)
+
+// Signer produces detached signatures.
+type Signer interface {
+	// Sign returns the detached signature file contents for data
+	Sign(ctx context.Context, data []byte) ([]byte, error)
+	// Extension is the conventional signature file extension, e.g. ".sig"
+	Extension() string
+}
+
+// Result describes a verified signature.
+type Result struct {
+	Algorithm string `json:"algorithm" doc:"Signature algorithm" example:"ed25519"`
+	KeyID     string `json:"key_id" doc:"Signing key identifier" example:"5d41402abc4b2a76"`
+	SHA256    string `json:"sha256,omitempty" doc:"SHA-256 of the signed data"`
+}
+
+// Ed25519Signer signs with an Ed25519 private key.
+type Ed25519Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// NewEd25519Signer loads a PKCS#8 PEM Ed25519 private key, as written by
+// "openssl genpkey -algorithm ed25519".
+func NewEd25519Signer(keyFile string) (*Ed25519Signer, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s: no PEM block found", keyFile)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", keyFile, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s: not an Ed25519 key", keyFile)
+	}
+
+	return &Ed25519Signer{key: key, keyID: KeyID(key.Public().(ed25519.PublicKey))}, nil
+}
+
+// Sign returns a PEM-encoded signature block for data.
+func (s *Ed25519Signer) Sign(_ context.Context, data []byte) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	return pem.EncodeToMemory(&pem.Block{
+		Type: signatureType,
+		Headers: map[string]string{
+			"Algorithm": "ed25519",
+			"Key-Id":    s.keyID,
+			"SHA256":    hex.EncodeToString(sum[:]),
+		},
+		Bytes: ed25519.Sign(s.key, data),
+	}), nil
+}
+
+// Extension returns ".sig".
+func (s *Ed25519Signer) Extension() string { return ".sig" }
+
+// KeyID returns a short identifier of an Ed25519 public key: the first 16
+// hex digits of the SHA-256 of its PKIX encoding.
+func KeyID(pub ed25519.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
+
+// LoadPublicKey loads a PKIX PEM Ed25519 public key, as written by
+// "openssl pkey -pubout".
+func LoadPublicKey(keyFile string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("public key %s: no PEM block found", keyFile)
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("public key %s: %w", keyFile, err)
+	}
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s: not an Ed25519 key", keyFile)
+	}
+	return key, nil
+}
+
+// VerifyEd25519 checks an ldapmerge signature block against data.
+func VerifyEd25519(data, signature []byte, pub ed25519.PublicKey) (*Result, error) {
+	block, _ := pem.Decode(signature)
+	if block == nil || block.Type != signatureType {
+		return nil, fmt.Errorf("%w: not an ldapmerge signature", ErrInvalidSignature)
+	}
+	if alg := block.Headers["Algorithm"]; alg != "ed25519" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidSignature, alg)
+	}
+
+	keyID := KeyID(pub)
+	if id := block.Headers["Key-Id"]; id != keyID {
+		return nil, fmt.Errorf("%w: signed with key %s, verifying with %s", ErrInvalidSignature, id, keyID)
+	}
+	if !ed25519.Verify(pub, data, block.Bytes) {
+		return nil, fmt.Errorf("%w: file was modified after signing", ErrInvalidSignature)
+	}
+
+	sum := sha256.Sum256(data)
+	return &Result{Algorithm: "ed25519", KeyID: keyID, SHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+// IsGPG reports whether signature is an ASCII-armored PGP signature.
+func IsGPG(signature []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(signature), []byte(pgpArmorStart))
+}
+
+// GPGSigner signs with a key from the local GPG keyring.
+type GPGSigner struct {
+	keyID string
+}
+
+// NewGPGSigner returns a signer using the GPG key with the given ID,
+// fingerprint or user ID. The gpg binary must be in PATH.
+func NewGPGSigner(keyID string) (*GPGSigner, error) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		return nil, fmt.Errorf("gpg signing requires the gpg binary: %w", err)
+	}
+	return &GPGSigner{keyID: keyID}, nil
+}
+
+// Sign returns an ASCII-armored detached GPG signature for data.
+func (s *GPGSigner) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "gpg", "--batch", "--yes", "--armor", "--detach-sign",
+		"--local-user", s.keyID, "--output", "-")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("gpg sign: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Extension returns ".asc".
+func (s *GPGSigner) Extension() string { return ".asc" }
+
+// VerifyGPG checks a detached GPG signature against data using the local
+// keyring.
+func VerifyGPG(ctx context.Context, data, signature []byte) (*Result, error) {
+	dir, err := os.MkdirTemp("", "ldapmerge-verify-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	sigFile := filepath.Join(dir, "output.asc")
+	if err := os.WriteFile(sigFile, signature, 0o600); err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "gpg", "--batch", "--status-fd", "1", "--verify", sigFile, "-")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	runErr := cmd.Run()
+
+	result := &Result{Algorithm: "gpg"}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == "[GNUPG:]" && fields[1] == "VALIDSIG" {
+			result.KeyID = fields[2]
+			sum := sha256.Sum256(data)
+			result.SHA256 = hex.EncodeToString(sum[:])
+			return result, nil
+		}
+	}
+
+	if runErr != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSignature, strings.TrimSpace(stderr.String()))
+	}
+	return nil, fmt.Errorf("%w: gpg reported no valid signature", ErrInvalidSignature)
+}
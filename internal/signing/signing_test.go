@@ -0,0 +1,103 @@
+package signing_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"ldapmerge/internal/signing"
+)
+
+func writeTestKey(t *testing.T) (string, ed25519.PublicKey) {
+	t.Helper()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return path, pub
+}
+
+func TestEd25519SignVerify(t *testing.T) {
+	keyFile, pub := writeTestKey(t)
+
+	signer, err := signing.NewEd25519Signer(keyFile)
+	if err != nil {
+		t.Fatalf("NewEd25519Signer failed: %v", err)
+	}
+
+	data := []byte(`[{"id": "example.lab"}]`)
+	sig, err := signer.Sign(context.Background(), data)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+
+	result, err := signing.VerifyEd25519(data, sig, pub)
+	if err != nil {
+		t.Fatalf("VerifyEd25519 failed: %v", err)
+	}
+	if result.KeyID != signing.KeyID(pub) {
+		t.Errorf("Expected key ID %s, got %s", signing.KeyID(pub), result.KeyID)
+	}
+
+	tampered := []byte(`[{"id": "evil.lab"}]`)
+	if _, err := signing.VerifyEd25519(tampered, sig, pub); !errors.Is(err, signing.ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for modified data, got %v", err)
+	}
+
+	_, otherPub := writeTestKey(t)
+	if _, err := signing.VerifyEd25519(data, sig, otherPub); !errors.Is(err, signing.ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for another key, got %v", err)
+	}
+}
+
+func TestGPGSignVerify(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not installed")
+	}
+
+	home := t.TempDir()
+	t.Setenv("GNUPGHOME", home)
+	t.Cleanup(func() { _ = exec.Command("gpgconf", "--kill", "gpg-agent").Run() })
+	gen := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "ldapmerge-test@example.lab", "ed25519", "sign", "never")
+	if out, err := gen.CombinedOutput(); err != nil {
+		t.Skipf("gpg key generation unavailable: %v: %s", err, out)
+	}
+
+	signer, err := signing.NewGPGSigner("ldapmerge-test@example.lab")
+	if err != nil {
+		t.Fatalf("NewGPGSigner failed: %v", err)
+	}
+
+	data := []byte(`[]`)
+	sig, err := signer.Sign(context.Background(), data)
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if !signing.IsGPG(sig) {
+		t.Fatalf("Expected armored PGP signature, got %s", sig)
+	}
+
+	if _, err := signing.VerifyGPG(context.Background(), data, sig); err != nil {
+		t.Errorf("VerifyGPG failed: %v", err)
+	}
+	if _, err := signing.VerifyGPG(context.Background(), []byte(`[1]`), sig); !errors.Is(err, signing.ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature for modified data, got %v", err)
+	}
+}
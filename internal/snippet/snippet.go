@@ -0,0 +1,101 @@
+// Package snippet renders saved NSX configurations as ldapmerge command
+// lines, so that a sync set up through the API can be run from the CLI.
+package snippet
+
+import (
+	"fmt"
+	"strings"
+
+	"ldapmerge/internal/models"
+)
+
+// Placeholders of the arguments a saved configuration does not know
+const (
+	ResponsePlaceholder = "certificates_response.json"
+	ReasonPlaceholder   = "CHG-0000: reason"
+)
+
+// Sync returns the ldapmerge sync command line of config, one argument per
+// line, with its sync defaults. The password is left out: the command reads
+// it from LDAPMERGE_NSX_PASSWORD, as a comment above it says.
+func Sync(config *models.NSXConfig) string {
+	defaults := config.SyncDefaults
+	if defaults == nil {
+		defaults = &models.SyncDefaults{}
+	}
+
+	args := [][]string{
+		{"--host", config.Host},
+		{"-u", config.Username},
+	}
+	if config.Insecure {
+		args = append(args, []string{"-k"})
+	}
+	if defaults.Strategy != "" {
+		args = append(args, []string{"--strategy", defaults.Strategy})
+	}
+	for _, pattern := range defaults.Domains {
+		args = append(args, []string{"--domain", pattern})
+	}
+	if defaults.Canary != "" {
+		args = append(args, []string{"--canary", defaults.Canary})
+	}
+	args = append(args, []string{"-r", ResponsePlaceholder})
+	if defaults.DryRun {
+		args = append(args, []string{"--dry-run"})
+	} else {
+		args = append(args, []string{"--reason", ReasonPlaceholder})
+	}
+
+	var b strings.Builder
+	comment := config.Name
+	if config.Description != "" {
+		comment += ": " + config.Description
+	}
+	fmt.Fprintf(&b, "# %s\n", oneLine(comment))
+	b.WriteString("# The password is not included: set LDAPMERGE_NSX_PASSWORD or add -P\n")
+	b.WriteString("ldapmerge sync")
+	for _, arg := range args {
+		b.WriteString(" \\\n  ")
+		for i, word := range arg {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(Quote(word))
+		}
+	}
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// Quote quotes s for a POSIX shell, unless it is made only of characters
+// that need no quoting.
+func Quote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	safe := true
+	for _, r := range s {
+		if !isSafe(r) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func isSafe(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+	return strings.ContainsRune("@%+=:,./_-", r)
+}
+
+// oneLine keeps a comment on one line.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
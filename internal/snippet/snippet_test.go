@@ -0,0 +1,64 @@
+package snippet_test
+
+import (
+	"strings"
+	"testing"
+
+	"ldapmerge/internal/models"
+	"ldapmerge/internal/snippet"
+)
+
+func TestSync(t *testing.T) {
+	config := &models.NSXConfig{
+		Name:        "prod",
+		Description: "Production\nNSX",
+		Host:        "https://nsx.example.com",
+		Username:    "admin",
+		Password:    "secret",
+		Insecure:    true,
+		SyncDefaults: &models.SyncDefaults{
+			Strategy: "append",
+			Domains:  []string{"*.example.lab"},
+			Canary:   "lab.example.lab",
+		},
+	}
+
+	got := snippet.Sync(config)
+	want := `# prod: Production NSX
+# The password is not included: set LDAPMERGE_NSX_PASSWORD or add -P
+ldapmerge sync \
+  --host https://nsx.example.com \
+  -u admin \
+  -k \
+  --strategy append \
+  --domain '*.example.lab' \
+  --canary lab.example.lab \
+  -r certificates_response.json \
+  --reason 'CHG-0000: reason'
+`
+	if got != want {
+		t.Errorf("Unexpected snippet:\n%s", got)
+	}
+	if strings.Contains(got, "secret") {
+		t.Error("Expected the password to be left out")
+	}
+
+	config.SyncDefaults = &models.SyncDefaults{DryRun: true}
+	if got := snippet.Sync(config); !strings.HasSuffix(got, "--dry-run\n") || strings.Contains(got, "--reason") {
+		t.Errorf("Expected a dry run without a reason:\n%s", got)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                        "''",
+		"admin":                   "admin",
+		"https://nsx.example.com": "https://nsx.example.com",
+		"it's":                    `'it'\''s'`,
+		"$HOME":                   "'$HOME'",
+	} {
+		if got := snippet.Quote(in); got != want {
+			t.Errorf("Quote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}